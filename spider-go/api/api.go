@@ -1,17 +1,21 @@
 package api
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"spider-go/cookie"
@@ -27,6 +31,26 @@ var (
 	userAgentMu sync.RWMutex
 )
 
+// transport carries every API request; nil uses http.DefaultTransport
+var transport http.RoundTripper
+
+// SetTransport sends every API request through rt, e.g. to a fake API
+// server. nil restores the default transport. Sessions created before the
+// call keep the transport they were created with.
+func SetTransport(rt http.RoundTripper) {
+	transport = rt
+}
+
+// Transport returns the transport set by SetTransport, nil for the default
+func Transport() http.RoundTripper {
+	return transport
+}
+
+// newClient returns an HTTP client on the API transport
+func newClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
 // SetUserAgent sets the global User-Agent for all API requests
 func SetUserAgent(ua string) {
 	userAgentMu.Lock()
@@ -64,62 +88,203 @@ var (
 	wbiKeyCacheSeconds = 3600
 )
 
+// Error is a non-zero code returned in a Bilibili API response
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorCode returns the API response code carried by err, or 0 if err is not
+// an API error (e.g. a network failure)
+func ErrorCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return 0
+}
+
 // Session wraps an HTTP client with cookie management
 type Session struct {
 	client        *http.Client
 	currentCookie string
 	headers       map[string]string
+	manager       *SessionManager    // recycles the session on auth failures, may be nil
+	pool          *cookie.CookiePool // counts the requests of each cookie, may be nil
+	born          time.Time          // when the session was created or last renewed
+	requests      atomic.Int64       // requests since born
+	mu            sync.RWMutex       // guards client, currentCookie, headers and born
+	renewMu       sync.Mutex         // held while the session retires or is recycled
 }
 
 // NewSession creates a new session with a cookie from the pool
 func NewSession(cookieConfigPath string) *Session {
 	pool := cookie.GetCookiePool(cookieConfigPath)
-	cookieValue := pool.GetCookie()
+	session := newSession(pool, pool.GetCookie())
+	session.warm()
+	return session
+}
 
+// newSession creates a session that sends cookieValue from pool
+func newSession(pool *cookie.CookiePool, cookieValue string) *Session {
+	return &Session{
+		client:        newClient(15 * time.Second),
+		currentCookie: cookieValue,
+		headers:       sessionHeaders(cookieValue),
+		pool:          pool,
+		born:          time.Now(),
+	}
+}
+
+// sessionHeaders returns the headers of a session sending cookieValue
+func sessionHeaders(cookieValue string) map[string]string {
 	headers := make(map[string]string)
 	for k, v := range getDefaultHeaders() {
 		headers[k] = v
 	}
 	headers["Cookie"] = cookieValue
+	return headers
+}
 
-	session := &Session{
-		client: &http.Client{
-			Timeout: 15 * time.Second,
-		},
-		currentCookie: cookieValue,
-		headers:       headers,
-	}
+// warmupURL is visited once by every new session
+var warmupURL = "https://www.bilibili.com/"
 
-	// Initialize session by visiting bilibili.com
-	req, _ := http.NewRequest("GET", "https://www.bilibili.com/", nil)
-	for k, v := range session.headers {
-		req.Header.Set(k, v)
+// warm initializes the session by visiting bilibili.com
+func (s *Session) warm() {
+	resp, err := s.send("GET", warmupURL)
+	if err == nil {
+		resp.Body.Close()
 	}
-	session.client.Do(req)
+}
 
-	return session
+// cookie returns the cookie the session currently sends
+func (s *Session) cookie() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.currentCookie
 }
 
-// doRequest performs an HTTP request with the session's headers
+// doRequest performs an HTTP request with the session's headers, first
+// retiring the session if it has reached its manager's limits and sending
+// any browsing noise. The response time is added to the endpoint's latency.
 func (s *Session) doRequest(method, urlStr string) (*http.Response, error) {
+	if s.manager != nil {
+		s.manager.retireIfDue(s)
+		s.manager.browse(s, urlStr)
+	}
+	start := time.Now()
+	resp, err := s.send(method, urlStr)
+	if err == nil {
+		RecordLatency(endpointOf(urlStr), time.Since(start))
+	}
+	return resp, err
+}
+
+// send performs an HTTP request with the session's headers
+func (s *Session) send(method, urlStr string) (*http.Response, error) {
 	req, err := http.NewRequest(method, urlStr, nil)
 	if err != nil {
 		return nil, err
 	}
 
+	s.mu.RLock()
 	for k, v := range s.headers {
 		req.Header.Set(k, v)
 	}
+	current := s.currentCookie
+	client := s.client
+	s.mu.RUnlock()
 
-	return s.client.Do(req)
+	s.requests.Add(1)
+	resp, err := client.Do(req)
+	return s.recordUsage(current, resp, err)
 }
 
 // handleCookieError marks the current cookie as invalid if needed
 func (s *Session) handleCookieError(code int, cookieConfigPath string) {
-	if cookie.IsCookieError(code) && s.currentCookie != "" {
+	s.mu.RLock()
+	current := s.currentCookie
+	s.mu.RUnlock()
+
+	if cookie.IsCookieError(code) && current != "" {
 		pool := cookie.GetCookiePool(cookieConfigPath)
-		pool.MarkInvalid(s.currentCookie, false)
+		pool.MarkInvalid(current, false)
+		if s.manager != nil {
+			s.manager.recycle(s, current)
+		}
+	}
+}
+
+// Rotate switches the session to the next cookie from the pool. It returns
+// false if the pool has no other usable cookie.
+func (s *Session) Rotate(cookieConfigPath string) bool {
+	pool := cookie.GetCookiePool(cookieConfigPath)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < pool.Len(); i++ {
+		next := pool.GetCookie()
+		if next != "" && next != s.currentCookie {
+			s.currentCookie = next
+			s.headers["Cookie"] = next
+			return true
+		}
+	}
+	return false
+}
+
+// getJSON performs a GET request and decodes the data field of the standard
+// {code, message, data} response envelope into out
+func getJSON(urlStr string, session *Session, cookieConfigPath string, out interface{}) error {
+	var resp *http.Response
+	var err error
+
+	if session != nil {
+		resp, err = session.doRequest("GET", urlStr)
+	} else {
+		req, _ := http.NewRequest("GET", urlStr, nil)
+		for k, v := range getDefaultHeaders() {
+			req.Header.Set(k, v)
+		}
+		client := newClient(10 * time.Second)
+		resp, err = client.Do(req)
+	}
+
+	if err != nil {
+		return err
 	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var data struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Data    json.RawMessage `json:"data"`
+	}
+
+	if err := decodeResponse(urlStr, body, &data); err != nil {
+		return err
+	}
+
+	if data.Code != 0 {
+		if session != nil {
+			session.handleCookieError(data.Code, cookieConfigPath)
+		}
+		return &Error{Code: data.Code, Message: data.Message}
+	}
+
+	if out == nil || len(data.Data) == 0 || string(data.Data) == "null" {
+		return nil
+	}
+	return unmarshalLenient(data.Data, out)
 }
 
 // md5Hash computes MD5 hash of a string
@@ -156,7 +321,7 @@ func getWbiKeys(session *Session) (string, string, error) {
 		for k, v := range getDefaultHeaders() {
 			req.Header.Set(k, v)
 		}
-		client := &http.Client{Timeout: 10 * time.Second}
+		client := newClient(10 * time.Second)
 		resp, err = client.Do(req)
 	}
 
@@ -179,7 +344,7 @@ func getWbiKeys(session *Session) (string, string, error) {
 		} `json:"data"`
 	}
 
-	if err := json.Unmarshal(body, &data); err != nil {
+	if err := decodeResponse(urlStr, body, &data); err != nil {
 		return "", "", err
 	}
 
@@ -278,7 +443,9 @@ func withRetry[T any](fn func() (T, error), config RetryConfig) (T, error) {
 	for attempt := 0; attempt <= config.MaxRetries; attempt++ {
 		ratelimit.WaitForToken()
 
+		release := ratelimit.AcquireSlot()
 		result, err := fn()
+		release()
 		if err == nil {
 			return result, nil
 		}
@@ -297,17 +464,10 @@ func withRetry[T any](fn func() (T, error), config RetryConfig) (T, error) {
 	return zero, lastErr
 }
 
-// SearchResult represents a video search result
-type SearchResult struct {
-	Videos   []map[string]interface{}
-	NumPages int
-}
-
-// SearchVideos searches for videos by keyword
-func SearchVideos(keyword string, page, pageSize int, session *Session, cookieConfigPath string) (*SearchResult, error) {
-	return withRetry(func() (*SearchResult, error) {
-		urlStr := fmt.Sprintf("https://api.bilibili.com/x/web-interface/search/type?page=%d&page_size=%d&keyword=%s&search_type=video&order=",
-			page, pageSize, url.QueryEscape(keyword))
+// GetVideoDetail fetches video details by BVID
+func GetVideoDetail(bvid string, session *Session, cookieConfigPath string) (map[string]interface{}, error) {
+	return withRetry(func() (map[string]interface{}, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/web-interface/view?bvid=%s", bvid)
 
 		var resp *http.Response
 		var err error
@@ -319,7 +479,7 @@ func SearchVideos(keyword string, page, pageSize int, session *Session, cookieCo
 			for k, v := range getDefaultHeaders() {
 				req.Header.Set(k, v)
 			}
-			client := &http.Client{Timeout: 15 * time.Second}
+			client := newClient(10 * time.Second)
 			resp, err = client.Do(req)
 		}
 
@@ -334,15 +494,12 @@ func SearchVideos(keyword string, page, pageSize int, session *Session, cookieCo
 		}
 
 		var data struct {
-			Code    int    `json:"code"`
-			Message string `json:"message"`
-			Data    struct {
-				Result   []map[string]interface{} `json:"result"`
-				NumPages int                      `json:"numPages"`
-			} `json:"data"`
+			Code    int                    `json:"code"`
+			Message string                 `json:"message"`
+			Data    map[string]interface{} `json:"data"`
 		}
 
-		if err := json.Unmarshal(body, &data); err != nil {
+		if err := decodeResponse(urlStr, body, &data); err != nil {
 			return nil, err
 		}
 
@@ -350,63 +507,69 @@ func SearchVideos(keyword string, page, pageSize int, session *Session, cookieCo
 			if session != nil {
 				session.handleCookieError(data.Code, cookieConfigPath)
 			}
-			return nil, fmt.Errorf("%s", data.Message)
+			return nil, &Error{Code: data.Code, Message: data.Message}
 		}
 
-		return &SearchResult{
-			Videos:   data.Data.Result,
-			NumPages: data.Data.NumPages,
-		}, nil
+		return data.Data, nil
 	}, DefaultRetryConfig())
 }
 
-// GetVideoDetail fetches video details by BVID
-func GetVideoDetail(bvid string, session *Session, cookieConfigPath string) (map[string]interface{}, error) {
+// GetVideoStat fetches the current counters of a video (view, danmaku,
+// reply, favorite, coin, share, like) without the rest of its details
+func GetVideoStat(bvid string, session *Session, cookieConfigPath string) (map[string]interface{}, error) {
 	return withRetry(func() (map[string]interface{}, error) {
-		urlStr := fmt.Sprintf("https://api.bilibili.com/x/web-interface/view?bvid=%s", bvid)
-
-		var resp *http.Response
-		var err error
-
-		if session != nil {
-			resp, err = session.doRequest("GET", urlStr)
-		} else {
-			req, _ := http.NewRequest("GET", urlStr, nil)
-			for k, v := range getDefaultHeaders() {
-				req.Header.Set(k, v)
-			}
-			client := &http.Client{Timeout: 10 * time.Second}
-			resp, err = client.Do(req)
-		}
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/web-interface/archive/stat?bvid=%s", bvid)
 
-		if err != nil {
+		var data map[string]interface{}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
 			return nil, err
 		}
-		defer resp.Body.Close()
+		return data, nil
+	}, DefaultRetryConfig())
+}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
+// OnlineCount is how many people are watching a video page right now, as
+// rounded text such as "1000+" or "1.2万+"
+type OnlineCount struct {
+	Total string `json:"total"` // across all platforms
+	Count string `json:"count"` // on the web player
+}
+
+// GetOnlineCount fetches the current viewer count of a video page
+func GetOnlineCount(bvid string, cid int64, session *Session, cookieConfigPath string) (*OnlineCount, error) {
+	return withRetry(func() (*OnlineCount, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/player/online/total?bvid=%s&cid=%d", bvid, cid)
+
+		var online OnlineCount
+		if err := getJSON(urlStr, session, cookieConfigPath, &online); err != nil {
 			return nil, err
 		}
+		return &online, nil
+	}, DefaultRetryConfig())
+}
 
-		var data struct {
-			Code    int                    `json:"code"`
-			Message string                 `json:"message"`
-			Data    map[string]interface{} `json:"data"`
-		}
+// VideoPage is one page (分P) of a video
+type VideoPage struct {
+	Cid      int64  `json:"cid"`
+	Page     int64  `json:"page"` // page number, from 1
+	Part     string `json:"part"` // page title
+	Duration int64  `json:"duration"`
+}
+
+// GetVideoPages lists every page of a video in order. Single-page videos
+// have one.
+func GetVideoPages(bvid string, session *Session, cookieConfigPath string) ([]VideoPage, error) {
+	return withRetry(func() ([]VideoPage, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/player/pagelist?bvid=%s", bvid)
 
-		if err := json.Unmarshal(body, &data); err != nil {
+		var pages []VideoPage
+		if err := getJSON(urlStr, session, cookieConfigPath, &pages); err != nil {
 			return nil, err
 		}
-
-		if data.Code != 0 {
-			if session != nil {
-				session.handleCookieError(data.Code, cookieConfigPath)
-			}
-			return nil, fmt.Errorf("%s", data.Message)
+		if len(pages) == 0 {
+			return nil, fmt.Errorf("video %s has no pages", bvid)
 		}
-
-		return data.Data, nil
+		return pages, nil
 	}, DefaultRetryConfig())
 }
 
@@ -427,13 +590,80 @@ func GetVideoAid(bvid string, session *Session, cookieConfigPath string) (int64,
 
 // MainCommentsResult represents the result of fetching main comments
 type MainCommentsResult struct {
-	Replies    []map[string]interface{}
+	Replies []map[string]interface{}
+	// TopReplies are the pinned comments, only returned with the first page
+	// and not repeated in Replies. Those pinned by the uploader, an admin or
+	// a vote carry pinned_by "upper", "admin" or "vote".
+	TopReplies []map[string]interface{}
 	NextCursor string
 	IsEnd      bool
+	// Total is the number of main comments, if the API reports it
+	Total int
+}
+
+// Main comment sort modes
+const (
+	CommentModeTime = 2
+	CommentModeHot  = 3
+)
+
+// Comment section types: the type parameter of the reply APIs
+const (
+	CommentTypeVideo       = 1
+	CommentTypeDynamicDraw = 11 // dynamics with pictures
+	CommentTypeDynamic     = 17 // text and forwarded dynamics
+)
+
+// topReplies collects the pinned comments of a main comment page from
+// top_replies and the upper/admin/vote entries of top, once per rpid. Each
+// comment found in top gets the entry's key as pinned_by.
+func topReplies(list []map[string]interface{}, top map[string]interface{}) []map[string]interface{} {
+	seen := make(map[string]map[string]interface{})
+	var out []map[string]interface{}
+	add := func(reply map[string]interface{}) map[string]interface{} {
+		if reply["rpid"] == nil {
+			return nil
+		}
+		rpid := fmt.Sprintf("%v", reply["rpid"])
+		if first, ok := seen[rpid]; ok {
+			return first
+		}
+		seen[rpid] = reply
+		out = append(out, reply)
+		return reply
+	}
+	for _, reply := range list {
+		add(reply)
+	}
+	for _, key := range []string{"upper", "admin", "vote"} {
+		reply, _ := top[key].(map[string]interface{})
+		if reply = add(reply); reply != nil && reply["pinned_by"] == nil {
+			reply["pinned_by"] = key
+		}
+	}
+	return out
 }
 
-// GetMainComments fetches main comments for a video
+// GetMainComments fetches main comments for a video, newest first
 func GetMainComments(oid int64, cursor string, session *Session, cookieConfigPath string) (*MainCommentsResult, error) {
+	return GetMainCommentsSorted(oid, cursor, CommentModeTime, session, cookieConfigPath)
+}
+
+// GetMainCommentsSorted fetches main comments for a video in the given sort
+// mode. Cursors are only valid within the mode that returned them.
+func GetMainCommentsSorted(oid int64, cursor string, mode int, session *Session, cookieConfigPath string) (*MainCommentsResult, error) {
+	return getMainComments(oid, CommentTypeVideo, cursor, mode, session, cookieConfigPath)
+}
+
+// GetDynamicComments fetches the main comments under a dynamic, newest
+// first. oid and commentType are the comment_id_str and comment_type the
+// dynamic reports (its own ID and CommentTypeDynamic for text dynamics).
+func GetDynamicComments(oid int64, commentType int, cursor string, session *Session, cookieConfigPath string) (*MainCommentsResult, error) {
+	return getMainComments(oid, commentType, cursor, CommentModeTime, session, cookieConfigPath)
+}
+
+// getMainComments fetches main comments of any comment section
+func getMainComments(oid int64, typeVal int, cursor string, mode int, session *Session, cookieConfigPath string) (*MainCommentsResult, error) {
 	return withRetry(func() (*MainCommentsResult, error) {
 		var paginationStr string
 		if cursor != "" {
@@ -444,9 +674,7 @@ func GetMainComments(oid int64, cursor string, session *Session, cookieConfigPat
 
 		paginationStrEncoded := url.QueryEscape(paginationStr)
 
-		mode := 2
 		plat := 1
-		typeVal := 1
 		webLocation := 1315875
 
 		mixinKey := GetWbiMixinKey(session)
@@ -487,7 +715,7 @@ func GetMainComments(oid int64, cursor string, session *Session, cookieConfigPat
 			for k, v := range getDefaultHeaders() {
 				req.Header.Set(k, v)
 			}
-			client := &http.Client{Timeout: 10 * time.Second}
+			client := newClient(10 * time.Second)
 			resp, err = client.Do(req)
 		}
 
@@ -505,8 +733,10 @@ func GetMainComments(oid int64, cursor string, session *Session, cookieConfigPat
 			Code    int    `json:"code"`
 			Message string `json:"message"`
 			Data    struct {
-				Replies []map[string]interface{} `json:"replies"`
-				Cursor  struct {
+				Replies    []map[string]interface{} `json:"replies"`
+				TopReplies []map[string]interface{} `json:"top_replies"`
+				Top        map[string]interface{}   `json:"top"`
+				Cursor     struct {
 					IsEnd           bool `json:"is_end"`
 					PaginationReply struct {
 						NextOffset string `json:"next_offset"`
@@ -515,7 +745,7 @@ func GetMainComments(oid int64, cursor string, session *Session, cookieConfigPat
 			} `json:"data"`
 		}
 
-		if err := json.Unmarshal(body, &data); err != nil {
+		if err := decodeResponse(urlStr, body, &data); err != nil {
 			return nil, err
 		}
 
@@ -523,7 +753,7 @@ func GetMainComments(oid int64, cursor string, session *Session, cookieConfigPat
 			if session != nil {
 				session.handleCookieError(data.Code, cookieConfigPath)
 			}
-			return nil, fmt.Errorf("%s", data.Message)
+			return nil, &Error{Code: data.Code, Message: data.Message}
 		}
 
 		replies := data.Data.Replies
@@ -540,12 +770,92 @@ func GetMainComments(oid int64, cursor string, session *Session, cookieConfigPat
 
 		return &MainCommentsResult{
 			Replies:    replies,
+			TopReplies: topReplies(data.Data.TopReplies, data.Data.Top),
 			NextCursor: nextCursor,
 			IsEnd:      isEnd,
 		}, nil
 	}, DefaultRetryConfig())
 }
 
+// LegacyCommentPageSize is the page size GetMainCommentsLegacy requests
+const LegacyCommentPageSize = 20
+
+// GetMainCommentsLegacy fetches page pn (from 1) of a video's main comments,
+// newest first, from the older page-numbered reply API. It needs no WBI
+// signature, so it can stand in when reply/wbi/main is risk-controlled.
+// NextCursor is the number of the next page.
+func GetMainCommentsLegacy(oid int64, pn int, session *Session, cookieConfigPath string) (*MainCommentsResult, error) {
+	return withRetry(func() (*MainCommentsResult, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/v2/reply?oid=%d&type=1&sort=0&ps=%d&pn=%d",
+			oid, LegacyCommentPageSize, pn)
+
+		var resp *http.Response
+		var err error
+
+		if session != nil {
+			resp, err = session.doRequest("GET", urlStr)
+		} else {
+			req, _ := http.NewRequest("GET", urlStr, nil)
+			for k, v := range getDefaultHeaders() {
+				req.Header.Set(k, v)
+			}
+			client := newClient(10 * time.Second)
+			resp, err = client.Do(req)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		var data struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+			Data    struct {
+				Replies []map[string]interface{} `json:"replies"`
+				Page    struct {
+					Count int `json:"count"`
+				} `json:"page"`
+				Upper struct {
+					Top map[string]interface{} `json:"top"`
+				} `json:"upper"`
+			} `json:"data"`
+		}
+
+		if err := decodeResponse(urlStr, body, &data); err != nil {
+			return nil, err
+		}
+
+		if data.Code != 0 {
+			if session != nil {
+				session.handleCookieError(data.Code, cookieConfigPath)
+			}
+			return nil, &Error{Code: data.Code, Message: data.Message}
+		}
+
+		replies := data.Data.Replies
+		if replies == nil {
+			replies = []map[string]interface{}{}
+		}
+
+		result := &MainCommentsResult{
+			Replies:    replies,
+			NextCursor: strconv.Itoa(pn + 1),
+			IsEnd:      len(replies) == 0 || pn*LegacyCommentPageSize >= data.Data.Page.Count,
+			Total:      data.Data.Page.Count,
+		}
+		if pn == 1 {
+			result.TopReplies = topReplies(nil, map[string]interface{}{"upper": data.Data.Upper.Top})
+		}
+		return result, nil
+	}, DefaultRetryConfig())
+}
+
 // ReplyCommentsResult represents the result of fetching reply comments
 type ReplyCommentsResult struct {
 	Replies    []map[string]interface{}
@@ -568,7 +878,7 @@ func GetReplyComments(oid int64, rootRpid int64, page, pageSize int, session *Se
 			for k, v := range getDefaultHeaders() {
 				req.Header.Set(k, v)
 			}
-			client := &http.Client{Timeout: 10 * time.Second}
+			client := newClient(10 * time.Second)
 			resp, err = client.Do(req)
 		}
 
@@ -593,7 +903,7 @@ func GetReplyComments(oid int64, rootRpid int64, page, pageSize int, session *Se
 			} `json:"data"`
 		}
 
-		if err := json.Unmarshal(body, &data); err != nil {
+		if err := decodeResponse(urlStr, body, &data); err != nil {
 			return nil, err
 		}
 
@@ -601,7 +911,7 @@ func GetReplyComments(oid int64, rootRpid int64, page, pageSize int, session *Se
 			if session != nil {
 				session.handleCookieError(data.Code, cookieConfigPath)
 			}
-			return nil, fmt.Errorf("%s", data.Message)
+			return nil, &Error{Code: data.Code, Message: data.Message}
 		}
 
 		replies := data.Data.Replies
@@ -631,7 +941,7 @@ func GetUserCard(mid string, session *Session, cookieConfigPath string) (map[str
 			for k, v := range getDefaultHeaders() {
 				req.Header.Set(k, v)
 			}
-			client := &http.Client{Timeout: 10 * time.Second}
+			client := newClient(10 * time.Second)
 			resp, err = client.Do(req)
 		}
 
@@ -651,7 +961,7 @@ func GetUserCard(mid string, session *Session, cookieConfigPath string) (map[str
 			Data    map[string]interface{} `json:"data"`
 		}
 
-		if err := json.Unmarshal(body, &data); err != nil {
+		if err := decodeResponse(urlStr, body, &data); err != nil {
 			return nil, err
 		}
 
@@ -659,9 +969,617 @@ func GetUserCard(mid string, session *Session, cookieConfigPath string) (map[str
 			if session != nil {
 				session.handleCookieError(data.Code, cookieConfigPath)
 			}
-			return nil, fmt.Errorf("%s", data.Message)
+			return nil, &Error{Code: data.Code, Message: data.Message}
 		}
 
 		return data.Data, nil
 	}, DefaultRetryConfig())
 }
+
+// GetUserInfo fetches the space profile of a user, which adds birthday,
+// school, tags, live room and official verification to what the card has
+func GetUserInfo(mid string, session *Session, cookieConfigPath string) (map[string]interface{}, error) {
+	return withRetry(func() (map[string]interface{}, error) {
+		params := map[string]string{
+			"mid":          mid,
+			"platform":     "web",
+			"web_location": "1550101",
+		}
+		wRid, wts := GenerateWbiSign(params, session)
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/space/wbi/acc/info?mid=%s&platform=web&web_location=1550101&w_rid=%s&wts=%d",
+			url.QueryEscape(mid), wRid, wts)
+
+		var data map[string]interface{}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}, DefaultRetryConfig())
+}
+
+// Upstat is the creator-scale totals of a user
+type Upstat struct {
+	ArchiveViews int64 // views of all their videos
+	ArticleViews int64 // views of all their articles
+	Likes        int64 // likes received
+}
+
+// GetUserUpstat fetches the view and like totals of a user's uploads. The
+// endpoint may return zeros to logged-out cookies.
+func GetUserUpstat(mid string, session *Session, cookieConfigPath string) (*Upstat, error) {
+	return withRetry(func() (*Upstat, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/space/upstat?mid=%s", url.QueryEscape(mid))
+
+		var data struct {
+			Archive struct {
+				View int64 `json:"view"`
+			} `json:"archive"`
+			Article struct {
+				View int64 `json:"view"`
+			} `json:"article"`
+			Likes int64 `json:"likes"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+		return &Upstat{
+			ArchiveViews: data.Archive.View,
+			ArticleViews: data.Article.View,
+			Likes:        data.Likes,
+		}, nil
+	}, DefaultRetryConfig())
+}
+
+// NavInfo is the login state of a cookie as reported by the nav endpoint
+type NavInfo struct {
+	IsLogin   bool   `json:"isLogin"`
+	Mid       int64  `json:"mid"`
+	Uname     string `json:"uname"`
+	VipStatus int    `json:"vipStatus"`
+}
+
+// GetNavInfo checks a single cookie value against the nav endpoint without
+// going through the cookie pool. A logged-out cookie is not an error.
+func GetNavInfo(cookieValue string) (*NavInfo, error) {
+	headers := getDefaultHeaders()
+	headers["Cookie"] = cookieValue
+	session := &Session{
+		client:  newClient(15 * time.Second),
+		headers: headers,
+	}
+
+	return withRetry(func() (*NavInfo, error) {
+		var info NavInfo
+		err := getJSON("https://api.bilibili.com/x/web-interface/nav", session, "", &info)
+		if ErrorCode(err) == -101 {
+			return &NavInfo{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &info, nil
+	}, DefaultRetryConfig())
+}
+
+// GetRelatedVideos fetches the videos recommended alongside a video
+func GetRelatedVideos(bvid string, session *Session, cookieConfigPath string) ([]map[string]interface{}, error) {
+	return withRetry(func() ([]map[string]interface{}, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/web-interface/archive/related?bvid=%s", bvid)
+
+		var videos []map[string]interface{}
+		if err := getJSON(urlStr, session, cookieConfigPath, &videos); err != nil {
+			return nil, err
+		}
+
+		if videos == nil {
+			videos = []map[string]interface{}{}
+		}
+		return videos, nil
+	}, DefaultRetryConfig())
+}
+
+// GetVideoTags fetches the tags of a video, each with its tag_id and
+// tag_name
+func GetVideoTags(bvid string, session *Session, cookieConfigPath string) ([]map[string]interface{}, error) {
+	return withRetry(func() ([]map[string]interface{}, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/tag/archive/tags?bvid=%s", bvid)
+
+		var tags []map[string]interface{}
+		if err := getJSON(urlStr, session, cookieConfigPath, &tags); err != nil {
+			return nil, err
+		}
+
+		if tags == nil {
+			tags = []map[string]interface{}{}
+		}
+		return tags, nil
+	}, DefaultRetryConfig())
+}
+
+// HotSearchTerm is one entry of the hot search (热搜) list
+type HotSearchTerm struct {
+	Keyword  string `json:"keyword"`
+	ShowName string `json:"show_name"`
+}
+
+// GetHotSearch fetches up to limit terms of the current hot search list,
+// hottest first
+func GetHotSearch(limit int, session *Session, cookieConfigPath string) ([]HotSearchTerm, error) {
+	return withRetry(func() ([]HotSearchTerm, error) {
+		params := map[string]string{
+			"limit":    strconv.Itoa(limit),
+			"platform": "web",
+		}
+		wRid, wts := GenerateWbiSign(params, session)
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/web-interface/wbi/search/square?limit=%d&platform=web&w_rid=%s&wts=%d",
+			limit, wRid, wts)
+
+		var data struct {
+			Trending struct {
+				List []HotSearchTerm `json:"list"`
+			} `json:"trending"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+
+		if data.Trending.List == nil {
+			return []HotSearchTerm{}, nil
+		}
+		return data.Trending.List, nil
+	}, DefaultRetryConfig())
+}
+
+// PopularResult represents a page of the popular (综合热门) video list
+type PopularResult struct {
+	Videos []map[string]interface{}
+	NoMore bool
+}
+
+// GetPopular fetches page pn of the popular video list
+func GetPopular(pn, ps int, session *Session, cookieConfigPath string) (*PopularResult, error) {
+	return withRetry(func() (*PopularResult, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/web-interface/popular?pn=%d&ps=%d", pn, ps)
+
+		var data struct {
+			List   []map[string]interface{} `json:"list"`
+			NoMore bool                     `json:"no_more"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+
+		if data.List == nil {
+			data.List = []map[string]interface{}{}
+		}
+		return &PopularResult{Videos: data.List, NoMore: data.NoMore}, nil
+	}, DefaultRetryConfig())
+}
+
+// GetRanking fetches the ranking (排行榜) videos of a partition; rid 0 is
+// the all-partition ranking
+func GetRanking(rid int, session *Session, cookieConfigPath string) ([]map[string]interface{}, error) {
+	return withRetry(func() ([]map[string]interface{}, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/web-interface/ranking/v2?rid=%d&type=all", rid)
+
+		var data struct {
+			List []map[string]interface{} `json:"list"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+
+		if data.List == nil {
+			return []map[string]interface{}{}, nil
+		}
+		return data.List, nil
+	}, DefaultRetryConfig())
+}
+
+// UserVideosResult represents a page of a user's uploads
+type UserVideosResult struct {
+	Videos []map[string]interface{}
+	Total  int // uploads in all pages
+}
+
+// GetUserVideos fetches page pn of a user's uploads, newest first
+func GetUserVideos(mid string, pn, ps int, session *Session, cookieConfigPath string) (*UserVideosResult, error) {
+	return withRetry(func() (*UserVideosResult, error) {
+		params := map[string]string{
+			"mid":          mid,
+			"pn":           strconv.Itoa(pn),
+			"ps":           strconv.Itoa(ps),
+			"order":        "pubdate",
+			"platform":     "web",
+			"web_location": "1550101",
+		}
+		wRid, wts := GenerateWbiSign(params, session)
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/space/wbi/arc/search?mid=%s&pn=%d&ps=%d&order=pubdate&platform=web&web_location=1550101&w_rid=%s&wts=%d",
+			url.QueryEscape(mid), pn, ps, wRid, wts)
+
+		var data struct {
+			List struct {
+				Vlist []map[string]interface{} `json:"vlist"`
+			} `json:"list"`
+			Page struct {
+				Count int `json:"count"`
+			} `json:"page"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+
+		videos := data.List.Vlist
+		if videos == nil {
+			videos = []map[string]interface{}{}
+		}
+		return &UserVideosResult{Videos: videos, Total: data.Page.Count}, nil
+	}, DefaultRetryConfig())
+}
+
+// DynamicsResult represents a page of a user's dynamics feed
+type DynamicsResult struct {
+	Items   []map[string]interface{}
+	Offset  string
+	HasMore bool
+}
+
+// GetUserDynamics fetches one page of a user's dynamics (动态) feed
+func GetUserDynamics(mid string, offset string, session *Session, cookieConfigPath string) (*DynamicsResult, error) {
+	return withRetry(func() (*DynamicsResult, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/polymer/web-dynamic/v1/feed/space?host_mid=%s&offset=%s&timezone_offset=-480",
+			mid, url.QueryEscape(offset))
+
+		var data struct {
+			Items   []map[string]interface{} `json:"items"`
+			Offset  string                   `json:"offset"`
+			HasMore bool                     `json:"has_more"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+
+		items := data.Items
+		if items == nil {
+			items = []map[string]interface{}{}
+		}
+
+		return &DynamicsResult{
+			Items:   items,
+			Offset:  data.Offset,
+			HasMore: data.HasMore && data.Offset != "",
+		}, nil
+	}, DefaultRetryConfig())
+}
+
+// TopicResult represents a page of the dynamics posted under a topic
+type TopicResult struct {
+	Items   []map[string]interface{}
+	Offset  string
+	HasMore bool
+}
+
+// GetTopicDynamics fetches a page of the dynamics posted under a topic (话题),
+// most popular first. Each item is a dynamic in the same form as a user's
+// dynamics feed.
+func GetTopicDynamics(topicID int64, offset string, session *Session, cookieConfigPath string) (*TopicResult, error) {
+	return withRetry(func() (*TopicResult, error) {
+		urlStr := fmt.Sprintf("https://app.bilibili.com/x/topic/web/details/cards?topic_id=%d&sort_by=0&offset=%s&page_size=20&source=Web",
+			topicID, url.QueryEscape(offset))
+
+		var data struct {
+			TopicCardList struct {
+				Items []struct {
+					DynamicCardItem map[string]interface{} `json:"dynamic_card_item"`
+				} `json:"items"`
+				Offset  string `json:"offset"`
+				HasMore bool   `json:"has_more"`
+			} `json:"topic_card_list"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+
+		items := []map[string]interface{}{}
+		for _, card := range data.TopicCardList.Items {
+			if card.DynamicCardItem != nil {
+				items = append(items, card.DynamicCardItem)
+			}
+		}
+
+		return &TopicResult{
+			Items:   items,
+			Offset:  data.TopicCardList.Offset,
+			HasMore: data.TopicCardList.HasMore && data.TopicCardList.Offset != "",
+		}, nil
+	}, DefaultRetryConfig())
+}
+
+// GetLiveRoom fetches the live room of a user: room id, title, area and
+// live status (0 offline, 1 live, 2 rotating replays). It returns nil if the
+// user has never opened a room.
+func GetLiveRoom(mid string, session *Session, cookieConfigPath string) (map[string]interface{}, error) {
+	return withRetry(func() (map[string]interface{}, error) {
+		urlStr := fmt.Sprintf("https://api.live.bilibili.com/room/v1/Room/get_status_info_by_uids?uids[]=%s", mid)
+
+		// Users without a room come back as an empty array instead of a map
+		var data json.RawMessage
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+		if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+			return nil, nil
+		}
+
+		var rooms map[string]map[string]interface{}
+		if err := json.Unmarshal(data, &rooms); err != nil {
+			return nil, err
+		}
+		return rooms[mid], nil
+	}, DefaultRetryConfig())
+}
+
+// GetLiveRoomInfo fetches the live room a user has opened, looked up by mid:
+// room id, URL, title, cover and live status (0 offline, 1 live, 2 rotating
+// replays). It returns nil if the user has never opened a room, which tells
+// pure video creators apart from streamers.
+func GetLiveRoomInfo(mid string, session *Session, cookieConfigPath string) (map[string]interface{}, error) {
+	return withRetry(func() (map[string]interface{}, error) {
+		urlStr := fmt.Sprintf("https://api.live.bilibili.com/room/v1/Room/getRoomInfoOld?mid=%s", url.QueryEscape(mid))
+
+		var data map[string]interface{}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+		if status, _ := data["roomStatus"].(float64); status == 0 {
+			return nil, nil
+		}
+		return data, nil
+	}, DefaultRetryConfig())
+}
+
+// RelationsResult represents a page of a user's followings or followers
+type RelationsResult struct {
+	List  []map[string]interface{}
+	Total int
+}
+
+// GetUserRelations fetches one page of a user's followings or followers.
+// relationType must be "followings" or "followers".
+func GetUserRelations(mid string, relationType string, page, pageSize int, session *Session, cookieConfigPath string) (*RelationsResult, error) {
+	if relationType != "followings" && relationType != "followers" {
+		return nil, fmt.Errorf("unknown relation type: %s", relationType)
+	}
+
+	return withRetry(func() (*RelationsResult, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/relation/%s?vmid=%s&pn=%d&ps=%d&order=desc",
+			relationType, mid, page, pageSize)
+
+		var data struct {
+			List  []map[string]interface{} `json:"list"`
+			Total int                      `json:"total"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+
+		list := data.List
+		if list == nil {
+			list = []map[string]interface{}{}
+		}
+
+		return &RelationsResult{
+			List:  list,
+			Total: data.Total,
+		}, nil
+	}, DefaultRetryConfig())
+}
+
+// FavFolder is one of a user's favorite folders
+type FavFolder struct {
+	ID         int64  `json:"id"`
+	Title      string `json:"title"`
+	Attr       int    `json:"attr"`
+	MediaCount int    `json:"media_count"`
+}
+
+// Public reports whether the folder is visible to other users
+func (f FavFolder) Public() bool {
+	return f.Attr&1 == 0
+}
+
+// GetFavFolders fetches the favorite folders a user created
+func GetFavFolders(mid string, session *Session, cookieConfigPath string) ([]FavFolder, error) {
+	return withRetry(func() ([]FavFolder, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/v3/fav/folder/created/list-all?up_mid=%s", mid)
+
+		var data struct {
+			List []FavFolder `json:"list"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+		return data.List, nil
+	}, DefaultRetryConfig())
+}
+
+// FavResult represents a page of a favorite folder's contents
+type FavResult struct {
+	Medias  []map[string]interface{}
+	HasMore bool
+}
+
+// GetFavResources fetches one page of the items in a favorite folder
+func GetFavResources(folderID int64, page, pageSize int, session *Session, cookieConfigPath string) (*FavResult, error) {
+	return withRetry(func() (*FavResult, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/v3/fav/resource/list?media_id=%d&pn=%d&ps=%d&platform=web",
+			folderID, page, pageSize)
+
+		var data struct {
+			Medias  []map[string]interface{} `json:"medias"`
+			HasMore bool                     `json:"has_more"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+
+		medias := data.Medias
+		if medias == nil {
+			medias = []map[string]interface{}{}
+		}
+		return &FavResult{Medias: medias, HasMore: data.HasMore}, nil
+	}, DefaultRetryConfig())
+}
+
+// DashStream is one video or audio track of a DASH playurl response
+type DashStream struct {
+	ID        int      `json:"id"` // video: 120 4K, 80 1080P, 64 720P, 32 480P, 16 360P
+	BaseURL   string   `json:"baseUrl"`
+	BackupURL []string `json:"backupUrl"`
+	Bandwidth int64    `json:"bandwidth"`
+	Codecs    string   `json:"codecs"`
+	Width     int      `json:"width"`
+	Height    int      `json:"height"`
+}
+
+// PlayURL holds the DASH streams of one video page
+type PlayURL struct {
+	Quality int
+	Video   []DashStream
+	Audio   []DashStream
+}
+
+// GetPlayURL fetches the DASH stream URLs of a video page, asking for quality
+// qn. The streams actually offered depend on the login state of the cookie.
+func GetPlayURL(bvid string, cid int64, qn int, session *Session, cookieConfigPath string) (*PlayURL, error) {
+	return withRetry(func() (*PlayURL, error) {
+		params := map[string]string{
+			"bvid":  bvid,
+			"cid":   fmt.Sprintf("%d", cid),
+			"qn":    fmt.Sprintf("%d", qn),
+			"fnval": "4048", // DASH with all codecs
+			"fourk": "1",
+		}
+		wRid, wts := GenerateWbiSign(params, session)
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/player/wbi/playurl?bvid=%s&cid=%d&qn=%d&fnval=4048&fourk=1&w_rid=%s&wts=%d",
+			bvid, cid, qn, wRid, wts)
+
+		var data struct {
+			Quality int `json:"quality"`
+			Dash    *struct {
+				Video []DashStream `json:"video"`
+				Audio []DashStream `json:"audio"`
+			} `json:"dash"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+		if data.Dash == nil {
+			return nil, fmt.Errorf("no DASH streams for %s", bvid)
+		}
+
+		return &PlayURL{
+			Quality: data.Quality,
+			Video:   data.Dash.Video,
+			Audio:   data.Dash.Audio,
+		}, nil
+	}, DefaultRetryConfig())
+}
+
+// SubtitleTrack is one CC subtitle language of a video page
+type SubtitleTrack struct {
+	ID     int64  `json:"id"`
+	Lan    string `json:"lan"`
+	LanDoc string `json:"lan_doc"`
+	URL    string `json:"subtitle_url"`
+	AIType int    `json:"ai_type"` // non-zero for machine-generated subtitles
+}
+
+// GetSubtitleTracks lists the CC subtitles of a video page. Subtitle URLs are
+// only returned to logged-in cookies.
+func GetSubtitleTracks(bvid string, cid int64, session *Session, cookieConfigPath string) ([]SubtitleTrack, error) {
+	return withRetry(func() ([]SubtitleTrack, error) {
+		params := map[string]string{
+			"bvid": bvid,
+			"cid":  fmt.Sprintf("%d", cid),
+		}
+		wRid, wts := GenerateWbiSign(params, session)
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/player/wbi/v2?bvid=%s&cid=%d&w_rid=%s&wts=%d",
+			bvid, cid, wRid, wts)
+
+		var data struct {
+			Subtitle struct {
+				Subtitles []SubtitleTrack `json:"subtitles"`
+			} `json:"subtitle"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+
+		tracks := data.Subtitle.Subtitles
+		for i := range tracks {
+			if strings.HasPrefix(tracks[i].URL, "//") {
+				tracks[i].URL = "https:" + tracks[i].URL
+			}
+		}
+		return tracks, nil
+	}, DefaultRetryConfig())
+}
+
+// GetSubtitle downloads the JSON body of a subtitle track
+func GetSubtitle(urlStr string) (map[string]interface{}, error) {
+	return withRetry(func() (map[string]interface{}, error) {
+		var buf bytes.Buffer
+		if _, err := Download(urlStr, &buf, 16<<20); err != nil {
+			return nil, err
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &body); err != nil {
+			return nil, err
+		}
+		return body, nil
+	}, DefaultRetryConfig())
+}
+
+// Subtitle is a downloaded CC subtitle track of a video page
+type Subtitle struct {
+	Track SubtitleTrack
+	Text  string // the content of every line, one per line
+}
+
+// GetSubtitles downloads the CC subtitle tracks of a video page that want
+// accepts (nil accepts all). Tracks without a URL, which logged-out cookies
+// get, are skipped.
+func GetSubtitles(bvid string, cid int64, want func(SubtitleTrack) bool, session *Session, cookieConfigPath string) ([]Subtitle, error) {
+	tracks, err := GetSubtitleTracks(bvid, cid, session, cookieConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	subtitles := []Subtitle{}
+	for _, track := range tracks {
+		if track.URL == "" || want != nil && !want(track) {
+			continue
+		}
+		body, err := GetSubtitle(track.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", track.Lan, err)
+		}
+		subtitles = append(subtitles, Subtitle{Track: track, Text: subtitleText(body)})
+	}
+	return subtitles, nil
+}
+
+// subtitleText joins the content of the lines of a subtitle body
+func subtitleText(body map[string]interface{}) string {
+	lines, _ := body["body"].([]interface{})
+	var text []string
+	for _, line := range lines {
+		entry, _ := line.(map[string]interface{})
+		if content, _ := entry["content"].(string); content != "" {
+			text = append(text, content)
+		}
+	}
+	return strings.Join(text, "\n")
+}
@@ -1,6 +1,15 @@
 package api
 
 import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -157,6 +166,25 @@ func TestSession_Headers(t *testing.T) {
 	}
 }
 
+func TestSession_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	os.WriteFile(path, []byte(`{"cookies": [
+		{"name": "a", "value": "SESSDATA=a", "enabled": true},
+		{"name": "b", "value": "SESSDATA=b", "enabled": true}
+	]}`), 0644)
+
+	session := &Session{
+		currentCookie: "SESSDATA=a",
+		headers:       map[string]string{"Cookie": "SESSDATA=a"},
+	}
+	if !session.Rotate(path) {
+		t.Fatal("Rotate should switch to the other cookie")
+	}
+	if session.headers["Cookie"] != "SESSDATA=b" || session.currentCookie != "SESSDATA=b" {
+		t.Errorf("Cookie header = %q, expected SESSDATA=b", session.headers["Cookie"])
+	}
+}
+
 func TestSetUserAgent(t *testing.T) {
 	originalUA := GetUserAgent()
 
@@ -175,3 +203,397 @@ func TestSetUserAgent(t *testing.T) {
 	// Restore original
 	SetUserAgent(originalUA)
 }
+
+func TestGetJSON(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.Write([]byte(`{"code":-404,"message":"啥都木有","data":null}`))
+			return
+		}
+		w.Write([]byte(`{"code":0,"message":"0","data":[{"bvid":"BV1"},{"bvid":"BV2"}]}`))
+	}))
+	defer server.Close()
+
+	var videos []map[string]interface{}
+	if err := getJSON(server.URL, nil, "", &videos); err != nil {
+		t.Fatalf("getJSON failed: %v", err)
+	}
+	if len(videos) != 2 || videos[1]["bvid"] != "BV2" {
+		t.Errorf("Unexpected data: %v", videos)
+	}
+
+	err := getJSON(server.URL+"?fail=1", nil, "", &videos)
+	if err == nil {
+		t.Error("Expected error for non-zero code")
+	}
+	if ErrorCode(err) != -404 {
+		t.Errorf("ErrorCode = %d, expected -404", ErrorCode(err))
+	}
+}
+
+// roundTripFunc adapts a function to an http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestSetTransport(t *testing.T) {
+	var requested string
+	SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.URL.String()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader(`{"code":0,"data":{"card":{"mid":"42"}}}`)),
+			Request:    req,
+		}, nil
+	}))
+	t.Cleanup(func() { SetTransport(nil) })
+
+	data, err := GetUserCard("42", nil, "")
+	if err != nil {
+		t.Fatalf("GetUserCard failed: %v", err)
+	}
+	if card, _ := data["card"].(map[string]interface{}); card["mid"] != "42" {
+		t.Errorf("Unexpected data: %v", data)
+	}
+	if !strings.HasPrefix(requested, "https://api.bilibili.com/x/web-interface/card?mid=42") {
+		t.Errorf("Request went to %q", requested)
+	}
+}
+
+func TestGetUserInfo(t *testing.T) {
+	var requested *url.URL
+	SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"code":0,"data":{"wbi_img":{"img_url":"https://i0.hdslb.com/bfs/wbi/a.png","sub_url":"https://i0.hdslb.com/bfs/wbi/b.png"}}}`
+		if req.URL.Path == "/x/space/wbi/acc/info" {
+			requested = req.URL
+			body = `{"code":0,"data":{"mid":42,"name":"up","birthday":"01-01","school":{"name":"x"}}}`
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	}))
+	t.Cleanup(func() { SetTransport(nil) })
+
+	info, err := GetUserInfo("42", nil, "")
+	if err != nil {
+		t.Fatalf("GetUserInfo failed: %v", err)
+	}
+	if info["birthday"] != "01-01" || info["school"] == nil {
+		t.Errorf("Unexpected data: %v", info)
+	}
+	if requested == nil {
+		t.Fatal("space info endpoint was not requested")
+	}
+	query := requested.Query()
+	if query.Get("mid") != "42" || query.Get("w_rid") == "" || query.Get("wts") == "" {
+		t.Errorf("Request is not WBI-signed: %s", requested)
+	}
+}
+
+func TestGetUserUpstat(t *testing.T) {
+	SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"code":0,"data":{"archive":{"view":1234},"article":{"view":56},"likes":78}}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	}))
+	t.Cleanup(func() { SetTransport(nil) })
+
+	upstat, err := GetUserUpstat("42", nil, "")
+	if err != nil {
+		t.Fatalf("GetUserUpstat failed: %v", err)
+	}
+	if *upstat != (Upstat{ArchiveViews: 1234, ArticleViews: 56, Likes: 78}) {
+		t.Errorf("Unexpected upstat: %+v", upstat)
+	}
+}
+
+func TestGetMainCommentsLegacy(t *testing.T) {
+	var requested *url.URL
+	SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.URL
+		body := `{"code":0,"data":{"page":{"num":1,"size":20,"count":21},` +
+			`"replies":[{"rpid":2,"mid":1,"ctime":1,"rcount":0,"content":{"message":"hi"},"member":{}}],` +
+			`"upper":{"top":{"rpid":1,"mid":1,"ctime":1,"rcount":0,"content":{"message":"top"},"member":{}}}}}`
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	}))
+	t.Cleanup(func() { SetTransport(nil) })
+
+	result, err := GetMainCommentsLegacy(42, 1, nil, "")
+	if err != nil {
+		t.Fatalf("GetMainCommentsLegacy failed: %v", err)
+	}
+	if requested.Path != "/x/v2/reply" || requested.Query().Get("oid") != "42" || requested.Query().Get("pn") != "1" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(result.Replies) != 1 || len(result.TopReplies) != 1 {
+		t.Errorf("got %d replies and %d top replies, expected 1 and 1", len(result.Replies), len(result.TopReplies))
+	}
+	if result.IsEnd || result.NextCursor != "2" {
+		t.Errorf("IsEnd = %v, NextCursor = %q; expected more from page 2", result.IsEnd, result.NextCursor)
+	}
+
+	// The second page is the last of 21 comments and repeats no top reply
+	result, err = GetMainCommentsLegacy(42, 2, nil, "")
+	if err != nil {
+		t.Fatalf("GetMainCommentsLegacy failed: %v", err)
+	}
+	if !result.IsEnd || len(result.TopReplies) != 0 {
+		t.Errorf("IsEnd = %v with %d top replies on the last page", result.IsEnd, len(result.TopReplies))
+	}
+}
+
+// serveBody answers every request with body, recording the last request URL
+func serveBody(t *testing.T, body string) *url.URL {
+	requested := &url.URL{}
+	SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		*requested = *req.URL
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	}))
+	t.Cleanup(func() { SetTransport(nil) })
+	return requested
+}
+
+func TestGetOnlineCount(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"total":"1.2万+","count":"3000+","show_switch":{"total":true,"count":true}}}`)
+
+	online, err := GetOnlineCount("BV1", 42, nil, "")
+	if err != nil {
+		t.Fatalf("GetOnlineCount failed: %v", err)
+	}
+	if requested.Path != "/x/player/online/total" || requested.Query().Get("bvid") != "BV1" || requested.Query().Get("cid") != "42" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if *online != (OnlineCount{Total: "1.2万+", Count: "3000+"}) {
+		t.Errorf("online = %+v", online)
+	}
+}
+
+func TestGetVideoPages(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":[{"cid":10,"page":1,"part":"上","duration":60},{"cid":11,"page":2,"part":"下","duration":90}]}`)
+
+	pages, err := GetVideoPages("BV1", nil, "")
+	if err != nil {
+		t.Fatalf("GetVideoPages failed: %v", err)
+	}
+	if requested.Path != "/x/player/pagelist" || requested.Query().Get("bvid") != "BV1" {
+		t.Errorf("Request went to %s", requested)
+	}
+	expected := []VideoPage{{Cid: 10, Page: 1, Part: "上", Duration: 60}, {Cid: 11, Page: 2, Part: "下", Duration: 90}}
+	if !reflect.DeepEqual(pages, expected) {
+		t.Errorf("pages = %+v, expected %+v", pages, expected)
+	}
+}
+
+func TestGetVideoTags(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":[{"tag_id":1,"tag_name":"音乐"},{"tag_id":2,"tag_name":"翻唱"}]}`)
+
+	tags, err := GetVideoTags("BV1xx411c7mD", nil, "")
+	if err != nil {
+		t.Fatalf("GetVideoTags failed: %v", err)
+	}
+	if requested.Path != "/x/tag/archive/tags" || requested.Query().Get("bvid") != "BV1xx411c7mD" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(tags) != 2 || tags[1]["tag_name"] != "翻唱" {
+		t.Errorf("tags = %v", tags)
+	}
+}
+
+func TestGetUserVideos(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"list":{"vlist":[{"aid":1,"bvid":"BV1","title":"a","length":"03:21"}]},`+
+		`"page":{"pn":2,"ps":30,"count":31}}}`)
+
+	result, err := GetUserVideos("7", 2, 30, nil, "")
+	if err != nil {
+		t.Fatalf("GetUserVideos failed: %v", err)
+	}
+	query := requested.Query()
+	if requested.Path != "/x/space/wbi/arc/search" || query.Get("mid") != "7" || query.Get("pn") != "2" || query.Get("w_rid") == "" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(result.Videos) != 1 || result.Total != 31 {
+		t.Errorf("got %d videos of %d", len(result.Videos), result.Total)
+	}
+}
+
+func TestGetUserDynamics(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"items":[{"id_str":"901","modules":{}}],"offset":"901","has_more":true}}`)
+
+	result, err := GetUserDynamics("7", "900 1", nil, "")
+	if err != nil {
+		t.Fatalf("GetUserDynamics failed: %v", err)
+	}
+	if requested.Path != "/x/polymer/web-dynamic/v1/feed/space" || requested.Query().Get("host_mid") != "7" || requested.Query().Get("offset") != "900 1" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(result.Items) != 1 || result.Offset != "901" || !result.HasMore {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestGetUserDynamics_LastPage(t *testing.T) {
+	serveBody(t, `{"code":0,"data":{"items":null,"offset":"","has_more":true}}`)
+
+	result, err := GetUserDynamics("7", "", nil, "")
+	if err != nil {
+		t.Fatalf("GetUserDynamics failed: %v", err)
+	}
+	if result.Items == nil || result.HasMore {
+		t.Errorf("result = %+v, expected an empty last page", result)
+	}
+}
+
+func TestGetUserRelations(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"list":[{"mid":8,"uname":"a"},{"mid":9,"uname":"b"}],"re_version":0,"total":52}}`)
+
+	result, err := GetUserRelations("7", "followers", 2, 50, nil, "")
+	if err != nil {
+		t.Fatalf("GetUserRelations failed: %v", err)
+	}
+	query := requested.Query()
+	if requested.Path != "/x/relation/followers" || query.Get("vmid") != "7" || query.Get("pn") != "2" || query.Get("ps") != "50" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(result.List) != 2 || result.Total != 52 {
+		t.Errorf("got %d entries of %d", len(result.List), result.Total)
+	}
+}
+
+func TestGetUserRelations_UnknownType(t *testing.T) {
+	if _, err := GetUserRelations("7", "friends", 1, 50, nil, ""); err == nil {
+		t.Error("GetUserRelations accepted an unknown relation type")
+	}
+}
+
+func TestGetLiveRoomInfo(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"roomStatus":1,"roundStatus":0,"liveStatus":1,"title":"直播中","roomid":21}}`)
+
+	room, err := GetLiveRoomInfo("7", nil, "")
+	if err != nil {
+		t.Fatalf("GetLiveRoomInfo failed: %v", err)
+	}
+	if requested.Host != "api.live.bilibili.com" || requested.Path != "/room/v1/Room/getRoomInfoOld" || requested.Query().Get("mid") != "7" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if room["roomid"] != float64(21) || room["liveStatus"] != float64(1) {
+		t.Errorf("room = %v", room)
+	}
+}
+
+func TestGetLiveRoomInfo_NoRoom(t *testing.T) {
+	serveBody(t, `{"code":0,"data":{"roomStatus":0,"roundStatus":0,"liveStatus":0,"url":"","title":"","roomid":0}}`)
+
+	room, err := GetLiveRoomInfo("7", nil, "")
+	if err != nil {
+		t.Fatalf("GetLiveRoomInfo failed: %v", err)
+	}
+	if room != nil {
+		t.Errorf("room = %v, expected nil for a user without a room", room)
+	}
+}
+
+func TestGetHotSearch(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"trending":{"title":"bilibili热搜","list":[`+
+		`{"keyword":"新番","show_name":"新番定档"},{"keyword":"游戏","show_name":"游戏"}]}}}`)
+
+	terms, err := GetHotSearch(10, nil, "")
+	if err != nil {
+		t.Fatalf("GetHotSearch failed: %v", err)
+	}
+	if requested.Path != "/x/web-interface/wbi/search/square" || requested.Query().Get("limit") != "10" || requested.Query().Get("w_rid") == "" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(terms) != 2 || terms[0].Keyword != "新番" || terms[0].ShowName != "新番定档" {
+		t.Errorf("terms = %+v", terms)
+	}
+}
+
+func TestGetPopular(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"list":[{"bvid":"BV1","aid":1}],"no_more":true}}`)
+
+	result, err := GetPopular(2, 20, nil, "")
+	if err != nil {
+		t.Fatalf("GetPopular failed: %v", err)
+	}
+	if requested.Path != "/x/web-interface/popular" || requested.Query().Get("pn") != "2" || requested.Query().Get("ps") != "20" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(result.Videos) != 1 || !result.NoMore {
+		t.Errorf("got %d videos, NoMore = %v", len(result.Videos), result.NoMore)
+	}
+}
+
+func TestGetRanking(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"note":"","list":null}}`)
+
+	videos, err := GetRanking(3, nil, "")
+	if err != nil {
+		t.Fatalf("GetRanking failed: %v", err)
+	}
+	if requested.Path != "/x/web-interface/ranking/v2" || requested.Query().Get("rid") != "3" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if videos == nil || len(videos) != 0 {
+		t.Errorf("videos = %v, expected an empty list", videos)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	err := error(&Error{Code: -412, Message: "请求被拦截"})
+	if ErrorCode(err) != -412 {
+		t.Errorf("ErrorCode = %d, expected -412", ErrorCode(err))
+	}
+	if err.Error() != "请求被拦截" {
+		t.Errorf("Error() = %q, expected message", err.Error())
+	}
+
+	wrapped := fmt.Errorf("wrapped: %w", err)
+	if ErrorCode(wrapped) != -412 {
+		t.Error("ErrorCode should unwrap wrapped errors")
+	}
+
+	if ErrorCode(fmt.Errorf("network down")) != 0 {
+		t.Error("ErrorCode should be 0 for non-API errors")
+	}
+}
+
+func TestTopReplies(t *testing.T) {
+	pinned := map[string]interface{}{"rpid": float64(1)}
+	top := map[string]interface{}{
+		"upper": map[string]interface{}{"rpid": float64(1)},
+		"admin": map[string]interface{}{"rpid": float64(2)},
+		"vote":  nil,
+	}
+
+	replies := topReplies([]map[string]interface{}{pinned}, top)
+	if len(replies) != 2 || replies[0]["rpid"] != float64(1) || replies[1]["rpid"] != float64(2) {
+		t.Errorf("topReplies = %v, expected rpids 1 and 2 once each", replies)
+	}
+	if replies[0]["pinned_by"] != "upper" || replies[1]["pinned_by"] != "admin" {
+		t.Errorf("pinned_by = %v/%v, expected upper/admin", replies[0]["pinned_by"], replies[1]["pinned_by"])
+	}
+	if topReplies(nil, nil) != nil {
+		t.Error("A page without pinned comments should have no top replies")
+	}
+}
+
+func TestGetSubtitles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"body":[{"from":0,"to":1,"content":"大家好"},{"from":1,"to":2,"content":"欢迎"}]}`))
+	}))
+	defer server.Close()
+	requested := serveBody(t, `{"code":0,"data":{"subtitle":{"subtitles":[`+
+		`{"lan":"zh-CN","lan_doc":"中文","subtitle_url":"`+server.URL+`/zh.json"},`+
+		`{"lan":"ai-zh","lan_doc":"中文（自动生成）","ai_type":1,"subtitle_url":"`+server.URL+`/ai.json"},`+
+		`{"lan":"en-US","lan_doc":"English","subtitle_url":""}]}}}`)
+
+	subtitles, err := GetSubtitles("BV1", 42, func(track SubtitleTrack) bool { return track.AIType == 0 }, nil, "")
+	if err != nil {
+		t.Fatalf("GetSubtitles failed: %v", err)
+	}
+	if requested.Path != "/x/player/wbi/v2" || requested.Query().Get("cid") != "42" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(subtitles) != 1 || subtitles[0].Track.Lan != "zh-CN" || subtitles[0].Text != "大家好\n欢迎" {
+		t.Errorf("subtitles = %+v", subtitles)
+	}
+}
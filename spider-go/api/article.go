@@ -0,0 +1,21 @@
+package api
+
+import "fmt"
+
+// GetArticleViewInfo fetches the view info of an article by its cv number:
+// title, author, banner and image URLs and its stats (view, like, favorite,
+// coin, share, reply)
+func GetArticleViewInfo(id int64, session *Session, cookieConfigPath string) (map[string]interface{}, error) {
+	return withRetry(func() (map[string]interface{}, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/article/viewinfo?id=%d", id)
+
+		var info map[string]interface{}
+		if err := getJSON(urlStr, session, cookieConfigPath, &info); err != nil {
+			return nil, err
+		}
+		if info == nil {
+			return nil, fmt.Errorf("article cv%d has no view info", id)
+		}
+		return info, nil
+	}, DefaultRetryConfig())
+}
@@ -0,0 +1,18 @@
+package api
+
+import "testing"
+
+func TestGetArticleViewInfo(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"title":"攻略","mid":7,"author_name":"up","stats":{"view":100,"like":5}}}`)
+
+	info, err := GetArticleViewInfo(123, nil, "")
+	if err != nil {
+		t.Fatalf("GetArticleViewInfo failed: %v", err)
+	}
+	if requested.Path != "/x/article/viewinfo" || requested.Query().Get("id") != "123" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if info["author_name"] != "up" {
+		t.Errorf("info = %v", info)
+	}
+}
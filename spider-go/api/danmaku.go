@@ -0,0 +1,106 @@
+package api
+
+import (
+	"compress/flate"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Danmaku is one bullet comment (弹幕) of a video page
+type Danmaku struct {
+	ID       string  // dmid
+	Progress float64 // seconds into the video
+	Mode     int     // 1-3 scrolling, 4 bottom, 5 top, 6 reverse, 7 positioned
+	FontSize int
+	Color    int64 // RGB as a decimal number
+	Ctime    int64
+	Pool     int    // 0 normal, 1 subtitle, 2 special
+	MidHash  string // CRC32 of the sender's mid, in hex
+	Weight   int    // block weight, 0 when not reported
+	Content  string
+}
+
+// GetDanmaku fetches the danmaku of a video page from its XML danmaku list.
+// The list holds only the most recent danmaku, up to a pool size set by the
+// video's length.
+func GetDanmaku(cid int64, session *Session) ([]Danmaku, error) {
+	return withRetry(func() ([]Danmaku, error) {
+		urlStr := fmt.Sprintf("https://api.bilibili.com/x/v1/dm/list.so?oid=%d", cid)
+
+		var resp *http.Response
+		var err error
+
+		if session != nil {
+			resp, err = session.doRequest("GET", urlStr)
+		} else {
+			req, _ := http.NewRequest("GET", urlStr, nil)
+			for k, v := range getDefaultHeaders() {
+				req.Header.Set(k, v)
+			}
+			client := newClient(15 * time.Second)
+			resp, err = client.Do(req)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("danmaku list of cid %d: %s", cid, resp.Status)
+		}
+
+		// The list is sent raw-deflated, which net/http does not undo
+		body := io.Reader(resp.Body)
+		if strings.EqualFold(resp.Header.Get("Content-Encoding"), "deflate") {
+			inflated := flate.NewReader(resp.Body)
+			defer inflated.Close()
+			body = inflated
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+		return parseDanmakuXML(data)
+	}, DefaultRetryConfig())
+}
+
+// parseDanmakuXML decodes a danmaku list. Each <d> element carries its
+// attributes in p as "progress,mode,fontsize,color,ctime,pool,midhash,dmid"
+// and optionally ",weight".
+func parseDanmakuXML(data []byte) ([]Danmaku, error) {
+	var doc struct {
+		Items []struct {
+			P    string `xml:"p,attr"`
+			Text string `xml:",chardata"`
+		} `xml:"d"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse danmaku list: %w", err)
+	}
+
+	danmaku := make([]Danmaku, 0, len(doc.Items))
+	for _, item := range doc.Items {
+		p := strings.Split(item.P, ",")
+		if len(p) < 8 {
+			continue
+		}
+		d := Danmaku{MidHash: p[6], ID: p[7], Content: item.Text}
+		d.Progress, _ = strconv.ParseFloat(p[0], 64)
+		d.Mode, _ = strconv.Atoi(p[1])
+		d.FontSize, _ = strconv.Atoi(p[2])
+		d.Color, _ = strconv.ParseInt(p[3], 10, 64)
+		d.Ctime, _ = strconv.ParseInt(p[4], 10, 64)
+		d.Pool, _ = strconv.Atoi(p[5])
+		if len(p) > 8 {
+			d.Weight, _ = strconv.Atoi(p[8])
+		}
+		danmaku = append(danmaku, d)
+	}
+	return danmaku, nil
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"net/http"
+	"testing"
+)
+
+const danmakuXML = `<?xml version="1.0" encoding="UTF-8"?><i><chatserver>chat.bilibili.com</chatserver><chatid>42</chatid>` +
+	`<d p="12.34500,1,25,16777215,1700000000,0,a1b2c3d4,1234567890123456789,10">前方高能</d>` +
+	`<d p="3.2,5,25,16711680,1700000001,1,e5f6a7b8,1234567890123456790">字幕&amp;弹幕</d>` +
+	`<d p="broken">skipped</d></i>`
+
+func TestParseDanmakuXML(t *testing.T) {
+	danmaku, err := parseDanmakuXML([]byte(danmakuXML))
+	if err != nil {
+		t.Fatalf("parseDanmakuXML failed: %v", err)
+	}
+	if len(danmaku) != 2 {
+		t.Fatalf("got %d danmaku, expected 2", len(danmaku))
+	}
+
+	first := danmaku[0]
+	expected := Danmaku{
+		ID: "1234567890123456789", Progress: 12.345, Mode: 1, FontSize: 25, Color: 16777215,
+		Ctime: 1700000000, Pool: 0, MidHash: "a1b2c3d4", Weight: 10, Content: "前方高能",
+	}
+	if first != expected {
+		t.Errorf("first danmaku = %+v, expected %+v", first, expected)
+	}
+	if second := danmaku[1]; second.Weight != 0 || second.Pool != 1 || second.Content != "字幕&弹幕" {
+		t.Errorf("second danmaku = %+v", second)
+	}
+}
+
+func TestParseDanmakuXML_Invalid(t *testing.T) {
+	if _, err := parseDanmakuXML([]byte("<i><d>")); err == nil {
+		t.Error("parseDanmakuXML succeeded on a truncated list")
+	}
+}
+
+func TestGetDanmaku_Deflated(t *testing.T) {
+	var compressed bytes.Buffer
+	w, _ := flate.NewWriter(&compressed, flate.DefaultCompression)
+	w.Write([]byte(danmakuXML))
+	w.Close()
+
+	var requested string
+	SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.URL.String()
+		header := http.Header{"Content-Encoding": {"deflate"}}
+		return &http.Response{StatusCode: http.StatusOK, Header: header, Body: io.NopCloser(bytes.NewReader(compressed.Bytes())), Request: req}, nil
+	}))
+	t.Cleanup(func() { SetTransport(nil) })
+
+	danmaku, err := GetDanmaku(42, nil)
+	if err != nil {
+		t.Fatalf("GetDanmaku failed: %v", err)
+	}
+	if requested != "https://api.bilibili.com/x/v1/dm/list.so?oid=42" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(danmaku) != 2 {
+		t.Errorf("got %d danmaku, expected 2", len(danmaku))
+	}
+}
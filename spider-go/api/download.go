@@ -0,0 +1,55 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// ErrTooLarge is returned by Download when the body exceeds the size limit
+var ErrTooLarge = errors.New("download exceeds size limit")
+
+// downloadClient fetches CDN files, which may take much longer than API calls
+var downloadClient = &http.Client{Timeout: 10 * time.Minute}
+
+// Download fetches urlStr with the default browser headers and copies the
+// body to w, returning the number of bytes written. With maxBytes > 0 larger
+// bodies fail with ErrTooLarge. CDN downloads do not use the API rate limiter.
+func Download(urlStr string, w io.Writer, maxBytes int64) (int64, error) {
+	req, err := http.NewRequest("GET", urlStr, nil)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range getDefaultHeaders() {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Accept", "*/*")
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("download %s: %s", urlStr, resp.Status)
+	}
+	if maxBytes > 0 && resp.ContentLength > maxBytes {
+		return 0, ErrTooLarge
+	}
+
+	body := io.Reader(resp.Body)
+	if maxBytes > 0 {
+		body = io.LimitReader(resp.Body, maxBytes+1)
+	}
+	n, err := io.Copy(w, body)
+	if err != nil {
+		return n, err
+	}
+	if maxBytes > 0 && n > maxBytes {
+		return n, ErrTooLarge
+	}
+	return n, nil
+}
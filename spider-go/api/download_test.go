@@ -0,0 +1,36 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDownload(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Referer") == "" {
+			t.Error("Download should send a Referer")
+		}
+		w.Write([]byte("0123456789"))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	n, err := Download(server.URL+"/cover.jpg", &buf, 0)
+	if err != nil || n != 10 || buf.String() != "0123456789" {
+		t.Errorf("Download = %d, %v, body %q", n, err, buf.String())
+	}
+
+	if _, err := Download(server.URL+"/cover.jpg", &bytes.Buffer{}, 5); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+	if _, err := Download(server.URL+"/missing", &bytes.Buffer{}, 0); err == nil {
+		t.Error("Expected error for 404")
+	}
+}
@@ -0,0 +1,435 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of schema drift
+const (
+	DriftUnknown  = "unknown"  // a field the schema does not expect
+	DriftMissing  = "missing"  // a required field is absent
+	DriftMistyped = "mistyped" // a field has another JSON type
+)
+
+// Drift is one way the responses of an endpoint differ from what the
+// crawler expects, with how often it was seen
+type Drift struct {
+	Endpoint  string `json:"endpoint"`
+	Path      string `json:"path"`
+	Kind      string `json:"kind"`
+	Expected  string `json:"expected,omitempty"`
+	Got       string `json:"got,omitempty"` // type of the first mistyped value
+	Count     int    `json:"count"`
+	FirstSeen int64  `json:"first_seen"`
+}
+
+// fieldSpec is a response field the crawler relies on. "[]" in a path
+// stands for every element of an array.
+type fieldSpec struct {
+	Path     string
+	Type     string   // string, number, bool, object or array
+	Optional bool     // may be absent or null
+	Known    []string // for a closed object, every key it may have
+}
+
+// commentFields are the fields of each comment in a comment list at prefix
+func commentFields(prefix string) []fieldSpec {
+	return []fieldSpec{
+		{Path: prefix + ".rpid", Type: "number"},
+		{Path: prefix + ".mid", Type: "number"},
+		{Path: prefix + ".ctime", Type: "number"},
+		{Path: prefix + ".rcount", Type: "number"},
+		{Path: prefix + ".content", Type: "object"},
+		{Path: prefix + ".content.message", Type: "string"},
+		{Path: prefix + ".member", Type: "object"},
+	}
+}
+
+// relationFields are the fields of a page of followings or followers
+var relationFields = []fieldSpec{
+	{Path: "data", Type: "object"},
+	{Path: "data.list", Type: "array", Optional: true},
+	{Path: "data.list[].mid", Type: "number"},
+	{Path: "data.total", Type: "number"},
+}
+
+// searchFields are the fields of a page of search results, whose results
+// have the given fields
+func searchFields(result ...fieldSpec) []fieldSpec {
+	return append([]fieldSpec{
+		{Path: "data", Type: "object"},
+		{Path: "data.numPages", Type: "number"},
+		{Path: "data.result", Type: "array", Optional: true},
+	}, result...)
+}
+
+// typedEndpoints are the endpoints whose response shape is chosen by a query
+// parameter, by the name of that parameter
+var typedEndpoints = map[string]string{
+	"/x/web-interface/search/type": "search_type",
+}
+
+// responseSchemas lists the fields the crawler relies on, by endpoint (see
+// endpointOf).
+// Every response is also checked against the standard envelope.
+var responseSchemas = map[string][]fieldSpec{
+	"/x/web-interface/nav": {
+		{Path: "data.wbi_img", Type: "object", Known: []string{"img_url", "sub_url"}},
+		{Path: "data.wbi_img.img_url", Type: "string"},
+		{Path: "data.wbi_img.sub_url", Type: "string"},
+	},
+	"/x/web-interface/search/type?search_type=video": searchFields(
+		fieldSpec{Path: "data.result[].bvid", Type: "string"},
+		fieldSpec{Path: "data.result[].aid", Type: "number"},
+		fieldSpec{Path: "data.result[].title", Type: "string"},
+	),
+	"/x/web-interface/search/type?search_type=bili_user": searchFields(
+		fieldSpec{Path: "data.result[].mid", Type: "number"},
+		fieldSpec{Path: "data.result[].uname", Type: "string"},
+	),
+	"/x/web-interface/search/type?search_type=live_room": searchFields(
+		fieldSpec{Path: "data.result[].roomid", Type: "number"},
+		fieldSpec{Path: "data.result[].uid", Type: "number"},
+	),
+	"/x/web-interface/search/type?search_type=article": searchFields(
+		fieldSpec{Path: "data.result[].id", Type: "number"},
+		fieldSpec{Path: "data.result[].mid", Type: "number"},
+		fieldSpec{Path: "data.result[].title", Type: "string"},
+	),
+	"/x/article/viewinfo": {
+		{Path: "data", Type: "object"},
+		{Path: "data.mid", Type: "number"},
+		{Path: "data.title", Type: "string"},
+		{Path: "data.stats", Type: "object"},
+		{Path: "data.stats.view", Type: "number"},
+	},
+	"/x/web-interface/view": {
+		{Path: "data", Type: "object"},
+		{Path: "data.aid", Type: "number"},
+		{Path: "data.bvid", Type: "string"},
+		{Path: "data.cid", Type: "number"},
+		{Path: "data.title", Type: "string"},
+		{Path: "data.pubdate", Type: "number"},
+		{Path: "data.owner", Type: "object"},
+		{Path: "data.owner.mid", Type: "number"},
+		{Path: "data.stat", Type: "object"},
+		{Path: "data.stat.reply", Type: "number"},
+	},
+	"/x/web-interface/archive/stat": {
+		{Path: "data", Type: "object"},
+		{Path: "data.view", Type: "number"},
+		{Path: "data.reply", Type: "number"},
+		{Path: "data.like", Type: "number"},
+	},
+	"/x/player/online/total": {
+		{Path: "data", Type: "object"},
+		{Path: "data.total", Type: "string"},
+		{Path: "data.count", Type: "string"},
+	},
+	"/x/player/pagelist": {
+		{Path: "data", Type: "array"},
+		{Path: "data[].cid", Type: "number"},
+		{Path: "data[].page", Type: "number"},
+	},
+	"/x/v2/reply/wbi/main": append([]fieldSpec{
+		{Path: "data", Type: "object"},
+		{Path: "data.replies", Type: "array", Optional: true},
+		{Path: "data.top_replies", Type: "array", Optional: true},
+		{Path: "data.cursor", Type: "object"},
+		{Path: "data.cursor.is_end", Type: "bool"},
+		{Path: "data.cursor.pagination_reply", Type: "object", Optional: true},
+		{Path: "data.cursor.pagination_reply.next_offset", Type: "string", Optional: true},
+	}, commentFields("data.replies[]")...),
+	"/x/v2/reply": append([]fieldSpec{
+		{Path: "data", Type: "object"},
+		{Path: "data.replies", Type: "array", Optional: true},
+		{Path: "data.page", Type: "object"},
+		{Path: "data.page.count", Type: "number"},
+		{Path: "data.upper", Type: "object", Optional: true},
+		{Path: "data.upper.top", Type: "object", Optional: true},
+	}, commentFields("data.replies[]")...),
+	"/x/v2/reply/reply": append([]fieldSpec{
+		{Path: "data", Type: "object"},
+		{Path: "data.replies", Type: "array", Optional: true},
+		{Path: "data.page", Type: "object", Known: []string{"num", "size", "count", "acount"}},
+		{Path: "data.page.count", Type: "number"},
+	}, commentFields("data.replies[]")...),
+	"/x/tag/archive/tags": {
+		{Path: "data", Type: "array", Optional: true},
+		{Path: "data[].tag_id", Type: "number"},
+		{Path: "data[].tag_name", Type: "string"},
+	},
+	"/x/web-interface/wbi/search/square": {
+		{Path: "data", Type: "object"},
+		{Path: "data.trending", Type: "object"},
+		{Path: "data.trending.list", Type: "array", Optional: true},
+		{Path: "data.trending.list[].keyword", Type: "string"},
+	},
+	"/x/web-interface/popular": {
+		{Path: "data", Type: "object"},
+		{Path: "data.list", Type: "array", Optional: true},
+		{Path: "data.list[].bvid", Type: "string"},
+		{Path: "data.no_more", Type: "bool"},
+	},
+	"/x/web-interface/ranking/v2": {
+		{Path: "data", Type: "object"},
+		{Path: "data.list", Type: "array", Optional: true},
+		{Path: "data.list[].bvid", Type: "string"},
+	},
+	"/x/space/wbi/acc/info": {
+		{Path: "data", Type: "object"},
+		{Path: "data.mid", Type: "number"},
+		{Path: "data.name", Type: "string"},
+	},
+	"/x/space/upstat": {
+		{Path: "data", Type: "object"},
+		{Path: "data.archive", Type: "object"},
+		{Path: "data.archive.view", Type: "number"},
+		{Path: "data.article", Type: "object"},
+		{Path: "data.article.view", Type: "number"},
+		{Path: "data.likes", Type: "number"},
+	},
+	"/x/space/wbi/arc/search": {
+		{Path: "data", Type: "object"},
+		{Path: "data.list", Type: "object"},
+		{Path: "data.list.vlist", Type: "array", Optional: true},
+		{Path: "data.list.vlist[].bvid", Type: "string"},
+		{Path: "data.list.vlist[].aid", Type: "number"},
+		{Path: "data.page", Type: "object"},
+		{Path: "data.page.count", Type: "number"},
+	},
+	"/x/polymer/web-dynamic/v1/feed/space": {
+		{Path: "data", Type: "object"},
+		{Path: "data.items", Type: "array", Optional: true},
+		{Path: "data.items[].id_str", Type: "string"},
+		{Path: "data.items[].modules", Type: "object"},
+		{Path: "data.offset", Type: "string"},
+		{Path: "data.has_more", Type: "bool"},
+	},
+	"/x/relation/followings": relationFields,
+	"/x/relation/followers":  relationFields,
+	"/room/v1/Room/getRoomInfoOld": {
+		{Path: "data", Type: "object"},
+		{Path: "data.roomStatus", Type: "number"},
+		{Path: "data.roomid", Type: "number", Optional: true},
+		{Path: "data.liveStatus", Type: "number", Optional: true},
+	},
+	"/x/web-interface/card": {
+		{Path: "data", Type: "object"},
+		{Path: "data.card", Type: "object"},
+		{Path: "data.card.mid", Type: "string"},
+		{Path: "data.card.name", Type: "string"},
+	},
+}
+
+// envelopeFields are the top-level keys of a standard response
+var envelopeFields = map[string]bool{"code": true, "message": true, "ttl": true, "data": true}
+
+type driftKey struct {
+	endpoint, path, kind string
+}
+
+var (
+	driftMu       sync.Mutex
+	drifts        = make(map[driftKey]*Drift)
+	driftHandler  func(Drift)
+	lenientDecode bool
+)
+
+// SetLenientDecode sets whether a response with a field of an unexpected
+// type is kept, with that field left at its zero value, instead of failing
+// the request
+func SetLenientDecode(enabled bool) {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	lenientDecode = enabled
+}
+
+// SetDriftHandler sets a function called the first time each drift is seen;
+// nil removes it
+func SetDriftHandler(handler func(Drift)) {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	driftHandler = handler
+}
+
+// DriftReport returns every drift seen since the last reset, sorted by
+// endpoint and path
+func DriftReport() []Drift {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	out := make([]Drift, 0, len(drifts))
+	for _, d := range drifts {
+		out = append(out, *d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Endpoint != out[j].Endpoint {
+			return out[i].Endpoint < out[j].Endpoint
+		}
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Kind < out[j].Kind
+	})
+	return out
+}
+
+// ResetDrift forgets the drifts seen so far
+func ResetDrift() {
+	driftMu.Lock()
+	defer driftMu.Unlock()
+	drifts = make(map[driftKey]*Drift)
+}
+
+func recordDrift(endpoint, path, kind, expected, got string) {
+	key := driftKey{endpoint, path, kind}
+
+	driftMu.Lock()
+	d, seen := drifts[key]
+	if !seen {
+		d = &Drift{Endpoint: endpoint, Path: path, Kind: kind, Expected: expected, Got: got, FirstSeen: time.Now().Unix()}
+		drifts[key] = d
+	}
+	d.Count++
+	first, handler := *d, driftHandler
+	driftMu.Unlock()
+
+	if !seen && handler != nil {
+		handler(first)
+	}
+}
+
+// decodeResponse checks a response body against the schema of its endpoint
+// and decodes it into v
+func decodeResponse(urlStr string, body []byte, v interface{}) error {
+	checkDrift(endpointOf(urlStr), body)
+	return unmarshalLenient(body, v)
+}
+
+// unmarshalLenient decodes data into v. With lenient decoding a field of
+// the wrong type is left at its zero value; encoding/json still fills in
+// the rest, so the response is kept.
+func unmarshalLenient(data []byte, v interface{}) error {
+	err := json.Unmarshal(data, v)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		driftMu.Lock()
+		lenient := lenientDecode
+		driftMu.Unlock()
+		if lenient {
+			return nil
+		}
+	}
+	return err
+}
+
+// endpointOf returns the path of a request URL, which names its endpoint.
+// For a typed endpoint the type parameter is kept, since each type returns
+// differently shaped data.
+func endpointOf(urlStr string) string {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return urlStr
+	}
+	if param, ok := typedEndpoints[u.Path]; ok {
+		return u.Path + "?" + param + "=" + u.Query().Get(param)
+	}
+	return u.Path
+}
+
+// checkDrift records how body differs from the envelope and the schema of
+// endpoint. Error responses are only checked against the envelope.
+func checkDrift(endpoint string, body []byte) {
+	var root interface{}
+	if err := json.Unmarshal(body, &root); err != nil {
+		// Not JSON at all; the decode reports it
+		return
+	}
+	obj, ok := root.(map[string]interface{})
+	if !ok {
+		recordDrift(endpoint, "", DriftMistyped, "object", jsonType(root))
+		return
+	}
+	for key := range obj {
+		if !envelopeFields[key] {
+			recordDrift(endpoint, key, DriftUnknown, "", jsonType(obj[key]))
+		}
+	}
+	if code, _ := obj["code"].(float64); code != 0 {
+		return
+	}
+
+	for _, spec := range responseSchemas[endpoint] {
+		checkField(endpoint, spec, obj, strings.Split(spec.Path, "."))
+	}
+}
+
+// checkField follows the rest of a spec's path from value. A missing or
+// mistyped parent is reported by its own spec, so the walk just stops.
+func checkField(endpoint string, spec fieldSpec, value interface{}, rest []string) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+	name, each := strings.CutSuffix(rest[0], "[]")
+	field, present := obj[name]
+	if len(rest) > 1 {
+		if !each {
+			checkField(endpoint, spec, field, rest[1:])
+			return
+		}
+		items, _ := field.([]interface{})
+		for _, item := range items {
+			checkField(endpoint, spec, item, rest[1:])
+		}
+		return
+	}
+
+	switch {
+	case !present || field == nil:
+		switch {
+		case spec.Optional:
+		case present:
+			recordDrift(endpoint, spec.Path, DriftMistyped, spec.Type, "null")
+		default:
+			recordDrift(endpoint, spec.Path, DriftMissing, spec.Type, "")
+		}
+	case jsonType(field) != spec.Type:
+		recordDrift(endpoint, spec.Path, DriftMistyped, spec.Type, jsonType(field))
+	case spec.Known != nil:
+		known := make(map[string]bool, len(spec.Known))
+		for _, key := range spec.Known {
+			known[key] = true
+		}
+		for key, item := range field.(map[string]interface{}) {
+			if !known[key] {
+				recordDrift(endpoint, spec.Path+"."+key, DriftUnknown, "", jsonType(item))
+			}
+		}
+	}
+}
+
+// jsonType names the JSON type of a decoded value
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "unknown"
+}
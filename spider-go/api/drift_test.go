@@ -0,0 +1,118 @@
+package api
+
+import (
+	"testing"
+)
+
+// driftKinds indexes a drift report by path and kind
+func driftKinds(report []Drift) map[string]Drift {
+	out := make(map[string]Drift, len(report))
+	for _, d := range report {
+		out[d.Path+" "+d.Kind] = d
+	}
+	return out
+}
+
+func TestCheckDrift(t *testing.T) {
+	ResetDrift()
+	t.Cleanup(ResetDrift)
+
+	body := `{"code":0,"message":"0","extra":1,"data":{"replies":[
+		{"rpid":1,"mid":2,"ctime":3,"rcount":0,"content":{"message":"hi"},"member":{}},
+		{"rpid":"4","mid":5,"rcount":0,"content":{"message":"hi"},"member":{}}
+	],"page":{"num":1,"size":20,"count":2,"acount":2,"more":true}}}`
+	checkDrift("/x/v2/reply/reply", []byte(body))
+
+	got := driftKinds(DriftReport())
+	if d, ok := got["extra unknown"]; !ok || d.Got != "number" {
+		t.Errorf("unknown top-level field not reported: %+v", got)
+	}
+	if d, ok := got["data.replies[].rpid mistyped"]; !ok || d.Expected != "number" || d.Got != "string" || d.Count != 1 {
+		t.Errorf("mistyped rpid not reported: %+v", d)
+	}
+	if _, ok := got["data.replies[].ctime missing"]; !ok {
+		t.Errorf("missing ctime not reported: %+v", got)
+	}
+	if _, ok := got["data.page.more unknown"]; !ok {
+		t.Errorf("unknown key of a closed object not reported: %+v", got)
+	}
+	if len(got) != 4 {
+		t.Errorf("got %d drifts, want 4: %+v", len(got), got)
+	}
+}
+
+func TestCheckDrift_OptionalAndErrors(t *testing.T) {
+	ResetDrift()
+	t.Cleanup(ResetDrift)
+
+	// Empty comment pages have null replies and no pagination_reply
+	checkDrift("/x/v2/reply/wbi/main", []byte(`{"code":0,"message":"0","ttl":1,"data":{"replies":null,"cursor":{"is_end":true}}}`))
+	// Error responses carry no data to check
+	checkDrift("/x/web-interface/view", []byte(`{"code":-404,"message":"啥都木有","ttl":1}`))
+	// Endpoints without a schema only get the envelope check
+	checkDrift("/x/unknown", []byte(`{"code":0,"data":{"anything":1}}`))
+
+	if report := DriftReport(); len(report) != 0 {
+		t.Errorf("unexpected drifts: %+v", report)
+	}
+}
+
+func TestDriftHandler_FirstOccurrenceOnly(t *testing.T) {
+	ResetDrift()
+	var calls []Drift
+	SetDriftHandler(func(d Drift) { calls = append(calls, d) })
+	t.Cleanup(func() {
+		SetDriftHandler(nil)
+		ResetDrift()
+	})
+
+	body := []byte(`{"code":0,"data":{"card":{"mid":7,"name":"x"}}}`)
+	checkDrift("/x/web-interface/card", body)
+	checkDrift("/x/web-interface/card", body)
+
+	if len(calls) != 1 || calls[0].Path != "data.card.mid" {
+		t.Fatalf("handler calls = %+v, want one for data.card.mid", calls)
+	}
+	if report := DriftReport(); len(report) != 1 || report[0].Count != 2 {
+		t.Errorf("report = %+v, want one drift seen twice", report)
+	}
+}
+
+func TestUnmarshalLenient(t *testing.T) {
+	t.Cleanup(func() { SetLenientDecode(false) })
+
+	var data struct {
+		NumPages int                      `json:"numPages"`
+		Result   []map[string]interface{} `json:"result"`
+	}
+	body := []byte(`{"numPages":"3","result":[{"bvid":"BV1"}]}`)
+
+	if err := unmarshalLenient(body, &data); err == nil {
+		t.Error("strict decode accepted a mistyped field")
+	}
+
+	SetLenientDecode(true)
+	data.Result = nil
+	if err := unmarshalLenient(body, &data); err != nil {
+		t.Fatalf("lenient decode failed: %v", err)
+	}
+	if data.NumPages != 0 || len(data.Result) != 1 || data.Result[0]["bvid"] != "BV1" {
+		t.Errorf("lenient decode kept %+v", data)
+	}
+
+	if err := unmarshalLenient([]byte(`{not json`), &data); err == nil {
+		t.Error("lenient decode accepted invalid JSON")
+	}
+}
+
+func TestEndpointOf(t *testing.T) {
+	got := endpointOf("https://api.bilibili.com/x/web-interface/view?bvid=BV1")
+	if got != "/x/web-interface/view" {
+		t.Errorf("endpointOf = %q", got)
+	}
+
+	got = endpointOf("https://api.bilibili.com/x/web-interface/search/type?keyword=a&page=1&search_type=bili_user")
+	if got != "/x/web-interface/search/type?search_type=bili_user" {
+		t.Errorf("endpointOf = %q for a typed endpoint", got)
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latency smoothing: the recent average follows the last few responses of
+// an endpoint, the baseline its usual speed over a much longer span
+const (
+	latencyRecentWeight   = 0.2
+	latencyBaselineWeight = 0.01
+	latencyMinSamples     = 20 // responses before an endpoint's baseline is trusted
+)
+
+// Latency is the response latency of one endpoint
+type Latency struct {
+	Endpoint   string  `json:"endpoint"`
+	Samples    int     `json:"samples"`
+	RecentMs   float64 `json:"recent_ms"`
+	BaselineMs float64 `json:"baseline_ms"`
+}
+
+// Slowdown returns how many times slower recent responses are than the
+// baseline
+func (l Latency) Slowdown() float64 {
+	if l.BaselineMs <= 0 {
+		return 1
+	}
+	return l.RecentMs / l.BaselineMs
+}
+
+var (
+	latencyMu sync.Mutex
+	latencies = make(map[string]*Latency)
+)
+
+// RecordLatency adds a response that took d to the averages of endpoint
+func RecordLatency(endpoint string, d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	l, ok := latencies[endpoint]
+	if !ok {
+		latencies[endpoint] = &Latency{Endpoint: endpoint, Samples: 1, RecentMs: ms, BaselineMs: ms}
+		return
+	}
+	l.Samples++
+	l.RecentMs += latencyRecentWeight * (ms - l.RecentMs)
+	l.BaselineMs += latencyBaselineWeight * (ms - l.BaselineMs)
+}
+
+// LatencyReport returns the latency of every endpoint seen since the last
+// reset, sorted by endpoint
+func LatencyReport() []Latency {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	out := make([]Latency, 0, len(latencies))
+	for _, l := range latencies {
+		out = append(out, *l)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Endpoint < out[j].Endpoint })
+	return out
+}
+
+// SlowestEndpoint returns the endpoint that has slowed down the most
+// against its baseline, among those with enough responses to tell; ok is
+// false if there is none yet
+func SlowestEndpoint() (slowest Latency, ok bool) {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	for _, l := range latencies {
+		if l.Samples < latencyMinSamples {
+			continue
+		}
+		if !ok || l.Slowdown() > slowest.Slowdown() {
+			slowest, ok = *l, true
+		}
+	}
+	return slowest, ok
+}
+
+// ResetLatency forgets the latencies measured so far
+func ResetLatency() {
+	latencyMu.Lock()
+	defer latencyMu.Unlock()
+	latencies = make(map[string]*Latency)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRecordLatency(t *testing.T) {
+	ResetLatency()
+	defer ResetLatency()
+
+	for i := 0; i < latencyMinSamples; i++ {
+		RecordLatency("/fast", 100*time.Millisecond)
+		RecordLatency("/slow", 100*time.Millisecond)
+	}
+	if l, ok := SlowestEndpoint(); !ok || l.Slowdown() != 1 {
+		t.Fatalf("SlowestEndpoint = %+v, %v, expected no slowdown", l, ok)
+	}
+
+	for i := 0; i < 10; i++ {
+		RecordLatency("/slow", 500*time.Millisecond)
+	}
+	l, ok := SlowestEndpoint()
+	if !ok || l.Endpoint != "/slow" || l.Slowdown() < 2 {
+		t.Fatalf("SlowestEndpoint = %+v (slowdown %.2f), expected /slow well above its baseline", l, l.Slowdown())
+	}
+
+	// Back to normal speed, the recent average returns to the baseline
+	for i := 0; i < 30; i++ {
+		RecordLatency("/slow", 100*time.Millisecond)
+	}
+	if l, _ := SlowestEndpoint(); l.Slowdown() > 1.1 {
+		t.Errorf("Slowdown = %.2f after recovering, expected about 1", l.Slowdown())
+	}
+
+	report := LatencyReport()
+	if len(report) != 2 || report[0].Endpoint != "/fast" || report[1].Samples != latencyMinSamples+40 {
+		t.Errorf("LatencyReport = %+v", report)
+	}
+}
+
+func TestSlowestEndpoint_NeedsSamples(t *testing.T) {
+	ResetLatency()
+	defer ResetLatency()
+
+	RecordLatency("/x", time.Second)
+	if _, ok := SlowestEndpoint(); ok {
+		t.Error("An endpoint with too few samples should not be reported")
+	}
+}
+
+func TestDoRequest_RecordsLatency(t *testing.T) {
+	ResetLatency()
+	defer ResetLatency()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0,"data":{}}`))
+	}))
+	defer server.Close()
+
+	if err := getJSON(server.URL+"/x/web-interface/card?mid=1", &Session{client: newClient(time.Second)}, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	if report := LatencyReport(); len(report) != 1 || report[0].Endpoint != "/x/web-interface/card" {
+		t.Errorf("LatencyReport = %+v, expected the card endpoint", report)
+	}
+}
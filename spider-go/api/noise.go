@@ -0,0 +1,86 @@
+package api
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"strconv"
+
+	"spider-go/ratelimit"
+)
+
+// Pages a browser on bilibili visits besides the API, used as noise
+const (
+	homepageURL = "https://www.bilibili.com/"
+	navURL      = "https://api.bilibili.com/x/web-interface/nav"
+)
+
+// SetNoise makes sessions precede about rate (0 to 1) of their API requests
+// with a harmless browsing request: the homepage, the nav endpoint or the
+// page of the video being crawled. 0 disables it.
+func (m *SessionManager) SetNoise(rate float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.noiseRate = rate
+}
+
+// Noise returns how many browsing requests sessions have sent
+func (m *SessionManager) Noise() int64 {
+	return m.noise.Load()
+}
+
+// browse sends a browsing request with session before a request to urlStr,
+// at the manager's noise rate. It waits for a rate limit token and takes a
+// concurrency slot like any request, and its response and errors are
+// ignored. The request it precedes already holds a slot, so waiting for a
+// second one could deadlock; the noise is skipped when none is free.
+func (m *SessionManager) browse(session *Session, urlStr string) {
+	m.mu.Lock()
+	rate, roll := m.noiseRate, m.roll
+	m.mu.Unlock()
+	if rate <= 0 || roll() >= rate {
+		return
+	}
+
+	pages := noisePages(urlStr)
+	page := pages[int(roll()*float64(len(pages)))%len(pages)]
+	release, ok := ratelimit.TryAcquireSlot()
+	if !ok {
+		return
+	}
+	defer release()
+	ratelimit.WaitForToken()
+	resp, err := session.send("GET", page)
+	if err == nil {
+		resp.Body.Close()
+	}
+	m.noise.Add(1)
+}
+
+// noisePages lists the browsing pages that fit a request to urlStr: the
+// homepage and nav always, and the video page when the request names a video
+func noisePages(urlStr string) []string {
+	pages := []string{homepageURL, navURL}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return pages
+	}
+	query := u.Query()
+	switch {
+	case query.Get("bvid") != "":
+		pages = append(pages, homepageURL+"video/"+query.Get("bvid"))
+	case query.Get("aid") != "":
+		pages = append(pages, fmt.Sprintf("%svideo/av%s", homepageURL, query.Get("aid")))
+	case query.Get("oid") != "" && query.Get("type") == "1":
+		// Comments of a video are addressed by its aid
+		if aid, err := strconv.ParseInt(query.Get("oid"), 10, 64); err == nil {
+			pages = append(pages, fmt.Sprintf("%svideo/av%d", homepageURL, aid))
+		}
+	}
+	return pages
+}
+
+// defaultRoll draws the random numbers noise decisions are made from
+func defaultRoll() float64 {
+	return rand.Float64()
+}
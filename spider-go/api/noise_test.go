@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+
+	"spider-go/ratelimit"
+)
+
+func TestNoisePages(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string // video page, "" if none
+	}{
+		{"https://api.bilibili.com/x/web-interface/view?bvid=BV1xx411c7mD", "https://www.bilibili.com/video/BV1xx411c7mD"},
+		{"https://api.bilibili.com/x/web-interface/archive/stat?aid=42", "https://www.bilibili.com/video/av42"},
+		{"https://api.bilibili.com/x/v2/reply/reply?oid=42&type=1&root=7", "https://www.bilibili.com/video/av42"},
+		{"https://api.bilibili.com/x/v2/reply/reply?oid=42&type=17", ""},
+		{"https://api.bilibili.com/x/web-interface/card?mid=7", ""},
+	}
+	for _, tt := range tests {
+		expected := []string{homepageURL, navURL}
+		if tt.expected != "" {
+			expected = append(expected, tt.expected)
+		}
+		if got := noisePages(tt.url); !reflect.DeepEqual(got, expected) {
+			t.Errorf("noisePages(%q) = %v, expected %v", tt.url, got, expected)
+		}
+	}
+}
+
+func TestSessionManager_Noise(t *testing.T) {
+	useCookies(t, "SESSDATA=a")
+	ratelimit.InitRateLimiter(1000, 1000)
+	var mu sync.Mutex
+	var requested []string
+	SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requested = append(requested, req.URL.String())
+		mu.Unlock()
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}))
+	t.Cleanup(func() { SetTransport(nil) })
+
+	m := NewSessionManager("")
+	session := m.Acquire()
+	apiURL := "https://api.bilibili.com/x/web-interface/view?bvid=BV1"
+
+	// Off by default
+	session.doRequest("GET", apiURL)
+	if m.Noise() != 0 {
+		t.Fatalf("Noise = %d with noise disabled", m.Noise())
+	}
+
+	// Rolls of 0.1 pass a rate of 0.5 and pick the first page, 0.9 does not
+	rolls := []float64{0.1, 0.1, 0.9}
+	m.roll = func() float64 {
+		r := rolls[0]
+		rolls = rolls[1:]
+		return r
+	}
+	m.SetNoise(0.5)
+	requested = nil
+	session.doRequest("GET", apiURL)
+	session.doRequest("GET", apiURL)
+
+	if m.Noise() != 1 {
+		t.Errorf("Noise = %d, expected 1", m.Noise())
+	}
+	expected := []string{homepageURL, apiURL, apiURL}
+	if !reflect.DeepEqual(requested, expected) {
+		t.Errorf("requested %v, expected %v", requested, expected)
+	}
+}
+
+func TestSessionManager_NoiseTakesSlot(t *testing.T) {
+	useCookies(t, "SESSDATA=a")
+	ratelimit.InitRateLimiter(1000, 1000)
+	var inFlight []int64
+	SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.String() == homepageURL {
+			inFlight = append(inFlight, ratelimit.InFlight())
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+	}))
+	t.Cleanup(func() { SetTransport(nil) })
+	t.Cleanup(func() { ratelimit.SetMaxConcurrent(0) })
+
+	m := NewSessionManager("")
+	session := m.Acquire()
+	m.roll = func() float64 { return 0 }
+	m.SetNoise(1)
+	apiURL := "https://api.bilibili.com/x/web-interface/view?bvid=BV1"
+
+	// The API request holds a slot, as under withRetry, and the noise takes
+	// the second one
+	ratelimit.SetMaxConcurrent(2)
+	release := ratelimit.AcquireSlot()
+	session.doRequest("GET", apiURL)
+	release()
+	if !reflect.DeepEqual(inFlight, []int64{2}) || m.Noise() != 1 {
+		t.Fatalf("noise sent with %v requests in flight, Noise = %d; expected one with 2", inFlight, m.Noise())
+	}
+
+	// Without a free slot the noise is skipped rather than waited for
+	ratelimit.SetMaxConcurrent(1)
+	release = ratelimit.AcquireSlot()
+	session.doRequest("GET", apiURL)
+	release()
+	if m.Noise() != 1 {
+		t.Errorf("Noise = %d, expected the noise skipped without a free slot", m.Noise())
+	}
+}
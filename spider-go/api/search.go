@@ -0,0 +1,113 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Search types accepted by Search
+const (
+	SearchTypeVideo    = "video"
+	SearchTypeUser     = "bili_user"
+	SearchTypeLiveRoom = "live_room"
+	SearchTypeArticle  = "article"
+)
+
+// SearchPage is one page of search results of any search type. The shape
+// of each result depends on the type; the typed wrappers below name them.
+type SearchPage struct {
+	Results  []map[string]interface{}
+	NumPages int
+}
+
+// Search fetches page page of the results of a keyword search of the given
+// type. pageSize 0 leaves the page size to the API, which fixes it for some
+// types anyway.
+func Search(searchType, keyword string, page, pageSize int, session *Session, cookieConfigPath string) (*SearchPage, error) {
+	return withRetry(func() (*SearchPage, error) {
+		query := url.Values{}
+		query.Set("search_type", searchType)
+		query.Set("keyword", keyword)
+		query.Set("page", fmt.Sprintf("%d", page))
+		if pageSize > 0 {
+			query.Set("page_size", fmt.Sprintf("%d", pageSize))
+		}
+		urlStr := "https://api.bilibili.com/x/web-interface/search/type?" + query.Encode()
+
+		var data struct {
+			Result   []map[string]interface{} `json:"result"`
+			NumPages int                      `json:"numPages"`
+		}
+		if err := getJSON(urlStr, session, cookieConfigPath, &data); err != nil {
+			return nil, err
+		}
+
+		if data.Result == nil {
+			data.Result = []map[string]interface{}{}
+		}
+		return &SearchPage{Results: data.Result, NumPages: data.NumPages}, nil
+	}, DefaultRetryConfig())
+}
+
+// SearchResult represents a video search result
+type SearchResult struct {
+	Videos   []map[string]interface{}
+	NumPages int
+}
+
+// SearchVideos searches for videos by keyword
+func SearchVideos(keyword string, page, pageSize int, session *Session, cookieConfigPath string) (*SearchResult, error) {
+	result, err := Search(SearchTypeVideo, keyword, page, pageSize, session, cookieConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return &SearchResult{Videos: result.Results, NumPages: result.NumPages}, nil
+}
+
+// UserSearchResult represents a page of user search results, each with the
+// user's mid, uname, fans, videos and level
+type UserSearchResult struct {
+	Users    []map[string]interface{}
+	NumPages int
+}
+
+// SearchUsers searches for users by keyword
+func SearchUsers(keyword string, page int, session *Session, cookieConfigPath string) (*UserSearchResult, error) {
+	result, err := Search(SearchTypeUser, keyword, page, 0, session, cookieConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return &UserSearchResult{Users: result.Results, NumPages: result.NumPages}, nil
+}
+
+// LiveSearchResult represents a page of live room search results, each with
+// the room's roomid, the streamer's uid and uname, title and live_status
+type LiveSearchResult struct {
+	Rooms    []map[string]interface{}
+	NumPages int
+}
+
+// SearchLiveRooms searches for live rooms by keyword
+func SearchLiveRooms(keyword string, page int, session *Session, cookieConfigPath string) (*LiveSearchResult, error) {
+	result, err := Search(SearchTypeLiveRoom, keyword, page, 0, session, cookieConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return &LiveSearchResult{Rooms: result.Results, NumPages: result.NumPages}, nil
+}
+
+// ArticleSearchResult represents a page of article (专栏) search results
+type ArticleSearchResult struct {
+	Articles []map[string]interface{}
+	NumPages int
+}
+
+// SearchArticles searches for articles (专栏) by keyword. Each result carries
+// its cv number as id, the author's mid, title, category and counters.
+func SearchArticles(keyword string, page int, session *Session, cookieConfigPath string) (*ArticleSearchResult, error) {
+	result, err := Search(SearchTypeArticle, keyword, page, 0, session, cookieConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return &ArticleSearchResult{Articles: result.Results, NumPages: result.NumPages}, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import "testing"
+
+func TestSearch(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"numPages":10,"result":[{"bvid":"BV1","aid":1,"title":"a"}]}}`)
+
+	result, err := Search(SearchTypeVideo, "原神 攻略", 3, 50, nil, "")
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	query := requested.Query()
+	if requested.Path != "/x/web-interface/search/type" || query.Get("search_type") != "video" ||
+		query.Get("keyword") != "原神 攻略" || query.Get("page") != "3" || query.Get("page_size") != "50" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(result.Results) != 1 || result.NumPages != 10 {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestSearchUsers(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"numPages":2,"result":[{"mid":7,"uname":"up","fans":100}]}}`)
+
+	result, err := SearchUsers("up", 1, nil, "")
+	if err != nil {
+		t.Fatalf("SearchUsers failed: %v", err)
+	}
+	if query := requested.Query(); query.Get("search_type") != "bili_user" || query.Has("page_size") {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(result.Users) != 1 || result.Users[0]["mid"] != float64(7) || result.NumPages != 2 {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestSearchLiveRooms(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"numPages":1,"result":[{"roomid":100,"uid":7,"live_status":1}]}}`)
+
+	result, err := SearchLiveRooms("up", 1, nil, "")
+	if err != nil {
+		t.Fatalf("SearchLiveRooms failed: %v", err)
+	}
+	if requested.Query().Get("search_type") != "live_room" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(result.Rooms) != 1 || result.Rooms[0]["roomid"] != float64(100) {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestSearchArticles(t *testing.T) {
+	requested := serveBody(t, `{"code":0,"data":{"numPages":3,"result":[{"id":123,"mid":7,"title":"<em class=\"keyword\">原神</em>攻略","view":100}]}}`)
+
+	result, err := SearchArticles("原神", 2, nil, "")
+	if err != nil {
+		t.Fatalf("SearchArticles failed: %v", err)
+	}
+	query := requested.Query()
+	if requested.Path != "/x/web-interface/search/type" || query.Get("search_type") != "article" ||
+		query.Get("keyword") != "原神" || query.Get("page") != "2" {
+		t.Errorf("Request went to %s", requested)
+	}
+	if len(result.Articles) != 1 || result.NumPages != 3 || result.Articles[0]["id"] != float64(123) {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestSearchArticles_NoResults(t *testing.T) {
+	serveBody(t, `{"code":0,"data":{"numPages":0,"result":null}}`)
+
+	result, err := SearchArticles("none", 1, nil, "")
+	if err != nil {
+		t.Fatalf("SearchArticles failed: %v", err)
+	}
+	if result.Articles == nil || len(result.Articles) != 0 {
+		t.Errorf("result = %+v, expected no articles", result)
+	}
+}
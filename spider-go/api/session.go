@@ -0,0 +1,246 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"spider-go/cookie"
+)
+
+// SessionManager hands out warmed sessions shared by cookie, so workers on
+// the same cookie reuse one HTTP client and one warm-up request. A session
+// that hits an auth failure is moved to another cookie and warmed again.
+type SessionManager struct {
+	cookieConfigPath string
+	byCookie         map[string]*Session // session handed out for each cookie
+	sessions         []*Session          // every session created
+	recycled         int
+	retired          int
+	maxRequests      atomic.Int64   // requests before a session retires, 0 for no limit
+	maxAge           atomic.Int64   // age in nanoseconds at which a session retires, 0 for no limit
+	noiseRate        float64        // share of requests preceded by a browsing request
+	roll             func() float64 // random source of noise decisions
+	noise            atomic.Int64   // browsing requests sent
+	mu               sync.Mutex
+}
+
+// NewSessionManager creates a manager drawing cookies from the pool at
+// cookieConfigPath
+func NewSessionManager(cookieConfigPath string) *SessionManager {
+	return &SessionManager{
+		cookieConfigPath: cookieConfigPath,
+		byCookie:         make(map[string]*Session),
+		roll:             defaultRoll,
+	}
+}
+
+// Acquire returns the session for the next cookie from the pool, creating
+// and warming it on first use
+func (m *SessionManager) Acquire() *Session {
+	pool := cookie.GetCookiePool(m.cookieConfigPath)
+	value := pool.GetCookie()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if session, ok := m.byCookie[value]; ok {
+		return session
+	}
+	session := newSession(pool, value)
+	session.manager = m
+	session.warm()
+	m.byCookie[value] = session
+	m.sessions = append(m.sessions, session)
+	return session
+}
+
+// recycle moves session off a cookie that failed auth. Workers sharing the
+// session may all report the same failure; only the first one rotates it.
+// The session is warmed on its new cookie with the manager unlocked and
+// handed out for that cookie only afterwards.
+func (m *SessionManager) recycle(session *Session, failed string) {
+	session.renewMu.Lock()
+	defer session.renewMu.Unlock()
+
+	m.mu.Lock()
+	if session.cookie() != failed {
+		m.mu.Unlock()
+		return
+	}
+	if m.byCookie[failed] == session {
+		delete(m.byCookie, failed)
+	}
+	rotated := session.Rotate(m.cookieConfigPath)
+	m.mu.Unlock()
+	if !rotated {
+		return
+	}
+
+	session.warm()
+	m.mu.Lock()
+	m.recycled++
+	m.register(session)
+	m.mu.Unlock()
+}
+
+// register makes session the one handed out for its cookie unless another
+// session already is. Callers hold m.mu.
+func (m *SessionManager) register(session *Session) {
+	if _, ok := m.byCookie[session.cookie()]; !ok {
+		m.byCookie[session.cookie()] = session
+	}
+}
+
+// RotateAll switches every session to a new cookie and returns how many
+// changed
+func (m *SessionManager) RotateAll() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rotated := 0
+	m.byCookie = make(map[string]*Session)
+	for _, session := range m.sessions {
+		if session.Rotate(m.cookieConfigPath) {
+			rotated++
+		}
+		m.register(session)
+	}
+	return rotated
+}
+
+// RebuildAll moves every session to the next cookie with a fresh HTTP
+// client and header set and warms it again, as when a session retires, and
+// returns how many sessions were rebuilt. The sessions are warmed after the
+// manager is unlocked, so workers are not held up by the warm-up requests.
+func (m *SessionManager) RebuildAll() int {
+	m.mu.Lock()
+	m.byCookie = make(map[string]*Session)
+	sessions := append([]*Session(nil), m.sessions...)
+	for _, session := range sessions {
+		session.Rotate(m.cookieConfigPath)
+		session.reset()
+		m.register(session)
+	}
+	m.mu.Unlock()
+
+	for _, session := range sessions {
+		session.warm()
+	}
+	return len(sessions)
+}
+
+// SetRetirement makes sessions retire after maxRequests requests or once
+// they are maxAge old; 0 disables either limit. A retired session moves to
+// the next cookie from the pool (keeping its cookie if there is no other)
+// with a fresh HTTP client and header set, and is warmed again, so no
+// identical identity is used for too long.
+func (m *SessionManager) SetRetirement(maxRequests int64, maxAge time.Duration) {
+	m.maxRequests.Store(maxRequests)
+	m.maxAge.Store(int64(maxAge))
+}
+
+// retireIfDue renews session if it has reached a retirement limit. Workers
+// sharing the session wait for the renewal, and only the first renews it.
+// Only the session is locked during the warm-up request, so workers on other
+// sessions carry on.
+func (m *SessionManager) retireIfDue(session *Session) {
+	maxRequests, maxAge := m.maxRequests.Load(), time.Duration(m.maxAge.Load())
+	if maxRequests == 0 && maxAge == 0 {
+		return
+	}
+
+	session.renewMu.Lock()
+	defer session.renewMu.Unlock()
+	if !session.due(maxRequests, maxAge, time.Now()) {
+		return
+	}
+
+	m.mu.Lock()
+	current := session.cookie()
+	if m.byCookie[current] == session {
+		delete(m.byCookie, current)
+	}
+	session.Rotate(m.cookieConfigPath)
+	session.reset()
+	m.retired++
+	m.register(session)
+	m.mu.Unlock()
+
+	session.warm()
+}
+
+// Retired returns how many times a session retired after reaching its limits
+func (m *SessionManager) Retired() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.retired
+}
+
+// Len returns how many sessions have been created
+func (m *SessionManager) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.sessions)
+}
+
+// Recycled returns how many times a session was moved off a failed cookie
+func (m *SessionManager) Recycled() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.recycled
+}
+
+// due reports whether the session has made maxRequests requests or is
+// maxAge old at now
+func (s *Session) due(maxRequests int64, maxAge time.Duration, now time.Time) bool {
+	if maxRequests > 0 && s.requests.Load() >= maxRequests {
+		return true
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return maxAge > 0 && now.Sub(s.born) >= maxAge
+}
+
+// reset gives the session a fresh HTTP client, so no connection is reused,
+// and a fresh header set
+func (s *Session) reset() {
+	s.mu.Lock()
+	s.headers = sessionHeaders(s.currentCookie)
+	s.client = newClient(15 * time.Second)
+	s.born = time.Now()
+	s.mu.Unlock()
+
+	s.requests.Store(0)
+}
+
+// recordUsage counts a request of the session's cookie in its pool. The
+// body is read here to learn the API code and handed back unread.
+func (s *Session) recordUsage(cookieValue string, resp *http.Response, err error) (*http.Response, error) {
+	if s.pool == nil || cookieValue == "" {
+		return resp, err
+	}
+	if err != nil {
+		s.pool.RecordRequest(cookieValue, false, 0)
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		s.pool.RecordRequest(cookieValue, false, 0)
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Pages without an envelope, such as the warm-up, count by status
+	var envelope struct {
+		Code int `json:"code"`
+	}
+	json.Unmarshal(body, &envelope)
+	s.pool.RecordRequest(cookieValue, resp.StatusCode < 400 && envelope.Code == 0, envelope.Code)
+	return resp, nil
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"spider-go/cookie"
+)
+
+// useCookies installs a pool with the given cookie values and counts
+// warm-up requests
+func useCookies(t *testing.T, values ...string) *int32 {
+	t.Helper()
+
+	config := `{"cookies": [`
+	for i, value := range values {
+		if i > 0 {
+			config += ","
+		}
+		config += `{"name": "` + value + `", "value": "` + value + `", "enabled": true}`
+	}
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	os.WriteFile(path, []byte(config+`]}`), 0644)
+
+	previous := cookie.GetCookiePool(path)
+	cookie.SetCookiePool(cookie.NewCookiePool(path))
+	t.Cleanup(func() { cookie.SetCookiePool(previous) })
+
+	var warmups int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&warmups, 1)
+	}))
+	t.Cleanup(server.Close)
+	original := warmupURL
+	warmupURL = server.URL
+	t.Cleanup(func() { warmupURL = original })
+	return &warmups
+}
+
+func TestSessionManager_SharesByCookie(t *testing.T) {
+	warmups := useCookies(t, "SESSDATA=a", "SESSDATA=b")
+	m := NewSessionManager("")
+
+	first, second, third := m.Acquire(), m.Acquire(), m.Acquire()
+	if first == second {
+		t.Error("Different cookies should get different sessions")
+	}
+	if first != third {
+		t.Error("The same cookie should get the same session")
+	}
+	if m.Len() != 2 || atomic.LoadInt32(warmups) != 2 {
+		t.Errorf("Len = %d, warm-ups = %d, expected 2 each", m.Len(), *warmups)
+	}
+}
+
+func TestSessionManager_RecycleOnCookieError(t *testing.T) {
+	warmups := useCookies(t, "SESSDATA=a", "SESSDATA=b")
+	m := NewSessionManager("")
+
+	session := m.Acquire()
+	failed := session.cookie()
+	session.handleCookieError(-101, "")
+	m.recycle(session, failed) // a second worker reporting the same failure
+
+	if session.cookie() == failed {
+		t.Fatal("Session should have moved off the failed cookie")
+	}
+	if m.Recycled() != 1 {
+		t.Errorf("Recycled = %d, expected 1", m.Recycled())
+	}
+	if atomic.LoadInt32(warmups) != 2 {
+		t.Errorf("Warm-ups = %d, expected the recycled session to warm again", *warmups)
+	}
+	if m.byCookie[session.cookie()] != session {
+		t.Error("The recycled session should be handed out for its new cookie")
+	}
+}
+
+func TestSessionManager_IgnoresOtherErrors(t *testing.T) {
+	useCookies(t, "SESSDATA=a", "SESSDATA=b")
+	m := NewSessionManager("")
+
+	session := m.Acquire()
+	before := session.cookie()
+	session.handleCookieError(-404, "")
+	if session.cookie() != before || m.Recycled() != 0 {
+		t.Error("Non-cookie errors should not recycle the session")
+	}
+}
+
+func TestSessionManager_RotateAll(t *testing.T) {
+	useCookies(t, "SESSDATA=a", "SESSDATA=b")
+	m := NewSessionManager("")
+
+	first, second := m.Acquire(), m.Acquire()
+	if rotated := m.RotateAll(); rotated != 2 {
+		t.Errorf("RotateAll = %d, expected 2", rotated)
+	}
+	if first.cookie() == "SESSDATA=a" || second.cookie() == "SESSDATA=b" {
+		t.Error("Every session should have switched cookie")
+	}
+}
+
+func TestSessionManager_Retirement(t *testing.T) {
+	warmups := useCookies(t, "SESSDATA=a", "SESSDATA=b")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0,"data":{}}`))
+	}))
+	defer server.Close()
+
+	m := NewSessionManager("")
+	m.SetRetirement(3, 0)
+	session := m.Acquire()
+	first, client := session.cookie(), session.client
+
+	// The warm-up and two requests use up the first identity
+	for i := 0; i < 2; i++ {
+		if err := getJSON(server.URL, session, "", nil); err != nil {
+			t.Fatalf("getJSON failed: %v", err)
+		}
+	}
+	if m.Retired() != 0 || session.cookie() != first {
+		t.Fatal("Session retired before reaching its limit")
+	}
+
+	getJSON(server.URL, session, "", nil)
+	if m.Retired() != 1 {
+		t.Fatalf("Retired = %d, expected 1", m.Retired())
+	}
+	if session.cookie() == first || session.client == client {
+		t.Error("A retired session should get the next cookie and a fresh client")
+	}
+	if atomic.LoadInt32(warmups) != 2 {
+		t.Errorf("Warm-ups = %d, expected the retired session to warm again", *warmups)
+	}
+	if m.byCookie[session.cookie()] != session {
+		t.Error("The renewed session should be handed out for its new cookie")
+	}
+
+	// An old session retires by age as well
+	m.SetRetirement(0, time.Minute)
+	session.born = time.Now().Add(-2 * time.Minute)
+	getJSON(server.URL, session, "", nil)
+	if m.Retired() != 2 || session.cookie() != first {
+		t.Errorf("Retired = %d, cookie = %s, expected an age retirement back to %s", m.Retired(), session.cookie(), first)
+	}
+}
+
+func TestSessionManager_RebuildAll(t *testing.T) {
+	warmups := useCookies(t, "SESSDATA=a", "SESSDATA=b")
+
+	m := NewSessionManager("")
+	a, b := m.Acquire(), m.Acquire()
+	clientA, clientB := a.client, b.client
+	before := atomic.LoadInt32(warmups)
+
+	if n := m.RebuildAll(); n != 2 {
+		t.Fatalf("RebuildAll = %d, expected 2", n)
+	}
+	if a.client == clientA || b.client == clientB {
+		t.Error("Rebuilt sessions should get fresh clients")
+	}
+	if got := atomic.LoadInt32(warmups) - before; got != 2 {
+		t.Errorf("Warm-ups = %d, expected every rebuilt session to warm again", got)
+	}
+	if m.byCookie[a.cookie()] == nil || m.byCookie[b.cookie()] == nil {
+		t.Error("Rebuilt sessions should be handed out for their new cookies")
+	}
+}
+
+// blockWarmups makes the warm-up requests from now on wait until the
+// returned release is called, signalling each arrival on started
+func blockWarmups(t *testing.T) (started <-chan struct{}, release func()) {
+	t.Helper()
+	arrived := make(chan struct{}, 16)
+	gate := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		<-gate
+	}))
+	var once sync.Once
+	release = func() { once.Do(func() { close(gate) }) }
+	t.Cleanup(server.Close)
+	t.Cleanup(release)
+	original := warmupURL
+	warmupURL = server.URL
+	t.Cleanup(func() { warmupURL = original })
+	return arrived, release
+}
+
+// assertUnlocked fails unless the manager's lock can be taken while a
+// warm-up request is in flight
+func assertUnlocked(t *testing.T, m *SessionManager, started <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("No warm-up request was sent")
+	}
+	locked := make(chan struct{})
+	go func() {
+		m.Len()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("The manager stayed locked during a warm-up request")
+	}
+}
+
+func TestSessionManager_RebuildAllWarmsUnlocked(t *testing.T) {
+	useCookies(t, "SESSDATA=a", "SESSDATA=b")
+	m := NewSessionManager("")
+	m.Acquire()
+
+	started, release := blockWarmups(t)
+	done := make(chan struct{})
+	go func() {
+		m.RebuildAll()
+		close(done)
+	}()
+	assertUnlocked(t, m, started)
+	release()
+	<-done
+}
+
+func TestSessionManager_RetireWarmsUnlocked(t *testing.T) {
+	useCookies(t, "SESSDATA=a", "SESSDATA=b")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0,"data":{}}`))
+	}))
+	defer server.Close()
+
+	m := NewSessionManager("")
+	m.SetRetirement(1, 0)
+	session := m.Acquire() // the warm-up uses up the first identity
+
+	started, release := blockWarmups(t)
+	done := make(chan struct{})
+	go func() {
+		getJSON(server.URL, session, "", nil)
+		close(done)
+	}()
+	assertUnlocked(t, m, started)
+	release()
+	<-done
+	if m.Retired() != 1 {
+		t.Errorf("Retired = %d, expected 1", m.Retired())
+	}
+}
+
+func TestSessionManager_RecycleWarmsUnlocked(t *testing.T) {
+	useCookies(t, "SESSDATA=a", "SESSDATA=b")
+	m := NewSessionManager("")
+	session := m.Acquire()
+	failed := session.cookie()
+
+	started, release := blockWarmups(t)
+	done := make(chan struct{})
+	go func() {
+		m.recycle(session, failed)
+		close(done)
+	}()
+	assertUnlocked(t, m, started)
+	m.mu.Lock()
+	handedOut := m.byCookie[session.cookie()] == session
+	m.mu.Unlock()
+	if handedOut {
+		t.Error("The session should not be handed out before it is warmed")
+	}
+	release()
+	<-done
+	if m.Recycled() != 1 || m.byCookie[session.cookie()] != session {
+		t.Errorf("Recycled = %d, expected the warmed session handed out for its new cookie", m.Recycled())
+	}
+}
+
+func TestSessionManager_NoRetirementSkipsLock(t *testing.T) {
+	useCookies(t, "SESSDATA=a")
+	m := NewSessionManager("")
+	session := m.Acquire()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		m.retireIfDue(session)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("retireIfDue waited for the manager without retirement limits")
+	}
+}
+
+func TestSession_CountsCookieUsage(t *testing.T) {
+	useCookies(t, "SESSDATA=a")
+	SetTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"code":0,"data":{}}`
+		switch req.URL.Path {
+		case "/blocked":
+			body = `{"code":-412,"message":"请求被拦截"}`
+		case "/down":
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body)), Request: req}, nil
+	}))
+	t.Cleanup(func() { SetTransport(nil) })
+
+	session := NewSession("")
+	if err := getJSON("https://api.bilibili.com/ok", session, "", nil); err != nil {
+		t.Fatalf("getJSON failed: %v", err)
+	}
+	getJSON("https://api.bilibili.com/blocked", session, "", nil)
+	getJSON("https://api.bilibili.com/down", session, "", nil)
+
+	usage := cookie.GetCookiePool("").Usage()
+	if len(usage) != 1 {
+		t.Fatalf("usage = %+v, expected one cookie", usage)
+	}
+	// The warm-up counts as a successful request
+	expected := cookie.Usage{Name: "SESSDATA=a", Requests: 4, Successes: 2, Failures: 2, CookieErrors: 1}
+	if usage[0] != expected {
+		t.Errorf("usage = %+v, expected %+v", usage[0], expected)
+	}
+}
@@ -0,0 +1,182 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"spider-go/api"
+	"spider-go/cookie"
+	"spider-go/crawler"
+	"spider-go/storage"
+)
+
+// Stages lists the pipeline stages a benchmark reports, in pipeline order
+var Stages = []string{"search", "detail", "comment", "reply", "account"}
+
+// Options configures a benchmark run
+type Options struct {
+	Fixture
+	Threads int           // crawler threads per stage
+	Latency time.Duration // delay the fake API adds to every response
+}
+
+// DefaultOptions returns a fixture of a few thousand records per stage
+func DefaultOptions() Options {
+	return Options{
+		Fixture: Fixture{Videos: 100, Comments: 40, Replies: 3, Users: 2000},
+		Threads: 4,
+	}
+}
+
+// StageResult is the throughput of one stage. Its window runs from the
+// stage's first request to its last.
+type StageResult struct {
+	Stage    string        `json:"stage"`
+	Requests int           `json:"requests"`
+	Records  int           `json:"records"` // records saved, 0 for search
+	Window   time.Duration `json:"window"`
+}
+
+// RequestsPerSecond returns the request rate over the stage's window
+func (s StageResult) RequestsPerSecond() float64 {
+	return perSecond(s.Requests, s.Window)
+}
+
+// RecordsPerSecond returns the saved record rate over the stage's window
+func (s StageResult) RecordsPerSecond() float64 {
+	return perSecond(s.Records, s.Window)
+}
+
+// Result is the outcome of a benchmark run
+type Result struct {
+	Elapsed  time.Duration    `json:"elapsed"`
+	Stages   []StageResult    `json:"stages"`
+	Records  int64            `json:"records"` // records published to the sink
+	Bytes    int64            `json:"bytes"`
+	Counters crawler.Counters `json:"counters"`
+	ExitCode int              `json:"exit_code"`
+}
+
+// RecordsPerSecond returns the published record rate over the whole run
+func (r Result) RecordsPerSecond() float64 {
+	return perSecond(int(r.Records), r.Elapsed)
+}
+
+func perSecond(n int, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+// Run crawls the fake API with the full pipeline until it finishes or ctx
+// is done. Records go to a counting sink and crawl state to a temporary
+// directory, so nothing is published and no real state is touched. It
+// replaces the process-wide API transport, sink, cookie pool, record
+// directory and rate limiter, and must not run alongside another crawl. The
+// API transport and record directory are restored when it returns.
+func Run(ctx context.Context, opts Options, logOut io.Writer) (Result, error) {
+	if err := opts.check(); err != nil {
+		return Result{}, err
+	}
+	if opts.Threads < 1 {
+		return Result{}, fmt.Errorf("threads must be >= 1 (got %d)", opts.Threads)
+	}
+
+	dir, err := os.MkdirTemp("", "biliclaw-bench-*")
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create bench directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fake := newFakeAPI(opts.Fixture, opts.Latency)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	previousTransport := api.Transport()
+	api.SetTransport(redirectTransport{target: target, base: http.DefaultTransport})
+	defer api.SetTransport(previousTransport)
+
+	var records, bytes atomic.Int64
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		records.Add(1)
+		bytes.Add(int64(len(value)))
+		return nil
+	}))
+	defer storage.SetSink(nil)
+	previousDir := storage.RecordDir()
+	storage.SetRecordDir(filepath.Join(dir, "sent_records"))
+	defer storage.SetRecordDir(previousDir)
+	defer storage.CloseSentIDs()
+
+	config := benchConfig(opts, filepath.Join(dir, "cookies.json"))
+	cookie.SetCookiePool(cookie.NewCookiePool(config.CookieConfigPath))
+
+	c, err := crawler.NewBiliCrawler(config)
+	if err != nil {
+		return Result{}, err
+	}
+	c.SetLogOutput(logOut)
+	stop := context.AfterFunc(ctx, c.Cancel)
+	defer stop()
+
+	start := time.Now()
+	c.Run()
+	result := Result{
+		Elapsed:  time.Since(start),
+		Records:  records.Load(),
+		Bytes:    bytes.Load(),
+		Counters: c.Snapshot().Counters,
+		ExitCode: c.ExitCode(),
+	}
+	result.Stages = stageResults(fake.stageHits(), result.Counters)
+	return result, ctx.Err()
+}
+
+// benchConfig returns a config that crawls every video of the fixture as
+// fast as the pipeline allows
+func benchConfig(opts Options, cookiePath string) crawler.Config {
+	config := crawler.DefaultConfig()
+	config.Keyword = "bench"
+	config.NThreads = opts.Threads
+	config.PagesPerThread = (opts.searchPages() + opts.Threads - 1) / opts.Threads
+	config.DelayMin = 0
+	config.DelayMax = 0
+	config.Resume = false
+	config.ResumePendingMids = false
+	config.CookieConfigPath = cookiePath
+	config.RateLimitRate = 1e9
+	config.RateLimitCapacity = 1e9
+	config.ReportPath = ""
+	config.KafkaOutput = false
+	return config
+}
+
+// stageResults pairs the requests the fake API saw with the records saved
+func stageResults(hits map[string]stageHits, counters crawler.Counters) []StageResult {
+	saved := map[string]int{
+		"detail":  counters.VideosSaved,
+		"comment": counters.CommentsSaved,
+		"reply":   counters.RepliesSaved,
+		"account": counters.AccountsSaved,
+	}
+	results := make([]StageResult, 0, len(Stages))
+	for _, stage := range Stages {
+		h := hits[stage]
+		results = append(results, StageResult{
+			Stage:    stage,
+			Requests: h.count,
+			Records:  saved[stage],
+			Window:   h.last.Sub(h.first),
+		})
+	}
+	return results
+}
@@ -0,0 +1,150 @@
+package bench
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestRun_CrawlsFixture(t *testing.T) {
+	opts := Options{
+		Fixture: Fixture{Videos: 60, Comments: 25, Replies: 3, Users: 40},
+		Threads: 2,
+	}
+	result, err := Run(context.Background(), opts, io.Discard)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	counters := result.Counters
+	if counters.VideosSaved != 60 {
+		t.Errorf("VideosSaved = %d, want 60", counters.VideosSaved)
+	}
+	if counters.CommentsSaved != 60*25 {
+		t.Errorf("CommentsSaved = %d, want %d", counters.CommentsSaved, 60*25)
+	}
+	if counters.RepliesSaved != 60*25*3 {
+		t.Errorf("RepliesSaved = %d, want %d", counters.RepliesSaved, 60*25*3)
+	}
+	if counters.AccountsSaved != 40+60 {
+		t.Errorf("AccountsSaved = %d, want %d", counters.AccountsSaved, 40+60)
+	}
+
+	want := map[string]int{
+		"search":  2,       // 50 videos per page
+		"detail":  60,      // one per video
+		"comment": 60 * 2,  // 20 comments per page
+		"reply":   60 * 25, // one page per comment
+		"account": 40 + 60,
+	}
+	if len(result.Stages) != len(Stages) {
+		t.Fatalf("got %d stages, want %d", len(result.Stages), len(Stages))
+	}
+	for _, stage := range result.Stages {
+		if stage.Requests != want[stage.Stage] {
+			t.Errorf("%s requests = %d, want %d", stage.Stage, stage.Requests, want[stage.Stage])
+		}
+	}
+	if drift := api.DriftReport(); len(drift) != 0 {
+		t.Errorf("fake API drifts from the response schemas: %+v", drift)
+	}
+	if result.Records < int64(60+60*25*4) {
+		t.Errorf("Records = %d, want at least %d", result.Records, 60+60*25*4)
+	}
+}
+
+func TestRun_RestoresGlobals(t *testing.T) {
+	dir := t.TempDir()
+	storage.SetRecordDir(dir)
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+	rt := http.DefaultTransport
+	api.SetTransport(rt)
+	t.Cleanup(func() { api.SetTransport(nil) })
+
+	opts := Options{Fixture: Fixture{Videos: 1, Users: 1}, Threads: 1}
+	if _, err := Run(context.Background(), opts, io.Discard); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if got := storage.RecordDir(); got != dir {
+		t.Errorf("record directory = %q after Run, want %q", got, dir)
+	}
+	if api.Transport() != rt {
+		t.Error("API transport not restored after Run")
+	}
+}
+
+func TestRun_CancelWhilePaused(t *testing.T) {
+	ratelimit.Pause()
+	defer ratelimit.ResumeAll()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	opts := Options{Fixture: Fixture{Videos: 10, Comments: 5, Users: 5}, Threads: 2}
+	finished := make(chan error, 1)
+	go func() {
+		_, err := Run(ctx, opts, io.Discard)
+		finished <- err
+	}()
+
+	select {
+	case err := <-finished:
+		if err != context.Canceled {
+			t.Errorf("Run = %v, expected %v", err, context.Canceled)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("cancelled crawl did not finish while paused")
+	}
+}
+
+func TestRun_InvalidOptions(t *testing.T) {
+	cases := []Options{
+		{Fixture: Fixture{Videos: 0, Users: 1}, Threads: 1},
+		{Fixture: Fixture{Videos: 1, Replies: maxReplies + 1, Users: 1}, Threads: 1},
+		{Fixture: Fixture{Videos: 1, Users: 0}, Threads: 1},
+		{Fixture: Fixture{Videos: 1, Users: 1}, Threads: 0},
+	}
+	for _, opts := range cases {
+		if _, err := Run(context.Background(), opts, io.Discard); err == nil {
+			t.Errorf("Run(%+v) succeeded, want error", opts)
+		}
+	}
+}
+
+func TestVideoAid(t *testing.T) {
+	if aid, ok := videoAid(videoBvid(42)); !ok || aid != 42 {
+		t.Errorf("videoAid(videoBvid(42)) = %d, %v", aid, ok)
+	}
+	for _, bvid := range []string{"BV1xx411c7mD", "BVbench", "BVbench00000"} {
+		if _, ok := videoAid(bvid); ok {
+			t.Errorf("videoAid(%q) succeeded, want failure", bvid)
+		}
+	}
+}
+
+func TestFakeAPI_MainCommentsPaging(t *testing.T) {
+	f := newFakeAPI(Fixture{Videos: 1, Comments: 45, Users: 10}, 0)
+
+	var seen int
+	offset := ""
+	for page := 0; ; page++ {
+		data := f.mainComments(1, `{"offset":"`+offset+`"}`)
+		seen += len(data["replies"].([]map[string]interface{}))
+		cursor := data["cursor"].(map[string]interface{})
+		if cursor["is_end"].(bool) {
+			break
+		}
+		offset = cursor["pagination_reply"].(map[string]interface{})["next_offset"].(string)
+		if page > 5 {
+			t.Fatal("paging did not end")
+		}
+	}
+	if seen != 45 {
+		t.Errorf("saw %d comments, want 45", seen)
+	}
+}
@@ -0,0 +1,351 @@
+// Package bench runs the crawl pipeline against an in-process fake bilibili
+// API and reports its throughput per stage, without any real traffic
+package bench
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Page sizes the fake API serves; search matches the crawler's page size
+const (
+	searchPageSize  = 50
+	commentPageSize = 20
+)
+
+// ID strides keep every rpid unique: main comments of a video are numbered
+// under its aid, replies under their root comment
+const (
+	commentStride = 1_000_000
+	replyStride   = 1_000
+)
+
+// Limits on a fixture so that its IDs stay unique and exact as JSON numbers
+const (
+	maxVideos   = 100_000
+	maxComments = commentStride - 1
+	maxReplies  = replyStride - 1
+)
+
+// endpointStages maps the fake API paths to the crawler stage calling them
+var endpointStages = map[string]string{
+	"/x/web-interface/search/type": "search",
+	"/x/web-interface/view":        "detail",
+	"/x/v2/reply/wbi/main":         "comment",
+	"/x/v2/reply/reply":            "reply",
+	"/x/web-interface/card":        "account",
+}
+
+// Fixture sizes the canned data the fake API serves
+type Fixture struct {
+	Videos   int // videos the search finds
+	Comments int // main comments per video
+	Replies  int // replies per main comment
+	Users    int // distinct commenters, besides one uploader per video
+}
+
+// check reports the first fixture size out of range
+func (f Fixture) check() error {
+	switch {
+	case f.Videos < 1 || f.Videos > maxVideos:
+		return fmt.Errorf("videos must be within [1, %d] (got %d)", maxVideos, f.Videos)
+	case f.Comments < 0 || f.Comments > maxComments:
+		return fmt.Errorf("comments must be within [0, %d] (got %d)", maxComments, f.Comments)
+	case f.Replies < 0 || f.Replies > maxReplies:
+		return fmt.Errorf("replies must be within [0, %d] (got %d)", maxReplies, f.Replies)
+	case f.Users < 1:
+		return fmt.Errorf("users must be >= 1 (got %d)", f.Users)
+	}
+	return nil
+}
+
+// searchPages returns the number of search result pages
+func (f Fixture) searchPages() int {
+	return (f.Videos + searchPageSize - 1) / searchPageSize
+}
+
+// stageHits counts the requests of one stage and when they arrived
+type stageHits struct {
+	count       int
+	first, last time.Time
+}
+
+// fakeAPI answers the endpoints the pipeline calls with canned data
+// generated from a fixture, recording the requests of each stage
+type fakeAPI struct {
+	fixture Fixture
+	latency time.Duration // added before every API response
+
+	mu   sync.Mutex
+	hits map[string]*stageHits
+}
+
+func newFakeAPI(fixture Fixture, latency time.Duration) *fakeAPI {
+	return &fakeAPI{fixture: fixture, latency: latency, hits: make(map[string]*stageHits)}
+}
+
+// stageHits returns a copy of the request counts by stage
+func (f *fakeAPI) stageHits() map[string]stageHits {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make(map[string]stageHits, len(f.hits))
+	for stage, h := range f.hits {
+		out[stage] = *h
+	}
+	return out
+}
+
+func (f *fakeAPI) record(stage string) {
+	now := time.Now()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	h, ok := f.hits[stage]
+	if !ok {
+		h = &stageHits{first: now}
+		f.hits[stage] = h
+	}
+	h.count++
+	h.last = now
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/" {
+		// Session warmup
+		w.Write([]byte("ok"))
+		return
+	}
+	if stage, ok := endpointStages[r.URL.Path]; ok {
+		f.record(stage)
+	}
+	if f.latency > 0 {
+		time.Sleep(f.latency)
+	}
+
+	query := r.URL.Query()
+	var data interface{}
+	switch r.URL.Path {
+	case "/x/web-interface/nav":
+		data = map[string]interface{}{
+			"isLogin": false,
+			"wbi_img": map[string]interface{}{
+				"img_url": "https://i0.hdslb.com/bfs/wbi/7cd084941338484aae1ad9425b84077c.png",
+				"sub_url": "https://i0.hdslb.com/bfs/wbi/4932caff0ff746eab6f01bf08b70ac45.png",
+			},
+		}
+	case "/x/web-interface/search/type":
+		data = f.search(intParam(query, "page"), intParam(query, "page_size"))
+	case "/x/web-interface/view":
+		aid, ok := videoAid(query.Get("bvid"))
+		if !ok || aid > int64(f.fixture.Videos) {
+			writeError(w, -404, "啥都木有")
+			return
+		}
+		data = f.video(aid)
+	case "/x/v2/reply/wbi/main":
+		data = f.mainComments(int64(intParam(query, "oid")), query.Get("pagination_str"))
+	case "/x/v2/reply/reply":
+		data = f.replies(int64(intParam(query, "oid")), int64(intParam(query, "root")), intParam(query, "pn"), intParam(query, "ps"))
+	case "/x/web-interface/card":
+		data = f.card(query.Get("mid"))
+	default:
+		writeError(w, -404, "啥都木有")
+		return
+	}
+	writeData(w, data)
+}
+
+func (f *fakeAPI) search(page, pageSize int) map[string]interface{} {
+	if pageSize <= 0 {
+		pageSize = searchPageSize
+	}
+	start := min((max(page, 1)-1)*pageSize, f.fixture.Videos)
+	end := min(start+pageSize, f.fixture.Videos)
+
+	results := make([]map[string]interface{}, 0, end-start)
+	for i := start; i < end; i++ {
+		aid := int64(i + 1)
+		results = append(results, map[string]interface{}{
+			"type":    "video",
+			"aid":     aid,
+			"bvid":    videoBvid(aid),
+			"title":   fmt.Sprintf(`<em class="keyword">bench</em> 视频 %d`, aid),
+			"mid":     f.ownerMid(aid),
+			"author":  fmt.Sprintf("up%d", aid),
+			"play":    1000,
+			"review":  f.videoReplyCount(),
+			"pubdate": 1700000000 + aid,
+		})
+	}
+	return map[string]interface{}{
+		"result":   results,
+		"numPages": (f.fixture.Videos + pageSize - 1) / pageSize,
+	}
+}
+
+func (f *fakeAPI) video(aid int64) map[string]interface{} {
+	return map[string]interface{}{
+		"aid":     aid,
+		"bvid":    videoBvid(aid),
+		"cid":     aid,
+		"title":   fmt.Sprintf("bench 视频 %d", aid),
+		"pubdate": 1700000000 + aid,
+		"owner": map[string]interface{}{
+			"mid":  f.ownerMid(aid),
+			"name": fmt.Sprintf("up%d", aid),
+		},
+		"stat": map[string]interface{}{
+			"view":  1000,
+			"reply": f.videoReplyCount(),
+		},
+	}
+}
+
+func (f *fakeAPI) mainComments(aid int64, paginationStr string) map[string]interface{} {
+	var pagination struct {
+		Offset string `json:"offset"`
+	}
+	json.Unmarshal([]byte(paginationStr), &pagination)
+	page, _ := strconv.Atoi(pagination.Offset)
+
+	start := min(page*commentPageSize, f.fixture.Comments)
+	end := min(start+commentPageSize, f.fixture.Comments)
+	replies := make([]map[string]interface{}, 0, end-start)
+	for i := start; i < end; i++ {
+		rpid := aid*commentStride + int64(i+1)
+		replies = append(replies, f.comment(aid, rpid, 0, f.commenterMid(aid, i, 0), f.fixture.Replies))
+	}
+
+	isEnd := end >= f.fixture.Comments
+	nextOffset := ""
+	if !isEnd {
+		nextOffset = strconv.Itoa(page + 1)
+	}
+	return map[string]interface{}{
+		"replies": replies,
+		"cursor": map[string]interface{}{
+			"is_end":           isEnd,
+			"pagination_reply": map[string]interface{}{"next_offset": nextOffset},
+		},
+	}
+}
+
+func (f *fakeAPI) replies(aid, root int64, page, pageSize int) map[string]interface{} {
+	if pageSize <= 0 {
+		pageSize = commentPageSize
+	}
+	start := min((max(page, 1)-1)*pageSize, f.fixture.Replies)
+	end := min(start+pageSize, f.fixture.Replies)
+	index := int(root - aid*commentStride - 1)
+	replies := make([]map[string]interface{}, 0, end-start)
+	for i := start; i < end; i++ {
+		mid := f.commenterMid(aid, index, i+1)
+		replies = append(replies, f.comment(aid, root*replyStride+int64(i+1), root, mid, 0))
+	}
+	return map[string]interface{}{
+		"replies": replies,
+		"page":    map[string]interface{}{"count": f.fixture.Replies},
+	}
+}
+
+// comment builds a main comment (root 0) or a reply
+func (f *fakeAPI) comment(aid, rpid, root, mid int64, rcount int) map[string]interface{} {
+	return map[string]interface{}{
+		"rpid":   rpid,
+		"oid":    aid,
+		"type":   1,
+		"mid":    mid,
+		"root":   root,
+		"parent": root,
+		"rcount": rcount,
+		"like":   rpid % 100,
+		"ctime":  1700000000 + rpid%86400,
+		"content": map[string]interface{}{
+			"message": fmt.Sprintf("bench 评论 %d", rpid),
+		},
+		"member": map[string]interface{}{
+			"mid":   strconv.FormatInt(mid, 10),
+			"uname": fmt.Sprintf("user%d", mid),
+		},
+	}
+}
+
+func (f *fakeAPI) card(mid string) map[string]interface{} {
+	return map[string]interface{}{
+		"card": map[string]interface{}{
+			"mid":  mid,
+			"name": "user" + mid,
+			"sign": "",
+			"level_info": map[string]interface{}{
+				"current_level": 3,
+			},
+		},
+		"follower":      10,
+		"archive_count": 0,
+	}
+}
+
+// videoReplyCount is the comment count every video reports, replies included
+func (f *fakeAPI) videoReplyCount() int {
+	return f.fixture.Comments * (1 + f.fixture.Replies)
+}
+
+// commenterMid deals the comments out to the fixture's users in turn: the
+// index-th main comment of a video, or its reply-th reply (from 1)
+func (f *fakeAPI) commenterMid(aid int64, index, reply int) int64 {
+	n := ((aid-1)*int64(f.fixture.Comments)+int64(index))*int64(1+f.fixture.Replies) + int64(reply)
+	return 1 + n%int64(f.fixture.Users)
+}
+
+// ownerMid gives every video its own uploader, apart from the commenters
+func (f *fakeAPI) ownerMid(aid int64) int64 {
+	return int64(f.fixture.Users) + aid
+}
+
+// videoBvid and videoAid convert between a fake aid and its BVID
+func videoBvid(aid int64) string {
+	return fmt.Sprintf("BVbench%05d", aid)
+}
+
+func videoAid(bvid string) (int64, bool) {
+	digits, ok := strings.CutPrefix(bvid, "BVbench")
+	if !ok {
+		return 0, false
+	}
+	aid, err := strconv.ParseInt(digits, 10, 64)
+	return aid, err == nil && aid > 0
+}
+
+func intParam(query url.Values, key string) int {
+	n, _ := strconv.Atoi(query.Get(key))
+	return n
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": 0, "message": "0", "data": data})
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "message": message})
+}
+
+// redirectTransport sends every request to the fake API whatever its host
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = t.target.Scheme
+	out.URL.Host = t.target.Host
+	out.Host = t.target.Host
+	return t.base.RoundTrip(out)
+}
@@ -0,0 +1,174 @@
+// Package biliclaw embeds the crawler in other Go programs:
+//
+//	client, err := biliclaw.New(
+//		biliclaw.WithConfig(cfg),
+//		biliclaw.WithSink(biliclaw.SinkFunc(func(topic, key string, value []byte) error {
+//			...
+//		})),
+//	)
+//	counters, err := client.CrawlKeyword(ctx, "原神")
+//
+// The rate limiter, cookie pool, sink and sent records are process-wide, so
+// a Client runs one crawl at a time and a program should use one Client.
+package biliclaw
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"spider-go/cookie"
+	"spider-go/crawler"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+// Sink receives every saved record, encoded as JSON, in place of Kafka
+type Sink = storage.Sink
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc = storage.SinkFunc
+
+// Counters are the totals of a finished crawl
+type Counters = crawler.Counters
+
+// Option configures a Client
+type Option func(*Client)
+
+// Client runs crawls in-process
+type Client struct {
+	config  crawler.Config
+	sink    Sink
+	pool    *cookie.CookiePool
+	limiter *ratelimit.TokenBucket
+	logger  io.Writer
+	ctx     context.Context
+
+	mu sync.Mutex
+}
+
+// WithConfig sets the crawl config; the default is crawler.DefaultConfig.
+// Keyword is overridden by CrawlKeyword.
+func WithConfig(config crawler.Config) Option {
+	return func(c *Client) { c.config = config }
+}
+
+// WithSink sends saved records to sink instead of Kafka
+func WithSink(sink Sink) Option {
+	return func(c *Client) { c.sink = sink }
+}
+
+// WithCookiePool uses pool instead of the pool loaded from cookie_config_path
+func WithCookiePool(pool *cookie.CookiePool) Option {
+	return func(c *Client) { c.pool = pool }
+}
+
+// WithLimiter uses limiter instead of one built from rate_limit_rate and
+// rate_limit_capacity
+func WithLimiter(limiter *ratelimit.TokenBucket) Option {
+	return func(c *Client) { c.limiter = limiter }
+}
+
+// WithLogger writes progress messages to w; the default discards them
+func WithLogger(w io.Writer) Option {
+	return func(c *Client) { c.logger = w }
+}
+
+// WithContext cancels every crawl of the Client once ctx is done, in
+// addition to the context passed to each crawl
+func WithContext(ctx context.Context) Option {
+	return func(c *Client) { c.ctx = ctx }
+}
+
+// New creates a Client
+func New(opts ...Option) (*Client, error) {
+	c := &Client{
+		config: crawler.DefaultConfig(),
+		logger: io.Discard,
+		ctx:    context.Background(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.ctx == nil {
+		return nil, fmt.Errorf("context must not be nil")
+	}
+
+	if c.sink != nil {
+		storage.SetSink(c.sink)
+	}
+	if c.pool != nil {
+		cookie.SetCookiePool(c.pool)
+	}
+	return c, nil
+}
+
+// CrawlKeyword searches a keyword and crawls the videos found with their
+// comments, users and whatever else the config enables
+func (c *Client) CrawlKeyword(ctx context.Context, keyword string) (Counters, error) {
+	keyword = strings.TrimSpace(keyword)
+	if keyword == "" {
+		return Counters{}, fmt.Errorf("keyword is empty")
+	}
+	config := c.config
+	config.Keyword = keyword
+	return c.crawl(ctx, config, (*crawler.BiliCrawler).Run)
+}
+
+// CrawlVideo crawls a single video with its comments, users and whatever
+// else the config enables. Its records are tagged with the configured
+// keyword, or the BVID if there is none.
+func (c *Client) CrawlVideo(ctx context.Context, bvid string) (Counters, error) {
+	bvid = strings.TrimSpace(bvid)
+	if bvid == "" {
+		return Counters{}, fmt.Errorf("bvid is empty")
+	}
+	config := c.config
+	if strings.TrimSpace(config.Keyword) == "" {
+		config.Keyword = bvid
+	}
+	return c.crawl(ctx, config, func(b *crawler.BiliCrawler) {
+		b.CrawlVideos([]string{bvid})
+	})
+}
+
+// crawl runs one crawl until it finishes or a context is done. Cancelled
+// crawls return the context's error, aborted or partly failed crawls an
+// error with their exit code.
+func (c *Client) crawl(ctx context.Context, config crawler.Config, mode func(*crawler.BiliCrawler)) (Counters, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := config.Validate(); err != nil {
+		return Counters{}, fmt.Errorf("invalid config: %w", err)
+	}
+	b, err := crawler.NewBiliCrawler(config)
+	if err != nil {
+		return Counters{}, err
+	}
+	if c.limiter != nil {
+		ratelimit.SetRateLimiter(c.limiter)
+	}
+	b.SetLogOutput(c.logger)
+
+	stopCall := context.AfterFunc(ctx, b.Cancel)
+	defer stopCall()
+	stopClient := context.AfterFunc(c.ctx, b.Cancel)
+	defer stopClient()
+
+	mode(b)
+
+	counters := b.Snapshot().Counters
+	if err := ctx.Err(); err != nil {
+		return counters, err
+	}
+	if err := c.ctx.Err(); err != nil {
+		return counters, err
+	}
+	if code := b.ExitCode(); code != crawler.ExitCompleted {
+		return counters, fmt.Errorf("crawl ended with exit code %d", code)
+	}
+	return counters, nil
+}
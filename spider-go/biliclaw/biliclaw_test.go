@@ -0,0 +1,49 @@
+package biliclaw
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"spider-go/crawler"
+)
+
+func TestNew_Defaults(t *testing.T) {
+	c, err := New()
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if c.config.NThreads != crawler.DefaultConfig().NThreads {
+		t.Error("New should start from the default config")
+	}
+	if c.ctx == nil || c.logger == nil {
+		t.Error("New should default the context and logger")
+	}
+}
+
+func TestNew_NilContext(t *testing.T) {
+	if _, err := New(WithContext(nil)); err == nil {
+		t.Error("expected an error for a nil context")
+	}
+}
+
+func TestCrawlKeyword_Empty(t *testing.T) {
+	c, _ := New()
+	if _, err := c.CrawlKeyword(context.Background(), "  "); err == nil {
+		t.Error("expected an error for an empty keyword")
+	}
+	if _, err := c.CrawlVideo(context.Background(), ""); err == nil {
+		t.Error("expected an error for an empty bvid")
+	}
+}
+
+func TestCrawlKeyword_InvalidConfig(t *testing.T) {
+	config := crawler.DefaultConfig()
+	config.NThreads = 0
+	c, _ := New(WithConfig(config))
+
+	_, err := c.CrawlKeyword(context.Background(), "测试")
+	if err == nil || !strings.Contains(err.Error(), "n_threads") {
+		t.Errorf("err = %v, expected the config validation error", err)
+	}
+}
@@ -0,0 +1,692 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"spider-go/api"
+	"spider-go/bench"
+	"spider-go/cookie"
+	"spider-go/crawler"
+	"spider-go/storage"
+	"spider-go/tui"
+	"spider-go/web"
+)
+
+// errLimitReached stops an export once enough messages were written
+var errLimitReached = errors.New("limit reached")
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: %s %s [选项]\n", os.Args[0], name)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// configSource is where a command's config comes from
+type configSource struct {
+	path      *string
+	profile   *string
+	overrides map[string]string
+}
+
+// configFlags registers -config, -profile, one override flag per config key
+// and the -quiet/-verbose shorthands for log_level
+func configFlags(fs *flag.FlagSet) configSource {
+	source := configSource{
+		path:      fs.String("config", "config.json", "配置文件路径，支持 .json/.yaml/.yml/.toml（为空则只使用默认值、环境变量和命令行）"),
+		profile:   fs.String("profile", os.Getenv("SPIDER_PROFILE"), "使用配置文件 profiles 中的命名配置（环境变量 SPIDER_PROFILE）"),
+		overrides: crawler.ConfigFlags(fs),
+	}
+	fs.BoolFunc("quiet", "只输出错误和最终统计（同 -log_level quiet）", source.logLevelFlag(crawler.LogQuiet))
+	fs.BoolFunc("verbose", "输出每个搜索页、视频、评论和用户的处理过程（同 -log_level verbose）", source.logLevelFlag(crawler.LogVerbose))
+	return source
+}
+
+// logLevelFlag sets log_level to level when its boolean flag is true, so
+// -quiet=false leaves the level alone
+func (s configSource) logLevelFlag(level string) func(string) error {
+	return func(value string) error {
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		if on {
+			s.overrides["log_level"] = level
+		}
+		return nil
+	}
+}
+
+// resolve reads the config file and profile, SPIDER_* environment variables
+// and command-line overrides, in increasing precedence
+func (s configSource) resolve() (crawler.Config, error) {
+	return crawler.ResolveConfig(*s.path, *s.profile, os.LookupEnv, s.overrides)
+}
+
+func loadConfig(source configSource) (crawler.Config, bool) {
+	config, err := source.resolve()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
+		return config, false
+	}
+	return config, true
+}
+
+func runCrawl(args []string) int {
+	return runPipeline("crawl", args, (*crawler.BiliCrawler).Run)
+}
+
+func runRetryFailed(args []string) int {
+	return runPipeline("retry-failed", args, (*crawler.BiliCrawler).RetryFailed)
+}
+
+func runCrawlComments(args []string) int {
+	return runPipeline("crawl-comments", args, (*crawler.BiliCrawler).CrawlComments)
+}
+
+func runCrawlAccounts(args []string) int {
+	return runPipeline("crawl-accounts", args, (*crawler.BiliCrawler).CrawlAccounts)
+}
+
+func runSnapshotStats(args []string) int {
+	return runPipeline("snapshot-stats", args, (*crawler.BiliCrawler).SnapshotStats)
+}
+
+func runTrending(args []string) int {
+	return runPipelineWith("trending", args, (*crawler.BiliCrawler).Trending, crawler.Config.ValidateTrending)
+}
+
+// cancelOnSignal cancels the crawl on the first interrupt or SIGTERM, so the
+// stages drain and the sink, sent records and report are written out as on
+// any other stop. A second signal writes out the buffered sent records and
+// exits at once. The returned function reports the first signal's exit code,
+// or 0 if none arrived.
+func cancelOnSignal(c *crawler.BiliCrawler) func() int {
+	var code atomic.Int32
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		code.Store(int32(128 + int(sig.(syscall.Signal))))
+		fmt.Fprintln(os.Stderr, "收到中断，正在收尾；再次中断将立即退出")
+		c.Cancel()
+
+		sig = <-signals
+		storage.CloseSentIDs()
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}()
+	return func() int { return int(code.Load()) }
+}
+
+// randomToken returns a fresh web control token
+func randomToken() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// runPipeline builds a crawler from the config and runs one of its modes,
+// optionally with the web console and the terminal dashboard
+func runPipeline(name string, args []string, mode func(*crawler.BiliCrawler)) int {
+	return runPipelineWith(name, args, mode, crawler.Config.Validate)
+}
+
+// runPipelineWith is runPipeline checking the config with validate
+func runPipelineWith(name string, args []string, mode func(*crawler.BiliCrawler), validate func(crawler.Config) error) int {
+	fs := newFlagSet(name)
+	source := configFlags(fs)
+	useTUI := fs.Bool("tui", false, "启用终端仪表盘")
+	fs.Parse(args)
+
+	config, ok := loadConfig(source)
+	if !ok {
+		return 1
+	}
+	if err := validate(config); err != nil {
+		fmt.Fprintf(os.Stderr, "配置无效:\n%v\n", err)
+		return 1
+	}
+
+	c, err := crawler.NewBiliCrawler(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "初始化爬虫失败: %v\n", err)
+		return 1
+	}
+	run := func() { mode(c) }
+	defer storage.CloseSink()
+	defer storage.CloseSentIDs()
+	interrupted := cancelOnSignal(c)
+	controlOnSignal(c)
+	exitCode := func() int {
+		code := c.ExitCode()
+		if signalled := interrupted(); signalled != 0 && (code == crawler.ExitCompleted || code == crawler.ExitCancelled) {
+			return signalled
+		}
+		return code
+	}
+
+	stopWatch, err := c.WatchConfig(*source.path, config.WatchConfig, source.resolve)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "监听配置文件失败: %v\n", err)
+	} else {
+		defer stopWatch()
+	}
+
+	if config.WebAddr != "" {
+		token := config.WebToken
+		if token == "" {
+			token = randomToken()
+		}
+		go func() {
+			if err := web.Serve(config.WebAddr, c, token); err != nil {
+				fmt.Fprintf(os.Stderr, "Web 控制台启动失败: %v\n", err)
+			}
+		}()
+		fmt.Printf("Web 控制台: http://%s/?token=%s\n", config.WebAddr, url.QueryEscape(token))
+	}
+
+	if *useTUI {
+		if err := tui.Run(c, run); err != nil {
+			fmt.Fprintf(os.Stderr, "仪表盘运行失败: %v\n", err)
+			return 1
+		}
+		return exitCode()
+	}
+
+	run()
+	return exitCode()
+}
+
+func runStatus(args []string) int {
+	fs := newFlagSet("status")
+	recordDir := fs.String("records", "sent_records", "记录目录")
+	asJSON := fs.Bool("json", false, "以 JSON 输出")
+	fs.Parse(args)
+
+	storage.SetRecordDir(*recordDir)
+	status, err := storage.GetRecordStatus()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取记录失败: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(status)
+		return 0
+	}
+
+	fmt.Printf("记录目录: %s\n", *recordDir)
+	fmt.Printf("已发送视频:       %d\n", status.SentVideos)
+	fmt.Printf("已发送评论:       %d\n", status.SentComments)
+	fmt.Printf("已发送用户:       %d\n", status.SentAccounts)
+	fmt.Printf("已发送动态:       %d\n", status.SentDynamics)
+	fmt.Printf("已发送字幕:       %d\n", status.SentSubtitles)
+	fmt.Printf("已爬弹幕的分P:    %d\n", status.DanmakuPages)
+	fmt.Printf("已发送专栏:       %d\n", status.SentArticles)
+	fmt.Printf("已发送直播间:     %d\n", status.SentLive)
+	fmt.Printf("已下架视频:       %d\n", status.Tombstones)
+	fmt.Printf("已爬关系的用户:   %d\n", status.RelationMids)
+	fmt.Printf("已爬收藏的用户:   %d\n", status.FavoriteMids)
+	fmt.Printf("搜索见过的视频:   %d\n", status.SeenSearchBvids)
+	fmt.Printf("待爬取用户:       %d\n", status.PendingMids)
+	fmt.Printf("待爬评论视频:     %d\n", status.PendingBvids)
+	fmt.Printf("评论进度:         完成 %d，中断 %d\n", status.CommentsDone, status.CommentsInProgress)
+	fmt.Printf("回复进度:         中断 %d\n", status.RepliesInProgress)
+
+	if len(status.FailedTasks) > 0 {
+		fmt.Println("失败任务:")
+		for _, kind := range sortedKeys(status.FailedTasks) {
+			fmt.Printf("  %-10s %d\n", kind, status.FailedTasks[kind])
+		}
+	}
+
+	if len(status.Searches) > 0 {
+		fmt.Println("搜索进度:")
+		keywords := make([]string, 0, len(status.Searches))
+		for keyword := range status.Searches {
+			keywords = append(keywords, keyword)
+		}
+		sort.Strings(keywords)
+		for _, keyword := range keywords {
+			p := status.Searches[keyword]
+			fmt.Printf("  %s: 已爬 %d/%d 页，更新于 %s\n", keyword, len(p.Pages), p.NumPages,
+				time.Unix(p.Updated, 0).Format("2006-01-02 15:04"))
+		}
+	}
+	return 0
+}
+
+func runValidateCookies(args []string) int {
+	fs := newFlagSet("validate-cookies")
+	source := configFlags(fs)
+	fs.Parse(args)
+
+	config, ok := loadConfig(source)
+	if !ok {
+		return 1
+	}
+	if config.UserAgent != "" {
+		api.SetUserAgent(config.UserAgent)
+	}
+
+	cookies, err := cookie.LoadCookieConfig(config.CookieConfigPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取 Cookie 配置失败: %v\n", err)
+		return 1
+	}
+
+	valid := 0
+	for i, item := range cookies.Cookies {
+		name := item.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if !item.Enabled || item.Value == "" {
+			fmt.Printf("%-12s 已禁用\n", name)
+			continue
+		}
+
+		info, err := api.GetNavInfo(item.Value)
+		switch {
+		case err != nil:
+			fmt.Printf("%-12s 检查失败: %v\n", name, err)
+		case !info.IsLogin:
+			fmt.Printf("%-12s 未登录（Cookie 已失效）\n", name)
+		default:
+			valid++
+			fmt.Printf("%-12s 有效: %s (mid=%d)\n", name, info.Uname, info.Mid)
+		}
+	}
+
+	fmt.Printf("有效 Cookie: %d/%d\n", valid, len(cookies.Cookies))
+	if valid == 0 {
+		return 1
+	}
+	return 0
+}
+
+// kindTopic returns the topic of a data kind, or with a keyword the topic
+// its records are routed to by template
+func kindTopic(kind, keyword, template string) (string, error) {
+	topic, err := storage.TopicFor(kind)
+	if err != nil || keyword == "" {
+		return topic, err
+	}
+	if err := storage.CheckTopicTemplate(template); err != nil {
+		return "", err
+	}
+	storage.SetTopicTemplate(template)
+	return storage.RoutedTopic(topic, keyword), nil
+}
+
+func runExport(args []string) int {
+	fs := newFlagSet("export")
+	kind := fs.String("kind", "video", "数据类型: video, comment, account, dynamic, relation, favorite, subtitle, danmaku, article, live, stat, tombstone, quarantine")
+	output := fs.String("o", "", "输出文件（默认标准输出）")
+	limit := fs.Int("limit", 0, "最多导出条数（0 表示全部）")
+	keyword := fs.String("keyword", "", "按 topic_template 读取该关键词的主题")
+	template := fs.String("topic-template", "{topic}.{keyword}", "与爬取时相同的 topic_template")
+	fs.Parse(args)
+
+	topic, err := kindTopic(*kind, *keyword, *template)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "创建输出文件失败: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	count := 0
+	err = storage.ReadTopic(ctx, topic, true, false, func(key, value []byte) error {
+		w.Write(value)
+		w.WriteByte('\n')
+		count++
+		if *limit > 0 && count >= *limit {
+			return errLimitReached
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errLimitReached) {
+		fmt.Fprintf(os.Stderr, "导出中断: %v\n", err)
+		return 1
+	}
+
+	fmt.Fprintf(os.Stderr, "已从 %s 导出 %d 条\n", topic, count)
+	return 0
+}
+
+func runConsume(args []string) int {
+	fs := newFlagSet("consume")
+	kind := fs.String("kind", "video", "数据类型: video, comment, account, dynamic, relation, favorite, subtitle, danmaku, article, live, stat, tombstone, quarantine")
+	fromStart := fs.Bool("from-beginning", false, "从最早的消息开始")
+	keyword := fs.String("keyword", "", "按 topic_template 读取该关键词的主题")
+	template := fs.String("topic-template", "{topic}.{keyword}", "与爬取时相同的 topic_template")
+	fs.Parse(args)
+
+	topic, err := kindTopic(*kind, *keyword, *template)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "正在消费 %s，按 Ctrl+C 退出\n", topic)
+	err = storage.ReadTopic(ctx, topic, *fromStart, true, func(key, value []byte) error {
+		fmt.Printf("%s\t%s\n", key, value)
+		return nil
+	})
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "消费中断: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runRepublish(args []string) int {
+	fs := newFlagSet("republish")
+	source := configFlags(fs)
+	kind := fs.String("kind", "video", "数据类型: video, comment, account, dynamic, relation, favorite, subtitle, danmaku, article, live, stat, tombstone, quarantine")
+	input := fs.String("i", "", "export 导出的 JSON Lines 文件（默认标准输入）")
+	fromTopic := fs.String("from-topic", "", "改为直接读取该 Kafka 主题中的原始消息，按原 key 重新发布")
+	topic := fs.String("topic", "", "目标主题（默认为该类数据的主题）")
+	fs.Parse(args)
+
+	if *input != "" && *fromTopic != "" {
+		fmt.Fprintln(os.Stderr, "-i 和 -from-topic 只能指定一个")
+		return 2
+	}
+	if *topic == "" {
+		t, err := storage.TopicFor(*kind)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return 2
+		}
+		*topic = t
+	}
+
+	config, ok := loadConfig(source)
+	if !ok {
+		return 1
+	}
+	if err := crawler.SetupSinks(config); err != nil {
+		fmt.Fprintf(os.Stderr, "初始化输出失败: %v\n", err)
+		return 1
+	}
+	defer storage.CloseSink()
+
+	var count int
+	var err error
+	if *fromTopic != "" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		count, err = storage.RepublishTopic(ctx, *fromTopic, *topic)
+	} else {
+		var in io.Reader = os.Stdin
+		if *input != "" {
+			f, err := os.Open(*input)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "打开输入文件失败: %v\n", err)
+				return 1
+			}
+			defer f.Close()
+			in = f
+		}
+		count, err = storage.Republish(in, *kind, *topic)
+	}
+	fmt.Fprintf(os.Stderr, "已向 %s 重新发布 %d 条\n", *topic, count)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "重新发布中断: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runState(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "export":
+			return runStateExport(args[1:])
+		case "import":
+			return runStateImport(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "用法: %s state export|import [选项]\n", os.Args[0])
+	return 2
+}
+
+// stateFlags registers the flags shared by state export and import
+func stateFlags(fs *flag.FlagSet) (recordDir *string, source configSource) {
+	recordDir = fs.String("records", "sent_records", "记录目录")
+	return recordDir, configFlags(fs)
+}
+
+func runStateExport(args []string) int {
+	fs := newFlagSet("state export")
+	recordDir, source := stateFlags(fs)
+	output := fs.String("o", "state.tar.gz", "输出文件")
+	fs.Parse(args)
+
+	config, ok := loadConfig(source)
+	if !ok {
+		return 1
+	}
+	storage.SetRecordDir(*recordDir)
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建输出文件失败: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	names, err := storage.ExportState(f, config.CookieConfigPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导出状态失败: %v\n", err)
+		return 1
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	fmt.Fprintf(os.Stderr, "已导出 %d 个文件到 %s\n", len(names), *output)
+	return 0
+}
+
+func runStateImport(args []string) int {
+	fs := newFlagSet("state import")
+	recordDir, source := stateFlags(fs)
+	input := fs.String("i", "state.tar.gz", "状态包文件")
+	force := fs.Bool("force", false, "覆盖已存在的文件")
+	fs.Parse(args)
+
+	config, ok := loadConfig(source)
+	if !ok {
+		return 1
+	}
+	storage.SetRecordDir(*recordDir)
+
+	f, err := os.Open(*input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "打开状态包失败: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	restored, err := storage.ImportState(f, config.CookieConfigPath, *force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导入状态失败: %v\n", err)
+		return 1
+	}
+	for _, target := range restored {
+		fmt.Println(target)
+	}
+	fmt.Fprintf(os.Stderr, "已恢复 %d 个文件\n", len(restored))
+	return 0
+}
+
+func runDedup(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "export":
+			return runDedupExport(args[1:])
+		case "import":
+			return runDedupImport(args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "用法: %s dedup export|import [选项]\n", os.Args[0])
+	return 2
+}
+
+func runDedupExport(args []string) int {
+	fs := newFlagSet("dedup export")
+	recordDir := fs.String("records", "sent_records", "记录目录")
+	kinds := fs.String("kind", strings.Join(storage.DedupSetKinds(), ","), "要导出的集合，逗号分隔: video, comment, account")
+	output := fs.String("o", "dedup.gz", "输出文件")
+	fs.Parse(args)
+	storage.SetRecordDir(*recordDir)
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建输出文件失败: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	selected := strings.Split(*kinds, ",")
+	counts, err := storage.ExportSentIDs(f, selected)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导出去重集合失败: %v\n", err)
+		return 1
+	}
+	for _, kind := range selected {
+		fmt.Printf("%s\t%d\n", kind, counts[kind])
+	}
+	return 0
+}
+
+func runDedupImport(args []string) int {
+	fs := newFlagSet("dedup import")
+	recordDir := fs.String("records", "sent_records", "记录目录")
+	input := fs.String("i", "dedup.gz", "dedup export 导出的文件")
+	fs.Parse(args)
+	storage.SetRecordDir(*recordDir)
+	defer storage.CloseSentIDs()
+
+	f, err := os.Open(*input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "打开输入文件失败: %v\n", err)
+		return 1
+	}
+	defer f.Close()
+
+	added, err := storage.ImportSentIDs(f)
+	for _, kind := range storage.DedupSetKinds() {
+		if n, ok := added[kind]; ok {
+			fmt.Printf("%s\t+%d\n", kind, n)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导入去重集合失败: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runBench(args []string) int {
+	defaults := bench.DefaultOptions()
+	fs := newFlagSet("bench")
+	videos := fs.Int("videos", defaults.Videos, "模拟搜索到的视频数")
+	comments := fs.Int("comments", defaults.Comments, "每个视频的一级评论数")
+	replies := fs.Int("replies", defaults.Replies, "每条一级评论的回复数")
+	users := fs.Int("users", defaults.Users, "评论者人数（另有每个视频一名 UP 主）")
+	threads := fs.Int("threads", defaults.Threads, "每个阶段的线程数")
+	latency := fs.Duration("latency", 0, "模拟接口每次响应的延迟")
+	verbose := fs.Bool("v", false, "输出爬虫日志")
+	asJSON := fs.Bool("json", false, "以 JSON 输出")
+	fs.Parse(args)
+
+	opts := bench.Options{
+		Fixture: bench.Fixture{Videos: *videos, Comments: *comments, Replies: *replies, Users: *users},
+		Threads: *threads,
+		Latency: *latency,
+	}
+	var logOut io.Writer = io.Discard
+	if *verbose {
+		logOut = os.Stderr
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "正在用模拟接口压测: %d 个视频，每个 %d 条评论、每条 %d 条回复，%d 线程\n",
+		*videos, *comments, *replies, *threads)
+	result, err := bench.Run(ctx, opts, logOut)
+	if err != nil && ctx.Err() == nil {
+		fmt.Fprintf(os.Stderr, "压测失败: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(result)
+		return 0
+	}
+
+	fmt.Println("阶段       请求数   记录数       耗时    请求/秒    记录/秒")
+	for _, stage := range result.Stages {
+		fmt.Printf("%-8s %8d %8d %10s %10.1f %10.1f\n", stage.Stage, stage.Requests, stage.Records,
+			stage.Window.Round(time.Millisecond), stage.RequestsPerSecond(), stage.RecordsPerSecond())
+	}
+	fmt.Printf("总计: %d 条记录（%.1f MB），用时 %s，%.1f 条/秒\n", result.Records, float64(result.Bytes)/(1<<20),
+		result.Elapsed.Round(time.Millisecond), result.RecordsPerSecond())
+	if ctx.Err() != nil {
+		fmt.Println("压测被中断，结果不完整")
+	}
+	return 0
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -2,6 +2,7 @@ package cookie
 
 import (
 	"encoding/json"
+	"fmt"
 	"math/rand"
 	"os"
 	"sync"
@@ -15,6 +16,7 @@ type CookieItem struct {
 	IsValid   bool   `json:"-"`
 	FailCount int    `json:"-"`
 	MaxFails  int    `json:"-"`
+	usage     Usage
 }
 
 // MarkFailed increments the fail count and returns true if the cookie should be disabled
@@ -65,15 +67,24 @@ func NewCookiePool(configPath string) *CookiePool {
 	return pool
 }
 
-// loadCookies loads cookies from the configuration file
-func (p *CookiePool) loadCookies() {
-	data, err := os.ReadFile(p.configPath)
+// LoadCookieConfig reads a cookie configuration file, including disabled cookies
+func LoadCookieConfig(path string) (*CookieConfig, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return
+		return nil, fmt.Errorf("failed to read cookie config: %w", err)
 	}
 
 	var config CookieConfig
 	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse cookie config: %w", err)
+	}
+	return &config, nil
+}
+
+// loadCookies loads cookies from the configuration file
+func (p *CookiePool) loadCookies() {
+	config, err := LoadCookieConfig(p.configPath)
+	if err != nil {
 		return
 	}
 
@@ -208,6 +219,13 @@ func GetCookiePool(configPath string) *CookiePool {
 	return globalPool
 }
 
+// SetCookiePool installs pool as the global cookie pool, so later
+// GetCookiePool calls return it whatever their config path
+func SetCookiePool(pool *CookiePool) {
+	poolOnce.Do(func() {})
+	globalPool = pool
+}
+
 // IsCookieError checks if the error code indicates a cookie-related error
 func IsCookieError(code int) bool {
 	// -101: Not logged in
@@ -84,6 +84,27 @@ func TestCookiePool_LoadCookies(t *testing.T) {
 	}
 }
 
+func TestLoadCookieConfig(t *testing.T) {
+	configPath := createTempConfig(t, `{
+		"cookies": [
+			{"value": "cookie1", "name": "账号1", "enabled": true},
+			{"value": "cookie2", "name": "账号2", "enabled": false}
+		]
+	}`)
+
+	config, err := LoadCookieConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load cookie config: %v", err)
+	}
+	if len(config.Cookies) != 2 {
+		t.Errorf("Expected disabled cookies to be kept, got %d cookies", len(config.Cookies))
+	}
+
+	if _, err := LoadCookieConfig(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected error for missing config")
+	}
+}
+
 func TestCookiePool_RoundRobin(t *testing.T) {
 	config := `{
 		"cookies": [
@@ -0,0 +1,85 @@
+package cookie
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Usage counts the requests made with one cookie since the pool was loaded
+// or its usage was last reset
+type Usage struct {
+	Name         string `json:"name"`
+	Requests     int64  `json:"requests"`
+	Successes    int64  `json:"successes"`
+	Failures     int64  `json:"failures"`
+	CookieErrors int64  `json:"cookie_errors"` // failures with a code that invalidates the cookie
+}
+
+// FailureRate returns the share of requests that failed
+func (u Usage) FailureRate() float64 {
+	if u.Requests == 0 {
+		return 0
+	}
+	return float64(u.Failures) / float64(u.Requests)
+}
+
+// RecordRequest counts a request made with a cookie. code is the API code of
+// a failed response, 0 for a transport or HTTP error. Values not in the pool
+// are ignored.
+func (p *CookiePool) RecordRequest(cookieValue string, ok bool, code int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, cookie := range p.cookies {
+		if cookie.Value != cookieValue {
+			continue
+		}
+		cookie.usage.Requests++
+		if ok {
+			cookie.usage.Successes++
+			return
+		}
+		cookie.usage.Failures++
+		if IsCookieError(code) {
+			cookie.usage.CookieErrors++
+		}
+		return
+	}
+}
+
+// Usage returns the usage of every cookie that made a request, most failures
+// first. Cookies without a name are called cookie1, cookie2... by their
+// position among the enabled cookies.
+func (p *CookiePool) Usage() []Usage {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var usage []Usage
+	for i, cookie := range p.cookies {
+		if cookie.usage.Requests == 0 {
+			continue
+		}
+		u := cookie.usage
+		u.Name = cookie.Name
+		if u.Name == "" {
+			u.Name = fmt.Sprintf("cookie%d", i+1)
+		}
+		usage = append(usage, u)
+	}
+	sort.SliceStable(usage, func(i, j int) bool {
+		if usage[i].Failures != usage[j].Failures {
+			return usage[i].Failures > usage[j].Failures
+		}
+		return usage[i].Requests > usage[j].Requests
+	})
+	return usage
+}
+
+// ResetUsage clears the usage counters of every cookie
+func (p *CookiePool) ResetUsage() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, cookie := range p.cookies {
+		cookie.usage = Usage{}
+	}
+}
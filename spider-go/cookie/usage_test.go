@@ -0,0 +1,40 @@
+package cookie
+
+import "testing"
+
+func TestCookiePool_Usage(t *testing.T) {
+	pool := &CookiePool{cookies: []*CookieItem{
+		{Value: "a", Name: "主号", Enabled: true, IsValid: true},
+		{Value: "b", Enabled: true, IsValid: true},
+		{Value: "c", Enabled: true, IsValid: true},
+	}}
+
+	pool.RecordRequest("a", true, 0)
+	pool.RecordRequest("a", false, -404)
+	pool.RecordRequest("b", true, 0)
+	pool.RecordRequest("b", false, -412)
+	pool.RecordRequest("b", false, 0)
+	pool.RecordRequest("unknown", false, -412)
+
+	usage := pool.Usage()
+	expected := []Usage{
+		{Name: "cookie2", Requests: 3, Successes: 1, Failures: 2, CookieErrors: 1},
+		{Name: "主号", Requests: 2, Successes: 1, Failures: 1},
+	}
+	if len(usage) != len(expected) {
+		t.Fatalf("usage = %+v, expected %+v", usage, expected)
+	}
+	for i := range expected {
+		if usage[i] != expected[i] {
+			t.Errorf("usage[%d] = %+v, expected %+v", i, usage[i], expected[i])
+		}
+	}
+	if rate := usage[0].FailureRate(); rate < 0.66 || rate > 0.67 {
+		t.Errorf("FailureRate = %v, expected 2/3", rate)
+	}
+
+	pool.ResetUsage()
+	if usage := pool.Usage(); len(usage) != 0 {
+		t.Errorf("usage after reset = %+v, expected none", usage)
+	}
+}
@@ -0,0 +1,154 @@
+package crawler
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// articleSearchFields are the article search result fields kept in the
+// claw_article record, which the view info lacks
+var articleSearchFields = []string{"category_name", "desc", "pub_time"}
+
+// searchArticles queues the new articles (专栏) found for a keyword to the
+// article stage
+func (c *BiliCrawler) searchArticles(keyword string) {
+	if !c.config.CrawlArticles {
+		return
+	}
+	c.logf("搜索专栏 (关键词: %s)\n", keyword)
+	c.searchArticlePages(keyword, c.newSession())
+}
+
+// searchArticlePages pages through the article search results of a
+// keyword, up to article_max_pages pages, and queues the new articles
+func (c *BiliCrawler) searchArticlePages(keyword string, session *api.Session) {
+	found, queued := 0, 0
+	for page := 1; ; page++ {
+		if c.isCancelled() {
+			break
+		}
+		result, err := api.SearchArticles(keyword, page, session, c.config.CookieConfigPath)
+		c.recordResult("article", err)
+		if err != nil {
+			c.errorf("关键词 %s 专栏搜索第 %d 页错误: %v\n", keyword, page, err)
+			break
+		}
+
+		for _, article := range result.Articles {
+			found++
+			if c.queueArticle(&ArticleTask{ID: articleID(article), Keyword: keyword, Result: article}) {
+				queued++
+			}
+		}
+
+		if len(result.Articles) == 0 || page >= result.NumPages {
+			break
+		}
+		if maxPages := c.live().ArticleMaxPages; maxPages > 0 && page >= maxPages {
+			break
+		}
+		c.delay()
+	}
+	c.logf("关键词 %s 找到 %d 篇专栏，其中新专栏 %d 篇\n", keyword, found, queued)
+}
+
+// articleID returns the cv number of an article search result
+func articleID(article map[string]interface{}) int64 {
+	id, _ := article["id"].(float64)
+	return int64(id)
+}
+
+// queueArticle hands a searched article to the article stage once per
+// run, skipping articles saved before, and reports whether it was queued
+func (c *BiliCrawler) queueArticle(task *ArticleTask) bool {
+	if task.ID == 0 {
+		return false
+	}
+	key := strconv.FormatInt(task.ID, 10)
+
+	c.mu.Lock()
+	_, seen := c.seenArticles[key]
+	c.seenArticles[key] = struct{}{}
+	_, saved := c.savedArticles[key]
+	c.mu.Unlock()
+	if seen || saved {
+		return false
+	}
+	c.articleQueue <- task
+	return true
+}
+
+// articleRecord builds the claw_article record of an article from its view
+// info and search result
+func articleRecord(task *ArticleTask, info map[string]interface{}) map[string]interface{} {
+	record := make(map[string]interface{}, len(info)+len(articleSearchFields)+2)
+	for k, v := range info {
+		record[k] = v
+	}
+	for _, field := range articleSearchFields {
+		if v, ok := task.Result[field]; ok {
+			record[field] = v
+		}
+	}
+	record["id"] = task.ID
+	record["topic_keyword"] = task.Keyword
+	return record
+}
+
+// crawlArticle fetches the view info of a searched article and saves it
+func (c *BiliCrawler) crawlArticle(task *ArticleTask, session *api.Session) error {
+	if task.ID == 0 {
+		return fmt.Errorf("article search result has no id")
+	}
+
+	info, err := api.GetArticleViewInfo(task.ID, session, c.config.CookieConfigPath)
+	c.recordResult("article", err)
+	if err != nil {
+		return err
+	}
+
+	if err := storage.SaveArticle(articleRecord(task, info)); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.savedArticles[strconv.FormatInt(task.ID, 10)] = struct{}{}
+	c.mu.Unlock()
+	c.stats.incArticlesSaved()
+	return nil
+}
+
+// articleWorker fetches the view info of articles from the article queue
+func (c *BiliCrawler) articleWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
+	defer wg.Done()
+
+	for {
+		if !c.waitTurn("article", threadID, done) {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case task, ok := <-c.articleQueue:
+			if !ok {
+				return
+			}
+			if c.isCancelled() {
+				continue
+			}
+
+			c.recoverTask("article", threadID, nil, func() {
+				if err := c.crawlArticle(task, session); err != nil {
+					c.errorf("[专栏线程%d] 获取专栏 cv%d 失败: %v\n", threadID, task.ID, err)
+				} else {
+					c.debugf("[专栏线程%d] 专栏 cv%d 已保存\n", threadID, task.ID)
+				}
+				c.delay()
+			})
+		}
+	}
+}
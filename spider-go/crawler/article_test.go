@@ -0,0 +1,88 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestArticleRecord_SchemaFields(t *testing.T) {
+	task := &ArticleTask{ID: 3, Keyword: "测试", Result: map[string]interface{}{
+		"id": float64(3), "category_name": "游戏", "desc": "摘要", "pub_time": float64(1700000000),
+	}}
+	record := articleRecord(task, map[string]interface{}{"title": "攻略", "mid": float64(7)})
+	for _, field := range storage.SchemaFields["article"] {
+		if _, ok := record[field]; !ok {
+			t.Errorf("article record lacks schema field %q", field)
+		}
+	}
+	if record["id"] != int64(3) || record["title"] != "攻略" || record["topic_keyword"] != "测试" {
+		t.Errorf("record = %v", record)
+	}
+}
+
+func TestBiliCrawler_SearchAndCrawlArticles(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/x/web-interface/search/type":
+			pn := r.URL.Query().Get("page")
+			pages = append(pages, pn)
+			// Article 1 is on every page
+			fmt.Fprintf(w, `{"code":0,"data":{"numPages":5,"result":[{"id":1,"mid":7},{"id":1%s,"mid":7}]}}`, pn)
+		case "/x/article/viewinfo":
+			fmt.Fprintf(w, `{"code":0,"data":{"title":"cv%s","mid":7,"stats":{"view":1}}}`, r.URL.Query().Get("id"))
+		}
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+	var keys []string
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	t.Cleanup(func() { storage.SetSink(nil) })
+
+	c := newReloadCrawler()
+	c.config.CrawlArticles = true
+	c.config.ArticleMaxPages = 2
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.articleQueue = make(chan *ArticleTask, 10)
+	c.seenArticles = make(map[string]struct{})
+	c.savedArticles = map[string]struct{}{"12": {}}
+
+	c.searchArticlePages("测试", nil)
+	if !reflect.DeepEqual(pages, []string{"1", "2"}) {
+		t.Errorf("fetched pages %v, expected [1 2]", pages)
+	}
+	// cv1 is queued once and cv12 was saved before
+	if len(c.articleQueue) != 2 {
+		t.Fatalf("queued %d articles, expected 2", len(c.articleQueue))
+	}
+
+	close(c.articleQueue)
+	for task := range c.articleQueue {
+		if err := c.crawlArticle(task, nil); err != nil {
+			t.Fatalf("crawlArticle failed: %v", err)
+		}
+	}
+	if !reflect.DeepEqual(keys, []string{"1", "11"}) {
+		t.Errorf("published keys = %v, expected [1 11]", keys)
+	}
+	if c.stats.ArticlesSaved != 2 {
+		t.Errorf("ArticlesSaved = %d, expected 2", c.stats.ArticlesSaved)
+	}
+}
@@ -0,0 +1,181 @@
+package crawler
+
+import (
+	"math"
+	"time"
+
+	"spider-go/ratelimit"
+)
+
+// AutoTuneConfig configures the controller that adjusts the worker counts of
+// the queue-fed stages and the request delays while crawling
+type AutoTuneConfig struct {
+	Enabled         bool    `json:"enabled"`
+	IntervalSeconds int     `json:"interval_seconds"` // how often to adjust
+	MinThreads      int     `json:"min_threads"`      // lower bound per stage
+	MaxThreads      int     `json:"max_threads"`      // upper bound per stage; this many workers are started
+	QueueHighWater  float64 `json:"queue_high_water"` // queue fill ratio that adds a worker
+	ErrorThreshold  float64 `json:"error_threshold"`  // share of requests failing with risk-control codes that backs off
+	MaxDelayScale   float64 `json:"max_delay_scale"`  // upper bound of the delay multiplier
+}
+
+// autoTuneStages are the stages whose worker counts the controller adjusts;
+// their workers run for the whole crawl and read from a single queue
+var autoTuneStages = []string{"comment", "reply", "account", "dynamic", "relation"}
+
+// riskControlCodes are the API codes that make the controller back off
+var riskControlCodes = []string{"-352", "-412"}
+
+// workerSlots returns how many workers to start for a stage: its worker
+// count, or auto_tune.max_threads if that is higher and the stage is tuned
+func (c *BiliCrawler) workerSlots(stage string) int {
+	n := c.threads(stage)
+	cfg := c.live().AutoTune
+	if !cfg.Enabled {
+		return n
+	}
+	for _, s := range autoTuneStages {
+		if s == stage {
+			return max(n, cfg.MaxThreads)
+		}
+	}
+	return n
+}
+
+// stageQueue returns the length and capacity of a tuned stage's input queue
+func (c *BiliCrawler) stageQueue(stage string) (int, int) {
+	switch stage {
+	case "comment":
+		return len(c.videoQueue), cap(c.videoQueue)
+	case "reply":
+		return len(c.commentQueue), cap(c.commentQueue)
+	case "account":
+		return len(c.userMidQueue), cap(c.userMidQueue)
+	case "dynamic":
+		return len(c.dynamicQueue), cap(c.dynamicQueue)
+	case "relation":
+		return len(c.relationQueue), cap(c.relationQueue)
+	}
+	return 0, 0
+}
+
+// tuneThreads returns a stage's next worker count: one fewer when backing
+// off, one more when its queue is filling up, within the configured bounds
+func tuneThreads(current int, fill float64, backoff bool, cfg AutoTuneConfig) int {
+	switch {
+	case backoff:
+		current--
+	case fill >= cfg.QueueHighWater:
+		current++
+	}
+	return min(max(current, cfg.MinThreads), cfg.MaxThreads)
+}
+
+// tuneDelayScale returns the next delay multiplier: 1.5 times longer when
+// backing off, otherwise recovering towards 1
+func tuneDelayScale(scale float64, backoff bool, cfg AutoTuneConfig) float64 {
+	if backoff {
+		return math.Min(scale*1.5, math.Max(cfg.MaxDelayScale, 1))
+	}
+	return math.Max(scale/1.25, 1)
+}
+
+// delayScale returns the multiplier auto-tuning applies to request delays
+func (c *BiliCrawler) delayScale() float64 {
+	c.configMu.RLock()
+	defer c.configMu.RUnlock()
+	if c.tunedDelayScale < 1 {
+		return 1
+	}
+	return c.tunedDelayScale
+}
+
+// riskErrors returns how many requests failed with a risk-control code
+func (c *BiliCrawler) riskErrors() int {
+	_, errors := c.stats.breakdown()
+	total := 0
+	for _, codes := range errors {
+		for _, code := range riskControlCodes {
+			total += codes[code]
+		}
+	}
+	return total
+}
+
+// autoTune adjusts worker counts and the delay scale once, given the share
+// of requests since the last adjustment that failed with risk-control codes
+func (c *BiliCrawler) autoTune(errorRate float64) {
+	cfg := c.live().AutoTune
+	backoff := errorRate >= cfg.ErrorThreshold
+
+	fills := make(map[string]float64, len(autoTuneStages))
+	for _, stage := range autoTuneStages {
+		if n, capacity := c.stageQueue(stage); capacity > 0 {
+			fills[stage] = float64(n) / float64(capacity)
+		}
+	}
+
+	c.configMu.Lock()
+	if c.tunedThreads == nil {
+		c.tunedThreads = make(map[string]int)
+	}
+	changed := make(map[string]int)
+	for _, stage := range autoTuneStages {
+		current, ok := c.tunedThreads[stage]
+		if !ok {
+			current = c.config.NThreads
+			if n := c.config.StageThreads[stage]; n > 0 {
+				current = n
+			}
+		}
+		next := tuneThreads(current, fills[stage], backoff, cfg)
+		if next != current || !ok {
+			c.tunedThreads[stage] = next
+		}
+		if next != current {
+			changed[stage] = next
+		}
+	}
+	prevScale := math.Max(c.tunedDelayScale, 1)
+	c.tunedDelayScale = tuneDelayScale(prevScale, backoff, cfg)
+	scale := c.tunedDelayScale
+	c.configMu.Unlock()
+
+	if backoff {
+		c.errorf("[自动调优] 风控错误率 %.1f%%，降低并发，请求间隔 ×%.2f\n", errorRate*100, scale)
+	} else if scale != prevScale {
+		c.logf("[自动调优] 请求间隔 ×%.2f\n", scale)
+	}
+	for _, stage := range autoTuneStages {
+		if n, ok := changed[stage]; ok {
+			c.logf("[自动调优] %s 阶段线程数调整为 %d\n", stage, n)
+		}
+	}
+}
+
+// watchAutoTune runs the auto-tuning controller until stop is closed
+func (c *BiliCrawler) watchAutoTune(stop <-chan struct{}) {
+	cfg := c.live().AutoTune
+	if !cfg.Enabled {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(cfg.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	lastRequests, lastErrors := ratelimit.Requests(), c.riskErrors()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		requests, errors := ratelimit.Requests(), c.riskErrors()
+		rate := 0.0
+		if requests > lastRequests {
+			rate = float64(errors-lastErrors) / float64(requests-lastRequests)
+		}
+		lastRequests, lastErrors = requests, errors
+		c.autoTune(rate)
+	}
+}
@@ -0,0 +1,83 @@
+package crawler
+
+import "testing"
+
+func TestTuneThreads(t *testing.T) {
+	cfg := DefaultConfig().AutoTune
+	cfg.MinThreads, cfg.MaxThreads = 1, 4
+
+	tests := []struct {
+		current int
+		fill    float64
+		backoff bool
+		want    int
+	}{
+		{2, 0.6, false, 3},
+		{2, 0.1, false, 2},
+		{4, 1, false, 4},
+		{2, 0.9, true, 1},
+		{1, 0, true, 1},
+		{6, 0, false, 4},
+	}
+	for _, tt := range tests {
+		if got := tuneThreads(tt.current, tt.fill, tt.backoff, cfg); got != tt.want {
+			t.Errorf("tuneThreads(%d, %g, %v) = %d, expected %d", tt.current, tt.fill, tt.backoff, got, tt.want)
+		}
+	}
+}
+
+func TestTuneDelayScale(t *testing.T) {
+	cfg := DefaultConfig().AutoTune
+	cfg.MaxDelayScale = 2
+
+	if got := tuneDelayScale(1, true, cfg); got != 1.5 {
+		t.Errorf("backing off from 1 = %g, expected 1.5", got)
+	}
+	if got := tuneDelayScale(1.5, true, cfg); got != 2 {
+		t.Errorf("backing off from 1.5 = %g, expected the cap 2", got)
+	}
+	if got := tuneDelayScale(1.1, false, cfg); got != 1 {
+		t.Errorf("recovering from 1.1 = %g, expected 1", got)
+	}
+}
+
+func TestAutoTune(t *testing.T) {
+	c := newReloadCrawler()
+	c.config.NThreads = 2
+	c.config.AutoTune.Enabled = true
+	c.config.AutoTune.MaxThreads = 4
+	c.videoQueue = make(chan *VideoTask, 4)
+	c.commentQueue = make(chan *CommentTask, 4)
+	c.userMidQueue = make(chan string, 4)
+	c.dynamicQueue = make(chan string, 4)
+	c.relationQueue = make(chan string, 4)
+	for i := 0; i < 3; i++ {
+		c.commentQueue <- &CommentTask{}
+	}
+
+	if got := c.workerSlots("reply"); got != 4 {
+		t.Errorf("workerSlots(reply) = %d, expected max_threads", got)
+	}
+	if got := c.workerSlots("search"); got != 2 {
+		t.Errorf("workerSlots(search) = %d, search is not tuned", got)
+	}
+
+	c.autoTune(0)
+	if got := c.threads("reply"); got != 3 {
+		t.Errorf("reply threads = %d, expected 3 with its queue backed up", got)
+	}
+	if got := c.threads("comment"); got != 2 {
+		t.Errorf("comment threads = %d, expected 2 with an empty queue", got)
+	}
+
+	c.autoTune(0.5)
+	if got := c.threads("reply"); got != 2 {
+		t.Errorf("reply threads = %d, expected 2 after backing off", got)
+	}
+	if got := c.threads("comment"); got != 1 {
+		t.Errorf("comment threads = %d, expected 1 after backing off", got)
+	}
+	if got := c.delayScale(); got != 1.5 {
+		t.Errorf("delayScale = %g, expected 1.5 after backing off", got)
+	}
+}
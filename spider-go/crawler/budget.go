@@ -0,0 +1,193 @@
+package crawler
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"spider-go/ratelimit"
+)
+
+// runBudgetCheckInterval is how often max_runtime and max_requests are checked
+var runBudgetCheckInterval = 200 * time.Millisecond
+
+// videoBudget limits how long one comment worker stays on a single video
+type videoBudget struct {
+	maxPages int
+	deadline time.Time
+}
+
+// newVideoBudget starts a budget for one pass over a video's comments. Zero
+// limits are unlimited.
+func newVideoBudget(maxPages, maxSeconds int, now time.Time) videoBudget {
+	b := videoBudget{maxPages: maxPages}
+	if maxSeconds > 0 {
+		b.deadline = now.Add(time.Duration(maxSeconds) * time.Second)
+	}
+	return b
+}
+
+// exceeded reports whether the budget is used up after pages comment pages
+func (b videoBudget) exceeded(pages int, now time.Time) bool {
+	if b.maxPages > 0 && pages >= b.maxPages {
+		return true
+	}
+	return !b.deadline.IsZero() && !now.Before(b.deadline)
+}
+
+// deferVideo parks a video whose budget ran out so it is revisited from
+// cursor once the first comment pass finishes
+func (c *BiliCrawler) deferVideo(task *VideoTask, cursor string) {
+	c.mu.Lock()
+	c.deferredVideos = append(c.deferredVideos, task.resumeAt(cursor))
+	c.mu.Unlock()
+	c.stats.incVideosDeferred()
+}
+
+// takeDeferredVideos returns and clears the deferred videos
+func (c *BiliCrawler) takeDeferredVideos() []*VideoTask {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tasks := c.deferredVideos
+	c.deferredVideos = nil
+	return tasks
+}
+
+// revisitDeferred runs further comment passes over deferred videos, each with
+// a fresh budget, until none are left
+func (c *BiliCrawler) revisitDeferred(done <-chan struct{}) {
+	for round := 1; ; round++ {
+		tasks := c.takeDeferredVideos()
+		if len(tasks) == 0 {
+			return
+		}
+		c.logf("第 %d 轮续爬: %d 个视频超出单视频预算，从游标继续\n", round, len(tasks))
+
+		queue := make(chan *VideoTask, len(tasks))
+		for _, task := range tasks {
+			queue <- task
+		}
+		close(queue)
+
+		var wg sync.WaitGroup
+		for i := 0; i < c.threads("comment"); i++ {
+			wg.Add(1)
+			session := c.newSession()
+			go c.commentWorker(i, queue, &wg, done, session)
+		}
+		wg.Wait()
+	}
+}
+
+// runBudget limits the run time and request count of a whole crawl
+type runBudget struct {
+	deadline    time.Time
+	maxRequests int64
+	baseline    int64 // request count when the crawl started
+}
+
+// newRunBudget starts a crawl budget from the config. Invalid or empty limits
+// are unlimited; Validate reports them.
+func newRunBudget(cfg Config, now time.Time, requests int64) runBudget {
+	b := runBudget{maxRequests: cfg.MaxRequests, baseline: requests}
+	if d, err := time.ParseDuration(cfg.MaxRuntime); err == nil && d > 0 {
+		b.deadline = now.Add(d)
+	}
+	return b
+}
+
+// exhausted returns why the budget is used up, or "" while it is not
+func (b runBudget) exhausted(now time.Time, requests int64) string {
+	if b.maxRequests > 0 && requests-b.baseline >= b.maxRequests {
+		return fmt.Sprintf("已达到请求数上限 %d", b.maxRequests)
+	}
+	if !b.deadline.IsZero() && !now.Before(b.deadline) {
+		return fmt.Sprintf("已达到运行时长上限 %s", b.deadline.Format("15:04:05"))
+	}
+	return ""
+}
+
+// watchRunBudget stops the crawl with ExitBudgetExhausted once max_runtime
+// or max_requests is used up, until stop is closed. This is a planned stop:
+// the stages drain and the run is checkpointed and reported like any other.
+func (c *BiliCrawler) watchRunBudget(stop <-chan struct{}) {
+	budget := newRunBudget(c.config, time.Now(), ratelimit.Requests())
+	if budget.deadline.IsZero() && budget.maxRequests == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(runBudgetCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if reason := budget.exhausted(time.Now(), ratelimit.Requests()); reason != "" {
+				if c.stopWith(reason, ExitBudgetExhausted) {
+					c.summaryf("运行预算用尽，停止爬取: %s\n", reason)
+				}
+				return
+			}
+		}
+	}
+}
+
+// drainLimit bounds the account stage once the stages feeding it are done,
+// so that a long queue of users does not keep the run going for days
+type drainLimit struct {
+	deadline    time.Time
+	maxAccounts int64
+
+	taken   atomic.Int64 // users taken from the queue since the drain began
+	reached atomic.Bool
+}
+
+// newDrainLimit starts a drain limit from the config, or returns nil when
+// the drain is unlimited. Invalid limits are unlimited; Validate reports them.
+func newDrainLimit(cfg Config, now time.Time) *drainLimit {
+	l := &drainLimit{maxAccounts: cfg.DrainMaxAccounts}
+	if d, err := time.ParseDuration(cfg.DrainMaxTime); err == nil && d > 0 {
+		l.deadline = now.Add(d)
+	}
+	if l.deadline.IsZero() && l.maxAccounts == 0 {
+		return nil
+	}
+	return l
+}
+
+// take reports whether another user may be fetched, and whether this call
+// is the one that reached the limit
+func (l *drainLimit) take(now time.Time) (ok, first bool) {
+	if l.reached.Load() {
+		return false, false
+	}
+	over := l.maxAccounts > 0 && l.taken.Add(1) > l.maxAccounts
+	over = over || (!l.deadline.IsZero() && !now.Before(l.deadline))
+	if !over {
+		return true, false
+	}
+	return false, l.reached.CompareAndSwap(false, true)
+}
+
+// drainAllowed reports whether the account stage may fetch another user.
+// Past the drain limit the rest of the queue is skipped; those users stay
+// unsaved and are written to pending_mids when the run ends.
+func (c *BiliCrawler) drainAllowed() bool {
+	l := c.drain.Load()
+	if l == nil {
+		return true
+	}
+	ok, first := l.take(time.Now())
+	if first {
+		c.logf("用户信息收尾达到上限，跳过队列中剩余的用户，下次运行从 pending_mids 继续\n")
+	}
+	return ok
+}
+
+// drainReached reports whether the drain limit cut the account stage short
+func (c *BiliCrawler) drainReached() bool {
+	l := c.drain.Load()
+	return l != nil && l.reached.Load()
+}
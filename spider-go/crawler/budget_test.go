@@ -0,0 +1,150 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVideoBudget(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	unlimited := newVideoBudget(0, 0, now)
+	if unlimited.exceeded(100000, now.Add(24*time.Hour)) {
+		t.Error("Zero budget should be unlimited")
+	}
+
+	pages := newVideoBudget(5, 0, now)
+	if pages.exceeded(4, now) {
+		t.Error("Budget should not be exceeded before max pages")
+	}
+	if !pages.exceeded(5, now) {
+		t.Error("Budget should be exceeded at max pages")
+	}
+
+	timed := newVideoBudget(0, 60, now)
+	if timed.exceeded(1, now.Add(59*time.Second)) {
+		t.Error("Budget should not be exceeded before the deadline")
+	}
+	if !timed.exceeded(1, now.Add(60*time.Second)) {
+		t.Error("Budget should be exceeded at the deadline")
+	}
+}
+
+func TestBiliCrawler_DeferredVideos(t *testing.T) {
+	c := &BiliCrawler{}
+
+	c.deferVideo(&VideoTask{Bvid: "BV1"}, "cursor1")
+	c.deferVideo(&VideoTask{Bvid: "BV2", Cursor: "old"}, "cursor2")
+
+	if c.stats.VideosDeferred != 2 {
+		t.Errorf("VideosDeferred = %d, expected 2", c.stats.VideosDeferred)
+	}
+
+	tasks := c.takeDeferredVideos()
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 deferred videos, got %d", len(tasks))
+	}
+	if tasks[0].Cursor != "cursor1" || tasks[1].Cursor != "cursor2" {
+		t.Error("Deferred videos should carry the checkpointed cursor")
+	}
+	if tasks[1].Bvid != "BV2" {
+		t.Error("Deferred videos should keep their IDs")
+	}
+	if len(c.takeDeferredVideos()) != 0 {
+		t.Error("takeDeferredVideos should clear the list")
+	}
+}
+
+func TestRunBudget(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	cfg := DefaultConfig()
+	if b := newRunBudget(cfg, now, 0); b.exhausted(now.Add(24*time.Hour), 1<<40) != "" {
+		t.Error("Default config should have no run budget")
+	}
+
+	cfg.MaxRuntime = "1h"
+	cfg.MaxRequests = 100
+	b := newRunBudget(cfg, now, 50)
+	if reason := b.exhausted(now.Add(30*time.Minute), 149); reason != "" {
+		t.Errorf("Budget should not be exhausted yet: %s", reason)
+	}
+	if b.exhausted(now.Add(30*time.Minute), 150) == "" {
+		t.Error("Budget should be exhausted after max_requests since the start")
+	}
+	if b.exhausted(now.Add(time.Hour), 60) == "" {
+		t.Error("Budget should be exhausted after max_runtime")
+	}
+}
+
+func TestBiliCrawler_WatchRunBudget(t *testing.T) {
+	c := newReloadCrawler()
+	c.cancelled = make(chan struct{})
+	c.config.MaxRuntime = "10ms"
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.watchRunBudget(stop)
+
+	select {
+	case <-c.cancelled:
+		if aborted := c.abortedWith(); aborted == nil || aborted.code != ExitBudgetExhausted {
+			t.Errorf("aborted = %+v, expected exit code %d", aborted, ExitBudgetExhausted)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Crawl was not stopped after max_runtime")
+	}
+}
+
+func TestDrainLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	cfg := DefaultConfig()
+	if l := newDrainLimit(cfg, now); l != nil {
+		t.Error("Default config should have no drain limit")
+	}
+
+	cfg.DrainMaxAccounts = 2
+	l := newDrainLimit(cfg, now)
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.take(now); !ok {
+			t.Fatalf("take %d refused within drain_max_accounts", i+1)
+		}
+	}
+	if ok, first := l.take(now); ok || !first {
+		t.Errorf("take past the limit = %v, %v; want refused and first", ok, first)
+	}
+	if ok, first := l.take(now); ok || first {
+		t.Errorf("take after the limit = %v, %v; want refused, not first", ok, first)
+	}
+
+	cfg = DefaultConfig()
+	cfg.DrainMaxTime = "1h"
+	l = newDrainLimit(cfg, now)
+	if ok, _ := l.take(now.Add(59 * time.Minute)); !ok {
+		t.Error("take refused before drain_max_time")
+	}
+	if ok, _ := l.take(now.Add(time.Hour)); ok {
+		t.Error("take allowed after drain_max_time")
+	}
+}
+
+func TestBiliCrawler_DrainAllowed(t *testing.T) {
+	c := newReloadCrawler()
+	if !c.drainAllowed() || c.drainReached() {
+		t.Fatal("Drain should be unlimited before the account stage drains")
+	}
+
+	cfg := DefaultConfig()
+	cfg.DrainMaxAccounts = 1
+	c.drain.Store(newDrainLimit(cfg, time.Now()))
+	if !c.drainAllowed() {
+		t.Error("First user should be fetched")
+	}
+	if c.drainAllowed() || c.drainAllowed() {
+		t.Error("Users past drain_max_accounts should be skipped")
+	}
+	if !c.drainReached() {
+		t.Error("drainReached should report the limit")
+	}
+}
@@ -0,0 +1,44 @@
+package crawler
+
+import (
+	"errors"
+
+	"spider-go/ratelimit"
+)
+
+// errCancelled is the error of a task cut short by Cancel. Reply tasks
+// failing with it are recorded in failed_tasks.json and continued by the
+// next run with resume.
+var errCancelled = errors.New("crawl cancelled")
+
+// Cancel ends the running crawl early. No further keywords, search pages or
+// comment or reply pages are started, queued tasks are dropped and the
+// stages drain in their usual order, so comment cursors, pending MIDs and
+// unfinished reply tasks are kept for a resumed run. Pauses for the operator, quiet hours or the error circuit are
+// lifted, since a paused worker could not drain. It is safe to call more
+// than once.
+func (c *BiliCrawler) Cancel() {
+	c.cancelOnce.Do(func() {
+		close(c.cancelled)
+		ratelimit.ResumeAll()
+	})
+}
+
+// isCancelled reports whether Cancel was called
+func (c *BiliCrawler) isCancelled() bool {
+	select {
+	case <-c.cancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// pauseFor pauses requests for reason unless the crawl is cancelled. Cancel
+// lifts the pauses taken before it; one taken after is lifted here.
+func (c *BiliCrawler) pauseFor(reason string) {
+	ratelimit.PauseFor(reason)
+	if c.isCancelled() {
+		ratelimit.ResumeFor(reason)
+	}
+}
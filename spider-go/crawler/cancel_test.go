@@ -0,0 +1,219 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"spider-go/api"
+	"spider-go/cookie"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestCancel(t *testing.T) {
+	c := newReloadCrawler()
+	c.cancelled = make(chan struct{})
+	c.keywords = []string{"测试", "其他"}
+
+	if c.isCancelled() {
+		t.Fatal("new crawler should not be cancelled")
+	}
+	c.Cancel()
+	c.Cancel()
+	if !c.isCancelled() {
+		t.Fatal("crawler should be cancelled")
+	}
+	if keyword, ok := c.nextKeyword(); ok {
+		t.Errorf("nextKeyword = %q after Cancel, expected none", keyword)
+	}
+	if err := c.AddKeyword("新的"); err == nil {
+		t.Error("AddKeyword should fail once the cancelled search has stopped")
+	}
+}
+
+func TestCancel_DrainsQueue(t *testing.T) {
+	c := newReloadCrawler()
+	c.cancelled = make(chan struct{})
+	c.recentErrors = newLogBuffer(10)
+	c.config.DownloadMedia = true
+	c.config.MediaDir = t.TempDir()
+	c.mediaQueue = make(chan mediaTask, 2)
+	c.mediaQueue <- mediaTask{Kind: MediaCover, URL: "http://127.0.0.1:1/a.jpg"}
+	c.mediaQueue <- mediaTask{Kind: MediaCover, URL: "http://127.0.0.1:1/b.jpg"}
+	close(c.mediaQueue)
+	c.Cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	c.mediaWorker(0, &wg, make(chan struct{}))
+
+	if len(c.mediaQueue) != 0 {
+		t.Errorf("%d tasks left in the queue", len(c.mediaQueue))
+	}
+	if errs := c.recentErrors.Lines(); len(errs) > 0 {
+		t.Errorf("cancelled tasks should be dropped without downloading, got errors %v", errs)
+	}
+}
+
+func TestCancel_LiftsPauses(t *testing.T) {
+	defer ratelimit.ResumeAll()
+	ratelimit.InitRateLimiter(1000, 1000)
+	c := newReloadCrawler()
+	c.cancelled = make(chan struct{})
+	c.Pause()
+	ratelimit.PauseFor(ratelimit.PauseQuiet)
+
+	waited := make(chan struct{})
+	go func() {
+		ratelimit.WaitForToken()
+		close(waited)
+	}()
+	c.Cancel()
+	select {
+	case <-waited:
+	case <-time.After(2 * time.Second):
+		t.Fatal("worker waiting on a paused crawl was not released by Cancel")
+	}
+
+	// A pause taken while draining must not hold the drain up either
+	c.pauseFor(ratelimit.PauseCircuit)
+	if ratelimit.IsPaused() {
+		t.Error("pause taken after Cancel was kept")
+	}
+}
+
+func TestBiliCrawler_CancelDrainsAndReports(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0,"data":{}}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+
+	dir := t.TempDir()
+	storage.SetRecordDir(dir)
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+	var summaries int
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		if strings.Contains(string(value), `"type":"summary"`) {
+			summaries++
+		}
+		return nil
+	}))
+	t.Cleanup(func() { storage.SetSink(nil) })
+	t.Cleanup(func() { storage.CloseSentIDs() })
+
+	config := DefaultConfig()
+	config.Keyword = "测试"
+	config.DelayMin, config.DelayMax = 0, 0
+	config.RateLimitRate, config.RateLimitCapacity = 1000, 1000
+	config.CookieConfigPath = filepath.Join(dir, "cookies.json")
+	config.ReportPath = filepath.Join(dir, "report.json")
+	config.KafkaOutput = false
+	config.RunStats = true
+	previous := cookie.GetCookiePool(config.CookieConfigPath)
+	cookie.SetCookiePool(cookie.NewCookiePool(config.CookieConfigPath))
+	t.Cleanup(func() { cookie.SetCookiePool(previous) })
+
+	c, err := NewBiliCrawler(config)
+	if err != nil {
+		t.Fatalf("NewBiliCrawler: %v", err)
+	}
+	c.SetLogOutput(io.Discard)
+	c.Cancel()
+	c.CrawlVideos([]string{"BV1"})
+
+	if code := c.ExitCode(); code != ExitCancelled {
+		t.Errorf("ExitCode = %d, expected %d", code, ExitCancelled)
+	}
+	if !c.Snapshot().Finished {
+		t.Error("Cancelled run should be marked finished")
+	}
+	data, err := os.ReadFile(config.ReportPath)
+	if err != nil {
+		t.Fatalf("Cancelled run should still write its report: %v", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil || report.Outcome != OutcomeCancelled {
+		t.Errorf("report = %+v, %v; expected outcome %q", report, err, OutcomeCancelled)
+	}
+	if summaries != 1 {
+		t.Errorf("published %d run summaries, expected 1", summaries)
+	}
+}
+
+func TestBiliCrawler_CommentLoopsStopOnCancel(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/x/v2/reply/wbi/main" {
+			w.Write([]byte(`{"code":0,"data":{"wbi_img":{"img_url":"https://i0.hdslb.com/bfs/wbi/a.png","sub_url":"https://i0.hdslb.com/bfs/wbi/b.png"}}}`))
+			return
+		}
+		mu.Lock()
+		requests++
+		page := requests
+		mu.Unlock()
+		// Five pages of fresh comments
+		fmt.Fprintf(w, `{"code":0,"data":{"replies":[{"rpid":%d,"mid":1,"ctime":1,"rcount":0,"content":{"message":"hi"},"member":{}}],`+
+			`"cursor":{"is_end":%t,"pagination_reply":{"next_offset":"p%d"}}}}`, 5000+page, page >= 5, page+1)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+
+	ctx := commentContext{Bvid: "BV1", Aid: 1, Title: "视频"}
+	loops := map[string]func(c *BiliCrawler){
+		"hot": func(c *BiliCrawler) {
+			c.config.HotCommentPages = 5
+			c.crawlHotComments(0, ctx, nil)
+		},
+		"new": func(c *BiliCrawler) {
+			c.crawlNewComments(0, ctx, nil)
+		},
+		"reconcile": func(c *BiliCrawler) {
+			c.config.CommentReconcilePages = 5
+			c.config.CommentReconcileThreshold = 0.1
+			c.reconcileComments(0, ctx, map[string]interface{}{"stat": map[string]interface{}{"reply": float64(100)}}, 0, nil)
+		},
+		"dynamic": func(c *BiliCrawler) {
+			c.config.DynamicCommentPages = 0
+			c.crawlDynamicComments(0, map[string]interface{}{"id_str": "900"}, nil)
+		},
+	}
+	for name, loop := range loops {
+		c := newReloadCrawler()
+		c.cancelled = make(chan struct{})
+		c.config.DelayMin, c.config.DelayMax = 0, 0
+		c.savedRpids = newDedupSet(0, "")
+		c.savedMids = newDedupSet(0, "")
+		c.userMids = make(map[string]storage.MidSource)
+		// The crawl is cancelled while the first page is saved
+		storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+			c.Cancel()
+			return nil
+		}))
+		requests = 0
+
+		loop(c)
+		if requests != 1 {
+			t.Errorf("%s: %d comment pages fetched, expected none after the cancel", name, requests)
+		}
+	}
+	storage.SetSink(nil)
+}
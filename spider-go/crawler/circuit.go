@@ -0,0 +1,263 @@
+package crawler
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+)
+
+// Exit codes used when the crawl is aborted
+const (
+	ExitAbortedRiskControl = 3
+	ExitBudgetExhausted    = 4
+	ExitStalled            = 6
+)
+
+// ErrorCircuitConfig configures the crawl-wide error-rate circuit
+type ErrorCircuitConfig struct {
+	Enabled         bool    `json:"enabled"`
+	Window          int     `json:"window"`      // outcomes remembered per stage
+	MinSamples      int     `json:"min_samples"` // outcomes needed before the circuit can trip
+	Threshold       float64 `json:"threshold"`   // failure ratio that trips the circuit
+	Codes           []int   `json:"codes"`       // API codes counted as failures; empty counts every error
+	Action          string  `json:"action"`      // "pause" or "abort"
+	CooldownSeconds int     `json:"cooldown_seconds"`
+
+	// Each consecutive trip multiplies the cool-down by CooldownMultiplier,
+	// up to MaxCooldownSeconds. The streak resets once the crawl has run
+	// CooldownResetSeconds without tripping.
+	CooldownMultiplier   float64 `json:"cooldown_multiplier"`
+	MaxCooldownSeconds   int     `json:"max_cooldown_seconds"`
+	CooldownResetSeconds int     `json:"cooldown_reset_seconds"`
+
+	// Switch every worker session to a new cookie before resuming
+	RotateSessions bool `json:"rotate_sessions"`
+}
+
+// stageWindow is a ring buffer of the most recent request outcomes of a stage
+type stageWindow struct {
+	failed   []bool
+	next     int
+	count    int
+	failures int
+}
+
+func (w *stageWindow) add(failed bool) {
+	if w.count == len(w.failed) {
+		if w.failed[w.next] {
+			w.failures--
+		}
+	} else {
+		w.count++
+	}
+	w.failed[w.next] = failed
+	if failed {
+		w.failures++
+	}
+	w.next = (w.next + 1) % len(w.failed)
+}
+
+func (w *stageWindow) rate() float64 {
+	if w.count == 0 {
+		return 0
+	}
+	return float64(w.failures) / float64(w.count)
+}
+
+// errorCircuit tracks rolling error rates per stage
+type errorCircuit struct {
+	config  ErrorCircuitConfig
+	codes   map[int]struct{}
+	windows map[string]*stageWindow
+	tripped bool
+	streak  int       // consecutive trips
+	resumed time.Time // end of the last cool-down
+	mu      sync.Mutex
+}
+
+func newErrorCircuit(config ErrorCircuitConfig) *errorCircuit {
+	if !config.Enabled {
+		return nil
+	}
+	if config.Window <= 0 {
+		config.Window = 50
+	}
+	if config.MinSamples <= 0 || config.MinSamples > config.Window {
+		config.MinSamples = config.Window
+	}
+
+	codes := make(map[int]struct{})
+	for _, code := range config.Codes {
+		codes[code] = struct{}{}
+	}
+
+	return &errorCircuit{
+		config:  config,
+		codes:   codes,
+		windows: make(map[string]*stageWindow),
+	}
+}
+
+// isFailure reports whether err counts against the error rate
+func (ec *errorCircuit) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if len(ec.codes) == 0 {
+		return true
+	}
+	_, counted := ec.codes[api.ErrorCode(err)]
+	return counted
+}
+
+// record adds an outcome for the stage. It returns the stage's failure rate
+// and true if this outcome tripped the circuit.
+func (ec *errorCircuit) record(stage string, err error) (float64, bool) {
+	if ec == nil {
+		return 0, false
+	}
+
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	w, ok := ec.windows[stage]
+	if !ok {
+		w = &stageWindow{failed: make([]bool, ec.config.Window)}
+		ec.windows[stage] = w
+	}
+	w.add(ec.isFailure(err))
+
+	if ec.tripped || w.count < ec.config.MinSamples || w.rate() < ec.config.Threshold {
+		return w.rate(), false
+	}
+	ec.tripped = true
+	return w.rate(), true
+}
+
+// isTripped reports whether the circuit is currently tripped
+func (ec *errorCircuit) isTripped() bool {
+	if ec == nil {
+		return false
+	}
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	return ec.tripped
+}
+
+// nextCooldown returns the cool-down for a trip at now, lengthening it
+// exponentially for consecutive trips
+func (ec *errorCircuit) nextCooldown(now time.Time) time.Duration {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+
+	resetAfter := time.Duration(ec.config.CooldownResetSeconds) * time.Second
+	if resetAfter > 0 && !ec.resumed.IsZero() && now.Sub(ec.resumed) > resetAfter {
+		ec.streak = 0
+	}
+
+	multiplier := max(ec.config.CooldownMultiplier, 1)
+	seconds := float64(ec.config.CooldownSeconds) * math.Pow(multiplier, float64(ec.streak))
+	if limit := float64(ec.config.MaxCooldownSeconds); limit > 0 && seconds > limit {
+		seconds = limit
+	}
+	ec.streak++
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// reset clears all windows and re-arms the circuit
+func (ec *errorCircuit) reset() {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	ec.windows = make(map[string]*stageWindow)
+	ec.tripped = false
+	ec.resumed = time.Now()
+}
+
+// recordResult feeds a request outcome into the error circuit and pauses or
+// aborts the crawl when the stage's error rate crosses the threshold
+func (c *BiliCrawler) recordResult(stage string, err error) {
+	if err == nil {
+		c.health.success(stage, time.Now())
+	} else {
+		c.stats.incError(stage, err)
+	}
+
+	rate, tripped := c.circuit.record(stage, err)
+	if !tripped {
+		return
+	}
+
+	reason := fmt.Sprintf("%s 阶段错误率 %.0f%% 超过阈值 %.0f%%", stage, rate*100, c.circuit.config.Threshold*100)
+	if c.circuit.config.Action == "abort" {
+		c.abort(reason, ExitAbortedRiskControl)
+		return
+	}
+
+	cooldown := c.circuit.nextCooldown(time.Now())
+	c.errorf("[熔断] %s，暂停 %v\n", reason, cooldown)
+	go func() {
+		c.pauseFor(ratelimit.PauseCircuit)
+		time.Sleep(cooldown)
+		if c.circuit.config.RotateSessions {
+			rotated := c.rotateSessions()
+			c.logf("[熔断] 已为 %d 个会话更换 Cookie\n", rotated)
+		}
+		c.circuit.reset()
+		ratelimit.ResumeFor(ratelimit.PauseCircuit)
+		c.logf("[熔断] 冷却结束，恢复爬取\n")
+	}()
+}
+
+// newSession hands out a shared worker session from the session manager,
+// which also lets the circuit rotate its cookie
+func (c *BiliCrawler) newSession() *api.Session {
+	return c.sessions.Acquire()
+}
+
+// rotateSessions switches every worker session to a new cookie and returns
+// how many changed
+func (c *BiliCrawler) rotateSessions() int {
+	return c.sessions.RotateAll()
+}
+
+// runAbort is why and with which exit code the crawl was stopped early
+type runAbort struct {
+	code   int
+	reason string
+}
+
+// abort stops the crawl with the given exit code after a failure such as
+// risk control or a stall
+func (c *BiliCrawler) abort(reason string, code int) {
+	if c.stopWith(reason, code) {
+		c.errorf("爬虫中止: %s\n", reason)
+	}
+}
+
+// stopWith ends the crawl early with the given exit code and reports whether
+// this was the first stop. It cancels rather than exits, so the stages drain
+// and run checkpoints pending work, flushes the sink and sent records and
+// writes the report as usual.
+func (c *BiliCrawler) stopWith(reason string, code int) bool {
+	c.mu.Lock()
+	first := c.aborted == nil
+	if first {
+		c.aborted = &runAbort{code: code, reason: reason}
+	}
+	c.mu.Unlock()
+	if first {
+		c.Cancel()
+	}
+	return first
+}
+
+// abortedWith returns the early stop that ended the crawl, or nil
+func (c *BiliCrawler) abortedWith() *runAbort {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.aborted
+}
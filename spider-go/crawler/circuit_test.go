@@ -0,0 +1,181 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"spider-go/api"
+	"spider-go/cookie"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestStageWindow(t *testing.T) {
+	w := &stageWindow{failed: make([]bool, 4)}
+
+	w.add(true)
+	w.add(false)
+	if w.rate() != 0.5 {
+		t.Errorf("rate = %f, expected 0.5", w.rate())
+	}
+
+	// Oldest outcomes fall out of the window
+	w.add(false)
+	w.add(false)
+	w.add(false)
+	if w.rate() != 0 {
+		t.Errorf("rate = %f, expected 0 after the failure left the window", w.rate())
+	}
+}
+
+func TestErrorCircuit_Disabled(t *testing.T) {
+	if newErrorCircuit(ErrorCircuitConfig{}) != nil {
+		t.Error("Disabled circuit should be nil")
+	}
+
+	var ec *errorCircuit
+	if _, tripped := ec.record("comment", fmt.Errorf("x")); tripped {
+		t.Error("Nil circuit should never trip")
+	}
+}
+
+func TestErrorCircuit_Trips(t *testing.T) {
+	ec := newErrorCircuit(ErrorCircuitConfig{
+		Enabled:    true,
+		Window:     10,
+		MinSamples: 4,
+		Threshold:  0.5,
+		Codes:      []int{-412},
+	})
+
+	riskErr := &api.Error{Code: -412, Message: "请求被拦截"}
+	otherErr := &api.Error{Code: -404, Message: "啥都木有"}
+
+	// Errors with other codes don't count
+	for i := 0; i < 4; i++ {
+		if _, tripped := ec.record("comment", otherErr); tripped {
+			t.Fatal("Circuit should not trip on uncounted codes")
+		}
+	}
+
+	ec.reset()
+	ec.record("comment", nil)
+	ec.record("comment", riskErr)
+	ec.record("comment", nil)
+	rate, tripped := ec.record("comment", riskErr)
+	if !tripped || rate != 0.5 {
+		t.Errorf("Expected circuit to trip at 50%%, got tripped=%v rate=%f", tripped, rate)
+	}
+
+	// Only trips once until reset
+	if _, tripped := ec.record("comment", riskErr); tripped {
+		t.Error("Circuit should not trip twice")
+	}
+
+	// Stages are tracked separately
+	ec.reset()
+	ec.record("account", riskErr)
+	ec.record("account", riskErr)
+	ec.record("comment", nil)
+	if _, tripped := ec.record("comment", nil); tripped {
+		t.Error("Comment stage should not trip from account failures")
+	}
+}
+
+func TestErrorCircuit_NextCooldown(t *testing.T) {
+	ec := newErrorCircuit(ErrorCircuitConfig{
+		Enabled:              true,
+		CooldownSeconds:      60,
+		CooldownMultiplier:   2,
+		MaxCooldownSeconds:   200,
+		CooldownResetSeconds: 600,
+	})
+	now := time.Now()
+
+	for i, expected := range []time.Duration{60 * time.Second, 120 * time.Second, 200 * time.Second} {
+		if got := ec.nextCooldown(now); got != expected {
+			t.Errorf("Trip %d: cooldown = %v, expected %v", i+1, got, expected)
+		}
+	}
+
+	// A long run without trips resets the streak
+	ec.resumed = now
+	if got := ec.nextCooldown(now.Add(11 * time.Minute)); got != 60*time.Second {
+		t.Errorf("Cooldown after reset = %v, expected 1m0s", got)
+	}
+}
+
+func TestBiliCrawler_Abort(t *testing.T) {
+	c := newReloadCrawler()
+	c.cancelled = make(chan struct{})
+
+	c.abort("测试", ExitAbortedRiskControl)
+	c.abort("稍后", ExitBudgetExhausted)
+
+	if !c.isCancelled() {
+		t.Error("Abort should cancel the crawl")
+	}
+	if ratelimit.IsPaused() {
+		t.Error("Abort should not pause requests the drain still needs")
+	}
+	aborted := c.abortedWith()
+	if aborted == nil || aborted.code != ExitAbortedRiskControl || aborted.reason != "测试" {
+		t.Errorf("aborted = %+v, expected the first abort kept", aborted)
+	}
+}
+
+func TestBiliCrawler_AbortDrainsAndReports(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0,"data":{}}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+
+	dir := t.TempDir()
+	storage.SetRecordDir(dir)
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error { return nil }))
+	t.Cleanup(func() { storage.SetSink(nil) })
+	t.Cleanup(func() { storage.CloseSentIDs() })
+
+	config := DefaultConfig()
+	config.Keyword = "测试"
+	config.DelayMin, config.DelayMax = 0, 0
+	config.RateLimitRate, config.RateLimitCapacity = 1000, 1000
+	config.CookieConfigPath = filepath.Join(dir, "cookies.json")
+	config.ReportPath = filepath.Join(dir, "report.json")
+	config.KafkaOutput = false
+	previous := cookie.GetCookiePool(config.CookieConfigPath)
+	cookie.SetCookiePool(cookie.NewCookiePool(config.CookieConfigPath))
+	t.Cleanup(func() { cookie.SetCookiePool(previous) })
+
+	c, err := NewBiliCrawler(config)
+	if err != nil {
+		t.Fatalf("NewBiliCrawler: %v", err)
+	}
+	c.SetLogOutput(io.Discard)
+	c.abort("测试", ExitAbortedRiskControl)
+	c.CrawlVideos([]string{"BV1"})
+
+	if code := c.ExitCode(); code != ExitAbortedRiskControl {
+		t.Errorf("ExitCode = %d, expected %d", code, ExitAbortedRiskControl)
+	}
+	data, err := os.ReadFile(config.ReportPath)
+	if err != nil {
+		t.Fatalf("Aborted run should still write its report: %v", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil || report.ExitCode != ExitAbortedRiskControl || report.Reason != "测试" {
+		t.Errorf("report = %+v, %v; expected the abort code and reason", report, err)
+	}
+}
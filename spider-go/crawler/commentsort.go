@@ -0,0 +1,46 @@
+package crawler
+
+import (
+	"strings"
+
+	"spider-go/api"
+)
+
+// Main comment orders accepted by comment_sort
+const (
+	CommentSortTime = "time" // newest first
+	CommentSortHot  = "hot"  // hottest first
+)
+
+// hotCursorPrefix marks a comment cursor of the hot-sorted main comments.
+// Cursors are only valid in the order that returned them, so saved as
+// progress it makes a resumed crawl stay in that order whatever
+// comment_sort says by then.
+const hotCursorPrefix = "hot:"
+
+// isHotCursor reports whether cursor belongs to the hot-sorted comments
+func isHotCursor(cursor string) bool {
+	return strings.HasPrefix(cursor, hotCursorPrefix)
+}
+
+// fetchSortedComments fetches a page of a video's main comments from
+// reply/wbi/main in the order the cursor belongs to, or in comment_sort
+// for the first page
+func (c *BiliCrawler) fetchSortedComments(aid int64, cursor string, session *api.Session) (*api.MainCommentsResult, error) {
+	offset, hot := strings.CutPrefix(cursor, hotCursorPrefix)
+	if cursor == "" {
+		hot = c.config.CommentSort == CommentSortHot
+	}
+	if !hot {
+		return api.GetMainComments(aid, cursor, session, c.config.CookieConfigPath)
+	}
+
+	result, err := api.GetMainCommentsSorted(aid, offset, api.CommentModeHot, session, c.config.CookieConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if result.NextCursor != "" {
+		result.NextCursor = hotCursorPrefix + result.NextCursor
+	}
+	return result, nil
+}
@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+)
+
+func TestFetchMainComments_Hot(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/x/v2/reply/wbi/main" {
+			w.Write([]byte(`{"code":0,"data":{"wbi_img":{"img_url":"https://i0.hdslb.com/bfs/wbi/a.png","sub_url":"https://i0.hdslb.com/bfs/wbi/b.png"}}}`))
+			return
+		}
+		requests = append(requests, r.URL.Query().Get("mode")+" "+r.URL.Query().Get("pagination_str"))
+		fmt.Fprint(w, `{"code":0,"data":{"cursor":{"is_end":false,"pagination_reply":{"next_offset":"abc"}},`+
+			`"replies":[{"rpid":5,"mid":1,"ctime":1,"rcount":0,"content":{"message":"hi"},"member":{}}]}}`)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	c := newReloadCrawler()
+	c.config.CommentSort = CommentSortHot
+	result, err := c.fetchMainComments(1, "", nil)
+	if err != nil {
+		t.Fatalf("fetchMainComments: %v", err)
+	}
+	if result.NextCursor != hotCursorPrefix+"abc" || !isHotCursor(result.NextCursor) {
+		t.Errorf("NextCursor = %q, want it to stay in hot order", result.NextCursor)
+	}
+
+	// A hot cursor stays hot after comment_sort changes; a bare one is time
+	c.config.CommentSort = CommentSortTime
+	if _, err := c.fetchMainComments(1, result.NextCursor, nil); err != nil {
+		t.Fatalf("fetchMainComments: %v", err)
+	}
+	if _, err := c.fetchMainComments(1, "abc", nil); err != nil {
+		t.Fatalf("fetchMainComments: %v", err)
+	}
+	if len(requests) != 3 || !strings.HasPrefix(requests[0], "3 ") ||
+		requests[1] != `3 {"offset":"abc"}` || requests[2] != `2 {"offset":"abc"}` {
+		t.Errorf("requested %q", requests)
+	}
+}
@@ -0,0 +1,307 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"spider-go/storage"
+)
+
+// configJSON converts a config file to JSON, picking the format from the
+// file extension (.yaml/.yml, .toml, anything else is JSON). YAML and TOML
+// documents use the same keys as the JSON config.
+func configJSON(path string, data []byte) ([]byte, error) {
+	var doc map[string]interface{}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return data, nil
+	}
+
+	// Round-trip through JSON so the json tags stay the single source of keys
+	return json.Marshal(doc)
+}
+
+// decodeConfig decodes a config file into config. With a profile, the
+// matching entry of the file's "profiles" section is applied on top of the
+// top-level settings.
+func decodeConfig(path string, data []byte, profile string, config *Config) error {
+	data, err := configJSON(path, data)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return err
+	}
+	if profile == "" {
+		return nil
+	}
+
+	var doc struct {
+		Profiles map[string]json.RawMessage `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	raw, ok := doc.Profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(doc.Profiles))
+		for name := range doc.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(names, ", "))
+	}
+	if err := json.Unmarshal(raw, config); err != nil {
+		return fmt.Errorf("invalid profile %q: %w", profile, err)
+	}
+	return nil
+}
+
+// stageNames are the stages that accept a stage_threads entry
+var stageNames = map[string]bool{
+	"search": true, "detail": true, "comment": true, "reply": true,
+	"account": true, "dynamic": true, "relation": true, "favorite": true, "related": true,
+	"media": true, "stream": true, "subtitle": true, "danmaku": true, "article": true,
+	"live": true, "stats": true,
+}
+
+// defaultQueueSizes are the capacities of the pipeline queues, by the names
+// Snapshot reports them under
+var defaultQueueSizes = map[string]int{
+	"video": 100, "comment": 500, "account": 1000, "dynamic": 1000, "relation": 1000,
+	"favorite": 1000, "media": 1000, "stream": 100, "subtitle": 500, "danmaku": 500, "article": 1000,
+	"live": 1000,
+}
+
+// queueSize returns the capacity of a pipeline queue: its queue_sizes entry,
+// or the default when it has none
+func (c Config) queueSize(name string) int {
+	if n := c.QueueSizes[name]; n > 0 {
+		return n
+	}
+	return defaultQueueSizes[name]
+}
+
+// Validate reports every setting that would make the crawler run with
+// nonsense values
+func (c Config) Validate() error {
+	return c.validate(true)
+}
+
+// ValidateTrending is Validate for the trending command, which searches the
+// hot search terms and so needs no keyword
+func (c Config) ValidateTrending() error {
+	return c.validate(false)
+}
+
+func (c Config) validate(needKeyword bool) error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Source == "" || c.Source == SourceSearch || c.Source == SourceRanking,
+		"source must be search or ranking (got %q)", c.Source)
+	check(!needKeyword || c.Source == SourceRanking || strings.TrimSpace(c.Keyword) != "", "keyword must not be empty")
+	check(c.CommentSort == "" || c.CommentSort == CommentSortTime || c.CommentSort == CommentSortHot,
+		"comment_sort must be time or hot (got %q)", c.CommentSort)
+	check(c.NThreads > 0, "n_threads must be > 0 (got %d)", c.NThreads)
+	check(c.PagesPerThread > 0, "pages_per_thread must be > 0 (got %d)", c.PagesPerThread)
+	check(c.DelayMin >= 0, "delay_min must be >= 0 (got %g)", c.DelayMin)
+	check(c.DelayMin <= c.DelayMax, "delay_min (%g) must be <= delay_max (%g)", c.DelayMin, c.DelayMax)
+	check(c.DelayDistribution == "" || c.DelayDistribution == DelayUniform ||
+		c.DelayDistribution == DelayNormal || c.DelayDistribution == DelayLogNormal,
+		"delay_distribution must be uniform, normal or lognormal (got %q)", c.DelayDistribution)
+	check(c.DelayMean == 0 || (c.DelayMean >= c.DelayMin && c.DelayMean <= c.DelayMax),
+		"delay_mean (%g) must be within [delay_min, delay_max]", c.DelayMean)
+	check(c.DelayStddev >= 0, "delay_stddev must be >= 0 (got %g)", c.DelayStddev)
+	if c.LatencyPacing {
+		check(c.LatencySlowdown > 1, "latency_slowdown must be > 1 (got %g)", c.LatencySlowdown)
+		check(c.LatencyMaxScale >= 1, "latency_max_scale must be >= 1 (got %g)", c.LatencyMaxScale)
+	}
+	check(c.RateLimitRate > 0, "rate_limit_rate must be > 0 (got %g)", c.RateLimitRate)
+	check(c.RateLimitCapacity >= 1, "rate_limit_capacity must be >= 1 (got %g)", c.RateLimitCapacity)
+	check(c.MaxConcurrentRequests >= 0, "max_concurrent_requests must be >= 0 (got %d)", c.MaxConcurrentRequests)
+	check(c.SessionMaxRequests >= 0, "session_max_requests must be >= 0 (got %d)", c.SessionMaxRequests)
+	check(c.NoiseRate >= 0 && c.NoiseRate <= 1, "noise_rate must be within [0, 1] (got %g)", c.NoiseRate)
+	if c.SessionMaxAge != "" {
+		d, err := time.ParseDuration(c.SessionMaxAge)
+		check(err == nil && d > 0, "session_max_age must be a positive duration such as \"30m\" (got %q)", c.SessionMaxAge)
+	}
+	check(c.CookieConfigPath != "", "cookie_config_path must not be empty")
+	check(c.RelatedDepth >= 0, "related_depth must be >= 0 (got %d)", c.RelatedDepth)
+	for _, id := range c.TopicIDs {
+		check(id > 0, "topic_ids must be positive (got %d)", id)
+	}
+	if c.StatSnapshotInterval != "" {
+		d, err := time.ParseDuration(c.StatSnapshotInterval)
+		check(err == nil && d > 0, "stat_snapshot_interval must be a positive duration such as \"6h\" (got %q)", c.StatSnapshotInterval)
+	}
+	check(c.StatSnapshotPasses >= 0, "stat_snapshot_passes must be >= 0 (got %d)", c.StatSnapshotPasses)
+	t := c.Trending
+	if t.Interval != "" {
+		d, err := time.ParseDuration(t.Interval)
+		check(err == nil && d > 0, "trending.interval must be a positive duration such as \"30m\" (got %q)", t.Interval)
+	}
+	check(t.Passes >= 0, "trending.passes must be >= 0 (got %d)", t.Passes)
+	check(t.HotSearchLimit >= 1, "trending.hot_search_limit must be >= 1 (got %d)", t.HotSearchLimit)
+	check(t.MaxTermsPerPass >= 0, "trending.max_terms_per_pass must be >= 0 (got %d)", t.MaxTermsPerPass)
+	check(t.PagesPerTerm >= 1, "trending.pages_per_term must be >= 1 (got %d)", t.PagesPerTerm)
+	if t.TermCooldown != "" {
+		d, err := time.ParseDuration(t.TermCooldown)
+		check(err == nil && d > 0, "trending.term_cooldown must be a positive duration such as \"24h\" (got %q)", t.TermCooldown)
+	}
+	check(t.PopularPages >= 0, "trending.popular_pages must be >= 0 (got %d)", t.PopularPages)
+	for _, rid := range t.RankingRids {
+		check(rid >= 0, "trending.ranking_rids must be >= 0 (got %d)", rid)
+	}
+	check(c.TopicMaxPages >= 0, "topic_max_pages must be >= 0 (got %d)", c.TopicMaxPages)
+	for _, mid := range c.UploadMids {
+		check(mid > 0, "upload_mids must be positive (got %d)", mid)
+	}
+	check(c.UploadMaxPages >= 0, "upload_max_pages must be >= 0 (got %d)", c.UploadMaxPages)
+	check(c.UserSearchMaxPages >= 0, "user_search_max_pages must be >= 0 (got %d)", c.UserSearchMaxPages)
+	check(c.ArticleMaxPages >= 0, "article_max_pages must be >= 0 (got %d)", c.ArticleMaxPages)
+	check(c.TagExpandDepth >= 0, "tag_expand_depth must be >= 0 (got %d)", c.TagExpandDepth)
+	check(c.TagExpandPerKeyword >= 0, "tag_expand_per_keyword must be >= 0 (got %d)", c.TagExpandPerKeyword)
+	check(c.TagExpandMaxTotal >= 0, "tag_expand_max_total must be >= 0 (got %d)", c.TagExpandMaxTotal)
+	check(c.TagExpandMinCount >= 1, "tag_expand_min_count must be >= 1 (got %d)", c.TagExpandMinCount)
+	check(c.SearchRefreshPages >= 0, "search_refresh_pages must be >= 0 (got %d)", c.SearchRefreshPages)
+	check(c.SearchExtendPages >= 0, "search_extend_pages must be >= 0 (got %d)", c.SearchExtendPages)
+	check(c.ReplyPageParallel >= 0, "reply_page_parallel must be >= 0 (got %d)", c.ReplyPageParallel)
+	check(c.VideoMaxPages >= 0, "video_max_pages must be >= 0 (got %d)", c.VideoMaxPages)
+	check(c.DynamicCommentPages >= 0, "dynamic_comment_pages must be >= 0 (got %d)", c.DynamicCommentPages)
+	if c.MaxRuntime != "" {
+		d, err := time.ParseDuration(c.MaxRuntime)
+		check(err == nil && d > 0, "max_runtime must be a positive duration such as \"6h\" (got %q)", c.MaxRuntime)
+	}
+	check(c.MaxRequests >= 0, "max_requests must be >= 0 (got %d)", c.MaxRequests)
+	if c.DrainMaxTime != "" {
+		d, err := time.ParseDuration(c.DrainMaxTime)
+		check(err == nil && d > 0, "drain_max_time must be a positive duration such as \"2h\" (got %q)", c.DrainMaxTime)
+	}
+	check(c.DrainMaxAccounts >= 0, "drain_max_accounts must be >= 0 (got %d)", c.DrainMaxAccounts)
+	if c.RunStats && c.RunStatsInterval != "" {
+		d, err := time.ParseDuration(c.RunStatsInterval)
+		check(err == nil && d > 0, "run_stats_interval must be a positive duration such as \"1m\" (got %q)", c.RunStatsInterval)
+	}
+	if c.StallTimeout != "" {
+		d, err := time.ParseDuration(c.StallTimeout)
+		check(err == nil && d > 0, "stall_timeout must be a positive duration such as \"15m\" (got %q)", c.StallTimeout)
+		check(c.StallAction == "heal" || c.StallAction == "exit", "stall_action must be \"heal\" or \"exit\" (got %q)", c.StallAction)
+		check(c.StallHealAttempts >= 0, "stall_heal_attempts must be >= 0 (got %d)", c.StallHealAttempts)
+	}
+	if c.DownloadMedia {
+		check(c.MediaDir != "", "media_dir must not be empty when download_media is enabled")
+	}
+	if c.DownloadStreams {
+		check(c.StreamDir != "", "stream_dir must not be empty when download_streams is enabled")
+		check(c.StreamQuality > 0, "stream_quality must be > 0 (got %d)", c.StreamQuality)
+	}
+	check(c.StreamMaxBytes >= 0, "stream_max_bytes must be >= 0 (got %d)", c.StreamMaxBytes)
+	check(c.MediaMaxBytes >= 0, "media_max_bytes must be >= 0 (got %d)", c.MediaMaxBytes)
+	check(c.HealthStaleSeconds >= 0, "health_stale_seconds must be >= 0 (got %d)", c.HealthStaleSeconds)
+	check(c.VideoMaxSeconds >= 0, "video_max_seconds must be >= 0 (got %d)", c.VideoMaxSeconds)
+	check(c.HotCommentPages >= 1, "hot_comment_pages must be >= 1 (got %d)", c.HotCommentPages)
+	if cs := c.CommentSampling; cs.Mode != "" {
+		check(cs.Mode == SampleFirst || cs.Mode == SampleEvery || cs.Mode == SampleRandom || cs.Mode == SampleTop,
+			"comment_sampling.mode must be \"first\", \"every\", \"random\" or \"top\" (got %q)", cs.Mode)
+		check(cs.MinReplies >= 0, "comment_sampling.min_replies must be >= 0 (got %d)", cs.MinReplies)
+		check(cs.Pages >= 1, "comment_sampling.pages must be >= 1 (got %d)", cs.Pages)
+		check(cs.Step >= 1, "comment_sampling.step must be >= 1 (got %d)", cs.Step)
+	}
+	check(c.HotReplyPages >= 0, "hot_reply_pages must be >= 0 (got %d)", c.HotReplyPages)
+	check(!c.Anonymize || c.AnonymizeKey != "", "anonymize requires anonymize_key")
+	if c.KafkaCreateTopics {
+		check(c.KafkaPartitions >= 1, "kafka_partitions must be >= 1 (got %d)", c.KafkaPartitions)
+		check(c.KafkaReplication >= 1, "kafka_replication must be >= 1 (got %d)", c.KafkaReplication)
+	}
+	if c.TopicTemplate != "" {
+		if err := storage.CheckTopicTemplate(c.TopicTemplate); err != nil {
+			errs = append(errs, fmt.Errorf("topic_template: %w", err))
+		}
+	}
+	check(!c.RecrawlNewComments || c.Resume, "recrawl_new_comments requires resume")
+	check(c.CommentReconcileThreshold >= 0 && c.CommentReconcileThreshold < 1,
+		"comment_reconcile_threshold must be in [0, 1) (got %g)", c.CommentReconcileThreshold)
+	check(c.CommentReconcilePages >= 1, "comment_reconcile_pages must be >= 1 (got %d)", c.CommentReconcilePages)
+
+	check(c.LogLevel == LogQuiet || c.LogLevel == LogNormal || c.LogLevel == LogVerbose,
+		"log_level must be %q, %q or %q (got %q)", LogQuiet, LogNormal, LogVerbose, c.LogLevel)
+
+	for _, window := range c.QuietHours.Windows {
+		if _, _, err := parseQuietWindow(window); err != nil {
+			errs = append(errs, fmt.Errorf("quiet_hours.windows: %w", err))
+		}
+	}
+	check(c.QuietHours.Rate >= 0, "quiet_hours.rate must be >= 0 (got %g)", c.QuietHours.Rate)
+
+	for stage, n := range c.StageThreads {
+		check(stageNames[stage], "stage_threads has unknown stage %q", stage)
+		check(n >= 0, "stage_threads.%s must be >= 0 (got %d)", stage, n)
+	}
+	for queue, n := range c.QueueSizes {
+		check(defaultQueueSizes[queue] > 0, "queue_sizes has unknown queue %q", queue)
+		check(n >= 0, "queue_sizes.%s must be >= 0 (got %d)", queue, n)
+	}
+
+	check(c.DedupMemoryIDs >= 0, "dedup_memory_ids must be >= 0 (got %d)", c.DedupMemoryIDs)
+	if c.SentIDFlushInterval != "" {
+		d, err := time.ParseDuration(c.SentIDFlushInterval)
+		check(err == nil && d >= 0, "sent_id_flush_interval must be a duration such as \"1s\" or \"0\" (got %q)", c.SentIDFlushInterval)
+	}
+	check(c.SentIDFsync == "" || c.SentIDFsync == storage.FsyncNone || c.SentIDFsync == storage.FsyncFlush || c.SentIDFsync == storage.FsyncAlways,
+		"sent_id_fsync must be %q, %q or %q (got %q)", storage.FsyncNone, storage.FsyncFlush, storage.FsyncAlways, c.SentIDFsync)
+
+	if c.CrawlRelations {
+		check(c.RelationPageSize > 0 && c.RelationPageSize <= 50,
+			"relation_page_size must be between 1 and 50 (got %d)", c.RelationPageSize)
+	}
+	if c.CrawlFavorites {
+		check(c.FavoritePageSize > 0 && c.FavoritePageSize <= 20,
+			"favorite_page_size must be between 1 and 20 (got %d)", c.FavoritePageSize)
+	}
+
+	f := c.VideoFilter
+	check(f.MaxDuration == 0 || f.MinDuration <= f.MaxDuration,
+		"video_filter.min_duration (%d) must be <= max_duration (%d)", f.MinDuration, f.MaxDuration)
+
+	if ec := c.ErrorCircuit; ec.Enabled {
+		check(ec.Window > 0, "error_circuit.window must be > 0 (got %d)", ec.Window)
+		check(ec.Threshold > 0 && ec.Threshold <= 1, "error_circuit.threshold must be in (0, 1] (got %g)", ec.Threshold)
+		check(ec.Action == "pause" || ec.Action == "abort", "error_circuit.action must be \"pause\" or \"abort\" (got %q)", ec.Action)
+		check(ec.CooldownSeconds >= 0, "error_circuit.cooldown_seconds must be >= 0 (got %d)", ec.CooldownSeconds)
+		check(ec.CooldownMultiplier >= 0, "error_circuit.cooldown_multiplier must be >= 0 (got %g)", ec.CooldownMultiplier)
+	}
+
+	if at := c.AutoTune; at.Enabled {
+		check(at.IntervalSeconds > 0, "auto_tune.interval_seconds must be > 0 (got %d)", at.IntervalSeconds)
+		check(at.MinThreads >= 1 && at.MinThreads <= at.MaxThreads,
+			"auto_tune.min_threads (%d) must be between 1 and max_threads (%d)", at.MinThreads, at.MaxThreads)
+		check(at.QueueHighWater > 0 && at.QueueHighWater <= 1, "auto_tune.queue_high_water must be in (0, 1] (got %g)", at.QueueHighWater)
+		check(at.ErrorThreshold > 0 && at.ErrorThreshold <= 1, "auto_tune.error_threshold must be in (0, 1] (got %g)", at.ErrorThreshold)
+		check(at.MaxDelayScale >= 1, "auto_tune.max_delay_scale must be >= 1 (got %g)", at.MaxDelayScale)
+	}
+
+	return errors.Join(errs...)
+}
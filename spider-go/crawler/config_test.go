@@ -0,0 +1,177 @@
+package crawler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig_Formats(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"keyword": "测试", "n_threads": 5, "video_filter": {"min_play": 100, "require_tags": ["游戏"]}}`,
+		"config.yaml": `
+keyword: 测试
+n_threads: 5
+video_filter:
+  min_play: 100
+  require_tags: [游戏]
+`,
+		"config.toml": `
+keyword = "测试"
+n_threads = 5
+
+[video_filter]
+min_play = 100
+require_tags = ["游戏"]
+`,
+	}
+
+	for name, content := range files {
+		config, err := LoadConfig(writeConfigFile(t, name, content))
+		if err != nil {
+			t.Errorf("%s: LoadConfig failed: %v", name, err)
+			continue
+		}
+		if config.Keyword != "测试" || config.NThreads != 5 {
+			t.Errorf("%s: top-level fields not loaded: %+v", name, config)
+		}
+		if config.VideoFilter.MinPlay != 100 || len(config.VideoFilter.RequireTags) != 1 {
+			t.Errorf("%s: nested fields not loaded: %+v", name, config.VideoFilter)
+		}
+		if config.PagesPerThread != DefaultConfig().PagesPerThread {
+			t.Errorf("%s: missing fields should keep defaults", name)
+		}
+	}
+
+	if _, err := LoadConfig(writeConfigFile(t, "bad.yml", "keyword: [unclosed")); err == nil {
+		t.Error("Expected error for invalid YAML")
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	config := DefaultConfig()
+	config.Keyword = "测试"
+	if err := config.Validate(); err != nil {
+		t.Errorf("Default config with a keyword should be valid: %v", err)
+	}
+
+	config.Keyword = " "
+	config.NThreads = 0
+	config.DelayMin = 5
+	config.DelayMax = 1
+	config.RateLimitRate = 0
+	config.ErrorCircuit.Enabled = true
+	config.ErrorCircuit.Action = "explode"
+	config.AutoTune.Enabled = true
+	config.AutoTune.MinThreads = 10
+	config.SentIDFsync = "sometimes"
+	config.TopicTemplate = "claw/{kind}"
+	config.SessionMaxAge = "forever"
+	config.NoiseRate = 1.5
+	config.KafkaCreateTopics = true
+	config.KafkaPartitions = 0
+	config.StallTimeout = "15m"
+	config.StallAction = "restart"
+	config.DrainMaxTime = "soon"
+	config.RunStats = true
+	config.RunStatsInterval = "often"
+	config.CommentSampling.Mode = "median"
+	config.CommentSort = "likes"
+
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{"keyword", "n_threads", "delay_min", "rate_limit_rate", "error_circuit.action", "auto_tune.min_threads", "sent_id_fsync", "topic_template", "session_max_age", "noise_rate", "kafka_partitions", "stall_action", "drain_max_time", "run_stats_interval", "comment_sampling.mode", "comment_sort"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validation error should mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestConfig_QueueSizes(t *testing.T) {
+	config := DefaultConfig()
+	config.Keyword = "测试"
+	config.QueueSizes = map[string]int{"comment": 5000, "account": 0}
+
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Valid queue sizes rejected: %v", err)
+	}
+	if got := config.queueSize("comment"); got != 5000 {
+		t.Errorf("queueSize(comment) = %d, want 5000", got)
+	}
+	if got := config.queueSize("account"); got != 1000 {
+		t.Errorf("queueSize(account) = %d, want the default 1000", got)
+	}
+	if got := config.queueSize("video"); got != 100 {
+		t.Errorf("queueSize(video) = %d, want the default 100", got)
+	}
+
+	config.QueueSizes = map[string]int{"reply": 10, "video": -1}
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{`unknown queue "reply"`, "queue_sizes.video"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validation error should mention %s, got: %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigProfile(t *testing.T) {
+	path := writeConfigFile(t, "config.yaml", `
+keyword: 测试
+n_threads: 3
+delay_min: 2
+delay_max: 4
+profiles:
+  gentle:
+    n_threads: 1
+    delay_min: 8
+    delay_max: 15
+  aggressive:
+    n_threads: 10
+    comment_filter:
+      min_likes: 5
+`)
+
+	base, err := LoadConfigProfile(path, "")
+	if err != nil {
+		t.Fatalf("LoadConfigProfile failed: %v", err)
+	}
+	if base.NThreads != 3 || base.DelayMin != 2 {
+		t.Errorf("Base config should ignore profiles: %+v", base)
+	}
+
+	gentle, err := LoadConfigProfile(path, "gentle")
+	if err != nil {
+		t.Fatalf("LoadConfigProfile(gentle) failed: %v", err)
+	}
+	if gentle.NThreads != 1 || gentle.DelayMin != 8 || gentle.DelayMax != 15 {
+		t.Errorf("Profile values should override the base: %+v", gentle)
+	}
+	if gentle.Keyword != "测试" {
+		t.Error("Settings missing from the profile should come from the base")
+	}
+
+	aggressive, _ := LoadConfigProfile(path, "aggressive")
+	if aggressive.CommentFilter.MinLikes != 5 || aggressive.CommentFilter.MaxRepeats != DefaultConfig().CommentFilter.MaxRepeats {
+		t.Errorf("Nested profile values should merge field by field: %+v", aggressive.CommentFilter)
+	}
+
+	_, err = LoadConfigProfile(path, "turbo")
+	if err == nil || !strings.Contains(err.Error(), "aggressive, gentle") {
+		t.Errorf("Unknown profile should list the available ones, got: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+
+	"spider-go/ratelimit"
+)
+
+// AddKeyword queues an additional search keyword. Keywords are searched in
+// the order they were added; once the search stage has finished no more
+// keywords can be accepted.
+func (c *BiliCrawler) AddKeyword(keyword string) error {
+	keyword = strings.TrimSpace(keyword)
+	if keyword == "" {
+		return fmt.Errorf("keyword is empty")
+	}
+
+	c.keywordMu.Lock()
+	defer c.keywordMu.Unlock()
+
+	if c.keywordIndex < 0 {
+		return fmt.Errorf("search stage already finished")
+	}
+	for _, k := range c.keywords {
+		if k == keyword {
+			return fmt.Errorf("keyword already added: %s", keyword)
+		}
+	}
+
+	c.keywords = append(c.keywords, keyword)
+	c.logf("已添加关键词: %s\n", keyword)
+	return nil
+}
+
+// Keywords returns all keywords accepted for this run
+func (c *BiliCrawler) Keywords() []string {
+	c.keywordMu.Lock()
+	defer c.keywordMu.Unlock()
+	keywords := make([]string, len(c.keywords))
+	copy(keywords, c.keywords)
+	return keywords
+}
+
+// nextKeyword returns the next keyword to search. When none are left or the
+// crawl was cancelled it closes the keyword list so that later AddKeyword
+// calls fail.
+func (c *BiliCrawler) nextKeyword() (string, bool) {
+	c.keywordMu.Lock()
+	defer c.keywordMu.Unlock()
+
+	if c.keywordIndex < 0 || c.keywordIndex >= len(c.keywords) || c.isCancelled() {
+		c.keywordIndex = -1
+		return "", false
+	}
+	keyword := c.keywords[c.keywordIndex]
+	c.keywordIndex++
+	return keyword, true
+}
+
+// Pause stops all workers from issuing new requests
+func (c *BiliCrawler) Pause() {
+	c.pauseFor(ratelimit.PauseOperator)
+	c.logf("爬虫已暂停\n")
+}
+
+// Resume lets paused workers continue
+func (c *BiliCrawler) Resume() {
+	ratelimit.Resume()
+	c.logf("爬虫已恢复\n")
+}
+
+// TogglePause pauses a running crawl or resumes one the operator paused. A
+// pause for the error circuit or quiet hours is left to end on its own.
+func (c *BiliCrawler) TogglePause() {
+	if ratelimit.PausedFor(ratelimit.PauseOperator) {
+		c.Resume()
+	} else {
+		c.Pause()
+	}
+}
+
+// SetRate changes the global request rate (requests per second)
+func (c *BiliCrawler) SetRate(rate float64) error {
+	if rate <= 0 {
+		return fmt.Errorf("rate must be positive, got %v", rate)
+	}
+	ratelimit.GetRateLimiter().SetRate(rate)
+	c.logf("请求速率已调整为 %.2f/s\n", rate)
+	return nil
+}
@@ -0,0 +1,111 @@
+package crawler
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"spider-go/cookie"
+	"spider-go/ratelimit"
+)
+
+func TestAddKeyword(t *testing.T) {
+	c := &BiliCrawler{keywords: []string{"初始"}}
+
+	if err := c.AddKeyword("  新词 "); err != nil {
+		t.Fatalf("AddKeyword failed: %v", err)
+	}
+	if err := c.AddKeyword("新词"); err == nil {
+		t.Error("Expected error for duplicate keyword")
+	}
+	if err := c.AddKeyword(" "); err == nil {
+		t.Error("Expected error for empty keyword")
+	}
+
+	keywords := c.Keywords()
+	if len(keywords) != 2 || keywords[1] != "新词" {
+		t.Errorf("Keywords = %v, expected [初始 新词]", keywords)
+	}
+}
+
+func TestNextKeyword(t *testing.T) {
+	c := &BiliCrawler{keywords: []string{"a"}}
+
+	if kw, ok := c.nextKeyword(); !ok || kw != "a" {
+		t.Fatalf("nextKeyword = %q, %v, expected a, true", kw, ok)
+	}
+
+	// Keywords added while searching are picked up
+	c.AddKeyword("b")
+	if kw, ok := c.nextKeyword(); !ok || kw != "b" {
+		t.Fatalf("nextKeyword = %q, %v, expected b, true", kw, ok)
+	}
+
+	// Once exhausted, the list is closed
+	if _, ok := c.nextKeyword(); ok {
+		t.Fatal("Expected no more keywords")
+	}
+	if err := c.AddKeyword("c"); err == nil {
+		t.Error("Expected error when adding keyword after search finished")
+	}
+}
+
+func TestSetRate_Invalid(t *testing.T) {
+	c := &BiliCrawler{}
+	if err := c.SetRate(0); err == nil {
+		t.Error("Expected error for zero rate")
+	}
+}
+
+func TestTogglePause(t *testing.T) {
+	c := newReloadCrawler()
+	defer ratelimit.Resume()
+
+	c.TogglePause()
+	if !ratelimit.IsPaused() {
+		t.Fatal("TogglePause should pause a running crawl")
+	}
+	c.TogglePause()
+	if ratelimit.IsPaused() {
+		t.Error("TogglePause should resume a paused crawl")
+	}
+
+	// Only the operator's own pause is toggled
+	ratelimit.PauseFor(ratelimit.PauseQuiet)
+	defer ratelimit.ResumeAll()
+	c.TogglePause()
+	if !ratelimit.PausedFor(ratelimit.PauseOperator) {
+		t.Error("TogglePause during quiet hours should add an operator pause")
+	}
+	c.TogglePause()
+	if ratelimit.PausedFor(ratelimit.PauseOperator) || !ratelimit.PausedFor(ratelimit.PauseQuiet) {
+		t.Error("TogglePause should lift only the operator pause")
+	}
+}
+
+func TestDumpStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cookies.json")
+	previous := cookie.GetCookiePool(path)
+	cookie.SetCookiePool(cookie.NewCookiePool(path))
+	t.Cleanup(func() { cookie.SetCookiePool(previous) })
+	c := newReloadCrawler()
+	c.recentLogs = newLogBuffer(10)
+	c.logf("之前的日志\n")
+	var out strings.Builder
+	c.SetLogOutput(&out)
+
+	c.DumpStatus()
+
+	line := strings.TrimSpace(out.String())
+	if !strings.HasPrefix(line, "[状态] ") {
+		t.Fatalf("log = %q, expected a status line", line)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "[状态] ")), &snapshot); err != nil {
+		t.Fatalf("status line is not a JSON snapshot: %v", err)
+	}
+	if snapshot.Keyword != "测试" || len(snapshot.RecentLogs) != 0 {
+		t.Errorf("snapshot = %+v, expected the keyword without the recent logs", snapshot)
+	}
+}
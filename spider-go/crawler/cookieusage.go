@@ -0,0 +1,43 @@
+package crawler
+
+import (
+	"time"
+
+	"spider-go/cookie"
+	"spider-go/storage"
+)
+
+// cookieOffendersLogged is how many cookies the end-of-run log lists
+const cookieOffendersLogged = 3
+
+// cookieUsage returns the request counts of each cookie this run
+func (c *BiliCrawler) cookieUsage() []cookie.Usage {
+	return cookie.GetCookiePool(c.config.CookieConfigPath).Usage()
+}
+
+// saveCookieUsage appends the cookie usage of the run to cookie_usage.json
+// and logs the cookies with the most failures
+func (c *BiliCrawler) saveCookieUsage(now time.Time) {
+	usage := c.cookieUsage()
+	if len(usage) == 0 {
+		return
+	}
+	started, _, _ := c.health.snapshot()
+	if started.IsZero() {
+		started = now
+	}
+	run := storage.CookieUsageRun{Started: started.Unix(), Finished: now.Unix(), Cookies: usage}
+	if err := storage.AppendCookieUsage(run); err != nil {
+		c.errorf("保存 Cookie 使用统计失败: %v\n", err)
+	}
+
+	for i, u := range usage {
+		if i == cookieOffendersLogged || u.Failures == 0 {
+			break
+		}
+		if i == 0 {
+			c.summaryf("失败最多的 Cookie:\n")
+		}
+		c.summaryf("  %s: 请求 %d，失败 %d (%.1f%%)，其中风控/失效 %d\n", u.Name, u.Requests, u.Failures, u.FailureRate()*100, u.CookieErrors)
+	}
+}
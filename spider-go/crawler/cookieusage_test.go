@@ -0,0 +1,52 @@
+package crawler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spider-go/cookie"
+	"spider-go/storage"
+)
+
+func TestBiliCrawler_SaveCookieUsage(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cookies.json")
+	os.WriteFile(path, []byte(`{"cookies": [
+		{"name": "主号", "value": "SESSDATA=a", "enabled": true},
+		{"name": "小号", "value": "SESSDATA=b", "enabled": true},
+		{"name": "备用", "value": "SESSDATA=c", "enabled": true}
+	]}`), 0644)
+	pool := cookie.NewCookiePool(path)
+	previous := cookie.GetCookiePool(path)
+	cookie.SetCookiePool(pool)
+	t.Cleanup(func() { cookie.SetCookiePool(previous) })
+	storage.SetRecordDir(dir)
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+
+	pool.RecordRequest("SESSDATA=a", true, 0)
+	pool.RecordRequest("SESSDATA=b", false, -412)
+	pool.RecordRequest("SESSDATA=b", true, 0)
+	pool.RecordRequest("SESSDATA=c", true, 0)
+
+	c := newReloadCrawler()
+	var out strings.Builder
+	c.SetLogOutput(&out)
+	c.saveCookieUsage(time.Now())
+
+	// Only cookies with failures are listed
+	log := out.String()
+	if !strings.Contains(log, "小号: 请求 2，失败 1 (50.0%)，其中风控/失效 1") {
+		t.Errorf("log = %q, expected the failing cookie", log)
+	}
+	if strings.Contains(log, "主号") || strings.Contains(log, "备用") {
+		t.Errorf("log = %q, expected cookies without failures left out", log)
+	}
+
+	runs, _ := storage.GetCookieUsage()
+	if len(runs) != 1 || len(runs[0].Cookies) != 3 || runs[0].Cookies[0].Name != "小号" {
+		t.Errorf("runs = %+v, expected one run with all three cookies", runs)
+	}
+}
@@ -1,14 +1,18 @@
 package crawler
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"spider-go/api"
+	"spider-go/cookie"
 	"spider-go/ratelimit"
 	"spider-go/storage"
 )
@@ -29,6 +33,366 @@ type Config struct {
 	RateLimitRate     float64 `json:"rate_limit_rate"`
 	RateLimitCapacity float64 `json:"rate_limit_capacity"`
 	UserAgent         string  `json:"user_agent"`
+
+	// Where the run finds videos: "search" searches the keywords, "ranking"
+	// seeds from the popular and ranking lists configured under trending
+	// (popular_pages, ranking_rids) instead
+	Source string `json:"source"`
+
+	// Cap on API requests in flight at once across all workers, so raising
+	// thread counts does not raise connection bursts (0 means no cap)
+	MaxConcurrentRequests int `json:"max_concurrent_requests"`
+
+	// Retire each worker session after session_max_requests requests or
+	// once it is session_max_age old (a duration such as "30m"): it moves to
+	// the next cookie with a fresh client and headers. 0 or empty means never.
+	SessionMaxRequests int64  `json:"session_max_requests"`
+	SessionMaxAge      string `json:"session_max_age"`
+
+	// Share of API requests (0 to 1) a session precedes with a harmless
+	// browsing request such as the homepage, so its traffic looks less like
+	// a pure API client; 0 disables it
+	NoiseRate float64 `json:"noise_rate"`
+
+	// Inter-request delay distribution: "uniform", "normal" or "lognormal".
+	// Mean and stddev (seconds) default to the middle and a quarter of the
+	// [delay_min, delay_max] range, which also bounds every sample.
+	DelayDistribution string  `json:"delay_distribution"`
+	DelayMean         float64 `json:"delay_mean"`
+	DelayStddev       float64 `json:"delay_stddev"`
+
+	// Latency pacing: once an API endpoint's recent response time reaches
+	// latency_slowdown times its usual time, request delays are stretched by
+	// the same factor, up to latency_max_scale, and shrink back as it
+	// recovers
+	LatencyPacing   bool    `json:"latency_pacing"`
+	LatencySlowdown float64 `json:"latency_slowdown"`
+	LatencyMaxScale float64 `json:"latency_max_scale"`
+
+	// Related-video expansion (0 depth disables it)
+	RelatedDepth       int `json:"related_depth"`
+	RelatedPerVideo    int `json:"related_per_video"`
+	RelatedMaxPerDepth int `json:"related_max_per_depth"`
+	RelatedMaxTotal    int `json:"related_max_total"`
+
+	// Topic (话题) seeds: the dynamics under each topic are saved and the
+	// videos among them crawled, up to topic_max_pages pages per topic
+	// (0 means all)
+	TopicIDs      []int64 `json:"topic_ids"`
+	TopicMaxPages int     `json:"topic_max_pages"`
+
+	// Upload (投稿) seeds: the uploads of each upload_mids user are crawled
+	// before the keywords, and with upload_owners the uploads of the
+	// uploaders of the videos saved are crawled after them, up to
+	// upload_max_pages pages of 30 per user (0 means all)
+	UploadMids     []int64 `json:"upload_mids"`
+	UploadOwners   bool    `json:"upload_owners"`
+	UploadMaxPages int     `json:"upload_max_pages"`
+
+	// Tag-based keyword expansion: once a keyword is searched, its saved
+	// videos' most frequent tags (at least tag_expand_min_count videos) are
+	// appended as keywords, up to tag_expand_per_keyword per keyword,
+	// tag_expand_max_total overall and tag_expand_depth generations
+	TagExpand           bool     `json:"tag_expand"`
+	TagExpandDepth      int      `json:"tag_expand_depth"`
+	TagExpandPerKeyword int      `json:"tag_expand_per_keyword"`
+	TagExpandMaxTotal   int      `json:"tag_expand_max_total"`
+	TagExpandMinCount   int      `json:"tag_expand_min_count"`
+	TagExpandStopwords  []string `json:"tag_expand_stopwords"`
+
+	// Core stages, all on by default. Turning one off drops its tasks
+	// unprocessed, e.g. for metadata-only crawls.
+	CrawlComments bool `json:"crawl_comments"`
+	CrawlReplies  bool `json:"crawl_replies"`
+	CrawlAccounts bool `json:"crawl_accounts"`
+
+	// Also fetch each video's tags and save them as "tags" in the video
+	VideoTags bool `json:"video_tags"`
+	// Also fetch the CC subtitles of every page of each video, filtered by
+	// subtitle_languages and subtitle_skip_ai, and save their text as
+	// "subtitles" in the video
+	VideoSubtitles bool `json:"video_subtitles"`
+	// Also fetch each video's current viewer count and save it as "online"
+	// in the video
+	VideoOnline bool `json:"video_online"`
+	// Also fetch the full page (分P) list of each video and save it as
+	// "pages" in the video; the danmaku and subtitle stages then crawl
+	// every page instead of only the first
+	VideoPages bool `json:"video_pages"`
+
+	// Also fetch each account's space profile (birthday, school, tags, live
+	// room, official verification) and save it as "space" in the account
+	AccountSpaceInfo bool `json:"account_space_info"`
+	// Also fetch each account's upload totals and save them as
+	// total_archive_views, total_article_views and total_likes
+	AccountUpstat bool `json:"account_upstat"`
+	// Also fetch each account's live room and save it as "live_room" in the
+	// account, null for users who never opened one
+	AccountLiveRoom bool `json:"account_live_room"`
+
+	// User dynamics stage
+	CrawlDynamics    bool `json:"crawl_dynamics"`
+	DynamicsMaxCount int  `json:"dynamics_max_count"`
+	DynamicsMaxDays  int  `json:"dynamics_max_days"`
+
+	// Also save up to dynamic_comment_pages pages (0 for all) of the main
+	// comments under each new text or picture dynamic; they go to
+	// claw_comment with dynamic_id set
+	DynamicComments     bool `json:"dynamic_comments"`
+	DynamicCommentPages int  `json:"dynamic_comment_pages"`
+
+	// Relation graph stage
+	CrawlRelations   bool `json:"crawl_relations"`
+	RelationMaxPages int  `json:"relation_max_pages"`
+	RelationPageSize int  `json:"relation_page_size"`
+
+	// Favorites stage: videos in discovered users' public favorite folders
+	CrawlFavorites   bool `json:"crawl_favorites"`
+	FavoriteMaxPages int  `json:"favorite_max_pages"` // pages per folder
+	FavoritePageSize int  `json:"favorite_page_size"`
+
+	// Media stage: download video covers and user avatars into media_dir,
+	// one file per URL hash (media_max_bytes 0 means no size limit), or
+	// into the store of a Go plugin (.so) exporting
+	// storage.MediaStorePluginSymbol, created with sink_options
+	DownloadMedia    bool   `json:"download_media"`
+	MediaDir         string `json:"media_dir"`
+	MediaStorePlugin string `json:"media_store_plugin"`
+	MediaCovers      bool   `json:"media_covers"`
+	MediaAvatars     bool   `json:"media_avatars"`
+	MediaMaxBytes    int64  `json:"media_max_bytes"`
+
+	// Stream stage: download the DASH video (best quality up to
+	// stream_quality, e.g. 80 = 1080P, 64 = 720P) and audio tracks of saved
+	// videos that pass stream_filter into stream_dir/<bvid>/
+	DownloadStreams bool        `json:"download_streams"`
+	StreamDir       string      `json:"stream_dir"`
+	StreamQuality   int         `json:"stream_quality"`
+	StreamAudio     bool        `json:"stream_audio"`
+	StreamMaxBytes  int64       `json:"stream_max_bytes"` // per track, 0 means no limit
+	StreamFilter    VideoFilter `json:"stream_filter"`
+
+	// Subtitle stage: save the CC subtitles of saved videos to claw_subtitle,
+	// optionally limited to some languages (e.g. "zh-CN", "ai-zh")
+	CrawlSubtitles    bool     `json:"crawl_subtitles"`
+	SubtitleLanguages []string `json:"subtitle_languages"`
+	SubtitleSkipAI    bool     `json:"subtitle_skip_ai"`
+
+	// Danmaku stage: save the danmaku (弹幕) of saved videos to
+	// claw_danmaku, one record per danmaku
+	CrawlDanmaku bool `json:"crawl_danmaku"`
+
+	// User search: also search every keyword for users, up to
+	// user_search_max_pages pages (0 means all), and send them to the
+	// account stage
+	SearchUsers        bool `json:"search_users"`
+	UserSearchMaxPages int  `json:"user_search_max_pages"`
+
+	// Article stage: also search every keyword for articles (专栏), up to
+	// article_max_pages pages of 20 (0 means all), and save each new
+	// article's view info to claw_article
+	CrawlArticles   bool `json:"crawl_articles"`
+	ArticleMaxPages int  `json:"article_max_pages"`
+
+	// snapshot-stats command: revisit saved videos every
+	// stat_snapshot_interval (a duration; empty means a single pass) and
+	// publish their counters to claw_video_stats, stopping after
+	// stat_snapshot_passes passes (0 means until stopped). With
+	// stat_snapshot_online each snapshot also carries the video's current
+	// viewer count as online_total and online_count.
+	StatSnapshotInterval string `json:"stat_snapshot_interval"`
+	StatSnapshotPasses   int    `json:"stat_snapshot_passes"`
+	StatSnapshotOnline   bool   `json:"stat_snapshot_online"`
+
+	// trending command: seed crawls from the hot search list and the
+	// popular and ranking videos, pass after pass
+	Trending TrendingConfig `json:"trending"`
+
+	// Live stage: save the live room info (room id, title, area, status) of
+	// the uploaders of saved videos to claw_live
+	CrawlLive bool `json:"crawl_live"`
+
+	// Search pages re-scanned for freshness when resuming a keyword
+	SearchRefreshPages int `json:"search_refresh_pages"`
+
+	// Pages fetched beyond pages_per_thread * search threads when the search
+	// reports more result pages than that (0 never extends)
+	SearchExtendPages int `json:"search_extend_pages"`
+
+	// Filters applied to search/related results before the detail stage
+	VideoFilter VideoFilter `json:"video_filter"`
+
+	// Filters applied to comments and replies before they are saved
+	CommentFilter CommentFilter `json:"comment_filter"`
+
+	// Reply pages fetched concurrently per root comment (1 pages serially)
+	ReplyPageParallel int `json:"reply_page_parallel"`
+
+	// Per-video comment budget per pass; videos over budget are checkpointed
+	// and revisited after the other videos (0 means unlimited)
+	VideoMaxPages   int `json:"video_max_pages"`
+	VideoMaxSeconds int `json:"video_max_seconds"`
+
+	// Hot-comments-only survey mode: fetch the first hot_comment_pages pages
+	// of hot-sorted comments per video and at most hot_reply_pages reply
+	// pages per root comment (0 keeps only the replies embedded in the
+	// comment) instead of paging through everything
+	HotCommentsOnly bool `json:"hot_comments_only"`
+	HotCommentPages int  `json:"hot_comment_pages"`
+	HotReplyPages   int  `json:"hot_reply_pages"`
+
+	// Order the main comments of a video are paged through in: "time"
+	// (newest first) or "hot". The orders surface different comments and
+	// reply trees; a video finished in one is not crawled again in the other.
+	CommentSort string `json:"comment_sort"`
+
+	// Fall back to the older page-numbered reply API for a video whose main
+	// comments are risk-controlled on reply/wbi/main; its comments carry
+	// comment_source "legacy"
+	LegacyCommentFallback bool `json:"legacy_comment_fallback"`
+
+	// Sample the main comments of large comment sections instead of paging
+	// through them all; the sample is recorded in the video's progress
+	CommentSampling CommentSamplingConfig `json:"comment_sampling"`
+
+	// Check published records against per-topic schemas, routing invalid
+	// ones to claw_quarantine, strip invalid UTF-8 and control characters
+	// and rewrite Unix timestamps as RFC3339
+	ValidateRecords bool `json:"validate_records"`
+
+	// Keep an API response whose fields changed type, leaving those fields
+	// empty, instead of failing the request. Changed response shapes are
+	// logged and listed in the report either way.
+	LenientDecode bool `json:"lenient_decode"`
+
+	// Go plugins (.so) exporting storage.SinkPluginSymbol that receive every
+	// saved record, each created with sink_options. Records still go to
+	// Kafka unless kafka_output is false.
+	SinkPlugins []string          `json:"sink_plugins"`
+	SinkOptions map[string]string `json:"sink_options"`
+	KafkaOutput bool              `json:"kafka_output"`
+
+	// Create the claw_* topics missing on the broker at startup with
+	// kafka_partitions partitions and kafka_replication replicas, instead
+	// of relying on the broker's auto-create defaults
+	KafkaCreateTopics bool `json:"kafka_create_topics"`
+	KafkaPartitions   int  `json:"kafka_partitions"`
+	KafkaReplication  int  `json:"kafka_replication"`
+
+	// Pseudonymize user IDs and names with an HMAC keyed by anonymize_key
+	// and drop avatars and locations from every published record
+	Anonymize    bool   `json:"anonymize"`
+	AnonymizeKey string `json:"anonymize_key"`
+
+	// Publish records found under a keyword to a topic of their own, e.g.
+	// "{topic}.{keyword}" for claw_comment.u539fu795e-9ebf6a5b; see
+	// storage.SetTopicTemplate
+	TopicTemplate string `json:"topic_template"`
+
+	// Revisit videos whose comments are done (needs resume) for the
+	// comments posted since, stopping at the first already saved comment
+	RecrawlNewComments bool `json:"recrawl_new_comments"`
+
+	// Comment count reconciliation: when a finished comment crawl has seen
+	// more than comment_reconcile_threshold (a fraction) fewer comments than
+	// the video's reply count, refetch up to comment_reconcile_pages pages
+	// in hot order and record the gap in the report
+	CommentReconcile          bool    `json:"comment_reconcile"`
+	CommentReconcileThreshold float64 `json:"comment_reconcile_threshold"`
+	CommentReconcilePages     int     `json:"comment_reconcile_pages"`
+
+	// Stop the crawl once it has run for max_runtime (a duration such as
+	// "6h") or issued max_requests requests; empty or 0 means unlimited
+	MaxRuntime  string `json:"max_runtime"`
+	MaxRequests int64  `json:"max_requests"`
+
+	// Bound the account stage once the reply stage is done: after
+	// drain_max_time (a duration such as "2h") or drain_max_accounts users,
+	// the users still queued are left in pending_mids and the run finishes;
+	// empty or 0 means unlimited
+	DrainMaxTime     string `json:"drain_max_time"`
+	DrainMaxAccounts int64  `json:"drain_max_accounts"`
+
+	// Stall watchdog: when no record has been saved and no request has
+	// succeeded for stall_timeout (a duration such as "15m"; empty
+	// disables), log the queue states and, with stall_action "heal",
+	// rebuild every session up to stall_heal_attempts times in a row before
+	// aborting with ExitStalled; "exit" aborts straight away
+	StallTimeout      string `json:"stall_timeout"`
+	StallAction       string `json:"stall_action"`
+	StallHealAttempts int    `json:"stall_heal_attempts"`
+
+	// Keep at most dedup_memory_ids IDs per saved-ID set (videos, comments,
+	// accounts) in memory and spill the rest to an on-disk index in
+	// dedup_dir (the system temp directory if empty); 0 keeps all in memory
+	DedupMemoryIDs int    `json:"dedup_memory_ids"`
+	DedupDir       string `json:"dedup_dir"`
+
+	// Saved IDs are buffered and appended to sent_records every
+	// sent_id_flush_interval (a duration; "0" writes each ID through) and
+	// synced per sent_id_fsync: "none", "flush" or "always"
+	SentIDFlushInterval string `json:"sent_id_flush_interval"`
+	SentIDFsync         string `json:"sent_id_fsync"`
+
+	// Lua script whose filter_video, filter_comment and filter_account
+	// functions can drop or rewrite records before they are saved
+	ScriptHook string `json:"script_hook"`
+
+	// Pause or abort the crawl when a stage's error rate is too high
+	ErrorCircuit ErrorCircuitConfig `json:"error_circuit"`
+
+	// Daily windows during which the crawl pauses or runs at a reduced rate
+	QuietHours QuietHoursConfig `json:"quiet_hours"`
+
+	// Adjust the worker counts of the comment, reply, account, dynamic and
+	// relation stages and the request delays from queue depths and
+	// risk-control errors, overriding their configured worker counts
+	AutoTune AutoTuneConfig `json:"auto_tune"`
+
+	// Worker count per stage ("search", "detail", "comment", "reply",
+	// "account", "dynamic", "relation", "favorite", "related", "media", "stream", "subtitle", "danmaku",
+	// "article", "live", "stats");
+	// missing stages use n_threads
+	StageThreads map[string]int `json:"stage_threads"`
+
+	// Capacity per pipeline queue ("video", "comment", "account", "dynamic",
+	// "relation", "favorite", "media", "stream", "subtitle", "danmaku", "article",
+	// "live");
+	// missing queues keep their defaults (see defaultQueueSizes). Producers
+	// block on a full queue, except that users found while the account
+	// queue is full wait in pending_mids for a later run.
+	QueueSizes map[string]int `json:"queue_sizes"`
+
+	// Reload reloadable settings when the config file changes (SIGHUP always reloads)
+	WatchConfig bool `json:"watch_config"`
+
+	// Web dashboard and control API listen address ("" disables it)
+	WebAddr string `json:"web_addr"`
+
+	// Token the control API requires as "Authorization: Bearer <token>"; an
+	// empty token makes the crawl command generate one for the run
+	WebToken string `json:"web_token"`
+
+	// Where to write the JSON report of each run ("" disables it)
+	ReportPath string `json:"report_path"`
+
+	// Publish a heartbeat every run_stats_interval (a duration such as
+	// "1m"; empty sends none) and the run report at the end to
+	// claw_run_stats
+	RunStats         bool   `json:"run_stats"`
+	RunStatsInterval string `json:"run_stats_interval"`
+
+	// "quiet" prints only errors and the final statistics, "normal" adds
+	// stage progress and "verbose" a line per search page, video, comment
+	// and user
+	LogLevel string `json:"log_level"`
+
+	// Redraw a progress line of the search pages and per-video comment pages
+	Progress bool `json:"progress"`
+
+	// /healthz reports the crawl as degraded when no request has succeeded
+	// for this many seconds (0 disables the check)
+	HealthStaleSeconds int `json:"health_stale_seconds"`
 }
 
 // DefaultConfig returns the default crawler configuration
@@ -48,11 +412,132 @@ func DefaultConfig() Config {
 		RateLimitRate:     2.0,
 		RateLimitCapacity: 5.0,
 		UserAgent:         "Mozilla/5.0 (X11; Linux x86_64; rv:147.0) Gecko/20100101 Firefox/147.0",
+		Source:            SourceSearch,
+		CommentSort:       CommentSortTime,
+
+		DelayDistribution: DelayUniform,
+
+		LatencySlowdown: 1.5,
+		LatencyMaxScale: 4,
+
+		RelatedDepth:       0,
+		RelatedPerVideo:    10,
+		RelatedMaxPerDepth: 200,
+		RelatedMaxTotal:    500,
+
+		TopicMaxPages:  10,
+		UploadMaxPages: 5,
+
+		UserSearchMaxPages: 2,
+		ArticleMaxPages:    5,
+
+		TagExpandDepth:      1,
+		TagExpandPerKeyword: 3,
+		TagExpandMaxTotal:   10,
+		TagExpandMinCount:   3,
+
+		CrawlComments: true,
+		CrawlReplies:  true,
+		CrawlAccounts: true,
+
+		CrawlDynamics:    false,
+		DynamicsMaxCount: 20,
+		DynamicsMaxDays:  30,
+
+		DynamicCommentPages: 3,
+
+		CrawlRelations:   false,
+		RelationMaxPages: 5,
+		RelationPageSize: 50,
+
+		CrawlFavorites:   false,
+		FavoriteMaxPages: 5,
+		FavoritePageSize: 20,
+
+		DownloadMedia: false,
+		MediaDir:      "media",
+		MediaCovers:   true,
+		MediaAvatars:  true,
+		MediaMaxBytes: 10 << 20,
+
+		DownloadStreams: false,
+		StreamDir:       "streams",
+		StreamQuality:   64,
+		StreamAudio:     true,
+		StreamMaxBytes:  1 << 30,
+
+		SearchRefreshPages: 1,
+
+		ReplyPageParallel: 1,
+
+		HealthStaleSeconds: 600,
+		ReportPath:         "report.json",
+		RunStatsInterval:   "1m",
+		LogLevel:           LogNormal,
+
+		VideoMaxPages:   0,
+		VideoMaxSeconds: 0,
+
+		HotCommentPages: 3,
+		HotReplyPages:   1,
+
+		CommentSampling: CommentSamplingConfig{Pages: 10, Step: 10},
+		Trending: TrendingConfig{
+			Interval:        "30m",
+			HotSearchLimit:  30,
+			MaxTermsPerPass: 10,
+			PagesPerTerm:    2,
+			PopularPages:    1,
+			RankingRids:     []int{0},
+		},
+
+		KafkaOutput:      true,
+		KafkaPartitions:  6,
+		KafkaReplication: 1,
+
+		SentIDFlushInterval: "1s",
+		SentIDFsync:         storage.FsyncNone,
+
+		StallAction:       "heal",
+		StallHealAttempts: 2,
+
+		CommentReconcileThreshold: 0.1,
+		CommentReconcilePages:     10,
+
+		ErrorCircuit: ErrorCircuitConfig{
+			Enabled:         false,
+			Window:          50,
+			MinSamples:      20,
+			Threshold:       0.5,
+			Codes:           []int{-352, -412},
+			Action:          "pause",
+			CooldownSeconds: 300,
+
+			CooldownMultiplier:   2,
+			MaxCooldownSeconds:   3600,
+			CooldownResetSeconds: 1800,
+		},
+
+		AutoTune: AutoTuneConfig{
+			Enabled:         false,
+			IntervalSeconds: 10,
+			MinThreads:      1,
+			MaxThreads:      8,
+			QueueHighWater:  0.5,
+			ErrorThreshold:  0.05,
+			MaxDelayScale:   4,
+		},
 	}
 }
 
-// LoadConfig loads configuration from a JSON file
+// LoadConfig loads configuration from a JSON, YAML or TOML file
 func LoadConfig(path string) (Config, error) {
+	return LoadConfigProfile(path, "")
+}
+
+// LoadConfigProfile loads a config file with one of its named profiles
+// applied ("" for none)
+func LoadConfigProfile(path, profile string) (Config, error) {
 	config := DefaultConfig()
 
 	data, err := os.ReadFile(path)
@@ -60,34 +545,59 @@ func LoadConfig(path string) (Config, error) {
 		return config, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	if err := json.Unmarshal(data, &config); err != nil {
+	if err := decodeConfig(path, data, profile, &config); err != nil {
 		return config, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
 	return config, nil
 }
 
-// VideoTask represents a video to be processed
-type VideoTask struct {
-	Detail map[string]interface{}
-}
-
-// CommentTask represents a comment with replies to be processed
-type CommentTask struct {
-	Aid     int64
-	Comment map[string]interface{}
+// Counters holds the crawler's saved/skipped counts
+type Counters struct {
+	VideosSaved      int `json:"videos_saved"`
+	CommentsSaved    int `json:"comments_saved"`
+	RepliesSaved     int `json:"replies_saved"`
+	AccountsSaved    int `json:"accounts_saved"`
+	VideosSkipped    int `json:"videos_skipped"`
+	VideosFiltered   int `json:"videos_filtered"`
+	VideosDeduped    int `json:"videos_deduped"`
+	CommentsSkipped  int `json:"comments_skipped"`
+	AccountsSkipped  int `json:"accounts_skipped"`
+	CommentsFiltered int `json:"comments_filtered"`
+	AccountsFiltered int `json:"accounts_filtered"`
+	DynamicsSaved    int `json:"dynamics_saved"`
+	RelationsSaved   int `json:"relations_saved"`
+	FavoritesSaved   int `json:"favorites_saved"`
+	VideosDeferred   int `json:"videos_deferred"`
+	MediaSaved       int `json:"media_saved"`
+	StreamsSaved     int `json:"streams_saved"`
+	SubtitlesSaved   int `json:"subtitles_saved"`
+	LiveSaved        int `json:"live_saved"`
+	StatSnapshots    int `json:"stat_snapshots"`
+	Tombstones       int `json:"tombstones"`
+	// Videos whose comments fell back to the older reply API
+	LegacyCommentVideos int `json:"legacy_comment_videos"`
+	Panics              int `json:"panics"`
+	// Comments saved from the comment sections of dynamics
+	DynamicCommentsSaved int `json:"dynamic_comments_saved"`
+	DanmakuSaved         int `json:"danmaku_saved"`
+	ArticlesSaved        int `json:"articles_saved"`
 }
 
 // Stats holds crawler statistics
 type Stats struct {
-	VideosSaved     int
-	CommentsSaved   int
-	RepliesSaved    int
-	AccountsSaved   int
-	VideosSkipped   int
-	CommentsSkipped int
-	AccountsSkipped int
-	mu              sync.Mutex
+	Counters
+	perKeyword map[string]*KeywordCounts
+	errors     map[string]map[string]int
+	gaps       []CommentGap
+	mu         sync.Mutex
+}
+
+// Snapshot returns a consistent copy of the counters
+func (s *Stats) Snapshot() Counters {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Counters
 }
 
 func (s *Stats) incVideosSaved() {
@@ -114,18 +624,138 @@ func (s *Stats) incAccountsSaved() {
 	s.mu.Unlock()
 }
 
+func (s *Stats) incDynamicsSaved() {
+	s.mu.Lock()
+	s.DynamicsSaved++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incDynamicCommentsSaved() {
+	s.mu.Lock()
+	s.DynamicCommentsSaved++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incRelationsSaved() {
+	s.mu.Lock()
+	s.RelationsSaved++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incFavoritesSaved() {
+	s.mu.Lock()
+	s.FavoritesSaved++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incAccountsFiltered() {
+	s.mu.Lock()
+	s.AccountsFiltered++
+	s.mu.Unlock()
+}
+
 func (s *Stats) incVideosSkipped() {
 	s.mu.Lock()
 	s.VideosSkipped++
 	s.mu.Unlock()
 }
 
+func (s *Stats) addVideosSkipped(n int) {
+	s.mu.Lock()
+	s.VideosSkipped += n
+	s.mu.Unlock()
+}
+
+func (s *Stats) incVideosFiltered() {
+	s.mu.Lock()
+	s.VideosFiltered++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incVideosDeduped() {
+	s.mu.Lock()
+	s.VideosDeduped++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incVideosDeferred() {
+	s.mu.Lock()
+	s.VideosDeferred++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incMediaSaved() {
+	s.mu.Lock()
+	s.MediaSaved++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incStreamsSaved() {
+	s.mu.Lock()
+	s.StreamsSaved++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incSubtitlesSaved() {
+	s.mu.Lock()
+	s.SubtitlesSaved++
+	s.mu.Unlock()
+}
+
+func (s *Stats) addDanmakuSaved(n int) {
+	s.mu.Lock()
+	s.DanmakuSaved += n
+	s.mu.Unlock()
+}
+
+func (s *Stats) incArticlesSaved() {
+	s.mu.Lock()
+	s.ArticlesSaved++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incLiveSaved() {
+	s.mu.Lock()
+	s.LiveSaved++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incStatSnapshots() {
+	s.mu.Lock()
+	s.StatSnapshots++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incTombstones() {
+	s.mu.Lock()
+	s.Tombstones++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incLegacyCommentVideos() {
+	s.mu.Lock()
+	s.LegacyCommentVideos++
+	s.mu.Unlock()
+}
+
+func (s *Stats) incPanics() {
+	s.mu.Lock()
+	s.Panics++
+	s.mu.Unlock()
+}
+
 func (s *Stats) incCommentsSkipped() {
 	s.mu.Lock()
 	s.CommentsSkipped++
 	s.mu.Unlock()
 }
 
+func (s *Stats) incCommentsFiltered() {
+	s.mu.Lock()
+	s.CommentsFiltered++
+	s.mu.Unlock()
+}
+
 func (s *Stats) incAccountsSkipped() {
 	s.mu.Lock()
 	s.AccountsSkipped++
@@ -134,57 +764,245 @@ func (s *Stats) incAccountsSkipped() {
 
 // BiliCrawler is the main crawler engine
 type BiliCrawler struct {
-	config Config
-	stats  Stats
-
-	videoQueue   chan *VideoTask
-	commentQueue chan *CommentTask
-	userMidQueue chan string
-
-	userMids   map[string]struct{}
-	savedBvids map[string]struct{}
-	savedRpids map[string]struct{}
-	savedMids  map[string]struct{}
-
-	videoProgress map[string]*storage.VideoProgress
+	config   Config
+	configMu sync.RWMutex
+	stats    Stats
+
+	videoQueue    chan *VideoTask
+	commentQueue  chan *CommentTask
+	userMidQueue  chan string
+	dynamicQueue  chan string
+	relationQueue chan string
+	favoriteQueue chan string
+	mediaQueue    chan mediaTask
+	mediaStore    storage.MediaStore // nil stores into media_dir
+	streamQueue   chan *VideoTask
+	subtitleQueue chan *VideoTask
+	danmakuQueue  chan *VideoTask
+	articleQueue  chan *ArticleTask
+	liveQueue     chan string
+
+	userMids        map[string]storage.MidSource
+	drainMids       bool // the seed queues pending_mids itself
+	savedBvids      *dedupSet
+	savedRpids      *dedupSet
+	savedMids       *dedupSet
+	savedDynamicIDs map[string]struct{}
+	relationMids    map[string]struct{}
+	favoriteMids    map[string]struct{}
+	seenSearchBvids map[string]struct{}
+	runSearchBvids  map[string]struct{}
+	pendingBvids    map[string]struct{} // recorded in pending_bvids this run
+	finishedBvids   map[string]struct{} // comment crawl finished this run
+	seenMedia       map[string]struct{}
+	savedSubtitles  map[string]struct{}
+	danmakuCids     map[string]struct{}
+	savedArticles   map[string]struct{}
+	seenArticles    map[string]struct{} // queued to the article stage this run
+	savedLiveMids   map[string]struct{}
+	seenLiveMids    map[string]struct{}
+	tombstoned      map[string]struct{}
+	uploaders       map[string]struct{} // users whose uploads are listed this run
+	statCids        map[string]int64    // first-page cids of snapshot videos
+	uploadOwners    []string            // uploaders due for crawlOwnerUploads
+
+	videoProgress  map[string]*storage.VideoProgress
+	deferredVideos []*VideoTask
+	failedTasks    map[string]struct{}
+	droppedReplies []*CommentTask // reply tasks skipped after Cancel
+	closedStages   map[string]bool
+	videoFilter    *videoFilter
+	streamFilter   *videoFilter
+	commentFilter  *commentFilter
+	script         *scriptHook
+	circuit        *errorCircuit
+	aborted        *runAbort
+	cancelled      chan struct{}
+	cancelOnce     sync.Once
+	idle           atomic.Bool // waiting between passes, see waitNextPass
+
+	health   healthTracker
+	exitCode int
+	sessions *api.SessionManager
+
+	logOut        io.Writer
+	progress      *progressBar // nil unless progress is set
+	progressDrawn bool         // under logMu
+	logMu         sync.Mutex
+	recentLogs    *logBuffer
+	recentErrors  *logBuffer
+	finished      bool
+
+	keywords     []string
+	keywordIndex int
+	keywordMu    sync.Mutex
+
+	// Worker counts and delay multiplier set by auto-tuning (under configMu)
+	tunedThreads    map[string]int
+	tunedDelayScale float64
+
+	// Whether latency pacing is stretching the delays (under mu)
+	latencyPaced bool
+
+	// Set once the account stage starts draining, nil while unlimited
+	drain atomic.Pointer[drainLimit]
+
+	// Identify this run's messages on claw_run_stats
+	runID string
+	host  string
+
+	// Tag expansion: tag counts per keyword (under mu), and the generation
+	// of expanded keywords and how many were added (under keywordMu)
+	tagCounts     map[string]map[string]int
+	keywordDepth  map[string]int
+	expandedTotal int
 
 	mu sync.Mutex
 }
 
+// SetupSinks routes saved records to the sink plugins of config, alongside
+// Kafka unless kafka_output is false. Without plugins records go to Kafka.
+func SetupSinks(config Config) error {
+	if len(config.SinkPlugins) == 0 {
+		return nil
+	}
+	var sinks storage.MultiSink
+	if config.KafkaOutput {
+		sinks = append(sinks, storage.KafkaSink)
+	}
+	for _, path := range config.SinkPlugins {
+		s, err := storage.LoadSinkPlugin(path, config.SinkOptions)
+		if err != nil {
+			return fmt.Errorf("failed to load sink plugin %s: %w", path, err)
+		}
+		sinks = append(sinks, s)
+	}
+	storage.SetSink(sinks)
+	return nil
+}
+
 // NewBiliCrawler creates a new crawler instance
 func NewBiliCrawler(config Config) (*BiliCrawler, error) {
 	// Initialize rate limiter with config values
 	ratelimit.InitRateLimiter(config.RateLimitRate, config.RateLimitCapacity)
+	ratelimit.SetMaxConcurrent(config.MaxConcurrentRequests)
 
 	// Set User-Agent
 	if config.UserAgent != "" {
 		api.SetUserAgent(config.UserAgent)
 	}
+	api.SetLenientDecode(config.LenientDecode)
+
+	if config.Anonymize {
+		storage.SetAnonymizer(storage.NewAnonymizer(config.AnonymizeKey))
+	}
+	storage.SetRecordValidation(config.ValidateRecords)
+	storage.SetTopicTemplate(config.TopicTemplate)
+	flushInterval, _ := time.ParseDuration(config.SentIDFlushInterval)
+	if err := storage.SetSentIDPolicy(flushInterval, config.SentIDFsync); err != nil {
+		return nil, err
+	}
+	if err := SetupSinks(config); err != nil {
+		return nil, err
+	}
+
+	filter, err := newVideoFilter(config.VideoFilter)
+	if err != nil {
+		return nil, err
+	}
+	streamFilter, err := newVideoFilter(config.StreamFilter)
+	if err != nil {
+		return nil, fmt.Errorf("stream_filter: %w", err)
+	}
+	var mediaStore storage.MediaStore
+	if config.DownloadMedia && config.MediaStorePlugin != "" {
+		if mediaStore, err = storage.LoadMediaStorePlugin(config.MediaStorePlugin, config.SinkOptions); err != nil {
+			return nil, fmt.Errorf("failed to load media store plugin %s: %w", config.MediaStorePlugin, err)
+		}
+	}
 
+	host := hostname()
 	crawler := &BiliCrawler{
-		config:       config,
-		videoQueue:   make(chan *VideoTask, 100),
-		commentQueue: make(chan *CommentTask, 500),
-		userMidQueue: make(chan string, 1000),
-		userMids:     make(map[string]struct{}),
-		savedBvids:   make(map[string]struct{}),
-		savedRpids:   make(map[string]struct{}),
-		savedMids:    make(map[string]struct{}),
+		config:          config,
+		runID:           newRunID(host, time.Now()),
+		host:            host,
+		videoQueue:      make(chan *VideoTask, config.queueSize("video")),
+		commentQueue:    make(chan *CommentTask, config.queueSize("comment")),
+		userMidQueue:    make(chan string, config.queueSize("account")),
+		dynamicQueue:    make(chan string, config.queueSize("dynamic")),
+		relationQueue:   make(chan string, config.queueSize("relation")),
+		favoriteQueue:   make(chan string, config.queueSize("favorite")),
+		mediaQueue:      make(chan mediaTask, config.queueSize("media")),
+		mediaStore:      mediaStore,
+		streamQueue:     make(chan *VideoTask, config.queueSize("stream")),
+		subtitleQueue:   make(chan *VideoTask, config.queueSize("subtitle")),
+		danmakuQueue:    make(chan *VideoTask, config.queueSize("danmaku")),
+		articleQueue:    make(chan *ArticleTask, config.queueSize("article")),
+		liveQueue:       make(chan string, config.queueSize("live")),
+		userMids:        make(map[string]storage.MidSource),
+		savedBvids:      newDedupSet(config.DedupMemoryIDs, config.DedupDir),
+		savedRpids:      newDedupSet(config.DedupMemoryIDs, config.DedupDir),
+		savedMids:       newDedupSet(config.DedupMemoryIDs, config.DedupDir),
+		savedDynamicIDs: make(map[string]struct{}),
+		relationMids:    make(map[string]struct{}),
+		favoriteMids:    make(map[string]struct{}),
+		seenSearchBvids: make(map[string]struct{}),
+		runSearchBvids:  make(map[string]struct{}),
+		pendingBvids:    make(map[string]struct{}),
+		finishedBvids:   make(map[string]struct{}),
+		seenMedia:       make(map[string]struct{}),
+		savedSubtitles:  make(map[string]struct{}),
+		danmakuCids:     make(map[string]struct{}),
+		savedArticles:   make(map[string]struct{}),
+		seenArticles:    make(map[string]struct{}),
+		savedLiveMids:   make(map[string]struct{}),
+		seenLiveMids:    make(map[string]struct{}),
+		tombstoned:      make(map[string]struct{}),
+		uploaders:       make(map[string]struct{}),
+		statCids:        make(map[string]int64),
+		failedTasks:     make(map[string]struct{}),
+		closedStages:    make(map[string]bool),
+		logOut:          os.Stdout,
+		recentLogs:      newLogBuffer(200),
+		recentErrors:    newLogBuffer(50),
+		keywords:        []string{config.Keyword},
+		tagCounts:       make(map[string]map[string]int),
+		keywordDepth:    make(map[string]int),
+		videoFilter:     filter,
+		streamFilter:    streamFilter,
+		commentFilter:   newCommentFilter(config.CommentFilter),
+		circuit:         newErrorCircuit(config.ErrorCircuit),
+		sessions:        api.NewSessionManager(config.CookieConfigPath),
+		cancelled:       make(chan struct{}),
+	}
+	sessionMaxAge, _ := time.ParseDuration(config.SessionMaxAge)
+	crawler.sessions.SetRetirement(config.SessionMaxRequests, sessionMaxAge)
+	crawler.sessions.SetNoise(config.NoiseRate)
+	if config.Progress {
+		crawler.progress = newProgressBar()
 	}
+	if config.ScriptHook != "" {
+		crawler.script, err = loadScriptHook(config.ScriptHook, crawler.logf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load script hook: %w", err)
+		}
+	}
+	api.ResetDrift()
+	api.ResetLatency()
+	api.SetDriftHandler(crawler.logDrift)
 
 	if config.Resume {
-		var err error
-		crawler.savedBvids, err = storage.GetSavedVideoBvids()
+		crawler.savedBvids, err = loadDedupSet(storage.EachSavedVideoBvid, config.DedupMemoryIDs, config.DedupDir)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load saved BVIDs: %w", err)
 		}
 
-		crawler.savedRpids, err = storage.GetSavedCommentRpids()
+		crawler.savedRpids, err = loadDedupSet(storage.EachSavedCommentRpid, config.DedupMemoryIDs, config.DedupDir)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load saved RPIDs: %w", err)
 		}
 
-		crawler.savedMids, err = storage.GetSavedAccountMids()
+		crawler.savedMids, err = loadDedupSet(storage.EachSavedAccountMid, config.DedupMemoryIDs, config.DedupDir)
 		if err != nil {
 			return nil, fmt.Errorf("failed to load saved MIDs: %w", err)
 		}
@@ -193,6 +1011,51 @@ func NewBiliCrawler(config Config) (*BiliCrawler, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to load video progress: %w", err)
 		}
+
+		crawler.savedDynamicIDs, err = storage.GetSavedDynamicIDs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load saved dynamic IDs: %w", err)
+		}
+
+		crawler.savedSubtitles, err = storage.GetSavedSubtitleIDs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load saved subtitle IDs: %w", err)
+		}
+
+		crawler.danmakuCids, err = storage.GetDanmakuCids()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load danmaku cids: %w", err)
+		}
+
+		crawler.savedArticles, err = storage.GetSavedArticleIDs()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load saved article IDs: %w", err)
+		}
+
+		crawler.savedLiveMids, err = storage.GetSavedLiveMids()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load saved live MIDs: %w", err)
+		}
+
+		crawler.tombstoned, err = storage.GetTombstonedBvids()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load tombstoned BVIDs: %w", err)
+		}
+
+		crawler.relationMids, err = storage.GetRelationDoneMids()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load relation MIDs: %w", err)
+		}
+
+		crawler.favoriteMids, err = storage.GetFavoriteDoneMids()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load favorite MIDs: %w", err)
+		}
+
+		crawler.seenSearchBvids, err = storage.GetSeenSearchBvids()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load seen search BVIDs: %w", err)
+		}
 	} else {
 		crawler.videoProgress = make(map[string]*storage.VideoProgress)
 	}
@@ -201,11 +1064,13 @@ func NewBiliCrawler(config Config) (*BiliCrawler, error) {
 }
 
 func (c *BiliCrawler) delay() {
-	d := c.config.DelayMin + rand.Float64()*(c.config.DelayMax-c.config.DelayMin)
+	d := sampleDelay(c.live(), globalRand{}) * c.delayScale() * c.latencyScale()
 	time.Sleep(time.Duration(d * float64(time.Second)))
 }
 
-func (c *BiliCrawler) addUserMid(mid string) {
+// addUserMid queues a discovered account for the account stage. The first
+// discovery of an account is kept as its source.
+func (c *BiliCrawler) addUserMid(mid string, source storage.MidSource) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -213,15 +1078,15 @@ func (c *BiliCrawler) addUserMid(mid string) {
 		return
 	}
 
-	c.userMids[mid] = struct{}{}
+	c.userMids[mid] = source
 
 	if c.config.Resume {
-		if _, saved := c.savedMids[mid]; saved {
+		if c.savedMids.Has(mid) {
 			return
 		}
 	}
 
-	storage.SavePendingMid(mid)
+	storage.SavePendingMid(mid, source)
 	select {
 	case c.userMidQueue <- mid:
 	default:
@@ -232,195 +1097,465 @@ func (c *BiliCrawler) addUserMid(mid string) {
 func (c *BiliCrawler) isBvidSaved(bvid string) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	_, exists := c.savedBvids[bvid]
-	return exists
+	return c.savedBvids.Has(bvid)
 }
 
 func (c *BiliCrawler) markBvidSaved(bvid string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.savedBvids[bvid] = struct{}{}
+	c.savedBvids.Add(bvid)
+}
+
+// claimSearchResult records a search hit and reports whether it should enter
+// the pipeline. A video found earlier in this run (e.g. by another keyword) is
+// never pushed twice; one seen in a previous run is only pushed again while
+// its comment crawl is unfinished or recrawl_new_comments is set.
+func (c *BiliCrawler) claimSearchResult(bvid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, claimed := c.runSearchBvids[bvid]; claimed {
+		return false
+	}
+	c.runSearchBvids[bvid] = struct{}{}
+
+	if _, seen := c.seenSearchBvids[bvid]; seen {
+		saved := c.savedBvids.Has(bvid)
+		progress := c.videoProgress[bvid]
+		return !(saved && progress != nil && progress.Done) || c.config.RecrawlNewComments
+	}
+
+	c.seenSearchBvids[bvid] = struct{}{}
+	storage.RecordSeenSearchBvid(bvid)
+	return true
 }
 
 func (c *BiliCrawler) isRpidSaved(rpid string) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	_, exists := c.savedRpids[rpid]
-	return exists
+	return c.savedRpids.Has(rpid)
 }
 
 func (c *BiliCrawler) markRpidSaved(rpid string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.savedRpids[rpid] = struct{}{}
+	c.savedRpids.Add(rpid)
 }
 
-func (c *BiliCrawler) isMidSaved(mid string) bool {
+func (c *BiliCrawler) isDynamicSaved(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, exists := c.savedDynamicIDs[id]
+	return exists
+}
+
+func (c *BiliCrawler) markDynamicSaved(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.savedDynamicIDs[id] = struct{}{}
+}
+
+func (c *BiliCrawler) isRelationDone(mid string) bool {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	_, exists := c.savedMids[mid]
+	_, exists := c.relationMids[mid]
 	return exists
 }
 
+func (c *BiliCrawler) markRelationDone(mid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.relationMids[mid] = struct{}{}
+}
+
+// midSource returns how an account was discovered
+func (c *BiliCrawler) midSource(mid string) storage.MidSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.userMids[mid]
+}
+
+func (c *BiliCrawler) isMidSaved(mid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.savedMids.Has(mid)
+}
+
 func (c *BiliCrawler) markMidSaved(mid string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.savedMids[mid] = struct{}{}
+	c.savedMids.Add(mid)
 }
 
-func (c *BiliCrawler) searchWorker(threadID int, pagesPerThread int, results chan<- map[string]interface{}, wg *sync.WaitGroup, session *api.Session) {
+func (c *BiliCrawler) searchWorker(threadID int, keyword string, queue *searchQueue, results chan<- *VideoListing, wg *sync.WaitGroup, session *api.Session) {
 	defer wg.Done()
 
-	for page := 1; page <= pagesPerThread; page++ {
-		actualPage := threadID*pagesPerThread + page
-		fmt.Printf("[搜索线程%d] 正在获取第 %d 页...\n", threadID, actualPage)
+	for page, ok := queue.next(); ok; page, ok = queue.next() {
+		if c.isCancelled() {
+			queue.finish(0)
+			continue
+		}
+		if queue.beyond(page) {
+			c.debugf("[搜索线程%d] 第 %d 页超出搜索结果页数，跳过\n", threadID, page)
+			c.progress.searchPage()
+			queue.finish(0)
+			continue
+		}
+		c.debugf("[搜索线程%d] 正在获取第 %d 页...\n", threadID, page)
+
+		settled := false
+		c.recoverTask("search", threadID, nil, func() {
+			result, err := api.SearchVideos(keyword, page, 50, session, c.config.CookieConfigPath)
+			c.recordResult("search", err)
+			if err != nil {
+				settled = true
+				if queue.fail(page) {
+					c.errorf("[搜索线程%d] 第 %d 页错误，稍后重试: %v\n", threadID, page, err)
+					return
+				}
+				c.errorf("[搜索线程%d] 第 %d 页错误: %v\n", threadID, page, err)
+				c.progress.searchPage()
+				return
+			}
 
-		result, err := api.SearchVideos(c.config.Keyword, actualPage, 50, session, c.config.CookieConfigPath)
-		if err != nil {
-			fmt.Printf("[搜索线程%d] 第 %d 页错误: %v\n", threadID, actualPage, err)
-		} else {
 			for _, video := range result.Videos {
-				results <- video
+				results <- newVideoListing(video, keyword)
 			}
-			fmt.Printf("[搜索线程%d] 第 %d 页获取 %d 条视频\n", threadID, actualPage, len(result.Videos))
+			storage.SaveSearchPage(keyword, page, result.NumPages)
+			c.debugf("[搜索线程%d] 第 %d 页获取 %d 条视频\n", threadID, page, len(result.Videos))
+			c.progress.searchPage()
+
+			settled = true
+			if added := queue.finish(result.NumPages); len(added) > 0 {
+				c.logf("关键词 %s 共 %d 页搜索结果，追加爬取 %d 页\n", keyword, result.NumPages, len(added))
+				c.progress.extendSearch(len(added))
+			}
+		})
+		if !settled {
+			c.progress.searchPage()
+			queue.drop()
 		}
 		c.delay()
 	}
 }
 
-func (c *BiliCrawler) videoDetailWorker(threadID int, videos <-chan map[string]interface{}, wg *sync.WaitGroup, session *api.Session) {
+func (c *BiliCrawler) videoDetailWorker(threadID int, videos <-chan *VideoListing, wg *sync.WaitGroup, session *api.Session) {
 	defer wg.Done()
 
 	for video := range videos {
-		bvid, ok := video["bvid"].(string)
-		if !ok {
+		bvid, keyword := video.Bvid, video.Keyword
+		if bvid == "" || c.isCancelled() {
 			continue
 		}
 
-		detail, err := api.GetVideoDetail(bvid, session, c.config.CookieConfigPath)
-		if err != nil {
-			fmt.Printf("[视频线程%d] %s 获取详情失败: %v\n", threadID, bvid, err)
-		} else {
-			detail["topic_keyword"] = c.config.Keyword
+		c.recoverTask("detail", threadID, &storage.FailedTask{Kind: storage.FailedVideo, ID: bvid, Keyword: keyword}, func() {
+			detail, err := api.GetVideoDetail(bvid, session, c.config.CookieConfigPath)
+			c.recordResult("detail", err)
+			if c.isBvidSaved(bvid) && c.recordTombstone(bvid, err) {
+				c.logf("[视频线程%d] %s 已删除或不可见: %v\n", threadID, bvid, err)
+			} else if err != nil {
+				c.errorf("[视频线程%d] %s 获取详情失败: %v\n", threadID, bvid, err)
+				c.recordFailure(storage.FailedTask{Kind: storage.FailedVideo, ID: bvid, Keyword: keyword}, err)
+			} else {
+				c.clearFailure(storage.FailedVideo, bvid)
+				topicKeyword := c.config.Keyword
+				if keyword != "" {
+					topicKeyword = keyword
+				}
+				detail["topic_keyword"] = topicKeyword
+				if video.RelatedFrom != "" {
+					detail["related_from"] = video.RelatedFrom
+					detail["related_depth"] = video.RelatedDepth
+				}
 
-			if err := storage.SaveVideo(detail); err == nil {
-				c.stats.incVideosSaved()
-				c.markBvidSaved(bvid)
+				if c.config.VideoPages {
+					c.addVideoPages(threadID, bvid, detail, session)
+				}
+				if c.config.VideoTags {
+					c.addVideoTags(threadID, bvid, detail, session)
+				}
+				if !c.allowDetailTags(video.Record, detail) {
+					return
+				}
+				if c.config.VideoSubtitles {
+					c.addVideoSubtitles(threadID, bvid, detail, session)
+				}
+				if c.config.VideoOnline {
+					c.addVideoOnline(threadID, bvid, detail, session)
+				}
+				detail, keep := c.applyScript("video", detail)
+				if !keep {
+					c.stats.incVideosFiltered()
+					c.debugf("视频 %s 被脚本过滤\n", bvid)
+					return
+				}
 
-				if owner, ok := detail["owner"].(map[string]interface{}); ok {
-					if mid, ok := owner["mid"]; ok {
-						c.addUserMid(fmt.Sprintf("%v", mid))
+				if err := storage.SaveVideo(detail); err == nil {
+					c.stats.incVideosSaved()
+					c.stats.incKeyword(topicKeyword, func(k *KeywordCounts) { k.Videos++ })
+					c.markBvidSaved(bvid)
+					c.harvestTags(topicKeyword, video.Record)
+
+					if owner, ok := detail["owner"].(map[string]interface{}); ok {
+						if mid := int64Field(owner, "mid"); mid != 0 {
+							key := strconv.FormatInt(mid, 10)
+							c.addUserMid(key, storage.MidSource{Role: storage.MidOwner, Bvid: bvid})
+							c.queueLive(key)
+							c.noteOwner(key)
+						}
 					}
+					c.queueMedia(MediaCover, detail["pic"])
+					task := newVideoTask(detail)
+					c.queueStream(task)
+					c.queueSubtitles(task)
+					c.queueDanmaku(task)
+
+					c.queueVideo(task)
+					c.debugf("[视频线程%d] %s 已保存并推送到评论队列\n", threadID, bvid)
 				}
-
-				c.videoQueue <- &VideoTask{Detail: detail}
-				fmt.Printf("[视频线程%d] %s 已保存并推送到评论队列\n", threadID, bvid)
 			}
-		}
+		})
 		c.delay()
 	}
 }
 
-func (c *BiliCrawler) commentWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
+func (c *BiliCrawler) commentWorker(threadID int, queue <-chan *VideoTask, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
 	defer wg.Done()
 
 	for {
+		if !c.waitTurn("comment", threadID, done) {
+			return
+		}
+
 		select {
 		case <-done:
 			return
-		case task, ok := <-c.videoQueue:
+		case task, ok := <-queue:
 			if !ok {
 				return
 			}
-
-			bvid, _ := task.Detail["bvid"].(string)
-			aid, _ := task.Detail["aid"].(float64)
-			aidInt := int64(aid)
-
-			progress, _ := storage.GetVideoCommentProgress(bvid)
-			if c.config.Resume && progress.Done {
-				fmt.Printf("[评论线程%d] %s 评论已爬完，跳过\n", threadID, bvid)
+			if c.isCancelled() || !c.stageEnabled("comment") {
 				continue
 			}
 
-			if aidInt == 0 {
-				if progress.Aid != 0 {
-					aidInt = progress.Aid
-				} else {
-					var err error
-					aidInt, err = api.GetVideoAid(bvid, session, c.config.CookieConfigPath)
-					if err != nil {
-						fmt.Printf("[评论线程%d] 获取 %s 的aid失败: %v\n", threadID, bvid, err)
-						continue
-					}
-					c.delay()
-				}
-			}
+			c.recoverTask("comment", threadID, &storage.FailedTask{Kind: storage.FailedComment, ID: task.Bvid, Keyword: task.Keyword}, func() {
+				c.crawlVideoComments(threadID, task, session)
+			})
+		}
+	}
+}
 
-			cursor := ""
-			if c.config.Resume {
-				cursor = progress.Cursor
-			}
+// crawlVideoComments crawls the main comments of one video from its saved
+// cursor, queueing replies for the reply stage
+func (c *BiliCrawler) crawlVideoComments(threadID int, task *VideoTask, session *api.Session) {
+	bvid := task.Bvid
 
-			if cursor != "" {
-				fmt.Printf("[评论线程%d] %s (aid=%d) 从游标 %s... 恢复爬取...\n", threadID, bvid, aidInt, truncate(cursor, 20))
-			} else {
-				fmt.Printf("[评论线程%d] %s (aid=%d) 开始爬取评论...\n", threadID, bvid, aidInt)
-			}
+	keyword := task.Keyword
+	if keyword == "" {
+		keyword = c.config.Keyword
+	}
 
-			commentCount := 0
-			for {
-				result, err := api.GetMainComments(aidInt, cursor, session, c.config.CookieConfigPath)
-				if err != nil {
-					fmt.Printf("[评论线程%d] %s 评论获取错误: %v\n", threadID, bvid, err)
-					storage.SaveVideoCommentProgress(bvid, cursor, aidInt)
-					break
-				}
+	progress, _ := storage.GetVideoCommentProgress(bvid)
+	recrawl := c.config.Resume && progress.Done
+	if recrawl && !c.config.RecrawlNewComments {
+		c.debugf("[评论线程%d] %s 评论已爬完，跳过\n", threadID, bvid)
+		c.finishVideo(bvid)
+		return
+	}
 
-				for _, reply := range result.Replies {
-					rpid := fmt.Sprintf("%v", reply["rpid"])
-					if mid, ok := reply["mid"]; ok {
-						c.addUserMid(fmt.Sprintf("%v", mid))
-					}
+	ctx := commentContext{Bvid: bvid, Aid: task.Aid, Title: task.Title, Keyword: keyword}
+	if err := c.completeVideoContext("comment", &ctx, progress, session); err != nil {
+		c.errorf("[评论线程%d] 获取 %s 的视频信息失败: %v\n", threadID, bvid, err)
+		c.recordFailure(storage.FailedTask{Kind: storage.FailedComment, ID: bvid, Aid: ctx.Aid, Title: ctx.Title, Keyword: keyword}, err)
+		return
+	}
+	aidInt := ctx.Aid
+	if recrawl {
+		c.crawlNewComments(threadID, ctx, session)
+		c.finishVideo(bvid)
+		return
+	}
+	if c.config.HotCommentsOnly {
+		c.crawlHotComments(threadID, ctx, session)
+		c.finishVideo(bvid)
+		return
+	}
 
-					if c.config.Resume && c.isRpidSaved(rpid) {
-						c.stats.incCommentsSkipped()
-						if rcount, ok := reply["rcount"].(float64); ok && rcount > 0 {
-							c.commentQueue <- &CommentTask{Aid: aidInt, Comment: reply}
-						}
-						continue
-					}
+	cursor := ""
+	if c.config.Resume {
+		cursor = progress.Cursor
+	}
+	if task.Cursor != "" {
+		cursor = task.Cursor
+	}
 
-					if err := storage.SaveComment(reply); err == nil {
-						c.stats.incCommentsSaved()
-						c.markRpidSaved(rpid)
-						commentCount++
+	if cursor == "" && c.config.CommentSampling.applies(videoReplyCount(task.Detail)) {
+		c.crawlSampledComments(threadID, ctx, session)
+		c.finishVideo(bvid)
+		return
+	}
 
-						if rcount, ok := reply["rcount"].(float64); ok && rcount > 0 {
-							c.commentQueue <- &CommentTask{Aid: aidInt, Comment: reply}
-						}
-					}
-				}
+	c.progress.startVideo(bvid, videoReplyCount(task.Detail))
+	defer c.progress.endVideo(bvid)
 
-				if result.IsEnd || len(result.Replies) == 0 {
-					storage.MarkVideoCommentsDone(bvid)
-					break
-				}
+	if cursor != "" {
+		c.debugf("[评论线程%d] %s (aid=%d) 从游标 %s... 恢复爬取...\n", threadID, bvid, aidInt, truncate(cursor, 20))
+	} else {
+		c.debugf("[评论线程%d] %s (aid=%d) 开始爬取评论...\n", threadID, bvid, aidInt)
+	}
 
-				cursor = result.NextCursor
-				storage.SaveVideoCommentProgress(bvid, cursor, aidInt)
-				c.delay()
+	commentCount := 0
+	// Comments seen, only meaningful for a crawl from the first page
+	seen := 0
+	fromStart := cursor == ""
+	pages := 0
+	deferred := false
+	cfg := c.live()
+	budget := newVideoBudget(cfg.VideoMaxPages, cfg.VideoMaxSeconds, time.Now())
+	for {
+		result, err := c.fetchMainComments(aidInt, cursor, session)
+		c.recordResult("comment", err)
+		if err != nil && c.config.LegacyCommentFallback && isRiskControlled(err) && !isLegacyCursor(cursor) {
+			// Start over on the older API; comments already saved are
+			// deduplicated, and the count of comments seen starts over too, as
+			// the crawl now covers the video from its first page
+			c.logf("[评论线程%d] %s 评论接口被风控 (%v)，改用旧版分页接口\n", threadID, bvid, err)
+			c.stats.incLegacyCommentVideos()
+			cursor = legacyCursorPrefix + "1"
+			seen = 0
+			fromStart = true
+			result, err = c.fetchMainComments(aidInt, cursor, session)
+			c.recordResult("comment", err)
+		}
+		if err != nil {
+			c.errorf("[评论线程%d] %s 评论获取错误: %v\n", threadID, bvid, err)
+			storage.SaveVideoCommentProgress(bvid, cursor, aidInt, ctx.Title)
+			c.recordFailure(storage.FailedTask{Kind: storage.FailedComment, ID: bvid, Aid: aidInt, Title: ctx.Title, Keyword: keyword}, err)
+			break
+		}
+
+		commentCount += c.handleMainComments(markPinned(result.TopReplies), ctx, 0)
+		commentCount += c.handleMainComments(result.Replies, ctx, 0)
+		c.progress.videoPage(bvid)
+		seen += commentCoverage(result.TopReplies) + commentCoverage(result.Replies)
+
+		if result.IsEnd || len(result.Replies) == 0 {
+			storage.MarkVideoCommentsDone(bvid)
+			c.finishVideo(bvid)
+			c.clearFailure(storage.FailedComment, bvid)
+			if c.config.CommentReconcile && fromStart && c.config.CommentSort != CommentSortHot {
+				c.reconcileComments(threadID, ctx, task.Detail, seen, session)
 			}
+			break
+		}
+
+		cursor = result.NextCursor
+		storage.SaveVideoCommentProgress(bvid, cursor, aidInt, ctx.Title)
+		if c.isCancelled() {
+			break
+		}
+		c.delay()
+
+		pages++
+		if budget.exceeded(pages, time.Now()) {
+			c.deferVideo(task, cursor)
+			deferred = true
+			break
+		}
+	}
+
+	if deferred {
+		c.debugf("[评论线程%d] %s 超出单视频预算，已保存游标，本轮 %d 条一级评论，稍后续爬\n", threadID, bvid, commentCount)
+		return
+	}
+	c.debugf("[评论线程%d] %s 爬取完成，共 %d 条一级评论\n", threadID, bvid, commentCount)
+}
+
+// completeVideoContext fills in the aid and title a comment context lacks,
+// first from the video's comment progress and otherwise from its detail, so
+// that no comment is saved without its video
+func (c *BiliCrawler) completeVideoContext(stage string, ctx *commentContext, progress *storage.VideoProgress, session *api.Session) error {
+	if ctx.Aid == 0 {
+		ctx.Aid = progress.Aid
+	}
+	if ctx.Title == "" {
+		ctx.Title = progress.Title
+	}
+	if ctx.Aid != 0 && ctx.Title != "" {
+		return nil
+	}
+
+	detail, err := api.GetVideoDetail(ctx.Bvid, session, c.config.CookieConfigPath)
+	c.recordResult(stage, err)
+	if err != nil {
+		return err
+	}
+	c.delay()
+	if ctx.Aid == 0 {
+		if ctx.Aid = int64Field(detail, "aid"); ctx.Aid == 0 {
+			return fmt.Errorf("aid not found in response")
+		}
+	}
+	if ctx.Title == "" {
+		ctx.Title = videoTitle(detail)
+	}
+	return nil
+}
+
+// handleMainComments filters, enriches and saves one page of main comments
+// and returns how many were saved. Comments with replies are queued for the
+// reply stage with replyPages as their page cap; a negative replyPages
+// queues none. A comment dropped by the comment filter or the script drops
+// its thread, so its replies are not crawled.
+func (c *BiliCrawler) handleMainComments(replies []map[string]interface{}, ctx commentContext, replyPages int) int {
+	queueReplies := func(ids commentIDs) {
+		if ids.Rcount > 0 && replyPages >= 0 {
+			c.commentQueue <- &CommentTask{Aid: ctx.Aid, Bvid: ctx.Bvid, Title: ctx.Title, Keyword: ctx.Keyword, Rpid: ids.Rpid, Rcount: ids.Rcount, MaxPages: replyPages}
+		}
+	}
+
+	saved := 0
+	for _, reply := range replies {
+		ids := newCommentIDs(reply)
+		skipped := c.config.Resume && c.isRpidSaved(ids.key())
+		if !skipped && !c.allowComment(reply, ctx.Bvid) {
+			continue
+		}
+		if ids.Mid != 0 {
+			c.addUserMid(ids.midKey(), storage.MidSource{Role: storage.MidCommenter, Bvid: ctx.Bvid, Rpid: ids.Rpid})
+		}
+
+		if skipped {
+			c.stats.incCommentsSkipped()
+			queueReplies(ids)
+			continue
+		}
 
-			fmt.Printf("[评论线程%d] %s 爬取完成，共 %d 条一级评论\n", threadID, bvid, commentCount)
+		enrichComment(reply, ctx)
+		reply, keep := c.applyScript("comment", reply)
+		if !keep {
+			c.stats.incCommentsFiltered()
+			continue
+		}
+		if err := storage.SaveComment(reply); err == nil {
+			c.stats.incCommentsSaved()
+			c.stats.incKeyword(ctx.Keyword, func(k *KeywordCounts) { k.Comments++ })
+			c.markRpidSaved(ids.key())
+			saved++
+			queueReplies(ids)
 		}
 	}
+	return saved
 }
 
 func (c *BiliCrawler) replyWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
 	defer wg.Done()
 
 	for {
+		if !c.waitTurn("reply", threadID, done) {
+			return
+		}
+
 		select {
 		case <-done:
 			return
@@ -428,58 +1563,81 @@ func (c *BiliCrawler) replyWorker(threadID int, wg *sync.WaitGroup, done <-chan
 			if !ok {
 				return
 			}
+			if !c.stageEnabled("reply") {
+				continue
+			}
+			if c.isCancelled() {
+				c.dropReply(task)
+				continue
+			}
 
-			rpid := int64(task.Comment["rpid"].(float64))
-			rcount := int(task.Comment["rcount"].(float64))
-			fmt.Printf("[回复线程%d] 开始爬取评论 %d 的 %d 条回复...\n", threadID, rpid, rcount)
-
-			page := 1
-			totalFetched := 0
-			for {
-				result, err := api.GetReplyComments(task.Aid, rpid, page, 20, session, c.config.CookieConfigPath)
-				if err != nil {
-					fmt.Printf("[回复线程%d] 评论 %d 回复获取错误: %v\n", threadID, rpid, err)
-					break
-				}
-
-				if len(result.Replies) == 0 {
-					break
-				}
-
-				for _, reply := range result.Replies {
-					replyRpid := fmt.Sprintf("%v", reply["rpid"])
-					if mid, ok := reply["mid"]; ok {
-						c.addUserMid(fmt.Sprintf("%v", mid))
-					}
-
-					if c.config.Resume && c.isRpidSaved(replyRpid) {
-						totalFetched++
-						continue
-					}
-
-					if err := storage.SaveComment(reply); err == nil {
-						c.stats.incRepliesSaved()
-						c.markRpidSaved(replyRpid)
-						totalFetched++
-					}
-				}
-
-				if totalFetched >= result.TotalCount {
-					break
-				}
-				page++
-				c.delay()
+			failed := &storage.FailedTask{
+				Kind:    storage.FailedReply,
+				ID:      strconv.FormatInt(task.Rpid, 10),
+				Aid:     task.Aid,
+				Bvid:    task.Bvid,
+				Title:   task.Title,
+				Keyword: task.Keyword,
 			}
+			c.recoverTask("reply", threadID, failed, func() {
+				c.crawlCommentReplies(threadID, task, session)
+			})
+		}
+	}
+}
+
+// crawlCommentReplies crawls the replies of one main comment
+func (c *BiliCrawler) crawlCommentReplies(threadID int, task *CommentTask, session *api.Session) {
+	rpid := task.Rpid
+	if rpid == 0 {
+		c.errorf("[回复线程%d] 评论ID无效: %v\n", threadID, rpid)
+		return
+	}
+	if task.Title == "" && task.Bvid != "" {
+		// Reply tasks retried from failed_tasks.json may predate titles
+		progress, _ := storage.GetVideoCommentProgress(task.Bvid)
+		ctx := commentContext{Bvid: task.Bvid, Aid: task.Aid}
+		if err := c.completeVideoContext("reply", &ctx, progress, session); err != nil {
+			c.errorf("[回复线程%d] 获取 %s 的视频信息失败: %v\n", threadID, task.Bvid, err)
+			c.recordFailure(storage.FailedTask{Kind: storage.FailedReply, ID: strconv.FormatInt(rpid, 10), Aid: task.Aid, Bvid: task.Bvid, Keyword: task.Keyword}, err)
+			return
+		}
+		resolved := *task
+		resolved.Aid, resolved.Title = ctx.Aid, ctx.Title
+		task = &resolved
+	}
+	rcount := task.Rcount
+	c.debugf("[回复线程%d] 开始爬取评论 %d 的 %d 条回复...\n", threadID, rpid, rcount)
 
-			fmt.Printf("[回复线程%d] 评论 %d 爬取完成，共 %d 条回复\n", threadID, rpid, totalFetched)
+	totalFetched, err := c.crawlReplies(threadID, task, rpid, session)
+	if err != nil {
+		if errors.Is(err, errCancelled) {
+			c.debugf("[回复线程%d] 评论 %d 的回复因取消中断，已处理 %d 条\n", threadID, rpid, totalFetched)
+		} else {
+			c.errorf("[回复线程%d] 评论 %d 回复获取错误: %v\n", threadID, rpid, err)
 		}
+		c.recordFailure(storage.FailedTask{
+			Kind:    storage.FailedReply,
+			ID:      strconv.FormatInt(rpid, 10),
+			Aid:     task.Aid,
+			Bvid:    task.Bvid,
+			Title:   task.Title,
+			Keyword: task.Keyword,
+		}, err)
+	} else {
+		c.clearFailure(storage.FailedReply, strconv.FormatInt(rpid, 10))
 	}
+	c.debugf("[回复线程%d] 评论 %d 爬取完成，共 %d 条回复\n", threadID, rpid, totalFetched)
 }
 
 func (c *BiliCrawler) accountWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
 	defer wg.Done()
 
 	for {
+		if !c.waitTurn("account", threadID, done) {
+			return
+		}
+
 		select {
 		case <-done:
 			return
@@ -487,32 +1645,116 @@ func (c *BiliCrawler) accountWorker(threadID int, wg *sync.WaitGroup, done <-cha
 			if !ok {
 				return
 			}
-
-			if c.config.Resume && c.isMidSaved(mid) {
-				c.stats.incAccountsSkipped()
+			if c.isCancelled() || !c.stageEnabled("account") || !c.drainAllowed() {
 				continue
 			}
 
-			userData, err := api.GetUserCard(mid, session, c.config.CookieConfigPath)
-			if err != nil {
-				fmt.Printf("[用户线程%d] 获取用户 %s 信息失败: %v\n", threadID, mid, err)
-			} else {
-				if err := storage.SaveAccount(userData); err == nil {
-					c.stats.incAccountsSaved()
-					c.markMidSaved(mid)
+			c.recoverTask("account", threadID, &storage.FailedTask{Kind: storage.FailedAccount, ID: mid}, func() {
+				if c.config.Resume && c.isMidSaved(mid) {
+					c.stats.incAccountsSkipped()
+					return
 				}
-			}
-			c.delay()
+
+				userData, err := api.GetUserCard(mid, session, c.config.CookieConfigPath)
+				c.recordResult("account", err)
+				if err != nil {
+					c.errorf("[用户线程%d] 获取用户 %s 信息失败: %v\n", threadID, mid, err)
+					c.recordFailure(storage.FailedTask{Kind: storage.FailedAccount, ID: mid}, err)
+				} else {
+					c.clearFailure(storage.FailedAccount, mid)
+					c.addAccountExtras(threadID, mid, userData, session)
+					enrichAccount(userData, c.midSource(mid))
+					userData, keep := c.applyScript("account", userData)
+					if !keep {
+						c.stats.incAccountsFiltered()
+						c.markMidSaved(mid)
+						return
+					}
+					if err := storage.SaveAccount(userData); err == nil {
+						c.stats.incAccountsSaved()
+						c.markMidSaved(mid)
+						if card, ok := userData["card"].(map[string]interface{}); ok {
+							c.queueMedia(MediaAvatar, card["face"])
+						}
+
+						if c.config.CrawlDynamics {
+							c.dynamicQueue <- mid
+						}
+						if c.config.CrawlRelations {
+							c.relationQueue <- mid
+						}
+						if c.config.CrawlFavorites {
+							c.favoriteQueue <- mid
+						}
+					}
+				}
+				c.delay()
+			})
 		}
 	}
 }
 
 // Run starts the crawler
 func (c *BiliCrawler) Run() {
-	fmt.Printf("关键词: %s\n", c.config.Keyword)
-	fmt.Printf("线程数: %d\n", c.config.NThreads)
-	fmt.Printf("预计搜索视频数: ~%d\n", c.config.NThreads*c.config.PagesPerThread*50)
-	fmt.Printf("断点续传: %s\n", boolToStr(c.config.Resume, "启用", "禁用"))
+	c.run(func() {
+		c.queuePendingVideos()
+		c.crawlTopics()
+		c.crawlUploads()
+		if c.config.Source == SourceRanking {
+			c.crawlRankings()
+		} else {
+			c.searchKeywords()
+		}
+		c.crawlOwnerUploads()
+	})
+}
+
+// CrawlVideos runs the pipeline over the given videos instead of searching
+// keywords
+func (c *BiliCrawler) CrawlVideos(bvids []string) {
+	c.run(func() {
+		c.queuePendingVideos()
+		videos := make([]*VideoListing, 0, len(bvids))
+		for _, bvid := range bvids {
+			videos = append(videos, &VideoListing{Bvid: bvid, Keyword: c.config.Keyword})
+		}
+		c.fetchVideoDetails(videos)
+	})
+}
+
+// searchKeywords searches every keyword, including keywords added while
+// running, and fetches the video details
+func (c *BiliCrawler) searchKeywords() {
+	for keyword, ok := c.nextKeyword(); ok; keyword, ok = c.nextKeyword() {
+		c.searchVideosParallel(keyword)
+		c.searchUsers(keyword)
+		c.searchArticles(keyword)
+		c.expandKeywords(keyword)
+	}
+}
+
+// closeSentRecords writes out and syncs the buffered sent-record IDs
+func (c *BiliCrawler) closeSentRecords() {
+	if err := storage.CloseSentIDs(); err != nil {
+		c.errorf("写入发送记录失败: %v\n", err)
+	}
+}
+
+// run starts the stage workers, lets seed feed the detail and comment stages,
+// then drains every stage in order
+func (c *BiliCrawler) run(seed func()) {
+	defer c.script.close()
+	defer c.closeDedupSets()
+	defer c.closeSentRecords()
+	c.logf("关键词: %s\n", c.config.Keyword)
+	cfg := c.live()
+	c.logf("线程数: %d\n", cfg.NThreads)
+	c.logf("预计搜索视频数: ~%d\n", c.threads("search")*cfg.PagesPerThread*50)
+	c.logf("断点续传: %s\n", boolToStr(c.config.Resume, "启用", "禁用"))
+	if off := c.disabledStages(); len(off) > 0 {
+		c.logf("已关闭的阶段: %s\n", strings.Join(off, ", "))
+	}
+	c.ensureTopics()
 
 	if c.config.Resume && len(c.videoProgress) > 0 {
 		doneCount := 0
@@ -524,17 +1766,17 @@ func (c *BiliCrawler) Run() {
 				inProgressCount++
 			}
 		}
-		fmt.Printf("  - 已完成评论爬取的视频: %d\n", doneCount)
-		fmt.Printf("  - 评论爬取中断的视频: %d\n", inProgressCount)
+		c.logf("  - 已完成评论爬取的视频: %d\n", doneCount)
+		c.logf("  - 评论爬取中断的视频: %d\n", inProgressCount)
 	}
 
 	// Restore pending MIDs
-	if c.config.Resume && c.config.ResumePendingMids {
+	if c.config.Resume && c.config.ResumePendingMids && !c.drainMids {
 		pendingMids, _ := storage.GetPendingMids()
 		restoredCount := 0
-		for mid := range pendingMids {
-			if _, saved := c.savedMids[mid]; !saved {
-				c.userMids[mid] = struct{}{}
+		for mid, source := range pendingMids {
+			if !c.savedMids.Has(mid) {
+				c.userMids[mid] = source
 				select {
 				case c.userMidQueue <- mid:
 					restoredCount++
@@ -543,137 +1785,448 @@ func (c *BiliCrawler) Run() {
 			}
 		}
 		if restoredCount > 0 {
-			fmt.Printf("  - 已恢复 %d 个待爬取的用户mid\n", restoredCount)
+			c.logf("  - 已恢复 %d 个待爬取的用户mid\n", restoredCount)
 		}
 	}
 
+	c.health.start(time.Now())
+	cookie.GetCookiePool(c.config.CookieConfigPath).ResetUsage()
+
+	// Stop once max_runtime or max_requests is used up
+	budgetStop := make(chan struct{})
+	defer close(budgetStop)
+	go c.watchRunBudget(budgetStop)
+
+	// Publish heartbeats to claw_run_stats
+	runStatsStop := make(chan struct{})
+	defer close(runStatsStop)
+	go c.watchRunStats(runStatsStop)
+
+	// Rebuild sessions or abort once nothing is saved or succeeds any more
+	stallStop := make(chan struct{})
+	defer close(stallStop)
+	go c.watchStall(stallStop)
+
+	// Pause or slow down during quiet hours
+	quietStop := make(chan struct{})
+	defer close(quietStop)
+	go c.watchQuietHours(quietStop)
+
+	// Redraw the progress line of search and comment pages
+	progressStop := make(chan struct{})
+	defer close(progressStop)
+	go c.watchProgress(progressStop)
+
+	// Adjust worker counts and delays from queue depths and error rates
+	tuneStop := make(chan struct{})
+	defer close(tuneStop)
+	go c.watchAutoTune(tuneStop)
+
 	// Start workers
 	commentDone := make(chan struct{})
 	replyDone := make(chan struct{})
 	accountDone := make(chan struct{})
+	dynamicDone := make(chan struct{})
+	relationDone := make(chan struct{})
+	favoriteDone := make(chan struct{})
 
-	var commentWg, replyWg, accountWg sync.WaitGroup
+	var commentWg, replyWg, accountWg, dynamicWg, relationWg, favoriteWg sync.WaitGroup
 
 	// Start comment workers
-	for i := 0; i < c.config.NThreads; i++ {
+	for i := 0; i < c.workerSlots("comment"); i++ {
 		commentWg.Add(1)
-		session := api.NewSession(c.config.CookieConfigPath)
-		go c.commentWorker(i, &commentWg, commentDone, session)
+		session := c.newSession()
+		go c.commentWorker(i, c.videoQueue, &commentWg, commentDone, session)
 	}
 
 	// Start reply workers
-	for i := 0; i < c.config.NThreads; i++ {
+	for i := 0; i < c.workerSlots("reply"); i++ {
 		replyWg.Add(1)
-		session := api.NewSession(c.config.CookieConfigPath)
+		session := c.newSession()
 		go c.replyWorker(i, &replyWg, replyDone, session)
 	}
 
 	// Start account workers
-	for i := 0; i < c.config.NThreads; i++ {
+	for i := 0; i < c.workerSlots("account"); i++ {
 		accountWg.Add(1)
-		session := api.NewSession(c.config.CookieConfigPath)
+		session := c.newSession()
 		go c.accountWorker(i, &accountWg, accountDone, session)
 	}
 
-	// Search and fetch video details
-	c.searchVideosParallel()
+	// Start dynamics workers
+	if c.config.CrawlDynamics {
+		for i := 0; i < c.workerSlots("dynamic"); i++ {
+			dynamicWg.Add(1)
+			session := c.newSession()
+			go c.dynamicWorker(i, &dynamicWg, dynamicDone, session)
+		}
+	}
+
+	// Start relation workers
+	if c.config.CrawlRelations {
+		for i := 0; i < c.workerSlots("relation"); i++ {
+			relationWg.Add(1)
+			session := c.newSession()
+			go c.relationWorker(i, &relationWg, relationDone, session)
+		}
+	}
+
+	// Start favorite workers
+	if c.config.CrawlFavorites {
+		for i := 0; i < c.threads("favorite"); i++ {
+			favoriteWg.Add(1)
+			session := c.newSession()
+			go c.favoriteWorker(i, &favoriteWg, favoriteDone, session)
+		}
+	}
+
+	// Start media workers
+	mediaDone := make(chan struct{})
+	var mediaWg sync.WaitGroup
+	if c.config.DownloadMedia {
+		for i := 0; i < c.threads("media"); i++ {
+			mediaWg.Add(1)
+			go c.mediaWorker(i, &mediaWg, mediaDone)
+		}
+	}
+
+	// Start stream workers
+	streamDone := make(chan struct{})
+	var streamWg sync.WaitGroup
+	if c.config.DownloadStreams {
+		for i := 0; i < c.threads("stream"); i++ {
+			streamWg.Add(1)
+			session := c.newSession()
+			go c.streamWorker(i, &streamWg, streamDone, session)
+		}
+	}
+
+	// Start live workers
+	liveDone := make(chan struct{})
+	var liveWg sync.WaitGroup
+	if c.config.CrawlLive {
+		for i := 0; i < c.threads("live"); i++ {
+			liveWg.Add(1)
+			session := c.newSession()
+			go c.liveWorker(i, &liveWg, liveDone, session)
+		}
+	}
+
+	// Start subtitle workers
+	subtitleDone := make(chan struct{})
+	var subtitleWg sync.WaitGroup
+	if c.config.CrawlSubtitles {
+		for i := 0; i < c.threads("subtitle"); i++ {
+			subtitleWg.Add(1)
+			session := c.newSession()
+			go c.subtitleWorker(i, &subtitleWg, subtitleDone, session)
+		}
+	}
+
+	// Start danmaku workers
+	danmakuDone := make(chan struct{})
+	var danmakuWg sync.WaitGroup
+	if c.config.CrawlDanmaku {
+		for i := 0; i < c.threads("danmaku"); i++ {
+			danmakuWg.Add(1)
+			session := c.newSession()
+			go c.danmakuWorker(i, &danmakuWg, danmakuDone, session)
+		}
+	}
+
+	// Start article workers
+	articleDone := make(chan struct{})
+	var articleWg sync.WaitGroup
+	if c.config.CrawlArticles {
+		for i := 0; i < c.threads("article"); i++ {
+			articleWg.Add(1)
+			session := c.newSession()
+			go c.articleWorker(i, &articleWg, articleDone, session)
+		}
+	}
+
+	c.debugf("已创建 %d 个共享会话\n", c.sessions.Len())
+
+	// Continue the reply threads a cancelled run left unfinished
+	if c.config.Resume && c.stageEnabled("reply") {
+		c.queueCancelledReplies()
+	}
+
+	// Search (or re-queue failed tasks) and fetch video details
+	seed()
 
 	// Wait for video queue to be processed
 	close(c.videoQueue)
+	c.closeStage("comment")
 	commentWg.Wait()
-	fmt.Printf("一级评论爬取完成，共保存 %d 条\n", c.stats.CommentsSaved)
+	c.revisitDeferred(commentDone)
+	c.logf("一级评论爬取完成，共保存 %d 条\n", c.stats.CommentsSaved)
 
 	// Signal comment workers done, wait for reply workers
 	close(commentDone)
 	close(c.commentQueue)
+	c.closeStage("reply")
 	replyWg.Wait()
-	fmt.Printf("二级评论爬取完成，共保存 %d 条\n", c.stats.RepliesSaved)
+	c.checkpointDroppedReplies()
+	c.logf("二级评论爬取完成，共保存 %d 条\n", c.stats.RepliesSaved)
 
 	// Signal reply workers done, wait for account workers
 	close(replyDone)
 	close(c.userMidQueue)
+	c.closeStage("account")
+	c.drain.Store(newDrainLimit(c.config, time.Now()))
 	accountWg.Wait()
-	fmt.Printf("用户信息爬取完成，共保存 %d 个\n", c.stats.AccountsSaved)
+	c.logf("用户信息爬取完成，共保存 %d 个\n", c.stats.AccountsSaved)
 
+	// Signal account workers done, wait for dynamics, relation and favorite workers
 	close(accountDone)
+	close(c.dynamicQueue)
+	close(c.relationQueue)
+	close(c.favoriteQueue)
+	c.closeStage("dynamic")
+	c.closeStage("relation")
+	c.closeStage("favorite")
+	dynamicWg.Wait()
+	if c.config.CrawlDynamics {
+		c.logf("用户动态爬取完成，共保存 %d 条\n", c.stats.DynamicsSaved)
+		if c.config.DynamicComments {
+			c.logf("动态评论爬取完成，共保存 %d 条\n", c.stats.DynamicCommentsSaved)
+		}
+	}
+	relationWg.Wait()
+	if c.config.CrawlRelations {
+		c.logf("用户关系爬取完成，共保存 %d 条\n", c.stats.RelationsSaved)
+	}
+	favoriteWg.Wait()
+	if c.config.CrawlFavorites {
+		c.logf("用户收藏爬取完成，共保存 %d 条\n", c.stats.FavoritesSaved)
+	}
+
+	close(dynamicDone)
+	close(relationDone)
+	close(favoriteDone)
+
+	// Live rooms, subtitles and streams are queued by the detail stage
+	close(c.liveQueue)
+	c.closeStage("live")
+	liveWg.Wait()
+	close(liveDone)
+	if c.config.CrawlLive {
+		c.logf("直播间信息爬取完成，共保存 %d 个\n", c.stats.LiveSaved)
+	}
+
+	close(c.subtitleQueue)
+	c.closeStage("subtitle")
+	subtitleWg.Wait()
+	close(subtitleDone)
+	if c.config.CrawlSubtitles {
+		c.logf("字幕爬取完成，共保存 %d 条\n", c.stats.SubtitlesSaved)
+	}
+
+	close(c.danmakuQueue)
+	c.closeStage("danmaku")
+	danmakuWg.Wait()
+	close(danmakuDone)
+	if c.config.CrawlDanmaku {
+		c.logf("弹幕爬取完成，共保存 %d 条\n", c.stats.DanmakuSaved)
+	}
+
+	close(c.articleQueue)
+	c.closeStage("article")
+	articleWg.Wait()
+	close(articleDone)
+	if c.config.CrawlArticles {
+		c.logf("专栏爬取完成，共保存 %d 篇\n", c.stats.ArticlesSaved)
+	}
+
+	close(c.streamQueue)
+	c.closeStage("stream")
+	streamWg.Wait()
+	close(streamDone)
+	if c.config.DownloadStreams {
+		c.logf("音视频下载完成，共保存 %d 个视频\n", c.stats.StreamsSaved)
+	}
+
+	// Covers and avatars are queued by the detail and account stages
+	close(c.mediaQueue)
+	c.closeStage("media")
+	mediaWg.Wait()
+	close(mediaDone)
+	if c.config.DownloadMedia {
+		c.logf("封面和头像下载完成，共保存 %d 个\n", c.stats.MediaSaved)
+	}
 
 	// Print final stats
-	fmt.Printf("保存视频数: %d\n", c.stats.VideosSaved)
+	c.summaryf("保存视频数: %d\n", c.stats.VideosSaved)
 	if c.stats.VideosSkipped > 0 {
-		fmt.Printf("跳过视频数（已存在）: %d\n", c.stats.VideosSkipped)
+		c.summaryf("跳过视频数（已存在）: %d\n", c.stats.VideosSkipped)
 	}
-	fmt.Printf("保存一级评论数: %d\n", c.stats.CommentsSaved)
+	c.summaryf("保存一级评论数: %d\n", c.stats.CommentsSaved)
 	if c.stats.CommentsSkipped > 0 {
-		fmt.Printf("跳过评论数（已存在）: %d\n", c.stats.CommentsSkipped)
+		c.summaryf("跳过评论数（已存在）: %d\n", c.stats.CommentsSkipped)
 	}
-	fmt.Printf("保存二级评论数: %d\n", c.stats.RepliesSaved)
-	fmt.Printf("总评论数: %d\n", c.stats.CommentsSaved+c.stats.RepliesSaved)
-	fmt.Printf("保存用户数: %d\n", c.stats.AccountsSaved)
+	c.summaryf("保存二级评论数: %d\n", c.stats.RepliesSaved)
+	c.summaryf("总评论数: %d\n", c.stats.CommentsSaved+c.stats.RepliesSaved)
+	c.summaryf("保存用户数: %d\n", c.stats.AccountsSaved)
 	if c.stats.AccountsSkipped > 0 {
-		fmt.Printf("跳过用户数（已存在）: %d\n", c.stats.AccountsSkipped)
+		c.summaryf("跳过用户数（已存在）: %d\n", c.stats.AccountsSkipped)
+	}
+	if c.config.CrawlDynamics {
+		c.summaryf("保存用户动态数: %d\n", c.stats.DynamicsSaved)
+	}
+	if c.config.CrawlRelations {
+		c.summaryf("保存用户关系数: %d\n", c.stats.RelationsSaved)
+	}
+	if c.config.CrawlFavorites {
+		c.summaryf("保存用户收藏数: %d\n", c.stats.FavoritesSaved)
+	}
+	if recycled := c.sessions.Recycled(); recycled > 0 {
+		c.logf("会话因 Cookie 失效更换次数: %d\n", recycled)
+	}
+	if retired := c.sessions.Retired(); retired > 0 {
+		c.logf("会话到期更换次数: %d\n", retired)
+	}
+	if noise := c.sessions.Noise(); noise > 0 {
+		c.logf("浏览噪声请求数: %d\n", noise)
 	}
 
 	// Clean up pending MIDs
+	remaining := c.savePendingMids()
+	if remaining > 0 {
+		c.summaryf("剩余未爬取用户数: %d\n", remaining)
+	} else {
+		c.summaryf("所有用户信息已爬取完成，pending_mids已清理\n")
+	}
+	if remaining := c.savePendingBvids(); remaining > 0 {
+		c.summaryf("剩余未爬完评论的视频数: %d\n", remaining)
+	}
+
+	if aborted := c.abortedWith(); aborted != nil {
+		c.markFinished()
+		c.finish(aborted.code, aborted.reason)
+		return
+	}
+	if c.isCancelled() {
+		c.summaryf("爬取已取消\n")
+		c.markFinished()
+		c.finish(ExitCancelled, "爬取被取消，未完成的任务已保存断点")
+		return
+	}
+	reason := ""
+	if c.drainReached() {
+		reason = fmt.Sprintf("用户信息收尾达到上限，剩余 %d 个用户留待下次运行", remaining)
+		c.summaryf("%s\n", reason)
+	}
+	c.markFinished()
+	c.finish(c.completionCode(), reason)
+}
+
+// stageEnabled reports whether a core stage is switched on. Stages without a
+// switch are always on.
+func (c *BiliCrawler) stageEnabled(stage string) bool {
+	switch stage {
+	case "comment":
+		return c.config.CrawlComments
+	case "reply":
+		return c.config.CrawlReplies
+	case "account":
+		return c.config.CrawlAccounts
+	}
+	return true
+}
+
+// disabledStages lists the core stages switched off
+func (c *BiliCrawler) disabledStages() []string {
+	var off []string
+	for _, stage := range []string{"comment", "reply", "account"} {
+		if !c.stageEnabled(stage) {
+			off = append(off, stage)
+		}
+	}
+	return off
+}
+
+// savePendingMids rewrites pending_mids with the discovered users that have
+// not been saved yet and returns how many remain
+func (c *BiliCrawler) savePendingMids() int {
 	c.mu.Lock()
-	remainingMids := make(map[string]struct{})
-	for mid := range c.userMids {
-		if _, saved := c.savedMids[mid]; !saved {
-			remainingMids[mid] = struct{}{}
+	remainingMids := make(map[string]storage.MidSource)
+	for mid, source := range c.userMids {
+		if !c.savedMids.Has(mid) {
+			remainingMids[mid] = source
 		}
 	}
 	c.mu.Unlock()
 
 	storage.UpdatePendingMids(remainingMids)
-	if len(remainingMids) > 0 {
-		fmt.Printf("剩余未爬取用户数: %d\n", len(remainingMids))
-	} else {
-		fmt.Println("所有用户信息已爬取完成，pending_mids已清理")
-	}
+	return len(remainingMids)
 }
 
-func (c *BiliCrawler) searchVideosParallel() {
-	fmt.Printf("搜索视频 (关键词: %s)\n", c.config.Keyword)
+func (c *BiliCrawler) searchVideosParallel(keyword string) {
+	c.searchVideos(keyword, c.threads("search")*c.live().PagesPerThread, true)
+}
 
-	// Collect search results
-	resultsChan := make(chan map[string]interface{}, c.config.NThreads*c.config.PagesPerThread*50)
-	var searchWg sync.WaitGroup
+// searchVideos searches pageCount result pages of a keyword, extending past
+// them by search_extend_pages if extend is set, and fetches the details of
+// the videos found. It reports whether every result page was fetched.
+func (c *BiliCrawler) searchVideos(keyword string, pageCount int, extend bool) bool {
+	c.logf("搜索视频 (关键词: %s)\n", keyword)
 
-	for i := 0; i < c.config.NThreads; i++ {
-		searchWg.Add(1)
-		session := api.NewSession(c.config.CookieConfigPath)
-		go c.searchWorker(i, c.config.PagesPerThread, resultsChan, &searchWg, session)
+	cfg := c.live()
+	progress := &storage.SearchProgress{}
+	if c.config.Resume {
+		progress, _ = storage.GetSearchProgress(keyword)
+		if len(progress.Pages) > 0 {
+			c.logf("关键词 %s 已爬取 %d 页搜索结果，从未爬取的页继续\n", keyword, len(progress.Pages))
+		}
 	}
+	pages := planSearchPages(progress, cfg.SearchRefreshPages, pageCount)
+	c.progress.startSearch(keyword, len(pages))
+
+	// Collect search results
+	resultsChan := make(chan *VideoListing, len(pages)*50)
+	queue := newSearchQueue(pages, func(numPages int) []int {
+		if !extend {
+			return nil
+		}
+		return extendSearchPages(progress, pages, numPages, c.live().SearchExtendPages)
+	})
 
 	// Wait for search to complete and close results channel
 	go func() {
-		searchWg.Wait()
+		c.searchPages(keyword, queue, resultsChan)
 		close(resultsChan)
 	}()
 
 	// Deduplicate results
 	seenBvids := make(map[string]struct{})
-	var uniqueVideos []map[string]interface{}
+	var uniqueVideos []*VideoListing
 
 	for video := range resultsChan {
-		bvid, ok := video["bvid"].(string)
-		if !ok || bvid == "" {
+		bvid := video.Bvid
+		if bvid == "" {
 			continue
 		}
 		if _, seen := seenBvids[bvid]; !seen {
 			seenBvids[bvid] = struct{}{}
-			uniqueVideos = append(uniqueVideos, video)
+			if !c.claimSearchResult(bvid) {
+				c.stats.incVideosDeduped()
+				continue
+			}
+			if c.allowVideo(video.Record) {
+				uniqueVideos = append(uniqueVideos, video)
+			}
 		}
 	}
 
 	// Filter out already saved videos in resume mode
-	if c.config.Resume && len(c.savedBvids) > 0 {
+	if c.config.Resume && c.savedBvids.Len() > 0 {
 		beforeCount := len(uniqueVideos)
-		var newVideos []map[string]interface{}
+		var newVideos []*VideoListing
 		for _, v := range uniqueVideos {
-			bvid := v["bvid"].(string)
-			if _, saved := c.savedBvids[bvid]; saved {
+			if c.isBvidSaved(v.Bvid) {
 				// Push to video queue for comment crawling
-				c.videoQueue <- &VideoTask{Detail: v}
+				c.queueVideo(v.task())
 			} else {
 				newVideos = append(newVideos, v)
 			}
@@ -681,28 +2234,50 @@ func (c *BiliCrawler) searchVideosParallel() {
 		uniqueVideos = newVideos
 		skipped := beforeCount - len(uniqueVideos)
 		if skipped > 0 {
-			c.stats.VideosSkipped = skipped
+			c.stats.addVideosSkipped(skipped)
 		}
 	}
 
-	fmt.Printf("共 %d 个新视频\n", len(uniqueVideos))
+	c.logf("共 %d 个新视频\n", len(uniqueVideos))
 
 	if len(uniqueVideos) == 0 {
-		fmt.Println("没有新视频需要获取详情")
-		return
+		c.logf("没有新视频需要获取详情\n")
+	} else {
+		c.fetchVideoDetails(uniqueVideos)
 	}
 
-	// Distribute videos to detail workers
-	videoChan := make(chan map[string]interface{}, len(uniqueVideos))
+	if cfg.RelatedDepth > 0 {
+		seeds := make([]string, 0, len(seenBvids))
+		for bvid := range seenBvids {
+			seeds = append(seeds, bvid)
+		}
+		c.expandRelated(keyword, seeds, seenBvids)
+	}
+	return queue.complete()
+}
+
+// searchPages runs the search workers over a page queue and waits for them
+func (c *BiliCrawler) searchPages(keyword string, queue *searchQueue, results chan<- *VideoListing) {
+	var wg sync.WaitGroup
+	for i := 0; i < c.threads("search"); i++ {
+		wg.Add(1)
+		go c.searchWorker(i, keyword, queue, results, &wg, c.newSession())
+	}
+	wg.Wait()
+}
+
+// fetchVideoDetails distributes videos to detail workers and waits for them
+func (c *BiliCrawler) fetchVideoDetails(uniqueVideos []*VideoListing) {
+	videoChan := make(chan *VideoListing, len(uniqueVideos))
 	for _, v := range uniqueVideos {
 		videoChan <- v
 	}
 	close(videoChan)
 
 	var detailWg sync.WaitGroup
-	for i := 0; i < c.config.NThreads; i++ {
+	for i := 0; i < c.threads("detail"); i++ {
 		detailWg.Add(1)
-		session := api.NewSession(c.config.CookieConfigPath)
+		session := c.newSession()
 		go c.videoDetailWorker(i, videoChan, &detailWg, session)
 	}
 
@@ -1,10 +1,14 @@
 package crawler
 
 import (
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
+
+	"spider-go/storage"
 )
 
 func TestStats_Concurrent(t *testing.T) {
@@ -125,30 +129,37 @@ func TestLoadConfig_InvalidJSON(t *testing.T) {
 }
 
 func TestBiliCrawler_AddUserMid(t *testing.T) {
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+
 	config := DefaultConfig()
 	config.Resume = false
 
 	crawler := &BiliCrawler{
 		config:       config,
 		userMidQueue: make(chan string, 10),
-		userMids:     make(map[string]struct{}),
-		savedMids:    make(map[string]struct{}),
+		userMids:     make(map[string]storage.MidSource),
+		savedMids:    newDedupSet(0, ""),
 	}
 
 	// Add first MID
-	crawler.addUserMid("123")
+	owner := storage.MidSource{Role: storage.MidOwner, Bvid: "BV1"}
+	crawler.addUserMid("123", owner)
 	if len(crawler.userMids) != 1 {
 		t.Errorf("Expected 1 MID, got %d", len(crawler.userMids))
 	}
 
-	// Add same MID again (should be deduplicated)
-	crawler.addUserMid("123")
+	// Add same MID again (should be deduplicated, keeping the first source)
+	crawler.addUserMid("123", storage.MidSource{Role: storage.MidCommenter, Bvid: "BV2", Rpid: 7})
 	if len(crawler.userMids) != 1 {
 		t.Errorf("Expected 1 MID after duplicate, got %d", len(crawler.userMids))
 	}
+	if crawler.midSource("123") != owner {
+		t.Errorf("midSource = %+v, expected the first discovery %+v", crawler.midSource("123"), owner)
+	}
 
 	// Add different MID
-	crawler.addUserMid("456")
+	crawler.addUserMid("456", storage.MidSource{})
 	if len(crawler.userMids) != 2 {
 		t.Errorf("Expected 2 MIDs, got %d", len(crawler.userMids))
 	}
@@ -156,7 +167,7 @@ func TestBiliCrawler_AddUserMid(t *testing.T) {
 
 func TestBiliCrawler_BvidTracking(t *testing.T) {
 	crawler := &BiliCrawler{
-		savedBvids: make(map[string]struct{}),
+		savedBvids: newDedupSet(0, ""),
 		mu:         sync.Mutex{},
 	}
 
@@ -176,7 +187,7 @@ func TestBiliCrawler_BvidTracking(t *testing.T) {
 
 func TestBiliCrawler_RpidTracking(t *testing.T) {
 	crawler := &BiliCrawler{
-		savedRpids: make(map[string]struct{}),
+		savedRpids: newDedupSet(0, ""),
 		mu:         sync.Mutex{},
 	}
 
@@ -196,7 +207,7 @@ func TestBiliCrawler_RpidTracking(t *testing.T) {
 
 func TestBiliCrawler_MidTracking(t *testing.T) {
 	crawler := &BiliCrawler{
-		savedMids: make(map[string]struct{}),
+		savedMids: newDedupSet(0, ""),
 		mu:        sync.Mutex{},
 	}
 
@@ -246,12 +257,17 @@ func TestBoolToStr(t *testing.T) {
 
 func TestVideoTask(t *testing.T) {
 	task := &VideoTask{
+		Bvid:  "BV123",
+		Title: "Test Video",
 		Detail: map[string]interface{}{
 			"bvid":  "BV123",
 			"title": "Test Video",
 		},
 	}
 
+	if task.Bvid != "BV123" || task.Title != "Test Video" {
+		t.Error("VideoTask should store its IDs correctly")
+	}
 	if task.Detail["bvid"] != "BV123" {
 		t.Error("VideoTask should store detail correctly")
 	}
@@ -259,18 +275,16 @@ func TestVideoTask(t *testing.T) {
 
 func TestCommentTask(t *testing.T) {
 	task := &CommentTask{
-		Aid: 12345,
-		Comment: map[string]interface{}{
-			"rpid":    float64(67890),
-			"content": "Test comment",
-		},
+		Aid:    12345,
+		Rpid:   67890,
+		Rcount: 3,
 	}
 
 	if task.Aid != 12345 {
 		t.Error("CommentTask should store Aid correctly")
 	}
-	if task.Comment["rpid"] != float64(67890) {
-		t.Error("CommentTask should store Comment correctly")
+	if task.Rpid != 67890 || task.Rcount != 3 {
+		t.Error("CommentTask should store the comment correctly")
 	}
 }
 
@@ -279,19 +293,19 @@ func TestChannelCommunication(t *testing.T) {
 	commentQueue := make(chan *CommentTask, 10)
 
 	// Test video queue
-	videoQueue <- &VideoTask{Detail: map[string]interface{}{"bvid": "BV1"}}
-	videoQueue <- &VideoTask{Detail: map[string]interface{}{"bvid": "BV2"}}
+	videoQueue <- &VideoTask{Bvid: "BV1"}
+	videoQueue <- &VideoTask{Bvid: "BV2"}
 
 	task1 := <-videoQueue
 	task2 := <-videoQueue
 
-	if task1.Detail["bvid"] != "BV1" || task2.Detail["bvid"] != "BV2" {
+	if task1.Bvid != "BV1" || task2.Bvid != "BV2" {
 		t.Error("Video queue should maintain order")
 	}
 
 	// Test comment queue
-	commentQueue <- &CommentTask{Aid: 1, Comment: map[string]interface{}{"rpid": float64(1)}}
-	commentQueue <- &CommentTask{Aid: 2, Comment: map[string]interface{}{"rpid": float64(2)}}
+	commentQueue <- &CommentTask{Aid: 1, Rpid: 1}
+	commentQueue <- &CommentTask{Aid: 2, Rpid: 2}
 
 	ct1 := <-commentQueue
 	ct2 := <-commentQueue
@@ -300,3 +314,107 @@ func TestChannelCommunication(t *testing.T) {
 		t.Error("Comment queue should maintain order")
 	}
 }
+
+func TestBiliCrawler_ClaimSearchResult(t *testing.T) {
+	storage.SetRecordDir(t.TempDir())
+
+	crawler := &BiliCrawler{
+		savedBvids:      dedupSetOf("BV_DONE", "BV_PARTIAL"),
+		seenSearchBvids: map[string]struct{}{"BV_DONE": {}, "BV_PARTIAL": {}, "BV_UNSAVED": {}},
+		runSearchBvids:  make(map[string]struct{}),
+		videoProgress: map[string]*storage.VideoProgress{
+			"BV_DONE":    {Done: true},
+			"BV_PARTIAL": {Cursor: "abc"},
+		},
+	}
+
+	// Seen in a previous run with comments done: not pushed again
+	if crawler.claimSearchResult("BV_DONE") {
+		t.Error("BV_DONE should not be claimed")
+	}
+	// Seen before but comment crawl unfinished or never saved: pushed again
+	if !crawler.claimSearchResult("BV_PARTIAL") {
+		t.Error("BV_PARTIAL should be claimed")
+	}
+	if !crawler.claimSearchResult("BV_UNSAVED") {
+		t.Error("BV_UNSAVED should be claimed")
+	}
+
+	// New video is claimed once per run
+	if !crawler.claimSearchResult("BV_NEW") {
+		t.Error("BV_NEW should be claimed the first time")
+	}
+	if crawler.claimSearchResult("BV_NEW") {
+		t.Error("BV_NEW should not be claimed twice in one run")
+	}
+
+	seen, _ := storage.GetSeenSearchBvids()
+	if _, ok := seen["BV_NEW"]; !ok {
+		t.Error("BV_NEW should be persisted as seen")
+	}
+}
+
+func TestBiliCrawler_FailedTasks(t *testing.T) {
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+
+	c := &BiliCrawler{failedTasks: make(map[string]struct{})}
+	c.SetLogOutput(io.Discard)
+
+	c.recordFailure(storage.FailedTask{Kind: storage.FailedVideo, ID: "BV1"}, fmt.Errorf("timeout"))
+	c.recordFailure(storage.FailedTask{Kind: storage.FailedAccount, ID: "42"}, fmt.Errorf("-352"))
+
+	tasks, _ := storage.GetFailedTasks()
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 failed tasks, got %d", len(tasks))
+	}
+
+	c.clearFailure(storage.FailedVideo, "BV1")
+	c.clearFailure(storage.FailedVideo, "BV2")
+
+	tasks, _ = storage.GetFailedTasks()
+	if len(tasks) != 1 || tasks[0].Kind != storage.FailedAccount || tasks[0].Error != "-352" {
+		t.Errorf("Expected only the account failure left, got %+v", tasks)
+	}
+}
+
+func TestBiliCrawler_StageEnabled(t *testing.T) {
+	c := &BiliCrawler{config: DefaultConfig()}
+	if off := c.disabledStages(); len(off) != 0 {
+		t.Errorf("All core stages should be on by default, got %v off", off)
+	}
+
+	c.config.CrawlReplies = false
+	c.config.CrawlAccounts = false
+	if !c.stageEnabled("comment") || c.stageEnabled("reply") || c.stageEnabled("account") {
+		t.Error("stageEnabled should follow the stage switches")
+	}
+	if !c.stageEnabled("dynamic") {
+		t.Error("Stages without a switch should always be on")
+	}
+	if off := c.disabledStages(); len(off) != 2 || off[0] != "reply" || off[1] != "account" {
+		t.Errorf("disabledStages = %v, expected [reply account]", off)
+	}
+}
+
+func TestBiliCrawler_CompleteVideoContext(t *testing.T) {
+	c := &BiliCrawler{}
+	ctx := commentContext{Bvid: "BV1", Keyword: "k"}
+	progress := &storage.VideoProgress{Aid: 1, Title: "标题"}
+
+	// Both known from the progress: no request is made (the nil session
+	// would fail one)
+	if err := c.completeVideoContext("comment", &ctx, progress, nil); err != nil {
+		t.Fatalf("completeVideoContext() error = %v", err)
+	}
+	if ctx.Aid != 1 || ctx.Title != "标题" || ctx.Keyword != "k" {
+		t.Errorf("ctx = %+v, expected the aid and title from the progress", ctx)
+	}
+
+	// Values the task carried win over the progress
+	ctx = commentContext{Bvid: "BV1", Aid: 2, Title: "新标题"}
+	c.completeVideoContext("comment", &ctx, progress, nil)
+	if ctx.Aid != 2 || ctx.Title != "新标题" {
+		t.Errorf("ctx = %+v, expected the task's own aid and title", ctx)
+	}
+}
@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// queueDanmaku hands a saved video to the danmaku stage
+func (c *BiliCrawler) queueDanmaku(task *VideoTask) {
+	if c.config.CrawlDanmaku {
+		c.danmakuQueue <- task
+	}
+}
+
+// danmakuRecord builds the claw_danmaku record of one danmaku of a video
+// page
+func danmakuRecord(task *VideoTask, cid int64, d api.Danmaku) map[string]interface{} {
+	return map[string]interface{}{
+		"bvid":          task.Bvid,
+		"aid":           task.Aid,
+		"cid":           cid,
+		"topic_keyword": task.Keyword,
+		"dmid":          d.ID,
+		"progress":      d.Progress,
+		"mode":          d.Mode,
+		"fontsize":      d.FontSize,
+		"color":         d.Color,
+		"ctime":         d.Ctime,
+		"pool":          d.Pool,
+		"mid_hash":      d.MidHash,
+		"weight":        d.Weight,
+		"content":       d.Content,
+	}
+}
+
+// crawlDanmaku saves the danmaku of a video's pages (see taskPages) and
+// returns how many were saved. A failed page does not stop the rest; the
+// error names every page that failed.
+func (c *BiliCrawler) crawlDanmaku(task *VideoTask, session *api.Session) (int, error) {
+	pages := c.taskPages(task)
+	if task.Bvid == "" || len(pages) == 0 {
+		return 0, fmt.Errorf("video detail has no bvid or cid")
+	}
+
+	saved := 0
+	var errs []error
+	for _, page := range pages {
+		n, err := c.crawlDanmakuPage(task, page.Cid, session)
+		saved += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("P%d: %w", page.Page, err))
+		}
+	}
+	return saved, errors.Join(errs...)
+}
+
+// crawlDanmakuPage saves the danmaku of one page of a video. A page is
+// recorded once all of its danmaku are saved, so an interrupted page is
+// fetched again in full.
+func (c *BiliCrawler) crawlDanmakuPage(task *VideoTask, cid int64, session *api.Session) (int, error) {
+	if c.isDanmakuCrawled(cid) {
+		return 0, nil
+	}
+
+	danmaku, err := api.GetDanmaku(cid, session)
+	c.recordResult("danmaku", err)
+	if err != nil {
+		return 0, err
+	}
+
+	saved := 0
+	for _, d := range danmaku {
+		if err := storage.SaveDanmaku(danmakuRecord(task, cid, d)); err != nil {
+			c.stats.addDanmakuSaved(saved)
+			return saved, err
+		}
+		saved++
+	}
+	c.stats.addDanmakuSaved(saved)
+
+	if err := storage.MarkDanmakuCrawled(cid); err != nil {
+		return saved, err
+	}
+	c.markDanmakuCrawled(cid)
+	return saved, nil
+}
+
+func (c *BiliCrawler) isDanmakuCrawled(cid int64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.danmakuCids[strconv.FormatInt(cid, 10)]
+	return ok
+}
+
+func (c *BiliCrawler) markDanmakuCrawled(cid int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.danmakuCids[strconv.FormatInt(cid, 10)] = struct{}{}
+}
+
+// danmakuWorker fetches the danmaku of videos from the danmaku queue
+func (c *BiliCrawler) danmakuWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
+	defer wg.Done()
+
+	for {
+		if !c.waitTurn("danmaku", threadID, done) {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case task, ok := <-c.danmakuQueue:
+			if !ok {
+				return
+			}
+			if c.isCancelled() {
+				continue
+			}
+
+			c.recoverTask("danmaku", threadID, nil, func() {
+				saved, err := c.crawlDanmaku(task, session)
+				if err != nil {
+					c.errorf("[弹幕线程%d] %s 获取弹幕失败: %v\n", threadID, task.Bvid, err)
+				} else if saved > 0 {
+					c.debugf("[弹幕线程%d] %s 保存 %d 条弹幕\n", threadID, task.Bvid, saved)
+				}
+				c.delay()
+			})
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestDanmakuRecord_SchemaFields(t *testing.T) {
+	task := &VideoTask{Bvid: "BV1", Aid: 1, Cid: 2, Keyword: "测试"}
+	record := danmakuRecord(task, 2, api.Danmaku{ID: "3", Content: "前方高能"})
+	for _, field := range storage.SchemaFields["danmaku"] {
+		if _, ok := record[field]; !ok {
+			t.Errorf("danmaku record lacks schema field %q", field)
+		}
+	}
+}
+
+func TestBiliCrawler_CrawlDanmaku(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`<i><chatid>2</chatid>` +
+			`<d p="1.5,1,25,16777215,1700000000,0,abc,101,5">一</d>` +
+			`<d p="2.5,1,25,16777215,1700000001,0,def,102,5">二</d></i>`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	storage.SetRecordDir(t.TempDir())
+	var keys []string
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		keys = append(keys, key)
+		return nil
+	}))
+	t.Cleanup(func() { storage.SetSink(nil) })
+
+	c := newReloadCrawler()
+	c.danmakuCids = make(map[string]struct{})
+	task := &VideoTask{Bvid: "BV1", Aid: 1, Cid: 2}
+
+	saved, err := c.crawlDanmaku(task, nil)
+	if err != nil || saved != 2 {
+		t.Fatalf("crawlDanmaku = %d, %v; expected 2 saved", saved, err)
+	}
+	if len(keys) != 2 || keys[0] != "101" || keys[1] != "102" {
+		t.Errorf("published keys = %v", keys)
+	}
+	if c.stats.DanmakuSaved != 2 {
+		t.Errorf("DanmakuSaved = %d, expected 2", c.stats.DanmakuSaved)
+	}
+
+	// The page is recorded and not fetched again
+	if saved, err := c.crawlDanmaku(task, nil); err != nil || saved != 0 || requests != 1 {
+		t.Errorf("second crawlDanmaku = %d, %v after %d requests", saved, err, requests)
+	}
+}
@@ -0,0 +1,276 @@
+package crawler
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+)
+
+// dedupSet is a set of saved IDs kept in memory up to a limit. IDs added
+// beyond it spill to an on-disk hash index, with an LRU cache of recently
+// used spilled IDs in front of it. A nil set is empty. Callers serialize
+// access (under BiliCrawler.mu).
+type dedupSet struct {
+	mem   map[string]struct{}
+	limit int // IDs kept in mem, 0 means unlimited
+	dir   string
+	disk  *diskIndex // nil until the first spill
+	cache *lruCache
+}
+
+// newDedupSet creates a set keeping at most limit IDs in memory and spilling
+// the rest to dir (the system temp directory if empty)
+func newDedupSet(limit int, dir string) *dedupSet {
+	return &dedupSet{
+		mem:   make(map[string]struct{}),
+		limit: limit,
+		dir:   dir,
+		cache: newLRUCache(max(limit/4, 1)),
+	}
+}
+
+// loadDedupSet creates a set and fills it from a record file scanner
+func loadDedupSet(each func(func(string)) error, limit int, dir string) (*dedupSet, error) {
+	s := newDedupSet(limit, dir)
+	if err := each(s.Add); err != nil {
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Has reports whether id is in the set. A failed disk read reports false,
+// which at worst saves a record again.
+func (s *dedupSet) Has(id string) bool {
+	if s == nil {
+		return false
+	}
+	if _, ok := s.mem[id]; ok {
+		return true
+	}
+	if s.disk == nil {
+		return false
+	}
+	if s.cache.get(id) {
+		return true
+	}
+	found, err := s.disk.has(id)
+	if err == nil && found {
+		s.cache.add(id)
+	}
+	return found
+}
+
+// Add puts id into the set. If the disk index cannot be written the ID is
+// kept in memory instead.
+func (s *dedupSet) Add(id string) {
+	if s.Has(id) {
+		return
+	}
+	if s.limit <= 0 || len(s.mem) < s.limit {
+		s.mem[id] = struct{}{}
+		return
+	}
+	if s.disk == nil {
+		disk, err := newDiskIndex(s.dir, 1<<16)
+		if err != nil {
+			s.mem[id] = struct{}{}
+			return
+		}
+		s.disk = disk
+	}
+	if err := s.disk.add(id); err != nil {
+		s.mem[id] = struct{}{}
+		return
+	}
+	s.cache.add(id)
+}
+
+// Len returns the number of IDs in the set
+func (s *dedupSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	n := len(s.mem)
+	if s.disk != nil {
+		n += int(s.disk.count)
+	}
+	return n
+}
+
+// spilled reports how many IDs live on disk
+func (s *dedupSet) spilled() int {
+	if s == nil || s.disk == nil {
+		return 0
+	}
+	return int(s.disk.count)
+}
+
+// close removes the disk index
+func (s *dedupSet) close() {
+	if s == nil || s.disk == nil {
+		return
+	}
+	s.disk.close()
+	s.disk = nil
+}
+
+// indexSlotSize is the size of one slot of a disk index: a 128-bit ID hash,
+// all zeros for an empty slot
+const indexSlotSize = 16
+
+// diskIndex is an open-addressing hash set of ID hashes in a temporary file.
+// It doubles its size when half full.
+type diskIndex struct {
+	file  *os.File
+	slots uint64 // power of two
+	count uint64
+}
+
+func newDiskIndex(dir string, slots uint64) (*diskIndex, error) {
+	f, err := os.CreateTemp(dir, "biliclaw-dedup-*.idx")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Truncate(int64(slots * indexSlotSize)); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	return &diskIndex{file: f, slots: slots}, nil
+}
+
+// hashID returns the slot content for id, never all zeros
+func hashID(id string) [indexSlotSize]byte {
+	sum := sha1.Sum([]byte(id))
+	var h [indexSlotSize]byte
+	copy(h[:], sum[:])
+	if h == ([indexSlotSize]byte{}) {
+		h[0] = 1
+	}
+	return h
+}
+
+// probe finds the slot holding h or the empty slot where it belongs
+func (d *diskIndex) probe(h [indexSlotSize]byte) (uint64, bool, error) {
+	var slot [indexSlotSize]byte
+	pos := binary.BigEndian.Uint64(h[:8]) & (d.slots - 1)
+	for {
+		if _, err := d.file.ReadAt(slot[:], int64(pos*indexSlotSize)); err != nil {
+			return 0, false, err
+		}
+		switch slot {
+		case h:
+			return pos, true, nil
+		case [indexSlotSize]byte{}:
+			return pos, false, nil
+		}
+		pos = (pos + 1) & (d.slots - 1)
+	}
+}
+
+func (d *diskIndex) has(id string) (bool, error) {
+	_, found, err := d.probe(hashID(id))
+	return found, err
+}
+
+func (d *diskIndex) add(id string) error {
+	if (d.count+1)*2 > d.slots {
+		if err := d.grow(); err != nil {
+			return err
+		}
+	}
+	return d.insert(hashID(id))
+}
+
+func (d *diskIndex) insert(h [indexSlotSize]byte) error {
+	pos, found, err := d.probe(h)
+	if err != nil || found {
+		return err
+	}
+	if _, err := d.file.WriteAt(h[:], int64(pos*indexSlotSize)); err != nil {
+		return err
+	}
+	d.count++
+	return nil
+}
+
+// grow rehashes the index into a file twice the size
+func (d *diskIndex) grow() error {
+	bigger, err := newDiskIndex(filepath.Dir(d.file.Name()), d.slots*2)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4096*indexSlotSize)
+	for off := int64(0); off < int64(d.slots*indexSlotSize); off += int64(len(buf)) {
+		n, err := d.file.ReadAt(buf, off)
+		if n == 0 && err != nil {
+			bigger.close()
+			return err
+		}
+		for i := 0; i+indexSlotSize <= n; i += indexSlotSize {
+			var h [indexSlotSize]byte
+			copy(h[:], buf[i:i+indexSlotSize])
+			if h == ([indexSlotSize]byte{}) {
+				continue
+			}
+			if err := bigger.insert(h); err != nil {
+				bigger.close()
+				return err
+			}
+		}
+	}
+
+	d.close()
+	*d = *bigger
+	return nil
+}
+
+func (d *diskIndex) close() {
+	d.file.Close()
+	os.Remove(d.file.Name())
+}
+
+// lruCache remembers the most recently used IDs up to a capacity
+type lruCache struct {
+	capacity int
+	order    *list.List // front is most recent
+	items    map[string]*list.Element
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{capacity: capacity, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lruCache) get(id string) bool {
+	e, ok := c.items[id]
+	if ok {
+		c.order.MoveToFront(e)
+	}
+	return ok
+}
+
+func (c *lruCache) add(id string) {
+	if e, ok := c.items[id]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[id] = c.order.PushFront(id)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(string))
+	}
+}
+
+// closeDedupSets removes the disk indexes of the saved-ID sets
+func (c *BiliCrawler) closeDedupSets() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.savedBvids.close()
+	c.savedRpids.close()
+	c.savedMids.close()
+}
@@ -0,0 +1,102 @@
+package crawler
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// dedupSetOf returns an in-memory set holding ids
+func dedupSetOf(ids ...string) *dedupSet {
+	s := newDedupSet(0, "")
+	for _, id := range ids {
+		s.Add(id)
+	}
+	return s
+}
+
+func TestDedupSet_Spill(t *testing.T) {
+	dir := t.TempDir()
+	s := newDedupSet(100, dir)
+	defer s.close()
+
+	// Enough spilled IDs to make the disk index grow a few times
+	const total = 200000
+	for i := 0; i < total; i++ {
+		s.Add(fmt.Sprintf("rpid%d", i))
+	}
+	s.Add("rpid5") // duplicates are not counted twice
+
+	if len(s.mem) != 100 {
+		t.Errorf("%d IDs in memory, expected the limit of 100", len(s.mem))
+	}
+	if s.Len() != total || s.spilled() != total-100 {
+		t.Errorf("Len = %d, spilled = %d, expected %d and %d", s.Len(), s.spilled(), total, total-100)
+	}
+	for _, i := range []int{0, 99, 100, 12345, total - 1} {
+		if !s.Has(fmt.Sprintf("rpid%d", i)) {
+			t.Errorf("rpid%d should be in the set", i)
+		}
+	}
+	if s.Has("rpid-missing") || s.Has(fmt.Sprintf("rpid%d", total)) {
+		t.Error("IDs never added should not be in the set")
+	}
+	if len(s.cache.items) > 25 {
+		t.Errorf("LRU cache holds %d IDs, expected at most 25", len(s.cache.items))
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("%d index files in dedup_dir, expected 1 after growing", len(entries))
+	}
+	s.close()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Error("close should remove the disk index")
+	}
+}
+
+func TestDedupSet_Unlimited(t *testing.T) {
+	s := newDedupSet(0, t.TempDir())
+	for i := 0; i < 1000; i++ {
+		s.Add(fmt.Sprint(i))
+	}
+	if s.disk != nil || s.Len() != 1000 {
+		t.Errorf("A set without a limit should stay in memory (disk %v, Len %d)", s.disk != nil, s.Len())
+	}
+}
+
+func TestDedupSet_Nil(t *testing.T) {
+	var s *dedupSet
+	if s.Has("x") || s.Len() != 0 {
+		t.Error("A nil set should be empty")
+	}
+	s.close()
+}
+
+func TestLoadDedupSet(t *testing.T) {
+	each := func(fn func(string)) error {
+		for _, id := range []string{"BV1", "BV2", "BV3"} {
+			fn(id)
+		}
+		return nil
+	}
+	s, err := loadDedupSet(each, 1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if s.Len() != 3 || !s.Has("BV3") || s.spilled() != 2 {
+		t.Errorf("Len = %d, spilled = %d, expected 3 and 2", s.Len(), s.spilled())
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2)
+	c.add("a")
+	c.add("b")
+	c.get("a")
+	c.add("c") // evicts b, the least recently used
+	if !c.get("a") || c.get("b") || !c.get("c") {
+		t.Error("The least recently used entry should be evicted")
+	}
+}
@@ -0,0 +1,46 @@
+package crawler
+
+import (
+	"sort"
+
+	"spider-go/storage"
+)
+
+// CrawlAccounts works off pending_mids: it fetches the card of every
+// discovered user not saved yet, without searching or crawling comments.
+// Users still unsaved when the run stops stay in pending_mids.
+func (c *BiliCrawler) CrawlAccounts() {
+	c.drainMids = true
+	c.run(c.queuePendingMids)
+}
+
+// queuePendingMids pushes every unsaved pending MID into the account stage,
+// waiting for room instead of dropping MIDs when the queue is full
+func (c *BiliCrawler) queuePendingMids() {
+	pending, err := storage.GetPendingMids()
+	if err != nil {
+		c.errorf("读取待爬取用户出错: %v\n", err)
+		return
+	}
+
+	c.mu.Lock()
+	mids := make([]string, 0, len(pending))
+	for mid, source := range pending {
+		if _, queued := c.userMids[mid]; queued || c.savedMids.Has(mid) {
+			continue
+		}
+		c.userMids[mid] = source
+		mids = append(mids, mid)
+	}
+	c.mu.Unlock()
+	sort.Strings(mids)
+
+	c.logf("只爬用户: %d 个待爬取用户（pending_mids 共 %d 个）\n", len(mids), len(pending))
+	for _, mid := range mids {
+		select {
+		case <-c.cancelled:
+			return
+		case c.userMidQueue <- mid:
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package crawler
+
+import (
+	"io"
+	"testing"
+
+	"spider-go/storage"
+)
+
+func TestQueuePendingMids(t *testing.T) {
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+	for _, mid := range []string{"3", "1", "2", "4"} {
+		storage.SavePendingMid(mid, storage.MidSource{})
+	}
+
+	c := &BiliCrawler{
+		userMidQueue: make(chan string, 10),
+		userMids:     map[string]storage.MidSource{"4": {}},
+		savedMids:    dedupSetOf("2"),
+		cancelled:    make(chan struct{}),
+	}
+	c.SetLogOutput(io.Discard)
+	c.queuePendingMids()
+	close(c.userMidQueue)
+
+	var queued []string
+	for mid := range c.userMidQueue {
+		queued = append(queued, mid)
+	}
+	// Saved and already queued users are skipped, the rest go in MID order
+	if len(queued) != 2 || queued[0] != "1" || queued[1] != "3" {
+		t.Errorf("queued = %v, expected [1 3]", queued)
+	}
+	if _, ok := c.userMids["3"]; !ok {
+		t.Error("Queued users should be tracked so unsaved ones stay pending")
+	}
+}
+
+func TestQueuePendingMids_Cancelled(t *testing.T) {
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+	storage.SavePendingMid("1", storage.MidSource{})
+	storage.SavePendingMid("2", storage.MidSource{})
+
+	c := &BiliCrawler{
+		userMidQueue: make(chan string, 1),
+		userMids:     make(map[string]storage.MidSource),
+		cancelled:    make(chan struct{}),
+	}
+	c.SetLogOutput(io.Discard)
+	close(c.cancelled)
+
+	// A full queue must not block a cancelled run
+	c.userMidQueue <- "0"
+	c.queuePendingMids()
+}
@@ -0,0 +1,26 @@
+package crawler
+
+import (
+	"fmt"
+
+	"spider-go/api"
+)
+
+// logDrift logs the first time an API response differs from the shape the
+// crawler expects
+func (c *BiliCrawler) logDrift(d api.Drift) {
+	c.errorf("[接口变化] %s: %s\n", d.Endpoint, describeDrift(d))
+}
+
+// describeDrift explains a drift in one phrase
+func describeDrift(d api.Drift) string {
+	switch d.Kind {
+	case api.DriftUnknown:
+		return fmt.Sprintf("出现未知字段 %s", d.Path)
+	case api.DriftMissing:
+		return fmt.Sprintf("缺少字段 %s", d.Path)
+	case api.DriftMistyped:
+		return fmt.Sprintf("字段 %s 的类型应为 %s，实际为 %s", d.Path, d.Expected, d.Got)
+	}
+	return fmt.Sprintf("%s %s", d.Kind, d.Path)
+}
@@ -0,0 +1,23 @@
+package crawler
+
+import (
+	"testing"
+
+	"spider-go/api"
+)
+
+func TestDescribeDrift(t *testing.T) {
+	tests := []struct {
+		drift api.Drift
+		want  string
+	}{
+		{api.Drift{Kind: api.DriftUnknown, Path: "extra"}, "出现未知字段 extra"},
+		{api.Drift{Kind: api.DriftMissing, Path: "data.numPages", Expected: "number"}, "缺少字段 data.numPages"},
+		{api.Drift{Kind: api.DriftMistyped, Path: "data.card.mid", Expected: "string", Got: "number"}, "字段 data.card.mid 的类型应为 string，实际为 number"},
+	}
+	for _, tt := range tests {
+		if got := describeDrift(tt.drift); got != tt.want {
+			t.Errorf("describeDrift(%+v) = %q, want %q", tt.drift, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"sync"
+	"time"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+func (c *BiliCrawler) dynamicWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
+	defer wg.Done()
+
+	for {
+		if !c.waitTurn("dynamic", threadID, done) {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case mid, ok := <-c.dynamicQueue:
+			if !ok {
+				return
+			}
+			if c.isCancelled() {
+				continue
+			}
+
+			c.recoverTask("dynamic", threadID, nil, func() {
+				saved := c.crawlUserDynamics(threadID, mid, session)
+				c.debugf("[动态线程%d] 用户 %s 动态爬取完成，共 %d 条\n", threadID, mid, saved)
+			})
+		}
+	}
+}
+
+// crawlUserDynamics pages through a user's dynamics feed until the count or
+// time window is exhausted and returns the number of dynamics saved
+func (c *BiliCrawler) crawlUserDynamics(threadID int, mid string, session *api.Session) int {
+	cfg := c.live()
+	var cutoff int64
+	if cfg.DynamicsMaxDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -cfg.DynamicsMaxDays).Unix()
+	}
+
+	offset := ""
+	fetched := 0
+	saved := 0
+	for {
+		result, err := api.GetUserDynamics(mid, offset, session, c.config.CookieConfigPath)
+		c.recordResult("dynamic", err)
+		if err != nil {
+			c.errorf("[动态线程%d] 用户 %s 动态获取错误: %v\n", threadID, mid, err)
+			return saved
+		}
+
+		for _, item := range result.Items {
+			if cfg.DynamicsMaxCount > 0 && fetched >= cfg.DynamicsMaxCount {
+				return saved
+			}
+			if cutoff > 0 && !isPinnedDynamic(item) && dynamicPubTs(item) < cutoff {
+				return saved
+			}
+			fetched++
+
+			id, _ := item["id_str"].(string)
+			if c.config.Resume && c.isDynamicSaved(id) {
+				continue
+			}
+
+			item["host_mid"] = mid
+			if err := storage.SaveDynamic(item); err == nil {
+				c.stats.incDynamicsSaved()
+				c.markDynamicSaved(id)
+				saved++
+				if c.config.DynamicComments {
+					c.crawlDynamicComments(threadID, item, session)
+				}
+			}
+		}
+
+		if !result.HasMore || len(result.Items) == 0 {
+			return saved
+		}
+		offset = result.Offset
+		c.delay()
+	}
+}
+
+// dynamicPubTs returns the publish timestamp of a dynamic item
+func dynamicPubTs(item map[string]interface{}) int64 {
+	modules, _ := item["modules"].(map[string]interface{})
+	author, _ := modules["module_author"].(map[string]interface{})
+	ts, _ := author["pub_ts"].(float64)
+	return int64(ts)
+}
+
+// isPinnedDynamic reports whether a dynamic item is pinned to the top of the
+// feed, in which case it may be older than the items that follow it
+func isPinnedDynamic(item map[string]interface{}) bool {
+	modules, _ := item["modules"].(map[string]interface{})
+	tag, _ := modules["module_tag"].(map[string]interface{})
+	text, _ := tag["text"].(string)
+	return text == "置顶"
+}
@@ -0,0 +1,38 @@
+package crawler
+
+import (
+	"testing"
+)
+
+func TestDynamicPubTs(t *testing.T) {
+	item := map[string]interface{}{
+		"modules": map[string]interface{}{
+			"module_author": map[string]interface{}{
+				"pub_ts": float64(1700000000),
+			},
+		},
+	}
+
+	if ts := dynamicPubTs(item); ts != 1700000000 {
+		t.Errorf("dynamicPubTs = %d, expected 1700000000", ts)
+	}
+
+	if ts := dynamicPubTs(map[string]interface{}{}); ts != 0 {
+		t.Errorf("dynamicPubTs of empty item = %d, expected 0", ts)
+	}
+}
+
+func TestIsPinnedDynamic(t *testing.T) {
+	pinned := map[string]interface{}{
+		"modules": map[string]interface{}{
+			"module_tag": map[string]interface{}{"text": "置顶"},
+		},
+	}
+
+	if !isPinnedDynamic(pinned) {
+		t.Error("Expected dynamic with 置顶 tag to be pinned")
+	}
+	if isPinnedDynamic(map[string]interface{}{"modules": map[string]interface{}{}}) {
+		t.Error("Expected dynamic without tag not to be pinned")
+	}
+}
@@ -0,0 +1,96 @@
+package crawler
+
+import (
+	"strconv"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// dynamicCommentSection returns the comment section of a dynamic: the oid
+// and type its basic module reports, or the dynamic's own ID as a text
+// dynamic. Sections of videos and articles belong to those and are skipped.
+func dynamicCommentSection(item map[string]interface{}) (int64, int, bool) {
+	basic, _ := item["basic"].(map[string]interface{})
+	idStr, _ := basic["comment_id_str"].(string)
+	commentType := int(int64Field(basic, "comment_type"))
+	if idStr == "" {
+		idStr, _ = item["id_str"].(string)
+		commentType = api.CommentTypeDynamic
+	}
+	oid, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || oid <= 0 {
+		return 0, 0, false
+	}
+	switch commentType {
+	case api.CommentTypeDynamic, api.CommentTypeDynamicDraw:
+		return oid, commentType, true
+	}
+	return 0, 0, false
+}
+
+// crawlDynamicComments saves up to dynamic_comment_pages pages of the main
+// comments under a saved dynamic and returns how many were saved. Replies
+// are kept only as the previews embedded in each comment.
+func (c *BiliCrawler) crawlDynamicComments(threadID int, item map[string]interface{}, session *api.Session) int {
+	oid, commentType, ok := dynamicCommentSection(item)
+	if !ok {
+		return 0
+	}
+	id, _ := item["id_str"].(string)
+	ctx := commentContext{DynamicID: id}
+
+	maxPages := c.live().DynamicCommentPages
+	cursor := ""
+	saved := 0
+	for page := 1; ; page++ {
+		result, err := api.GetDynamicComments(oid, commentType, cursor, session, c.config.CookieConfigPath)
+		c.recordResult("dynamic", err)
+		if err != nil {
+			c.errorf("[动态线程%d] 动态 %s 评论获取错误: %v\n", threadID, id, err)
+			return saved
+		}
+
+		for _, reply := range append(markPinned(result.TopReplies), result.Replies...) {
+			if c.saveDynamicComment(reply, ctx) {
+				saved++
+			}
+		}
+		if result.IsEnd || len(result.Replies) == 0 || (maxPages > 0 && page >= maxPages) {
+			return saved
+		}
+		cursor = result.NextCursor
+		if c.isCancelled() {
+			return saved
+		}
+		c.delay()
+	}
+}
+
+// saveDynamicComment saves one comment of a dynamic unless it was saved
+// before or is filtered out, and reports whether it was saved
+func (c *BiliCrawler) saveDynamicComment(reply map[string]interface{}, ctx commentContext) bool {
+	rpid := newCommentIDs(reply).key()
+	if c.config.Resume && c.isRpidSaved(rpid) {
+		c.stats.incCommentsSkipped()
+		return false
+	}
+	if !c.allowComment(reply, "dynamic:"+ctx.DynamicID) {
+		return false
+	}
+
+	enrichComment(reply, ctx)
+	reply, keep := c.applyScript("comment", reply)
+	if !keep {
+		c.stats.incCommentsFiltered()
+		return false
+	}
+	if err := storage.SaveComment(reply); err != nil {
+		c.errorf("动态 %s 的评论 %s 保存失败: %v\n", ctx.DynamicID, rpid, err)
+		c.stats.incSaveError("dynamic")
+		return false
+	}
+	c.stats.incDynamicCommentsSaved()
+	c.markRpidSaved(rpid)
+	return true
+}
@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestDynamicCommentSection(t *testing.T) {
+	cases := []struct {
+		item     map[string]interface{}
+		oid      int64
+		typ      int
+		expected bool
+	}{
+		// Text dynamic reporting its own section
+		{map[string]interface{}{"id_str": "900", "basic": map[string]interface{}{"comment_id_str": "900", "comment_type": float64(17)}}, 900, 17, true},
+		// Picture dynamic with a separate oid
+		{map[string]interface{}{"id_str": "901", "basic": map[string]interface{}{"comment_id_str": "55", "comment_type": float64(11)}}, 55, 11, true},
+		// No basic module: the dynamic's own ID as a text dynamic
+		{map[string]interface{}{"id_str": "902"}, 902, 17, true},
+		// Video dynamics belong to the video's section
+		{map[string]interface{}{"id_str": "903", "basic": map[string]interface{}{"comment_id_str": "170001", "comment_type": float64(1)}}, 0, 0, false},
+		{map[string]interface{}{}, 0, 0, false},
+	}
+	for _, tc := range cases {
+		oid, typ, ok := dynamicCommentSection(tc.item)
+		if oid != tc.oid || typ != tc.typ || ok != tc.expected {
+			t.Errorf("dynamicCommentSection(%v) = %d, %d, %v; expected %d, %d, %v", tc.item, oid, typ, ok, tc.oid, tc.typ, tc.expected)
+		}
+	}
+}
+
+func TestBiliCrawler_CrawlDynamicComments(t *testing.T) {
+	var mu sync.Mutex
+	var requests []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/x/v2/reply/wbi/main" {
+			w.Write([]byte(`{"code":0,"data":{"wbi_img":{"img_url":"https://i0.hdslb.com/bfs/wbi/a.png","sub_url":"https://i0.hdslb.com/bfs/wbi/b.png"}}}`))
+			return
+		}
+		query := r.URL.Query()
+		mu.Lock()
+		requests = append(requests, query)
+		page := len(requests)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"code":0,"data":{"replies":[{"rpid":%d,"mid":1,"ctime":1,"rcount":0,"content":{"message":"hi"},"member":{}}],`+
+			`"cursor":{"is_end":false,"pagination_reply":{"next_offset":"p%d"}}}}`, 5000+page, page+1)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+
+	var saved []map[string]interface{}
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		var record map[string]interface{}
+		json.Unmarshal(value, &record)
+		saved = append(saved, record)
+		return nil
+	}))
+	defer storage.SetSink(nil)
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.DynamicCommentPages = 2
+	c.savedRpids = newDedupSet(0, "")
+
+	item := map[string]interface{}{"id_str": "900", "basic": map[string]interface{}{"comment_id_str": "900", "comment_type": float64(17)}}
+	if n := c.crawlDynamicComments(1, item, nil); n != 2 {
+		t.Errorf("saved %d comments, expected 2 from dynamic_comment_pages", n)
+	}
+	if len(requests) != 2 || requests[0].Get("type") != "17" || requests[0].Get("oid") != "900" {
+		t.Errorf("requests = %v, expected two pages of oid 900 type 17", requests)
+	}
+	if len(saved) != 2 || saved[0]["dynamic_id"] != "900" || saved[0]["bvid"] != "" {
+		t.Errorf("saved = %v, expected comments of dynamic 900", saved)
+	}
+	if got := c.stats.Snapshot().DynamicCommentsSaved; got != 2 {
+		t.Errorf("DynamicCommentsSaved = %d, expected 2", got)
+	}
+}
+
+func TestBiliCrawler_SaveDynamicCommentFailure(t *testing.T) {
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		return fmt.Errorf("broker down")
+	}))
+	t.Cleanup(func() { storage.SetSink(nil) })
+
+	c := newReloadCrawler()
+	c.savedRpids = newDedupSet(0, "")
+	reply := map[string]interface{}{"rpid": float64(5001), "mid": float64(1), "ctime": float64(1), "content": map[string]interface{}{"message": "hi"}, "member": map[string]interface{}{}}
+
+	if c.saveDynamicComment(reply, commentContext{DynamicID: "900"}) {
+		t.Fatal("saveDynamicComment reported a comment the sink rejected as saved")
+	}
+	if c.isRpidSaved("5001") || c.stats.Snapshot().DynamicCommentsSaved != 0 {
+		t.Error("A comment that was not saved should not be recorded or counted as saved")
+	}
+	if _, errors := c.stats.breakdown(); errors["dynamic"]["save"] != 1 {
+		t.Errorf("errors = %v, expected one dynamic save failure", errors)
+	}
+}
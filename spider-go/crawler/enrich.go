@@ -0,0 +1,214 @@
+package crawler
+
+import (
+	"sort"
+
+	"spider-go/storage"
+)
+
+// commentContext identifies where a comment was found
+type commentContext struct {
+	Bvid     string
+	Aid      int64
+	Title    string
+	Keyword  string
+	RootRpid int64 // root comment of a reply thread, 0 for main comments
+	// Dynamic whose comment section the comment is in, "" for videos
+	DynamicID string
+}
+
+// enrichComment adds the video and thread context to a comment record so that
+// downstream consumers can place it without joining on other topics. The
+// nested replies preview keeps its API order and each entry gets its position.
+func enrichComment(comment map[string]interface{}, ctx commentContext) {
+	root := int64Field(comment, "root")
+	if root == 0 {
+		root = ctx.RootRpid
+	}
+	parent := int64Field(comment, "parent")
+	if parent == 0 {
+		parent = root
+	}
+
+	comment["bvid"] = ctx.Bvid
+	comment["aid"] = ctx.Aid
+	comment["video_title"] = ctx.Title
+	comment["root_rpid"] = root
+	comment["parent_rpid"] = parent
+	comment["topic_keyword"] = ctx.Keyword
+	comment["dynamic_id"] = ctx.DynamicID
+	parseContent(comment)
+	member, _ := comment["member"].(map[string]interface{})
+	setMemberFields(comment, member)
+	setFanMedal(comment, member)
+	setUpFlags(comment)
+	if _, ok := comment["comment_source"]; !ok {
+		comment["comment_source"] = commentSourceWbi
+	}
+
+	previews, ok := comment["replies"].([]interface{})
+	if !ok {
+		return
+	}
+
+	rpid := int64Field(comment, "rpid")
+	previewCtx := ctx
+	if root == 0 {
+		previewCtx.RootRpid = rpid
+	} else {
+		previewCtx.RootRpid = root
+	}
+
+	for i, p := range previews {
+		preview, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		preview["comment_source"] = comment["comment_source"]
+		enrichComment(preview, previewCtx)
+		preview["preview_index"] = i
+	}
+}
+
+// parseContent flattens the structured parts of a comment's content into
+// top-level fields: emote_codes (e.g. "[doge]"), mentioned_mids, jump_urls
+// (keyword, title and url of each linked keyword) and picture_urls. Each
+// field is always present, empty if the comment has none.
+func parseContent(comment map[string]interface{}) {
+	content, _ := comment["content"].(map[string]interface{})
+
+	emotes, _ := content["emote"].(map[string]interface{})
+	codes := make([]string, 0, len(emotes))
+	for code := range emotes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	ats, _ := content["at_name_to_mid"].(map[string]interface{})
+	mids := make([]int64, 0, len(ats))
+	for name := range ats {
+		if mid := int64Field(ats, name); mid != 0 {
+			mids = append(mids, mid)
+		}
+	}
+	sort.Slice(mids, func(i, j int) bool { return mids[i] < mids[j] })
+
+	jumps, _ := content["jump_url"].(map[string]interface{})
+	keywords := make([]string, 0, len(jumps))
+	for keyword := range jumps {
+		keywords = append(keywords, keyword)
+	}
+	sort.Strings(keywords)
+	links := make([]map[string]interface{}, 0, len(jumps))
+	for _, keyword := range keywords {
+		jump, _ := jumps[keyword].(map[string]interface{})
+		links = append(links, map[string]interface{}{
+			"keyword": keyword,
+			"title":   jump["title"],
+			"url":     jump["pc_url"],
+		})
+	}
+
+	pictures, _ := content["pictures"].([]interface{})
+	urls := make([]string, 0, len(pictures))
+	for _, p := range pictures {
+		picture, _ := p.(map[string]interface{})
+		if src, ok := picture["img_src"].(string); ok && src != "" {
+			urls = append(urls, src)
+		}
+	}
+
+	comment["emote_codes"] = codes
+	comment["mentioned_mids"] = mids
+	comment["jump_urls"] = links
+	comment["picture_urls"] = urls
+}
+
+// enrichAccount lifts the member level and vip status of a user card to
+// top-level fields of the account record and adds how the account was found
+func enrichAccount(account map[string]interface{}, source storage.MidSource) {
+	card, _ := account["card"].(map[string]interface{})
+	setMemberFields(account, card)
+	account["discovered_as"] = source.Role
+	account["discovered_bvid"] = source.Bvid
+	account["discovered_rpid"] = source.Rpid
+}
+
+// setMemberFields copies the member level and vip status of a comment member
+// or user card into member_level, vip_type, vip_status and is_vip. Comment
+// members spell the vip fields vipType/vipStatus, user cards also have
+// type/status.
+func setMemberFields(record, member map[string]interface{}) {
+	levelInfo, _ := member["level_info"].(map[string]interface{})
+	vip, _ := member["vip"].(map[string]interface{})
+
+	vipType := int64Field(vip, "vipType")
+	if vipType == 0 {
+		vipType = int64Field(vip, "type")
+	}
+	vipStatus := int64Field(vip, "vipStatus")
+	if vipStatus == 0 {
+		vipStatus = int64Field(vip, "status")
+	}
+
+	record["member_level"] = int64Field(levelInfo, "current_level")
+	record["vip_type"] = vipType
+	record["vip_status"] = vipStatus
+	record["is_vip"] = vipStatus == 1
+}
+
+// setFanMedal copies the fan medal a commenter wears into fan_medal_id,
+// fan_medal_name and fan_medal_level, zero values if none is worn
+func setFanMedal(comment, member map[string]interface{}) {
+	medal, _ := member["fans_detail"].(map[string]interface{})
+	name, _ := medal["medal_name"].(string)
+
+	comment["fan_medal_id"] = int64Field(medal, "medal_id")
+	comment["fan_medal_name"] = name
+	comment["fan_medal_level"] = int64Field(medal, "level")
+}
+
+// setUpFlags copies whether the uploader liked or replied to a comment into
+// up_liked and up_replied, and sets is_pinned from the uploader's pin unless
+// markPinned already set it. pinned_by says who pinned it: "upper" for the
+// uploader, "admin" or "vote" as the API reports, "" if unknown or unpinned.
+func setUpFlags(comment map[string]interface{}) {
+	action, _ := comment["up_action"].(map[string]interface{})
+	liked, _ := action["like"].(bool)
+	replied, _ := action["reply"].(bool)
+	comment["up_liked"] = liked
+	comment["up_replied"] = replied
+
+	control, _ := comment["reply_control"].(map[string]interface{})
+	upTop, _ := control["is_up_top"].(bool)
+	if _, ok := comment["is_pinned"]; !ok {
+		comment["is_pinned"] = upTop
+	}
+	pinnedBy, _ := comment["pinned_by"].(string)
+	if pinnedBy == "" && upTop {
+		pinnedBy = "upper"
+	}
+	comment["pinned_by"] = pinnedBy
+}
+
+// markPinned sets is_pinned on the pinned comments of a main comment page and
+// returns them
+func markPinned(replies []map[string]interface{}) []map[string]interface{} {
+	for _, reply := range replies {
+		reply["is_pinned"] = true
+	}
+	return replies
+}
+
+// int64Field returns a numeric field of a decoded JSON object as int64
+func int64Field(m map[string]interface{}, key string) int64 {
+	switch v := m[key].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	}
+	return 0
+}
@@ -0,0 +1,219 @@
+package crawler
+
+import (
+	"reflect"
+	"testing"
+
+	"spider-go/storage"
+)
+
+// assertSchemaFields fails if record lacks a field storage.SchemaFields
+// promises for kind
+func assertSchemaFields(t *testing.T, kind string, record map[string]interface{}) {
+	t.Helper()
+	for _, field := range storage.SchemaFields[kind] {
+		if _, ok := record[field]; !ok {
+			t.Errorf("%s record lacks schema field %s", kind, field)
+		}
+	}
+}
+
+func TestEnrichComment_SchemaFields(t *testing.T) {
+	comment := map[string]interface{}{"rpid": float64(1), "content": map[string]interface{}{"message": "hi"}}
+	enrichComment(comment, commentContext{Bvid: "BV1", Aid: 42})
+	assertSchemaFields(t, "comment", comment)
+}
+
+func TestEnrichComment_MainComment(t *testing.T) {
+	comment := map[string]interface{}{
+		"rpid":   float64(100),
+		"root":   float64(0),
+		"parent": float64(0),
+		"replies": []interface{}{
+			map[string]interface{}{"rpid": float64(102), "root": float64(100), "parent": float64(100)},
+			map[string]interface{}{"rpid": float64(101), "root": float64(100), "parent": float64(102)},
+		},
+	}
+
+	enrichComment(comment, commentContext{Bvid: "BV1", Aid: 42, Title: "视频", Keyword: "测试"})
+
+	if comment["bvid"] != "BV1" || comment["aid"] != int64(42) || comment["video_title"] != "视频" || comment["topic_keyword"] != "测试" {
+		t.Errorf("Video context not set: %v", comment)
+	}
+	if comment["root_rpid"] != int64(0) || comment["parent_rpid"] != int64(0) {
+		t.Errorf("Main comment should have zero root/parent, got %v/%v", comment["root_rpid"], comment["parent_rpid"])
+	}
+
+	previews := comment["replies"].([]interface{})
+	first := previews[0].(map[string]interface{})
+	second := previews[1].(map[string]interface{})
+
+	if first["rpid"] != float64(102) || first["preview_index"] != 0 {
+		t.Errorf("Preview order not preserved: %v", first)
+	}
+	if second["preview_index"] != 1 || second["parent_rpid"] != int64(102) {
+		t.Errorf("Unexpected second preview: %v", second)
+	}
+	if first["root_rpid"] != int64(100) || first["bvid"] != "BV1" {
+		t.Errorf("Preview context not set: %v", first)
+	}
+}
+
+func TestEnrichComment_ReplyFallsBackToTaskRoot(t *testing.T) {
+	reply := map[string]interface{}{"rpid": float64(200)}
+
+	enrichComment(reply, commentContext{Bvid: "BV1", Aid: 42, RootRpid: 100})
+
+	if reply["root_rpid"] != int64(100) {
+		t.Errorf("root_rpid = %v, expected 100", reply["root_rpid"])
+	}
+	if reply["parent_rpid"] != int64(100) {
+		t.Errorf("parent_rpid = %v, expected 100", reply["parent_rpid"])
+	}
+}
+
+func TestParseContent(t *testing.T) {
+	comment := map[string]interface{}{
+		"content": map[string]interface{}{
+			"message": "[doge][笑哭] @甲 @乙 原神 真好玩",
+			"emote": map[string]interface{}{
+				"[笑哭]":   map[string]interface{}{"id": float64(2)},
+				"[doge]": map[string]interface{}{"id": float64(1)},
+			},
+			"at_name_to_mid": map[string]interface{}{"乙": float64(20), "甲": float64(10)},
+			"jump_url": map[string]interface{}{
+				"原神": map[string]interface{}{"title": "原神", "pc_url": "https://search.bilibili.com/all?keyword=原神"},
+			},
+			"pictures": []interface{}{
+				map[string]interface{}{"img_src": "https://i0.hdslb.com/bfs/new_dyn/a.jpg"},
+			},
+		},
+	}
+
+	parseContent(comment)
+
+	if codes := comment["emote_codes"]; !reflect.DeepEqual(codes, []string{"[doge]", "[笑哭]"}) {
+		t.Errorf("emote_codes = %v", codes)
+	}
+	if mids := comment["mentioned_mids"]; !reflect.DeepEqual(mids, []int64{10, 20}) {
+		t.Errorf("mentioned_mids = %v", mids)
+	}
+	links := comment["jump_urls"].([]map[string]interface{})
+	if len(links) != 1 || links[0]["keyword"] != "原神" || links[0]["url"] != "https://search.bilibili.com/all?keyword=原神" {
+		t.Errorf("jump_urls = %v", links)
+	}
+	if urls := comment["picture_urls"]; !reflect.DeepEqual(urls, []string{"https://i0.hdslb.com/bfs/new_dyn/a.jpg"}) {
+		t.Errorf("picture_urls = %v", urls)
+	}
+
+	plain := map[string]interface{}{"content": map[string]interface{}{"message": "hi"}}
+	parseContent(plain)
+	if codes := plain["emote_codes"].([]string); codes == nil || len(codes) != 0 {
+		t.Errorf("emote_codes should be an empty list, got %#v", plain["emote_codes"])
+	}
+}
+
+func TestInt64Field(t *testing.T) {
+	m := map[string]interface{}{"a": float64(1), "b": int64(2), "c": 3, "d": "4"}
+
+	if int64Field(m, "a") != 1 || int64Field(m, "b") != 2 || int64Field(m, "c") != 3 {
+		t.Error("int64Field should convert numeric types")
+	}
+	if int64Field(m, "d") != 0 || int64Field(m, "missing") != 0 {
+		t.Error("int64Field should return 0 for non-numeric or missing fields")
+	}
+}
+
+func TestEnrichComment_MemberFields(t *testing.T) {
+	comment := map[string]interface{}{
+		"rpid": float64(1),
+		"member": map[string]interface{}{
+			"level_info": map[string]interface{}{"current_level": float64(5)},
+			"vip":        map[string]interface{}{"vipType": float64(2), "vipStatus": float64(1)},
+			"fans_detail": map[string]interface{}{
+				"medal_id": float64(7), "medal_name": "测试牌", "level": float64(12),
+			},
+		},
+	}
+	enrichComment(comment, commentContext{Bvid: "BV1"})
+
+	if comment["member_level"] != int64(5) || comment["vip_type"] != int64(2) || comment["is_vip"] != true {
+		t.Errorf("Member fields not set: level %v, vip %v/%v", comment["member_level"], comment["vip_type"], comment["is_vip"])
+	}
+	if comment["fan_medal_id"] != int64(7) || comment["fan_medal_name"] != "测试牌" || comment["fan_medal_level"] != int64(12) {
+		t.Errorf("Fan medal not set: %v %v %v", comment["fan_medal_id"], comment["fan_medal_name"], comment["fan_medal_level"])
+	}
+}
+
+func TestEnrichComment_NoMedal(t *testing.T) {
+	comment := map[string]interface{}{
+		"rpid":   float64(1),
+		"member": map[string]interface{}{"fans_detail": nil},
+	}
+	enrichComment(comment, commentContext{Bvid: "BV1"})
+
+	if comment["fan_medal_name"] != "" || comment["fan_medal_level"] != int64(0) || comment["is_vip"] != false {
+		t.Errorf("Missing medal and vip should give zero values, got %v %v %v",
+			comment["fan_medal_name"], comment["fan_medal_level"], comment["is_vip"])
+	}
+}
+
+func TestEnrichComment_UpFlags(t *testing.T) {
+	comment := map[string]interface{}{
+		"rpid":      float64(1),
+		"up_action": map[string]interface{}{"like": true, "reply": false},
+	}
+	enrichComment(comment, commentContext{Bvid: "BV1"})
+
+	if comment["up_liked"] != true || comment["up_replied"] != false || comment["is_pinned"] != false {
+		t.Errorf("UP flags = %v/%v, pinned %v", comment["up_liked"], comment["up_replied"], comment["is_pinned"])
+	}
+
+	upTop := map[string]interface{}{
+		"rpid":          float64(2),
+		"reply_control": map[string]interface{}{"is_up_top": true},
+	}
+	enrichComment(upTop, commentContext{Bvid: "BV1"})
+	if upTop["is_pinned"] != true || upTop["pinned_by"] != "upper" {
+		t.Errorf("A comment the uploader pinned should be marked is_pinned by upper, got %v/%v", upTop["is_pinned"], upTop["pinned_by"])
+	}
+	if comment["pinned_by"] != "" {
+		t.Errorf("An unpinned comment should have empty pinned_by, got %v", comment["pinned_by"])
+	}
+
+	adminTop := markPinned([]map[string]interface{}{{"rpid": float64(3), "pinned_by": "admin"}})[0]
+	enrichComment(adminTop, commentContext{Bvid: "BV1"})
+	if adminTop["is_pinned"] != true || adminTop["pinned_by"] != "admin" {
+		t.Errorf("An admin pin should keep pinned_by admin, got %v/%v", adminTop["is_pinned"], adminTop["pinned_by"])
+	}
+}
+
+func TestMarkPinned(t *testing.T) {
+	top := markPinned([]map[string]interface{}{{"rpid": float64(1)}})
+	enrichComment(top[0], commentContext{Bvid: "BV1"})
+	if top[0]["is_pinned"] != true {
+		t.Error("markPinned should survive enrichment")
+	}
+	if markPinned(nil) != nil {
+		t.Error("markPinned(nil) should return nil")
+	}
+}
+
+func TestEnrichAccount(t *testing.T) {
+	account := map[string]interface{}{
+		"card": map[string]interface{}{
+			"mid":        "42",
+			"level_info": map[string]interface{}{"current_level": float64(6)},
+			"vip":        map[string]interface{}{"type": float64(1), "status": float64(1)},
+		},
+	}
+	enrichAccount(account, storage.MidSource{Role: storage.MidReplier, Bvid: "BV1", Rpid: 100})
+	assertSchemaFields(t, "account", account)
+
+	if account["member_level"] != int64(6) || account["vip_type"] != int64(1) || account["is_vip"] != true {
+		t.Errorf("Account member fields not set: %v %v %v", account["member_level"], account["vip_type"], account["is_vip"])
+	}
+	if account["discovered_as"] != "replier" || account["discovered_bvid"] != "BV1" || account["discovered_rpid"] != int64(100) {
+		t.Errorf("Account provenance not set: %v %v %v", account["discovered_as"], account["discovered_bvid"], account["discovered_rpid"])
+	}
+}
@@ -0,0 +1,97 @@
+package crawler
+
+import (
+	"sort"
+	"strings"
+)
+
+// harvestTags counts the tags of a saved video towards its keyword
+func (c *BiliCrawler) harvestTags(keyword string, video map[string]interface{}) {
+	if !c.config.TagExpand {
+		return
+	}
+	tags := videoTags(video)
+	if len(tags) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := c.tagCounts[keyword]
+	if counts == nil {
+		counts = make(map[string]int)
+		c.tagCounts[keyword] = counts
+	}
+	seen := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		if _, dup := seen[tag]; !dup {
+			seen[tag] = struct{}{}
+			counts[tag]++
+		}
+	}
+}
+
+// topTags returns up to n tags seen at least minCount times, most frequent
+// first (ties by name), skipping excluded ones
+func topTags(counts map[string]int, n, minCount int, exclude func(string) bool) []string {
+	var tags []string
+	for tag, count := range counts {
+		if count >= minCount && !exclude(tag) {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+	if len(tags) > n {
+		tags = tags[:n]
+	}
+	return tags
+}
+
+// expandKeywords appends the top tags of a keyword that has just been
+// searched as new keywords one generation deeper
+func (c *BiliCrawler) expandKeywords(keyword string) {
+	if !c.config.TagExpand {
+		return
+	}
+	cfg := c.live()
+
+	c.mu.Lock()
+	counts := c.tagCounts[keyword]
+	delete(c.tagCounts, keyword)
+	c.mu.Unlock()
+
+	c.keywordMu.Lock()
+	defer c.keywordMu.Unlock()
+
+	depth := c.keywordDepth[keyword] + 1
+	if depth > cfg.TagExpandDepth || c.keywordIndex < 0 {
+		return
+	}
+	n := cfg.TagExpandPerKeyword
+	if left := cfg.TagExpandMaxTotal - c.expandedTotal; left < n {
+		n = left
+	}
+	if n <= 0 {
+		return
+	}
+
+	exclude := func(tag string) bool {
+		for _, word := range append(cfg.TagExpandStopwords, c.keywords...) {
+			if strings.EqualFold(tag, word) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, tag := range topTags(counts, n, cfg.TagExpandMinCount, exclude) {
+		c.keywords = append(c.keywords, tag)
+		c.keywordDepth[tag] = depth
+		c.expandedTotal++
+		c.logf("根据标签扩展关键词: %s (来自 %s，%d 个视频)\n", tag, keyword, counts[tag])
+	}
+}
@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopTags(t *testing.T) {
+	counts := map[string]int{"原神": 5, "游戏": 5, "攻略": 3, "搞笑": 1, "测试": 9}
+	exclude := func(tag string) bool { return tag == "测试" }
+
+	got := topTags(counts, 2, 2, exclude)
+	if expected := []string{"原神", "游戏"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("topTags = %v, expected %v", got, expected)
+	}
+	got = topTags(counts, 10, 2, exclude)
+	if expected := []string{"原神", "游戏", "攻略"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("topTags = %v, expected tags below min count to be dropped: %v", got, expected)
+	}
+}
+
+func TestBiliCrawler_ExpandKeywords(t *testing.T) {
+	c := newReloadCrawler()
+	c.config.TagExpand = true
+	c.config.TagExpandMinCount = 2
+	c.config.TagExpandPerKeyword = 2
+	c.config.TagExpandMaxTotal = 3
+	c.config.TagExpandStopwords = []string{"日常"}
+	c.keywords = []string{"测试"}
+	c.tagCounts = make(map[string]map[string]int)
+	c.keywordDepth = make(map[string]int)
+
+	for _, tag := range []string{"游戏,日常,测试", "游戏,攻略,日常", "攻略,游戏,游戏", "音乐"} {
+		c.harvestTags("测试", map[string]interface{}{"tag": tag})
+	}
+	if got := c.tagCounts["测试"]["游戏"]; got != 3 {
+		t.Errorf("游戏 counted %d times, expected once per video", got)
+	}
+
+	c.expandKeywords("测试")
+	if expected := []string{"测试", "游戏", "攻略"}; !reflect.DeepEqual(c.keywords, expected) {
+		t.Fatalf("keywords = %v, expected %v", c.keywords, expected)
+	}
+
+	// Expanded keywords are already at the maximum depth
+	c.harvestTags("游戏", map[string]interface{}{"tag": "手游"})
+	c.harvestTags("游戏", map[string]interface{}{"tag": "手游"})
+	c.expandKeywords("游戏")
+	if len(c.keywords) != 3 {
+		t.Errorf("keywords = %v, expected no expansion beyond tag_expand_depth", c.keywords)
+	}
+
+	c.config.TagExpandDepth = 2
+	c.harvestTags("攻略", map[string]interface{}{"tag": "手游,单机"})
+	c.harvestTags("攻略", map[string]interface{}{"tag": "手游,单机"})
+	c.expandKeywords("攻略")
+	if expected := []string{"测试", "游戏", "攻略", "单机"}; !reflect.DeepEqual(c.keywords, expected) {
+		t.Errorf("keywords = %v, expected tag_expand_max_total to cap expansion: %v", c.keywords, expected)
+	}
+}
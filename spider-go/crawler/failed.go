@@ -0,0 +1,184 @@
+package crawler
+
+import (
+	"strconv"
+
+	"spider-go/storage"
+)
+
+func failedKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+// recordFailure persists a task that still failed after the API retries so a
+// later retry-failed run can pick it up
+func (c *BiliCrawler) recordFailure(task storage.FailedTask, err error) {
+	task.Error = err.Error()
+	if err := storage.RecordFailedTask(task); err != nil {
+		c.errorf("记录失败任务 %s:%s 出错: %v\n", task.Kind, task.ID, err)
+		return
+	}
+
+	c.mu.Lock()
+	c.failedTasks[failedKey(task.Kind, task.ID)] = struct{}{}
+	c.mu.Unlock()
+}
+
+// clearFailure drops a task from the failed list after it succeeded
+func (c *BiliCrawler) clearFailure(kind, id string) {
+	key := failedKey(kind, id)
+
+	c.mu.Lock()
+	_, failed := c.failedTasks[key]
+	delete(c.failedTasks, key)
+	c.mu.Unlock()
+
+	if failed {
+		storage.ClearFailedTask(kind, id)
+	}
+}
+
+// dropReply remembers a reply task skipped because the crawl was cancelled,
+// to be recorded by checkpointDroppedReplies
+func (c *BiliCrawler) dropReply(task *CommentTask) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.droppedReplies = append(c.droppedReplies, task)
+}
+
+// checkpointDroppedReplies records the reply tasks skipped after Cancel as
+// failed with errCancelled in one write, so a resumed run continues them
+func (c *BiliCrawler) checkpointDroppedReplies() {
+	c.mu.Lock()
+	dropped := c.droppedReplies
+	c.droppedReplies = nil
+	c.mu.Unlock()
+	if len(dropped) == 0 {
+		return
+	}
+
+	tasks := make([]storage.FailedTask, 0, len(dropped))
+	for _, task := range dropped {
+		tasks = append(tasks, storage.FailedTask{
+			Kind:    storage.FailedReply,
+			ID:      strconv.FormatInt(task.Rpid, 10),
+			Aid:     task.Aid,
+			Bvid:    task.Bvid,
+			Title:   task.Title,
+			Keyword: task.Keyword,
+			Error:   errCancelled.Error(),
+		})
+	}
+	if err := storage.RecordFailedTasks(tasks); err != nil {
+		c.errorf("记录取消的回复任务出错: %v\n", err)
+		return
+	}
+
+	c.mu.Lock()
+	for _, task := range tasks {
+		c.failedTasks[failedKey(task.Kind, task.ID)] = struct{}{}
+	}
+	c.mu.Unlock()
+	c.logf("已取消的 %d 个回复任务已记入 failed_tasks.json，断点续传时继续\n", len(tasks))
+}
+
+// queueCancelledReplies pushes the reply tasks a cancelled run recorded into
+// the reply stage
+func (c *BiliCrawler) queueCancelledReplies() {
+	tasks, err := storage.GetFailedTasks()
+	if err != nil {
+		c.errorf("读取失败任务出错: %v\n", err)
+		return
+	}
+
+	queued := 0
+	for _, task := range tasks {
+		if task.Kind != storage.FailedReply || task.Error != errCancelled.Error() {
+			continue
+		}
+		rpid, err := strconv.ParseInt(task.ID, 10, 64)
+		if err != nil {
+			continue
+		}
+		c.mu.Lock()
+		c.failedTasks[failedKey(task.Kind, task.ID)] = struct{}{}
+		c.mu.Unlock()
+		c.commentQueue <- &CommentTask{
+			Aid:     task.Aid,
+			Bvid:    task.Bvid,
+			Title:   task.Title,
+			Keyword: task.Keyword,
+			Rpid:    rpid,
+		}
+		queued++
+	}
+	if queued > 0 {
+		c.logf("  - 已恢复 %d 个因取消中断的回复任务\n", queued)
+	}
+}
+
+// RetryFailed runs the pipeline over the tasks recorded in failed_tasks.json
+// instead of searching keywords
+func (c *BiliCrawler) RetryFailed() {
+	c.run(c.queueFailedTasks)
+}
+
+// queueFailedTasks pushes every recorded failed task into its stage
+func (c *BiliCrawler) queueFailedTasks() {
+	tasks, err := storage.GetFailedTasks()
+	if err != nil {
+		c.errorf("读取失败任务出错: %v\n", err)
+		return
+	}
+	c.logf("重试失败任务: %d 个\n", len(tasks))
+
+	// Known as failed, so that succeeding clears them from failed_tasks.json.
+	// Reply tasks a cancel cut short were already queued on resume.
+	c.mu.Lock()
+	queued := make(map[string]bool)
+	for _, task := range tasks {
+		key := failedKey(task.Kind, task.ID)
+		if _, ok := c.failedTasks[key]; ok {
+			queued[key] = true
+		}
+		c.failedTasks[key] = struct{}{}
+	}
+	c.mu.Unlock()
+
+	var videos []*VideoListing
+	for _, task := range tasks {
+		switch task.Kind {
+		case storage.FailedVideo:
+			videos = append(videos, &VideoListing{Bvid: task.ID, Keyword: task.Keyword})
+		case storage.FailedComment:
+			c.videoQueue <- newVideoTask(map[string]interface{}{
+				"bvid":          task.ID,
+				"aid":           task.Aid,
+				"title":         task.Title,
+				"topic_keyword": task.Keyword,
+			})
+		case storage.FailedReply:
+			if queued[failedKey(task.Kind, task.ID)] {
+				continue
+			}
+			rpid, err := strconv.ParseInt(task.ID, 10, 64)
+			if err != nil {
+				c.errorf("失败任务中的评论ID无效: %s\n", task.ID)
+				continue
+			}
+			c.commentQueue <- &CommentTask{
+				Aid:     task.Aid,
+				Bvid:    task.Bvid,
+				Title:   task.Title,
+				Keyword: task.Keyword,
+				Rpid:    rpid,
+			}
+		case storage.FailedAccount:
+			c.addUserMid(task.ID, storage.MidSource{})
+		}
+	}
+
+	if len(videos) > 0 {
+		c.fetchVideoDetails(videos)
+	}
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/cookie"
+	"spider-go/storage"
+)
+
+func TestBiliCrawler_RetryFailedClearsSucceeded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/x/web-interface/view" {
+			w.Write([]byte(`{"code":0,"data":{"bvid":"BV1","aid":1,"cid":2,"title":"视频","owner":{"mid":3}}}`))
+			return
+		}
+		w.Write([]byte(`{"code":0,"data":{}}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+
+	dir := t.TempDir()
+	storage.SetRecordDir(dir)
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error { return nil }))
+	t.Cleanup(func() { storage.SetSink(nil) })
+	t.Cleanup(func() { storage.CloseSentIDs() })
+
+	config := DefaultConfig()
+	config.Keyword = "测试"
+	config.DelayMin, config.DelayMax = 0, 0
+	config.RateLimitRate, config.RateLimitCapacity = 1000, 1000
+	config.CookieConfigPath = filepath.Join(dir, "cookies.json")
+	config.ReportPath = ""
+	config.KafkaOutput = false
+	config.CrawlComments = false
+	config.CrawlAccounts = false
+	previous := cookie.GetCookiePool(config.CookieConfigPath)
+	cookie.SetCookiePool(cookie.NewCookiePool(config.CookieConfigPath))
+	t.Cleanup(func() { cookie.SetCookiePool(previous) })
+
+	storage.RecordFailedTask(storage.FailedTask{Kind: storage.FailedVideo, ID: "BV1", Error: "timeout"})
+
+	c, err := NewBiliCrawler(config)
+	if err != nil {
+		t.Fatalf("NewBiliCrawler: %v", err)
+	}
+	c.SetLogOutput(io.Discard)
+	c.RetryFailed()
+
+	if tasks, err := storage.GetFailedTasks(); err != nil || len(tasks) != 0 {
+		t.Errorf("failed tasks = %v, %v; expected the retried video cleared", tasks, err)
+	}
+	if code := c.ExitCode(); code != ExitCompleted {
+		t.Errorf("ExitCode = %d, expected %d", code, ExitCompleted)
+	}
+}
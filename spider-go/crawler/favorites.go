@@ -0,0 +1,130 @@
+package crawler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// favTypeVideo is the type of a video in a favorite folder
+const favTypeVideo = 2
+
+func (c *BiliCrawler) favoriteWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
+	defer wg.Done()
+
+	for {
+		if !c.waitTurn("favorite", threadID, done) {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case mid, ok := <-c.favoriteQueue:
+			if !ok {
+				return
+			}
+			if c.isCancelled() {
+				continue
+			}
+
+			c.recoverTask("favorite", threadID, nil, func() {
+				if c.config.Resume && c.isFavoriteDone(mid) {
+					return
+				}
+
+				saved, err := c.crawlUserFavorites(mid, session)
+				if err != nil {
+					c.errorf("[收藏线程%d] 用户 %s 的收藏获取错误: %v\n", threadID, mid, err)
+				} else {
+					storage.MarkFavoritesDone(mid)
+					c.markFavoriteDone(mid)
+				}
+				c.debugf("[收藏线程%d] 用户 %s 收藏爬取完成，共 %d 条\n", threadID, mid, saved)
+			})
+		}
+	}
+}
+
+// crawlUserFavorites saves the videos in every public favorite folder of a
+// user and returns the number saved
+func (c *BiliCrawler) crawlUserFavorites(mid string, session *api.Session) (int, error) {
+	folders, err := api.GetFavFolders(mid, session, c.config.CookieConfigPath)
+	c.recordResult("favorite", err)
+	if err != nil {
+		return 0, err
+	}
+
+	saved := 0
+	for _, folder := range folders {
+		if !folder.Public() || folder.MediaCount == 0 {
+			continue
+		}
+		n, err := c.crawlFavFolder(mid, folder, session)
+		saved += n
+		if err != nil {
+			return saved, fmt.Errorf("folder %d: %w", folder.ID, err)
+		}
+		c.delay()
+	}
+	return saved, nil
+}
+
+// crawlFavFolder pages through one favorite folder, saving its videos
+func (c *BiliCrawler) crawlFavFolder(mid string, folder api.FavFolder, session *api.Session) (int, error) {
+	maxPages := c.live().FavoriteMaxPages
+	saved := 0
+	for page := 1; maxPages <= 0 || page <= maxPages; page++ {
+		result, err := api.GetFavResources(folder.ID, page, c.config.FavoritePageSize, session, c.config.CookieConfigPath)
+		c.recordResult("favorite", err)
+		if err != nil {
+			return saved, err
+		}
+
+		crawlTime := time.Now().Unix()
+		for _, media := range result.Medias {
+			if int64Field(media, "type") != favTypeVideo {
+				continue
+			}
+			if err := storage.SaveFavorite(newFavoriteRecord(mid, folder, media, crawlTime)); err == nil {
+				c.stats.incFavoritesSaved()
+				saved++
+			}
+		}
+
+		if !result.HasMore {
+			break
+		}
+		c.delay()
+	}
+	return saved, nil
+}
+
+// newFavoriteRecord builds the favorite record published for a folder item
+func newFavoriteRecord(ownerMid string, folder api.FavFolder, media map[string]interface{}, crawlTime int64) map[string]interface{} {
+	record := make(map[string]interface{}, len(media)+4)
+	for k, v := range media {
+		record[k] = v
+	}
+	record["owner_mid"] = ownerMid
+	record["folder_id"] = folder.ID
+	record["folder_title"] = folder.Title
+	record["crawl_time"] = crawlTime
+	return record
+}
+
+func (c *BiliCrawler) isFavoriteDone(mid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.favoriteMids[mid]
+	return ok
+}
+
+func (c *BiliCrawler) markFavoriteDone(mid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.favoriteMids[mid] = struct{}{}
+}
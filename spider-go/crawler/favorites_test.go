@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestNewFavoriteRecord(t *testing.T) {
+	media := map[string]interface{}{
+		"bvid":  "BV1xx",
+		"type":  float64(favTypeVideo),
+		"title": "test",
+	}
+	folder := api.FavFolder{ID: 789, Title: "默认收藏夹"}
+
+	record := newFavoriteRecord("123", folder, media, 1700000000)
+
+	if record["owner_mid"] != "123" || record["bvid"] != "BV1xx" {
+		t.Errorf("owner_mid/bvid = %v/%v, expected 123/BV1xx", record["owner_mid"], record["bvid"])
+	}
+	if record["folder_id"] != int64(789) || record["folder_title"] != "默认收藏夹" {
+		t.Errorf("folder = %v %v, expected 789 默认收藏夹", record["folder_id"], record["folder_title"])
+	}
+	if _, ok := media["owner_mid"]; ok {
+		t.Error("newFavoriteRecord should not modify the source item")
+	}
+	assertSchemaFields(t, "favorite", record)
+}
+
+func TestFavFolder_Public(t *testing.T) {
+	if !(api.FavFolder{Attr: 0}).Public() || !(api.FavFolder{Attr: 2}).Public() {
+		t.Error("Folders without the private bit should be public")
+	}
+	if (api.FavFolder{Attr: 1}).Public() || (api.FavFolder{Attr: 3}).Public() {
+		t.Error("Folders with the private bit should not be public")
+	}
+}
+
+// favoriteServer serves the favorite folders of users 1, 2 and 4. User 1's
+// folder list fails; user 2's folder fails on its second page.
+func favoriteServer(t *testing.T) *[]string {
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		mu.Lock()
+		switch r.URL.Path {
+		case "/x/v3/fav/folder/created/list-all":
+			requests = append(requests, "folders:"+query.Get("up_mid"))
+		case "/x/v3/fav/resource/list":
+			requests = append(requests, query.Get("media_id")+":"+query.Get("pn"))
+		}
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/x/v3/fav/folder/created/list-all":
+			mid := query.Get("up_mid")
+			if mid == "1" {
+				w.Write([]byte(`{"code":-400,"message":"请求错误"}`))
+				return
+			}
+			// A public folder, a private one and an empty one
+			fmt.Fprintf(w, `{"code":0,"data":{"list":[{"id":%s1,"title":"默认收藏夹","attr":0,"media_count":5},`+
+				`{"id":%s2,"title":"私密","attr":1,"media_count":5},{"id":%s3,"title":"空","attr":2,"media_count":0}]}}`, mid, mid, mid)
+		case "/x/v3/fav/resource/list":
+			folder, pn := query.Get("media_id"), query.Get("pn")
+			if folder == "21" && pn == "2" {
+				w.Write([]byte(`{"code":-400,"message":"请求错误"}`))
+				return
+			}
+			// A video and an audio item per page, with three pages in all
+			fmt.Fprintf(w, `{"code":0,"data":{"medias":[{"type":2,"bvid":"BV%s_%s"},{"type":12,"bvid":""}],"has_more":%t}}`,
+				folder, pn, pn != "3")
+		}
+	}))
+	t.Cleanup(server.Close)
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+	return &requests
+}
+
+func TestBiliCrawler_CrawlUserFavorites(t *testing.T) {
+	requests := favoriteServer(t)
+	var keys []string
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		if key == "4_41_BV41_2" {
+			return errors.New("sink down")
+		}
+		keys = append(keys, key)
+		return nil
+	}))
+	t.Cleanup(func() { storage.SetSink(nil) })
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.FavoriteMaxPages = 2
+
+	saved, err := c.crawlUserFavorites("4", nil)
+	if err != nil {
+		t.Fatalf("crawlUserFavorites: %v", err)
+	}
+	// Only the public folder is listed, up to favorite_max_pages pages
+	if expected := []string{"folders:4", "41:1", "41:2"}; !reflect.DeepEqual(*requests, expected) {
+		t.Errorf("requests = %v, expected %v", *requests, expected)
+	}
+	// The audio items are skipped and the failed save is not counted
+	if expected := []string{"4_41_BV41_1"}; saved != 1 || !reflect.DeepEqual(keys, expected) {
+		t.Errorf("saved %d %v, expected 1 %v", saved, keys, expected)
+	}
+	if c.stats.FavoritesSaved != 1 {
+		t.Errorf("FavoritesSaved = %d, expected 1", c.stats.FavoritesSaved)
+	}
+}
+
+func TestBiliCrawler_CrawlFavFolderUnlimited(t *testing.T) {
+	requests := favoriteServer(t)
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error { return nil }))
+	t.Cleanup(func() { storage.SetSink(nil) })
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.FavoriteMaxPages = 0
+
+	saved, err := c.crawlFavFolder("4", api.FavFolder{ID: 41}, nil)
+	if err != nil || saved != 3 {
+		t.Errorf("crawlFavFolder = %d, %v, expected 3 saved", saved, err)
+	}
+	// Paging stops at the page without has_more
+	if expected := []string{"41:1", "41:2", "41:3"}; !reflect.DeepEqual(*requests, expected) {
+		t.Errorf("requests = %v, expected %v", *requests, expected)
+	}
+}
+
+func TestBiliCrawler_FavoriteWorker(t *testing.T) {
+	requests := favoriteServer(t)
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error { return nil }))
+	t.Cleanup(func() { storage.SetSink(nil) })
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.Resume = true
+	c.config.StageThreads = map[string]int{"favorite": 2}
+	c.cancelled = make(chan struct{})
+	c.favoriteMids = map[string]struct{}{"3": {}}
+	c.favoriteQueue = make(chan string, 4)
+	for _, mid := range []string{"1", "2", "3", "4"} {
+		c.favoriteQueue <- mid
+	}
+	close(c.favoriteQueue)
+
+	// Both failing users retry at once, one per thread
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for threadID := 0; threadID < 2; threadID++ {
+		wg.Add(1)
+		go c.favoriteWorker(threadID, &wg, done, nil)
+	}
+	wg.Wait()
+
+	// Users whose folders failed are left to be crawled again
+	if expected := map[string]struct{}{"3": {}, "4": {}}; !reflect.DeepEqual(c.favoriteMids, expected) {
+		t.Errorf("done users = %v, expected %v", c.favoriteMids, expected)
+	}
+	for _, request := range *requests {
+		if request == "folders:3" {
+			t.Error("user 3 was crawled again although resume marks them done")
+		}
+	}
+	// User 2's failed page stops their folder, keeping the first page
+	if c.stats.FavoritesSaved != 1+3 {
+		t.Errorf("FavoritesSaved = %d, expected %d", c.stats.FavoritesSaved, 1+3)
+	}
+}
@@ -0,0 +1,385 @@
+package crawler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// VideoFilter configures which search/related results are crawled. Zero
+// values disable the corresponding check.
+type VideoFilter struct {
+	MinPlay           int64    `json:"min_play"`
+	MinDuration       int      `json:"min_duration"` // seconds
+	MaxDuration       int      `json:"max_duration"` // seconds
+	ExcludeTitleRegex string   `json:"exclude_title_regex"`
+	ExcludeMids       []string `json:"exclude_mids"`
+	RequireTags       []string `json:"require_tags"` // at least one must match
+}
+
+// videoFilter is the compiled form of VideoFilter
+type videoFilter struct {
+	config      VideoFilter
+	titleRe     *regexp.Regexp
+	excludeMids map[string]struct{}
+}
+
+var emTagRe = regexp.MustCompile(`</?em[^>]*>`)
+
+func newVideoFilter(config VideoFilter) (*videoFilter, error) {
+	f := &videoFilter{
+		config:      config,
+		excludeMids: make(map[string]struct{}),
+	}
+
+	if config.ExcludeTitleRegex != "" {
+		re, err := regexp.Compile(config.ExcludeTitleRegex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude_title_regex: %w", err)
+		}
+		f.titleRe = re
+	}
+
+	for _, mid := range config.ExcludeMids {
+		f.excludeMids[mid] = struct{}{}
+	}
+
+	return f, nil
+}
+
+// Allow reports whether a video passes the filter, and if not, why
+func (f *videoFilter) Allow(video map[string]interface{}) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+
+	if f.config.MinPlay > 0 && videoPlayCount(video) < f.config.MinPlay {
+		return false, "播放量过低"
+	}
+
+	duration := videoDuration(video)
+	if f.config.MinDuration > 0 && duration < f.config.MinDuration {
+		return false, "时长过短"
+	}
+	if f.config.MaxDuration > 0 && duration > f.config.MaxDuration {
+		return false, "时长过长"
+	}
+
+	if f.titleRe != nil && f.titleRe.MatchString(videoTitle(video)) {
+		return false, "标题被排除"
+	}
+
+	if len(f.excludeMids) > 0 {
+		if _, excluded := f.excludeMids[videoOwnerMid(video)]; excluded {
+			return false, "UP主被排除"
+		}
+	}
+
+	if !f.AllowTags(video) {
+		return false, "缺少必需标签"
+	}
+
+	return true, ""
+}
+
+// AllowTags reports whether a video has one of require_tags. Listings
+// without tags, such as related and popular videos, pass; their tags are
+// checked on the detail once video_tags has added them.
+func (f *videoFilter) AllowTags(video map[string]interface{}) bool {
+	if f == nil || len(f.config.RequireTags) == 0 || !listsTags(video) {
+		return true
+	}
+	return hasAnyTag(videoTags(video), f.config.RequireTags)
+}
+
+// allowVideo applies the configured video filter, counting rejected videos
+func (c *BiliCrawler) allowVideo(video map[string]interface{}) bool {
+	ok, reason := c.videoFilter.Allow(video)
+	if !ok {
+		c.stats.incVideosFiltered()
+		c.debugf("视频 %v 被过滤: %s\n", video["bvid"], reason)
+	}
+	return ok
+}
+
+// allowDetailTags applies require_tags to a video detail whose listing
+// carried no tags, counting it as filtered if it has none of them
+func (c *BiliCrawler) allowDetailTags(listed, detail map[string]interface{}) bool {
+	if listsTags(listed) || c.videoFilter.AllowTags(detail) {
+		return true
+	}
+	c.stats.incVideosFiltered()
+	c.debugf("视频 %v 被过滤: 缺少必需标签\n", detail["bvid"])
+	return false
+}
+
+// videoPlayCount returns the play count of a search result or video detail
+func videoPlayCount(video map[string]interface{}) int64 {
+	if play, ok := video["play"].(float64); ok {
+		return int64(play)
+	}
+	if stat, ok := video["stat"].(map[string]interface{}); ok {
+		if view, ok := stat["view"].(float64); ok {
+			return int64(view)
+		}
+	}
+	return 0
+}
+
+// videoDuration returns the duration in seconds. Search results report it
+// as "M:SS" or "H:MM:SS", video details as a number of seconds.
+func videoDuration(video map[string]interface{}) int {
+	switch d := video["duration"].(type) {
+	case float64:
+		return int(d)
+	case string:
+		seconds := 0
+		for _, part := range strings.Split(d, ":") {
+			n, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return 0
+			}
+			seconds = seconds*60 + n
+		}
+		return seconds
+	}
+	return 0
+}
+
+// videoTitle returns the title without the search highlight markup
+func videoTitle(video map[string]interface{}) string {
+	title, _ := video["title"].(string)
+	return emTagRe.ReplaceAllString(title, "")
+}
+
+// videoOwnerMid returns the uploader's mid as a string
+func videoOwnerMid(video map[string]interface{}) string {
+	if mid, ok := video["mid"]; ok && mid != nil {
+		return fmt.Sprintf("%v", int64Field(video, "mid"))
+	}
+	if owner, ok := video["owner"].(map[string]interface{}); ok {
+		return fmt.Sprintf("%v", int64Field(owner, "mid"))
+	}
+	return ""
+}
+
+// videoTags returns the tag names of a video. Search results carry them as a
+// comma separated "tag" string, enriched details as a "tags" list.
+func videoTags(video map[string]interface{}) []string {
+	var tags []string
+	if tag, ok := video["tag"].(string); ok && tag != "" {
+		for _, t := range strings.Split(tag, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+	}
+	if list, ok := video["tags"].([]interface{}); ok {
+		for _, item := range list {
+			switch t := item.(type) {
+			case string:
+				tags = append(tags, t)
+			case map[string]interface{}:
+				if name, ok := t["tag_name"].(string); ok {
+					tags = append(tags, name)
+				}
+			}
+		}
+	}
+	return tags
+}
+
+// listsTags reports whether a search result or detail carries its tags
+func listsTags(video map[string]interface{}) bool {
+	_, tag := video["tag"]
+	_, tags := video["tags"]
+	return tag || tags
+}
+
+func hasAnyTag(tags []string, required []string) bool {
+	for _, tag := range tags {
+		for _, r := range required {
+			if strings.EqualFold(tag, r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CommentFilter configures which comments and replies are saved. Zero values
+// disable the corresponding check.
+type CommentFilter struct {
+	MinLength      int  `json:"min_length"` // characters of content.message
+	MinLikes       int  `json:"min_likes"`
+	MinMemberLevel int  `json:"min_member_level"`
+	DropRepeated   bool `json:"drop_repeated"`
+	MaxRepeats     int  `json:"max_repeats"` // copies of the same text kept per video
+}
+
+// Bounds on what the comment filter remembers: the comments and texts of at
+// most commentFilterVideos videos, the oldest video forgotten first, and at
+// most commentFilterComments comments and texts per video. Comments past
+// either cap are still filtered, just not remembered.
+const (
+	commentFilterVideos   = 32
+	commentFilterComments = 20000
+)
+
+// videoComments is what the comment filter remembers of one video
+type videoComments struct {
+	repeats  map[uint64]int   // copies kept of each normalized text
+	verdicts map[int64]string // why each comment seen was dropped, "" if it passed
+}
+
+// commentFilter applies CommentFilter and tracks repeated texts per video
+type commentFilter struct {
+	config CommentFilter
+	videos map[string]*videoComments
+	order  []string // remembered videos, oldest first
+	mu     sync.Mutex
+}
+
+func newCommentFilter(config CommentFilter) *commentFilter {
+	if config.DropRepeated && config.MaxRepeats <= 0 {
+		config.MaxRepeats = 3
+	}
+	return &commentFilter{
+		config: config,
+		videos: make(map[string]*videoComments),
+	}
+}
+
+// active reports whether any check is configured
+func (f *commentFilter) active() bool {
+	return f.config.MinLength > 0 || f.config.MinLikes > 0 || f.config.MinMemberLevel > 0 || f.config.DropRepeated
+}
+
+// Allow reports whether a comment passes the filter, and if not, why
+func (f *commentFilter) Allow(comment map[string]interface{}, bvid string) (bool, string) {
+	ok, reason, _ := f.check(comment, bvid)
+	return ok, reason
+}
+
+// check is Allow that also reports whether the comment was seen before on
+// the same video. A comment seen again, such as a pinned comment listed
+// twice or one met again by reconcile or recrawl, gets its earlier verdict
+// without counting as another copy of its text.
+func (f *commentFilter) check(comment map[string]interface{}, bvid string) (ok bool, reason string, seen bool) {
+	if f == nil || !f.active() {
+		return true, "", false
+	}
+
+	rpid := int64Field(comment, "rpid")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	video := f.video(bvid)
+	if reason, seen := video.verdicts[rpid]; seen && rpid != 0 {
+		return reason == "", reason, true
+	}
+
+	reason = f.reason(comment, video)
+	if rpid != 0 && len(video.verdicts) < commentFilterComments {
+		video.verdicts[rpid] = reason
+	}
+	return reason == "", reason, false
+}
+
+// reason returns why a comment new to the video is dropped, or "" if it
+// passes. Callers hold f.mu.
+func (f *commentFilter) reason(comment map[string]interface{}, video *videoComments) string {
+	message := commentMessage(comment)
+
+	if f.config.MinLength > 0 && utf8.RuneCountInString(strings.TrimSpace(message)) < f.config.MinLength {
+		return "内容过短"
+	}
+
+	if f.config.MinLikes > 0 && int64Field(comment, "like") < int64(f.config.MinLikes) {
+		return "点赞数过低"
+	}
+
+	if f.config.MinMemberLevel > 0 && commentMemberLevel(comment) < f.config.MinMemberLevel {
+		return "用户等级过低"
+	}
+
+	if f.config.DropRepeated {
+		normalized := normalizeCommentText(message)
+		if normalized == "" {
+			return ""
+		}
+		h := fnv.New64a()
+		h.Write([]byte(normalized))
+		key := h.Sum64()
+
+		count, tracked := video.repeats[key]
+		if !tracked && len(video.repeats) >= commentFilterComments {
+			return ""
+		}
+		video.repeats[key] = count + 1
+		if count+1 > f.config.MaxRepeats {
+			return "重复内容"
+		}
+	}
+
+	return ""
+}
+
+// video returns what is remembered of bvid, forgetting the oldest video
+// once more than commentFilterVideos are remembered. Callers hold f.mu.
+func (f *commentFilter) video(bvid string) *videoComments {
+	if video, ok := f.videos[bvid]; ok {
+		return video
+	}
+	if len(f.order) >= commentFilterVideos {
+		delete(f.videos, f.order[0])
+		f.order = f.order[1:]
+	}
+	video := &videoComments{
+		repeats:  make(map[uint64]int),
+		verdicts: make(map[int64]string),
+	}
+	f.videos[bvid] = video
+	f.order = append(f.order, bvid)
+	return video
+}
+
+// allowComment applies the configured comment filter, counting each
+// rejected comment once however often it is met
+func (c *BiliCrawler) allowComment(comment map[string]interface{}, bvid string) bool {
+	ok, _, seen := c.commentFilter.check(comment, bvid)
+	if !ok && !seen {
+		c.stats.incCommentsFiltered()
+	}
+	return ok
+}
+
+// commentMessage returns the text of a comment
+func commentMessage(comment map[string]interface{}) string {
+	content, _ := comment["content"].(map[string]interface{})
+	message, _ := content["message"].(string)
+	return message
+}
+
+// commentMemberLevel returns the commenter's account level
+func commentMemberLevel(comment map[string]interface{}) int {
+	member, _ := comment["member"].(map[string]interface{})
+	levelInfo, _ := member["level_info"].(map[string]interface{})
+	return int(int64Field(levelInfo, "current_level"))
+}
+
+// normalizeCommentText lowercases the text and drops whitespace, punctuation
+// and symbols so trivially varied copies compare equal
+func normalizeCommentText(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
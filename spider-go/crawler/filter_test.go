@@ -0,0 +1,264 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestVideoDuration(t *testing.T) {
+	tests := []struct {
+		duration interface{}
+		expected int
+	}{
+		{"3:25", 205},
+		{"1:02:03", 3723},
+		{float64(90), 90},
+		{"bad", 0},
+		{nil, 0},
+	}
+
+	for _, tt := range tests {
+		if got := videoDuration(map[string]interface{}{"duration": tt.duration}); got != tt.expected {
+			t.Errorf("videoDuration(%v) = %d, expected %d", tt.duration, got, tt.expected)
+		}
+	}
+}
+
+func TestVideoFieldHelpers(t *testing.T) {
+	searchResult := map[string]interface{}{
+		"title": `<em class="keyword">电棍</em>合集`,
+		"play":  float64(1000),
+		"mid":   float64(123),
+		"tag":   "游戏, 鬼畜 ,",
+	}
+	detail := map[string]interface{}{
+		"stat":  map[string]interface{}{"view": float64(2000)},
+		"owner": map[string]interface{}{"mid": float64(456)},
+		"tags":  []interface{}{map[string]interface{}{"tag_name": "音乐"}},
+	}
+
+	if videoTitle(searchResult) != "电棍合集" {
+		t.Errorf("videoTitle = %q", videoTitle(searchResult))
+	}
+	if videoPlayCount(searchResult) != 1000 || videoPlayCount(detail) != 2000 {
+		t.Error("videoPlayCount returned unexpected value")
+	}
+	if videoOwnerMid(searchResult) != "123" || videoOwnerMid(detail) != "456" {
+		t.Error("videoOwnerMid returned unexpected value")
+	}
+	if tags := videoTags(searchResult); len(tags) != 2 || tags[1] != "鬼畜" {
+		t.Errorf("videoTags(search) = %v", tags)
+	}
+	if tags := videoTags(detail); len(tags) != 1 || tags[0] != "音乐" {
+		t.Errorf("videoTags(detail) = %v", tags)
+	}
+}
+
+func TestVideoFilter_Allow(t *testing.T) {
+	f, err := newVideoFilter(VideoFilter{
+		MinPlay:           100,
+		MinDuration:       30,
+		MaxDuration:       600,
+		ExcludeTitleRegex: "抽奖|广告",
+		ExcludeMids:       []string{"999"},
+		RequireTags:       []string{"鬼畜"},
+	})
+	if err != nil {
+		t.Fatalf("newVideoFilter failed: %v", err)
+	}
+
+	base := func() map[string]interface{} {
+		return map[string]interface{}{
+			"title":    "正常视频",
+			"play":     float64(500),
+			"duration": "2:00",
+			"mid":      float64(1),
+			"tag":      "鬼畜",
+		}
+	}
+
+	if ok, reason := f.Allow(base()); !ok {
+		t.Errorf("Expected video to pass, rejected: %s", reason)
+	}
+
+	cases := map[string]func(map[string]interface{}){
+		"play":    func(v map[string]interface{}) { v["play"] = float64(10) },
+		"short":   func(v map[string]interface{}) { v["duration"] = "0:10" },
+		"long":    func(v map[string]interface{}) { v["duration"] = "20:00" },
+		"title":   func(v map[string]interface{}) { v["title"] = "<em>抽奖</em>视频" },
+		"mid":     func(v map[string]interface{}) { v["mid"] = float64(999) },
+		"no tag":  func(v map[string]interface{}) { v["tag"] = "音乐" },
+		"no tags": func(v map[string]interface{}) { v["tag"] = "" },
+	}
+	for name, mutate := range cases {
+		v := base()
+		mutate(v)
+		if ok, _ := f.Allow(v); ok {
+			t.Errorf("Expected video to be rejected (%s)", name)
+		}
+	}
+}
+
+func TestVideoFilter_RequireTagsOnUntaggedListing(t *testing.T) {
+	f, _ := newVideoFilter(VideoFilter{RequireTags: []string{"鬼畜"}})
+	c := &BiliCrawler{videoFilter: f}
+	c.SetLogOutput(io.Discard)
+	related := map[string]interface{}{"bvid": "BV1", "title": "相关视频"}
+
+	// Related videos carry no tags, so they pass until the detail is known
+	if ok, reason := f.Allow(related); !ok {
+		t.Errorf("Untagged listing rejected: %s", reason)
+	}
+	if !c.allowDetailTags(related, map[string]interface{}{"bvid": "BV1"}) {
+		t.Error("A detail without tags (video_tags off) should pass")
+	}
+
+	tagged := map[string]interface{}{"bvid": "BV1", "tags": []interface{}{map[string]interface{}{"tag_name": "音乐"}}}
+	if c.allowDetailTags(related, tagged) {
+		t.Error("A detail lacking the required tags should be rejected")
+	}
+	tagged["tags"] = []interface{}{map[string]interface{}{"tag_name": "鬼畜"}}
+	if !c.allowDetailTags(related, tagged) {
+		t.Error("A detail with a required tag should pass")
+	}
+	if c.stats.VideosFiltered != 1 {
+		t.Errorf("VideosFiltered = %d, expected 1", c.stats.VideosFiltered)
+	}
+
+	// Search results were checked on their own tags already
+	if !c.allowDetailTags(map[string]interface{}{"tag": "鬼畜"}, map[string]interface{}{"tags": []interface{}{}}) {
+		t.Error("A search result should not be checked again on its detail")
+	}
+}
+
+func TestVideoFilter_InvalidRegex(t *testing.T) {
+	if _, err := newVideoFilter(VideoFilter{ExcludeTitleRegex: "("}); err == nil {
+		t.Error("Expected error for invalid regex")
+	}
+}
+
+func TestVideoFilter_Nil(t *testing.T) {
+	var f *videoFilter
+	if ok, _ := f.Allow(map[string]interface{}{}); !ok {
+		t.Error("Nil filter should allow everything")
+	}
+}
+
+func testComment(message string, like, level int) map[string]interface{} {
+	return map[string]interface{}{
+		"content": map[string]interface{}{"message": message},
+		"like":    float64(like),
+		"member": map[string]interface{}{
+			"level_info": map[string]interface{}{"current_level": float64(level)},
+		},
+	}
+}
+
+func TestCommentFilter_Allow(t *testing.T) {
+	f := newCommentFilter(CommentFilter{MinLength: 3, MinLikes: 2, MinMemberLevel: 2})
+
+	if ok, reason := f.Allow(testComment("说的道理", 5, 3), "BV1"); !ok {
+		t.Errorf("Expected comment to pass, rejected: %s", reason)
+	}
+	if ok, _ := f.Allow(testComment("哈哈", 5, 3), "BV1"); ok {
+		t.Error("Expected short comment to be rejected")
+	}
+	if ok, _ := f.Allow(testComment("说的道理", 1, 3), "BV1"); ok {
+		t.Error("Expected low-like comment to be rejected")
+	}
+	if ok, _ := f.Allow(testComment("说的道理", 5, 1), "BV1"); ok {
+		t.Error("Expected low-level comment to be rejected")
+	}
+}
+
+func TestCommentFilter_DropRepeated(t *testing.T) {
+	f := newCommentFilter(CommentFilter{DropRepeated: true, MaxRepeats: 2})
+
+	for i, msg := range []string{"复制粘贴！", "复制 粘贴", "复制粘贴~~"} {
+		ok, _ := f.Allow(testComment(msg, 0, 0), "BV1")
+		if expected := i < 2; ok != expected {
+			t.Errorf("copy %d: allowed = %v, expected %v", i+1, ok, expected)
+		}
+	}
+
+	// Repeats are counted per video
+	if ok, _ := f.Allow(testComment("复制粘贴", 0, 0), "BV2"); !ok {
+		t.Error("Same text in another video should be allowed")
+	}
+}
+
+func TestCommentFilter_SeenCommentKeepsVerdict(t *testing.T) {
+	f := newCommentFilter(CommentFilter{DropRepeated: true, MaxRepeats: 1})
+	withRpid := func(rpid int) map[string]interface{} {
+		comment := testComment("复制粘贴", 0, 0)
+		comment["rpid"] = float64(rpid)
+		return comment
+	}
+
+	if ok, _, seen := f.check(withRpid(1), "BV1"); !ok || seen {
+		t.Errorf("first copy: ok = %v, seen = %v, expected a new kept comment", ok, seen)
+	}
+	// The same comment listed again is not another copy
+	if ok, _, seen := f.check(withRpid(1), "BV1"); !ok || !seen {
+		t.Errorf("same comment again: ok = %v, seen = %v, expected it kept and seen", ok, seen)
+	}
+	if ok, _, seen := f.check(withRpid(2), "BV1"); ok || seen {
+		t.Errorf("second copy: ok = %v, seen = %v, expected a new dropped comment", ok, seen)
+	}
+	if ok, reason, seen := f.check(withRpid(2), "BV1"); ok || !seen || reason != "重复内容" {
+		t.Errorf("dropped comment again: ok = %v, seen = %v, reason = %q", ok, seen, reason)
+	}
+}
+
+func TestBiliCrawler_AllowCommentCountsDropsOnce(t *testing.T) {
+	c := &BiliCrawler{commentFilter: newCommentFilter(CommentFilter{MinLikes: 2})}
+	comment := testComment("说的道理", 0, 0)
+	comment["rpid"] = float64(1)
+
+	for i := 0; i < 3; i++ {
+		if c.allowComment(comment, "BV1") {
+			t.Fatal("Expected low-like comment to be rejected")
+		}
+	}
+	if c.stats.CommentsFiltered != 1 {
+		t.Errorf("CommentsFiltered = %d, expected the drop counted once", c.stats.CommentsFiltered)
+	}
+}
+
+func TestCommentFilter_ForgetsOldestVideo(t *testing.T) {
+	f := newCommentFilter(CommentFilter{DropRepeated: true})
+	for i := 0; i <= commentFilterVideos; i++ {
+		f.Allow(testComment("复制粘贴", 0, 0), fmt.Sprintf("BV%d", i))
+	}
+
+	if len(f.videos) != commentFilterVideos || len(f.order) != commentFilterVideos {
+		t.Errorf("remembered %d videos (%d in order), expected %d", len(f.videos), len(f.order), commentFilterVideos)
+	}
+	if _, ok := f.videos["BV0"]; ok {
+		t.Error("The oldest video should be forgotten")
+	}
+}
+
+func TestCommentFilter_Inactive(t *testing.T) {
+	f := newCommentFilter(CommentFilter{})
+	if ok, _ := f.Allow(testComment("", 0, 0), "BV1"); !ok {
+		t.Error("An empty filter should allow every comment")
+	}
+	if len(f.videos) != 0 {
+		t.Error("An empty filter should remember nothing")
+	}
+}
+
+func TestCommentFilter_DefaultMaxRepeats(t *testing.T) {
+	f := newCommentFilter(CommentFilter{DropRepeated: true})
+	if f.config.MaxRepeats != 3 {
+		t.Errorf("MaxRepeats = %d, expected default 3", f.config.MaxRepeats)
+	}
+}
+
+func TestNormalizeCommentText(t *testing.T) {
+	if got := normalizeCommentText(" Hello, 世界！[doge] "); got != "hello世界doge" {
+		t.Errorf("normalizeCommentText = %q", got)
+	}
+}
@@ -0,0 +1,112 @@
+package crawler
+
+import (
+	"sync"
+	"time"
+
+	"spider-go/ratelimit"
+)
+
+// Crawl states reported by Health
+const (
+	HealthStarting = "starting"
+	HealthRunning  = "running"
+	HealthPaused   = "paused"
+	HealthDegraded = "degraded"
+	HealthFinished = "finished"
+)
+
+// Health is the crawl state reported to orchestration probes
+type Health struct {
+	Status      string               `json:"status"`
+	Reason      string               `json:"reason,omitempty"`
+	Started     time.Time            `json:"started"`
+	LastSuccess time.Time            `json:"last_success"`
+	Stages      map[string]time.Time `json:"stages"` // last successful request per stage
+}
+
+// Live reports whether the crawl is making progress, or is idle on purpose
+func (h Health) Live() bool {
+	return h.Status != HealthDegraded
+}
+
+// Ready reports whether the crawl is actively working
+func (h Health) Ready() bool {
+	return h.Status == HealthRunning
+}
+
+// healthTracker remembers when each stage last had a successful request
+type healthTracker struct {
+	started     time.Time
+	lastSuccess map[string]time.Time
+	mu          sync.Mutex
+}
+
+func (h *healthTracker) start(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.started = now
+}
+
+func (h *healthTracker) success(stage string, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lastSuccess == nil {
+		h.lastSuccess = make(map[string]time.Time)
+	}
+	h.lastSuccess[stage] = now
+}
+
+// snapshot returns the start time, the latest success of any stage and a copy
+// of the per-stage successes
+func (h *healthTracker) snapshot() (time.Time, time.Time, map[string]time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var latest time.Time
+	stages := make(map[string]time.Time, len(h.lastSuccess))
+	for stage, t := range h.lastSuccess {
+		stages[stage] = t
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	return h.started, latest, stages
+}
+
+// Health reports whether the crawl is running, paused, degraded or finished.
+// A running crawl is degraded while its error circuit is tripped or when no
+// request has succeeded for health_stale_seconds.
+func (c *BiliCrawler) Health() Health {
+	return c.healthAt(time.Now())
+}
+
+func (c *BiliCrawler) healthAt(now time.Time) Health {
+	started, lastSuccess, stages := c.health.snapshot()
+	h := Health{Started: started, LastSuccess: lastSuccess, Stages: stages}
+
+	stale := time.Duration(c.live().HealthStaleSeconds) * time.Second
+	since := lastSuccess
+	if since.Before(started) {
+		since = started
+	}
+
+	switch {
+	case c.isFinished():
+		h.Status = HealthFinished
+	case started.IsZero():
+		h.Status = HealthStarting
+	case c.circuit.isTripped():
+		// Checked before pauses: a tripped circuit pauses requests too
+		h.Status = HealthDegraded
+		h.Reason = "error circuit tripped"
+	case ratelimit.IsPaused():
+		h.Status = HealthPaused
+	case stale > 0 && now.Sub(since) > stale:
+		h.Status = HealthDegraded
+		h.Reason = "no successful request since " + since.Format(time.RFC3339)
+	default:
+		h.Status = HealthRunning
+	}
+	return h
+}
@@ -0,0 +1,64 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+)
+
+func TestBiliCrawler_Health(t *testing.T) {
+	ratelimit.ResumeAll()
+	c := newReloadCrawler()
+	c.config.HealthStaleSeconds = 60
+	now := time.Now()
+
+	if h := c.healthAt(now); h.Status != HealthStarting {
+		t.Errorf("Status before run = %s, expected starting", h.Status)
+	}
+
+	c.health.start(now)
+	c.recordResult("comment", nil)
+	if h := c.healthAt(now); h.Status != HealthRunning || h.Stages["comment"].IsZero() {
+		t.Errorf("Expected running with a comment success, got %+v", h)
+	}
+
+	if h := c.healthAt(now.Add(2 * time.Minute)); h.Status != HealthDegraded || h.Live() {
+		t.Errorf("Status without recent success = %s, expected degraded", h.Status)
+	}
+
+	ratelimit.Pause()
+	if h := c.healthAt(now.Add(2 * time.Minute)); h.Status != HealthPaused || !h.Live() || h.Ready() {
+		t.Errorf("Status while paused = %s, expected paused", h.Status)
+	}
+	ratelimit.Resume()
+
+	c.markFinished()
+	if h := c.healthAt(now); h.Status != HealthFinished {
+		t.Errorf("Status after run = %s, expected finished", h.Status)
+	}
+}
+
+func TestBiliCrawler_HealthTrippedCircuit(t *testing.T) {
+	defer ratelimit.ResumeAll()
+	c := newReloadCrawler()
+	c.circuit = newErrorCircuit(ErrorCircuitConfig{
+		Enabled: true, Window: 2, MinSamples: 2, Threshold: 0.5, CooldownSeconds: 60,
+	})
+	now := time.Now()
+	c.health.start(now)
+
+	c.recordResult("comment", &api.Error{Code: -412})
+	c.recordResult("comment", &api.Error{Code: -412})
+	for deadline := time.Now().Add(time.Second); !ratelimit.PausedFor(ratelimit.PauseCircuit); {
+		if time.Now().After(deadline) {
+			t.Fatal("The tripped circuit did not pause requests")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if h := c.healthAt(now); h.Status != HealthDegraded || h.Reason != "error circuit tripped" {
+		t.Errorf("Status with a tripped circuit = %s (%s), expected degraded", h.Status, h.Reason)
+	}
+}
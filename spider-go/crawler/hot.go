@@ -0,0 +1,50 @@
+package crawler
+
+import (
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// hotReplyPages returns the reply page cap for hot-comments-only mode: -1
+// keeps only the replies embedded in each hot comment
+func hotReplyPages(cfg Config) int {
+	if cfg.HotReplyPages == 0 {
+		return -1
+	}
+	return cfg.HotReplyPages
+}
+
+// crawlHotComments saves the first hot_comment_pages pages of a video's
+// hot-sorted comments. Hot cursors are not interchangeable with the
+// time-sorted ones, so no comment progress is recorded and the video is
+// never marked done; a later exhaustive run still pages through it.
+func (c *BiliCrawler) crawlHotComments(threadID int, ctx commentContext, session *api.Session) {
+	cfg := c.live()
+	c.debugf("[评论线程%d] %s (aid=%d) 开始爬取前 %d 页热门评论...\n", threadID, ctx.Bvid, ctx.Aid, cfg.HotCommentPages)
+
+	commentCount := 0
+	cursor := ""
+	for page := 0; page < cfg.HotCommentPages; page++ {
+		result, err := api.GetMainCommentsSorted(ctx.Aid, cursor, api.CommentModeHot, session, c.config.CookieConfigPath)
+		c.recordResult("comment", err)
+		if err != nil {
+			c.errorf("[评论线程%d] %s 热门评论获取错误: %v\n", threadID, ctx.Bvid, err)
+			c.recordFailure(storage.FailedTask{Kind: storage.FailedComment, ID: ctx.Bvid, Aid: ctx.Aid, Title: ctx.Title, Keyword: ctx.Keyword}, err)
+			return
+		}
+
+		commentCount += c.handleMainComments(markPinned(result.TopReplies), ctx, hotReplyPages(cfg))
+		commentCount += c.handleMainComments(result.Replies, ctx, hotReplyPages(cfg))
+		if result.IsEnd || len(result.Replies) == 0 {
+			break
+		}
+		cursor = result.NextCursor
+		if c.isCancelled() {
+			return
+		}
+		c.delay()
+	}
+
+	c.clearFailure(storage.FailedComment, ctx.Bvid)
+	c.debugf("[评论线程%d] %s 热门评论爬取完成，共 %d 条一级评论\n", threadID, ctx.Bvid, commentCount)
+}
@@ -0,0 +1,69 @@
+package crawler
+
+import (
+	"testing"
+
+	"spider-go/storage"
+)
+
+func TestHotReplyPages(t *testing.T) {
+	cfg := DefaultConfig()
+	if got := hotReplyPages(cfg); got != 1 {
+		t.Errorf("hotReplyPages = %d, expected the default of 1", got)
+	}
+	cfg.HotReplyPages = 0
+	if got := hotReplyPages(cfg); got != -1 {
+		t.Errorf("hotReplyPages = %d, expected -1 to keep only embedded replies", got)
+	}
+}
+
+func TestBiliCrawler_HandleMainComments_ReplyPages(t *testing.T) {
+	c := newReloadCrawler()
+	c.config.Resume = true
+	c.savedRpids = dedupSetOf("1", "2")
+	c.commentQueue = make(chan *CommentTask, 4)
+	comments := func() []map[string]interface{} {
+		return []map[string]interface{}{
+			{"rpid": float64(1), "rcount": float64(5)},
+			{"rpid": float64(2), "rcount": float64(0)},
+		}
+	}
+
+	if saved := c.handleMainComments(comments(), commentContext{Bvid: "BV1", Aid: 1}, 2); saved != 0 {
+		t.Errorf("saved = %d, expected already saved comments to be skipped", saved)
+	}
+	if len(c.commentQueue) != 1 {
+		t.Fatalf("queued %d reply tasks, expected 1", len(c.commentQueue))
+	}
+	if task := <-c.commentQueue; task.MaxPages != 2 || task.Bvid != "BV1" {
+		t.Errorf("task = %+v, expected MaxPages 2 for BV1", task)
+	}
+
+	c.handleMainComments(comments(), commentContext{Bvid: "BV1", Aid: 1}, -1)
+	if len(c.commentQueue) != 0 {
+		t.Error("A negative reply page cap should queue no reply tasks")
+	}
+}
+
+func TestBiliCrawler_HandleMainComments_LargeIDs(t *testing.T) {
+	c := newReloadCrawler()
+	c.config.Resume = true
+	c.savedRpids = dedupSetOf("12345678901")
+	c.savedMids = dedupSetOf("3493123456789012")
+	c.userMids = make(map[string]storage.MidSource)
+	c.commentQueue = make(chan *CommentTask, 1)
+	comments := []map[string]interface{}{
+		{"rpid": float64(12345678901), "mid": float64(3493123456789012), "rcount": float64(3)},
+	}
+
+	// Keys in exponent form would miss the saved comment and save it again
+	if saved := c.handleMainComments(comments, commentContext{Bvid: "BV1", Aid: 1}, 0); saved != 0 {
+		t.Errorf("saved = %d, expected the comment to be found saved by its rpid", saved)
+	}
+	if _, ok := c.userMids["3493123456789012"]; !ok || len(c.userMids) != 1 {
+		t.Errorf("userMids = %v, expected the commenter under its full mid", c.userMids)
+	}
+	if task := <-c.commentQueue; task.Rpid != 12345678901 || task.Rcount != 3 {
+		t.Errorf("task = %+v, expected the reply task of rpid 12345678901", task)
+	}
+}
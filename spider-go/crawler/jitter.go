@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Delay distributions accepted by delay_distribution
+const (
+	DelayUniform   = "uniform"
+	DelayNormal    = "normal"    // truncated to [delay_min, delay_max]
+	DelayLogNormal = "lognormal" // truncated to [delay_min, delay_max]
+)
+
+// randSource is the subset of *rand.Rand used for sampling delays
+type randSource interface {
+	Float64() float64
+	NormFloat64() float64
+}
+
+// globalRand samples from the math/rand package-level source, which is safe
+// for concurrent use
+type globalRand struct{}
+
+func (globalRand) Float64() float64     { return rand.Float64() }
+func (globalRand) NormFloat64() float64 { return rand.NormFloat64() }
+
+// delayParams returns the mean and standard deviation of the delay in
+// seconds, deriving them from delay_min/delay_max when not set
+func delayParams(cfg Config) (mean, stddev float64) {
+	mean, stddev = cfg.DelayMean, cfg.DelayStddev
+	if mean <= 0 {
+		mean = (cfg.DelayMin + cfg.DelayMax) / 2
+	}
+	if stddev <= 0 {
+		stddev = (cfg.DelayMax - cfg.DelayMin) / 4
+	}
+	return mean, stddev
+}
+
+// sampleDelay draws an inter-request delay in seconds from the configured
+// distribution. Normal and log-normal samples outside [delay_min, delay_max]
+// are redrawn a few times and then clamped.
+func sampleDelay(cfg Config, r randSource) float64 {
+	lo, hi := cfg.DelayMin, cfg.DelayMax
+	if hi <= lo {
+		return lo
+	}
+
+	var sample func() float64
+	switch cfg.DelayDistribution {
+	case DelayNormal:
+		mean, stddev := delayParams(cfg)
+		sample = func() float64 { return mean + stddev*r.NormFloat64() }
+	case DelayLogNormal:
+		// Pick mu and sigma so the log-normal has the requested mean and stddev
+		mean, stddev := delayParams(cfg)
+		sigma2 := math.Log(1 + (stddev*stddev)/(mean*mean))
+		mu := math.Log(mean) - sigma2/2
+		sigma := math.Sqrt(sigma2)
+		sample = func() float64 { return math.Exp(mu + sigma*r.NormFloat64()) }
+	default:
+		return lo + r.Float64()*(hi-lo)
+	}
+
+	d := sample()
+	for i := 0; i < 10 && (d < lo || d > hi); i++ {
+		d = sample()
+	}
+	return math.Min(math.Max(d, lo), hi)
+}
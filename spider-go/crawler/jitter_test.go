@@ -0,0 +1,54 @@
+package crawler
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestSampleDelay_Bounds(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, dist := range []string{DelayUniform, DelayNormal, DelayLogNormal, ""} {
+		cfg := DefaultConfig()
+		cfg.DelayMin = 1
+		cfg.DelayMax = 5
+		cfg.DelayDistribution = dist
+
+		for i := 0; i < 1000; i++ {
+			if d := sampleDelay(cfg, r); d < 1 || d > 5 {
+				t.Fatalf("%q: delay %v outside [1, 5]", dist, d)
+			}
+		}
+	}
+}
+
+func TestSampleDelay_Mean(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, dist := range []string{DelayNormal, DelayLogNormal} {
+		cfg := DefaultConfig()
+		cfg.DelayMin = 0.5
+		cfg.DelayMax = 20
+		cfg.DelayDistribution = dist
+		cfg.DelayMean = 3
+		cfg.DelayStddev = 1
+
+		sum := 0.0
+		const n = 5000
+		for i := 0; i < n; i++ {
+			sum += sampleDelay(cfg, r)
+		}
+		if mean := sum / n; math.Abs(mean-3) > 0.1 {
+			t.Errorf("%s: sample mean = %v, expected about 3", dist, mean)
+		}
+	}
+}
+
+func TestSampleDelay_Degenerate(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.DelayMin = 2
+	cfg.DelayMax = 2
+	cfg.DelayDistribution = DelayLogNormal
+	if d := sampleDelay(cfg, rand.New(rand.NewSource(1))); d != 2 {
+		t.Errorf("Equal bounds should give delay_min, got %v", d)
+	}
+}
@@ -0,0 +1,78 @@
+package crawler
+
+import (
+	"sort"
+
+	"spider-go/storage"
+)
+
+// CrawlComments runs only the comment and reply stages over the videos
+// already in sent_records, without searching or fetching video details
+func (c *BiliCrawler) CrawlComments() {
+	c.run(c.queueKnownVideos)
+}
+
+// queueKnownVideos pushes every saved or partly crawled video into the
+// comment stage
+func (c *BiliCrawler) queueKnownVideos() {
+	saved, err := storage.GetSavedVideoBvids()
+	if err != nil {
+		c.errorf("读取已保存视频出错: %v\n", err)
+		return
+	}
+	progress, err := storage.LoadAllVideoProgress()
+	if err != nil {
+		c.errorf("读取评论进度出错: %v\n", err)
+		return
+	}
+	gone, err := storage.GetTombstonedBvids()
+	if err != nil {
+		c.errorf("读取已下架视频出错: %v\n", err)
+	}
+
+	tasks := knownVideoTasks(saved, progress, gone)
+	c.logf("只爬评论: %d 个已知视频\n", len(tasks))
+	for _, task := range tasks {
+		if c.isCancelled() {
+			return
+		}
+		c.videoQueue <- task
+	}
+}
+
+// knownVideoTasks builds comment tasks for the saved videos and the videos
+// with comment progress, leaving out deleted ones. Videos whose comments are
+// not done come first, each group in bvid order.
+func knownVideoTasks(saved map[string]struct{}, progress map[string]*storage.VideoProgress, gone map[string]struct{}) []*VideoTask {
+	bvids := make(map[string]struct{}, len(saved)+len(progress))
+	for bvid := range saved {
+		bvids[bvid] = struct{}{}
+	}
+	for bvid := range progress {
+		bvids[bvid] = struct{}{}
+	}
+
+	tasks := make([]*VideoTask, 0, len(bvids))
+	for bvid := range bvids {
+		if _, ok := gone[bvid]; ok {
+			continue
+		}
+		task := &VideoTask{Bvid: bvid, Detail: map[string]interface{}{"bvid": bvid}}
+		if p := progress[bvid]; p != nil {
+			task.Aid, task.Title = p.Aid, p.Title
+		}
+		tasks = append(tasks, task)
+	}
+
+	done := func(bvid string) bool {
+		p := progress[bvid]
+		return p != nil && p.Done
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if di, dj := done(tasks[i].Bvid), done(tasks[j].Bvid); di != dj {
+			return dj
+		}
+		return tasks[i].Bvid < tasks[j].Bvid
+	})
+	return tasks
+}
@@ -0,0 +1,36 @@
+package crawler
+
+import (
+	"testing"
+
+	"spider-go/storage"
+)
+
+func TestKnownVideoTasks(t *testing.T) {
+	saved := map[string]struct{}{"BV1": {}, "BV2": {}, "BV3": {}, "BV9": {}}
+	progress := map[string]*storage.VideoProgress{
+		"BV1": {Done: true, Aid: 1},
+		"BV3": {Cursor: "c", Aid: 3},
+		"BV4": {Cursor: "c", Aid: 4}, // comments started, detail never saved
+	}
+	gone := map[string]struct{}{"BV9": {}}
+
+	tasks := knownVideoTasks(saved, progress, gone)
+
+	var bvids []string
+	for _, task := range tasks {
+		bvids = append(bvids, task.Bvid)
+	}
+	expected := []string{"BV2", "BV3", "BV4", "BV1"}
+	if len(bvids) != len(expected) {
+		t.Fatalf("bvids = %v, expected %v", bvids, expected)
+	}
+	for i := range expected {
+		if bvids[i] != expected[i] {
+			t.Fatalf("bvids = %v, expected unfinished videos first: %v", bvids, expected)
+		}
+	}
+	if tasks[1].Aid != 3 || tasks[0].Aid != 0 {
+		t.Error("Tasks should carry the aid recorded with their comment progress")
+	}
+}
@@ -0,0 +1,55 @@
+package crawler
+
+import (
+	"strconv"
+	"strings"
+
+	"spider-go/api"
+)
+
+// legacyCursorPrefix marks a comment cursor of the older page-numbered
+// reply API; the rest is the page number. Saved as progress, it makes a
+// resumed crawl stay on that API.
+const legacyCursorPrefix = "legacy:"
+
+// Values of comment_source: the API a comment was fetched from
+const (
+	commentSourceWbi    = "wbi"
+	commentSourceLegacy = "legacy"
+)
+
+// isRiskControlled reports whether err is one of the risk control codes
+func isRiskControlled(err error) bool {
+	code := strconv.Itoa(api.ErrorCode(err))
+	for _, c := range riskControlCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// isLegacyCursor reports whether cursor belongs to the older reply API
+func isLegacyCursor(cursor string) bool {
+	return strings.HasPrefix(cursor, legacyCursorPrefix)
+}
+
+// fetchMainComments fetches a page of a video's main comments from the API
+// the cursor belongs to. Comments from the older API are marked with their
+// source and their next cursor stays on that API.
+func (c *BiliCrawler) fetchMainComments(aid int64, cursor string, session *api.Session) (*api.MainCommentsResult, error) {
+	page, legacy := strings.CutPrefix(cursor, legacyCursorPrefix)
+	if !legacy {
+		return c.fetchSortedComments(aid, cursor, session)
+	}
+	pn, _ := strconv.Atoi(page)
+	result, err := api.GetMainCommentsLegacy(aid, max(pn, 1), session, c.config.CookieConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	result.NextCursor = legacyCursorPrefix + result.NextCursor
+	for _, reply := range append(result.TopReplies, result.Replies...) {
+		reply["comment_source"] = commentSourceLegacy
+	}
+	return result, nil
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+)
+
+func TestIsRiskControlled(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&api.Error{Code: -352}, true},
+		{fmt.Errorf("wrapped: %w", &api.Error{Code: -412}), true},
+		{&api.Error{Code: -404}, false},
+		{fmt.Errorf("connection reset"), false},
+	}
+	for _, tc := range cases {
+		if got := isRiskControlled(tc.err); got != tc.want {
+			t.Errorf("isRiskControlled(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestFetchMainComments_Legacy(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path+"?pn="+r.URL.Query().Get("pn"))
+		fmt.Fprint(w, `{"code":0,"data":{"page":{"count":30},`+
+			`"replies":[{"rpid":5,"mid":1,"ctime":1,"rcount":0,"content":{"message":"hi"},"member":{}}]}}`)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	c := newReloadCrawler()
+	result, err := c.fetchMainComments(1, legacyCursorPrefix+"1", nil)
+	if err != nil {
+		t.Fatalf("fetchMainComments: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "/x/v2/reply?pn=1" {
+		t.Errorf("requested %v, want the legacy API page 1", paths)
+	}
+	if result.NextCursor != legacyCursorPrefix+"2" || !isLegacyCursor(result.NextCursor) {
+		t.Errorf("NextCursor = %q, want it to stay on the legacy API", result.NextCursor)
+	}
+	if len(result.Replies) != 1 || result.Replies[0]["comment_source"] != commentSourceLegacy {
+		t.Errorf("replies = %v, want them marked as legacy", result.Replies)
+	}
+}
+
+func TestEnrichComment_CommentSource(t *testing.T) {
+	comment := map[string]interface{}{
+		"rpid":           float64(1),
+		"comment_source": commentSourceLegacy,
+		"replies":        []interface{}{map[string]interface{}{"rpid": float64(2)}},
+	}
+	enrichComment(comment, commentContext{Bvid: "BV1", Aid: 42})
+	preview := comment["replies"].([]interface{})[0].(map[string]interface{})
+	if comment["comment_source"] != commentSourceLegacy || preview["comment_source"] != commentSourceLegacy {
+		t.Errorf("comment_source = %v, preview %v; want legacy for both", comment["comment_source"], preview["comment_source"])
+	}
+
+	comment = map[string]interface{}{"rpid": float64(3)}
+	enrichComment(comment, commentContext{Bvid: "BV1", Aid: 42})
+	if comment["comment_source"] != commentSourceWbi {
+		t.Errorf("comment_source = %v, want %s by default", comment["comment_source"], commentSourceWbi)
+	}
+}
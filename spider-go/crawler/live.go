@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"sync"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// queueLive hands an uploader to the live stage once per run
+func (c *BiliCrawler) queueLive(mid string) {
+	if !c.config.CrawlLive || mid == "" {
+		return
+	}
+
+	c.mu.Lock()
+	_, seen := c.seenLiveMids[mid]
+	c.seenLiveMids[mid] = struct{}{}
+	_, saved := c.savedLiveMids[mid]
+	c.mu.Unlock()
+	if seen || c.config.Resume && saved {
+		return
+	}
+	c.liveQueue <- mid
+}
+
+// crawlLive saves the live room of a user and reports whether the user has
+// one
+func (c *BiliCrawler) crawlLive(mid string, session *api.Session) (bool, error) {
+	room, err := api.GetLiveRoom(mid, session, c.config.CookieConfigPath)
+	c.recordResult("live", err)
+	if err != nil || room == nil {
+		return false, err
+	}
+
+	if err := storage.SaveLive(room); err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	c.savedLiveMids[mid] = struct{}{}
+	c.mu.Unlock()
+	c.stats.incLiveSaved()
+	return true, nil
+}
+
+// liveWorker fetches the live room info of uploaders from the live queue
+func (c *BiliCrawler) liveWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
+	defer wg.Done()
+
+	for {
+		if !c.waitTurn("live", threadID, done) {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case mid, ok := <-c.liveQueue:
+			if !ok {
+				return
+			}
+			if c.isCancelled() {
+				continue
+			}
+
+			c.recoverTask("live", threadID, nil, func() {
+				found, err := c.crawlLive(mid, session)
+				if err != nil {
+					c.errorf("[直播线程%d] 获取用户 %s 直播间失败: %v\n", threadID, mid, err)
+				} else if found {
+					c.debugf("[直播线程%d] 用户 %s 直播间已保存\n", threadID, mid)
+				}
+				c.delay()
+			})
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package crawler
+
+import "testing"
+
+func TestBiliCrawler_QueueLive(t *testing.T) {
+	c := newReloadCrawler()
+	c.liveQueue = make(chan string, 4)
+	c.seenLiveMids = make(map[string]struct{})
+	c.savedLiveMids = map[string]struct{}{"3": {}}
+
+	c.queueLive("1")
+	if len(c.liveQueue) != 0 {
+		t.Fatal("Uploaders should not be queued without crawl_live")
+	}
+
+	c.config.CrawlLive = true
+	c.config.Resume = true
+	for _, mid := range []string{"1", "2", "1", "3", ""} {
+		c.queueLive(mid)
+	}
+	if len(c.liveQueue) != 2 {
+		t.Errorf("queued %d uploaders, expected each new uploader once", len(c.liveQueue))
+	}
+}
@@ -0,0 +1,124 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logBuffer keeps the most recent log lines in memory
+type logBuffer struct {
+	lines []string
+	max   int
+	mu    sync.Mutex
+}
+
+func newLogBuffer(max int) *logBuffer {
+	return &logBuffer{max: max}
+}
+
+func (b *logBuffer) add(line string) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lines = append(b.lines, line)
+	if len(b.lines) > b.max {
+		b.lines = b.lines[len(b.lines)-b.max:]
+	}
+}
+
+// Lines returns a copy of the buffered lines, oldest first
+func (b *logBuffer) Lines() []string {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	lines := make([]string, len(b.lines))
+	copy(lines, b.lines)
+	return lines
+}
+
+// SetLogOutput redirects crawler progress messages, e.g. to io.Discard when a
+// dashboard owns the terminal. Messages are still kept in the recent log buffer.
+func (c *BiliCrawler) SetLogOutput(w io.Writer) {
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+	c.logOut = w
+}
+
+// LogOutput returns where crawler progress messages are written
+func (c *BiliCrawler) LogOutput() io.Writer {
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+	if c.logOut == nil {
+		return os.Stdout
+	}
+	return c.logOut
+}
+
+// Log levels accepted by log_level
+const (
+	LogQuiet   = "quiet"   // errors and the final statistics
+	LogNormal  = "normal"  // plus stage progress
+	LogVerbose = "verbose" // plus a line per search page, video, comment and user
+)
+
+// logLevel returns the current log_level
+func (c *BiliCrawler) logLevel() string {
+	c.configMu.RLock()
+	defer c.configMu.RUnlock()
+	return c.config.LogLevel
+}
+
+// write prints a message to the log output, clearing the progress line first
+func (c *BiliCrawler) write(msg string) {
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+	out := c.logOut
+	if out == nil {
+		out = os.Stdout
+	}
+	c.clearProgress(out)
+	fmt.Fprint(out, msg)
+}
+
+// logf prints a stage progress message unless log_level is quiet and keeps
+// it in the recent log buffer
+func (c *BiliCrawler) logf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	c.recentLogs.add(strings.TrimRight(msg, "\n"))
+	if c.logLevel() != LogQuiet {
+		c.write(msg)
+	}
+}
+
+// debugf is logf for per-item messages, printed only when log_level is
+// verbose
+func (c *BiliCrawler) debugf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	c.recentLogs.add(strings.TrimRight(msg, "\n"))
+	if c.logLevel() == LogVerbose {
+		c.write(msg)
+	}
+}
+
+// summaryf is logf for the final statistics, printed at every log level
+func (c *BiliCrawler) summaryf(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	c.recentLogs.add(strings.TrimRight(msg, "\n"))
+	c.write(msg)
+}
+
+// errorf is summaryf for failures; the message is also kept in the recent
+// errors buffer
+func (c *BiliCrawler) errorf(format string, args ...interface{}) {
+	msg := strings.TrimRight(fmt.Sprintf(format, args...), "\n")
+	c.recentErrors.add(time.Now().Format("15:04:05") + " " + msg)
+	c.summaryf(format, args...)
+}
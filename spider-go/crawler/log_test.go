@@ -0,0 +1,37 @@
+package crawler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	tests := []struct {
+		level string
+		want  []string
+	}{
+		{LogQuiet, []string{"error", "summary"}},
+		{LogNormal, []string{"info", "error", "summary"}},
+		{LogVerbose, []string{"debug", "info", "error", "summary"}},
+	}
+	for _, tt := range tests {
+		c := newReloadCrawler()
+		c.config.LogLevel = tt.level
+		c.recentLogs = newLogBuffer(10)
+		var out bytes.Buffer
+		c.SetLogOutput(&out)
+
+		c.debugf("debug\n")
+		c.logf("info\n")
+		c.errorf("error\n")
+		c.summaryf("summary\n")
+
+		if got := strings.Fields(out.String()); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s printed %v, expected %v", tt.level, got, tt.want)
+		}
+		if lines := c.recentLogs.Lines(); len(lines) != 4 {
+			t.Errorf("%s kept %d recent log lines, expected all 4", tt.level, len(lines))
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package crawler
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// Media kinds, also used as subdirectories of media_dir
+const (
+	MediaCover  = "covers"
+	MediaAvatar = "avatars"
+)
+
+// mediaTask is a cover or avatar to download
+type mediaTask struct {
+	Kind string
+	URL  string
+}
+
+// normalizeMediaURL completes protocol-relative CDN links with HTTPS
+func normalizeMediaURL(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "//") {
+		return "https:" + raw
+	}
+	return raw
+}
+
+// mediaKey returns the key a media URL is stored under:
+// kind/<sha1 of the URL><extension>
+func mediaKey(kind, rawURL string) string {
+	sum := sha1.Sum([]byte(rawURL))
+	ext := ".jpg"
+	if u, err := url.Parse(rawURL); err == nil && path.Ext(u.Path) != "" {
+		ext = path.Ext(u.Path)
+	}
+	return kind + "/" + hex.EncodeToString(sum[:]) + ext
+}
+
+// queueMedia hands a cover or avatar URL to the media stage once per run
+func (c *BiliCrawler) queueMedia(kind string, value interface{}) {
+	if !c.config.DownloadMedia {
+		return
+	}
+	if kind == MediaCover && !c.config.MediaCovers || kind == MediaAvatar && !c.config.MediaAvatars {
+		return
+	}
+	raw, _ := value.(string)
+	if raw = normalizeMediaURL(raw); raw == "" {
+		return
+	}
+
+	c.mu.Lock()
+	_, seen := c.seenMedia[raw]
+	c.seenMedia[raw] = struct{}{}
+	c.mu.Unlock()
+	if !seen {
+		c.mediaQueue <- mediaTask{Kind: kind, URL: raw}
+	}
+}
+
+// downloadMedia stores one media file unless the media store already has
+// it. It reports whether a new file was stored.
+func (c *BiliCrawler) downloadMedia(task mediaTask) (bool, error) {
+	store := c.mediaStore
+	if store == nil {
+		store = storage.DirMediaStore(c.config.MediaDir)
+	}
+	key := mediaKey(task.Kind, task.URL)
+	if stored, err := store.Has(key); err != nil || stored {
+		return false, err
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		_, err := api.Download(task.URL, w, c.config.MediaMaxBytes)
+		w.CloseWithError(err)
+	}()
+	err := store.Put(key, r)
+	// Stops the download if the store gave up before reading all of it
+	r.CloseWithError(err)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// downloadFile downloads urlStr to target unless target already exists and
+// reports whether a new file was written. The body goes to a temporary file
+// first so an interrupted download is never mistaken for a finished one.
+func downloadFile(urlStr, target string, maxBytes int64) (bool, error) {
+	if _, err := os.Stat(target); err == nil {
+		return false, nil
+	}
+	if err := storage.EnsureDir(filepath.Dir(target)); err != nil {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".download-*")
+	if err != nil {
+		return false, err
+	}
+	_, err = api.Download(urlStr, tmp, maxBytes)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return false, err
+	}
+	return true, nil
+}
+
+// mediaWorker downloads covers and avatars from the media queue
+func (c *BiliCrawler) mediaWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}) {
+	defer wg.Done()
+
+	for {
+		if !c.waitTurn("media", threadID, done) {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case task, ok := <-c.mediaQueue:
+			if !ok {
+				return
+			}
+			if c.isCancelled() {
+				continue
+			}
+
+			c.recoverTask("media", threadID, nil, func() {
+				saved, err := c.downloadMedia(task)
+				if err != nil {
+					c.errorf("[媒体线程%d] 下载 %s 失败: %v\n", threadID, task.URL, err)
+					return
+				}
+				if saved {
+					c.stats.incMediaSaved()
+				}
+			})
+		}
+	}
+}
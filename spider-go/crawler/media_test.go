@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeMediaURL(t *testing.T) {
+	tests := map[string]string{
+		"//i0.hdslb.com/bfs/archive/a.jpg":      "https://i0.hdslb.com/bfs/archive/a.jpg",
+		"http://i0.hdslb.com/bfs/face/b.png":    "http://i0.hdslb.com/bfs/face/b.png",
+		"https://i0.hdslb.com/bfs/face/c.webp ": "https://i0.hdslb.com/bfs/face/c.webp",
+		"":                                      "",
+	}
+	for in, expected := range tests {
+		if got := normalizeMediaURL(in); got != expected {
+			t.Errorf("normalizeMediaURL(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
+
+func TestMediaKey(t *testing.T) {
+	key := mediaKey(MediaCover, "https://i0.hdslb.com/bfs/archive/a.png?x=1")
+	if path.Dir(key) != MediaCover || !strings.HasSuffix(key, ".png") {
+		t.Errorf("Unexpected key %s", key)
+	}
+	if mediaKey(MediaCover, "https://i0.hdslb.com/a") == mediaKey(MediaCover, "https://i0.hdslb.com/b") {
+		t.Error("Different URLs should map to different files")
+	}
+	if !strings.HasSuffix(mediaKey(MediaAvatar, "https://i0.hdslb.com/face"), ".jpg") {
+		t.Error("URLs without an extension should default to .jpg")
+	}
+}
+
+func TestBiliCrawler_Media(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	c := newReloadCrawler()
+	c.config.DownloadMedia = true
+	c.config.MediaDir = t.TempDir()
+	c.seenMedia = make(map[string]struct{})
+	c.mediaQueue = make(chan mediaTask, 10)
+
+	c.queueMedia(MediaCover, server.URL+"/a.jpg")
+	c.queueMedia(MediaCover, server.URL+"/a.jpg")
+	c.queueMedia(MediaAvatar, nil)
+	if len(c.mediaQueue) != 1 {
+		t.Fatalf("Expected one queued download, got %d", len(c.mediaQueue))
+	}
+
+	task := <-c.mediaQueue
+	saved, err := c.downloadMedia(task)
+	if err != nil || !saved {
+		t.Fatalf("downloadMedia = %v, %v", saved, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(c.config.MediaDir, filepath.FromSlash(mediaKey(MediaCover, task.URL))))
+	if string(data) != "image" {
+		t.Errorf("Saved file = %q", data)
+	}
+
+	// Files already on disk are not downloaded again
+	if saved, _ := c.downloadMedia(task); saved || requests != 1 {
+		t.Errorf("Existing file should be skipped, saved=%v requests=%d", saved, requests)
+	}
+
+	c.config.MediaMaxBytes = 2
+	if _, err := c.downloadMedia(mediaTask{Kind: MediaAvatar, URL: server.URL + "/big.jpg"}); err == nil {
+		t.Error("Expected size limit error")
+	}
+	entries, _ := os.ReadDir(filepath.Join(c.config.MediaDir, MediaAvatar))
+	if len(entries) != 0 {
+		t.Errorf("Failed downloads should leave no files, found %d", len(entries))
+	}
+}
+
+// memMediaStore keeps media in memory, as an object storage plugin would
+// keep it remotely
+type memMediaStore map[string][]byte
+
+func (m memMediaStore) Has(key string) (bool, error) {
+	_, ok := m[key]
+	return ok, nil
+}
+
+func (m memMediaStore) Put(key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	m[key] = data
+	return nil
+}
+
+func TestBiliCrawler_MediaStore(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("image"))
+	}))
+	defer server.Close()
+
+	store := memMediaStore{}
+	c := newReloadCrawler()
+	c.config.MediaDir = t.TempDir()
+	c.mediaStore = store
+
+	task := mediaTask{Kind: MediaCover, URL: server.URL + "/a.jpg"}
+	if saved, err := c.downloadMedia(task); err != nil || !saved {
+		t.Fatalf("downloadMedia = %v, %v", saved, err)
+	}
+	if data := store[mediaKey(MediaCover, task.URL)]; string(data) != "image" {
+		t.Errorf("Stored = %q, expected the download in the media store", data)
+	}
+	if entries, _ := os.ReadDir(c.config.MediaDir); len(entries) != 0 {
+		t.Error("Nothing should be written to media_dir with another media store")
+	}
+
+	c.config.MediaMaxBytes = 2
+	if _, err := c.downloadMedia(mediaTask{Kind: MediaAvatar, URL: server.URL + "/big.jpg"}); err == nil {
+		t.Error("Expected size limit error")
+	}
+	if len(store) != 1 {
+		t.Errorf("A failed download should store nothing, store has %d", len(store))
+	}
+}
@@ -0,0 +1,76 @@
+package crawler
+
+import (
+	"time"
+
+	"spider-go/api"
+)
+
+// addVideoOnline adds the current viewer count of a video's first page to
+// its detail as "online" (total, count and fetched_at). A failed fetch is
+// logged and the video saved without it.
+func (c *BiliCrawler) addVideoOnline(threadID int, bvid string, detail map[string]interface{}, session *api.Session) {
+	cid := int64Field(detail, "cid")
+	if cid == 0 {
+		return
+	}
+
+	c.delay()
+	online, err := api.GetOnlineCount(bvid, cid, session, c.config.CookieConfigPath)
+	c.recordResult("detail", err)
+	if err != nil {
+		c.errorf("[视频线程%d] %s 获取在线人数失败: %v\n", threadID, bvid, err)
+		return
+	}
+	detail["online"] = map[string]interface{}{
+		"total":      online.Total,
+		"count":      online.Count,
+		"fetched_at": time.Now().Unix(),
+	}
+}
+
+// statCid returns the first-page cid of a snapshot video, looking it up in
+// the video's details the first time
+func (c *BiliCrawler) statCid(bvid string, session *api.Session) (int64, error) {
+	c.mu.Lock()
+	cid, ok := c.statCids[bvid]
+	c.mu.Unlock()
+	if ok {
+		return cid, nil
+	}
+
+	detail, err := api.GetVideoDetail(bvid, session, c.config.CookieConfigPath)
+	c.recordResult("stats", err)
+	if err != nil {
+		return 0, err
+	}
+	cid = int64Field(detail, "cid")
+	c.mu.Lock()
+	c.statCids[bvid] = cid
+	c.mu.Unlock()
+	return cid, nil
+}
+
+// addSnapshotOnline adds the current viewer count of a video to its stat
+// snapshot as online_total and online_count. A failed fetch is logged and
+// the snapshot saved without them.
+func (c *BiliCrawler) addSnapshotOnline(threadID int, bvid string, record map[string]interface{}, session *api.Session) {
+	cid, err := c.statCid(bvid, session)
+	if err != nil {
+		c.errorf("[快照线程%d] %s 获取 cid 失败: %v\n", threadID, bvid, err)
+		return
+	}
+	if cid == 0 {
+		return
+	}
+
+	c.delay()
+	online, err := api.GetOnlineCount(bvid, cid, session, c.config.CookieConfigPath)
+	c.recordResult("stats", err)
+	if err != nil {
+		c.errorf("[快照线程%d] %s 获取在线人数失败: %v\n", threadID, bvid, err)
+		return
+	}
+	record["online_total"] = online.Total
+	record["online_count"] = online.Count
+}
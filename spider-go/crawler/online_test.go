@@ -0,0 +1,65 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+)
+
+func serveOnline(t *testing.T, views *int) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/x/web-interface/view":
+			*views++
+			w.Write([]byte(`{"code":0,"data":{"bvid":"BV1","aid":1,"cid":42}}`))
+		case "/x/player/online/total":
+			if r.URL.Query().Get("cid") != "42" {
+				t.Errorf("online count requested for cid %s", r.URL.Query().Get("cid"))
+			}
+			w.Write([]byte(`{"code":0,"data":{"total":"1000+","count":"800+"}}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+}
+
+func TestBiliCrawler_AddVideoOnline(t *testing.T) {
+	serveOnline(t, new(int))
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+
+	detail := map[string]interface{}{"bvid": "BV1", "cid": float64(42)}
+	c.addVideoOnline(0, "BV1", detail, nil)
+	online, _ := detail["online"].(map[string]interface{})
+	if online["total"] != "1000+" || online["count"] != "800+" || online["fetched_at"] == nil {
+		t.Errorf("online = %v", detail["online"])
+	}
+}
+
+func TestBiliCrawler_AddSnapshotOnline(t *testing.T) {
+	views := 0
+	serveOnline(t, &views)
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.statCids = make(map[string]int64)
+
+	for pass := 0; pass < 2; pass++ {
+		record := videoStatRecord("BV1", map[string]interface{}{"aid": float64(1)}, time.Unix(100, 0))
+		c.addSnapshotOnline(0, "BV1", record, nil)
+		if record["online_total"] != "1000+" || record["online_count"] != "800+" {
+			t.Errorf("pass %d record = %v", pass, record)
+		}
+	}
+	// The cid is looked up once
+	if views != 1 {
+		t.Errorf("video details fetched %d times, expected 1", views)
+	}
+}
@@ -0,0 +1,221 @@
+package crawler
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is prepended to the upper-cased config key to form its
+// environment variable, e.g. SPIDER_N_THREADS or SPIDER_VIDEO_FILTER_MIN_PLAY
+const EnvPrefix = "SPIDER_"
+
+// ResolveConfig builds the effective configuration. Later sources win:
+// defaults, the config file (skipped when path is empty), the selected
+// profile of that file, SPIDER_* environment variables, then command-line
+// overrides keyed by config key ("n_threads", "video_filter.min_play").
+func ResolveConfig(path, profile string, lookupEnv func(string) (string, bool), overrides map[string]string) (Config, error) {
+	config := DefaultConfig()
+
+	if path == "" && profile != "" {
+		return config, fmt.Errorf("profile %q needs a config file", profile)
+	}
+	if path != "" {
+		var err error
+		if config, err = LoadConfigProfile(path, profile); err != nil {
+			return config, err
+		}
+	}
+
+	if err := ApplyEnv(&config, lookupEnv); err != nil {
+		return config, err
+	}
+	if err := ApplyOverrides(&config, overrides); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// ApplyEnv overrides config fields from SPIDER_* environment variables
+func ApplyEnv(config *Config, lookupEnv func(string) (string, bool)) error {
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+
+	var errs []error
+	walkConfig(reflect.ValueOf(config).Elem(), nil, func(key string, field reflect.Value) {
+		name := EnvName(key)
+		raw, ok := lookupEnv(name)
+		if !ok {
+			return
+		}
+		if err := setField(field, raw); err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s: %w", name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// ApplyOverrides sets config fields from values keyed by config key
+func ApplyOverrides(config *Config, overrides map[string]string) error {
+	fields := make(map[string]reflect.Value)
+	walkConfig(reflect.ValueOf(config).Elem(), nil, func(key string, field reflect.Value) {
+		fields[key] = field
+	})
+
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("unknown config key %q", key)
+		}
+		if err := setField(field, overrides[key]); err != nil {
+			return fmt.Errorf("invalid -%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// EnvName returns the environment variable that overrides a config key
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// configFlag collects the raw value of one config key set on the command line
+type configFlag struct {
+	key    string
+	isBool bool
+	values map[string]string
+}
+
+func (f *configFlag) String() string {
+	if f.values == nil {
+		return ""
+	}
+	return f.values[f.key]
+}
+
+func (f *configFlag) Set(value string) error {
+	f.values[f.key] = value
+	return nil
+}
+
+func (f *configFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// ConfigFlags registers one flag per config key on fs. Values given on the
+// command line end up in the returned map, ready for ApplyOverrides.
+func ConfigFlags(fs *flag.FlagSet) map[string]string {
+	values := make(map[string]string)
+	config := DefaultConfig()
+
+	walkConfig(reflect.ValueOf(&config).Elem(), nil, func(key string, field reflect.Value) {
+		f := &configFlag{key: key, isBool: field.Kind() == reflect.Bool, values: values}
+		fs.Var(f, key, fmt.Sprintf("覆盖配置 %s（环境变量 %s）", key, EnvName(key)))
+	})
+	return values
+}
+
+// walkConfig calls fn for every settable leaf field with its dotted json key
+func walkConfig(v reflect.Value, prefix []string, fn func(key string, field reflect.Value)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		path := append(append([]string{}, prefix...), name)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walkConfig(field, path, fn)
+			continue
+		}
+		fn(strings.Join(path, "."), field)
+	}
+}
+
+// setField parses raw into a config field. Slices are comma separated and
+// maps are comma separated key=value pairs.
+func setField(field reflect.Value, raw string) error {
+	if field.Kind() == reflect.Map {
+		m := reflect.MakeMap(field.Type())
+		for _, pair := range strings.Split(raw, ",") {
+			if strings.TrimSpace(pair) == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", pair)
+			}
+			elem := reflect.New(field.Type().Elem()).Elem()
+			if err := setScalar(elem, strings.TrimSpace(value)); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(key)), elem)
+		}
+		field.Set(m)
+		return nil
+	}
+
+	if field.Kind() == reflect.Slice {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			field.Set(reflect.MakeSlice(field.Type(), 0, 0))
+			return nil
+		}
+		parts := strings.Split(raw, ",")
+		slice := reflect.MakeSlice(field.Type(), len(parts), len(parts))
+		for i, part := range parts {
+			if err := setScalar(slice.Index(i), strings.TrimSpace(part)); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return setScalar(field, strings.TrimSpace(raw))
+}
+
+func setScalar(field reflect.Value, raw string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	if name := EnvName("n_threads"); name != "SPIDER_N_THREADS" {
+		t.Errorf("EnvName(n_threads) = %s", name)
+	}
+	if name := EnvName("video_filter.min_play"); name != "SPIDER_VIDEO_FILTER_MIN_PLAY" {
+		t.Errorf("EnvName(video_filter.min_play) = %s", name)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	config := DefaultConfig()
+	err := ApplyEnv(&config, envMap(map[string]string{
+		"SPIDER_KEYWORD":                   "测试",
+		"SPIDER_N_THREADS":                 "8",
+		"SPIDER_RESUME":                    "false",
+		"SPIDER_DELAY_MIN":                 "0.5",
+		"SPIDER_VIDEO_FILTER_MIN_PLAY":     "10000",
+		"SPIDER_ERROR_CIRCUIT_CODES":       "-352, -799",
+		"SPIDER_VIDEO_FILTER_EXCLUDE_MIDS": "",
+	}))
+	if err != nil {
+		t.Fatalf("ApplyEnv failed: %v", err)
+	}
+
+	if config.Keyword != "测试" || config.NThreads != 8 || config.Resume || config.DelayMin != 0.5 {
+		t.Errorf("Top-level fields not overridden: %+v", config)
+	}
+	if config.VideoFilter.MinPlay != 10000 {
+		t.Errorf("MinPlay = %d, expected 10000", config.VideoFilter.MinPlay)
+	}
+	codes := config.ErrorCircuit.Codes
+	if len(codes) != 2 || codes[0] != -352 || codes[1] != -799 {
+		t.Errorf("Codes = %v, expected [-352 -799]", codes)
+	}
+	if config.VideoFilter.ExcludeMids == nil || len(config.VideoFilter.ExcludeMids) != 0 {
+		t.Error("Empty env var should clear a list")
+	}
+
+	err = ApplyEnv(&config, envMap(map[string]string{"SPIDER_N_THREADS": "many"}))
+	if err == nil {
+		t.Error("Expected error for invalid number")
+	}
+}
+
+func TestApplyOverrides(t *testing.T) {
+	config := DefaultConfig()
+	err := ApplyOverrides(&config, map[string]string{
+		"pages_per_thread":         "4",
+		"comment_filter.min_likes": "3",
+	})
+	if err != nil {
+		t.Fatalf("ApplyOverrides failed: %v", err)
+	}
+	if config.PagesPerThread != 4 || config.CommentFilter.MinLikes != 3 {
+		t.Errorf("Overrides not applied: %+v", config)
+	}
+
+	if err := ApplyOverrides(&config, map[string]string{"no_such_key": "1"}); err == nil {
+		t.Error("Expected error for unknown key")
+	}
+}
+
+func TestConfigFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	values := ConfigFlags(fs)
+
+	if err := fs.Parse([]string{"-n_threads", "6", "-crawl_dynamics", "-video_filter.min_duration=30"}); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	if values["n_threads"] != "6" || values["crawl_dynamics"] != "true" || values["video_filter.min_duration"] != "30" {
+		t.Errorf("Unexpected flag values: %v", values)
+	}
+	if _, ok := values["keyword"]; ok {
+		t.Error("Unset flags should not be collected")
+	}
+}
+
+func TestResolveConfig_Precedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"keyword": "文件", "n_threads": 2, "pages_per_thread": 7}`), 0644)
+
+	config, err := ResolveConfig(path, "",
+		envMap(map[string]string{"SPIDER_N_THREADS": "4", "SPIDER_KEYWORD": "环境"}),
+		map[string]string{"keyword": "命令行"})
+	if err != nil {
+		t.Fatalf("ResolveConfig failed: %v", err)
+	}
+
+	if config.Keyword != "命令行" {
+		t.Errorf("Keyword = %s, flag should win", config.Keyword)
+	}
+	if config.NThreads != 4 {
+		t.Errorf("NThreads = %d, env should beat the file", config.NThreads)
+	}
+	if config.PagesPerThread != 7 {
+		t.Errorf("PagesPerThread = %d, file should beat defaults", config.PagesPerThread)
+	}
+
+	// Without a config file only defaults, env and flags apply
+	config, err = ResolveConfig("", "", envMap(nil), nil)
+	if err != nil || config.NThreads != DefaultConfig().NThreads {
+		t.Errorf("Expected defaults without a config file, got %d, %v", config.NThreads, err)
+	}
+}
+
+func TestSetField_Map(t *testing.T) {
+	config := DefaultConfig()
+	if err := ApplyOverrides(&config, map[string]string{"stage_threads": "comment=2, reply=4"}); err != nil {
+		t.Fatalf("ApplyOverrides failed: %v", err)
+	}
+	if config.StageThreads["comment"] != 2 || config.StageThreads["reply"] != 4 {
+		t.Errorf("StageThreads = %v", config.StageThreads)
+	}
+	if err := ApplyOverrides(&config, map[string]string{"stage_threads": "comment"}); err == nil {
+		t.Error("Expected error for a pair without value")
+	}
+}
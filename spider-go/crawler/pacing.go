@@ -0,0 +1,34 @@
+package crawler
+
+import (
+	"math"
+
+	"spider-go/api"
+)
+
+// latencyScale returns the multiplier latency pacing applies to request
+// delays: the slowdown of the slowest endpoint once it reaches
+// latency_slowdown, capped at latency_max_scale, and 1 otherwise
+func (c *BiliCrawler) latencyScale() float64 {
+	cfg := c.live()
+	if !cfg.LatencyPacing {
+		return 1
+	}
+	slowest, ok := api.SlowestEndpoint()
+	scale := 1.0
+	if ok && slowest.Slowdown() >= cfg.LatencySlowdown {
+		scale = math.Min(slowest.Slowdown(), cfg.LatencyMaxScale)
+	}
+
+	c.mu.Lock()
+	changed := (scale > 1) != c.latencyPaced
+	c.latencyPaced = scale > 1
+	c.mu.Unlock()
+	if changed && scale > 1 {
+		c.logf("[延迟] %s 响应变慢 (最近 %.0fms，通常 %.0fms)，请求间隔放大 %.1f 倍\n",
+			slowest.Endpoint, slowest.RecentMs, slowest.BaselineMs, scale)
+	} else if changed {
+		c.logf("[延迟] 接口响应恢复正常，请求间隔复原\n")
+	}
+	return scale
+}
@@ -0,0 +1,47 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"spider-go/api"
+)
+
+func TestBiliCrawler_LatencyScale(t *testing.T) {
+	api.ResetLatency()
+	defer api.ResetLatency()
+
+	c := newReloadCrawler()
+	var out strings.Builder
+	c.SetLogOutput(&out)
+
+	respond := func(endpoint string, d time.Duration, n int) {
+		for i := 0; i < n; i++ {
+			api.RecordLatency(endpoint, d)
+		}
+	}
+	respond("/x/v2/reply/wbi/main", 100*time.Millisecond, 30)
+	respond("/x/v2/reply/wbi/main", time.Second, 20)
+
+	if scale := c.latencyScale(); scale != 1 {
+		t.Errorf("latencyScale = %g with pacing off, expected 1", scale)
+	}
+
+	c.config.LatencyPacing = true
+	c.config.LatencyMaxScale = 2
+	if scale := c.latencyScale(); scale != c.config.LatencyMaxScale {
+		t.Errorf("latencyScale = %g, expected the cap %g", scale, c.config.LatencyMaxScale)
+	}
+	if !strings.Contains(out.String(), "/x/v2/reply/wbi/main 响应变慢") {
+		t.Errorf("log = %q, expected the slow endpoint", out.String())
+	}
+
+	respond("/x/v2/reply/wbi/main", 100*time.Millisecond, 40)
+	if scale := c.latencyScale(); scale != 1 {
+		t.Errorf("latencyScale = %g after recovering, expected 1", scale)
+	}
+	if !strings.Contains(out.String(), "恢复正常") {
+		t.Errorf("log = %q, expected the recovery", out.String())
+	}
+}
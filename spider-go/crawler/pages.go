@@ -0,0 +1,81 @@
+package crawler
+
+import "spider-go/api"
+
+// videoPage is one page (分P) of a video
+type videoPage struct {
+	Cid  int64
+	Page int64 // page number, from 1
+}
+
+// detailPages returns the pages of a video detail, falling back to its first
+// page's cid
+func detailPages(detail map[string]interface{}) []videoPage {
+	var pages []videoPage
+	list, _ := detail["pages"].([]interface{})
+	for _, item := range list {
+		page, _ := item.(map[string]interface{})
+		if cid := int64Field(page, "cid"); cid != 0 {
+			pages = append(pages, videoPage{Cid: cid, Page: int64Field(page, "page")})
+		}
+	}
+	if len(pages) == 0 {
+		if cid := int64Field(detail, "cid"); cid != 0 {
+			pages = append(pages, videoPage{Cid: cid, Page: 1})
+		}
+	}
+	return pages
+}
+
+// addVideoPages completes a video detail's "pages" so that it lists every
+// page with its cid, page number, title (part) and duration. The detail
+// usually lists them all already, and then nothing is fetched; otherwise the
+// page list is fetched and merged in by cid, keeping the fields only the
+// detail has. A failed fetch is logged and the detail's own pages kept.
+func (c *BiliCrawler) addVideoPages(threadID int, bvid string, detail map[string]interface{}, session *api.Session) {
+	existing, _ := detail["pages"].([]interface{})
+	if videos := int64Field(detail, "videos"); videos > 0 && int64(len(existing)) >= videos {
+		return
+	}
+
+	c.delay()
+	pages, err := api.GetVideoPages(bvid, session, c.config.CookieConfigPath)
+	c.recordResult("detail", err)
+	if err != nil {
+		c.errorf("[视频线程%d] %s 获取分P列表失败: %v\n", threadID, bvid, err)
+		return
+	}
+
+	byCid := make(map[int64]map[string]interface{}, len(existing))
+	for _, item := range existing {
+		if page, ok := item.(map[string]interface{}); ok {
+			byCid[int64Field(page, "cid")] = page
+		}
+	}
+	// Stored as decoded JSON would be, so detailPages and scripts read it too
+	list := make([]interface{}, len(pages))
+	for i, page := range pages {
+		entry := byCid[page.Cid]
+		if entry == nil {
+			entry = make(map[string]interface{})
+		}
+		entry["cid"] = page.Cid
+		entry["page"] = page.Page
+		entry["part"] = page.Part
+		entry["duration"] = page.Duration
+		list[i] = entry
+	}
+	detail["pages"] = list
+}
+
+// taskPages returns the pages the danmaku and subtitle stages crawl for a
+// video: every page with video_pages, otherwise only the first
+func (c *BiliCrawler) taskPages(task *VideoTask) []videoPage {
+	if c.config.VideoPages && len(task.Pages) > 0 {
+		return task.Pages
+	}
+	if task.Cid == 0 {
+		return nil
+	}
+	return []videoPage{{Cid: task.Cid, Page: 1}}
+}
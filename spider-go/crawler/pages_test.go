@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestDetailPages(t *testing.T) {
+	detail := map[string]interface{}{
+		"cid": float64(10),
+		"pages": []interface{}{
+			map[string]interface{}{"cid": float64(10), "page": float64(1)},
+			map[string]interface{}{"cid": float64(11), "page": float64(2)},
+		},
+	}
+	if got, expected := detailPages(detail), []videoPage{{10, 1}, {11, 2}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("detailPages = %v, expected %v", got, expected)
+	}
+
+	delete(detail, "pages")
+	if got, expected := detailPages(detail), []videoPage{{10, 1}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("detailPages without pages = %v, expected %v", got, expected)
+	}
+}
+
+func TestBiliCrawler_AddVideoPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0,"data":[{"cid":10,"page":1,"part":"上","duration":60},{"cid":11,"page":2,"part":"下","duration":90}]}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	detail := map[string]interface{}{"bvid": "BV1", "cid": float64(10)}
+	c.addVideoPages(0, "BV1", detail, nil)
+
+	if got, expected := detailPages(detail), []videoPage{{10, 1}, {11, 2}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("detailPages = %v, expected %v", got, expected)
+	}
+	pages, _ := detail["pages"].([]interface{})
+	if len(pages) != 2 || pages[1].(map[string]interface{})["part"] != "下" {
+		t.Errorf("pages = %v", detail["pages"])
+	}
+}
+
+func TestBiliCrawler_AddVideoPagesMerges(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"code":0,"data":[{"cid":10,"page":1,"part":"上","duration":60},{"cid":11,"page":2,"part":"下","duration":90}]}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+
+	// The detail lists only the first of its two pages: the list is fetched
+	// and the detail's own fields survive
+	first := map[string]interface{}{"cid": float64(10), "page": float64(1), "dimension": map[string]interface{}{"width": float64(1920)}, "first_frame": "f.jpg"}
+	detail := map[string]interface{}{"bvid": "BV1", "videos": float64(2), "pages": []interface{}{first}}
+	c.addVideoPages(0, "BV1", detail, nil)
+	pages, _ := detail["pages"].([]interface{})
+	if requests != 1 || len(pages) != 2 {
+		t.Fatalf("pages = %v after %d requests", pages, requests)
+	}
+	merged := pages[0].(map[string]interface{})
+	if merged["first_frame"] != "f.jpg" || merged["dimension"] == nil || merged["part"] != "上" {
+		t.Errorf("first page = %v, expected the detail's fields merged with the list's", merged)
+	}
+
+	// The detail lists every page: nothing is fetched
+	c.addVideoPages(0, "BV1", detail, nil)
+	if requests != 1 {
+		t.Errorf("%d requests, expected none for a detail listing every page", requests-1)
+	}
+}
+
+func TestBiliCrawler_TaskPages(t *testing.T) {
+	c := newReloadCrawler()
+	task := &VideoTask{Bvid: "BV1", Cid: 10, Pages: []videoPage{{10, 1}, {11, 2}}}
+
+	if got, expected := c.taskPages(task), []videoPage{{10, 1}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("taskPages = %v, expected only the first page without video_pages", got)
+	}
+	c.config.VideoPages = true
+	if got := c.taskPages(task); !reflect.DeepEqual(got, task.Pages) {
+		t.Errorf("taskPages = %v, expected every page with video_pages", got)
+	}
+}
+
+func TestBiliCrawler_CrawlDanmakuEveryPage(t *testing.T) {
+	var cids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cids = append(cids, r.URL.Query().Get("oid"))
+		w.Write([]byte(`<i><d p="1.5,1,25,16777215,1700000000,0,abc,10` + r.URL.Query().Get("oid") + `,5">一</d></i>`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+	// The danmaku of the first page cannot be published
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		if key == "1010" {
+			return fmt.Errorf("broker down")
+		}
+		return nil
+	}))
+	t.Cleanup(func() { storage.SetSink(nil) })
+
+	c := newReloadCrawler()
+	c.config.VideoPages = true
+	c.danmakuCids = make(map[string]struct{})
+	task := &VideoTask{Bvid: "BV1", Aid: 1, Cid: 10, Pages: []videoPage{{10, 1}, {11, 2}, {12, 3}}}
+
+	saved, err := c.crawlDanmaku(task, nil)
+	if err == nil || !strings.Contains(err.Error(), "P1") || saved != 2 {
+		t.Fatalf("crawlDanmaku = %d, %v; expected 2 saved and a P1 error", saved, err)
+	}
+	if !reflect.DeepEqual(cids, []string{"10", "11", "12"}) {
+		t.Errorf("danmaku requested for cids %v, expected every page despite the failure", cids)
+	}
+}
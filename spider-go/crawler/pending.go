@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"sort"
+
+	"spider-go/storage"
+)
+
+// queueVideo pushes a video into the comment stage. It is recorded in
+// pending_bvids first, so a video still waiting in the queue when the
+// process dies is picked up again by the next resumed run.
+func (c *BiliCrawler) queueVideo(task *VideoTask) {
+	if c.stageEnabled("comment") {
+		c.mu.Lock()
+		_, recorded := c.pendingBvids[task.Bvid]
+		c.pendingBvids[task.Bvid] = struct{}{}
+		c.mu.Unlock()
+		if !recorded {
+			storage.SavePendingBvid(task.Bvid, task.Keyword)
+		}
+	}
+	c.videoQueue <- task
+}
+
+// finishVideo notes that the comment crawl of a video finished, so it leaves
+// pending_bvids when the run ends
+func (c *BiliCrawler) finishVideo(bvid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finishedBvids[bvid] = struct{}{}
+}
+
+// queuePendingVideos pushes the videos an earlier run queued but never
+// finished back into the comment stage. They are claimed for this run so
+// that a search finding them again does not queue them twice.
+func (c *BiliCrawler) queuePendingVideos() {
+	if !c.config.Resume || !c.stageEnabled("comment") {
+		return
+	}
+	pending, err := storage.GetPendingBvids()
+	if err != nil {
+		c.errorf("读取待爬评论视频出错: %v\n", err)
+		return
+	}
+
+	c.mu.Lock()
+	tasks := make([]*VideoTask, 0, len(pending))
+	for bvid, keyword := range pending {
+		if _, gone := c.tombstoned[bvid]; gone {
+			continue
+		}
+		if p := c.videoProgress[bvid]; p != nil && p.Done {
+			continue
+		}
+		c.runSearchBvids[bvid] = struct{}{}
+		c.pendingBvids[bvid] = struct{}{}
+		video := map[string]interface{}{"bvid": bvid, "topic_keyword": keyword}
+		if p := c.videoProgress[bvid]; p != nil {
+			video["aid"], video["title"] = p.Aid, p.Title
+		}
+		tasks = append(tasks, newVideoTask(video))
+	}
+	c.mu.Unlock()
+	if len(tasks) == 0 {
+		return
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Bvid < tasks[j].Bvid })
+
+	c.logf("  - 已恢复 %d 个待爬评论的视频\n", len(tasks))
+	for _, task := range tasks {
+		select {
+		case <-c.cancelled:
+			return
+		case c.videoQueue <- task:
+		}
+	}
+}
+
+// savePendingBvids removes the videos whose comments finished this run from
+// pending_bvids and returns how many remain
+func (c *BiliCrawler) savePendingBvids() int {
+	pending, err := storage.GetPendingBvids()
+	if err != nil {
+		c.errorf("读取待爬评论视频出错: %v\n", err)
+		return 0
+	}
+	c.mu.Lock()
+	for bvid := range c.finishedBvids {
+		delete(pending, bvid)
+	}
+	c.mu.Unlock()
+
+	storage.UpdatePendingBvids(pending)
+	return len(pending)
+}
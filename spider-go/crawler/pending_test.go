@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"testing"
+
+	"spider-go/storage"
+)
+
+func newPendingCrawler(t *testing.T) *BiliCrawler {
+	t.Helper()
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+
+	c := newReloadCrawler()
+	c.videoQueue = make(chan *VideoTask, 10)
+	c.cancelled = make(chan struct{})
+	c.pendingBvids = make(map[string]struct{})
+	c.finishedBvids = make(map[string]struct{})
+	c.runSearchBvids = make(map[string]struct{})
+	c.tombstoned = make(map[string]struct{})
+	return c
+}
+
+func TestBiliCrawler_PendingVideos(t *testing.T) {
+	c := newPendingCrawler(t)
+
+	c.queueVideo(&VideoTask{Bvid: "BV1", Keyword: "测试"})
+	c.queueVideo(&VideoTask{Bvid: "BV2"})
+	c.queueVideo(&VideoTask{Bvid: "BV1", Keyword: "测试"})
+	if len(c.videoQueue) != 3 {
+		t.Errorf("queue length = %d, expected 3", len(c.videoQueue))
+	}
+	c.finishVideo("BV2")
+
+	// Only the unfinished video is left for the next run
+	if remaining := c.savePendingBvids(); remaining != 1 {
+		t.Errorf("remaining = %d, expected 1", remaining)
+	}
+	pending, _ := storage.GetPendingBvids()
+	if len(pending) != 1 || pending["BV1"] != "测试" {
+		t.Errorf("pending = %v, expected BV1 under 测试", pending)
+	}
+}
+
+func TestBiliCrawler_QueuePendingVideos(t *testing.T) {
+	c := newPendingCrawler(t)
+	storage.SavePendingBvid("BV_NEW", "测试")
+	storage.SavePendingBvid("BV_PARTIAL", "")
+	storage.SavePendingBvid("BV_DONE", "")
+	storage.SavePendingBvid("BV_GONE", "")
+	c.videoProgress = map[string]*storage.VideoProgress{
+		"BV_PARTIAL": {Cursor: "abc", Aid: 7, Title: "标题"},
+		"BV_DONE":    {Done: true},
+	}
+	c.tombstoned["BV_GONE"] = struct{}{}
+
+	c.queuePendingVideos()
+	close(c.videoQueue)
+	var tasks []*VideoTask
+	for task := range c.videoQueue {
+		tasks = append(tasks, task)
+	}
+
+	if len(tasks) != 2 || tasks[0].Bvid != "BV_NEW" || tasks[1].Bvid != "BV_PARTIAL" {
+		t.Fatalf("queued %+v, expected BV_NEW and BV_PARTIAL", tasks)
+	}
+	if tasks[0].Keyword != "测试" {
+		t.Errorf("keyword = %q, expected 测试", tasks[0].Keyword)
+	}
+	if tasks[1].Aid != 7 || tasks[1].Title != "标题" {
+		t.Errorf("aid, title = %d, %q, expected them from the progress", tasks[1].Aid, tasks[1].Title)
+	}
+	// A search finding a restored video again does not queue it twice
+	if c.claimSearchResult("BV_NEW") {
+		t.Error("restored video should already be claimed")
+	}
+}
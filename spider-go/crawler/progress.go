@@ -0,0 +1,202 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often the progress line is redrawn
+var progressInterval = 500 * time.Millisecond
+
+// commentPageSize is the number of main comments per page, used to estimate
+// how many pages a video has
+const commentPageSize = 20
+
+// progressBar tracks the search pages of the current keyword and the comment
+// pages of the videos being crawled for the progress line
+type progressBar struct {
+	keyword     string
+	searchDone  int
+	searchTotal int
+	videos      map[string]*videoPages
+	mu          sync.Mutex
+}
+
+// videoPages counts the comment pages fetched for one video against an
+// estimate from its reply count
+type videoPages struct {
+	started  time.Time
+	pages    int
+	estimate int
+}
+
+func newProgressBar() *progressBar {
+	return &progressBar{videos: make(map[string]*videoPages)}
+}
+
+// startSearch resets the search progress for a keyword
+func (p *progressBar) startSearch(keyword string, pages int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keyword, p.searchDone, p.searchTotal = keyword, 0, pages
+}
+
+// extendSearch adds pages to the search in progress
+func (p *progressBar) extendSearch(pages int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.searchTotal += pages
+}
+
+// searchPage counts a finished search page
+func (p *progressBar) searchPage() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.searchDone++
+}
+
+// startVideo starts tracking the comment pages of a video
+func (p *progressBar) startVideo(bvid string, replyCount int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	estimate := (replyCount + commentPageSize - 1) / commentPageSize
+	p.videos[bvid] = &videoPages{started: time.Now(), estimate: estimate}
+}
+
+// videoPage counts a fetched comment page of a video
+func (p *progressBar) videoPage(bvid string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if v, ok := p.videos[bvid]; ok {
+		v.pages++
+	}
+}
+
+// endVideo stops tracking a video
+func (p *progressBar) endVideo(bvid string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.videos, bvid)
+}
+
+// renderBar draws done out of total as a bar of width cells
+func renderBar(done, total, width int) string {
+	filled := 0
+	if total > 0 {
+		filled = min(done*width/total, width)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", width-filled) + "]"
+}
+
+// line renders the progress line: the search bar of the current keyword,
+// then the comment pages of the longest running videos
+func (p *progressBar) line(maxVideos int) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var parts []string
+	if p.searchTotal > 0 {
+		parts = append(parts, fmt.Sprintf("搜索 %s %s %d/%d 页",
+			p.keyword, renderBar(p.searchDone, p.searchTotal, 20), p.searchDone, p.searchTotal))
+	}
+
+	bvids := make([]string, 0, len(p.videos))
+	for bvid := range p.videos {
+		bvids = append(bvids, bvid)
+	}
+	sort.Slice(bvids, func(i, j int) bool {
+		a, b := p.videos[bvids[i]], p.videos[bvids[j]]
+		if !a.started.Equal(b.started) {
+			return a.started.Before(b.started)
+		}
+		return bvids[i] < bvids[j]
+	})
+
+	var videos []string
+	for _, bvid := range bvids[:min(len(bvids), maxVideos)] {
+		v := p.videos[bvid]
+		estimate := max(v.estimate, v.pages)
+		videos = append(videos, fmt.Sprintf("%s %s %d/~%d", bvid, renderBar(v.pages, estimate, 10), v.pages, estimate))
+	}
+	if len(videos) > 0 {
+		more := ""
+		if extra := len(bvids) - len(videos); extra > 0 {
+			more = fmt.Sprintf(" (+%d)", extra)
+		}
+		parts = append(parts, "评论页 "+strings.Join(videos, ", ")+more)
+	}
+	return strings.Join(parts, " | ")
+}
+
+// clearProgress erases a drawn progress line so a log message can take its
+// place; the caller holds logMu
+func (c *BiliCrawler) clearProgress(out io.Writer) {
+	if c.progressDrawn {
+		fmt.Fprint(out, "\r\033[K")
+		c.progressDrawn = false
+	}
+}
+
+// drawProgress redraws the progress line in place
+func (c *BiliCrawler) drawProgress() {
+	line := c.progress.line(3)
+	if line == "" {
+		return
+	}
+
+	c.logMu.Lock()
+	defer c.logMu.Unlock()
+	out := c.logOut
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprint(out, "\r\033[K"+line)
+	c.progressDrawn = true
+}
+
+// watchProgress redraws the progress line until stop is closed
+func (c *BiliCrawler) watchProgress(stop <-chan struct{}) {
+	if c.progress == nil {
+		return
+	}
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			c.logMu.Lock()
+			out := c.logOut
+			if out == nil {
+				out = os.Stdout
+			}
+			c.clearProgress(out)
+			c.logMu.Unlock()
+			return
+		case <-ticker.C:
+			c.drawProgress()
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package crawler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRenderBar(t *testing.T) {
+	tests := []struct {
+		done, total int
+		want        string
+	}{
+		{0, 10, "[-----]"},
+		{5, 10, "[##---]"},
+		{10, 10, "[#####]"},
+		{12, 10, "[#####]"},
+		{3, 0, "[-----]"},
+	}
+	for _, tt := range tests {
+		if got := renderBar(tt.done, tt.total, 5); got != tt.want {
+			t.Errorf("renderBar(%d, %d) = %q, expected %q", tt.done, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestProgressBar_Line(t *testing.T) {
+	p := newProgressBar()
+	if got := p.line(3); got != "" {
+		t.Errorf("empty progress line = %q", got)
+	}
+
+	p.startSearch("原神", 4)
+	p.searchPage()
+	p.startVideo("BV1", 100)
+	p.videoPage("BV1")
+	p.videoPage("BV1")
+	p.startVideo("BV2", 0)
+	p.videoPage("BV2")
+
+	line := p.line(1)
+	for _, want := range []string{"搜索 原神", "1/4 页", "BV1", "2/~5", "(+1)"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("line %q should contain %q", line, want)
+		}
+	}
+
+	p.endVideo("BV1")
+	if line := p.line(3); !strings.Contains(line, "BV2") || !strings.Contains(line, "1/~1") || strings.Contains(line, "BV1") {
+		t.Errorf("line after BV1 ended = %q", line)
+	}
+
+	var nilBar *progressBar
+	nilBar.startVideo("BV1", 1)
+	nilBar.videoPage("BV1")
+}
+
+func TestProgress_ClearedByLog(t *testing.T) {
+	c := newReloadCrawler()
+	c.progress = newProgressBar()
+	var out bytes.Buffer
+	c.SetLogOutput(&out)
+
+	c.progress.startSearch("原神", 2)
+	c.drawProgress()
+	c.logf("message\n")
+
+	want := "\r\033[K搜索 原神 [--------------------] 0/2 页\r\033[Kmessage\n"
+	if out.String() != want {
+		t.Errorf("output = %q, expected %q", out.String(), want)
+	}
+}
@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"spider-go/ratelimit"
+)
+
+// quietCheckInterval is how often the quiet-hours schedule is checked
+var quietCheckInterval = 30 * time.Second
+
+// QuietHoursConfig configures daily windows during which the crawl pauses or
+// slows down
+type QuietHoursConfig struct {
+	Windows []string `json:"windows"` // "HH:MM-HH:MM" in local time; may wrap past midnight
+	Rate    float64  `json:"rate"`    // request rate inside a window; 0 pauses the crawl
+}
+
+// parseQuietWindow parses "HH:MM-HH:MM" into minutes since midnight
+func parseQuietWindow(window string) (start, end int, err error) {
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid quiet window %q, expected HH:MM-HH:MM", window)
+	}
+	if start, err = parseClock(from); err != nil {
+		return 0, 0, fmt.Errorf("invalid quiet window %q: %w", window, err)
+	}
+	if end, err = parseClock(to); err != nil {
+		return 0, 0, fmt.Errorf("invalid quiet window %q: %w", window, err)
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// inQuietHours reports whether t falls inside any of the windows. Invalid
+// windows are ignored; Validate reports them.
+func inQuietHours(windows []string, t time.Time) bool {
+	now := t.Hour()*60 + t.Minute()
+	for _, window := range windows {
+		start, end, err := parseQuietWindow(window)
+		if err != nil {
+			continue
+		}
+		if start <= end && now >= start && now < end {
+			return true
+		}
+		if start > end && (now >= start || now < end) {
+			return true
+		}
+	}
+	return false
+}
+
+// quietState is what a quiet window changed, so that leaving it restores
+// the crawl as it was
+type quietState struct {
+	active  bool
+	restore float64 // request rate to restore at the end of the window
+	applied float64 // quiet rate last set, 0 if none
+}
+
+// applyQuietHours pauses or slows the crawl when now enters a quiet window
+// and restores the rate in effect before it when it leaves. The pause is
+// its own reason, so leaving a window does not lift an operator pause or a
+// tripped circuit. It takes the state of the previous check and returns
+// the new one.
+func (c *BiliCrawler) applyQuietHours(now time.Time, state quietState) quietState {
+	cfg := c.live()
+	limiter := ratelimit.GetRateLimiter()
+
+	if !inQuietHours(cfg.QuietHours.Windows, now) {
+		if state.active {
+			ratelimit.ResumeFor(ratelimit.PauseQuiet)
+			if state.applied != 0 {
+				limiter.SetRate(state.restore)
+				c.logf("[静默时段] 结束，恢复速率 %.2f 请求/秒\n", state.restore)
+			} else {
+				c.logf("[静默时段] 结束，恢复爬取\n")
+			}
+		}
+		return quietState{}
+	}
+
+	if !state.active {
+		state = quietState{active: true, restore: limiter.Rate()}
+	}
+	if cfg.QuietHours.Rate <= 0 {
+		if !ratelimit.PausedFor(ratelimit.PauseQuiet) {
+			c.pauseFor(ratelimit.PauseQuiet)
+			c.logf("[静默时段] 开始，暂停爬取\n")
+		}
+		return state
+	}
+
+	// A rate set meanwhile (console, web API, reload) is the one to
+	// restore; the quiet rate is applied again over it
+	if current := limiter.Rate(); state.applied != 0 && current != state.applied {
+		state.restore = current
+	}
+	rate := min(cfg.QuietHours.Rate, state.restore)
+	if limiter.Rate() != rate {
+		limiter.SetRate(rate)
+		c.logf("[静默时段] 速率降至 %.2f 请求/秒\n", rate)
+	}
+	state.applied = rate
+	return state
+}
+
+// watchQuietHours applies the quiet-hours schedule until stop is closed
+func (c *BiliCrawler) watchQuietHours(stop <-chan struct{}) {
+	ticker := time.NewTicker(quietCheckInterval)
+	defer ticker.Stop()
+
+	var state quietState
+	for {
+		state = c.applyQuietHours(time.Now(), state)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
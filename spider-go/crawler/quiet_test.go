@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+
+	"spider-go/ratelimit"
+)
+
+func TestInQuietHours(t *testing.T) {
+	at := func(clock string) time.Time {
+		tm, _ := time.ParseInLocation("15:04", clock, time.Local)
+		return tm
+	}
+	windows := []string{"02:00-07:00", "23:30-00:30"}
+
+	tests := []struct {
+		clock string
+		quiet bool
+	}{
+		{"01:59", false},
+		{"02:00", true},
+		{"06:59", true},
+		{"07:00", false},
+		{"23:45", true},
+		{"00:15", true},
+		{"12:00", false},
+	}
+	for _, tt := range tests {
+		if got := inQuietHours(windows, at(tt.clock)); got != tt.quiet {
+			t.Errorf("inQuietHours(%s) = %v, expected %v", tt.clock, got, tt.quiet)
+		}
+	}
+}
+
+func TestParseQuietWindow_Invalid(t *testing.T) {
+	for _, window := range []string{"02:00", "2am-7am", "25:00-07:00"} {
+		if _, _, err := parseQuietWindow(window); err == nil {
+			t.Errorf("Expected error for %q", window)
+		}
+	}
+}
+
+func TestBiliCrawler_ApplyQuietHours(t *testing.T) {
+	ratelimit.InitRateLimiter(2, 5)
+	defer ratelimit.ResumeAll()
+
+	c := newReloadCrawler()
+	c.config.QuietHours = QuietHoursConfig{Windows: []string{"02:00-07:00"}, Rate: 0.5}
+	night := time.Date(2024, 1, 1, 3, 0, 0, 0, time.Local)
+	day := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+	limiter := ratelimit.GetRateLimiter()
+
+	state := c.applyQuietHours(night, quietState{})
+	if !state.active || limiter.Rate() != 0.5 {
+		t.Errorf("Quiet window should reduce the rate, got %v", limiter.Rate())
+	}
+	state = c.applyQuietHours(day, state)
+	if state.active || limiter.Rate() != 2 {
+		t.Errorf("Leaving the window should restore the rate, got %v", limiter.Rate())
+	}
+
+	c.config.QuietHours.Rate = 0
+	state = c.applyQuietHours(night, quietState{})
+	if !ratelimit.IsPaused() {
+		t.Error("Quiet window with rate 0 should pause")
+	}
+	c.applyQuietHours(day, state)
+	if ratelimit.IsPaused() {
+		t.Error("Leaving the window should resume")
+	}
+}
+
+func TestBiliCrawler_ApplyQuietHours_KeepsOtherPauses(t *testing.T) {
+	ratelimit.InitRateLimiter(2, 5)
+	defer ratelimit.ResumeAll()
+
+	c := newReloadCrawler()
+	c.config.QuietHours = QuietHoursConfig{Windows: []string{"02:00-07:00"}}
+	night := time.Date(2024, 1, 1, 3, 0, 0, 0, time.Local)
+	day := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+
+	state := c.applyQuietHours(night, quietState{})
+	ratelimit.PauseFor(ratelimit.PauseCircuit)
+	c.Pause()
+	c.applyQuietHours(day, state)
+	if !ratelimit.PausedFor(ratelimit.PauseCircuit) || !ratelimit.PausedFor(ratelimit.PauseOperator) {
+		t.Error("Leaving quiet hours should not lift a circuit or operator pause")
+	}
+}
+
+func TestBiliCrawler_ApplyQuietHours_RestoresRateSetMeanwhile(t *testing.T) {
+	ratelimit.InitRateLimiter(2, 5)
+	defer ratelimit.ResumeAll()
+
+	c := newReloadCrawler()
+	c.config.RateLimitRate = 2
+	c.config.QuietHours = QuietHoursConfig{Windows: []string{"02:00-07:00"}, Rate: 0.5}
+	night := time.Date(2024, 1, 1, 3, 0, 0, 0, time.Local)
+	day := time.Date(2024, 1, 1, 9, 0, 0, 0, time.Local)
+	limiter := ratelimit.GetRateLimiter()
+
+	// Set from the console before the window
+	limiter.SetRate(4)
+	state := c.applyQuietHours(night, quietState{})
+	// and again during it
+	limiter.SetRate(3)
+	state = c.applyQuietHours(night.Add(time.Minute), state)
+	if limiter.Rate() != 0.5 {
+		t.Errorf("The quiet rate should be applied again, got %v", limiter.Rate())
+	}
+	c.applyQuietHours(day, state)
+	if limiter.Rate() != 3 {
+		t.Errorf("Leaving the window should restore the rate set last, got %v", limiter.Rate())
+	}
+}
@@ -0,0 +1,100 @@
+package crawler
+
+import "spider-go/api"
+
+// CommentGap is a video whose comment crawl found noticeably fewer comments
+// than its reply count
+type CommentGap struct {
+	Bvid      string `json:"bvid"`
+	Expected  int    `json:"expected"`  // reply count reported by the video
+	Seen      int    `json:"seen"`      // main comments plus their reply counts
+	Recovered int    `json:"recovered"` // main comments found by the refetch
+}
+
+func (s *Stats) addCommentGap(gap CommentGap) {
+	s.mu.Lock()
+	s.gaps = append(s.gaps, gap)
+	s.mu.Unlock()
+}
+
+// commentGaps returns a copy of the recorded comment gaps
+func (s *Stats) commentGaps() []CommentGap {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CommentGap(nil), s.gaps...)
+}
+
+// videoReplyCount returns the comment count of a video detail ("stat.reply")
+// or search result ("review")
+func videoReplyCount(video map[string]interface{}) int {
+	if stat, ok := video["stat"].(map[string]interface{}); ok {
+		return int(int64Field(stat, "reply"))
+	}
+	return int(int64Field(video, "review"))
+}
+
+// commentCoverage counts the comments a page of main comments accounts for:
+// each comment and the replies it reports
+func commentCoverage(replies []map[string]interface{}) int {
+	n := 0
+	for _, reply := range replies {
+		n += 1 + int(int64Field(reply, "rcount"))
+	}
+	return n
+}
+
+// commentGapExceeds reports whether seen falls short of expected by more
+// than threshold (a fraction of expected)
+func commentGapExceeds(expected, seen int, threshold float64) bool {
+	return expected > 0 && float64(expected-seen) > threshold*float64(expected)
+}
+
+// unsavedComments drops the comments already saved in this run or, when
+// resuming, an earlier one
+func (c *BiliCrawler) unsavedComments(replies []map[string]interface{}) []map[string]interface{} {
+	var fresh []map[string]interface{}
+	for _, reply := range replies {
+		if !c.isRpidSaved(newCommentIDs(reply).key()) {
+			fresh = append(fresh, reply)
+		}
+	}
+	return fresh
+}
+
+// reconcileComments compares the comments a finished crawl has seen with the
+// video's reply count and, if the gap is over comment_reconcile_threshold,
+// refetches up to comment_reconcile_pages pages in hot order to pick up
+// comments the time order missed. The gap is recorded for the report.
+func (c *BiliCrawler) reconcileComments(threadID int, ctx commentContext, detail map[string]interface{}, seen int, session *api.Session) {
+	cfg := c.live()
+	expected := videoReplyCount(detail)
+	if !commentGapExceeds(expected, seen, cfg.CommentReconcileThreshold) {
+		return
+	}
+	c.logf("[评论线程%d] %s 评论数不符: 视频显示 %d 条，本次发现 %d 条，按热度重新获取\n", threadID, ctx.Bvid, expected, seen)
+
+	recovered := 0
+	cursor := ""
+	for page := 0; page < cfg.CommentReconcilePages; page++ {
+		result, err := api.GetMainCommentsSorted(ctx.Aid, cursor, api.CommentModeHot, session, c.config.CookieConfigPath)
+		c.recordResult("comment", err)
+		if err != nil {
+			c.errorf("[评论线程%d] %s 热门评论获取错误: %v\n", threadID, ctx.Bvid, err)
+			break
+		}
+
+		recovered += c.handleMainComments(c.unsavedComments(markPinned(result.TopReplies)), ctx, 0)
+		recovered += c.handleMainComments(c.unsavedComments(result.Replies), ctx, 0)
+		if result.IsEnd || len(result.Replies) == 0 {
+			break
+		}
+		cursor = result.NextCursor
+		if c.isCancelled() {
+			break
+		}
+		c.delay()
+	}
+
+	c.stats.addCommentGap(CommentGap{Bvid: ctx.Bvid, Expected: expected, Seen: seen, Recovered: recovered})
+	c.logf("[评论线程%d] %s 重新获取补充 %d 条一级评论\n", threadID, ctx.Bvid, recovered)
+}
@@ -0,0 +1,65 @@
+package crawler
+
+import "testing"
+
+func TestVideoReplyCount(t *testing.T) {
+	detail := map[string]interface{}{"stat": map[string]interface{}{"reply": float64(120)}}
+	search := map[string]interface{}{"review": float64(80)}
+	if got := videoReplyCount(detail); got != 120 {
+		t.Errorf("videoReplyCount(detail) = %d, expected 120", got)
+	}
+	if got := videoReplyCount(search); got != 80 {
+		t.Errorf("videoReplyCount(search) = %d, expected 80", got)
+	}
+	if got := videoReplyCount(map[string]interface{}{}); got != 0 {
+		t.Errorf("videoReplyCount(empty) = %d, expected 0", got)
+	}
+}
+
+func TestCommentCoverage(t *testing.T) {
+	replies := []map[string]interface{}{
+		{"rpid": float64(1), "rcount": float64(4)},
+		{"rpid": float64(2)},
+	}
+	if got := commentCoverage(replies); got != 6 {
+		t.Errorf("commentCoverage = %d, expected 6", got)
+	}
+}
+
+func TestCommentGapExceeds(t *testing.T) {
+	tests := []struct {
+		expected, seen int
+		exceeds        bool
+	}{
+		{100, 95, false},
+		{100, 90, false},
+		{100, 89, true},
+		{100, 120, false},
+		{0, 0, false},
+	}
+	for _, tt := range tests {
+		if got := commentGapExceeds(tt.expected, tt.seen, 0.1); got != tt.exceeds {
+			t.Errorf("commentGapExceeds(%d, %d) = %v, expected %v", tt.expected, tt.seen, got, tt.exceeds)
+		}
+	}
+}
+
+func TestBiliCrawler_UnsavedComments(t *testing.T) {
+	c := newReloadCrawler()
+	c.savedRpids = dedupSetOf("1")
+
+	fresh := c.unsavedComments([]map[string]interface{}{{"rpid": float64(1)}, {"rpid": float64(2)}})
+	if len(fresh) != 1 || fresh[0]["rpid"] != float64(2) {
+		t.Errorf("unsavedComments = %v, expected only rpid 2", fresh)
+	}
+}
+
+func TestStats_CommentGaps(t *testing.T) {
+	var s Stats
+	s.addCommentGap(CommentGap{Bvid: "BV1", Expected: 100, Seen: 50})
+	gaps := s.commentGaps()
+	gaps[0].Bvid = "changed"
+	if s.commentGaps()[0].Bvid != "BV1" {
+		t.Error("commentGaps should return a copy")
+	}
+}
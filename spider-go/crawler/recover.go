@@ -0,0 +1,28 @@
+package crawler
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"spider-go/storage"
+)
+
+// recoverTask runs handle for one task of a stage. A panic is logged with its
+// stack and counted instead of killing the process, so the worker goes on
+// with its queue; with failed set the task is also recorded for
+// retry-failed. Tasks are not requeued, since a panic caused by the data
+// would only repeat.
+func (c *BiliCrawler) recoverTask(stage string, threadID int, failed *storage.FailedTask, handle func()) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		c.stats.incPanics()
+		c.errorf("[%s线程%d] 任务异常，已跳过: %v\n%s", stage, threadID, r, debug.Stack())
+		if failed != nil && failed.ID != "" {
+			c.recordFailure(*failed, fmt.Errorf("panic: %v", r))
+		}
+	}()
+	handle()
+}
@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+
+	"spider-go/storage"
+)
+
+func TestRecoverTask(t *testing.T) {
+	storage.SetRecordDir(t.TempDir())
+	c := newReloadCrawler()
+	c.failedTasks = make(map[string]struct{})
+	c.recentErrors = newLogBuffer(10)
+
+	var comment map[string]interface{}
+	c.recoverTask("reply", 0, &storage.FailedTask{Kind: storage.FailedReply, ID: "42"}, func() {
+		_ = comment["rpid"].(float64)
+	})
+
+	if got := c.stats.Snapshot().Panics; got != 1 {
+		t.Errorf("Panics = %d, expected 1", got)
+	}
+	if _, ok := c.failedTasks[failedKey(storage.FailedReply, "42")]; !ok {
+		t.Error("the panicking task should be recorded as failed")
+	}
+	errs := c.recentErrors.Lines()
+	if len(errs) != 1 || !strings.Contains(errs[0], "interface conversion") {
+		t.Errorf("errors = %v, expected the panic to be logged", errs)
+	}
+	if c.completionCode() != ExitCompletedWithErrors {
+		t.Error("a run with panics should not exit as completed")
+	}
+
+	ran := false
+	c.recoverTask("reply", 0, nil, func() { ran = true })
+	if !ran || c.stats.Snapshot().Panics != 1 {
+		t.Error("a task that returns normally should not count as a panic")
+	}
+}
+
+func TestCrawlCommentReplies_InvalidRpid(t *testing.T) {
+	c := newReloadCrawler()
+	c.recentErrors = newLogBuffer(10)
+
+	c.crawlCommentReplies(0, &CommentTask{Bvid: "BV1"}, nil)
+
+	if errs := c.recentErrors.Lines(); len(errs) != 1 || !strings.Contains(errs[0], "评论ID无效") {
+		t.Errorf("errors = %v, expected an invalid rpid error", errs)
+	}
+}
@@ -0,0 +1,42 @@
+package crawler
+
+import (
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// crawlNewComments pages a finished video's comments newest first and stops
+// at the first page that reaches a comment already saved, picking up only
+// the comments posted since. Replies to those new comments are queued as
+// usual; new replies to old comments are not looked for.
+func (c *BiliCrawler) crawlNewComments(threadID int, ctx commentContext, session *api.Session) {
+	c.debugf("[评论线程%d] %s (aid=%d) 评论已爬完，获取新评论...\n", threadID, ctx.Bvid, ctx.Aid)
+
+	commentCount := 0
+	cursor := ""
+	for {
+		result, err := api.GetMainComments(ctx.Aid, cursor, session, c.config.CookieConfigPath)
+		c.recordResult("comment", err)
+		if err != nil {
+			c.errorf("[评论线程%d] %s 新评论获取错误: %v\n", threadID, ctx.Bvid, err)
+			c.recordFailure(storage.FailedTask{Kind: storage.FailedComment, ID: ctx.Bvid, Aid: ctx.Aid, Title: ctx.Title, Keyword: ctx.Keyword}, err)
+			return
+		}
+
+		commentCount += c.handleMainComments(c.unsavedComments(markPinned(result.TopReplies)), ctx, 0)
+		fresh := c.unsavedComments(result.Replies)
+		commentCount += c.handleMainComments(fresh, ctx, 0)
+		if len(fresh) < len(result.Replies) || result.IsEnd || len(result.Replies) == 0 {
+			break
+		}
+		cursor = result.NextCursor
+		if c.isCancelled() {
+			// The next resumed pass picks up from the newest comments again
+			return
+		}
+		c.delay()
+	}
+
+	c.clearFailure(storage.FailedComment, ctx.Bvid)
+	c.debugf("[评论线程%d] %s 新评论爬取完成，共 %d 条一级评论\n", threadID, ctx.Bvid, commentCount)
+}
@@ -0,0 +1,41 @@
+package crawler
+
+import (
+	"testing"
+
+	"spider-go/storage"
+)
+
+func TestBiliCrawler_ClaimSearchResult_RecrawlNewComments(t *testing.T) {
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+
+	crawler := &BiliCrawler{
+		config:          Config{Resume: true, RecrawlNewComments: true},
+		savedBvids:      dedupSetOf("BV_DONE"),
+		seenSearchBvids: map[string]struct{}{"BV_DONE": {}},
+		runSearchBvids:  make(map[string]struct{}),
+		videoProgress:   map[string]*storage.VideoProgress{"BV_DONE": {Done: true}},
+	}
+
+	if !crawler.claimSearchResult("BV_DONE") {
+		t.Error("Finished videos should be claimed again with recrawl_new_comments")
+	}
+	if crawler.claimSearchResult("BV_DONE") {
+		t.Error("Finished videos should still be claimed only once per run")
+	}
+}
+
+func TestConfig_ValidateRecrawlNewComments(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Keyword = "测试"
+	cfg.RecrawlNewComments = true
+	cfg.Resume = false
+	if err := cfg.Validate(); err == nil {
+		t.Error("recrawl_new_comments without resume should be rejected")
+	}
+	cfg.Resume = true
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package crawler
+
+import (
+	"sync"
+
+	"spider-go/api"
+)
+
+// relatedBatch holds the related videos returned for one source video
+type relatedBatch struct {
+	From   string
+	Videos []map[string]interface{}
+}
+
+// expandRelated walks the related-video graph breadth-first from the seed
+// videos, sending newly discovered videos through the detail stage. Related
+// videos are claimed like search results, so a video another keyword found
+// this run, or one finished and saved in an earlier run, is neither fetched
+// again nor expanded from. No further depth is started after Cancel.
+func (c *BiliCrawler) expandRelated(keyword string, seeds []string, seen map[string]struct{}) {
+	frontier := seeds
+	total := 0
+
+	for depth := 1; depth <= c.live().RelatedDepth && len(frontier) > 0; depth++ {
+		if c.isCancelled() {
+			return
+		}
+		cfg := c.live()
+		limit := cfg.RelatedMaxPerDepth
+		if cfg.RelatedMaxTotal > 0 {
+			remaining := cfg.RelatedMaxTotal - total
+			if remaining <= 0 {
+				break
+			}
+			if limit <= 0 || remaining < limit {
+				limit = remaining
+			}
+		}
+
+		c.logf("相关视频扩展 第 %d 层，起点 %d 个视频\n", depth, len(frontier))
+
+		batches := c.fetchRelated(frontier)
+		selected := selectRelated(batches, seen, cfg.RelatedPerVideo, limit)
+
+		var newVideos []*VideoListing
+		frontier = make([]string, 0, len(selected))
+		for _, v := range selected {
+			v.RelatedDepth = depth
+			v.Keyword = keyword
+			if !c.claimSearchResult(v.Bvid) {
+				c.stats.incVideosDeduped()
+				continue
+			}
+			if !c.allowVideo(v.Record) {
+				continue
+			}
+			frontier = append(frontier, v.Bvid)
+
+			if c.config.Resume && c.isBvidSaved(v.Bvid) {
+				c.stats.incVideosSkipped()
+				c.queueVideo(v.task())
+				continue
+			}
+			newVideos = append(newVideos, v)
+		}
+		total += len(selected)
+
+		c.logf("相关视频扩展 第 %d 层发现 %d 个视频，其中新视频 %d 个\n", depth, len(selected), len(newVideos))
+
+		if len(newVideos) > 0 {
+			c.fetchVideoDetails(newVideos)
+		}
+	}
+}
+
+// fetchRelated fetches the related videos of every frontier video in
+// parallel. Videos not yet started when the crawl is cancelled are skipped,
+// and so is a video whose fetch panics: the expansion goes on without its
+// related videos.
+func (c *BiliCrawler) fetchRelated(frontier []string) []relatedBatch {
+	bvidChan := make(chan string, len(frontier))
+	for _, bvid := range frontier {
+		bvidChan <- bvid
+	}
+	close(bvidChan)
+
+	results := make(map[string][]map[string]interface{})
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < c.threads("related"); i++ {
+		wg.Add(1)
+		session := c.newSession()
+		go func(threadID int, session *api.Session) {
+			defer wg.Done()
+			for bvid := range bvidChan {
+				if c.isCancelled() {
+					continue
+				}
+				c.recoverTask("related", threadID, nil, func() {
+					videos, err := api.GetRelatedVideos(bvid, session, c.config.CookieConfigPath)
+					c.recordResult("related", err)
+					if err != nil {
+						c.errorf("[相关线程%d] %s 获取相关视频失败: %v\n", threadID, bvid, err)
+					} else {
+						resultsMu.Lock()
+						results[bvid] = videos
+						resultsMu.Unlock()
+					}
+				})
+				c.delay()
+			}
+		}(i, session)
+	}
+	wg.Wait()
+
+	// Keep frontier order so selection is deterministic
+	batches := make([]relatedBatch, 0, len(results))
+	for _, bvid := range frontier {
+		if videos, ok := results[bvid]; ok {
+			batches = append(batches, relatedBatch{From: bvid, Videos: videos})
+		}
+	}
+	return batches
+}
+
+// selectRelated picks unseen videos from the batches, taking at most perVideo
+// from each source and at most limit overall (0 means unlimited). Selected
+// videos are added to seen and tagged with the source bvid.
+func selectRelated(batches []relatedBatch, seen map[string]struct{}, perVideo, limit int) []*VideoListing {
+	var selected []*VideoListing
+
+	for _, batch := range batches {
+		taken := 0
+		for _, v := range batch.Videos {
+			if limit > 0 && len(selected) >= limit {
+				return selected
+			}
+			if perVideo > 0 && taken >= perVideo {
+				break
+			}
+
+			video := newVideoListing(v, "")
+			if video.Bvid == "" {
+				continue
+			}
+			if _, exists := seen[video.Bvid]; exists {
+				continue
+			}
+
+			seen[video.Bvid] = struct{}{}
+			video.RelatedFrom = batch.From
+			selected = append(selected, video)
+			taken++
+		}
+	}
+
+	return selected
+}
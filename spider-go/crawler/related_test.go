@@ -0,0 +1,188 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func relatedVideos(bvids ...string) []map[string]interface{} {
+	videos := make([]map[string]interface{}, 0, len(bvids))
+	for _, bvid := range bvids {
+		videos = append(videos, map[string]interface{}{"bvid": bvid})
+	}
+	return videos
+}
+
+func TestSelectRelated_Dedup(t *testing.T) {
+	seen := map[string]struct{}{"BV1": {}}
+	batches := []relatedBatch{
+		{From: "BV1", Videos: relatedVideos("BV1", "BV2", "BV3")},
+		{From: "BV2", Videos: relatedVideos("BV3", "BV4")},
+	}
+
+	selected := selectRelated(batches, seen, 0, 0)
+
+	if len(selected) != 3 {
+		t.Fatalf("Expected 3 selected videos, got %d", len(selected))
+	}
+	if selected[0].Bvid != "BV2" || selected[1].Bvid != "BV3" || selected[2].Bvid != "BV4" {
+		t.Errorf("Unexpected selection order: %v", selected)
+	}
+	if selected[2].RelatedFrom != "BV2" {
+		t.Errorf("RelatedFrom = %v, expected BV2", selected[2].RelatedFrom)
+	}
+	if _, ok := seen["BV4"]; !ok {
+		t.Error("Selected videos should be added to seen set")
+	}
+}
+
+func TestSelectRelated_Limits(t *testing.T) {
+	batches := []relatedBatch{
+		{From: "A", Videos: relatedVideos("BV1", "BV2", "BV3")},
+		{From: "B", Videos: relatedVideos("BV4", "BV5", "BV6")},
+	}
+
+	// Per-video limit
+	selected := selectRelated(batches, make(map[string]struct{}), 2, 0)
+	if len(selected) != 4 {
+		t.Errorf("Expected 4 videos with perVideo=2, got %d", len(selected))
+	}
+
+	// Overall limit
+	selected = selectRelated(batches, make(map[string]struct{}), 0, 5)
+	if len(selected) != 5 {
+		t.Errorf("Expected 5 videos with limit=5, got %d", len(selected))
+	}
+}
+
+func TestSelectRelated_SkipsMissingBvid(t *testing.T) {
+	batches := []relatedBatch{
+		{From: "A", Videos: []map[string]interface{}{{"aid": float64(1)}, {"bvid": ""}, {"bvid": "BV1"}}},
+	}
+
+	selected := selectRelated(batches, make(map[string]struct{}), 0, 0)
+	if len(selected) != 1 {
+		t.Errorf("Expected 1 video, got %d", len(selected))
+	}
+}
+
+func TestBiliCrawler_ExpandRelated_ClaimsVideos(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			// Session warmup
+			return
+		case "/x/web-interface/archive/related":
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"code":0,"data":[{"bvid":"BV1"},{"bvid":"BV2"}]}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.RelatedDepth = 1
+	c.sessions = api.NewSessionManager("")
+	c.savedBvids = newDedupSet(0, "")
+	// BV1 was found by another keyword this run; BV2 was finished earlier
+	c.runSearchBvids = map[string]struct{}{"BV1": {}}
+	c.seenSearchBvids = map[string]struct{}{"BV2": {}}
+	c.savedBvids.Add("BV2")
+	c.videoProgress = map[string]*storage.VideoProgress{"BV2": {Done: true}}
+
+	c.expandRelated("测试", []string{"BV0"}, map[string]struct{}{"BV0": {}})
+	if c.stats.VideosDeduped != 2 {
+		t.Errorf("VideosDeduped = %d, expected 2", c.stats.VideosDeduped)
+	}
+}
+
+func TestBiliCrawler_ExpandRelated_StopsOnCancel(t *testing.T) {
+	var c *BiliCrawler
+	var mu sync.Mutex
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/x/web-interface/archive/related" {
+			return
+		}
+		mu.Lock()
+		requests = append(requests, r.URL.Query().Get("bvid"))
+		mu.Unlock()
+		// The crawl is cancelled while the first source is fetched
+		c.Cancel()
+		w.Write([]byte(`{"code":0,"data":[{"bvid":"BV1"},{"bvid":"BV2"}]}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+
+	c = newReloadCrawler()
+	c.cancelled = make(chan struct{})
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.RelatedDepth = 3
+	c.config.StageThreads = map[string]int{"related": 1}
+	c.sessions = api.NewSessionManager("")
+	c.savedBvids = newDedupSet(0, "")
+	c.runSearchBvids = map[string]struct{}{"BV1": {}, "BV2": {}}
+	c.seenSearchBvids = make(map[string]struct{})
+
+	c.expandRelated("测试", []string{"BV0", "BV9"}, map[string]struct{}{"BV0": {}, "BV9": {}})
+	if len(requests) != 1 || requests[0] != "BV0" {
+		t.Errorf("related requests %v, expected only BV0 before the cancel", requests)
+	}
+}
+
+// panicTransport panics on requests for bvid and forwards the rest
+type panicTransport struct {
+	redirectTransport
+	bvid string
+}
+
+func (t panicTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Query().Get("bvid") == t.bvid {
+		panic("transport bug")
+	}
+	return t.redirectTransport.RoundTrip(req)
+}
+
+func TestBiliCrawler_FetchRelated_RecoversPanic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"code":0,"data":[{"bvid":"BV1"}]}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(panicTransport{redirectTransport: redirectTransport{target: target}, bvid: "BV0"})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.StageThreads = map[string]int{"related": 1}
+	c.sessions = api.NewSessionManager("")
+	c.recentErrors = newLogBuffer(10)
+
+	batches := c.fetchRelated([]string{"BV0", "BV9"})
+	if len(batches) != 1 || batches[0].From != "BV9" {
+		t.Errorf("batches = %+v, expected only BV9 after BV0 panicked", batches)
+	}
+	if got := c.stats.Snapshot().Panics; got != 1 {
+		t.Errorf("Panics = %d, expected 1", got)
+	}
+}
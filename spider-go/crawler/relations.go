@@ -0,0 +1,98 @@
+package crawler
+
+import (
+	"sync"
+	"time"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// relationTypes lists the relation lists crawled for each user
+var relationTypes = []string{"followings", "followers"}
+
+func (c *BiliCrawler) relationWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
+	defer wg.Done()
+
+	for {
+		if !c.waitTurn("relation", threadID, done) {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case mid, ok := <-c.relationQueue:
+			if !ok {
+				return
+			}
+			if c.isCancelled() {
+				continue
+			}
+
+			c.recoverTask("relation", threadID, nil, func() {
+				if c.config.Resume && c.isRelationDone(mid) {
+					return
+				}
+
+				total := 0
+				complete := true
+				for _, relationType := range relationTypes {
+					saved, err := c.crawlUserRelations(mid, relationType, session)
+					total += saved
+					if err != nil {
+						c.errorf("[关系线程%d] 用户 %s 的 %s 获取错误: %v\n", threadID, mid, relationType, err)
+						complete = false
+					}
+				}
+
+				if complete {
+					storage.MarkRelationsDone(mid)
+					c.markRelationDone(mid)
+				}
+				c.debugf("[关系线程%d] 用户 %s 关系爬取完成，共 %d 条\n", threadID, mid, total)
+			})
+		}
+	}
+}
+
+// crawlUserRelations pages through one relation list of a user, saving each
+// entry as an edge, and returns the number of edges saved
+func (c *BiliCrawler) crawlUserRelations(mid string, relationType string, session *api.Session) (int, error) {
+	maxPages := c.live().RelationMaxPages
+	saved := 0
+	for page := 1; maxPages <= 0 || page <= maxPages; page++ {
+		result, err := api.GetUserRelations(mid, relationType, page, c.config.RelationPageSize, session, c.config.CookieConfigPath)
+		c.recordResult("relation", err)
+		if err != nil {
+			return saved, err
+		}
+
+		crawlTime := time.Now().Unix()
+		for _, entry := range result.List {
+			if err := storage.SaveRelation(newRelationEdge(mid, relationType, entry, crawlTime)); err == nil {
+				c.stats.incRelationsSaved()
+				saved++
+			}
+		}
+
+		if len(result.List) < c.config.RelationPageSize || page*c.config.RelationPageSize >= result.Total {
+			break
+		}
+		c.delay()
+	}
+	return saved, nil
+}
+
+// newRelationEdge builds the relation record published for a list entry.
+// owner_mid follows mid for "followings" and is followed by mid for "followers".
+func newRelationEdge(ownerMid string, relationType string, entry map[string]interface{}, crawlTime int64) map[string]interface{} {
+	edge := make(map[string]interface{}, len(entry)+3)
+	for k, v := range entry {
+		edge[k] = v
+	}
+	edge["owner_mid"] = ownerMid
+	edge["relation_type"] = relationType
+	edge["crawl_time"] = crawlTime
+	return edge
+}
@@ -0,0 +1,36 @@
+package crawler
+
+import (
+	"testing"
+)
+
+func TestNewRelationEdge(t *testing.T) {
+	entry := map[string]interface{}{
+		"mid":   float64(456),
+		"uname": "test",
+	}
+
+	edge := newRelationEdge("123", "followings", entry, 1700000000)
+
+	if edge["owner_mid"] != "123" {
+		t.Errorf("owner_mid = %v, expected 123", edge["owner_mid"])
+	}
+	if edge["mid"] != float64(456) {
+		t.Errorf("mid = %v, expected 456", edge["mid"])
+	}
+	if edge["relation_type"] != "followings" {
+		t.Errorf("relation_type = %v, expected followings", edge["relation_type"])
+	}
+	if edge["crawl_time"] != int64(1700000000) {
+		t.Errorf("crawl_time = %v, expected 1700000000", edge["crawl_time"])
+	}
+
+	// The source entry must not be modified
+	if _, ok := entry["owner_mid"]; ok {
+		t.Error("newRelationEdge should not modify the source entry")
+	}
+}
+
+func TestNewRelationEdge_SchemaFields(t *testing.T) {
+	assertSchemaFields(t, "relation", newRelationEdge("1", "followers", map[string]interface{}{"mid": float64(2)}, 1700000000))
+}
@@ -0,0 +1,256 @@
+package crawler
+
+import (
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"spider-go/ratelimit"
+)
+
+// reloadableKeys are the config keys that can change while the crawler runs.
+// Everything else needs a restart.
+var reloadableKeys = map[string]bool{
+	"log_level":               true,
+	"delay_min":               true,
+	"delay_max":               true,
+	"delay_distribution":      true,
+	"delay_mean":              true,
+	"delay_stddev":            true,
+	"latency_pacing":          true,
+	"latency_slowdown":        true,
+	"latency_max_scale":       true,
+	"rate_limit_rate":         true,
+	"rate_limit_capacity":     true,
+	"max_concurrent_requests": true,
+	"n_threads":               true,
+	"stage_threads":           true,
+	"pages_per_thread":        true,
+	"search_refresh_pages":    true,
+	"search_extend_pages":     true,
+	"related_depth":           true,
+	"related_per_video":       true,
+	"related_max_per_depth":   true,
+	"related_max_total":       true,
+	"topic_max_pages":         true,
+	"upload_max_pages":        true,
+	"user_search_max_pages":   true,
+	"article_max_pages":       true,
+	"tag_expand_depth":        true,
+	"tag_expand_per_keyword":  true,
+	"tag_expand_max_total":    true,
+	"tag_expand_min_count":    true,
+	"tag_expand_stopwords":    true,
+	"dynamics_max_count":      true,
+	"dynamics_max_days":       true,
+	"dynamic_comment_pages":   true,
+	"relation_max_pages":      true,
+	"favorite_max_pages":      true,
+	"reply_page_parallel":     true,
+	"video_max_pages":         true,
+	"video_max_seconds":       true,
+	"hot_comment_pages":       true,
+	"hot_reply_pages":         true,
+	"quiet_hours.windows":     true,
+	"quiet_hours.rate":        true,
+	"health_stale_seconds":    true,
+}
+
+// live returns a copy of the config that is safe to read while a reload may
+// be in progress. Reloadable settings must be read through it.
+func (c *BiliCrawler) live() Config {
+	c.configMu.RLock()
+	defer c.configMu.RUnlock()
+	return c.config
+}
+
+// threads returns the worker count of a stage: the count set by auto-tuning,
+// its stage_threads entry, or n_threads when it has neither
+func (c *BiliCrawler) threads(stage string) int {
+	c.configMu.RLock()
+	defer c.configMu.RUnlock()
+	if n := c.tunedThreads[stage]; n > 0 {
+		return n
+	}
+	if n := c.config.StageThreads[stage]; n > 0 {
+		return n
+	}
+	return c.config.NThreads
+}
+
+// Reload applies the reloadable settings of next and returns which changed
+// keys were applied and which were ignored because they need a restart
+func (c *BiliCrawler) Reload(next Config) (applied, ignored []string) {
+	c.configMu.Lock()
+	prev := c.config
+	for _, key := range changedKeys(prev, next) {
+		if !reloadableKeys[key] {
+			ignored = append(ignored, key)
+			continue
+		}
+		copyConfigKey(&c.config, next, key)
+		applied = append(applied, key)
+	}
+	c.configMu.Unlock()
+
+	if next.RateLimitRate != prev.RateLimitRate {
+		ratelimit.GetRateLimiter().SetRate(next.RateLimitRate)
+	}
+	if next.RateLimitCapacity != prev.RateLimitCapacity {
+		ratelimit.GetRateLimiter().SetCapacity(next.RateLimitCapacity)
+	}
+	if next.MaxConcurrentRequests != prev.MaxConcurrentRequests {
+		ratelimit.SetMaxConcurrent(next.MaxConcurrentRequests)
+	}
+	return applied, ignored
+}
+
+// changedKeys lists the config keys whose values differ between a and b
+func changedKeys(a, b Config) []string {
+	values := make(map[string]reflect.Value)
+	walkConfig(reflect.ValueOf(&a).Elem(), nil, func(key string, field reflect.Value) {
+		values[key] = field
+	})
+
+	var changed []string
+	walkConfig(reflect.ValueOf(&b).Elem(), nil, func(key string, field reflect.Value) {
+		if !reflect.DeepEqual(values[key].Interface(), field.Interface()) {
+			changed = append(changed, key)
+		}
+	})
+	sort.Strings(changed)
+	return changed
+}
+
+// copyConfigKey copies the value of one config key from src into dst
+func copyConfigKey(dst *Config, src Config, key string) {
+	var value reflect.Value
+	walkConfig(reflect.ValueOf(&src).Elem(), nil, func(k string, field reflect.Value) {
+		if k == key {
+			value = field
+		}
+	})
+	walkConfig(reflect.ValueOf(dst).Elem(), nil, func(k string, field reflect.Value) {
+		if k == key && value.IsValid() {
+			field.Set(value)
+		}
+	})
+}
+
+// closeStage records that a stage's queue was closed so parked workers exit
+func (c *BiliCrawler) closeStage(stage string) {
+	c.mu.Lock()
+	c.closedStages[stage] = true
+	c.mu.Unlock()
+}
+
+func (c *BiliCrawler) isStageClosed(stage string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closedStages[stage]
+}
+
+// waitTurn parks a long-lived worker whose thread ID is beyond the stage's
+// current worker count until the count is raised again. It returns false
+// when the worker should exit instead.
+func (c *BiliCrawler) waitTurn(stage string, threadID int, done <-chan struct{}) bool {
+	for threadID >= c.threads(stage) {
+		if c.isStageClosed(stage) {
+			return false
+		}
+		select {
+		case <-done:
+			return false
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	return true
+}
+
+// WatchConfig reloads the config whenever the process receives SIGHUP and,
+// with watchFile set, whenever the config file at path changes. load must
+// return the fully resolved config. The returned function stops watching.
+func (c *BiliCrawler) WatchConfig(path string, watchFile bool, load func() (Config, error)) (func(), error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	var events <-chan fsnotify.Event
+	var watcher *fsnotify.Watcher
+	if watchFile && path != "" {
+		var err error
+		if watcher, err = fsnotify.NewWatcher(); err != nil {
+			signal.Stop(signals)
+			return nil, err
+		}
+		// Watch the directory, editors often replace the file instead of writing it
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			watcher.Close()
+			signal.Stop(signals)
+			return nil, err
+		}
+		events = watcher.Events
+	}
+
+	stop := make(chan struct{})
+	go func() {
+		// Editors emit several events per save, so reload once things settle
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-stop:
+				return
+			case <-signals:
+				c.logf("收到 SIGHUP，重新加载配置\n")
+				c.reloadFrom(load)
+			case event := <-events:
+				if filepath.Clean(event.Name) == filepath.Clean(path) &&
+					event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+					debounce = time.After(500 * time.Millisecond)
+				}
+			case <-debounce:
+				c.logf("配置文件 %s 已变更，重新加载配置\n", path)
+				c.reloadFrom(load)
+			}
+		}
+	}()
+
+	return func() {
+		close(stop)
+		signal.Stop(signals)
+		if watcher != nil {
+			watcher.Close()
+		}
+	}, nil
+}
+
+// reloadFrom loads, validates and applies a new config, keeping the current
+// one when anything is wrong. The keyword needs a restart to change, so a
+// crawler started without one (the trending command) reloads without one.
+func (c *BiliCrawler) reloadFrom(load func() (Config, error)) {
+	next, err := load()
+	if err == nil {
+		err = next.validate(strings.TrimSpace(c.live().Keyword) != "")
+	}
+	if err != nil {
+		c.errorf("重新加载配置失败，保持当前配置: %v\n", err)
+		return
+	}
+
+	applied, ignored := c.Reload(next)
+	if len(applied) == 0 && len(ignored) == 0 {
+		c.logf("配置无变化\n")
+	}
+	if len(applied) > 0 {
+		c.logf("已应用配置变更: %s\n", strings.Join(applied, ", "))
+	}
+	if len(ignored) > 0 {
+		c.logf("以下配置需重启才能生效，已忽略: %s\n", strings.Join(ignored, ", "))
+	}
+}
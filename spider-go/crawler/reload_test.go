@@ -0,0 +1,137 @@
+package crawler
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"spider-go/ratelimit"
+)
+
+func newReloadCrawler() *BiliCrawler {
+	config := DefaultConfig()
+	config.Keyword = "测试"
+	c := &BiliCrawler{config: config, closedStages: make(map[string]bool)}
+	c.SetLogOutput(io.Discard)
+	return c
+}
+
+func TestChangedKeys(t *testing.T) {
+	a := DefaultConfig()
+	b := DefaultConfig()
+	b.DelayMax = 10
+	b.VideoFilter.MinPlay = 5
+	b.StageThreads = map[string]int{"comment": 1}
+
+	changed := changedKeys(a, b)
+	expected := []string{"delay_max", "stage_threads", "video_filter.min_play"}
+	if !reflect.DeepEqual(changed, expected) {
+		t.Errorf("changedKeys = %v, expected %v", changed, expected)
+	}
+}
+
+func TestBiliCrawler_Reload(t *testing.T) {
+	ratelimit.InitRateLimiter(2, 5)
+	c := newReloadCrawler()
+
+	next := c.config
+	next.DelayMin = 5
+	next.DelayMax = 8
+	next.RateLimitRate = 0.5
+	next.Keyword = "另一个"
+	next.StageThreads = map[string]int{"reply": 1}
+
+	applied, ignored := c.Reload(next)
+
+	if !reflect.DeepEqual(applied, []string{"delay_max", "delay_min", "rate_limit_rate", "stage_threads"}) {
+		t.Errorf("applied = %v", applied)
+	}
+	if !reflect.DeepEqual(ignored, []string{"keyword"}) {
+		t.Errorf("ignored = %v", ignored)
+	}
+
+	cfg := c.live()
+	if cfg.DelayMin != 5 || cfg.DelayMax != 8 {
+		t.Error("Delays should be reloaded")
+	}
+	if cfg.Keyword != "测试" {
+		t.Error("Keyword should need a restart")
+	}
+	if rate := ratelimit.GetRateLimiter().Rate(); rate != 0.5 {
+		t.Errorf("Rate = %v, expected 0.5", rate)
+	}
+	if c.threads("reply") != 1 || c.threads("comment") != cfg.NThreads {
+		t.Error("threads should use stage_threads with n_threads as fallback")
+	}
+}
+
+func TestBiliCrawler_WaitTurn(t *testing.T) {
+	c := newReloadCrawler()
+	c.config.NThreads = 1
+	done := make(chan struct{})
+
+	if !c.waitTurn("comment", 0, done) {
+		t.Error("Worker within the thread count should run")
+	}
+
+	result := make(chan bool)
+	go func() { result <- c.waitTurn("comment", 1, done) }()
+
+	select {
+	case <-result:
+		t.Fatal("Worker beyond the thread count should be parked")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	c.Reload(func() Config { next := c.live(); next.NThreads = 2; return next }())
+	select {
+	case ok := <-result:
+		if !ok {
+			t.Error("Parked worker should resume when the count is raised")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Parked worker did not resume")
+	}
+
+	c.Reload(func() Config { next := c.live(); next.NThreads = 1; return next }())
+	c.closeStage("comment")
+	if c.waitTurn("comment", 1, done) {
+		t.Error("Parked worker should exit once its stage is closed")
+	}
+}
+
+func TestBiliCrawler_WatchConfig(t *testing.T) {
+	ratelimit.InitRateLimiter(2, 5)
+	c := newReloadCrawler()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"keyword": "测试", "delay_min": 2, "delay_max": 4}`), 0644)
+
+	stop, err := c.WatchConfig(path, true, func() (Config, error) {
+		return ResolveConfig(path, "", func(string) (string, bool) { return "", false }, nil)
+	})
+	if err != nil {
+		t.Fatalf("WatchConfig failed: %v", err)
+	}
+	defer stop()
+
+	os.WriteFile(path, []byte(`{"keyword": "测试", "delay_min": 6, "delay_max": 9}`), 0644)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for c.live().DelayMax != 9 {
+		if time.Now().After(deadline) {
+			t.Fatal("Config change was not picked up")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	// Invalid configs are rejected and the current config is kept
+	os.WriteFile(path, []byte(`{"keyword": "测试", "delay_min": 9, "delay_max": 1}`), 0644)
+	time.Sleep(1 * time.Second)
+	if cfg := c.live(); cfg.DelayMin != 6 {
+		t.Errorf("Invalid config should be ignored, DelayMin = %v", cfg.DelayMin)
+	}
+}
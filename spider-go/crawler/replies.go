@@ -0,0 +1,224 @@
+package crawler
+
+import (
+	"fmt"
+	"sync"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// replyPageSize is the number of replies requested per page
+const replyPageSize = 20
+
+// crawlReplies fetches the replies of a root comment and returns how many
+// were handled. The first page is fetched alone to learn the reply count;
+// with reply_page_parallel above 1 the remaining pages are then fetched that
+// many at a time, since reply pages are addressed by number. task.MaxPages
+// caps the pages fetched. With resume on, progress is saved after every page
+// and an interrupted thread continues after its last saved page. No page is
+// started after Cancel; the thread then fails with errCancelled.
+func (c *BiliCrawler) crawlReplies(threadID int, task *CommentTask, rpid int64, session *api.Session) (int, error) {
+	ctx := commentContext{Bvid: task.Bvid, Aid: task.Aid, Title: task.Title, Keyword: task.Keyword, RootRpid: rpid}
+
+	page, total := 1, 0
+	tracked := false
+	if c.config.Resume {
+		// Reply pages are in posting order, so replies posted since only
+		// append pages and the saved ones stay where they were
+		if progress, ok, _ := storage.GetReplyProgress(rpid); ok && (task.MaxPages == 0 || progress.Page < task.MaxPages) {
+			page, total = progress.Page+1, progress.Fetched
+			tracked = true
+			c.debugf("[回复] 评论 %d 从第 %d 页继续 (已处理 %d 条)\n", rpid, page, total)
+		}
+	}
+	saveProgress := func(page int) {
+		if !c.config.Resume {
+			return
+		}
+		tracked = true
+		storage.SaveReplyProgress(rpid, storage.ReplyProgress{Page: page, Fetched: total, Aid: task.Aid})
+	}
+	finish := func() (int, error) {
+		if tracked {
+			storage.ClearReplyProgress(rpid)
+		}
+		return total, nil
+	}
+
+	result, err := c.fetchReplyPage(task.Aid, rpid, page, session)
+	if err != nil {
+		return total, err
+	}
+	if len(result.Replies) == 0 {
+		return finish()
+	}
+	total += c.handleReplies(result.Replies, task.Bvid, ctx)
+	if total >= result.TotalCount || page == task.MaxPages {
+		return finish()
+	}
+	saveProgress(page)
+	c.delay()
+	page++
+
+	if c.isCancelled() {
+		return total, errCancelled
+	}
+
+	if parallel := c.live().ReplyPageParallel; parallel > 1 {
+		lastPage := replyPageCount(result.TotalCount)
+		if task.MaxPages > 0 && lastPage > task.MaxPages {
+			lastPage = task.MaxPages
+		}
+		if lastPage >= page {
+			handled, err := c.fetchReplyPages(threadID, task, ctx, page, lastPage, parallel, session)
+			total += handled
+			if err != nil {
+				// Pages of the failed batch may be missing, so the thread
+				// resumes from before it
+				return total, err
+			}
+			if total >= result.TotalCount || lastPage == task.MaxPages {
+				return finish()
+			}
+			saveProgress(lastPage)
+			// Replies posted meanwhile may have pushed some onto later pages
+			page = lastPage + 1
+		}
+	}
+
+	for ; task.MaxPages == 0 || page <= task.MaxPages; page++ {
+		if c.isCancelled() {
+			return total, errCancelled
+		}
+		result, err := c.fetchReplyPage(task.Aid, rpid, page, session)
+		if err != nil {
+			return total, err
+		}
+		if len(result.Replies) == 0 {
+			return finish()
+		}
+
+		total += c.handleReplies(result.Replies, task.Bvid, ctx)
+		if total >= result.TotalCount {
+			return finish()
+		}
+		saveProgress(page)
+		c.delay()
+	}
+	return finish()
+}
+
+// fetchReplyPages fetches pages from..to of a root comment with at most
+// parallel requests in flight and returns the number of replies handled.
+// No new pages are started after the first error or after Cancel. A page
+// that panics fails the batch like an error, so the reply task is recorded
+// as failed and the thread resumes from before the batch.
+func (c *BiliCrawler) fetchReplyPages(threadID int, task *CommentTask, ctx commentContext, from, to, parallel int, session *api.Session) (int, error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		total    int
+		firstErr error
+	)
+	slots := make(chan struct{}, parallel)
+
+	for page := from; page <= to; page++ {
+		slots <- struct{}{}
+
+		mu.Lock()
+		if firstErr == nil && c.isCancelled() {
+			firstErr = errCancelled
+		}
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			<-slots
+			break
+		}
+
+		wg.Add(1)
+		go func(page int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			// Stays set if the page panics
+			err := fmt.Errorf("page %d panicked", page)
+			handled := 0
+			c.recoverTask("reply", threadID, nil, func() {
+				handled, err = c.handleReplyPage(task, ctx, page, session)
+			})
+
+			mu.Lock()
+			total += handled
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+			if err == nil {
+				c.delay()
+			}
+		}(page)
+	}
+	wg.Wait()
+
+	return total, firstErr
+}
+
+// handleReplyPage fetches and handles one reply page of a parallel batch and
+// returns how many replies were handled
+func (c *BiliCrawler) handleReplyPage(task *CommentTask, ctx commentContext, page int, session *api.Session) (int, error) {
+	result, err := c.fetchReplyPage(task.Aid, ctx.RootRpid, page, session)
+	if err != nil {
+		return 0, err
+	}
+	return c.handleReplies(result.Replies, task.Bvid, ctx), nil
+}
+
+// replyPageCount returns the number of reply pages needed for total replies
+func replyPageCount(total int) int {
+	return (total + replyPageSize - 1) / replyPageSize
+}
+
+func (c *BiliCrawler) fetchReplyPage(aid, rpid int64, page int, session *api.Session) (*api.ReplyCommentsResult, error) {
+	result, err := api.GetReplyComments(aid, rpid, page, replyPageSize, session, c.config.CookieConfigPath)
+	c.recordResult("reply", err)
+	return result, err
+}
+
+// handleReplies filters, enriches and saves one page of replies and returns
+// how many were handled, including skipped and filtered ones
+func (c *BiliCrawler) handleReplies(replies []map[string]interface{}, bvid string, ctx commentContext) int {
+	handled := 0
+	for _, reply := range replies {
+		ids := newCommentIDs(reply)
+		saved := c.config.Resume && c.isRpidSaved(ids.key())
+		if !saved && !c.allowComment(reply, bvid) {
+			handled++
+			continue
+		}
+		if ids.Mid != 0 {
+			c.addUserMid(ids.midKey(), storage.MidSource{Role: storage.MidReplier, Bvid: ctx.Bvid, Rpid: ids.Rpid})
+		}
+
+		if saved {
+			handled++
+			continue
+		}
+
+		enrichComment(reply, ctx)
+		reply, keep := c.applyScript("comment", reply)
+		if !keep {
+			c.stats.incCommentsFiltered()
+			handled++
+			continue
+		}
+		if err := storage.SaveComment(reply); err == nil {
+			c.stats.incRepliesSaved()
+			c.stats.incKeyword(ctx.Keyword, func(k *KeywordCounts) { k.Replies++ })
+			c.markRpidSaved(ids.key())
+			handled++
+		}
+	}
+	return handled
+}
@@ -0,0 +1,244 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestReplyPageCount(t *testing.T) {
+	tests := []struct {
+		total    int
+		expected int
+	}{
+		{0, 0},
+		{1, 1},
+		{20, 1},
+		{21, 2},
+		{4001, 201},
+	}
+
+	for _, tt := range tests {
+		if got := replyPageCount(tt.total); got != tt.expected {
+			t.Errorf("replyPageCount(%d) = %d, expected %d", tt.total, got, tt.expected)
+		}
+	}
+}
+
+func TestBiliCrawler_CrawlReplies_Resume(t *testing.T) {
+	const replies = 50 // three pages
+
+	var mu sync.Mutex
+	var pages []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("pn"))
+		mu.Lock()
+		pages = append(pages, page)
+		mu.Unlock()
+
+		list := ""
+		for i := (page-1)*replyPageSize + 1; i <= min(page*replyPageSize, replies); i++ {
+			if list != "" {
+				list += ","
+			}
+			list += fmt.Sprintf(`{"rpid":%d,"mid":%d,"ctime":1,"rcount":0,"content":{"message":"hi"},"member":{}}`, 1000+i, i)
+		}
+		fmt.Fprintf(w, `{"code":0,"data":{"replies":[%s],"page":{"count":%d}}}`, list, replies)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error { return nil }))
+	defer storage.SetSink(nil)
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.savedRpids = newDedupSet(0, "")
+	c.savedMids = newDedupSet(0, "")
+	c.userMids = make(map[string]storage.MidSource)
+
+	// An earlier run was interrupted after the second page
+	storage.SaveReplyProgress(7, storage.ReplyProgress{Page: 2, Fetched: 40, Aid: 1})
+
+	total, err := c.crawlReplies(0, &CommentTask{Aid: 1, Bvid: "BV1", Rpid: 7}, 7, nil)
+	if err != nil {
+		t.Fatalf("crawlReplies: %v", err)
+	}
+	if total != replies {
+		t.Errorf("total = %d, expected %d", total, replies)
+	}
+	if len(pages) != 1 || pages[0] != 3 {
+		t.Errorf("fetched pages %v, expected only page 3", pages)
+	}
+	if _, ok, _ := storage.GetReplyProgress(7); ok {
+		t.Error("progress should be cleared once the replies are done")
+	}
+
+	// Without resume the saved progress is ignored
+	c.config.Resume = false
+	pages = nil
+	storage.SaveReplyProgress(7, storage.ReplyProgress{Page: 2, Fetched: 40, Aid: 1})
+	if total, _ := c.crawlReplies(0, &CommentTask{Aid: 1, Bvid: "BV1", Rpid: 7, MaxPages: 2}, 7, nil); total != 2*replyPageSize {
+		t.Errorf("total = %d, expected %d", total, 2*replyPageSize)
+	}
+	if len(pages) != 2 || pages[0] != 1 {
+		t.Errorf("fetched pages %v, expected pages 1 and 2", pages)
+	}
+	if progress, _, _ := storage.GetReplyProgress(7); progress.Page != 2 {
+		t.Errorf("progress = %+v, expected it left alone without resume", progress)
+	}
+}
+
+func TestBiliCrawler_CrawlReplies_StopsOnCancel(t *testing.T) {
+	const replies = 50 // three pages
+
+	var pages []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("pn"))
+		pages = append(pages, page)
+		fmt.Fprintf(w, `{"code":0,"data":{"replies":[{"rpid":%d,"mid":1,"ctime":1,"content":{"message":"hi"},"member":{}}],"page":{"count":%d}}}`, 1000+page, replies)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+
+	c := newReloadCrawler()
+	c.cancelled = make(chan struct{})
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.Resume = true
+	c.savedRpids = newDedupSet(0, "")
+	c.savedMids = newDedupSet(0, "")
+	c.userMids = make(map[string]storage.MidSource)
+	c.failedTasks = make(map[string]struct{})
+	// The crawl is cancelled while the first page is saved
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		c.Cancel()
+		return nil
+	}))
+	t.Cleanup(func() { storage.SetSink(nil) })
+
+	for _, parallel := range []int{1, 3} {
+		c.config.ReplyPageParallel = parallel
+		pages = nil
+		storage.ClearReplyProgress(7)
+
+		if _, err := c.crawlReplies(0, &CommentTask{Aid: 1, Bvid: "BV1", Rpid: 7}, 7, nil); !errors.Is(err, errCancelled) {
+			t.Errorf("parallel %d: crawlReplies = %v, expected %v", parallel, err, errCancelled)
+		}
+		if len(pages) != 1 || pages[0] != 1 {
+			t.Errorf("parallel %d: fetched pages %v, expected only page 1", parallel, pages)
+		}
+		if progress, ok, _ := storage.GetReplyProgress(7); !ok || progress.Page != 1 {
+			t.Errorf("parallel %d: progress = %+v, %v; expected page 1 kept for resume", parallel, progress, ok)
+		}
+	}
+}
+
+func TestBiliCrawler_ReplyWorker_CheckpointsOnCancel(t *testing.T) {
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+
+	c := newReloadCrawler()
+	c.cancelled = make(chan struct{})
+	c.failedTasks = make(map[string]struct{})
+	c.commentQueue = make(chan *CommentTask, 2)
+	c.commentQueue <- &CommentTask{Aid: 1, Bvid: "BV1", Title: "视频", Keyword: "测试", Rpid: 7, Rcount: 30}
+	c.commentQueue <- &CommentTask{Aid: 1, Bvid: "BV1", Title: "视频", Keyword: "测试", Rpid: 8, Rcount: 5}
+	close(c.commentQueue)
+	c.Cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	c.replyWorker(0, &wg, make(chan struct{}), nil)
+	c.checkpointDroppedReplies()
+
+	tasks, err := storage.GetFailedTasks()
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("failed tasks = %+v, %v; expected both dropped reply tasks", tasks, err)
+	}
+	for _, task := range tasks {
+		if task.Kind != storage.FailedReply || task.Error != errCancelled.Error() || task.Bvid != "BV1" || task.Title != "视频" {
+			t.Errorf("task = %+v, expected a cancelled reply task with its video", task)
+		}
+	}
+
+	// A resumed run queues them again, and retry-failed does not repeat them
+	resumed := newReloadCrawler()
+	resumed.failedTasks = make(map[string]struct{})
+	resumed.commentQueue = make(chan *CommentTask, 4)
+	resumed.queueCancelledReplies()
+	resumed.queueFailedTasks()
+	close(resumed.commentQueue)
+	var rpids []int64
+	for task := range resumed.commentQueue {
+		rpids = append(rpids, task.Rpid)
+	}
+	if len(rpids) != 2 || rpids[0] != 7 || rpids[1] != 8 {
+		t.Errorf("queued replies %v, expected [7 8] once each", rpids)
+	}
+}
+
+func TestBiliCrawler_FetchReplyPages_RecoversPanic(t *testing.T) {
+	const replies = 60 // three pages
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("pn"))
+		fmt.Fprintf(w, `{"code":0,"data":{"replies":[{"rpid":%d,"mid":1,"ctime":1,"content":{"message":"hi"},"member":{}}],"page":{"count":%d}}}`, 1000+page, replies)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+	// Saving the reply of page 2 panics
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		if key == "1002" {
+			panic("sink bug")
+		}
+		return nil
+	}))
+	t.Cleanup(func() { storage.SetSink(nil) })
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.Resume = true
+	c.config.ReplyPageParallel = 3
+	c.recentErrors = newLogBuffer(10)
+	c.savedRpids = newDedupSet(0, "")
+	c.savedMids = newDedupSet(0, "")
+	c.userMids = make(map[string]storage.MidSource)
+
+	total, err := c.crawlReplies(0, &CommentTask{Aid: 1, Bvid: "BV1", Rpid: 7}, 7, nil)
+	if err == nil {
+		t.Error("crawlReplies should fail when a page of the batch panics")
+	}
+	if total != 2 {
+		t.Errorf("total = %d, expected the replies of pages 1 and 3", total)
+	}
+	if got := c.stats.Snapshot().Panics; got != 1 {
+		t.Errorf("Panics = %d, expected 1", got)
+	}
+	// The batch is fetched again on resume
+	if progress, ok, _ := storage.GetReplyProgress(7); !ok || progress.Page != 1 {
+		t.Errorf("progress = %+v, %v; expected page 1 before the batch", progress, ok)
+	}
+}
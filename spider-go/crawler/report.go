@@ -0,0 +1,214 @@
+package crawler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	"spider-go/api"
+	"spider-go/cookie"
+)
+
+// Exit codes of a finished run
+const (
+	ExitCompleted           = 0
+	ExitCompletedWithErrors = 5
+	ExitCancelled           = 7
+)
+
+// Run outcomes written to the report
+const (
+	OutcomeCompleted           = "completed"
+	OutcomeCompletedWithErrors = "completed_with_errors"
+	OutcomeAbortedRiskControl  = "aborted_risk_control"
+	OutcomeBudgetExhausted     = "budget_exhausted"
+	OutcomeStalled             = "stalled"
+	OutcomeCancelled           = "cancelled"
+)
+
+// outcomeCodes maps exit codes to their report outcome
+var outcomeCodes = map[int]string{
+	ExitCompleted:           OutcomeCompleted,
+	ExitCompletedWithErrors: OutcomeCompletedWithErrors,
+	ExitAbortedRiskControl:  OutcomeAbortedRiskControl,
+	ExitBudgetExhausted:     OutcomeBudgetExhausted,
+	ExitStalled:             OutcomeStalled,
+	ExitCancelled:           OutcomeCancelled,
+}
+
+// KeywordCounts holds what was saved for one search keyword
+type KeywordCounts struct {
+	Videos   int `json:"videos"`
+	Comments int `json:"comments"`
+	Replies  int `json:"replies"`
+}
+
+// Report is the machine-readable summary written at the end of a run
+type Report struct {
+	RunID           string                    `json:"run_id"`
+	Outcome         string                    `json:"outcome"`
+	ExitCode        int                       `json:"exit_code"`
+	Reason          string                    `json:"reason,omitempty"`
+	ConfigHash      string                    `json:"config_hash"`
+	Keywords        []string                  `json:"keywords"`
+	Started         time.Time                 `json:"started"`
+	Finished        time.Time                 `json:"finished"`
+	DurationSeconds float64                   `json:"duration_seconds"`
+	Counters        Counters                  `json:"counters"`
+	PerKeyword      map[string]KeywordCounts  `json:"per_keyword"`
+	Errors          map[string]map[string]int `json:"errors"` // stage -> API code ("network" for transport errors, "save" for records not saved) -> count
+	FailedTasks     int                       `json:"failed_tasks"`
+	CommentGaps     []CommentGap              `json:"comment_gaps,omitempty"`
+	SchemaDrift     []api.Drift               `json:"schema_drift,omitempty"`
+	CookieUsage     []cookie.Usage            `json:"cookie_usage,omitempty"`
+	Latency         []api.Latency             `json:"latency,omitempty"` // response latency per endpoint
+}
+
+func (s *Stats) incKeyword(keyword string, inc func(*KeywordCounts)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.perKeyword == nil {
+		s.perKeyword = make(map[string]*KeywordCounts)
+	}
+	counts, ok := s.perKeyword[keyword]
+	if !ok {
+		counts = &KeywordCounts{}
+		s.perKeyword[keyword] = counts
+	}
+	inc(counts)
+}
+
+func (s *Stats) incError(stage string, err error) {
+	code := "network"
+	if n := api.ErrorCode(err); n != 0 {
+		code = strconv.Itoa(n)
+	}
+
+	s.countError(stage, code)
+}
+
+// incSaveError counts a record of stage that could not be saved, under the
+// code "save"
+func (s *Stats) incSaveError(stage string) {
+	s.countError(stage, "save")
+}
+
+func (s *Stats) countError(stage, code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.errors == nil {
+		s.errors = make(map[string]map[string]int)
+	}
+	if s.errors[stage] == nil {
+		s.errors[stage] = make(map[string]int)
+	}
+	s.errors[stage][code]++
+}
+
+// breakdown returns copies of the per-keyword counts and the error breakdown
+func (s *Stats) breakdown() (map[string]KeywordCounts, map[string]map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	perKeyword := make(map[string]KeywordCounts, len(s.perKeyword))
+	for keyword, counts := range s.perKeyword {
+		perKeyword[keyword] = *counts
+	}
+	errors := make(map[string]map[string]int, len(s.errors))
+	for stage, codes := range s.errors {
+		errors[stage] = make(map[string]int, len(codes))
+		for code, n := range codes {
+			errors[stage][code] = n
+		}
+	}
+	return perKeyword, errors
+}
+
+// configHash identifies the effective config of a run
+func configHash(config Config) string {
+	data, _ := json.Marshal(config)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// completionCode returns the exit code of a run that was not aborted
+func (c *BiliCrawler) completionCode() int {
+	panics := c.stats.Snapshot().Panics
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.failedTasks) > 0 || panics > 0 {
+		return ExitCompletedWithErrors
+	}
+	return ExitCompleted
+}
+
+// buildReport summarizes the run for an exit code
+func (c *BiliCrawler) buildReport(code int, reason string, now time.Time) Report {
+	started, _, _ := c.health.snapshot()
+	perKeyword, errors := c.stats.breakdown()
+
+	c.mu.Lock()
+	failed := len(c.failedTasks)
+	c.mu.Unlock()
+
+	report := Report{
+		RunID:       c.runID,
+		Outcome:     outcomeCodes[code],
+		ExitCode:    code,
+		Reason:      reason,
+		ConfigHash:  configHash(c.live()),
+		Keywords:    c.Keywords(),
+		Started:     started,
+		Finished:    now,
+		Counters:    c.stats.Snapshot(),
+		PerKeyword:  perKeyword,
+		Errors:      errors,
+		FailedTasks: failed,
+		CommentGaps: c.stats.commentGaps(),
+		SchemaDrift: api.DriftReport(),
+		CookieUsage: c.cookieUsage(),
+		Latency:     api.LatencyReport(),
+	}
+	if !started.IsZero() {
+		report.DurationSeconds = now.Sub(started).Seconds()
+	}
+	return report
+}
+
+// finish records the exit code of the run, writes report_path and
+// publishes the report to claw_run_stats
+func (c *BiliCrawler) finish(code int, reason string) {
+	c.mu.Lock()
+	c.exitCode = code
+	c.mu.Unlock()
+	c.saveCookieUsage(time.Now())
+
+	now := time.Now()
+	report := c.buildReport(code, reason, now)
+	c.publishRunStats(RunStats{Type: RunStatsSummary, SentAt: now, Summary: &report})
+
+	path := c.config.ReportPath
+	if path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		c.errorf("写入运行报告失败: %v\n", err)
+		return
+	}
+	c.summaryf("运行报告已写入 %s\n", path)
+}
+
+// ExitCode returns the process exit code for the finished run
+func (c *BiliCrawler) ExitCode() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.exitCode
+}
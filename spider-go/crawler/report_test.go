@@ -0,0 +1,74 @@
+package crawler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+func TestBiliCrawler_Report(t *testing.T) {
+	// finish saves the cookie usage into the record directory
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+
+	c := newReloadCrawler()
+	c.failedTasks = make(map[string]struct{})
+	c.config.ReportPath = filepath.Join(t.TempDir(), "report.json")
+	c.health.start(time.Now().Add(-time.Minute))
+
+	c.stats.incKeyword("测试", func(k *KeywordCounts) { k.Videos++ })
+	c.stats.incKeyword("测试", func(k *KeywordCounts) { k.Comments += 2 })
+	c.recordResult("comment", &api.Error{Code: -352})
+	c.recordResult("comment", &api.Error{Code: -352})
+	c.recordResult("account", fmt.Errorf("connection reset"))
+
+	if code := c.completionCode(); code != ExitCompleted {
+		t.Errorf("completionCode = %d, expected %d", code, ExitCompleted)
+	}
+	c.failedTasks[failedKey("video", "BV1")] = struct{}{}
+	c.finish(c.completionCode(), "")
+
+	if c.ExitCode() != ExitCompletedWithErrors {
+		t.Errorf("ExitCode = %d, expected %d", c.ExitCode(), ExitCompletedWithErrors)
+	}
+
+	data, err := os.ReadFile(c.config.ReportPath)
+	if err != nil {
+		t.Fatalf("Report not written: %v", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Invalid report: %v", err)
+	}
+
+	if report.Outcome != OutcomeCompletedWithErrors || report.FailedTasks != 1 {
+		t.Errorf("Unexpected outcome: %s, failed tasks %d", report.Outcome, report.FailedTasks)
+	}
+	if report.PerKeyword["测试"] != (KeywordCounts{Videos: 1, Comments: 2}) {
+		t.Errorf("Unexpected per-keyword counts: %+v", report.PerKeyword)
+	}
+	if report.Errors["comment"]["-352"] != 2 || report.Errors["account"]["network"] != 1 {
+		t.Errorf("Unexpected error breakdown: %+v", report.Errors)
+	}
+	if report.DurationSeconds < 59 || report.ConfigHash != configHash(c.config) {
+		t.Errorf("Unexpected duration %v or config hash %s", report.DurationSeconds, report.ConfigHash)
+	}
+}
+
+func TestConfigHash(t *testing.T) {
+	a := DefaultConfig()
+	b := DefaultConfig()
+	if configHash(a) != configHash(b) {
+		t.Error("Equal configs should hash equally")
+	}
+	b.NThreads++
+	if configHash(a) == configHash(b) {
+		t.Error("Different configs should hash differently")
+	}
+}
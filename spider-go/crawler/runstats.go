@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+// Types of claw_run_stats messages
+const (
+	RunStatsHeartbeat = "heartbeat"
+	RunStatsSummary   = "summary"
+)
+
+// RunStats is a message on claw_run_stats: a heartbeat every
+// run_stats_interval while the crawl runs, then its summary when it ends
+type RunStats struct {
+	Type   string    `json:"type"`
+	RunID  string    `json:"run_id"`
+	Host   string    `json:"host"`
+	SentAt time.Time `json:"sent_at"`
+
+	Heartbeat *Heartbeat `json:"heartbeat,omitempty"`
+	Summary   *Report    `json:"summary,omitempty"`
+}
+
+// Heartbeat is the progress of a running crawl
+type Heartbeat struct {
+	Keywords      []string     `json:"keywords"`
+	Started       time.Time    `json:"started"`
+	UptimeSeconds float64      `json:"uptime_seconds"`
+	Requests      int64        `json:"requests"`
+	Paused        bool         `json:"paused"`
+	InFlight      int64        `json:"in_flight"`
+	Counters      Counters     `json:"counters"`
+	Queues        []QueueDepth `json:"queues"`
+}
+
+// newRunID names a run after its host, start time and process
+func newRunID(host string, now time.Time) string {
+	return fmt.Sprintf("%s-%s-%d", host, now.UTC().Format("20060102T150405Z"), os.Getpid())
+}
+
+// hostname returns the name of this host, or "unknown"
+func hostname() string {
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// heartbeat returns the progress of the crawl at now
+func (c *BiliCrawler) heartbeat(now time.Time) *Heartbeat {
+	started, _, _ := c.health.snapshot()
+	h := &Heartbeat{
+		Keywords: c.Keywords(),
+		Started:  started,
+		Requests: ratelimit.Requests(),
+		Paused:   ratelimit.IsPaused(),
+		InFlight: ratelimit.InFlight(),
+		Counters: c.stats.Snapshot(),
+		Queues:   c.queueDepths(),
+	}
+	if !started.IsZero() {
+		h.UptimeSeconds = now.Sub(started).Seconds()
+	}
+	return h
+}
+
+// publishRunStats sends a message to claw_run_stats if run_stats is on
+func (c *BiliCrawler) publishRunStats(msg RunStats) {
+	if !c.config.RunStats {
+		return
+	}
+	msg.RunID = c.runID
+	msg.Host = c.host
+	if err := storage.PublishRunStats(c.runID, msg); err != nil {
+		c.errorf("发布运行统计失败: %v\n", err)
+	}
+}
+
+// watchRunStats publishes a heartbeat every run_stats_interval until stop
+// is closed
+func (c *BiliCrawler) watchRunStats(stop <-chan struct{}) {
+	if !c.config.RunStats {
+		return
+	}
+	interval, err := time.ParseDuration(c.config.RunStatsInterval)
+	if err != nil || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			c.publishRunStats(RunStats{Type: RunStatsHeartbeat, SentAt: now, Heartbeat: c.heartbeat(now)})
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package crawler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"spider-go/storage"
+)
+
+// captureRunStats sends claw_run_stats messages to the returned channel
+func captureRunStats(t *testing.T) <-chan RunStats {
+	t.Helper()
+	messages := make(chan RunStats, 16)
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error {
+		if topic != "claw_run_stats" {
+			return nil
+		}
+		var msg RunStats
+		if err := json.Unmarshal(value, &msg); err != nil {
+			t.Errorf("run stats message is not JSON: %v", err)
+		}
+		if key != msg.RunID {
+			t.Errorf("run stats key = %q, want the run ID %q", key, msg.RunID)
+		}
+		messages <- msg
+		return nil
+	}))
+	t.Cleanup(func() { storage.SetSink(nil) })
+	return messages
+}
+
+func TestNewRunID(t *testing.T) {
+	id := newRunID("host", time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC))
+	if !strings.HasPrefix(id, "host-20240501T083000Z-") {
+		t.Errorf("newRunID = %q", id)
+	}
+}
+
+func TestBiliCrawler_FinishPublishesSummary(t *testing.T) {
+	messages := captureRunStats(t)
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+	c := newReloadCrawler()
+	c.config.ReportPath = ""
+	c.config.RunStats = true
+	c.runID, c.host = "host-run", "host"
+	c.stats.incVideosSaved()
+
+	c.finish(ExitCompleted, "")
+
+	select {
+	case msg := <-messages:
+		if msg.Type != RunStatsSummary || msg.RunID != "host-run" || msg.Host != "host" {
+			t.Errorf("message = %+v, want a summary of host-run", msg)
+		}
+		if msg.Summary == nil || msg.Summary.RunID != "host-run" || msg.Summary.Counters.VideosSaved != 1 {
+			t.Errorf("summary = %+v, want the run report", msg.Summary)
+		}
+	default:
+		t.Fatal("No summary was published")
+	}
+}
+
+func TestBiliCrawler_WatchRunStats(t *testing.T) {
+	messages := captureRunStats(t)
+	c := newReloadCrawler()
+	c.runID = "host-run"
+	c.health.start(time.Now())
+
+	// Off by default
+	stop := make(chan struct{})
+	c.watchRunStats(stop)
+	close(stop)
+
+	c.config.RunStats = true
+	c.config.RunStatsInterval = "10ms"
+	stop = make(chan struct{})
+	defer close(stop)
+	go c.watchRunStats(stop)
+
+	select {
+	case msg := <-messages:
+		if msg.Type != RunStatsHeartbeat || msg.Heartbeat == nil || len(msg.Heartbeat.Queues) == 0 {
+			t.Errorf("message = %+v, want a heartbeat", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("No heartbeat was published")
+	}
+}
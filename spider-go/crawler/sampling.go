@@ -0,0 +1,155 @@
+package crawler
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// Comment sampling modes
+const (
+	SampleFirst  = "first"
+	SampleEvery  = "every"
+	SampleRandom = "random"
+	SampleTop    = "top"
+)
+
+// CommentSamplingConfig samples the main comments of large comment sections
+// instead of paging through all of them
+type CommentSamplingConfig struct {
+	// "first" fetches the first Pages pages, newest first; "every" every
+	// Step-th page from the first; "random" Pages distinct pages picked at
+	// random; "top" the first Pages pages in hot order. "" crawls in full.
+	Mode string `json:"mode"`
+	// Only videos reporting at least this many comments are sampled
+	MinReplies int `json:"min_replies"`
+	Pages      int `json:"pages"`
+	Step       int `json:"step"`
+	// Random samples are seeded by Seed and the video's BVID, so a rerun
+	// picks the same pages
+	Seed int64 `json:"seed"`
+}
+
+// applies reports whether a video reporting replyCount comments is sampled
+func (s CommentSamplingConfig) applies(replyCount int) bool {
+	return s.Mode != "" && replyCount >= s.MinReplies
+}
+
+// samplePages returns the pages, from 1 and in order, an "every" or
+// "random" sample of a video with totalPages main comment pages fetches
+func samplePages(s CommentSamplingConfig, totalPages int, bvid string) []int {
+	var pages []int
+	switch s.Mode {
+	case SampleEvery:
+		for page := 1; page <= totalPages; page += max(s.Step, 1) {
+			pages = append(pages, page)
+		}
+	case SampleRandom:
+		h := fnv.New64a()
+		h.Write([]byte(bvid))
+		r := rand.New(rand.NewSource(s.Seed ^ int64(h.Sum64())))
+		for _, i := range r.Perm(totalPages)[:min(s.Pages, totalPages)] {
+			pages = append(pages, i+1)
+		}
+		sort.Ints(pages)
+	}
+	return pages
+}
+
+// crawlSampledComments crawls a sample of a video's main comments, with
+// all replies of each, and records the sample in the video's progress
+func (c *BiliCrawler) crawlSampledComments(threadID int, ctx commentContext, session *api.Session) {
+	s := c.config.CommentSampling
+	sample := storage.CommentSample{Mode: s.Mode}
+	c.debugf("[评论线程%d] %s (aid=%d) 按 %s 方式抽样评论...\n", threadID, ctx.Bvid, ctx.Aid, s.Mode)
+
+	var commentCount int
+	var err error
+	switch s.Mode {
+	case SampleFirst, SampleTop:
+		commentCount, err = c.sampleLeadingPages(ctx, &sample, session)
+	default:
+		commentCount, err = c.sampleNumberedPages(ctx, &sample, session)
+	}
+	if err != nil {
+		c.errorf("[评论线程%d] %s 抽样评论获取错误: %v\n", threadID, ctx.Bvid, err)
+		c.recordFailure(storage.FailedTask{Kind: storage.FailedComment, ID: ctx.Bvid, Aid: ctx.Aid, Title: ctx.Title, Keyword: ctx.Keyword}, err)
+		return
+	}
+	if c.isCancelled() {
+		return
+	}
+
+	storage.MarkVideoCommentsSampled(ctx.Bvid, sample)
+	c.clearFailure(storage.FailedComment, ctx.Bvid)
+	c.debugf("[评论线程%d] %s 抽样完成，%d 页共 %d 条一级评论\n", threadID, ctx.Bvid, len(sample.Pages), commentCount)
+}
+
+// sampleLeadingPages fetches the first pages of a video's comments in time
+// order ("first") or hot order ("top")
+func (c *BiliCrawler) sampleLeadingPages(ctx commentContext, sample *storage.CommentSample, session *api.Session) (int, error) {
+	mode := api.CommentModeTime
+	if sample.Mode == SampleTop {
+		mode = api.CommentModeHot
+	}
+
+	saved := 0
+	cursor := ""
+	for page := 1; page <= c.config.CommentSampling.Pages; page++ {
+		result, err := api.GetMainCommentsSorted(ctx.Aid, cursor, mode, session, c.config.CookieConfigPath)
+		c.recordResult("comment", err)
+		if err != nil {
+			return saved, err
+		}
+		saved += c.handleMainComments(markPinned(result.TopReplies), ctx, 0)
+		saved += c.handleMainComments(result.Replies, ctx, 0)
+		sample.Pages = append(sample.Pages, page)
+		if result.IsEnd || len(result.Replies) == 0 || c.isCancelled() {
+			break
+		}
+		cursor = result.NextCursor
+		c.delay()
+	}
+	return saved, nil
+}
+
+// sampleNumberedPages fetches the pages of an "every" or "random" sample
+// from the page-numbered reply API. Its first page tells the page count;
+// its comments are only kept if the sample includes it.
+func (c *BiliCrawler) sampleNumberedPages(ctx commentContext, sample *storage.CommentSample, session *api.Session) (int, error) {
+	first, err := c.fetchMainComments(ctx.Aid, legacyCursorPrefix+"1", session)
+	c.recordResult("comment", err)
+	if err != nil {
+		return 0, err
+	}
+	s := c.config.CommentSampling
+	sample.TotalComments = first.Total
+	sample.TotalPages = (first.Total + api.LegacyCommentPageSize - 1) / api.LegacyCommentPageSize
+	if s.Mode == SampleRandom {
+		sample.Seed = s.Seed
+	}
+
+	saved := 0
+	for _, page := range samplePages(s, sample.TotalPages, ctx.Bvid) {
+		if c.isCancelled() {
+			break
+		}
+		result := first
+		if page != 1 {
+			c.delay()
+			result, err = c.fetchMainComments(ctx.Aid, legacyCursorPrefix+strconv.Itoa(page), session)
+			c.recordResult("comment", err)
+			if err != nil {
+				return saved, err
+			}
+		}
+		saved += c.handleMainComments(markPinned(result.TopReplies), ctx, 0)
+		saved += c.handleMainComments(result.Replies, ctx, 0)
+		sample.Pages = append(sample.Pages, page)
+	}
+	return saved, nil
+}
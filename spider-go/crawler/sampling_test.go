@@ -0,0 +1,100 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestSamplePages(t *testing.T) {
+	every := CommentSamplingConfig{Mode: SampleEvery, Step: 10}
+	if pages := samplePages(every, 25, "BV1"); !reflect.DeepEqual(pages, []int{1, 11, 21}) {
+		t.Errorf("every 10th of 25 pages = %v", pages)
+	}
+
+	random := CommentSamplingConfig{Mode: SampleRandom, Pages: 3, Seed: 7}
+	pages := samplePages(random, 10, "BV1")
+	if len(pages) != 3 || !sortedDistinct(pages, 10) {
+		t.Errorf("random 3 of 10 pages = %v, want 3 distinct sorted pages in [1, 10]", pages)
+	}
+	if again := samplePages(random, 10, "BV1"); !reflect.DeepEqual(again, pages) {
+		t.Errorf("random sample changed between runs: %v then %v", pages, again)
+	}
+	if all := samplePages(random, 2, "BV1"); !reflect.DeepEqual(all, []int{1, 2}) {
+		t.Errorf("random 3 of 2 pages = %v, want both", all)
+	}
+}
+
+func sortedDistinct(pages []int, last int) bool {
+	for i, page := range pages {
+		if page < 1 || page > last || (i > 0 && page <= pages[i-1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCommentSamplingConfig_Applies(t *testing.T) {
+	s := CommentSamplingConfig{MinReplies: 1000}
+	if s.applies(5000) {
+		t.Error("Sampling without a mode should not apply")
+	}
+	s.Mode = SampleFirst
+	if s.applies(999) || !s.applies(1000) {
+		t.Error("Sampling should apply from min_replies comments")
+	}
+}
+
+func TestBiliCrawler_CrawlSampledComments_Every(t *testing.T) {
+	const comments = 65 // four legacy pages
+
+	var mu sync.Mutex
+	var pages []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("pn"))
+		mu.Lock()
+		pages = append(pages, page)
+		mu.Unlock()
+		fmt.Fprintf(w, `{"code":0,"data":{"page":{"count":%d},"replies":[{"rpid":%d,"mid":1,"ctime":1,"rcount":0,"content":{"message":"hi"},"member":{}}]}}`,
+			comments, 9000+page)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+	storage.SetSink(storage.SinkFunc(func(topic, key string, value []byte) error { return nil }))
+	defer storage.SetSink(nil)
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.CommentSampling = CommentSamplingConfig{Mode: SampleEvery, Step: 2, Pages: 10}
+	c.savedRpids = newDedupSet(0, "")
+	c.savedMids = newDedupSet(0, "")
+	c.userMids = make(map[string]storage.MidSource)
+
+	c.crawlSampledComments(1, commentContext{Bvid: "BV1", Aid: 1}, nil)
+
+	if !reflect.DeepEqual(pages, []int{1, 3}) {
+		t.Errorf("fetched pages %v, want 1 and 3", pages)
+	}
+	if saved := c.stats.Snapshot().CommentsSaved; saved != 2 {
+		t.Errorf("CommentsSaved = %d, want 2", saved)
+	}
+	progress, _ := storage.GetVideoCommentProgress("BV1")
+	want := storage.CommentSample{Mode: SampleEvery, Pages: []int{1, 3}, TotalPages: 4, TotalComments: comments}
+	if !progress.Done || progress.Sample == nil || !reflect.DeepEqual(*progress.Sample, want) {
+		t.Errorf("progress = %+v with sample %+v, want done with %+v", progress, progress.Sample, want)
+	}
+}
@@ -0,0 +1,214 @@
+package crawler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// scriptTimeout bounds one call of a script hook function
+const scriptTimeout = time.Second
+
+// scriptFunctions are the global functions a hook script may define, one per
+// record kind. A missing function keeps every record of that kind.
+var scriptFunctions = map[string]string{
+	"video":   "filter_video",
+	"comment": "filter_comment",
+	"account": "filter_account",
+}
+
+// scriptHook runs a user Lua script that inspects each video, comment and
+// account record before it is saved. The hook function returns false or nil
+// to drop the record, true to keep it, or a table to save instead of it.
+type scriptHook struct {
+	state *lua.LState
+	mu    sync.Mutex // an LState is not safe for concurrent use
+}
+
+// loadScriptHook runs the script at path in a sandbox with only the base,
+// table, string and math libraries. print and log write through logf.
+func loadScriptHook(path string, logf func(format string, args ...interface{})) (*scriptHook, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "load", "loadstring"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	log := L.NewFunction(func(L *lua.LState) int {
+		var msg string
+		for i := 1; i <= L.GetTop(); i++ {
+			if i > 1 {
+				msg += "\t"
+			}
+			msg += L.ToStringMeta(L.Get(i)).String()
+		}
+		logf("[脚本] %s\n", msg)
+		return 0
+	})
+	L.SetGlobal("print", log)
+	L.SetGlobal("log", log)
+
+	if err := L.DoFile(path); err != nil {
+		L.Close()
+		return nil, err
+	}
+	return &scriptHook{state: L}, nil
+}
+
+// run passes record to the hook function of kind and returns the record to
+// save and whether to keep it
+func (h *scriptHook) run(kind string, record map[string]interface{}) (map[string]interface{}, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fn, ok := h.state.GetGlobal(scriptFunctions[kind]).(*lua.LFunction)
+	if !ok {
+		return record, true, nil
+	}
+
+	// Round-trip through JSON so the script sees exactly what is published
+	data, err := json.Marshal(record)
+	if err != nil {
+		return record, true, err
+	}
+	var plain map[string]interface{}
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return record, true, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), scriptTimeout)
+	defer cancel()
+	h.state.SetContext(ctx)
+	defer h.state.RemoveContext()
+
+	err = h.state.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, toLua(h.state, plain))
+	if err != nil {
+		return record, true, err
+	}
+	ret := h.state.Get(-1)
+	h.state.Pop(1)
+
+	switch v := ret.(type) {
+	case *lua.LNilType:
+		return record, false, nil
+	case lua.LBool:
+		return record, bool(v), nil
+	case *lua.LTable:
+		out, ok := fromLua(v, plain).(map[string]interface{})
+		if !ok {
+			return record, true, fmt.Errorf("%s returned an array, expected a record", scriptFunctions[kind])
+		}
+		return out, true, nil
+	}
+	return record, true, fmt.Errorf("%s returned %s, expected boolean, nil or table", scriptFunctions[kind], ret.Type())
+}
+
+// close releases the Lua state
+func (h *scriptHook) close() {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.state.Close()
+}
+
+// toLua converts a decoded JSON value to a Lua value
+func toLua(L *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		table := L.CreateTable(0, len(v))
+		for k, item := range v {
+			table.RawSetString(k, toLua(L, item))
+		}
+		return table
+	case []interface{}:
+		table := L.CreateTable(len(v), 0)
+		for _, item := range v {
+			table.Append(toLua(L, item))
+		}
+		return table
+	case string:
+		return lua.LString(v)
+	case float64:
+		return lua.LNumber(v)
+	case bool:
+		return lua.LBool(v)
+	}
+	return lua.LNil
+}
+
+// fromLua converts a Lua value back to a JSON value. Tables with only
+// integer keys become arrays. hint is the value the script was given, so
+// that an emptied array stays an array.
+func fromLua(value lua.LValue, hint interface{}) interface{} {
+	switch v := value.(type) {
+	case lua.LString:
+		return string(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LBool:
+		return bool(v)
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 && n == tableLen(v) {
+			hints, _ := hint.([]interface{})
+			out := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				var h interface{}
+				if i <= len(hints) {
+					h = hints[i-1]
+				}
+				out = append(out, fromLua(v.RawGetInt(i), h))
+			}
+			return out
+		}
+		if _, isArray := hint.([]interface{}); isArray && tableLen(v) == 0 {
+			return []interface{}{}
+		}
+		hints, _ := hint.(map[string]interface{})
+		out := make(map[string]interface{})
+		v.ForEach(func(key, item lua.LValue) {
+			k := key.String()
+			out[k] = fromLua(item, hints[k])
+		})
+		return out
+	}
+	return nil
+}
+
+// tableLen counts the entries of a table
+func tableLen(t *lua.LTable) int {
+	n := 0
+	t.ForEach(func(lua.LValue, lua.LValue) { n++ })
+	return n
+}
+
+// applyScript runs the script hook on a record before it is saved. A failing
+// script keeps the record unchanged.
+func (c *BiliCrawler) applyScript(kind string, record map[string]interface{}) (map[string]interface{}, bool) {
+	if c.script == nil {
+		return record, true
+	}
+	out, keep, err := c.script.run(kind, record)
+	if err != nil {
+		c.errorf("[脚本] %s 执行出错，保留原记录: %v\n", scriptFunctions[kind], err)
+		return record, true
+	}
+	return out, keep
+}
@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeScript writes a hook script to a temporary file and loads it
+func writeScript(t *testing.T, source string) *scriptHook {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.lua")
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+	hook, err := loadScriptHook(path, func(string, ...interface{}) {})
+	if err != nil {
+		t.Fatalf("loadScriptHook failed: %v", err)
+	}
+	t.Cleanup(hook.close)
+	return hook
+}
+
+func TestScriptHook_DropKeepModify(t *testing.T) {
+	hook := writeScript(t, `
+function filter_comment(c)
+  if string.find(c.content.message, "广告") then
+    return false
+  end
+  if c.like > 100 then
+    c.popular = true
+    return c
+  end
+  return true
+end
+`)
+
+	spam := map[string]interface{}{"like": 0, "content": map[string]interface{}{"message": "广告链接"}}
+	if _, keep, err := hook.run("comment", spam); err != nil || keep {
+		t.Errorf("Spam comment should be dropped (keep=%v, err=%v)", keep, err)
+	}
+
+	plain := map[string]interface{}{"like": 1, "content": map[string]interface{}{"message": "hi"}}
+	out, keep, err := hook.run("comment", plain)
+	if err != nil || !keep {
+		t.Fatalf("Plain comment should be kept (keep=%v, err=%v)", keep, err)
+	}
+	if _, ok := out["popular"]; ok {
+		t.Error("Returning true should keep the original record")
+	}
+
+	liked := map[string]interface{}{
+		"like":        200,
+		"emote_codes": []string{},
+		"content":     map[string]interface{}{"message": "hi"},
+	}
+	out, keep, err = hook.run("comment", liked)
+	if err != nil || !keep {
+		t.Fatalf("Liked comment should be kept (keep=%v, err=%v)", keep, err)
+	}
+	if out["popular"] != true || out["like"] != float64(200) {
+		t.Errorf("Returned table should replace the record, got %v", out)
+	}
+	if codes, ok := out["emote_codes"].([]interface{}); !ok || len(codes) != 0 {
+		t.Errorf("Empty array should stay an array, got %#v", out["emote_codes"])
+	}
+}
+
+func TestScriptHook_MissingFunctionKeeps(t *testing.T) {
+	hook := writeScript(t, `function filter_video(v) return false end`)
+
+	record := map[string]interface{}{"mid": 1}
+	out, keep, err := hook.run("account", record)
+	if err != nil || !keep || out["mid"] != 1 {
+		t.Errorf("Kinds without a function should be kept unchanged (keep=%v, err=%v)", keep, err)
+	}
+}
+
+func TestScriptHook_Sandboxed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hook.lua")
+	os.WriteFile(path, []byte(`os.exit(1)`), 0644)
+	if _, err := loadScriptHook(path, func(string, ...interface{}) {}); err == nil {
+		t.Error("The os library should not be available")
+	}
+}
+
+func TestScriptHook_Timeout(t *testing.T) {
+	hook := writeScript(t, `function filter_video(v) while true do end end`)
+
+	_, _, err := hook.run("video", map[string]interface{}{"bvid": "BV1"})
+	if err == nil {
+		t.Error("An endless loop should be stopped by the timeout")
+	}
+}
+
+func TestApplyScript_ErrorKeepsRecord(t *testing.T) {
+	c := newReloadCrawler()
+	c.recentErrors = newLogBuffer(10)
+	c.script = writeScript(t, `function filter_video(v) error("boom") end`)
+
+	record := map[string]interface{}{"bvid": "BV1"}
+	out, keep := c.applyScript("video", record)
+	if !keep || out["bvid"] != "BV1" {
+		t.Error("A failing script should keep the record")
+	}
+	if errs := c.recentErrors.Lines(); len(errs) == 0 || !strings.Contains(errs[0], "boom") {
+		t.Errorf("Script error should be logged, got %v", errs)
+	}
+}
+
+func TestScriptHook_Log(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hook.lua")
+	os.WriteFile(path, []byte(`print("loaded", 1)`), 0644)
+
+	var logged string
+	hook, err := loadScriptHook(path, func(format string, args ...interface{}) {
+		logged = args[0].(string)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hook.close()
+	if logged != "loaded\t1" {
+		t.Errorf("print should go to the crawler log, got %q", logged)
+	}
+}
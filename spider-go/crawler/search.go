@@ -0,0 +1,168 @@
+package crawler
+
+import (
+	"sync"
+
+	"spider-go/storage"
+)
+
+// planSearchPages returns the search pages to fetch for a keyword: the first
+// refresh pages are always re-scanned for freshness, followed by up to count
+// pages the keyword's progress has not covered yet. Pages beyond the last
+// known page count are not planned.
+func planSearchPages(progress *storage.SearchProgress, refresh, count int) []int {
+	var pages []int
+
+	// Without any progress, this is simply pages 1..count
+	if len(progress.Pages) == 0 {
+		for page := 1; page <= count; page++ {
+			pages = append(pages, page)
+		}
+		return pages
+	}
+
+	for page := 1; page <= refresh; page++ {
+		if progress.NumPages > 0 && page > progress.NumPages {
+			break
+		}
+		pages = append(pages, page)
+	}
+
+	added := 0
+	for page := 1; added < count; page++ {
+		if progress.NumPages > 0 && page > progress.NumPages {
+			break
+		}
+		if page <= refresh || progress.HasPage(page) {
+			continue
+		}
+		pages = append(pages, page)
+		added++
+	}
+
+	return pages
+}
+
+// searchPageAttempts is how many times a failing search page is tried, each
+// time by whichever worker takes it next
+const searchPageAttempts = 2
+
+// searchQueue hands the search pages of one keyword to the search workers.
+// Workers take the next page whenever they are free, so a slow worker does
+// not hold up a fixed page range. Failed pages go back in the queue, pages
+// past the reported page count are skipped, and extend may add pages once
+// that count is known.
+type searchQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	pending  []int
+	active   int // pages taken and not yet settled
+	attempts map[int]int
+	numPages int // 0 until a page reports it
+	failed   int // pages given up on
+	extend   func(numPages int) []int
+}
+
+func newSearchQueue(pages []int, extend func(numPages int) []int) *searchQueue {
+	q := &searchQueue{
+		pending:  append([]int(nil), pages...),
+		attempts: make(map[int]int),
+		extend:   extend,
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// next returns the next page to fetch, waiting while pages being fetched may
+// still add more. It returns false once every page is settled.
+func (q *searchQueue) next() (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) == 0 && q.active > 0 {
+		q.cond.Wait()
+	}
+	if len(q.pending) == 0 {
+		return 0, false
+	}
+	page := q.pending[0]
+	q.pending = q.pending[1:]
+	q.active++
+	return page, true
+}
+
+// beyond reports whether page lies past the reported last page
+func (q *searchQueue) beyond(page int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.numPages > 0 && page > q.numPages
+}
+
+// finish settles a taken page with the page count it reported (0 if none)
+// and returns the pages extend added on the first reported count
+func (q *searchQueue) finish(numPages int) []int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active--
+	defer q.cond.Broadcast()
+
+	if numPages <= 0 {
+		return nil
+	}
+	first := q.numPages == 0
+	q.numPages = numPages
+	if !first || q.extend == nil {
+		return nil
+	}
+	added := q.extend(numPages)
+	q.pending = append(q.pending, added...)
+	return added
+}
+
+// fail settles a taken page that failed, queueing it again unless it has
+// used up its attempts, and reports whether it was queued
+func (q *searchQueue) fail(page int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active--
+	defer q.cond.Broadcast()
+
+	q.attempts[page]++
+	if q.attempts[page] >= searchPageAttempts {
+		q.failed++
+		return false
+	}
+	q.pending = append(q.pending, page)
+	return true
+}
+
+// drop settles a taken page that was given up on without retrying
+func (q *searchQueue) drop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.active--
+	q.failed++
+	q.cond.Broadcast()
+}
+
+// complete reports whether no page was given up on
+func (q *searchQueue) complete() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.failed == 0
+}
+
+// extendSearchPages returns up to limit pages after the planned ones that the
+// reported page count shows exist and the keyword's progress has not covered
+func extendSearchPages(progress *storage.SearchProgress, planned []int, numPages, limit int) []int {
+	last := 0
+	for _, page := range planned {
+		last = max(last, page)
+	}
+	var pages []int
+	for page := last + 1; page <= numPages && len(pages) < limit; page++ {
+		if !progress.HasPage(page) {
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
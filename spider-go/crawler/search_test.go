@@ -0,0 +1,168 @@
+package crawler
+
+import (
+	"reflect"
+	"testing"
+
+	"spider-go/storage"
+)
+
+func TestPlanSearchPages_NoProgress(t *testing.T) {
+	pages := planSearchPages(&storage.SearchProgress{}, 1, 4)
+	if !reflect.DeepEqual(pages, []int{1, 2, 3, 4}) {
+		t.Errorf("pages = %v, expected [1 2 3 4]", pages)
+	}
+}
+
+func TestPlanSearchPages_Resume(t *testing.T) {
+	progress := &storage.SearchProgress{Pages: []int{1, 2, 3, 5}, NumPages: 20}
+
+	pages := planSearchPages(progress, 1, 3)
+	if !reflect.DeepEqual(pages, []int{1, 4, 6, 7}) {
+		t.Errorf("pages = %v, expected [1 4 6 7]", pages)
+	}
+
+	pages = planSearchPages(progress, 0, 2)
+	if !reflect.DeepEqual(pages, []int{4, 6}) {
+		t.Errorf("pages = %v, expected [4 6]", pages)
+	}
+}
+
+func TestPlanSearchPages_StopsAtNumPages(t *testing.T) {
+	progress := &storage.SearchProgress{Pages: []int{1, 2}, NumPages: 3}
+
+	pages := planSearchPages(progress, 1, 5)
+	if !reflect.DeepEqual(pages, []int{1, 3}) {
+		t.Errorf("pages = %v, expected [1 3]", pages)
+	}
+}
+
+// drainSearchQueue takes every page left in q, finishing each
+func drainSearchQueue(q *searchQueue) []int {
+	var pages []int
+	for page, ok := q.next(); ok; page, ok = q.next() {
+		pages = append(pages, page)
+		q.finish(0)
+	}
+	return pages
+}
+
+func TestSearchQueue_Order(t *testing.T) {
+	q := newSearchQueue([]int{1, 2, 3}, nil)
+	if pages := drainSearchQueue(q); !reflect.DeepEqual(pages, []int{1, 2, 3}) {
+		t.Errorf("pages = %v, expected [1 2 3]", pages)
+	}
+	if _, ok := q.next(); ok {
+		t.Error("A drained queue should be done")
+	}
+}
+
+func TestSearchQueue_Retry(t *testing.T) {
+	q := newSearchQueue([]int{1, 2}, nil)
+
+	page, _ := q.next()
+	if !q.fail(page) {
+		t.Fatal("A page failing for the first time should be queued again")
+	}
+	if pages := drainSearchQueue(q); !reflect.DeepEqual(pages, []int{2, 1}) {
+		t.Errorf("pages = %v, expected the failed page after the others", pages)
+	}
+
+	q = newSearchQueue([]int{1}, nil)
+	for attempt := 1; attempt <= searchPageAttempts; attempt++ {
+		page, ok := q.next()
+		if !ok {
+			t.Fatalf("attempt %d: expected page 1 again", attempt)
+		}
+		if requeued := q.fail(page); requeued != (attempt < searchPageAttempts) {
+			t.Errorf("attempt %d: requeued = %v", attempt, requeued)
+		}
+	}
+	if _, ok := q.next(); ok {
+		t.Error("A page out of attempts should not be queued again")
+	}
+	if q.complete() {
+		t.Error("A queue that gave up on a page should not be complete")
+	}
+}
+
+func TestSearchQueue_Complete(t *testing.T) {
+	q := newSearchQueue([]int{1, 2}, nil)
+	page, _ := q.next()
+	q.fail(page)
+	for page, ok := q.next(); ok; page, ok = q.next() {
+		q.finish(page)
+	}
+	if !q.complete() {
+		t.Error("A queue whose failed page succeeded on retry should be complete")
+	}
+
+	q = newSearchQueue([]int{1}, nil)
+	q.next()
+	q.drop()
+	if q.complete() {
+		t.Error("A queue with a dropped page should not be complete")
+	}
+}
+
+func TestSearchQueue_NumPages(t *testing.T) {
+	calls := 0
+	q := newSearchQueue([]int{1, 2, 3, 4}, func(numPages int) []int {
+		calls++
+		return []int{numPages + 10}
+	})
+
+	q.next()
+	if q.beyond(100) {
+		t.Error("No page should be beyond an unknown page count")
+	}
+	if added := q.finish(3); !reflect.DeepEqual(added, []int{13}) {
+		t.Errorf("added = %v, expected [13]", added)
+	}
+	if q.beyond(3) || !q.beyond(4) {
+		t.Error("Pages after the reported count should be beyond it")
+	}
+
+	q.next()
+	q.finish(0) // pages not reporting a count keep the known one
+	q.next()
+	if added := q.finish(3); added != nil || calls != 1 {
+		t.Errorf("Only the first reported count should extend, got %v after %d calls", added, calls)
+	}
+	if pages := drainSearchQueue(q); !reflect.DeepEqual(pages, []int{4, 13}) || !q.beyond(4) {
+		t.Errorf("pages = %v, expected [4 13]", pages)
+	}
+}
+
+func TestSearchQueue_WaitsForActivePages(t *testing.T) {
+	q := newSearchQueue([]int{1}, nil)
+	page, _ := q.next()
+
+	got := make(chan int)
+	go func() {
+		next, _ := q.next()
+		got <- next
+	}()
+
+	// The idle worker must not give up while page 1 may come back
+	q.fail(page)
+	if next := <-got; next != 1 {
+		t.Errorf("next = %d, expected the failed page", next)
+	}
+}
+
+func TestExtendSearchPages(t *testing.T) {
+	progress := &storage.SearchProgress{Pages: []int{1, 2, 6}}
+
+	pages := extendSearchPages(progress, []int{1, 3, 4}, 10, 3)
+	if !reflect.DeepEqual(pages, []int{5, 7, 8}) {
+		t.Errorf("pages = %v, expected [5 7 8]", pages)
+	}
+
+	if pages := extendSearchPages(progress, []int{1, 3, 4}, 4, 3); len(pages) != 0 {
+		t.Errorf("pages = %v, expected none when the plan covers every page", pages)
+	}
+	if pages := extendSearchPages(progress, []int{1, 3, 4}, 10, 0); len(pages) != 0 {
+		t.Errorf("pages = %v, expected none when extending is off", pages)
+	}
+}
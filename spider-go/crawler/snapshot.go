@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"encoding/json"
+
+	"spider-go/api"
+	"spider-go/cookie"
+	"spider-go/ratelimit"
+)
+
+// QueueDepth reports the fill level of one pipeline queue
+type QueueDepth struct {
+	Name string `json:"name"`
+	Len  int    `json:"len"`
+	Cap  int    `json:"cap"`
+}
+
+// Snapshot is a point-in-time view of a running crawl
+type Snapshot struct {
+	Keyword      string                 `json:"keyword"`
+	Keywords     []string               `json:"keywords"`
+	Paused       bool                   `json:"paused"`
+	Rate         float64                `json:"rate"`
+	InFlight     int64                  `json:"in_flight"`
+	Counters     Counters               `json:"counters"`
+	Queues       []QueueDepth           `json:"queues"`
+	Cookies      map[string]interface{} `json:"cookies"`
+	RecentLogs   []string               `json:"recent_logs"`
+	RecentErrors []string               `json:"recent_errors"`
+	SchemaDrift  []api.Drift            `json:"schema_drift,omitempty"`
+	CookieUsage  []cookie.Usage         `json:"cookie_usage,omitempty"`
+	Finished     bool                   `json:"finished"`
+}
+
+// Snapshot returns the current state of the crawl for dashboards
+func (c *BiliCrawler) Snapshot() Snapshot {
+	return Snapshot{
+		Keyword:      c.config.Keyword,
+		Keywords:     c.Keywords(),
+		Paused:       ratelimit.IsPaused(),
+		Rate:         ratelimit.GetRateLimiter().Rate(),
+		InFlight:     ratelimit.InFlight(),
+		Counters:     c.stats.Snapshot(),
+		Queues:       c.queueDepths(),
+		Cookies:      cookie.GetCookiePool(c.config.CookieConfigPath).GetStatus(),
+		RecentLogs:   c.recentLogs.Lines(),
+		RecentErrors: c.recentErrors.Lines(),
+		SchemaDrift:  api.DriftReport(),
+		CookieUsage:  c.cookieUsage(),
+		Finished:     c.isFinished(),
+	}
+}
+
+// queueDepths returns the fill level of every pipeline queue
+func (c *BiliCrawler) queueDepths() []QueueDepth {
+	return []QueueDepth{
+		{Name: "video", Len: len(c.videoQueue), Cap: cap(c.videoQueue)},
+		{Name: "comment", Len: len(c.commentQueue), Cap: cap(c.commentQueue)},
+		{Name: "account", Len: len(c.userMidQueue), Cap: cap(c.userMidQueue)},
+		{Name: "dynamic", Len: len(c.dynamicQueue), Cap: cap(c.dynamicQueue)},
+		{Name: "relation", Len: len(c.relationQueue), Cap: cap(c.relationQueue)},
+		{Name: "favorite", Len: len(c.favoriteQueue), Cap: cap(c.favoriteQueue)},
+		{Name: "media", Len: len(c.mediaQueue), Cap: cap(c.mediaQueue)},
+		{Name: "stream", Len: len(c.streamQueue), Cap: cap(c.streamQueue)},
+		{Name: "subtitle", Len: len(c.subtitleQueue), Cap: cap(c.subtitleQueue)},
+		{Name: "danmaku", Len: len(c.danmakuQueue), Cap: cap(c.danmakuQueue)},
+		{Name: "article", Len: len(c.articleQueue), Cap: cap(c.articleQueue)},
+		{Name: "live", Len: len(c.liveQueue), Cap: cap(c.liveQueue)},
+	}
+}
+
+// DumpStatus writes the current snapshot to the log as one JSON line,
+// leaving out the recent logs it would repeat
+func (c *BiliCrawler) DumpStatus() {
+	snapshot := c.Snapshot()
+	snapshot.RecentLogs = nil
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		c.errorf("[状态] 生成状态快照失败: %v\n", err)
+		return
+	}
+	c.summaryf("[状态] %s\n", data)
+}
+
+func (c *BiliCrawler) isFinished() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.finished
+}
+
+func (c *BiliCrawler) markFinished() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finished = true
+}
@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"spider-go/api"
+)
+
+// addAccountExtras adds the optional space data the config asks for to an
+// account record
+func (c *BiliCrawler) addAccountExtras(threadID int, mid string, account map[string]interface{}, session *api.Session) {
+	if c.config.AccountSpaceInfo {
+		c.addSpaceInfo(threadID, mid, account, session)
+	}
+	if c.config.AccountUpstat {
+		c.addUpstat(threadID, mid, account, session)
+	}
+	if c.config.AccountLiveRoom {
+		c.addLiveRoom(threadID, mid, account, session)
+	}
+}
+
+// addSpaceInfo adds a user's space profile to their account record as
+// "space". A failed fetch is logged and the account saved without it.
+func (c *BiliCrawler) addSpaceInfo(threadID int, mid string, account map[string]interface{}, session *api.Session) {
+	c.delay()
+	info, err := api.GetUserInfo(mid, session, c.config.CookieConfigPath)
+	c.recordResult("account", err)
+	if err != nil {
+		c.errorf("[用户线程%d] 获取用户 %s 空间信息失败: %v\n", threadID, mid, err)
+		return
+	}
+	account["space"] = info
+}
+
+// addUpstat adds a user's upload totals to their account record. A failed
+// fetch is logged and the account saved without them.
+func (c *BiliCrawler) addUpstat(threadID int, mid string, account map[string]interface{}, session *api.Session) {
+	c.delay()
+	upstat, err := api.GetUserUpstat(mid, session, c.config.CookieConfigPath)
+	c.recordResult("account", err)
+	if err != nil {
+		c.errorf("[用户线程%d] 获取用户 %s 播放与获赞数据失败: %v\n", threadID, mid, err)
+		return
+	}
+	account["total_archive_views"] = upstat.ArchiveViews
+	account["total_article_views"] = upstat.ArticleViews
+	account["total_likes"] = upstat.Likes
+}
+
+// addLiveRoom adds a user's live room to their account record as
+// "live_room", left null when they have none. A failed fetch is logged and
+// the account saved without the field.
+func (c *BiliCrawler) addLiveRoom(threadID int, mid string, account map[string]interface{}, session *api.Session) {
+	c.delay()
+	room, err := api.GetLiveRoomInfo(mid, session, c.config.CookieConfigPath)
+	c.recordResult("account", err)
+	if err != nil {
+		c.errorf("[用户线程%d] 获取用户 %s 直播间信息失败: %v\n", threadID, mid, err)
+		return
+	}
+	account["live_room"] = room
+}
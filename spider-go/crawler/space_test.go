@@ -0,0 +1,71 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+)
+
+// redirectTransport sends every request to a test server
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.URL.Scheme = t.target.Scheme
+	out.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(out)
+}
+
+func TestBiliCrawler_AddAccountExtras(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/x/space/wbi/acc/info":
+			w.Write([]byte(`{"code":0,"data":{"mid":7,"name":"up","birthday":"01-01"}}`))
+			return
+		case "/x/space/upstat":
+			w.Write([]byte(`{"code":0,"data":{"archive":{"view":1000},"article":{"view":20},"likes":300}}`))
+			return
+		case "/room/v1/Room/getRoomInfoOld":
+			w.Write([]byte(`{"code":0,"data":{"roomStatus":1,"liveStatus":0,"roomid":21}}`))
+			return
+		}
+		w.Write([]byte(`{"code":0,"data":{}}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+
+	// The extras are off by default
+	account := map[string]interface{}{"card": map[string]interface{}{"mid": "7"}}
+	c.addAccountExtras(1, "7", account, nil)
+	if len(account) != 1 {
+		t.Errorf("extras added while disabled: %v", account)
+	}
+
+	c.config.AccountSpaceInfo = true
+	c.config.AccountUpstat = true
+	c.config.AccountLiveRoom = true
+	c.addAccountExtras(1, "7", account, nil)
+
+	space, ok := account["space"].(map[string]interface{})
+	if !ok || space["birthday"] != "01-01" {
+		t.Errorf("space = %v", account["space"])
+	}
+	if account["total_archive_views"] != int64(1000) || account["total_article_views"] != int64(20) || account["total_likes"] != int64(300) {
+		t.Errorf("upstat fields = %v", account)
+	}
+	if room, ok := account["live_room"].(map[string]interface{}); !ok || room["roomid"] != float64(21) {
+		t.Errorf("live_room = %v", account["live_room"])
+	}
+}
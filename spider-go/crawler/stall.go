@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"spider-go/ratelimit"
+)
+
+// stallCheckInterval is how often the stall watchdog looks for progress
+var stallCheckInterval = 5 * time.Second
+
+// stallWatch tracks when the crawl last made progress, i.e. saved a record
+// or had a request succeed
+type stallWatch struct {
+	timeout  time.Duration
+	saved    int       // records saved at the last check
+	progress time.Time // last progress
+	heals    int       // session rebuilds since the last progress
+}
+
+// stalled takes the saved record count, the latest successful request and
+// whether the crawl is paused or idle between passes at now, and reports
+// whether it has made no progress for the timeout. Time spent paused or
+// idle does not count.
+func (w *stallWatch) stalled(now time.Time, saved int, lastSuccess time.Time, waiting bool) bool {
+	switch {
+	case saved != w.saved:
+		w.saved, w.progress, w.heals = saved, now, 0
+	case lastSuccess.After(w.progress):
+		w.progress, w.heals = lastSuccess, 0
+	case waiting:
+		w.progress = now
+	}
+	return now.Sub(w.progress) >= w.timeout
+}
+
+// savedRecords returns how many records of any kind have been saved
+func savedRecords(n Counters) int {
+	return n.VideosSaved + n.CommentsSaved + n.RepliesSaved + n.AccountsSaved +
+		n.DynamicsSaved + n.RelationsSaved + n.FavoritesSaved + n.MediaSaved +
+		n.StreamsSaved + n.SubtitlesSaved + n.DanmakuSaved + n.ArticlesSaved + n.LiveSaved + n.StatSnapshots + n.Tombstones
+}
+
+// watchStall logs the queue states when the crawl has made no progress for
+// stall_timeout, then rebuilds every session or aborts with ExitStalled,
+// until stop is closed
+func (c *BiliCrawler) watchStall(stop <-chan struct{}) {
+	timeout, err := time.ParseDuration(c.config.StallTimeout)
+	if err != nil || timeout <= 0 {
+		return
+	}
+	w := stallWatch{timeout: timeout, saved: savedRecords(c.stats.Snapshot()), progress: time.Now()}
+
+	ticker := time.NewTicker(stallCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		_, lastSuccess, _ := c.health.snapshot()
+		waiting := ratelimit.IsPaused() || c.idle.Load()
+		if !w.stalled(now, savedRecords(c.stats.Snapshot()), lastSuccess, waiting) {
+			continue
+		}
+
+		reason := fmt.Sprintf("已有 %v 没有保存记录或成功的请求", timeout)
+		c.dumpStall(reason)
+		if c.config.StallAction == "heal" && w.heals < c.config.StallHealAttempts {
+			w.heals++
+			rebuilt := c.sessions.RebuildAll()
+			c.logf("[停滞] 已重建 %d 个会话 (第 %d/%d 次)\n", rebuilt, w.heals, c.config.StallHealAttempts)
+			w.progress = time.Now()
+			continue
+		}
+		c.abort(reason, ExitStalled)
+		return
+	}
+}
+
+// waitNextPass waits until next between the passes of a repeating command
+// (trending, snapshot-stats) and reports whether the crawl should go on. The
+// wait is deliberate, so the stall watchdog does not count it.
+func (c *BiliCrawler) waitNextPass(next time.Time) bool {
+	c.idle.Store(true)
+	defer c.idle.Store(false)
+	select {
+	case <-c.cancelled:
+		return false
+	case <-time.After(time.Until(next)):
+		return true
+	}
+}
+
+// dumpStall logs why the crawl is considered stalled with the state of
+// every queue and the requests in flight
+func (c *BiliCrawler) dumpStall(reason string) {
+	depths := c.queueDepths()
+	queues := make([]string, len(depths))
+	for i, q := range depths {
+		queues[i] = fmt.Sprintf("%s %d/%d", q.Name, q.Len, q.Cap)
+	}
+	c.errorf("[停滞] %s\n", reason)
+	c.errorf("[停滞] 队列: %s; 进行中的请求: %d\n", strings.Join(queues, ", "), ratelimit.InFlight())
+}
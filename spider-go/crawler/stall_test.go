@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestStallWatch(t *testing.T) {
+	start := time.Now()
+	w := stallWatch{timeout: time.Minute, progress: start}
+
+	if w.stalled(start.Add(30*time.Second), 0, time.Time{}, false) {
+		t.Error("Should not be stalled before the timeout")
+	}
+	if !w.stalled(start.Add(time.Minute), 0, time.Time{}, false) {
+		t.Error("Should be stalled after the timeout without progress")
+	}
+
+	// A saved record or a successful request is progress
+	w.heals = 1
+	if w.stalled(start.Add(time.Minute), 1, time.Time{}, false) || w.heals != 0 {
+		t.Error("A saved record should restart the timeout and the heal count")
+	}
+	if w.stalled(start.Add(2*time.Minute), 1, start.Add(90*time.Second), false) {
+		t.Error("A successful request should restart the timeout")
+	}
+
+	// Paused time does not count
+	if w.stalled(start.Add(3*time.Minute), 1, time.Time{}, true) {
+		t.Error("A paused crawl should not be stalled")
+	}
+	if w.stalled(start.Add(3*time.Minute+30*time.Second), 1, time.Time{}, false) {
+		t.Error("The timeout should restart after a pause")
+	}
+}
+
+func TestBiliCrawler_WatchStall_HealsThenExits(t *testing.T) {
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+	defer ratelimit.ResumeAll()
+	defer func(d time.Duration) { stallCheckInterval = d }(stallCheckInterval)
+	stallCheckInterval = 5 * time.Millisecond
+
+	c := newReloadCrawler()
+	c.cancelled = make(chan struct{})
+	c.sessions = api.NewSessionManager("")
+	c.config.StallTimeout = "20ms"
+	c.config.StallHealAttempts = 1
+	c.config.ReportPath = filepath.Join(t.TempDir(), "report.json")
+	var out strings.Builder
+	c.SetLogOutput(&out)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	watched := make(chan struct{})
+	go func() {
+		c.watchStall(stop)
+		close(watched)
+	}()
+
+	// The abort is logged after the crawl is cancelled, so wait for the
+	// watch to return before reading the log
+	select {
+	case <-watched:
+		if aborted := c.abortedWith(); aborted == nil || aborted.code != ExitStalled {
+			t.Errorf("aborted = %+v, expected exit code %d", aborted, ExitStalled)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stalled crawl was not stopped")
+	}
+
+	log := out.String()
+	if !strings.Contains(log, "队列: video 0/0") || !strings.Contains(log, "已重建 0 个会话 (第 1/1 次)") {
+		t.Errorf("log = %q, expected a queue dump and one heal before exiting", log)
+	}
+}
+
+func TestBiliCrawler_WatchStall_IgnoresWaitBetweenPasses(t *testing.T) {
+	defer func(d time.Duration) { stallCheckInterval = d }(stallCheckInterval)
+	stallCheckInterval = 5 * time.Millisecond
+
+	c := newReloadCrawler()
+	c.cancelled = make(chan struct{})
+	c.sessions = api.NewSessionManager("")
+	c.config.StallTimeout = "20ms"
+	c.config.StallHealAttempts = 0
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go c.watchStall(stop)
+
+	if !c.waitNextPass(time.Now().Add(200 * time.Millisecond)) {
+		t.Fatal("waitNextPass should go on when not cancelled")
+	}
+	if aborted := c.abortedWith(); aborted != nil {
+		t.Errorf("Waiting between passes was taken for a stall (exit %d)", aborted.code)
+	}
+}
@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"spider-go/api"
+)
+
+// selectStreams picks the best video track not above maxQuality (the lowest
+// one if all are above it), preferring AVC for playback compatibility, and
+// the audio track with the highest bandwidth
+func selectStreams(play *api.PlayURL, maxQuality int) (video, audio *api.DashStream) {
+	better := func(a, b *api.DashStream) bool {
+		aFits, bFits := a.ID <= maxQuality, b.ID <= maxQuality
+		switch {
+		case aFits != bFits:
+			return aFits
+		case a.ID != b.ID:
+			// Highest quality that fits, or the lowest if none fits
+			return a.ID > b.ID == aFits
+		}
+		aAVC, bAVC := strings.HasPrefix(a.Codecs, "avc"), strings.HasPrefix(b.Codecs, "avc")
+		if aAVC != bAVC {
+			return aAVC
+		}
+		return a.Bandwidth > b.Bandwidth
+	}
+
+	for i := range play.Video {
+		if video == nil || better(&play.Video[i], video) {
+			video = &play.Video[i]
+		}
+	}
+	for i := range play.Audio {
+		if audio == nil || play.Audio[i].Bandwidth > audio.Bandwidth {
+			audio = &play.Audio[i]
+		}
+	}
+	return video, audio
+}
+
+// queueStream hands a saved video to the stream stage if it passes the
+// stream filter
+func (c *BiliCrawler) queueStream(task *VideoTask) {
+	if !c.config.DownloadStreams {
+		return
+	}
+	if ok, _ := c.streamFilter.Allow(task.Detail); !ok {
+		return
+	}
+	c.streamQueue <- task
+}
+
+// downloadStreams fetches the DASH streams of a video's first page into
+// stream_dir/<bvid>/ and returns how many files were written
+func (c *BiliCrawler) downloadStreams(task *VideoTask, session *api.Session) (int, error) {
+	bvid, cid := task.Bvid, task.Cid
+	if bvid == "" || cid == 0 {
+		return 0, fmt.Errorf("video detail has no bvid or cid")
+	}
+
+	play, err := api.GetPlayURL(bvid, cid, c.config.StreamQuality, session, c.config.CookieConfigPath)
+	c.recordResult("stream", err)
+	if err != nil {
+		return 0, err
+	}
+
+	video, audio := selectStreams(play, c.config.StreamQuality)
+	dir := filepath.Join(c.config.StreamDir, bvid)
+
+	files := 0
+	if video != nil {
+		target := filepath.Join(dir, fmt.Sprintf("video-%d.m4s", video.ID))
+		saved, err := downloadFile(video.BaseURL, target, c.config.StreamMaxBytes)
+		if err != nil {
+			return files, fmt.Errorf("video track: %w", err)
+		}
+		if saved {
+			files++
+		}
+	}
+	if audio != nil && c.config.StreamAudio {
+		saved, err := downloadFile(audio.BaseURL, filepath.Join(dir, "audio.m4s"), c.config.StreamMaxBytes)
+		if err != nil {
+			return files, fmt.Errorf("audio track: %w", err)
+		}
+		if saved {
+			files++
+		}
+	}
+	return files, nil
+}
+
+// streamWorker downloads the media streams of videos from the stream queue
+func (c *BiliCrawler) streamWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
+	defer wg.Done()
+
+	for {
+		if !c.waitTurn("stream", threadID, done) {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case task, ok := <-c.streamQueue:
+			if !ok {
+				return
+			}
+			if c.isCancelled() {
+				continue
+			}
+
+			c.recoverTask("stream", threadID, nil, func() {
+				files, err := c.downloadStreams(task, session)
+				if err != nil {
+					c.errorf("[流线程%d] %s 下载音视频失败: %v\n", threadID, task.Bvid, err)
+				} else if files > 0 {
+					c.stats.incStreamsSaved()
+					c.debugf("[流线程%d] %s 音视频已保存\n", threadID, task.Bvid)
+				}
+				c.delay()
+			})
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package crawler
+
+import (
+	"testing"
+
+	"spider-go/api"
+)
+
+func TestSelectStreams(t *testing.T) {
+	play := &api.PlayURL{
+		Video: []api.DashStream{
+			{ID: 80, Codecs: "avc1.640032", Bandwidth: 3000},
+			{ID: 64, Codecs: "hev1.1.6.L120", Bandwidth: 900},
+			{ID: 64, Codecs: "avc1.640028", Bandwidth: 1500},
+			{ID: 32, Codecs: "avc1.64001F", Bandwidth: 700},
+		},
+		Audio: []api.DashStream{
+			{ID: 30216, Bandwidth: 67000},
+			{ID: 30280, Bandwidth: 320000},
+		},
+	}
+
+	tests := []struct {
+		maxQuality int
+		id         int
+		codecs     string
+	}{
+		{120, 80, "avc1.640032"},
+		{64, 64, "avc1.640028"},
+		{48, 32, "avc1.64001F"},
+		{16, 32, "avc1.64001F"}, // nothing fits, lowest quality
+	}
+	for _, tt := range tests {
+		video, audio := selectStreams(play, tt.maxQuality)
+		if video == nil || video.ID != tt.id || video.Codecs != tt.codecs {
+			t.Errorf("maxQuality %d: selected %+v, expected %d %s", tt.maxQuality, video, tt.id, tt.codecs)
+		}
+		if audio == nil || audio.ID != 30280 {
+			t.Errorf("Expected the highest bandwidth audio, got %+v", audio)
+		}
+	}
+
+	if video, audio := selectStreams(&api.PlayURL{}, 80); video != nil || audio != nil {
+		t.Error("No streams should select nothing")
+	}
+}
+
+func TestBiliCrawler_QueueStream(t *testing.T) {
+	c := newReloadCrawler()
+	c.streamQueue = make(chan *VideoTask, 10)
+	c.streamFilter, _ = newVideoFilter(VideoFilter{MinPlay: 1000})
+
+	popular := newVideoTask(map[string]interface{}{"bvid": "BV1", "stat": map[string]interface{}{"view": float64(5000)}})
+	obscure := newVideoTask(map[string]interface{}{"bvid": "BV2", "stat": map[string]interface{}{"view": float64(10)}})
+
+	c.queueStream(popular)
+	if len(c.streamQueue) != 0 {
+		t.Error("Streams should not be queued while download_streams is off")
+	}
+
+	c.config.DownloadStreams = true
+	c.queueStream(popular)
+	c.queueStream(obscure)
+	if len(c.streamQueue) != 1 || (<-c.streamQueue).Bvid != "BV1" {
+		t.Error("Only videos passing stream_filter should be queued")
+	}
+}
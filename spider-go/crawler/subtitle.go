@@ -0,0 +1,171 @@
+package crawler
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// queueSubtitles hands a saved video to the subtitle stage
+func (c *BiliCrawler) queueSubtitles(task *VideoTask) {
+	if c.config.CrawlSubtitles {
+		c.subtitleQueue <- task
+	}
+}
+
+// wantSubtitle reports whether a track matches subtitle_languages and
+// subtitle_skip_ai
+func (c *BiliCrawler) wantSubtitle(track api.SubtitleTrack) bool {
+	if track.URL == "" || c.config.SubtitleSkipAI && track.AIType != 0 {
+		return false
+	}
+	if len(c.config.SubtitleLanguages) == 0 {
+		return true
+	}
+	for _, lan := range c.config.SubtitleLanguages {
+		if lan == track.Lan {
+			return true
+		}
+	}
+	return false
+}
+
+// crawlSubtitles saves every wanted subtitle track of a video's pages (see
+// taskPages) and returns how many were saved. A failed page does not stop
+// the rest; the error names every page that failed.
+func (c *BiliCrawler) crawlSubtitles(task *VideoTask, session *api.Session) (int, error) {
+	pages := c.taskPages(task)
+	if task.Bvid == "" || len(pages) == 0 {
+		return 0, fmt.Errorf("video detail has no bvid or cid")
+	}
+
+	saved := 0
+	var errs []error
+	for _, page := range pages {
+		n, err := c.crawlPageSubtitles(task, page.Cid, session)
+		saved += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("P%d: %w", page.Page, err))
+		}
+	}
+	return saved, errors.Join(errs...)
+}
+
+// crawlPageSubtitles saves every wanted subtitle track of one page of a
+// video
+func (c *BiliCrawler) crawlPageSubtitles(task *VideoTask, cid int64, session *api.Session) (int, error) {
+	bvid := task.Bvid
+	tracks, err := api.GetSubtitleTracks(bvid, cid, session, c.config.CookieConfigPath)
+	c.recordResult("subtitle", err)
+	if err != nil {
+		return 0, err
+	}
+
+	saved := 0
+	for _, track := range tracks {
+		id := storage.SubtitleID(bvid, cid, track.Lan)
+		if !c.wantSubtitle(track) || c.isSubtitleSaved(id) {
+			continue
+		}
+
+		body, err := api.GetSubtitle(track.URL)
+		if err != nil {
+			return saved, fmt.Errorf("%s: %w", track.Lan, err)
+		}
+
+		subtitle := map[string]interface{}{
+			"bvid":          bvid,
+			"aid":           task.Aid,
+			"cid":           cid,
+			"lan":           track.Lan,
+			"lan_doc":       track.LanDoc,
+			"ai_type":       track.AIType,
+			"subtitle_url":  track.URL,
+			"topic_keyword": task.Keyword,
+			"body":          body["body"],
+		}
+		if err := storage.SaveSubtitle(subtitle); err != nil {
+			return saved, err
+		}
+		c.markSubtitleSaved(id)
+		c.stats.incSubtitlesSaved()
+		saved++
+	}
+	return saved, nil
+}
+
+// addVideoSubtitles adds the text of the wanted CC subtitles of every page
+// of a video to its detail as "subtitles", one entry per page and language.
+// A failed page is logged and left out.
+func (c *BiliCrawler) addVideoSubtitles(threadID int, bvid string, detail map[string]interface{}, session *api.Session) {
+	list := []interface{}{}
+	for _, page := range detailPages(detail) {
+		c.delay()
+		subtitles, err := api.GetSubtitles(bvid, page.Cid, c.wantSubtitle, session, c.config.CookieConfigPath)
+		c.recordResult("detail", err)
+		if err != nil {
+			c.errorf("[视频线程%d] %s 第 %d P 获取字幕失败: %v\n", threadID, bvid, page.Page, err)
+			continue
+		}
+		for _, subtitle := range subtitles {
+			list = append(list, map[string]interface{}{
+				"cid":     page.Cid,
+				"page":    page.Page,
+				"lan":     subtitle.Track.Lan,
+				"lan_doc": subtitle.Track.LanDoc,
+				"ai_type": subtitle.Track.AIType,
+				"text":    subtitle.Text,
+			})
+		}
+	}
+	detail["subtitles"] = list
+}
+
+func (c *BiliCrawler) isSubtitleSaved(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.savedSubtitles[id]
+	return ok
+}
+
+func (c *BiliCrawler) markSubtitleSaved(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.savedSubtitles[id] = struct{}{}
+}
+
+// subtitleWorker fetches the CC subtitles of videos from the subtitle queue
+func (c *BiliCrawler) subtitleWorker(threadID int, wg *sync.WaitGroup, done <-chan struct{}, session *api.Session) {
+	defer wg.Done()
+
+	for {
+		if !c.waitTurn("subtitle", threadID, done) {
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case task, ok := <-c.subtitleQueue:
+			if !ok {
+				return
+			}
+			if c.isCancelled() {
+				continue
+			}
+
+			c.recoverTask("subtitle", threadID, nil, func() {
+				saved, err := c.crawlSubtitles(task, session)
+				if err != nil {
+					c.errorf("[字幕线程%d] %s 获取字幕失败: %v\n", threadID, task.Bvid, err)
+				} else if saved > 0 {
+					c.debugf("[字幕线程%d] %s 保存 %d 条字幕\n", threadID, task.Bvid, saved)
+				}
+				c.delay()
+			})
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+)
+
+func TestBiliCrawler_WantSubtitle(t *testing.T) {
+	c := newReloadCrawler()
+	zh := api.SubtitleTrack{Lan: "zh-CN", URL: "https://aisubtitle.hdslb.com/a.json"}
+	ai := api.SubtitleTrack{Lan: "ai-zh", URL: "https://aisubtitle.hdslb.com/b.json", AIType: 1}
+	en := api.SubtitleTrack{Lan: "en-US", URL: "https://aisubtitle.hdslb.com/c.json"}
+
+	for _, track := range []api.SubtitleTrack{zh, ai, en} {
+		if !c.wantSubtitle(track) {
+			t.Errorf("%s should be wanted without language filter", track.Lan)
+		}
+	}
+	if c.wantSubtitle(api.SubtitleTrack{Lan: "zh-CN"}) {
+		t.Error("Tracks without a URL cannot be fetched")
+	}
+
+	c.config.SubtitleSkipAI = true
+	if c.wantSubtitle(ai) {
+		t.Error("AI subtitles should be skipped with subtitle_skip_ai")
+	}
+
+	c.config.SubtitleLanguages = []string{"en-US"}
+	if c.wantSubtitle(zh) || !c.wantSubtitle(en) {
+		t.Error("subtitle_languages should limit the languages")
+	}
+}
+
+func TestBiliCrawler_AddVideoSubtitles(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/x/player/wbi/v2":
+			cid := r.URL.Query().Get("cid")
+			fmt.Fprintf(w, `{"code":0,"data":{"subtitle":{"subtitles":[{"lan":"zh-CN","lan_doc":"中文","subtitle_url":"%s/%s.json"}]}}}`, server.URL, cid)
+		case "/10.json":
+			w.Write([]byte(`{"body":[{"content":"第一集"}]}`))
+		case "/11.json":
+			w.Write([]byte(`{"body":[{"content":"第二集"}]}`))
+		}
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	detail := map[string]interface{}{
+		"pages": []interface{}{
+			map[string]interface{}{"cid": float64(10), "page": float64(1)},
+			map[string]interface{}{"cid": float64(11), "page": float64(2)},
+		},
+	}
+
+	c.addVideoSubtitles(0, "BV1", detail, nil)
+	subtitles, _ := detail["subtitles"].([]interface{})
+	if len(subtitles) != 2 {
+		t.Fatalf("subtitles = %v, expected one per page", detail["subtitles"])
+	}
+	second := subtitles[1].(map[string]interface{})
+	if second["cid"] != int64(11) || second["page"] != int64(2) || second["lan"] != "zh-CN" || second["text"] != "第二集" {
+		t.Errorf("second page subtitle = %v", second)
+	}
+}
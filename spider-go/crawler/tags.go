@@ -0,0 +1,23 @@
+package crawler
+
+import "spider-go/api"
+
+// addVideoTags adds a video's tags to its detail as "tags", the same list
+// of tag objects the tag API returns. A failed fetch is logged and the
+// video saved without them.
+func (c *BiliCrawler) addVideoTags(threadID int, bvid string, detail map[string]interface{}, session *api.Session) {
+	c.delay()
+	tags, err := api.GetVideoTags(bvid, session, c.config.CookieConfigPath)
+	c.recordResult("detail", err)
+	if err != nil {
+		c.errorf("[视频线程%d] %s 获取标签失败: %v\n", threadID, bvid, err)
+		return
+	}
+
+	// Stored as decoded JSON would be, so videoTags and scripts read it too
+	list := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		list[i] = tag
+	}
+	detail["tags"] = list
+}
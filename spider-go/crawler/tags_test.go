@@ -0,0 +1,35 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+)
+
+func TestBiliCrawler_AddVideoTags(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/x/tag/archive/tags" || r.URL.Query().Get("bvid") != "BV1" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write([]byte(`{"code":0,"data":[{"tag_id":1,"tag_name":"音乐"},{"tag_id":2,"tag_name":"翻唱"}]}`))
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+
+	detail := map[string]interface{}{"bvid": "BV1"}
+	c.addVideoTags(1, "BV1", detail, nil)
+	if got := videoTags(detail); !reflect.DeepEqual(got, []string{"音乐", "翻唱"}) {
+		t.Errorf("videoTags(detail) = %v", got)
+	}
+}
@@ -0,0 +1,114 @@
+package crawler
+
+import "strconv"
+
+// VideoTask represents a video to be processed. The IDs the stages need are
+// extracted once when the task is built; Detail is kept for the few readers
+// that need the whole record.
+type VideoTask struct {
+	Bvid    string
+	Aid     int64
+	Cid     int64
+	Pages   []videoPage // every page of the video, first one included
+	Title   string
+	Keyword string // topic keyword the video was found under
+	Detail  map[string]interface{}
+	// Cursor resumes a deferred video where its last pass stopped
+	Cursor string
+}
+
+// newVideoTask builds a task from a video detail or search result
+func newVideoTask(detail map[string]interface{}) *VideoTask {
+	bvid, _ := detail["bvid"].(string)
+	keyword, _ := detail["topic_keyword"].(string)
+	return &VideoTask{
+		Bvid:    bvid,
+		Aid:     int64Field(detail, "aid"),
+		Cid:     int64Field(detail, "cid"),
+		Pages:   detailPages(detail),
+		Title:   videoTitle(detail),
+		Keyword: keyword,
+		Detail:  detail,
+	}
+}
+
+// resumeAt returns a copy of the task that resumes from cursor
+func (t *VideoTask) resumeAt(cursor string) *VideoTask {
+	resumed := *t
+	resumed.Cursor = cursor
+	return &resumed
+}
+
+// commentIDs are the IDs of a decoded comment, extracted once. IDs decode
+// as float64, so keys are built from these rather than formatting the raw
+// values, which would print large ones in exponent form.
+type commentIDs struct {
+	Rpid   int64
+	Mid    int64
+	Rcount int64
+}
+
+// newCommentIDs extracts the IDs of a comment or reply
+func newCommentIDs(reply map[string]interface{}) commentIDs {
+	return commentIDs{
+		Rpid:   int64Field(reply, "rpid"),
+		Mid:    int64Field(reply, "mid"),
+		Rcount: int64Field(reply, "rcount"),
+	}
+}
+
+// key returns the rpid as saved-comment key
+func (ids commentIDs) key() string {
+	return strconv.FormatInt(ids.Rpid, 10)
+}
+
+// midKey returns the commenter's mid as user key
+func (ids commentIDs) midKey() string {
+	return strconv.FormatInt(ids.Mid, 10)
+}
+
+// VideoListing is a video found by a search, list or related expansion
+// that still needs its details. Record is the listing as returned, kept for
+// the filters and tag harvesting; the detail is what gets saved.
+type VideoListing struct {
+	Bvid    string
+	Keyword string // topic keyword the video was found under
+	// RelatedFrom is the video it was related to, "" unless found by
+	// related expansion at RelatedDepth
+	RelatedFrom  string
+	RelatedDepth int
+	Record       map[string]interface{}
+}
+
+// newVideoListing builds a listing from a search or list result
+func newVideoListing(record map[string]interface{}, keyword string) *VideoListing {
+	bvid, _ := record["bvid"].(string)
+	return &VideoListing{Bvid: bvid, Keyword: keyword, Record: record}
+}
+
+// task returns the comment stage task of a listed video that was saved
+// before
+func (l *VideoListing) task() *VideoTask {
+	task := newVideoTask(l.Record)
+	task.Keyword = l.Keyword
+	return task
+}
+
+// ArticleTask represents a searched article to be fetched
+type ArticleTask struct {
+	ID      int64
+	Keyword string
+	Result  map[string]interface{} // the search result
+}
+
+// CommentTask represents a comment with replies to be processed
+type CommentTask struct {
+	Aid     int64
+	Bvid    string
+	Title   string // title of the video
+	Keyword string
+	Rpid    int64
+	Rcount  int64 // reply count reported with the comment, 0 if unknown
+	// MaxPages caps the reply pages fetched (0 means all)
+	MaxPages int
+}
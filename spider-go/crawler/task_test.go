@@ -0,0 +1,67 @@
+package crawler
+
+import "testing"
+
+func TestNewVideoTask(t *testing.T) {
+	task := newVideoTask(map[string]interface{}{
+		"bvid":          "BV123",
+		"aid":           float64(170001),
+		"cid":           float64(279786),
+		"title":         `<em class="keyword">原神</em>实况`,
+		"topic_keyword": "原神",
+	})
+
+	if task.Bvid != "BV123" || task.Aid != 170001 || task.Cid != 279786 || task.Keyword != "原神" {
+		t.Errorf("task = %+v, expected the IDs extracted from the detail", task)
+	}
+	if task.Title != "原神实况" {
+		t.Errorf("Title = %q, expected the title without search highlights", task.Title)
+	}
+	if task.Detail["bvid"] != "BV123" {
+		t.Error("VideoTask should keep the detail")
+	}
+}
+
+func TestNewVideoTask_MissingFields(t *testing.T) {
+	task := newVideoTask(map[string]interface{}{"bvid": "BV1", "aid": "oops"})
+	if task.Bvid != "BV1" || task.Aid != 0 || task.Cid != 0 || task.Keyword != "" {
+		t.Errorf("task = %+v, expected zero values for missing or mistyped fields", task)
+	}
+}
+
+func TestVideoTask_ResumeAt(t *testing.T) {
+	task := newVideoTask(map[string]interface{}{"bvid": "BV1", "aid": float64(1)})
+	resumed := task.resumeAt("cursor")
+
+	if resumed.Cursor != "cursor" || resumed.Bvid != "BV1" || resumed.Aid != 1 {
+		t.Errorf("resumed = %+v, expected the same video at the cursor", resumed)
+	}
+	if task.Cursor != "" {
+		t.Error("resumeAt should not modify the original task")
+	}
+}
+
+func TestNewCommentIDs(t *testing.T) {
+	ids := newCommentIDs(map[string]interface{}{
+		"rpid": float64(12345678901), "mid": float64(3493123456789012), "rcount": float64(2),
+	})
+
+	if ids.Rpid != 12345678901 || ids.Mid != 3493123456789012 || ids.Rcount != 2 {
+		t.Errorf("ids = %+v, expected the IDs extracted from the comment", ids)
+	}
+	if ids.key() != "12345678901" || ids.midKey() != "3493123456789012" {
+		t.Errorf("keys = %q, %q, expected the IDs in full", ids.key(), ids.midKey())
+	}
+}
+
+func TestVideoListing_Task(t *testing.T) {
+	listing := newVideoListing(map[string]interface{}{"bvid": "BV1", "aid": float64(7), "title": "标题"}, "原神")
+	if listing.Bvid != "BV1" || listing.Keyword != "原神" {
+		t.Errorf("listing = %+v, expected the bvid and keyword", listing)
+	}
+
+	task := listing.task()
+	if task.Bvid != "BV1" || task.Aid != 7 || task.Title != "标题" || task.Keyword != "原神" {
+		t.Errorf("task = %+v, expected the listed video under its keyword", task)
+	}
+}
@@ -0,0 +1,60 @@
+package crawler
+
+import (
+	"time"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// Tombstone statuses
+const (
+	TombstoneDeleted = "deleted"
+	TombstoneBlocked = "blocked"
+)
+
+// tombstoneStatus maps the API code of a failed video request to a
+// tombstone status, or "" if the error does not mean the video is gone
+func tombstoneStatus(code int) string {
+	switch code {
+	case -404, 62002: // not found, invisible
+		return TombstoneDeleted
+	case -403, -10403, 62012: // no access, region blocked, uploader only
+		return TombstoneBlocked
+	}
+	return ""
+}
+
+// recordTombstone emits a tombstone for a saved video once err shows it was
+// deleted or blocked, and reports whether it did so now or earlier
+func (c *BiliCrawler) recordTombstone(bvid string, err error) bool {
+	status := tombstoneStatus(api.ErrorCode(err))
+	if err == nil || status == "" {
+		return false
+	}
+
+	c.mu.Lock()
+	_, done := c.tombstoned[bvid]
+	c.tombstoned[bvid] = struct{}{}
+	c.mu.Unlock()
+	if done {
+		return true
+	}
+
+	tombstone := map[string]interface{}{
+		"bvid":        bvid,
+		"status":      status,
+		"code":        api.ErrorCode(err),
+		"message":     err.Error(),
+		"detected_at": time.Now().Unix(),
+	}
+	if err := storage.SaveTombstone(tombstone); err != nil {
+		c.errorf("保存 %s 的下架记录失败: %v\n", bvid, err)
+		c.mu.Lock()
+		delete(c.tombstoned, bvid)
+		c.mu.Unlock()
+		return true
+	}
+	c.stats.incTombstones()
+	return true
+}
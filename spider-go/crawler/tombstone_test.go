@@ -0,0 +1,46 @@
+package crawler
+
+import (
+	"errors"
+	"testing"
+
+	"spider-go/api"
+)
+
+func TestTombstoneStatus(t *testing.T) {
+	tests := []struct {
+		code     int
+		expected string
+	}{
+		{-404, TombstoneDeleted},
+		{62002, TombstoneDeleted},
+		{-403, TombstoneBlocked},
+		{-10403, TombstoneBlocked},
+		{62012, TombstoneBlocked},
+		{-412, ""},
+		{0, ""},
+	}
+	for _, tt := range tests {
+		if got := tombstoneStatus(tt.code); got != tt.expected {
+			t.Errorf("tombstoneStatus(%d) = %q, expected %q", tt.code, got, tt.expected)
+		}
+	}
+}
+
+func TestBiliCrawler_RecordTombstone_OtherErrors(t *testing.T) {
+	c := newReloadCrawler()
+	c.tombstoned = map[string]struct{}{"BV1gone": {}}
+
+	if c.recordTombstone("BV1", nil) {
+		t.Error("A successful request is no tombstone")
+	}
+	if c.recordTombstone("BV1", &api.Error{Code: -412, Message: "请求被拦截"}) {
+		t.Error("Risk control errors are no tombstone")
+	}
+	if c.recordTombstone("BV1", errors.New("timeout")) {
+		t.Error("Network errors are no tombstone")
+	}
+	if !c.recordTombstone("BV1gone", &api.Error{Code: -404, Message: "啥都木有"}) {
+		t.Error("An already tombstoned video should still be reported as gone")
+	}
+}
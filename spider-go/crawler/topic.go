@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"fmt"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// topicKeyword is the topic_keyword of videos and dynamics found under a
+// topic
+func topicKeyword(topicID int64) string {
+	return fmt.Sprintf("topic:%d", topicID)
+}
+
+// topicVideo returns the video posted by a video dynamic, in the shape of a
+// search result, or nil for other dynamics
+func topicVideo(item map[string]interface{}) map[string]interface{} {
+	modules, _ := item["modules"].(map[string]interface{})
+	dynamic, _ := modules["module_dynamic"].(map[string]interface{})
+	major, _ := dynamic["major"].(map[string]interface{})
+	archive, _ := major["archive"].(map[string]interface{})
+	bvid, _ := archive["bvid"].(string)
+	if bvid == "" {
+		return nil
+	}
+
+	video := map[string]interface{}{"bvid": bvid, "title": archive["title"]}
+	if duration, ok := archive["duration_text"].(string); ok {
+		video["duration"] = duration
+	}
+	if author, ok := modules["module_author"].(map[string]interface{}); ok {
+		video["mid"] = author["mid"]
+	}
+	return video
+}
+
+// crawlTopics saves the dynamics posted under every configured topic and
+// sends the videos among them through the detail stage
+func (c *BiliCrawler) crawlTopics() {
+	if len(c.config.TopicIDs) == 0 {
+		return
+	}
+	session := c.newSession()
+
+	for _, topicID := range c.config.TopicIDs {
+		if c.isCancelled() {
+			return
+		}
+		c.logf("爬取话题 %d\n", topicID)
+		videos, saved := c.crawlTopic(topicID, session)
+
+		newVideos := c.claimVideos(videos)
+		c.logf("话题 %d 保存 %d 条动态，发现 %d 个视频，其中新视频 %d 个\n", topicID, saved, len(videos), len(newVideos))
+		if len(newVideos) > 0 {
+			c.fetchVideoDetails(newVideos)
+		}
+	}
+}
+
+// crawlTopic pages through a topic's dynamics, saving each one, and returns
+// the videos found among them and the number of dynamics saved
+func (c *BiliCrawler) crawlTopic(topicID int64, session *api.Session) ([]*VideoListing, int) {
+	keyword := topicKeyword(topicID)
+	var videos []*VideoListing
+	saved := 0
+
+	offset := ""
+	for page := 1; ; page++ {
+		result, err := api.GetTopicDynamics(topicID, offset, session, c.config.CookieConfigPath)
+		c.recordResult("topic", err)
+		if err != nil {
+			c.errorf("话题 %d 第 %d 页获取错误: %v\n", topicID, page, err)
+			return videos, saved
+		}
+
+		for _, item := range result.Items {
+			if video := topicVideo(item); video != nil {
+				video["topic_id"] = topicID
+				videos = append(videos, newVideoListing(video, keyword))
+			}
+
+			id, _ := item["id_str"].(string)
+			if c.config.Resume && c.isDynamicSaved(id) {
+				continue
+			}
+			item["topic_id"] = topicID
+			if err := storage.SaveDynamic(item); err == nil {
+				c.stats.incDynamicsSaved()
+				c.markDynamicSaved(id)
+				saved++
+			}
+		}
+
+		if !result.HasMore || len(result.Items) == 0 {
+			return videos, saved
+		}
+		if maxPages := c.live().TopicMaxPages; maxPages > 0 && page >= maxPages {
+			return videos, saved
+		}
+		offset = result.Offset
+		c.delay()
+	}
+}
@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTopicVideo(t *testing.T) {
+	item := map[string]interface{}{
+		"id_str": "900",
+		"modules": map[string]interface{}{
+			"module_author": map[string]interface{}{"mid": float64(42)},
+			"module_dynamic": map[string]interface{}{
+				"major": map[string]interface{}{
+					"archive": map[string]interface{}{
+						"bvid":          "BV1topic",
+						"title":         "话题视频",
+						"duration_text": "03:21",
+					},
+				},
+			},
+		},
+	}
+
+	video := topicVideo(item)
+	if video == nil {
+		t.Fatal("topicVideo should return the video of a video dynamic")
+	}
+	if video["bvid"] != "BV1topic" || videoDuration(video) != 201 || videoOwnerMid(video) != "42" {
+		t.Errorf("topicVideo = %v", video)
+	}
+
+	text := map[string]interface{}{"modules": map[string]interface{}{"module_dynamic": map[string]interface{}{}}}
+	if topicVideo(text) != nil {
+		t.Error("topicVideo should return nil for dynamics without a video")
+	}
+}
+
+func TestTopicKeyword(t *testing.T) {
+	if got := topicKeyword(1234); got != "topic:1234" {
+		t.Errorf("topicKeyword = %q", got)
+	}
+}
+
+func TestConfig_ValidateTopicIDs(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Keyword = "测试"
+	cfg.TopicIDs = []int64{1, 0}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "topic_ids") {
+		t.Errorf("Validate() = %v, expected a topic_ids error", err)
+	}
+}
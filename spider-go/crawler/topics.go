@@ -0,0 +1,25 @@
+package crawler
+
+import (
+	"context"
+	"strings"
+
+	"spider-go/storage"
+)
+
+// ensureTopics creates the claw_* topics missing on the broker when
+// kafka_create_topics is set. A failure is logged and the crawl goes on,
+// leaving the topics to the broker's auto-create.
+func (c *BiliCrawler) ensureTopics() {
+	if !c.config.KafkaOutput || !c.config.KafkaCreateTopics {
+		return
+	}
+	created, err := storage.EnsureTopics(context.Background(), c.config.KafkaPartitions, c.config.KafkaReplication)
+	if len(created) > 0 {
+		c.logf("已创建 Kafka 主题 (分区 %d, 副本 %d): %s\n",
+			c.config.KafkaPartitions, c.config.KafkaReplication, strings.Join(created, ", "))
+	}
+	if err != nil {
+		c.errorf("创建 Kafka 主题失败: %v\n", err)
+	}
+}
@@ -0,0 +1,26 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBiliCrawler_EnsureTopics_Disabled(t *testing.T) {
+	for _, tc := range []struct {
+		name                string
+		kafkaOutput, create bool
+	}{
+		{"create off", true, false},
+		{"kafka output off", false, true},
+	} {
+		c := newReloadCrawler()
+		c.config.KafkaOutput = tc.kafkaOutput
+		c.config.KafkaCreateTopics = tc.create
+		var out strings.Builder
+		c.SetLogOutput(&out)
+		c.ensureTopics()
+		if out.Len() != 0 {
+			t.Errorf("%s: ensureTopics logged %q, expected nothing", tc.name, out.String())
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package crawler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// Videos per page of the popular list
+const popularPageSize = 20
+
+// Video sources accepted by source
+const (
+	SourceSearch  = "search"  // search the keywords
+	SourceRanking = "ranking" // seed from the popular and ranking lists
+)
+
+// TrendingConfig configures the trending command, which keeps seeding
+// crawls from the hot search list and the popular and ranking videos
+// instead of a fixed keyword list
+type TrendingConfig struct {
+	// Time between the starts of two passes (a duration; empty means a
+	// single pass), and passes to run (0 means until stopped)
+	Interval string `json:"interval"`
+	Passes   int    `json:"passes"`
+	// Hot search terms read per pass, and how many of them not yet
+	// searched are searched in one pass (0 means all)
+	HotSearchLimit  int `json:"hot_search_limit"`
+	MaxTermsPerPass int `json:"max_terms_per_pass"`
+	// Search result pages crawled per term
+	PagesPerTerm int `json:"pages_per_term"`
+	// A term is searched again once this long has passed since it last was
+	// (a duration; empty searches every term once)
+	TermCooldown string `json:"term_cooldown"`
+	// Terms containing any of these, ignoring case, are never searched
+	Denylist []string `json:"denylist"`
+	// Pages of the popular list seeded per pass (0 skips it)
+	PopularPages int `json:"popular_pages"`
+	// Partitions whose ranking is seeded per pass; 0 is the all-partition
+	// ranking
+	RankingRids []int `json:"ranking_rids"`
+}
+
+// denied reports whether a term matches the denylist
+func (t TrendingConfig) denied(term string) bool {
+	lower := strings.ToLower(term)
+	for _, word := range t.Denylist {
+		if word != "" && strings.Contains(lower, strings.ToLower(word)) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectTrendingTerms returns the hot search terms to search now, hottest
+// first: terms not denied, not searched within cooldown (0 never repeats a
+// term) and not repeated, at most limit of them (0 means all)
+func selectTrendingTerms(cfg TrendingConfig, terms []api.HotSearchTerm, searched map[string]int64, cooldown time.Duration, now time.Time, limit int) []string {
+	var selected []string
+	seen := make(map[string]bool)
+	for _, term := range terms {
+		keyword := strings.TrimSpace(term.Keyword)
+		if keyword == "" || seen[keyword] || cfg.denied(keyword) {
+			continue
+		}
+		seen[keyword] = true
+		if last, ok := searched[keyword]; ok {
+			if cooldown <= 0 || now.Sub(time.Unix(last, 0)) < cooldown {
+				continue
+			}
+		}
+		selected = append(selected, keyword)
+		if limit > 0 && len(selected) >= limit {
+			break
+		}
+	}
+	return selected
+}
+
+// rankingKeyword is the topic_keyword of videos seeded from a ranking
+func rankingKeyword(rid int) string {
+	return fmt.Sprintf("ranking:%d", rid)
+}
+
+// Trending runs the pipeline over whatever is trending, pass after pass,
+// instead of searching the configured keywords
+func (c *BiliCrawler) Trending() {
+	c.run(c.trendingPasses)
+}
+
+// trendingPasses runs trending passes, once or every trending.interval
+func (c *BiliCrawler) trendingPasses() {
+	cfg := c.config.Trending
+	interval, _ := time.ParseDuration(cfg.Interval)
+
+	for pass := 1; ; pass++ {
+		started := time.Now()
+		terms, videos := c.trendingPass(started)
+		c.logf("第 %d 轮热点采集完成: 搜索 %d 个热搜词，发现 %d 个热门/排行榜视频\n", pass, terms, videos)
+
+		if interval <= 0 || cfg.Passes > 0 && pass >= cfg.Passes || c.isCancelled() {
+			return
+		}
+		next := started.Add(interval)
+		c.logf("下一轮热点采集: %s\n", next.Format("2006-01-02 15:04:05"))
+		if !c.waitNextPass(next) {
+			return
+		}
+	}
+}
+
+// trendingPass searches the new hot search terms and seeds the popular and
+// ranking videos, returning how many terms were searched and how many
+// videos the lists held
+func (c *BiliCrawler) trendingPass(now time.Time) (int, int) {
+	cfg := c.config.Trending
+	session := c.newSession()
+
+	terms := c.trendingTerms(now, session)
+	for _, term := range terms {
+		if c.isCancelled() {
+			return len(terms), 0
+		}
+		c.logf("热搜词: %s\n", term)
+		// A term whose search failed or was cut short is searched again next pass
+		if !c.searchVideos(term, cfg.PagesPerTerm, false) || c.isCancelled() {
+			c.logf("热搜词 %s 未完整搜索，下轮重新搜索\n", term)
+			continue
+		}
+		if err := storage.SaveTrendingTerm(term, now.Unix()); err != nil {
+			c.errorf("保存热搜词进度出错: %v\n", err)
+		}
+	}
+
+	return len(terms), c.seedRankings(session)
+}
+
+// seedRankings sends the videos of the first trending.popular_pages pages
+// of the popular list and of the trending.ranking_rids rankings through the
+// detail stage, returning how many videos the lists held
+func (c *BiliCrawler) seedRankings(session *api.Session) int {
+	cfg := c.config.Trending
+	videos := 0
+	for page := 1; page <= cfg.PopularPages && !c.isCancelled(); page++ {
+		result, err := api.GetPopular(page, popularPageSize, session, c.config.CookieConfigPath)
+		c.recordResult("trending", err)
+		if err != nil {
+			c.errorf("热门视频第 %d 页获取错误: %v\n", page, err)
+			break
+		}
+		videos += c.seedTrendingVideos(result.Videos, "popular")
+		if result.NoMore {
+			break
+		}
+		c.delay()
+	}
+	for _, rid := range cfg.RankingRids {
+		if c.isCancelled() {
+			break
+		}
+		list, err := api.GetRanking(rid, session, c.config.CookieConfigPath)
+		c.recordResult("trending", err)
+		if err != nil {
+			c.errorf("分区 %d 排行榜获取错误: %v\n", rid, err)
+			continue
+		}
+		videos += c.seedTrendingVideos(list, rankingKeyword(rid))
+		c.delay()
+	}
+	return videos
+}
+
+// crawlRankings seeds the crawl from the popular and ranking lists in place
+// of the keyword search
+func (c *BiliCrawler) crawlRankings() {
+	c.logf("从热门和排行榜获取视频\n")
+	videos := c.seedRankings(c.newSession())
+	c.logf("热门和排行榜共 %d 个视频\n", videos)
+}
+
+// trendingTerms fetches the hot search list and returns the terms to search
+// in this pass
+func (c *BiliCrawler) trendingTerms(now time.Time, session *api.Session) []string {
+	cfg := c.config.Trending
+	list, err := api.GetHotSearch(cfg.HotSearchLimit, session, c.config.CookieConfigPath)
+	c.recordResult("trending", err)
+	if err != nil {
+		c.errorf("热搜列表获取错误: %v\n", err)
+		return nil
+	}
+	c.delay()
+
+	searched, err := storage.GetTrendingTerms()
+	if err != nil {
+		c.errorf("读取热搜词进度出错: %v\n", err)
+	}
+	cooldown, _ := time.ParseDuration(cfg.TermCooldown)
+	terms := selectTrendingTerms(cfg, list, searched, cooldown, now, cfg.MaxTermsPerPass)
+	c.logf("热搜列表 %d 个词，本轮搜索 %d 个\n", len(list), len(terms))
+	return terms
+}
+
+// seedTrendingVideos sends the videos of a popular or ranking list through
+// the detail stage under keyword and returns how many the list held
+func (c *BiliCrawler) seedTrendingVideos(list []map[string]interface{}, keyword string) int {
+	var videos []*VideoListing
+	for _, record := range list {
+		if video := newVideoListing(record, keyword); video.Bvid != "" {
+			videos = append(videos, video)
+		}
+	}
+
+	newVideos := c.claimVideos(videos)
+	c.logf("%s: %d 个视频，其中新视频 %d 个\n", keyword, len(videos), len(newVideos))
+	if len(newVideos) > 0 {
+		c.fetchVideoDetails(newVideos)
+	}
+	return len(videos)
+}
+
+// claimVideos claims the videos of a list for this run and returns those
+// still needing their details. Videos already saved in resume mode go
+// straight to the comment stage.
+func (c *BiliCrawler) claimVideos(videos []*VideoListing) []*VideoListing {
+	var newVideos []*VideoListing
+	for _, video := range videos {
+		if !c.claimSearchResult(video.Bvid) {
+			c.stats.incVideosDeduped()
+			continue
+		}
+		if !c.allowVideo(video.Record) {
+			continue
+		}
+		if c.config.Resume && c.isBvidSaved(video.Bvid) {
+			c.stats.incVideosSkipped()
+			c.queueVideo(video.task())
+			continue
+		}
+		newVideos = append(newVideos, video)
+	}
+	return newVideos
+}
@@ -0,0 +1,189 @@
+package crawler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func hotTerms(keywords ...string) []api.HotSearchTerm {
+	terms := make([]api.HotSearchTerm, len(keywords))
+	for i, keyword := range keywords {
+		terms[i] = api.HotSearchTerm{Keyword: keyword}
+	}
+	return terms
+}
+
+func TestTrendingConfig_Denied(t *testing.T) {
+	cfg := TrendingConfig{Denylist: []string{"抽奖", "AD", ""}}
+	for term, expected := range map[string]bool{
+		"新番定档":   false,
+		"转发抽奖活动": true,
+		"ad投放":   true,
+		"":       false,
+	} {
+		if got := cfg.denied(term); got != expected {
+			t.Errorf("denied(%q) = %v, expected %v", term, got, expected)
+		}
+	}
+}
+
+func TestSelectTrendingTerms(t *testing.T) {
+	now := time.Unix(10000, 0)
+	cfg := TrendingConfig{Denylist: []string{"抽奖"}}
+	terms := hotTerms("新番", " 游戏 ", "抽奖", "新番", "", "音乐", "科技")
+	searched := map[string]int64{"音乐": 9000, "科技": 1000}
+
+	got := selectTrendingTerms(cfg, terms, searched, 0, now, 0)
+	if expected := []string{"新番", "游戏"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("without cooldown got %v, expected %v", got, expected)
+	}
+
+	// Only 科技 was searched longer than the cooldown ago
+	got = selectTrendingTerms(cfg, terms, searched, time.Hour, now, 0)
+	if expected := []string{"新番", "游戏", "科技"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("with cooldown got %v, expected %v", got, expected)
+	}
+
+	got = selectTrendingTerms(cfg, terms, nil, 0, now, 2)
+	if expected := []string{"新番", "游戏"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("with limit got %v, expected %v", got, expected)
+	}
+}
+
+func TestRankingKeyword(t *testing.T) {
+	if got := rankingKeyword(4); got != "ranking:4" {
+		t.Errorf("rankingKeyword = %q", got)
+	}
+}
+
+func TestConfig_ValidateTrending(t *testing.T) {
+	cases := map[string]func(*TrendingConfig){
+		"trending.interval":         func(t *TrendingConfig) { t.Interval = "soon" },
+		"trending.pages_per_term":   func(t *TrendingConfig) { t.PagesPerTerm = 0 },
+		"trending.term_cooldown":    func(t *TrendingConfig) { t.TermCooldown = "-1h" },
+		"trending.ranking_rids":     func(t *TrendingConfig) { t.RankingRids = []int{-1} },
+		"trending.hot_search_limit": func(t *TrendingConfig) { t.HotSearchLimit = 0 },
+	}
+	for key, mutate := range cases {
+		cfg := DefaultConfig()
+		mutate(&cfg.Trending)
+		err := cfg.ValidateTrending()
+		if err == nil || !strings.Contains(err.Error(), key) {
+			t.Errorf("Validate() = %v, expected a %s error", err, key)
+		}
+	}
+
+	// The trending command searches the hot search terms, not a keyword
+	cfg := DefaultConfig()
+	if err := cfg.ValidateTrending(); err != nil {
+		t.Errorf("default trending config is invalid: %v", err)
+	}
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "keyword") {
+		t.Errorf("Validate() = %v, expected a keyword error", err)
+	}
+}
+
+func TestConfig_ValidateSource(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Source = SourceRanking
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("ranking source without a keyword is invalid: %v", err)
+	}
+
+	cfg.Source = SourceSearch
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "keyword") {
+		t.Errorf("Validate() = %v, expected a keyword error", err)
+	}
+
+	cfg.Keyword = "测试"
+	cfg.Source = "hot"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "source") {
+		t.Errorf("Validate() = %v, expected a source error", err)
+	}
+}
+
+func TestBiliCrawler_TrendingPassRecordsFinishedTerms(t *testing.T) {
+	var c *BiliCrawler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/x/web-interface/nav":
+			w.Write([]byte(`{"code":0,"data":{"wbi_img":{"img_url":"https://i0.hdslb.com/bfs/wbi/7cd084941338484aae1ad9425b84077c.png","sub_url":"https://i0.hdslb.com/bfs/wbi/4932caff0ff746eab6f01bf08b70ac45.png"}}}`))
+		case "/x/web-interface/wbi/search/square":
+			w.Write([]byte(`{"code":0,"data":{"trending":{"list":[{"keyword":"新番"},{"keyword":"游戏"}]}}}`))
+		case "/x/web-interface/search/type":
+			// The search of the second term is cut short
+			if r.URL.Query().Get("keyword") == "游戏" {
+				c.Cancel()
+			}
+			w.Write([]byte(`{"code":0,"data":{"numPages":1,"result":[]}}`))
+		}
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	t.Cleanup(func() { storage.SetRecordDir("sent_records") })
+
+	c = newReloadCrawler()
+	c.cancelled = make(chan struct{})
+	c.sessions = api.NewSessionManager("")
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.Trending.PagesPerTerm = 1
+	c.config.Trending.PopularPages = 0
+	c.config.Trending.RankingRids = nil
+
+	if terms, _ := c.trendingPass(time.Unix(100, 0)); terms != 2 {
+		t.Errorf("trendingPass searched %d terms, expected 2", terms)
+	}
+	searched, err := storage.GetTrendingTerms()
+	if err != nil {
+		t.Fatalf("GetTrendingTerms failed: %v", err)
+	}
+	if expected := map[string]int64{"新番": 100}; !reflect.DeepEqual(searched, expected) {
+		t.Errorf("recorded terms %v, expected only the finished %v", searched, expected)
+	}
+}
+
+func TestBiliCrawler_SeedRankings(t *testing.T) {
+	var requested []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = append(requested, r.URL.Path+"?"+r.URL.RawQuery)
+		switch r.URL.Path {
+		case "/x/web-interface/popular":
+			w.Write([]byte(`{"code":0,"data":{"list":[{"bvid":"BV1"},{"bvid":"BV2"}],"no_more":true}}`))
+		case "/x/web-interface/ranking/v2":
+			w.Write([]byte(`{"code":0,"data":{"list":[{"bvid":"BV2"},{"bvid":"BV3"}]}}`))
+		}
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.Trending.PopularPages = 3
+	c.config.Trending.RankingRids = []int{4}
+	// Every video was already found this run, so no details are fetched
+	c.runSearchBvids = map[string]struct{}{"BV1": {}, "BV2": {}, "BV3": {}}
+
+	if videos := c.seedRankings(nil); videos != 4 {
+		t.Errorf("seedRankings = %d, expected 4", videos)
+	}
+	expected := []string{"/x/web-interface/popular?pn=1&ps=20", "/x/web-interface/ranking/v2?rid=4&type=all"}
+	if !reflect.DeepEqual(requested, expected) {
+		t.Errorf("requested %v, expected %v", requested, expected)
+	}
+}
@@ -0,0 +1,116 @@
+package crawler
+
+import (
+	"strconv"
+
+	"spider-go/api"
+)
+
+// Videos per page of a user's upload list
+const uploadPageSize = 30
+
+// uploadKeyword is the topic_keyword of videos found in a user's uploads
+func uploadKeyword(mid string) string {
+	return "upload:" + mid
+}
+
+// crawlUploads sends the uploads of every upload_mids user through the
+// detail stage
+func (c *BiliCrawler) crawlUploads() {
+	if len(c.config.UploadMids) == 0 {
+		return
+	}
+	session := c.newSession()
+
+	for _, id := range c.config.UploadMids {
+		if c.isCancelled() {
+			return
+		}
+		mid := strconv.FormatInt(id, 10)
+		c.claimUploader(mid)
+		c.crawlUserUploads(mid, session)
+	}
+}
+
+// crawlOwnerUploads sends the uploads of the uploaders of the videos saved
+// so far through the detail stage. The videos found there only add their
+// own uploader again, so this is not repeated.
+func (c *BiliCrawler) crawlOwnerUploads() {
+	if !c.config.UploadOwners {
+		return
+	}
+	c.mu.Lock()
+	owners := c.uploadOwners
+	c.uploadOwners = nil
+	c.mu.Unlock()
+	if len(owners) == 0 {
+		return
+	}
+
+	c.logf("爬取 %d 个 UP 主的投稿\n", len(owners))
+	session := c.newSession()
+	for _, mid := range owners {
+		if c.isCancelled() {
+			return
+		}
+		c.crawlUserUploads(mid, session)
+	}
+}
+
+// claimUploader records that a user's uploads are listed this run and
+// reports whether they were not yet
+func (c *BiliCrawler) claimUploader(mid string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.uploaders[mid]; ok {
+		return false
+	}
+	c.uploaders[mid] = struct{}{}
+	return true
+}
+
+// noteOwner queues the uploader of a saved video for crawlOwnerUploads
+func (c *BiliCrawler) noteOwner(mid string) {
+	if !c.config.UploadOwners || !c.claimUploader(mid) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.uploadOwners = append(c.uploadOwners, mid)
+}
+
+// crawlUserUploads pages through a user's uploads, newest first and up to
+// upload_max_pages pages, and sends the new videos through the detail stage
+func (c *BiliCrawler) crawlUserUploads(mid string, session *api.Session) {
+	keyword := uploadKeyword(mid)
+	var videos []*VideoListing
+
+	for page := 1; ; page++ {
+		result, err := api.GetUserVideos(mid, page, uploadPageSize, session, c.config.CookieConfigPath)
+		c.recordResult("upload", err)
+		if err != nil {
+			c.errorf("用户 %s 投稿第 %d 页获取错误: %v\n", mid, page, err)
+			break
+		}
+
+		for _, record := range result.Videos {
+			if video := newVideoListing(record, keyword); video.Bvid != "" {
+				videos = append(videos, video)
+			}
+		}
+
+		if len(result.Videos) == 0 || page*uploadPageSize >= result.Total {
+			break
+		}
+		if maxPages := c.live().UploadMaxPages; maxPages > 0 && page >= maxPages {
+			break
+		}
+		c.delay()
+	}
+
+	newVideos := c.claimVideos(videos)
+	c.logf("用户 %s 投稿 %d 个视频，其中新视频 %d 个\n", mid, len(videos), len(newVideos))
+	if len(newVideos) > 0 {
+		c.fetchVideoDetails(newVideos)
+	}
+}
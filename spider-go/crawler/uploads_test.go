@@ -0,0 +1,83 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestUploadKeyword(t *testing.T) {
+	if got := uploadKeyword("42"); got != "upload:42" {
+		t.Errorf("uploadKeyword = %q", got)
+	}
+}
+
+func TestBiliCrawler_NoteOwner(t *testing.T) {
+	c := newReloadCrawler()
+	c.uploaders = make(map[string]struct{})
+
+	c.noteOwner("1")
+	if len(c.uploadOwners) != 0 {
+		t.Errorf("owners noted without upload_owners: %v", c.uploadOwners)
+	}
+
+	c.config.UploadOwners = true
+	c.claimUploader("2") // listed as an upload_mids user
+	for _, mid := range []string{"1", "2", "3", "1"} {
+		c.noteOwner(mid)
+	}
+	if expected := []string{"1", "3"}; !reflect.DeepEqual(c.uploadOwners, expected) {
+		t.Errorf("uploadOwners = %v, expected %v", c.uploadOwners, expected)
+	}
+}
+
+func TestBiliCrawler_CrawlUserUploads(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/x/space/wbi/arc/search" {
+			return
+		}
+		pn := r.URL.Query().Get("pn")
+		pages = append(pages, pn)
+		fmt.Fprintf(w, `{"code":0,"data":{"list":{"vlist":[{"aid":1,"bvid":"BV%s"}]},"page":{"count":100}}}`, pn)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+
+	c := newReloadCrawler()
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.UploadMaxPages = 2
+	// Both videos were already found this run, so no details are fetched
+	c.runSearchBvids = map[string]struct{}{"BV1": {}, "BV2": {}}
+
+	c.crawlUserUploads("7", nil)
+	if !reflect.DeepEqual(pages, []string{"1", "2"}) {
+		t.Errorf("fetched pages %v, expected [1 2]", pages)
+	}
+	if c.stats.VideosDeduped != 2 {
+		t.Errorf("VideosDeduped = %d, expected 2", c.stats.VideosDeduped)
+	}
+}
+
+func TestConfig_ValidateUploadMids(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Keyword = "测试"
+	cfg.UploadMids = []int64{7, -1}
+	err := cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "upload_mids") {
+		t.Errorf("Validate() = %v, expected an upload_mids error", err)
+	}
+}
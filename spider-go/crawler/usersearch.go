@@ -0,0 +1,52 @@
+package crawler
+
+import (
+	"strconv"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// searchUsers sends the users found by a user search for a keyword to the
+// account stage
+func (c *BiliCrawler) searchUsers(keyword string) {
+	if !c.config.SearchUsers {
+		return
+	}
+	c.logf("搜索用户 (关键词: %s)\n", keyword)
+	c.searchUserPages(keyword, c.newSession())
+}
+
+// searchUserPages pages through the user search results of a keyword, up
+// to user_search_max_pages pages, and queues every user for the account
+// stage
+func (c *BiliCrawler) searchUserPages(keyword string, session *api.Session) {
+	found := 0
+	for page := 1; ; page++ {
+		if c.isCancelled() {
+			break
+		}
+		result, err := api.SearchUsers(keyword, page, session, c.config.CookieConfigPath)
+		c.recordResult("search", err)
+		if err != nil {
+			c.errorf("关键词 %s 用户搜索第 %d 页错误: %v\n", keyword, page, err)
+			break
+		}
+
+		for _, user := range result.Users {
+			if mid := int64Field(user, "mid"); mid != 0 {
+				found++
+				c.addUserMid(strconv.FormatInt(mid, 10), storage.MidSource{Role: storage.MidSearched})
+			}
+		}
+
+		if len(result.Users) == 0 || page >= result.NumPages {
+			break
+		}
+		if maxPages := c.live().UserSearchMaxPages; maxPages > 0 && page >= maxPages {
+			break
+		}
+		c.delay()
+	}
+	c.logf("关键词 %s 找到 %d 个用户\n", keyword, found)
+}
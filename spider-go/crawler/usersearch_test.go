@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"spider-go/api"
+	"spider-go/ratelimit"
+	"spider-go/storage"
+)
+
+func TestBiliCrawler_SearchUserPages(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("search_type") != "bili_user" {
+			return
+		}
+		pn := r.URL.Query().Get("page")
+		pages = append(pages, pn)
+		fmt.Fprintf(w, `{"code":0,"data":{"numPages":5,"result":[{"mid":%s0,"uname":"a"},{"uname":"no mid"}]}}`, pn)
+	}))
+	defer server.Close()
+	target, _ := url.Parse(server.URL)
+	api.SetTransport(redirectTransport{target: target})
+	t.Cleanup(func() { api.SetTransport(nil) })
+	ratelimit.InitRateLimiter(1000, 1000)
+	storage.SetRecordDir(t.TempDir())
+	defer storage.SetRecordDir("sent_records")
+
+	c := newReloadCrawler()
+	c.config.Resume = false
+	c.config.DelayMin, c.config.DelayMax = 0, 0
+	c.config.UserSearchMaxPages = 2
+	c.userMids = make(map[string]storage.MidSource)
+	c.userMidQueue = make(chan string, 10)
+
+	c.searchUserPages("测试", nil)
+	if !reflect.DeepEqual(pages, []string{"1", "2"}) {
+		t.Errorf("fetched pages %v, expected [1 2]", pages)
+	}
+	if len(c.userMidQueue) != 2 {
+		t.Fatalf("queued %d users, expected 2", len(c.userMidQueue))
+	}
+	if source := c.userMids["10"]; source.Role != storage.MidSearched {
+		t.Errorf("user 10 discovered as %+v", source)
+	}
+}
@@ -0,0 +1,120 @@
+package crawler
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"spider-go/api"
+	"spider-go/storage"
+)
+
+// videoStatFields are the counters copied into a stat snapshot
+var videoStatFields = []string{"view", "danmaku", "reply", "favorite", "coin", "share", "like"}
+
+// videoStatRecord builds the stat snapshot of a video taken at now
+func videoStatRecord(bvid string, stat map[string]interface{}, now time.Time) map[string]interface{} {
+	record := map[string]interface{}{
+		"bvid":        bvid,
+		"aid":         stat["aid"],
+		"snapshot_at": now.Unix(),
+	}
+	for _, field := range videoStatFields {
+		record[field] = stat[field]
+	}
+	return record
+}
+
+// SnapshotStats runs the pipeline over the saved videos, publishing their
+// current counters instead of searching keywords
+func (c *BiliCrawler) SnapshotStats() {
+	c.run(c.snapshotStatPasses)
+}
+
+// snapshotStatPasses takes stat snapshots of every saved video, once or
+// every stat_snapshot_interval
+func (c *BiliCrawler) snapshotStatPasses() {
+	interval, _ := time.ParseDuration(c.config.StatSnapshotInterval)
+
+	for pass := 1; ; pass++ {
+		started := time.Now()
+		saved, total := c.snapshotStatPass()
+		c.logf("第 %d 轮数据快照完成: %d/%d 个视频\n", pass, saved, total)
+
+		if interval <= 0 || c.config.StatSnapshotPasses > 0 && pass >= c.config.StatSnapshotPasses || c.isCancelled() {
+			return
+		}
+		next := started.Add(interval)
+		c.logf("下一轮数据快照: %s\n", next.Format("2006-01-02 15:04:05"))
+		if !c.waitNextPass(next) {
+			return
+		}
+	}
+}
+
+// snapshotStatPass takes one stat snapshot of every saved video and returns
+// how many were saved out of how many videos
+func (c *BiliCrawler) snapshotStatPass() (int, int) {
+	saved, err := storage.GetSavedVideoBvids()
+	if err != nil {
+		c.errorf("读取已保存视频出错: %v\n", err)
+		return 0, 0
+	}
+	gone, err := storage.GetTombstonedBvids()
+	if err != nil {
+		c.errorf("读取已下架视频出错: %v\n", err)
+	}
+	bvids := make([]string, 0, len(saved))
+	for bvid := range saved {
+		if _, ok := gone[bvid]; !ok {
+			bvids = append(bvids, bvid)
+		}
+	}
+	sort.Strings(bvids)
+
+	queue := make(chan string, len(bvids))
+	for _, bvid := range bvids {
+		queue <- bvid
+	}
+	close(queue)
+
+	before := c.stats.Snapshot().StatSnapshots
+	var wg sync.WaitGroup
+	for i := 0; i < c.threads("stats"); i++ {
+		wg.Add(1)
+		session := c.newSession()
+		go c.statWorker(i, queue, &wg, session)
+	}
+	wg.Wait()
+
+	return c.stats.Snapshot().StatSnapshots - before, len(bvids)
+}
+
+// statWorker takes stat snapshots of the videos from queue
+func (c *BiliCrawler) statWorker(threadID int, queue <-chan string, wg *sync.WaitGroup, session *api.Session) {
+	defer wg.Done()
+
+	for bvid := range queue {
+		if c.isCancelled() {
+			continue
+		}
+		c.recoverTask("stats", threadID, nil, func() {
+			stat, err := api.GetVideoStat(bvid, session, c.config.CookieConfigPath)
+			c.recordResult("stats", err)
+			if c.recordTombstone(bvid, err) {
+				c.logf("[快照线程%d] %s 已删除或不可见: %v\n", threadID, bvid, err)
+			} else if err != nil {
+				c.errorf("[快照线程%d] %s 获取数据失败: %v\n", threadID, bvid, err)
+			} else {
+				record := videoStatRecord(bvid, stat, time.Now())
+				if c.config.StatSnapshotOnline {
+					c.addSnapshotOnline(threadID, bvid, record, session)
+				}
+				if err := storage.SaveVideoStat(record); err == nil {
+					c.stats.incStatSnapshots()
+				}
+			}
+		})
+		c.delay()
+	}
+}
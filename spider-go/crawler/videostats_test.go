@@ -0,0 +1,30 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestVideoStatRecord(t *testing.T) {
+	stat := map[string]interface{}{
+		"aid": float64(170001), "view": float64(1000), "like": float64(50),
+		"coin": float64(5), "favorite": float64(8), "reply": float64(12),
+		"danmaku": float64(3), "share": float64(1), "now_rank": float64(0),
+	}
+	now := time.Unix(1700000000, 0)
+
+	record := videoStatRecord("BV1stat", stat, now)
+	if record["bvid"] != "BV1stat" || record["aid"] != float64(170001) || record["snapshot_at"] != int64(1700000000) {
+		t.Errorf("record = %v", record)
+	}
+	if record["view"] != float64(1000) || record["like"] != float64(50) || record["reply"] != float64(12) {
+		t.Errorf("record counters = %v", record)
+	}
+	if _, ok := record["now_rank"]; ok {
+		t.Error("Only the counters should be copied into a snapshot")
+	}
+}
+
+func TestVideoStatRecord_SchemaFields(t *testing.T) {
+	assertSchemaFields(t, "stat", videoStatRecord("BV1", map[string]interface{}{}, time.Now()))
+}
@@ -1,28 +1,64 @@
 package main
 
 import (
-	"flag"
 	"fmt"
 	"os"
-
-	"spider-go/crawler"
+	"strings"
 )
 
+// command is a subcommand with its own flag set
+type command struct {
+	Name    string
+	Summary string
+	Run     func(args []string) int
+}
+
+var commands = []command{
+	{"crawl", "按配置搜索并爬取视频、评论和用户（默认命令）", runCrawl},
+	{"retry-failed", "只重试 failed_tasks.json 中记录的失败任务", runRetryFailed},
+	{"crawl-comments", "跳过搜索和详情，只爬取已保存视频的评论和回复", runCrawlComments},
+	{"crawl-accounts", "只爬取 pending_mids 中待爬取用户的信息", runCrawlAccounts},
+	{"snapshot-stats", "定期重新获取已保存视频的播放、点赞等数据（时间序列）", runSnapshotStats},
+	{"trending", "持续跟踪热搜词和热门/排行榜视频，自动为新热点发起爬取", runTrending},
+	{"status", "汇总已发送记录和爬取进度", runStatus},
+	{"validate-cookies", "逐个检查 Cookie 是否仍处于登录状态", runValidateCookies},
+	{"export", "将 Kafka 中某类数据导出为 JSON Lines", runExport},
+	{"consume", "实时打印 Kafka 中某类数据的新消息", runConsume},
+	{"republish", "将 export 导出的 JSON Lines 按原消息键重新发布到 Kafka 或输出插件", runRepublish},
+	{"state", "导出/导入断点状态（state export|import）", runState},
+	{"dedup", "导出/合并已保存视频、评论、用户的去重集合（dedup export|import）", runDedup},
+	{"bench", "用进程内的模拟接口跑完整流程，测量各阶段吞吐量", runBench},
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "用法: %s <命令> [选项]\n\n命令:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-18s %s\n", cmd.Name, cmd.Summary)
+	}
+	fmt.Fprintf(os.Stderr, "\n使用 \"%s <命令> -h\" 查看命令的选项\n", os.Args[0])
+}
+
 func main() {
-	configPath := flag.String("config", "config.json", "配置文件路径")
-	flag.Parse()
+	args := os.Args[1:]
+
+	// Without a command, or with flags only, behave like the old single-command binary
+	name := "crawl"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-	config, err := crawler.LoadConfig(*configPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "加载配置失败: %v\n", err)
-		os.Exit(1)
+	if name == "help" {
+		usage()
+		return
 	}
 
-	c, err := crawler.NewBiliCrawler(config)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "初始化爬虫失败: %v\n", err)
-		os.Exit(1)
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			os.Exit(cmd.Run(args))
+		}
 	}
 
-	c.Run()
+	fmt.Fprintf(os.Stderr, "未知命令: %s\n\n", name)
+	usage()
+	os.Exit(2)
 }
@@ -2,6 +2,7 @@ package ratelimit
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -61,6 +62,22 @@ func (tb *TokenBucket) SetRate(rate float64) {
 	tb.rate = rate
 }
 
+// SetCapacity updates the bucket capacity, dropping tokens above it
+func (tb *TokenBucket) SetCapacity(capacity float64) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill()
+	tb.capacity = capacity
+	tb.tokens = min(tb.tokens, capacity)
+}
+
+// Rate returns the current rate of token generation
+func (tb *TokenBucket) Rate() float64 {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.rate
+}
+
 // GetTokens returns the current number of available tokens (for testing)
 func (tb *TokenBucket) GetTokens() float64 {
 	tb.mu.Lock()
@@ -72,6 +89,16 @@ func (tb *TokenBucket) GetTokens() float64 {
 var (
 	globalLimiter *TokenBucket
 	limiterMu     sync.Mutex
+
+	pauses    = make(map[string]bool) // reasons requests are paused for
+	pauseMu   sync.Mutex
+	pauseCond = sync.NewCond(&pauseMu)
+
+	requests atomic.Int64
+
+	slots    chan struct{} // one entry per request in flight, nil for no cap
+	slotsMu  sync.Mutex
+	inFlight atomic.Int64
 )
 
 // InitRateLimiter initializes the global rate limiter with custom rate and capacity
@@ -81,6 +108,13 @@ func InitRateLimiter(rate, capacity float64) {
 	globalLimiter = NewTokenBucket(rate, capacity)
 }
 
+// SetRateLimiter installs limiter as the global rate limiter
+func SetRateLimiter(limiter *TokenBucket) {
+	limiterMu.Lock()
+	defer limiterMu.Unlock()
+	globalLimiter = limiter
+}
+
 // GetRateLimiter returns the global rate limiter singleton
 func GetRateLimiter() *TokenBucket {
 	limiterMu.Lock()
@@ -91,7 +125,146 @@ func GetRateLimiter() *TokenBucket {
 	return globalLimiter
 }
 
-// WaitForToken acquires one token from the global rate limiter
+// Reasons requests are paused for. Requests stay paused while any reason
+// holds, so lifting one (e.g. the end of quiet hours) never lifts another
+// (e.g. a tripped circuit).
+const (
+	PauseOperator = "operator" // Pause and Resume: console, signals, web API
+	PauseCircuit  = "circuit"  // error circuit cool-down
+	PauseQuiet    = "quiet"    // quiet hours
+)
+
+// Pause blocks all subsequent WaitForToken calls until Resume is called.
+// Requests already in flight are not interrupted.
+func Pause() {
+	PauseFor(PauseOperator)
+}
+
+// Resume lifts a Pause. Requests stay paused while another reason holds.
+func Resume() {
+	ResumeFor(PauseOperator)
+}
+
+// PauseFor blocks all subsequent WaitForToken calls until ResumeFor is
+// called with the same reason
+func PauseFor(reason string) {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	pauses[reason] = true
+}
+
+// ResumeFor lifts the pause for reason and releases the callers blocked by
+// it if no other reason holds
+func ResumeFor(reason string) {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	delete(pauses, reason)
+	if len(pauses) == 0 {
+		pauseCond.Broadcast()
+	}
+}
+
+// ResumeAll lifts every pause, e.g. once a crawl is over
+func ResumeAll() {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	clear(pauses)
+	pauseCond.Broadcast()
+}
+
+// IsPaused reports whether requests are currently paused for any reason
+func IsPaused() bool {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	return len(pauses) > 0
+}
+
+// PausedFor reports whether requests are paused for reason
+func PausedFor(reason string) bool {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	return pauses[reason]
+}
+
+// waitWhilePaused blocks while requests are paused
+func waitWhilePaused() {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	for len(pauses) > 0 {
+		pauseCond.Wait()
+	}
+}
+
+// WaitForToken waits while requests are paused, then acquires one token from
+// the global rate limiter
 func WaitForToken() {
+	waitWhilePaused()
 	GetRateLimiter().Acquire(1.0, true)
+	requests.Add(1)
+}
+
+// Requests returns how many requests WaitForToken has let through
+func Requests() int64 {
+	return requests.Load()
+}
+
+// SetMaxConcurrent caps how many requests may be in flight at once across
+// the process, whatever the number of workers; n <= 0 removes the cap.
+// Requests already holding a slot keep it.
+func SetMaxConcurrent(n int) {
+	slotsMu.Lock()
+	defer slotsMu.Unlock()
+	if n <= 0 {
+		slots = nil
+		return
+	}
+	slots = make(chan struct{}, n)
+}
+
+// AcquireSlot blocks until a request may start under the concurrency cap and
+// returns the function that releases the slot when the request is done
+func AcquireSlot() func() {
+	slotsMu.Lock()
+	s := slots
+	slotsMu.Unlock()
+
+	if s != nil {
+		s <- struct{}{}
+	}
+	inFlight.Add(1)
+	return func() {
+		inFlight.Add(-1)
+		if s != nil {
+			<-s
+		}
+	}
+}
+
+// TryAcquireSlot takes a slot under the concurrency cap if one is free and
+// returns the function that releases it, or reports false at once when
+// every slot is held
+func TryAcquireSlot() (func(), bool) {
+	slotsMu.Lock()
+	s := slots
+	slotsMu.Unlock()
+
+	if s != nil {
+		select {
+		case s <- struct{}{}:
+		default:
+			return nil, false
+		}
+	}
+	inFlight.Add(1)
+	return func() {
+		inFlight.Add(-1)
+		if s != nil {
+			<-s
+		}
+	}, true
+}
+
+// InFlight returns how many requests currently hold a slot
+func InFlight() int64 {
+	return inFlight.Load()
 }
@@ -79,6 +79,20 @@ func TestTokenBucket_SetRate(t *testing.T) {
 	}
 }
 
+func TestTokenBucket_SetCapacity(t *testing.T) {
+	tb := NewTokenBucket(1.0, 5.0)
+
+	tb.SetCapacity(2.0)
+	if tokens := tb.GetTokens(); tokens > 2.0 {
+		t.Errorf("Tokens should be capped at the new capacity, got %f", tokens)
+	}
+
+	tb.SetCapacity(10.0)
+	if tokens := tb.GetTokens(); tokens > 2.1 {
+		t.Errorf("Raising capacity should not add tokens, got %f", tokens)
+	}
+}
+
 func TestTokenBucket_Concurrent(t *testing.T) {
 	tb := NewTokenBucket(1000.0, 100.0) // High rate for fast test
 
@@ -115,3 +129,171 @@ func TestGetRateLimiter_Singleton(t *testing.T) {
 		t.Error("GetRateLimiter should return the same instance")
 	}
 }
+
+func TestPauseResume(t *testing.T) {
+	InitRateLimiter(1000.0, 10.0)
+
+	Pause()
+	if !IsPaused() {
+		t.Fatal("Expected limiter to be paused")
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		WaitForToken()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("WaitForToken should block while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	Resume()
+	if IsPaused() {
+		t.Error("Expected limiter to be resumed")
+	}
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("WaitForToken should proceed after Resume")
+	}
+}
+
+func TestRequests(t *testing.T) {
+	InitRateLimiter(1000.0, 10.0)
+	before := Requests()
+	WaitForToken()
+	WaitForToken()
+	if got := Requests() - before; got != 2 {
+		t.Errorf("Requests increased by %d, expected 2", got)
+	}
+}
+
+func TestAcquireSlot_Cap(t *testing.T) {
+	SetMaxConcurrent(2)
+	defer SetMaxConcurrent(0)
+
+	var (
+		mu      sync.Mutex
+		current int
+		peak    int
+		wg      sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release := AcquireSlot()
+			defer release()
+
+			mu.Lock()
+			current++
+			peak = max(peak, current)
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			current--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if peak != 2 {
+		t.Errorf("Peak concurrency = %d, expected the cap of 2", peak)
+	}
+	if InFlight() != 0 {
+		t.Errorf("InFlight = %d after all requests finished", InFlight())
+	}
+}
+
+func TestAcquireSlot_Unlimited(t *testing.T) {
+	SetMaxConcurrent(0)
+
+	releases := make([]func(), 0, 100)
+	for i := 0; i < 100; i++ {
+		releases = append(releases, AcquireSlot())
+	}
+	if InFlight() != 100 {
+		t.Errorf("InFlight = %d, expected 100", InFlight())
+	}
+	for _, release := range releases {
+		release()
+	}
+}
+
+func TestTryAcquireSlot(t *testing.T) {
+	SetMaxConcurrent(1)
+	defer SetMaxConcurrent(0)
+
+	release, ok := TryAcquireSlot()
+	if !ok {
+		t.Fatal("TryAcquireSlot should take a free slot")
+	}
+	if _, ok := TryAcquireSlot(); ok {
+		t.Error("TryAcquireSlot should not take a slot over the cap")
+	}
+	release()
+	if release, ok := TryAcquireSlot(); !ok {
+		t.Error("TryAcquireSlot should take a released slot")
+	} else {
+		release()
+	}
+	if InFlight() != 0 {
+		t.Errorf("InFlight = %d after every slot was released", InFlight())
+	}
+}
+
+func TestSetMaxConcurrent_KeepsHeldSlots(t *testing.T) {
+	SetMaxConcurrent(1)
+	defer SetMaxConcurrent(0)
+
+	release := AcquireSlot()
+	SetMaxConcurrent(1)
+
+	acquired := make(chan struct{})
+	go func() {
+		AcquireSlot()()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("A new cap should not count slots held under the old one")
+	}
+	release()
+}
+
+func TestPauseFor_ReasonsAreIndependent(t *testing.T) {
+	InitRateLimiter(1000.0, 10.0)
+	defer ResumeAll()
+
+	PauseFor(PauseCircuit)
+	Pause()
+	Resume()
+	if !IsPaused() || !PausedFor(PauseCircuit) {
+		t.Fatal("Resume should not lift the circuit pause")
+	}
+	if PausedFor(PauseOperator) {
+		t.Error("Resume should lift the operator pause")
+	}
+
+	PauseFor(PauseQuiet)
+	ResumeFor(PauseCircuit)
+	if !IsPaused() {
+		t.Error("Requests should stay paused while quiet hours hold")
+	}
+	ResumeFor(PauseQuiet)
+	if IsPaused() {
+		t.Error("Requests should resume once no reason holds")
+	}
+
+	PauseFor(PauseCircuit)
+	PauseFor(PauseQuiet)
+	ResumeAll()
+	if IsPaused() {
+		t.Error("ResumeAll should lift every pause")
+	}
+}
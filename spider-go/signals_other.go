@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "spider-go/crawler"
+
+// controlOnSignal does nothing where SIGUSR1 and SIGUSR2 do not exist
+func controlOnSignal(c *crawler.BiliCrawler) {}
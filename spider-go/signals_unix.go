@@ -0,0 +1,28 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"spider-go/crawler"
+)
+
+// controlOnSignal lets operators pause and resume the crawl with SIGUSR1
+// and dump its status to the log with SIGUSR2
+func controlOnSignal(c *crawler.BiliCrawler) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			switch sig {
+			case syscall.SIGUSR1:
+				c.TogglePause()
+			case syscall.SIGUSR2:
+				c.DumpStatus()
+			}
+		}
+	}()
+}
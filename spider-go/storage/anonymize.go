@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+// Fields rewritten by the anonymizer wherever they appear in a record
+var (
+	// User IDs, replaced by their keyed hash
+	anonymizedIDFields = map[string]bool{"mid": true, "uid": true, "owner_mid": true, "host_mid": true}
+	// User names, replaced by their keyed hash
+	anonymizedNameFields = map[string]bool{"uname": true}
+	// Objects describing a user, whose "name" is a user name too
+	userObjects = map[string]bool{"owner": true, "card": true, "member": true, "module_author": true, "author": true, "space": true,
+		"staff": true}
+	// Avatar URLs, locations, birthdays and schools, removed
+	strippedFields = map[string]bool{"face": true, "avatar": true, "location": true, "ip_location": true, "pub_location_text": true,
+		"birthday": true, "school": true}
+)
+
+// Anonymizer pseudonymizes user IDs and names with a keyed HMAC, so the same
+// user keeps the same pseudonym across records and runs without the key
+// revealing who it is, and strips avatars and locations
+type Anonymizer struct {
+	key []byte
+}
+
+// NewAnonymizer creates an anonymizer with an HMAC key
+func NewAnonymizer(key string) *Anonymizer {
+	return &Anonymizer{key: []byte(key)}
+}
+
+// anonymizer applies to every published record when set
+var anonymizer *Anonymizer
+
+// SetAnonymizer enables anonymization of published records, or disables it
+// with nil. It must be called before anything is saved.
+func SetAnonymizer(a *Anonymizer) {
+	anonymizer = a
+}
+
+// ID returns the pseudonym of a user ID or name
+func (a *Anonymizer) ID(value string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// scalarString formats a decoded JSON ID the way the API prints it
+func scalarString(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	case int64:
+		return strconv.FormatInt(n, 10)
+	case int:
+		return strconv.Itoa(n)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// Record returns an anonymized copy of a record; the original is untouched
+func (a *Anonymizer) Record(record map[string]interface{}) map[string]interface{} {
+	return a.object(record, false)
+}
+
+func (a *Anonymizer) object(m map[string]interface{}, isUser bool) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		switch {
+		case strippedFields[key]:
+			continue
+		case value == nil:
+			out[key] = nil
+		case anonymizedIDFields[key], anonymizedNameFields[key], isUser && key == "name":
+			out[key] = a.ID(scalarString(value))
+		case key == "mentioned_mids":
+			out[key] = a.list(value)
+		case key == "at_name_to_mid":
+			ats, _ := value.(map[string]interface{})
+			hashed := make(map[string]interface{}, len(ats))
+			for name, mid := range ats {
+				hashed[a.ID(name)] = a.ID(scalarString(mid))
+			}
+			out[key] = hashed
+		default:
+			out[key] = a.value(value, userObjects[key])
+		}
+	}
+	return out
+}
+
+// list hashes every element of a list of IDs
+func (a *Anonymizer) list(value interface{}) []string {
+	var ids []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		ids = v
+	case []int64:
+		for _, id := range v {
+			ids = append(ids, id)
+		}
+	}
+	hashed := make([]string, 0, len(ids))
+	for _, id := range ids {
+		hashed = append(hashed, a.ID(scalarString(id)))
+	}
+	return hashed
+}
+
+func (a *Anonymizer) value(v interface{}, isUser bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return a.object(t, isUser)
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = a.value(item, isUser)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]map[string]interface{}, len(t))
+		for i, item := range t {
+			out[i] = a.object(item, isUser)
+		}
+		return out
+	}
+	return v
+}
+
+// publicID returns the form of a user ID used in Kafka message keys
+func publicID(id string) string {
+	if anonymizer != nil {
+		return anonymizer.ID(id)
+	}
+	return id
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizer_Record(t *testing.T) {
+	a := NewAnonymizer("secret")
+	comment := map[string]interface{}{
+		"rpid": float64(100),
+		"mid":  float64(123456789),
+		"member": map[string]interface{}{
+			"mid":    "123456789",
+			"uname":  "张三",
+			"avatar": "https://i0.hdslb.com/bfs/face/a.jpg",
+		},
+		"reply_control":  map[string]interface{}{"location": "IP属地：广东"},
+		"mentioned_mids": []int64{42},
+		"content": map[string]interface{}{
+			"message":        "@李四 你好",
+			"at_name_to_mid": map[string]interface{}{"李四": float64(42)},
+		},
+	}
+
+	out := a.Record(comment)
+	if out["mid"] != a.ID("123456789") || out["rpid"] != float64(100) {
+		t.Errorf("mid should be hashed and rpid kept, got %v / %v", out["mid"], out["rpid"])
+	}
+	member := out["member"].(map[string]interface{})
+	if member["mid"] != out["mid"] {
+		t.Error("The same user should get the same pseudonym whether the ID is a number or a string")
+	}
+	if member["uname"] != a.ID("张三") {
+		t.Errorf("uname = %v, expected it hashed", member["uname"])
+	}
+	if _, ok := member["avatar"]; ok {
+		t.Error("avatar should be stripped")
+	}
+	if _, ok := out["reply_control"].(map[string]interface{})["location"]; ok {
+		t.Error("location should be stripped")
+	}
+	if mids := out["mentioned_mids"].([]string); len(mids) != 1 || mids[0] != a.ID("42") {
+		t.Errorf("mentioned_mids = %v", mids)
+	}
+	ats := out["content"].(map[string]interface{})["at_name_to_mid"].(map[string]interface{})
+	if ats[a.ID("李四")] != a.ID("42") {
+		t.Errorf("at_name_to_mid = %v", ats)
+	}
+
+	// The original record is left untouched
+	if comment["mid"] != float64(123456789) || comment["member"].(map[string]interface{})["avatar"] == nil {
+		t.Error("Record should not modify its input")
+	}
+}
+
+func TestAnonymizer_OwnerName(t *testing.T) {
+	a := NewAnonymizer("secret")
+	video := map[string]interface{}{
+		"title": "视频",
+		"owner": map[string]interface{}{"mid": float64(1), "name": "UP主", "face": "https://i0.hdslb.com/a.jpg"},
+		"staff": []interface{}{map[string]interface{}{"mid": float64(2), "title": "合作", "name": "联合投稿人"}},
+		"tags":  []interface{}{map[string]interface{}{"tag_name": "游戏"}},
+	}
+
+	data, _ := json.Marshal(a.Record(video))
+	for _, leaked := range []string{"UP主", "联合投稿人", "hdslb"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("anonymized video still contains %q: %s", leaked, data)
+		}
+	}
+	if !strings.Contains(string(data), "游戏") || !strings.Contains(string(data), "视频") || !strings.Contains(string(data), "合作") {
+		t.Errorf("non-personal fields should be kept: %s", data)
+	}
+}
+
+func TestAnonymizer_SpaceInfo(t *testing.T) {
+	a := NewAnonymizer("secret")
+	account := map[string]interface{}{
+		"card": map[string]interface{}{"mid": "1", "name": "用户"},
+		"space": map[string]interface{}{
+			"mid":      float64(1),
+			"name":     "用户",
+			"birthday": "01-01",
+			"school":   map[string]interface{}{"name": "某大学"},
+			"sign":     "签名",
+		},
+	}
+
+	data, _ := json.Marshal(a.Record(account))
+	for _, leaked := range []string{"用户", "01-01", "某大学"} {
+		if strings.Contains(string(data), leaked) {
+			t.Errorf("anonymized account still contains %q: %s", leaked, data)
+		}
+	}
+	if !strings.Contains(string(data), "签名") {
+		t.Errorf("non-personal fields should be kept: %s", data)
+	}
+}
+
+func TestAnonymizer_KeyedHash(t *testing.T) {
+	if NewAnonymizer("a").ID("1") == NewAnonymizer("b").ID("1") {
+		t.Error("Pseudonyms should depend on the key")
+	}
+	if NewAnonymizer("a").ID("1") != NewAnonymizer("a").ID("1") {
+		t.Error("Pseudonyms should be stable for a key")
+	}
+}
+
+func TestPublicID(t *testing.T) {
+	defer SetAnonymizer(nil)
+
+	if publicID("42") != "42" {
+		t.Error("IDs should be unchanged without an anonymizer")
+	}
+	a := NewAnonymizer("secret")
+	SetAnonymizer(a)
+	if publicID("42") != a.ID("42") {
+		t.Error("IDs should be hashed with an anonymizer")
+	}
+}
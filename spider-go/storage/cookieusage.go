@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"spider-go/cookie"
+)
+
+const cookieUsageFile = "cookie_usage.json"
+
+// maxCookieUsageRuns is how many runs cookie_usage.json keeps
+const maxCookieUsageRuns = 100
+
+var cookieUsageMu sync.Mutex
+
+// CookieUsageRun is the request count of every cookie used in one run
+type CookieUsageRun struct {
+	Started  int64          `json:"started"`
+	Finished int64          `json:"finished"`
+	Cookies  []cookie.Usage `json:"cookies"`
+}
+
+// GetCookieUsage returns the recorded runs, oldest first
+func GetCookieUsage() ([]CookieUsageRun, error) {
+	cookieUsageMu.Lock()
+	defer cookieUsageMu.Unlock()
+	return loadCookieUsage()
+}
+
+// AppendCookieUsage records the cookie usage of a run, dropping the oldest
+// runs beyond the last 100
+func AppendCookieUsage(run CookieUsageRun) error {
+	cookieUsageMu.Lock()
+	defer cookieUsageMu.Unlock()
+
+	runs, err := loadCookieUsage()
+	if err != nil {
+		return err
+	}
+	runs = append(runs, run)
+	if len(runs) > maxCookieUsageRuns {
+		runs = runs[len(runs)-maxCookieUsageRuns:]
+	}
+
+	if err := EnsureDir(recordDir); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(recordDir, cookieUsageFile), content, 0644)
+}
+
+func loadCookieUsage() ([]CookieUsageRun, error) {
+	content, err := os.ReadFile(filepath.Join(recordDir, cookieUsageFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var runs []CookieUsageRun
+	if err := json.Unmarshal(content, &runs); err != nil {
+		return nil, nil
+	}
+	return runs, nil
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"testing"
+
+	"spider-go/cookie"
+)
+
+func TestAppendCookieUsage(t *testing.T) {
+	setupTestDir(t)
+
+	if runs, err := GetCookieUsage(); err != nil || len(runs) != 0 {
+		t.Fatalf("GetCookieUsage before any run = %v, %v", runs, err)
+	}
+	for i := 0; i < maxCookieUsageRuns+5; i++ {
+		run := CookieUsageRun{Started: int64(i), Finished: int64(i + 1), Cookies: []cookie.Usage{{Name: "a", Requests: int64(i)}}}
+		if err := AppendCookieUsage(run); err != nil {
+			t.Fatalf("AppendCookieUsage: %v", err)
+		}
+	}
+
+	runs, err := GetCookieUsage()
+	if err != nil {
+		t.Fatalf("GetCookieUsage: %v", err)
+	}
+	if len(runs) != maxCookieUsageRuns {
+		t.Fatalf("kept %d runs, expected %d", len(runs), maxCookieUsageRuns)
+	}
+	if runs[0].Started != 5 || runs[len(runs)-1].Cookies[0].Requests != maxCookieUsageRuns+4 {
+		t.Errorf("expected the oldest runs dropped, got first %+v, last %+v", runs[0], runs[len(runs)-1])
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// dedupSetFiles maps the kinds of a dedup set to their record files
+var dedupSetFiles = map[string]string{
+	"video":   "sent_videos.txt",
+	"comment": "sent_comments.txt",
+	"account": "sent_accounts.txt",
+}
+
+// dedupSectionPrefix starts the section of one kind in an exported set
+const dedupSectionPrefix = "#kind "
+
+// DedupSetKinds returns the kinds ExportSentIDs accepts, sorted
+func DedupSetKinds() []string {
+	kinds := make([]string, 0, len(dedupSetFiles))
+	for kind := range dedupSetFiles {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// ExportSentIDs writes the saved IDs of each kind (video BVIDs, comment
+// RPIDs, account MIDs) to w as gzipped text: a "#kind <kind>" line, then the
+// kind's IDs sorted, one per line. It returns the number of IDs per kind.
+func ExportSentIDs(w io.Writer, kinds []string) (map[string]int, error) {
+	for _, kind := range kinds {
+		if _, ok := dedupSetFiles[kind]; !ok {
+			return nil, fmt.Errorf("unknown dedup set %q (expected one of %v)", kind, DedupSetKinds())
+		}
+	}
+
+	gz := gzip.NewWriter(w)
+	bw := bufio.NewWriter(gz)
+	counts := make(map[string]int, len(kinds))
+	for _, kind := range kinds {
+		ids, err := loadSentIDs(dedupSetFiles[kind])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s IDs: %w", kind, err)
+		}
+		sorted := make([]string, 0, len(ids))
+		for id := range ids {
+			sorted = append(sorted, id)
+		}
+		sort.Strings(sorted)
+
+		fmt.Fprintf(bw, "%s%s\n", dedupSectionPrefix, kind)
+		for _, id := range sorted {
+			bw.WriteString(id)
+			bw.WriteByte('\n')
+		}
+		counts[kind] = len(sorted)
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	return counts, gz.Close()
+}
+
+// ImportSentIDs merges a set written by ExportSentIDs into the record
+// files, appending the IDs not saved yet, and returns the number added per
+// kind
+func ImportSentIDs(r io.Reader) (map[string]int, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dedup set: %w", err)
+	}
+	defer gz.Close()
+
+	added := make(map[string]int)
+	var kind string
+	var known map[string]struct{}
+	scanner := bufio.NewScanner(gz)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if section, ok := strings.CutPrefix(line, dedupSectionPrefix); ok {
+			if _, ok := dedupSetFiles[section]; !ok {
+				return added, fmt.Errorf("line %d: unknown dedup set %q", lineNo, section)
+			}
+			kind = section
+			if known, err = loadSentIDs(dedupSetFiles[kind]); err != nil {
+				return added, fmt.Errorf("failed to read %s IDs: %w", kind, err)
+			}
+			if _, ok := added[kind]; !ok {
+				added[kind] = 0
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		if kind == "" {
+			return added, fmt.Errorf("line %d: ID before any %q line", lineNo, strings.TrimSpace(dedupSectionPrefix))
+		}
+		if _, ok := known[line]; ok {
+			continue
+		}
+		if err := recordSentID(dedupSetFiles[kind], line); err != nil {
+			return added, err
+		}
+		known[line] = struct{}{}
+		added[kind]++
+	}
+	if err := scanner.Err(); err != nil {
+		return added, fmt.Errorf("invalid dedup set: %w", err)
+	}
+	return added, FlushSentIDs()
+}
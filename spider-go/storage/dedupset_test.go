@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"testing"
+)
+
+func TestExportImportSentIDs(t *testing.T) {
+	setupTestDir(t)
+	for _, bvid := range []string{"BV3", "BV1", "BV2", "BV1"} {
+		recordSentID("sent_videos.txt", bvid)
+	}
+	recordSentID("sent_comments.txt", "100")
+
+	var buf bytes.Buffer
+	counts, err := ExportSentIDs(&buf, DedupSetKinds())
+	if err != nil {
+		t.Fatalf("ExportSentIDs: %v", err)
+	}
+	if want := map[string]int{"account": 0, "comment": 1, "video": 3}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = %v, want %v", counts, want)
+	}
+
+	gz, _ := gzip.NewReader(bytes.NewReader(buf.Bytes()))
+	var text bytes.Buffer
+	text.ReadFrom(gz)
+	if want := "#kind account\n#kind comment\n100\n#kind video\nBV1\nBV2\nBV3\n"; text.String() != want {
+		t.Errorf("exported %q, want %q", text.String(), want)
+	}
+
+	// Merge into another host's records, which already have some IDs
+	setupTestDir(t)
+	recordSentID("sent_videos.txt", "BV2")
+	recordSentID("sent_videos.txt", "BV9")
+	added, err := ImportSentIDs(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportSentIDs: %v", err)
+	}
+	if want := map[string]int{"account": 0, "comment": 1, "video": 2}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	saved, _ := GetSavedVideoBvids()
+	if len(saved) != 4 {
+		t.Errorf("saved videos = %v, want BV1, BV2, BV3 and BV9", saved)
+	}
+
+	// Importing again adds nothing
+	added, _ = ImportSentIDs(bytes.NewReader(buf.Bytes()))
+	if added["video"] != 0 || added["comment"] != 0 {
+		t.Errorf("second import added %v, want nothing", added)
+	}
+}
+
+func TestImportSentIDs_Invalid(t *testing.T) {
+	setupTestDir(t)
+	gzipped := func(text string) *bytes.Buffer {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write([]byte(text))
+		gz.Close()
+		return &buf
+	}
+
+	for _, input := range []*bytes.Buffer{
+		bytes.NewBufferString("BV1\n"), // not gzipped
+		gzipped("BV1\n"),               // no section
+		gzipped("#kind danmaku\n1\n"),  // unknown kind
+	} {
+		if _, err := ImportSentIDs(input); err == nil {
+			t.Errorf("ImportSentIDs(%q) succeeded, want error", input.String())
+		}
+	}
+	if _, err := ExportSentIDs(&bytes.Buffer{}, []string{"danmaku"}); err == nil {
+		t.Error("Expected error for unknown kind")
+	}
+}
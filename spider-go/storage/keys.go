@@ -0,0 +1,60 @@
+package storage
+
+// messageKey returns the Kafka message key of a record of kind, or "" if the
+// record lacks the fields it is keyed by. userID gives the form user IDs take
+// in keys: publicID for a record about to be published, and the ID itself
+// for an exported record, whose IDs already have that form. The Save
+// functions and RecordKey both key records here, so a republished record
+// keeps the key it was first published with.
+func messageKey(kind string, record map[string]interface{}, userID func(string) string) string {
+	field := func(name string) string {
+		if v := record[name]; v != nil {
+			return scalarString(v)
+		}
+		return ""
+	}
+
+	switch kind {
+	case "video", "stat", "tombstone":
+		return field("bvid")
+	case "comment":
+		return field("rpid")
+	case "account":
+		if card, ok := record["card"].(map[string]interface{}); ok && card["mid"] != nil {
+			return userID(scalarString(card["mid"]))
+		}
+	case "dynamic":
+		return field("id_str")
+	case "relation":
+		if owner, mid := field("owner_mid"), field("mid"); owner != "" && mid != "" {
+			return userID(owner) + "_" + userID(mid)
+		}
+	case "favorite":
+		if owner, bvid := field("owner_mid"), field("bvid"); owner != "" && bvid != "" {
+			return userID(owner) + "_" + field("folder_id") + "_" + bvid
+		}
+	case "subtitle":
+		if bvid, cid, lan := field("bvid"), field("cid"), field("lan"); bvid != "" && cid != "" && lan != "" {
+			return bvid + ":" + cid + ":" + lan
+		}
+	case "danmaku":
+		return field("dmid")
+	case "article":
+		return field("id")
+	case "live":
+		if uid := field("uid"); uid != "" {
+			return userID(uid)
+		}
+	case "quarantine":
+		return field("key")
+	case "run_stats":
+		return field("run_id")
+	}
+	return ""
+}
+
+// sameID is the userID of messageKey for records whose IDs are already in
+// their published form
+func sameID(id string) string {
+	return id
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"plugin"
+)
+
+// MediaStore keeps downloaded media files such as covers and avatars under
+// slash-separated keys like "covers/<sha1>.jpg". DirMediaStore keeps them on
+// local disk; a media store plugin can put them into object storage.
+type MediaStore interface {
+	// Has reports whether something is stored under key
+	Has(key string) (bool, error)
+	// Put stores what r yields under key. If reading r fails nothing may
+	// be left under key.
+	Put(key string, r io.Reader) error
+}
+
+// DirMediaStore stores media files under a local directory
+type DirMediaStore string
+
+// Has reports whether the file for key exists
+func (d DirMediaStore) Has(key string) (bool, error) {
+	_, err := os.Stat(d.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put writes r to the file for key. The content goes to a temporary file
+// first so an interrupted download is never mistaken for a finished one.
+func (d DirMediaStore) Put(key string, r io.Reader) error {
+	target := d.path(key)
+	if err := EnsureDir(filepath.Dir(target)); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".download-*")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (d DirMediaStore) path(key string) string {
+	return filepath.Join(string(d), filepath.FromSlash(key))
+}
+
+// MediaStorePluginSymbol is the function a media store plugin exports to
+// create its store:
+//
+//	func NewMediaStore(options map[string]string) (storage.MediaStore, error)
+const MediaStorePluginSymbol = "NewMediaStore"
+
+// LoadMediaStorePlugin opens the Go plugin at path and creates its media
+// store with options
+func LoadMediaStorePlugin(path string, options map[string]string) (MediaStore, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(MediaStorePluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+	newStore, ok := sym.(func(map[string]string) (MediaStore, error))
+	if !ok {
+		return nil, fmt.Errorf("%s has type %T, expected func(map[string]string) (storage.MediaStore, error)", MediaStorePluginSymbol, sym)
+	}
+	s, err := newStore(options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", MediaStorePluginSymbol, err)
+	}
+	return s, nil
+}
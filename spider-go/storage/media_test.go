@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestDirMediaStore(t *testing.T) {
+	dir := t.TempDir()
+	store := DirMediaStore(dir)
+
+	if has, err := store.Has("covers/a.jpg"); has || err != nil {
+		t.Fatalf("Has = %v, %v before Put", has, err)
+	}
+	if err := store.Put("covers/a.jpg", strings.NewReader("image")); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if has, err := store.Has("covers/a.jpg"); !has || err != nil {
+		t.Errorf("Has = %v, %v after Put", has, err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "covers", "a.jpg"))
+	if string(data) != "image" {
+		t.Errorf("Stored file = %q", data)
+	}
+}
+
+func TestDirMediaStore_FailedReadLeavesNothing(t *testing.T) {
+	dir := t.TempDir()
+	store := DirMediaStore(dir)
+
+	r := io.MultiReader(strings.NewReader("part"), iotest.ErrReader(errors.New("connection reset")))
+	if err := store.Put("avatars/b.jpg", r); err == nil {
+		t.Fatal("Put should fail when the read fails")
+	}
+	entries, _ := os.ReadDir(filepath.Join(dir, "avatars"))
+	if len(entries) != 0 {
+		t.Errorf("A failed Put should leave no files, found %d", len(entries))
+	}
+}
+
+func TestLoadMediaStorePlugin_Missing(t *testing.T) {
+	if _, err := LoadMediaStorePlugin(filepath.Join(t.TempDir(), "missing.so"), nil); err == nil {
+		t.Error("Loading a missing plugin should fail")
+	}
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// SinkPluginSymbol is the function a sink plugin exports to create its sink:
+//
+//	func NewSink(options map[string]string) (storage.Sink, error)
+//
+// Plugins are built with `go build -buildmode=plugin` against the same
+// version of this module as the crawler binary.
+const SinkPluginSymbol = "NewSink"
+
+// LoadSinkPlugin opens the Go plugin at path and creates its sink with options
+func LoadSinkPlugin(path string, options map[string]string) (Sink, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(SinkPluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+	newSink, ok := sym.(func(map[string]string) (Sink, error))
+	if !ok {
+		return nil, fmt.Errorf("%s has type %T, expected func(map[string]string) (storage.Sink, error)", SinkPluginSymbol, sym)
+	}
+	s, err := newSink(options)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", SinkPluginSymbol, err)
+	}
+	return s, nil
+}
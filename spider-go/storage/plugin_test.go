@@ -0,0 +1,12 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSinkPlugin_Missing(t *testing.T) {
+	if _, err := LoadSinkPlugin(filepath.Join(t.TempDir(), "missing.so"), nil); err == nil {
+		t.Error("Loading a missing plugin should fail")
+	}
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// kindTopics maps each data kind to the Kafka topic that stores it
+var kindTopics = map[string]string{
+	"video":      kafkaTopicVideo,
+	"comment":    kafkaTopicComment,
+	"account":    kafkaTopicAccount,
+	"dynamic":    kafkaTopicDynamic,
+	"relation":   kafkaTopicRelation,
+	"favorite":   kafkaTopicFavorite,
+	"subtitle":   kafkaTopicSubtitle,
+	"danmaku":    kafkaTopicDanmaku,
+	"article":    kafkaTopicArticle,
+	"live":       kafkaTopicLive,
+	"stat":       kafkaTopicVideoStats,
+	"tombstone":  kafkaTopicTombstone,
+	"quarantine": kafkaTopicQuarantine,
+	"run_stats":  kafkaTopicRunStats,
+}
+
+// TopicFor returns the Kafka topic that stores the given data kind
+func TopicFor(kind string) (string, error) {
+	if topic, ok := kindTopics[kind]; ok {
+		return topic, nil
+	}
+
+	kinds := make([]string, 0, len(kindTopics))
+	for k := range kindTopics {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return "", fmt.Errorf("unknown data kind %q (expected one of %v)", kind, kinds)
+}
+
+// ReadTopic reads the messages of a topic and passes them to handle, one at a
+// time. With follow unset it reads from the beginning up to the offsets at
+// call time and returns; with follow set it keeps waiting for new messages
+// until ctx is cancelled, starting from the beginning only if fromStart is set.
+func ReadTopic(ctx context.Context, topic string, fromStart, follow bool, handle func(key, value []byte) error) error {
+	conn, err := kafka.DialContext(ctx, "tcp", kafkaBootstrapServers)
+	if err != nil {
+		return fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read partitions of %s: %w", topic, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var handleMu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make(chan error, len(partitions))
+
+	for _, p := range partitions {
+		wg.Add(1)
+		go func(partition int) {
+			defer wg.Done()
+			err := readPartition(ctx, topic, partition, fromStart, follow, func(m kafka.Message) error {
+				handleMu.Lock()
+				defer handleMu.Unlock()
+				return handle(m.Key, m.Value)
+			})
+			if err != nil && !errors.Is(err, context.Canceled) {
+				errs <- err
+				cancel()
+			}
+		}(p.ID)
+	}
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+// readPartition reads a single partition of a topic
+func readPartition(ctx context.Context, topic string, partition int, fromStart, follow bool, handle func(kafka.Message) error) error {
+	startOffset := kafka.LastOffset
+	if fromStart {
+		startOffset = kafka.FirstOffset
+	}
+
+	endOffset := int64(-1)
+	if !follow {
+		leader, err := kafka.DialLeader(ctx, "tcp", kafkaBootstrapServers, topic, partition)
+		if err != nil {
+			return fmt.Errorf("failed to connect to partition %d: %w", partition, err)
+		}
+		first, last, err := leader.ReadOffsets()
+		leader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read offsets of partition %d: %w", partition, err)
+		}
+		if !fromStart || last <= first {
+			return nil
+		}
+		endOffset = last
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   []string{kafkaBootstrapServers},
+		Topic:     topic,
+		Partition: partition,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+
+	if err := reader.SetOffset(startOffset); err != nil {
+		return err
+	}
+
+	for {
+		m, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return err
+		}
+		if err := handle(m); err != nil {
+			return err
+		}
+		if endOffset >= 0 && m.Offset+1 >= endOffset {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package storage
+
+import "testing"
+
+func TestTopicFor(t *testing.T) {
+	topic, err := TopicFor("comment")
+	if err != nil || topic != "claw_comment" {
+		t.Errorf("TopicFor(comment) = %q, %v", topic, err)
+	}
+	if _, err := TopicFor("unknown"); err == nil {
+		t.Error("Expected error for unknown kind")
+	}
+}
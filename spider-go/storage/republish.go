@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// RecordKey returns the message key a record of kind was published under,
+// read from the record as exported. The record must be decoded with
+// json.Decoder.UseNumber so that large IDs keep their digits.
+func RecordKey(kind string, record map[string]interface{}) (string, error) {
+	if _, err := TopicFor(kind); err != nil {
+		return "", err
+	}
+	key := messageKey(kind, record, sameID)
+	if key == "" {
+		return "", fmt.Errorf("%s record has no key fields", kind)
+	}
+	return key, nil
+}
+
+// Republish publishes the JSON Lines records of kind read from r, as written
+// by export, to topic through the sink (or Kafka). Each record is sent
+// unchanged under the key it was first published with, so that it lands in
+// the same partition as before. It returns the number of records published;
+// a line that is not a record of kind stops it with the line number.
+func Republish(r io.Reader, kind, topic string) (int, error) {
+	if _, err := TopicFor(kind); err != nil {
+		return 0, err
+	}
+
+	br := bufio.NewReader(r)
+	published := 0
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return published, fmt.Errorf("failed to read records: %w", err)
+		}
+		if value := bytes.TrimSpace(line); len(value) > 0 {
+			if err := republishLine(kind, topic, value); err != nil {
+				return published, fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			published++
+		}
+		if err != nil {
+			return published, nil
+		}
+	}
+}
+
+func republishLine(kind, topic string, value []byte) error {
+	var record map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(value))
+	dec.UseNumber()
+	if err := dec.Decode(&record); err != nil {
+		return fmt.Errorf("invalid record: %w", err)
+	}
+	key, err := RecordKey(kind, record)
+	if err != nil {
+		return err
+	}
+	return publish(topic, key, value)
+}
+
+// RepublishTopic publishes every message of topic from, the raw archive a
+// crawl wrote, to topic to through the sink (or Kafka), each unchanged under
+// the key it was stored with. It returns the number of messages published.
+func RepublishTopic(ctx context.Context, from, to string) (int, error) {
+	published := 0
+	err := ReadTopic(ctx, from, true, false, func(key, value []byte) error {
+		if err := publish(to, string(key), value); err != nil {
+			return err
+		}
+		published++
+		return nil
+	})
+	return published, err
+}
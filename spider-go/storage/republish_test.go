@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRepublish_KeepsKeys(t *testing.T) {
+	setupTestDir(t)
+	type message struct{ topic, key, value string }
+	var got []message
+	SetSink(SinkFunc(func(topic, key string, value []byte) error {
+		got = append(got, message{topic, key, string(value)})
+		return nil
+	}))
+	defer SetSink(nil)
+
+	// Save the records as a crawl would and keep what was published
+	saves := []struct {
+		kind string
+		save func() error
+	}{
+		{"video", func() error { return SaveVideo(map[string]interface{}{"bvid": "BV1xx"}) }},
+		{"comment", func() error {
+			return SaveComment(map[string]interface{}{"rpid": int64(987654321012345), "bvid": "BV1xx"})
+		}},
+		// Decoded API responses carry large IDs as float64
+		{"comment", func() error {
+			return SaveComment(map[string]interface{}{"rpid": float64(234567890123), "bvid": "BV1xx"})
+		}},
+		{"account", func() error { return SaveAccount(map[string]interface{}{"card": map[string]interface{}{"mid": "42"}}) }},
+		{"dynamic", func() error { return SaveDynamic(map[string]interface{}{"id_str": "900"}) }},
+		{"relation", func() error { return SaveRelation(map[string]interface{}{"owner_mid": int64(1), "mid": float64(2)}) }},
+		{"favorite", func() error {
+			return SaveFavorite(map[string]interface{}{"owner_mid": int64(1), "folder_id": int64(123456789012), "bvid": "BV1xx"})
+		}},
+		{"subtitle", func() error {
+			return SaveSubtitle(map[string]interface{}{"bvid": "BV1xx", "cid": int64(7), "lan": "zh-CN"})
+		}},
+		{"danmaku", func() error { return SaveDanmaku(map[string]interface{}{"dmid": "55"}) }},
+		{"article", func() error { return SaveArticle(map[string]interface{}{"id": int64(3)}) }},
+		{"live", func() error { return SaveLive(map[string]interface{}{"uid": float64(42)}) }},
+		{"stat", func() error { return SaveVideoStat(map[string]interface{}{"bvid": "BV1xx"}) }},
+		{"tombstone", func() error { return SaveTombstone(map[string]interface{}{"bvid": "BV1xx"}) }},
+	}
+	for _, s := range saves {
+		if err := s.save(); err != nil {
+			t.Fatalf("saving a %s failed: %v", s.kind, err)
+		}
+	}
+	if len(got) != len(saves) {
+		t.Fatalf("saved %d records, want %d", len(got), len(saves))
+	}
+	original := got
+	got = nil
+
+	for i, s := range saves {
+		n, err := Republish(strings.NewReader(original[i].value+"\n\n"), s.kind, "new_topic")
+		if err != nil || n != 1 {
+			t.Fatalf("Republish(%s) = %d, %v", s.kind, n, err)
+		}
+		if got[i].topic != "new_topic" || got[i].key != original[i].key || got[i].value != original[i].value {
+			t.Errorf("%s republished as %+v, want key %q and the original value", s.kind, got[i], original[i].key)
+		}
+	}
+}
+
+func TestRepublish_BadLine(t *testing.T) {
+	SetSink(SinkFunc(func(topic, key string, value []byte) error { return nil }))
+	defer SetSink(nil)
+
+	input := `{"bvid":"BV1"}` + "\n" + `{"title":"no bvid"}` + "\n" + `{"bvid":"BV2"}`
+	n, err := Republish(strings.NewReader(input), "video", kafkaTopicVideo)
+	if n != 1 || err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("Republish = %d, %v, want 1 and an error at line 2", n, err)
+	}
+
+	if _, err := Republish(strings.NewReader(""), "unknown", "t"); err == nil {
+		t.Error("Expected error for unknown kind")
+	}
+}
+
+func TestRecordKey(t *testing.T) {
+	var record map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(`{"owner_mid": 5, "folder_id": 123456789012, "bvid": "BV1"}`))
+	dec.UseNumber()
+	dec.Decode(&record)
+	if key, err := RecordKey("favorite", record); err != nil || key != "5_123456789012_BV1" {
+		t.Errorf("RecordKey(favorite) = %q, %v", key, err)
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// topicTemplate names the topic of a record with a topic_keyword, with
+// {topic} standing for the topic of its kind and {keyword} for the slug of
+// its keyword. Empty publishes every record to the topic of its kind.
+var topicTemplate string
+
+// topicNameRe matches the characters Kafka allows in a topic name
+var topicNameRe = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// maxTopicLen is the longest topic name Kafka accepts
+const maxTopicLen = 249
+
+// maxSlugLen caps the readable part of a keyword slug, so the hash after it
+// survives the cut to maxTopicLen
+const maxSlugLen = 200
+
+// CheckTopicTemplate reports whether tmpl is a usable topic template: it
+// must contain {keyword}, no other placeholders, and otherwise only the
+// characters Kafka allows in topic names
+func CheckTopicTemplate(tmpl string) error {
+	if !strings.Contains(tmpl, "{keyword}") {
+		return fmt.Errorf("topic template %q lacks {keyword}", tmpl)
+	}
+	name := strings.NewReplacer("{topic}", "t", "{keyword}", "k").Replace(tmpl)
+	if !topicNameRe.MatchString(name) {
+		return fmt.Errorf("topic template %q has unknown placeholders or characters other than letters, digits, '.', '_' and '-'", tmpl)
+	}
+	return nil
+}
+
+// SetTopicTemplate routes records that carry a topic_keyword to the topic
+// named by tmpl (see CheckTopicTemplate), or disables routing with "". It
+// must be called before anything is saved.
+func SetTopicTemplate(tmpl string) {
+	topicTemplate = tmpl
+}
+
+// RoutedTopic returns the topic a record of topic found under keyword is
+// published to with the template set
+func RoutedTopic(topic, keyword string) string {
+	if topicTemplate == "" || keyword == "" {
+		return topic
+	}
+	name := strings.NewReplacer("{topic}", topic, "{keyword}", KeywordSlug(keyword)).Replace(topicTemplate)
+	if len(name) > maxTopicLen {
+		name = name[:maxTopicLen]
+	}
+	return name
+}
+
+// routeTopic returns the topic a record of topic is published to
+func routeTopic(topic string, record map[string]interface{}) string {
+	keyword, _ := record["topic_keyword"].(string)
+	return RoutedTopic(topic, keyword)
+}
+
+// KeywordSlug turns a keyword into a string usable in topic names and paths:
+// ASCII letters and digits are kept in lower case, other characters outside
+// ASCII become u plus their hex code point (原神 is u539fu795e), and
+// anything else becomes '-'. A short hash of the keyword follows, so
+// keywords that read the same once slugged ("C++" and "C#") still differ.
+func KeywordSlug(keyword string) string {
+	keyword = strings.TrimSpace(keyword)
+	var b strings.Builder
+	for _, r := range keyword {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			b.WriteRune(unicode.ToLower(r))
+		case r > unicode.MaxASCII:
+			fmt.Fprintf(&b, "u%x", r)
+		default:
+			if s := b.String(); s != "" && !strings.HasSuffix(s, "-") {
+				b.WriteByte('-')
+			}
+		}
+	}
+	slug := b.String()
+	if len(slug) > maxSlugLen {
+		slug = slug[:maxSlugLen]
+	}
+	slug = strings.TrimSuffix(slug, "-")
+
+	h := fnv.New32a()
+	h.Write([]byte(keyword))
+	if slug == "" {
+		return fmt.Sprintf("%08x", h.Sum32())
+	}
+	return fmt.Sprintf("%s-%08x", slug, h.Sum32())
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeywordSlug(t *testing.T) {
+	tests := map[string]string{
+		"Minecraft":     "minecraft-1b592058",
+		"原神":            "u539fu795e-9ebf6a5b",
+		"Genshin 原神":    "genshin-u539fu795e-519011e1",
+		"  a/b  c!":     "a-b-c-6e622bcd",
+		"Apex Legends ": "apex-legends-e04c1253",
+		"C++":           "c-2ead0510",
+		"C#":            "c-95da4403",
+		"!!!":           "2d53a722",
+	}
+	for keyword, expected := range tests {
+		if got := KeywordSlug(keyword); got != expected {
+			t.Errorf("KeywordSlug(%q) = %q, expected %q", keyword, got, expected)
+		}
+	}
+}
+
+func TestRoutedTopic_LongKeyword(t *testing.T) {
+	SetTopicTemplate("{topic}.{keyword}")
+	defer SetTopicTemplate("")
+
+	long := strings.Repeat("原", 100)
+	a, b := RoutedTopic(kafkaTopicComment, long+"a"), RoutedTopic(kafkaTopicComment, long+"b")
+	if len(a) > maxTopicLen || len(b) > maxTopicLen {
+		t.Errorf("topic lengths %d and %d exceed %d", len(a), len(b), maxTopicLen)
+	}
+	if a == b {
+		t.Errorf("keywords differing past the slug cap share topic %q", a)
+	}
+}
+
+func TestCheckTopicTemplate(t *testing.T) {
+	for _, tmpl := range []string{"{topic}.{keyword}", "crawl-{keyword}_{topic}"} {
+		if err := CheckTopicTemplate(tmpl); err != nil {
+			t.Errorf("CheckTopicTemplate(%q) = %v, expected ok", tmpl, err)
+		}
+	}
+	for _, tmpl := range []string{"{topic}", "{topic}/{keyword}", "{kind}.{keyword}"} {
+		if err := CheckTopicTemplate(tmpl); err == nil {
+			t.Errorf("CheckTopicTemplate(%q) should fail", tmpl)
+		}
+	}
+}
+
+func TestSaveComment_RoutedTopic(t *testing.T) {
+	setupTestDir(t)
+	var topics []string
+	SetSink(SinkFunc(func(topic, key string, value []byte) error {
+		topics = append(topics, topic)
+		return nil
+	}))
+	defer SetSink(nil)
+	SetTopicTemplate("{topic}.{keyword}")
+	defer SetTopicTemplate("")
+
+	SaveComment(map[string]interface{}{"rpid": float64(1), "topic_keyword": "原神"})
+	SaveComment(map[string]interface{}{"rpid": float64(2)})
+	SaveAccount(map[string]interface{}{"card": map[string]interface{}{"mid": "3"}})
+
+	expected := []string{"claw_comment.u539fu795e-9ebf6a5b", kafkaTopicComment, kafkaTopicAccount}
+	if len(topics) != len(expected) {
+		t.Fatalf("topics = %v, expected %v", topics, expected)
+	}
+	for i := range expected {
+		if topics[i] != expected[i] {
+			t.Errorf("topics = %v, expected records without a keyword on their kind's topic: %v", topics, expected)
+			break
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// PublishRunStats publishes a run heartbeat or summary to claw_run_stats,
+// keyed by run ID so that every message of a run lands in one partition.
+// Run stats are not crawled data: they skip validation, anonymization and
+// the sent-record files.
+func PublishRunStats(runID string, message interface{}) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode run stats: %w", err)
+	}
+	return publish(kafkaTopicRunStats, runID, data)
+}
@@ -0,0 +1,30 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPublishRunStats(t *testing.T) {
+	var topic, key string
+	var value map[string]interface{}
+	SetSink(SinkFunc(func(tp, k string, v []byte) error {
+		topic, key = tp, k
+		return json.Unmarshal(v, &value)
+	}))
+	defer SetSink(nil)
+
+	if err := PublishRunStats("host-1", map[string]interface{}{"type": "heartbeat", "run_id": "host-1"}); err != nil {
+		t.Fatalf("PublishRunStats: %v", err)
+	}
+	if topic != "claw_run_stats" || key != "host-1" {
+		t.Errorf("published to %s under %q", topic, key)
+	}
+	if value["type"] != "heartbeat" || value["schema_version"] != nil {
+		t.Errorf("value = %v, want the message unchanged", value)
+	}
+
+	if k, err := RecordKey("run_stats", value); err != nil || k != "host-1" {
+		t.Errorf("RecordKey(run_stats) = %q, %v", k, err)
+	}
+}
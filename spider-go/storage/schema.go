@@ -0,0 +1,49 @@
+package storage
+
+// SchemaVersion is written as schema_version into every published record.
+//
+// Compatibility policy: adding fields to a record is compatible and keeps the
+// version. Removing or renaming a field listed in SchemaFields, or changing
+// its type, is a breaking change and requires bumping SchemaVersion and
+// recording the new field set in the schema tests. Fields passed through
+// from bilibili's API responses are not covered, since their shape is
+// outside the crawler's control.
+const SchemaVersion = 1
+
+// SchemaFields are the fields the crawler itself adds to each kind of record
+// (see TopicFor for the kinds) in the current schema version
+var SchemaFields = map[string][]string{
+	"video": {"topic_keyword"},
+	"comment": {
+		"bvid", "aid", "video_title", "root_rpid", "parent_rpid", "topic_keyword",
+		"emote_codes", "mentioned_mids", "jump_urls", "picture_urls",
+		"member_level", "vip_type", "vip_status", "is_vip",
+		"fan_medal_id", "fan_medal_name", "fan_medal_level",
+		"is_pinned", "up_liked", "up_replied", "comment_source",
+		"dynamic_id", "pinned_by",
+	},
+	"account": {
+		"member_level", "vip_type", "vip_status", "is_vip",
+		"discovered_as", "discovered_bvid", "discovered_rpid",
+	},
+	"favorite":  {"owner_mid", "folder_id", "folder_title", "bvid", "crawl_time"},
+	"relation":  {"owner_mid", "relation_type", "crawl_time"},
+	"subtitle":  {"bvid", "aid", "cid", "lan", "lan_doc", "ai_type", "subtitle_url", "topic_keyword", "body"},
+	"stat":      {"bvid", "aid", "snapshot_at", "view", "danmaku", "reply", "favorite", "coin", "share", "like"},
+	"tombstone": {"bvid", "status", "code", "message", "detected_at"},
+	"danmaku": {
+		"bvid", "aid", "cid", "topic_keyword", "dmid", "progress", "mode", "fontsize",
+		"color", "ctime", "pool", "mid_hash", "weight", "content",
+	},
+	"article": {"id", "topic_keyword", "category_name", "desc", "pub_time"},
+}
+
+// withSchemaVersion returns a shallow copy of record carrying schema_version
+func withSchemaVersion(record map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(record)+1)
+	for k, v := range record {
+		out[k] = v
+	}
+	out["schema_version"] = SchemaVersion
+	return out
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// schemaHistory freezes SchemaFields for every released schema version. A
+// field removed from SchemaFields without bumping SchemaVersion fails
+// TestSchemaFields_NoRemovals; after a bump, add the new version here.
+var schemaHistory = map[int]map[string][]string{
+	1: {
+		"video": {"topic_keyword"},
+		"comment": {
+			"bvid", "aid", "root_rpid", "parent_rpid", "topic_keyword",
+			"emote_codes", "mentioned_mids", "jump_urls", "picture_urls",
+			"member_level", "vip_type", "vip_status", "is_vip",
+			"fan_medal_id", "fan_medal_name", "fan_medal_level",
+			"is_pinned", "up_liked", "up_replied",
+		},
+		"account":   {"member_level", "vip_type", "vip_status", "is_vip"},
+		"favorite":  {"owner_mid", "folder_id", "folder_title", "bvid", "crawl_time"},
+		"relation":  {"owner_mid", "relation_type", "crawl_time"},
+		"subtitle":  {"bvid", "aid", "cid", "lan", "lan_doc", "ai_type", "subtitle_url", "topic_keyword", "body"},
+		"stat":      {"bvid", "aid", "snapshot_at", "view", "danmaku", "reply", "favorite", "coin", "share", "like"},
+		"tombstone": {"bvid", "status", "code", "message", "detected_at"},
+	},
+}
+
+func TestSchemaFields_NoRemovals(t *testing.T) {
+	frozen, ok := schemaHistory[SchemaVersion]
+	if !ok {
+		t.Fatalf("schema version %d has no entry in schemaHistory", SchemaVersion)
+	}
+	for kind, fields := range frozen {
+		current := make(map[string]bool)
+		for _, field := range SchemaFields[kind] {
+			current[field] = true
+		}
+		for _, field := range fields {
+			if !current[field] {
+				t.Errorf("%s.%s was removed without bumping SchemaVersion", kind, field)
+			}
+		}
+	}
+	for kind := range SchemaFields {
+		if _, err := TopicFor(kind); err != nil {
+			t.Errorf("SchemaFields has unknown kind %q", kind)
+		}
+	}
+}
+
+func TestEncodeRecord_SchemaVersion(t *testing.T) {
+	record := map[string]interface{}{"bvid": "BV1"}
+	data, err := encodeRecord(kafkaTopicVideo, "BV1", record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["schema_version"] != float64(SchemaVersion) {
+		t.Errorf("schema_version = %v, expected %d", out["schema_version"], SchemaVersion)
+	}
+	if _, ok := record["schema_version"]; ok {
+		t.Error("encodeRecord should not modify the record")
+	}
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Fsync policies for record files
+const (
+	FsyncNone   = "none"   // leave syncing to the OS
+	FsyncFlush  = "flush"  // fsync after every periodic flush
+	FsyncAlways = "always" // flush and fsync after every ID
+)
+
+// sentWriter is a buffered append handle on one record file
+type sentWriter struct {
+	file *os.File
+	buf  *bufio.Writer
+}
+
+func (w *sentWriter) flush(fsync bool) error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if fsync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+var (
+	sentMu            sync.Mutex
+	sentWriters       = make(map[string]*sentWriter) // by file path
+	sentFlushInterval time.Duration                  // 0 writes each ID through
+	sentFsync         = FsyncNone
+	sentFlusherStop   chan struct{}
+)
+
+// SetSentIDPolicy sets how record files are written: IDs are buffered and
+// flushed every interval (0 writes each ID through), and fsync is one of
+// FsyncNone, FsyncFlush or FsyncAlways. Pending IDs are flushed first.
+func SetSentIDPolicy(interval time.Duration, fsync string) error {
+	switch fsync {
+	case "":
+		fsync = FsyncNone
+	case FsyncNone, FsyncFlush, FsyncAlways:
+	default:
+		return fmt.Errorf("unknown fsync policy %q", fsync)
+	}
+	err := CloseSentIDs()
+
+	sentMu.Lock()
+	defer sentMu.Unlock()
+	sentFlushInterval = interval
+	sentFsync = fsync
+	return err
+}
+
+// recordSentID appends an ID to a record file
+func recordSentID(recordFile, idValue string) error {
+	sentMu.Lock()
+	defer sentMu.Unlock()
+
+	w, err := sentWriterFor(filepath.Join(recordDir, recordFile))
+	if err != nil {
+		return err
+	}
+	if _, err := w.buf.WriteString(idValue + "\n"); err != nil {
+		return err
+	}
+
+	switch {
+	case sentFsync == FsyncAlways:
+		return w.flush(true)
+	case sentFlushInterval <= 0:
+		return w.flush(sentFsync == FsyncFlush)
+	}
+	startSentFlusher()
+	return nil
+}
+
+// startSentFlusher starts the periodic flush unless it runs. Callers hold
+// sentMu.
+func startSentFlusher() {
+	if sentFlusherStop == nil {
+		sentFlusherStop = make(chan struct{})
+		go runSentFlusher(sentFlushInterval, sentFlusherStop)
+	}
+}
+
+// sentWriterFor returns the open writer for path, opening it on first use.
+// Callers hold sentMu.
+func sentWriterFor(path string) (*sentWriter, error) {
+	if w, ok := sentWriters[path]; ok {
+		return w, nil
+	}
+	if err := EnsureDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &sentWriter{file: f, buf: bufio.NewWriter(f)}
+	sentWriters[path] = w
+	return w, nil
+}
+
+// runSentFlusher flushes every record file each interval until stop closes
+func runSentFlusher(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			FlushSentIDs()
+		}
+	}
+}
+
+// FlushSentIDs writes buffered IDs of every record file, syncing them unless
+// the fsync policy is FsyncNone, and the pending reply progress
+func FlushSentIDs() error {
+	errs := []error{flushSentWriters()}
+	if err := flushReplyProgress(false); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", replyProgressFile, err))
+	}
+	return errors.Join(errs...)
+}
+
+func flushSentWriters() error {
+	sentMu.Lock()
+	defer sentMu.Unlock()
+
+	var errs []error
+	for path, w := range sentWriters {
+		if err := w.flush(sentFsync != FsyncNone); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// flushSentFile writes the buffered IDs of one record file before it is read
+func flushSentFile(path string) error {
+	sentMu.Lock()
+	defer sentMu.Unlock()
+	if w, ok := sentWriters[path]; ok {
+		return w.flush(false)
+	}
+	return nil
+}
+
+// closeSentFile flushes and closes one record file before it is replaced
+func closeSentFile(path string) error {
+	sentMu.Lock()
+	defer sentMu.Unlock()
+	w, ok := sentWriters[path]
+	if !ok {
+		return nil
+	}
+	delete(sentWriters, path)
+	err := w.flush(sentFsync != FsyncNone)
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// CloseSentIDs flushes, syncs and closes every record file, writes the
+// pending reply progress and stops the periodic flush. Record files reopen
+// on the next write.
+func CloseSentIDs() error {
+	errs := []error{closeSentWriters()}
+	if err := flushReplyProgress(true); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %w", replyProgressFile, err))
+	}
+	return errors.Join(errs...)
+}
+
+func closeSentWriters() error {
+	sentMu.Lock()
+	defer sentMu.Unlock()
+
+	if sentFlusherStop != nil {
+		close(sentFlusherStop)
+		sentFlusherStop = nil
+	}
+	var errs []error
+	for path, w := range sentWriters {
+		err := w.flush(true)
+		if closeErr := w.file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		}
+	}
+	sentWriters = make(map[string]*sentWriter)
+	return errors.Join(errs...)
+}
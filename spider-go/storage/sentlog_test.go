@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useSentIDPolicy sets a record file policy for one test
+func useSentIDPolicy(t *testing.T, interval time.Duration, fsync string) {
+	t.Helper()
+	if err := SetSentIDPolicy(interval, fsync); err != nil {
+		t.Fatalf("SetSentIDPolicy failed: %v", err)
+	}
+	t.Cleanup(func() { SetSentIDPolicy(0, FsyncNone) })
+}
+
+func TestRecordSentID_Buffered(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	useSentIDPolicy(t, time.Hour, FsyncFlush)
+
+	recordSentID("test.txt", "id1")
+	recordSentID("test.txt", "id2")
+
+	if content, _ := os.ReadFile(filepath.Join(tmpDir, "test.txt")); len(content) != 0 {
+		t.Errorf("File content = %q, expected IDs to stay buffered", content)
+	}
+
+	// Readers in this process see buffered IDs
+	ids, err := loadSentIDs("test.txt")
+	if err != nil || len(ids) != 2 {
+		t.Errorf("loadSentIDs = %v, %v, expected 2 IDs", ids, err)
+	}
+
+	recordSentID("test.txt", "id3")
+	if err := CloseSentIDs(); err != nil {
+		t.Fatalf("CloseSentIDs failed: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(tmpDir, "test.txt")); string(content) != "id1\nid2\nid3\n" {
+		t.Errorf("File content = %q after close", content)
+	}
+}
+
+func TestRecordSentID_PeriodicFlush(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	useSentIDPolicy(t, 10*time.Millisecond, FsyncNone)
+
+	recordSentID("test.txt", "id1")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		content, _ := os.ReadFile(filepath.Join(tmpDir, "test.txt"))
+		if string(content) == "id1\n" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("File content = %q, expected the flusher to write id1", content)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRecordSentID_FsyncAlways(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	useSentIDPolicy(t, time.Hour, FsyncAlways)
+
+	recordSentID("test.txt", "id1")
+	if content, _ := os.ReadFile(filepath.Join(tmpDir, "test.txt")); string(content) != "id1\n" {
+		t.Errorf("File content = %q, expected always to write each ID", content)
+	}
+}
+
+func TestUpdatePendingMids_Buffered(t *testing.T) {
+	setupTestDir(t)
+	useSentIDPolicy(t, time.Hour, FsyncNone)
+
+	SavePendingMid("1", MidSource{})
+	SavePendingMid("2", MidSource{})
+	if err := UpdatePendingMids(map[string]MidSource{"2": {}}); err != nil {
+		t.Fatalf("UpdatePendingMids failed: %v", err)
+	}
+	SavePendingMid("3", MidSource{})
+	CloseSentIDs()
+
+	mids, _ := GetPendingMids()
+	if _, ok := mids["1"]; ok || len(mids) != 2 {
+		t.Errorf("Pending MIDs = %v, expected 2 and 3", mids)
+	}
+}
+
+func TestSetSentIDPolicy_Invalid(t *testing.T) {
+	if err := SetSentIDPolicy(time.Second, "sometimes"); err == nil {
+		t.Error("An unknown fsync policy should be rejected")
+	}
+}
+
+func TestReplyProgress_Buffered(t *testing.T) {
+	tmpDir := setupTestDir(t)
+	useSentIDPolicy(t, time.Hour, FsyncNone)
+	path := filepath.Join(tmpDir, replyProgressFile)
+
+	SaveReplyProgress(100, ReplyProgress{Page: 1, Fetched: 20})
+	SaveReplyProgress(100, ReplyProgress{Page: 2, Fetched: 40})
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Stat = %v, expected progress to stay buffered", err)
+	}
+	if progress, ok, _ := GetReplyProgress(100); !ok || progress.Page != 2 {
+		t.Errorf("GetReplyProgress = %+v, %v, expected the buffered page", progress, ok)
+	}
+
+	if err := FlushSentIDs(); err != nil {
+		t.Fatalf("FlushSentIDs failed: %v", err)
+	}
+	if content, _ := os.ReadFile(path); !strings.Contains(string(content), `"page": 2`) {
+		t.Errorf("File content = %q after flush", content)
+	}
+
+	ClearReplyProgress(100)
+	if err := CloseSentIDs(); err != nil {
+		t.Fatalf("CloseSentIDs failed: %v", err)
+	}
+	if content, _ := os.ReadFile(path); strings.Contains(string(content), "100") {
+		t.Errorf("File content = %q, expected the cleared progress written on close", content)
+	}
+}
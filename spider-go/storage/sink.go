@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Sink receives encoded records in place of Kafka, e.g. when the crawler is
+// embedded in another program
+type Sink interface {
+	Publish(topic, key string, value []byte) error
+}
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(topic, key string, value []byte) error
+
+// Publish calls f
+func (f SinkFunc) Publish(topic, key string, value []byte) error {
+	return f(topic, key, value)
+}
+
+// KafkaSink publishes to the Kafka producer, for combining Kafka with other
+// sinks in a MultiSink
+var KafkaSink Sink = SinkFunc(publishKafka)
+
+// MultiSink publishes every record to each of its sinks in turn
+type MultiSink []Sink
+
+// Publish sends the record to every sink and joins their errors
+func (m MultiSink) Publish(topic, key string, value []byte) error {
+	var errs []error
+	for _, s := range m {
+		if err := s.Publish(topic, key, value); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every sink that implements io.Closer
+func (m MultiSink) Close() error {
+	var errs []error
+	for _, s := range m {
+		if closer, ok := s.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// sink replaces the Kafka producer when set
+var sink Sink
+
+// SetSink routes every saved record to s instead of Kafka; nil restores
+// Kafka. It must be called before anything is saved.
+func SetSink(s Sink) {
+	sink = s
+}
+
+// CloseSink closes the sink if it implements io.Closer, flushing sinks that
+// buffer records
+func CloseSink() error {
+	if closer, ok := sink.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// publish sends an encoded record to the sink or, without one, to Kafka
+func publish(topic, key string, value []byte) error {
+	if sink != nil {
+		return sink.Publish(topic, key, value)
+	}
+	return publishKafka(topic, key, value)
+}
+
+// publishKafka sends an encoded record to the Kafka producer
+func publishKafka(topic, key string, value []byte) error {
+	return GetProducer().WriteMessages(context.Background(), kafka.Message{
+		Topic: topic,
+		Key:   []byte(key),
+		Value: value,
+	})
+}
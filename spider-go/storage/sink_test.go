@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetSink(t *testing.T) {
+	setupTestDir(t)
+	type message struct {
+		topic, key string
+		value      []byte
+	}
+	var got []message
+	SetSink(SinkFunc(func(topic, key string, value []byte) error {
+		got = append(got, message{topic, key, value})
+		return nil
+	}))
+	defer SetSink(nil)
+
+	if err := SaveVideo(map[string]interface{}{"bvid": "BV1xx"}); err != nil {
+		t.Fatalf("SaveVideo: %v", err)
+	}
+	if len(got) != 1 || got[0].topic != kafkaTopicVideo || got[0].key != "BV1xx" {
+		t.Fatalf("sink received %+v", got)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(got[0].value, &record); err != nil || record["bvid"] != "BV1xx" {
+		t.Errorf("sink value = %s (%v)", got[0].value, err)
+	}
+
+	saved, err := GetSavedVideoBvids()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := saved["BV1xx"]; !ok {
+		t.Error("a video published to the sink should still be recorded as sent")
+	}
+}
+
+// closingSink counts published records and Close calls
+type closingSink struct {
+	published, closed int
+	err               error
+}
+
+func (s *closingSink) Publish(topic, key string, value []byte) error {
+	s.published++
+	return s.err
+}
+
+func (s *closingSink) Close() error {
+	s.closed++
+	return nil
+}
+
+func TestMultiSink(t *testing.T) {
+	ok := &closingSink{}
+	failing := &closingSink{err: errors.New("down")}
+	multi := MultiSink{failing, ok, SinkFunc(func(topic, key string, value []byte) error { return nil })}
+
+	err := multi.Publish("claw_video", "BV1", []byte("{}"))
+	if err == nil || !strings.Contains(err.Error(), "down") {
+		t.Errorf("Publish error = %v, expected the failing sink's error", err)
+	}
+	if failing.published != 1 || ok.published != 1 {
+		t.Error("A failing sink should not stop the others")
+	}
+
+	SetSink(multi)
+	defer SetSink(nil)
+	if err := CloseSink(); err != nil {
+		t.Fatal(err)
+	}
+	if ok.closed != 1 || failing.closed != 1 {
+		t.Error("CloseSink should close every closable sink")
+	}
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry names inside a state archive
+const (
+	stateCookieEntry = "cookies.json"
+	stateRecordDir   = "sent_records"
+)
+
+// readStable reads a state file that a running crawler may be writing.
+// Record files are cut after their last complete line and JSON files are
+// re-read until they parse.
+func readStable(file string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		switch filepath.Ext(file) {
+		case ".json":
+			if json.Valid(data) || attempt >= 10 {
+				return data, nil
+			}
+			time.Sleep(50 * time.Millisecond)
+		case ".txt":
+			return data[:bytes.LastIndexByte(data, '\n')+1], nil
+		default:
+			return data, nil
+		}
+	}
+}
+
+// ExportState writes the record directory (sent records, progress, pending
+// MIDs, failed tasks) and the cookie config to w as a gzipped tar archive.
+// It returns the archived entry names.
+func ExportState(w io.Writer, cookiePath string) ([]string, error) {
+	files := make(map[string]string)
+	if err := FlushSentIDs(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(recordDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			files[path.Join(stateRecordDir, entry.Name())] = filepath.Join(recordDir, entry.Name())
+		}
+	}
+	if cookiePath != "" {
+		if _, err := os.Stat(cookiePath); err == nil {
+			files[stateCookieEntry] = cookiePath
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, name := range names {
+		data, err := readStable(files[name])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", files[name], err)
+		}
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return names, gz.Close()
+}
+
+// stateTarget maps an archive entry to the file it restores, rejecting
+// entries outside the record directory and cookie config
+func stateTarget(name, cookiePath string) (string, error) {
+	if name == stateCookieEntry {
+		if cookiePath == "" {
+			return "", fmt.Errorf("archive contains %s but no cookie config path is set", name)
+		}
+		return cookiePath, nil
+	}
+
+	dir, base := path.Split(name)
+	if dir != stateRecordDir+"/" || base == "" || base == "." || base == ".." {
+		return "", fmt.Errorf("unexpected archive entry %q", name)
+	}
+	return filepath.Join(recordDir, base), nil
+}
+
+// ImportState restores an archive written by ExportState into the record
+// directory and cookie config. Existing files are only replaced with force;
+// otherwise nothing is written if any target exists. It returns the restored
+// file paths.
+func ImportState(r io.Reader, cookiePath string, force bool) ([]string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state archive: %w", err)
+	}
+	defer gz.Close()
+
+	contents := make(map[string][]byte)
+	var targets []string
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid state archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		target, err := stateTarget(header.Name, cookiePath)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid state archive: %w", err)
+		}
+		if _, seen := contents[target]; !seen {
+			targets = append(targets, target)
+		}
+		contents[target] = data
+	}
+
+	if !force {
+		var existing []string
+		for _, target := range targets {
+			if _, err := os.Stat(target); err == nil {
+				existing = append(existing, target)
+			}
+		}
+		if len(existing) > 0 {
+			return nil, fmt.Errorf("refusing to overwrite existing files: %s", strings.Join(existing, ", "))
+		}
+	}
+
+	if err := EnsureDir(recordDir); err != nil {
+		return nil, err
+	}
+	for _, target := range targets {
+		if err := closeSentFile(target); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, contents[target], 0644); err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportImportState(t *testing.T) {
+	src := setupTestDir(t)
+	cookiePath := filepath.Join(t.TempDir(), "cookies.json")
+	os.WriteFile(cookiePath, []byte(`{"cookies": []}`), 0644)
+
+	recordSentID("sent_videos.txt", "BV1")
+	SavePendingMid("42", MidSource{})
+	SaveVideoCommentProgress("BV1", "cursor", 1, "")
+	// A partially written record line is left out
+	f, _ := os.OpenFile(filepath.Join(src, "sent_videos.txt"), os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("BV2")
+	f.Close()
+
+	var archive bytes.Buffer
+	names, err := ExportState(&archive, cookiePath)
+	if err != nil {
+		t.Fatalf("ExportState failed: %v", err)
+	}
+	expected := []string{"cookies.json", "sent_records/pending_mids.txt", "sent_records/sent_videos.txt", "sent_records/" + progressFile}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Exported %v, expected %v", names, expected)
+	}
+
+	dst := setupTestDir(t)
+	newCookiePath := filepath.Join(t.TempDir(), "cookies.json")
+	restored, err := ImportState(bytes.NewReader(archive.Bytes()), newCookiePath, false)
+	if err != nil {
+		t.Fatalf("ImportState failed: %v", err)
+	}
+	if len(restored) != 4 {
+		t.Errorf("Restored %v, expected 4 files", restored)
+	}
+
+	bvids, _ := GetSavedVideoBvids()
+	if _, ok := bvids["BV1"]; !ok || len(bvids) != 1 {
+		t.Errorf("Restored BVIDs = %v, expected only BV1", bvids)
+	}
+	if p, _ := GetVideoCommentProgress("BV1"); p == nil || p.Cursor != "cursor" {
+		t.Errorf("Restored progress = %+v", p)
+	}
+	if data, _ := os.ReadFile(newCookiePath); string(data) != `{"cookies": []}` {
+		t.Errorf("Restored cookies = %q", data)
+	}
+
+	// Existing files are kept unless forced
+	_, err = ImportState(bytes.NewReader(archive.Bytes()), newCookiePath, false)
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(dst, "pending_mids.txt")) {
+		t.Errorf("Expected overwrite error, got %v", err)
+	}
+	if _, err := ImportState(bytes.NewReader(archive.Bytes()), newCookiePath, true); err != nil {
+		t.Errorf("Forced import failed: %v", err)
+	}
+}
+
+func TestImportState_RejectsUnexpectedEntries(t *testing.T) {
+	setupTestDir(t)
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "sent_records/../../evil.txt", Mode: 0644, Size: 1})
+	tw.Write([]byte("x"))
+	tw.Close()
+	gz.Close()
+
+	if _, err := ImportState(&archive, "", false); err == nil {
+		t.Error("Expected error for an entry outside the record directory")
+	}
+}
@@ -2,12 +2,15 @@ package storage
 
 import (
 	"bufio"
-	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/segmentio/kafka-go"
 )
@@ -17,14 +20,31 @@ var (
 	kafkaTopicVideo       = "claw_video"
 	kafkaTopicComment     = "claw_comment"
 	kafkaTopicAccount     = "claw_account"
+	kafkaTopicDynamic     = "claw_dynamic"
+	kafkaTopicRelation    = "claw_relation"
+	kafkaTopicFavorite    = "claw_favorite"
+	kafkaTopicSubtitle    = "claw_subtitle"
+	kafkaTopicDanmaku     = "claw_danmaku"
+	kafkaTopicArticle     = "claw_article"
+	kafkaTopicLive        = "claw_live"
+	kafkaTopicVideoStats  = "claw_video_stats"
+	kafkaTopicTombstone   = "claw_tombstone"
+	kafkaTopicQuarantine  = "claw_quarantine"
+	kafkaTopicRunStats    = "claw_run_stats"
 
-	recordDir    = "sent_records"
-	progressFile = "video_comment_progress.json"
+	recordDir          = "sent_records"
+	progressFile       = "video_comment_progress.json"
+	searchProgressFile = "search_progress.json"
+	failedTasksFile    = "failed_tasks.json"
+	replyProgressFile  = "reply_progress.json"
 
-	progressMu   sync.Mutex
-	producerMu   sync.Mutex
-	producer     *kafka.Writer
-	producerOnce sync.Once
+	progressMu       sync.Mutex
+	searchProgressMu sync.Mutex
+	failedTasksMu    sync.Mutex
+	replyProgressMu  sync.Mutex
+	producerMu       sync.Mutex
+	producer         *kafka.Writer
+	producerOnce     sync.Once
 )
 
 func getEnv(key, defaultValue string) string {
@@ -40,6 +60,8 @@ func GetProducer() *kafka.Writer {
 		producer = &kafka.Writer{
 			Addr:     kafka.TCP(kafkaBootstrapServers),
 			Balancer: &kafka.LeastBytes{},
+			// Routed topics are named at runtime, so let the broker create them
+			AllowAutoTopicCreation: topicTemplate != "",
 		}
 	})
 	return producer
@@ -62,44 +84,41 @@ func EnsureDir(dirPath string) error {
 	return os.MkdirAll(dirPath, 0755)
 }
 
-// recordSentID appends an ID to a record file
-func recordSentID(recordFile, idValue string) error {
-	if err := EnsureDir(recordDir); err != nil {
-		return err
-	}
-	filepath := filepath.Join(recordDir, recordFile)
-	f, err := os.OpenFile(filepath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-	_, err = f.WriteString(idValue + "\n")
-	return err
-}
-
 // loadSentIDs loads all IDs from a record file
 func loadSentIDs(recordFile string) (map[string]struct{}, error) {
-	filepath := filepath.Join(recordDir, recordFile)
 	ids := make(map[string]struct{})
+	err := scanSentIDs(recordFile, func(id string) {
+		ids[id] = struct{}{}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
 
-	f, err := os.Open(filepath)
+// scanSentIDs passes every ID in a record file to fn without holding them
+// all in memory
+func scanSentIDs(recordFile string, fn func(id string)) error {
+	path := filepath.Join(recordDir, recordFile)
+	if err := flushSentFile(path); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
 	if os.IsNotExist(err) {
-		return ids, nil
+		return nil
 	}
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer f.Close()
 
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
-		line := scanner.Text()
-		if line != "" {
-			ids[line] = struct{}{}
+		if line := scanner.Text(); line != "" {
+			fn(line)
 		}
 	}
-
-	return ids, scanner.Err()
+	return scanner.Err()
 }
 
 // SaveVideo saves a video to Kafka and records its BVID
@@ -109,17 +128,13 @@ func SaveVideo(video map[string]interface{}) error {
 		return fmt.Errorf("video has no bvid")
 	}
 
-	data, err := json.Marshal(video)
+	key := messageKey("video", video, publicID)
+	data, err := encodeRecord(kafkaTopicVideo, key, video)
 	if err != nil {
 		return err
 	}
 
-	producer := GetProducer()
-	err = producer.WriteMessages(context.Background(), kafka.Message{
-		Topic: kafkaTopicVideo,
-		Key:   []byte(bvid),
-		Value: data,
-	})
+	err = publish(routeTopic(kafkaTopicVideo, video), key, data)
 	if err != nil {
 		return err
 	}
@@ -135,18 +150,14 @@ func SaveComment(comment map[string]interface{}) error {
 	}
 
 	rpidStr := fmt.Sprintf("%v", rpid)
+	key := messageKey("comment", comment, publicID)
 
-	data, err := json.Marshal(comment)
+	data, err := encodeRecord(kafkaTopicComment, key, comment)
 	if err != nil {
 		return err
 	}
 
-	producer := GetProducer()
-	err = producer.WriteMessages(context.Background(), kafka.Message{
-		Topic: kafkaTopicComment,
-		Key:   []byte(rpidStr),
-		Value: data,
-	})
+	err = publish(routeTopic(kafkaTopicComment, comment), key, data)
 	if err != nil {
 		return err
 	}
@@ -167,18 +178,14 @@ func SaveAccount(account map[string]interface{}) error {
 	}
 
 	midStr := fmt.Sprintf("%v", mid)
+	key := messageKey("account", account, publicID)
 
-	data, err := json.Marshal(account)
+	data, err := encodeRecord(kafkaTopicAccount, key, account)
 	if err != nil {
 		return err
 	}
 
-	producer := GetProducer()
-	err = producer.WriteMessages(context.Background(), kafka.Message{
-		Topic: kafkaTopicAccount,
-		Key:   []byte(midStr),
-		Value: data,
-	})
+	err = publish(routeTopic(kafkaTopicAccount, account), key, data)
 	if err != nil {
 		return err
 	}
@@ -186,6 +193,206 @@ func SaveAccount(account map[string]interface{}) error {
 	return recordSentID("sent_accounts.txt", midStr)
 }
 
+// SaveDynamic saves a user dynamic to Kafka and records its ID
+func SaveDynamic(dynamic map[string]interface{}) error {
+	id, ok := dynamic["id_str"].(string)
+	if !ok || id == "" {
+		return fmt.Errorf("dynamic has no id_str")
+	}
+
+	key := messageKey("dynamic", dynamic, publicID)
+	data, err := encodeRecord(kafkaTopicDynamic, key, dynamic)
+	if err != nil {
+		return err
+	}
+
+	err = publish(routeTopic(kafkaTopicDynamic, dynamic), key, data)
+	if err != nil {
+		return err
+	}
+
+	return recordSentID("sent_dynamics.txt", id)
+}
+
+// SaveRelation saves a follower/following edge to Kafka
+func SaveRelation(relation map[string]interface{}) error {
+	ownerMid := relation["owner_mid"]
+	targetMid := relation["mid"]
+	if ownerMid == nil || targetMid == nil {
+		return fmt.Errorf("relation has no owner_mid or mid")
+	}
+
+	key := messageKey("relation", relation, publicID)
+
+	data, err := encodeRecord(kafkaTopicRelation, key, relation)
+	if err != nil {
+		return err
+	}
+
+	return publish(routeTopic(kafkaTopicRelation, relation), key, data)
+}
+
+// SaveFavorite saves a video in a user's public favorite folder to Kafka
+func SaveFavorite(favorite map[string]interface{}) error {
+	ownerMid := favorite["owner_mid"]
+	bvid, _ := favorite["bvid"].(string)
+	if ownerMid == nil || bvid == "" {
+		return fmt.Errorf("favorite has no owner_mid or bvid")
+	}
+
+	key := messageKey("favorite", favorite, publicID)
+
+	data, err := encodeRecord(kafkaTopicFavorite, key, favorite)
+	if err != nil {
+		return err
+	}
+
+	return publish(routeTopic(kafkaTopicFavorite, favorite), key, data)
+}
+
+// SubtitleID identifies one subtitle track of a video page
+func SubtitleID(bvid string, cid int64, lan string) string {
+	return fmt.Sprintf("%s:%d:%s", bvid, cid, lan)
+}
+
+// SaveSubtitle saves a subtitle track to Kafka and records its ID
+func SaveSubtitle(subtitle map[string]interface{}) error {
+	bvid, _ := subtitle["bvid"].(string)
+	cid, _ := subtitle["cid"].(int64)
+	lan, _ := subtitle["lan"].(string)
+	if bvid == "" || cid == 0 || lan == "" {
+		return fmt.Errorf("subtitle has no bvid, cid or lan")
+	}
+	id := SubtitleID(bvid, cid, lan)
+	key := messageKey("subtitle", subtitle, publicID)
+
+	data, err := encodeRecord(kafkaTopicSubtitle, key, subtitle)
+	if err != nil {
+		return err
+	}
+
+	err = publish(routeTopic(kafkaTopicSubtitle, subtitle), key, data)
+	if err != nil {
+		return err
+	}
+
+	return recordSentID("sent_subtitles.txt", id)
+}
+
+// SaveDanmaku saves one danmaku of a video page to Kafka. A page's danmaku
+// are recorded as a whole with MarkDanmakuCrawled, not one by one.
+func SaveDanmaku(danmaku map[string]interface{}) error {
+	dmid, ok := danmaku["dmid"].(string)
+	if !ok || dmid == "" {
+		return fmt.Errorf("danmaku has no dmid")
+	}
+
+	key := messageKey("danmaku", danmaku, publicID)
+	data, err := encodeRecord(kafkaTopicDanmaku, key, danmaku)
+	if err != nil {
+		return err
+	}
+
+	return publish(routeTopic(kafkaTopicDanmaku, danmaku), key, data)
+}
+
+// MarkDanmakuCrawled records that the danmaku of a video page were saved
+func MarkDanmakuCrawled(cid int64) error {
+	return recordSentID("sent_danmaku_cids.txt", strconv.FormatInt(cid, 10))
+}
+
+// SaveArticle saves an article (专栏) to Kafka and records its cv number
+func SaveArticle(article map[string]interface{}) error {
+	id, ok := article["id"].(int64)
+	if !ok || id == 0 {
+		return fmt.Errorf("article has no id")
+	}
+	idStr := messageKey("article", article, publicID)
+
+	data, err := encodeRecord(kafkaTopicArticle, idStr, article)
+	if err != nil {
+		return err
+	}
+
+	err = publish(routeTopic(kafkaTopicArticle, article), idStr, data)
+	if err != nil {
+		return err
+	}
+
+	return recordSentID("sent_articles.txt", idStr)
+}
+
+// SaveVideoStat saves a point-in-time stat record of a video to Kafka. Stat
+// records form a time series, so none are recorded as sent.
+func SaveVideoStat(stat map[string]interface{}) error {
+	bvid, ok := stat["bvid"].(string)
+	if !ok || bvid == "" {
+		return fmt.Errorf("video stat has no bvid")
+	}
+
+	key := messageKey("stat", stat, publicID)
+	data, err := encodeRecord(kafkaTopicVideoStats, key, stat)
+	if err != nil {
+		return err
+	}
+
+	return publish(routeTopic(kafkaTopicVideoStats, stat), key, data)
+}
+
+// SaveTombstone saves a record marking a saved video as deleted or blocked
+// to Kafka and records its BVID
+func SaveTombstone(tombstone map[string]interface{}) error {
+	bvid, ok := tombstone["bvid"].(string)
+	if !ok || bvid == "" {
+		return fmt.Errorf("tombstone has no bvid")
+	}
+
+	key := messageKey("tombstone", tombstone, publicID)
+	data, err := encodeRecord(kafkaTopicTombstone, key, tombstone)
+	if err != nil {
+		return err
+	}
+
+	err = publish(routeTopic(kafkaTopicTombstone, tombstone), key, data)
+	if err != nil {
+		return err
+	}
+
+	return recordSentID("sent_tombstones.txt", bvid)
+}
+
+// SaveLive saves a user's live room info to Kafka and records the user's MID
+func SaveLive(live map[string]interface{}) error {
+	uid, ok := live["uid"].(float64)
+	if !ok || uid == 0 {
+		return fmt.Errorf("live room has no uid")
+	}
+	midStr := strconv.FormatInt(int64(uid), 10)
+	key := messageKey("live", live, publicID)
+
+	data, err := encodeRecord(kafkaTopicLive, key, live)
+	if err != nil {
+		return err
+	}
+
+	err = publish(routeTopic(kafkaTopicLive, live), key, data)
+	if err != nil {
+		return err
+	}
+
+	return recordSentID("sent_live_mids.txt", midStr)
+}
+
+// MarkRelationsDone records that a user's relations have been crawled
+func MarkRelationsDone(mid string) error {
+	return recordSentID("sent_relation_mids.txt", mid)
+}
+
+// MarkFavoritesDone records that a user's favorites have been crawled
+func MarkFavoritesDone(mid string) error {
+	return recordSentID("sent_favorite_mids.txt", mid)
+}
+
 // GetSavedVideoBvids returns all saved video BVIDs
 func GetSavedVideoBvids() (map[string]struct{}, error) {
 	return loadSentIDs("sent_videos.txt")
@@ -201,23 +408,192 @@ func GetSavedAccountMids() (map[string]struct{}, error) {
 	return loadSentIDs("sent_accounts.txt")
 }
 
-// SavePendingMid saves a pending MID
-func SavePendingMid(mid string) error {
-	return recordSentID("pending_mids.txt", mid)
+// EachSavedVideoBvid passes every saved video BVID to fn
+func EachSavedVideoBvid(fn func(bvid string)) error {
+	return scanSentIDs("sent_videos.txt", fn)
+}
+
+// EachSavedCommentRpid passes every saved comment RPID to fn
+func EachSavedCommentRpid(fn func(rpid string)) error {
+	return scanSentIDs("sent_comments.txt", fn)
+}
+
+// EachSavedAccountMid passes every saved account MID to fn
+func EachSavedAccountMid(fn func(mid string)) error {
+	return scanSentIDs("sent_accounts.txt", fn)
+}
+
+// GetSavedDynamicIDs returns all saved dynamic IDs
+func GetSavedDynamicIDs() (map[string]struct{}, error) {
+	return loadSentIDs("sent_dynamics.txt")
+}
+
+// GetSavedSubtitleIDs returns the IDs of all saved subtitle tracks
+func GetSavedSubtitleIDs() (map[string]struct{}, error) {
+	return loadSentIDs("sent_subtitles.txt")
+}
+
+// GetDanmakuCids returns the cids of the video pages whose danmaku were saved
+func GetDanmakuCids() (map[string]struct{}, error) {
+	return loadSentIDs("sent_danmaku_cids.txt")
+}
+
+// GetSavedArticleIDs returns the cv numbers of all saved articles
+func GetSavedArticleIDs() (map[string]struct{}, error) {
+	return loadSentIDs("sent_articles.txt")
+}
+
+// GetTombstonedBvids returns the BVIDs of videos found deleted or blocked
+func GetTombstonedBvids() (map[string]struct{}, error) {
+	return loadSentIDs("sent_tombstones.txt")
+}
+
+// GetSavedLiveMids returns the MIDs whose live room info has been saved
+func GetSavedLiveMids() (map[string]struct{}, error) {
+	return loadSentIDs("sent_live_mids.txt")
+}
+
+// GetRelationDoneMids returns all MIDs whose relations have been crawled
+func GetRelationDoneMids() (map[string]struct{}, error) {
+	return loadSentIDs("sent_relation_mids.txt")
+}
+
+// GetFavoriteDoneMids returns all MIDs whose favorites have been crawled
+func GetFavoriteDoneMids() (map[string]struct{}, error) {
+	return loadSentIDs("sent_favorite_mids.txt")
+}
+
+// RecordSeenSearchBvid records a BVID returned by search, whether or not it
+// was saved
+func RecordSeenSearchBvid(bvid string) error {
+	return recordSentID("seen_search_bvids.txt", bvid)
+}
+
+// GetSeenSearchBvids returns all BVIDs previously returned by search
+func GetSeenSearchBvids() (map[string]struct{}, error) {
+	return loadSentIDs("seen_search_bvids.txt")
+}
+
+// Roles in which an account can be discovered
+const (
+	MidOwner     = "owner"     // uploader of a saved video
+	MidCommenter = "commenter" // author of a main comment
+	MidReplier   = "replier"   // author of a reply
+	MidSearched  = "searched"  // found by a user search for a keyword
+)
+
+// MidSource records how an account was discovered. The zero value means
+// unknown.
+type MidSource struct {
+	Role string
+	Bvid string
+	Rpid int64 // comment or reply written by the account, 0 for owners
 }
 
-// GetPendingMids returns all pending MIDs
-func GetPendingMids() (map[string]struct{}, error) {
-	return loadSentIDs("pending_mids.txt")
+// pendingLine encodes a pending MID with its source as tab-separated fields;
+// an unknown source leaves the bare MID
+func pendingLine(mid string, source MidSource) string {
+	if source == (MidSource{}) {
+		return mid
+	}
+	return strings.Join([]string{mid, source.Role, source.Bvid, strconv.FormatInt(source.Rpid, 10)}, "\t")
+}
+
+// parsePendingLine decodes a pending_mids line, which may be a bare MID
+// written by an older version
+func parsePendingLine(line string) (string, MidSource) {
+	fields := strings.Split(line, "\t")
+	var source MidSource
+	if len(fields) == 4 {
+		source.Role = fields[1]
+		source.Bvid = fields[2]
+		source.Rpid, _ = strconv.ParseInt(fields[3], 10, 64)
+	}
+	return fields[0], source
+}
+
+// SavePendingMid saves a pending MID with how it was discovered
+func SavePendingMid(mid string, source MidSource) error {
+	return recordSentID("pending_mids.txt", pendingLine(mid, source))
+}
+
+// GetPendingMids returns all pending MIDs with how they were discovered. A
+// MID recorded more than once keeps its first known source.
+func GetPendingMids() (map[string]MidSource, error) {
+	mids := make(map[string]MidSource)
+	err := scanSentIDs("pending_mids.txt", func(line string) {
+		mid, source := parsePendingLine(line)
+		if known, ok := mids[mid]; !ok || known == (MidSource{}) {
+			mids[mid] = source
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mids, nil
 }
 
 // UpdatePendingMids updates the pending MIDs file with the remaining MIDs
-func UpdatePendingMids(remainingMids map[string]struct{}) error {
-	filepath := filepath.Join(recordDir, "pending_mids.txt")
+func UpdatePendingMids(remainingMids map[string]MidSource) error {
+	lines := make([]string, 0, len(remainingMids))
+	for mid, source := range remainingMids {
+		lines = append(lines, pendingLine(mid, source))
+	}
+	return rewriteRecordFile("pending_mids.txt", lines)
+}
+
+// SavePendingBvid records a video queued for the comment stage with the
+// topic keyword it was found under, so that a crash does not lose it
+func SavePendingBvid(bvid, keyword string) error {
+	line := bvid
+	if keyword != "" {
+		line += "\t" + keyword
+	}
+	return recordSentID("pending_bvids.txt", line)
+}
 
-	if len(remainingMids) == 0 {
-		if _, err := os.Stat(filepath); err == nil {
-			return os.Remove(filepath)
+// GetPendingBvids returns the videos queued for comments whose comment crawl
+// has not finished, with their topic keywords
+func GetPendingBvids() (map[string]string, error) {
+	bvids := make(map[string]string)
+	err := scanSentIDs("pending_bvids.txt", func(line string) {
+		bvid, keyword, _ := strings.Cut(line, "\t")
+		if known := bvids[bvid]; known == "" {
+			bvids[bvid] = keyword
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bvids, nil
+}
+
+// UpdatePendingBvids rewrites the pending videos file with the remaining
+// videos
+func UpdatePendingBvids(remaining map[string]string) error {
+	lines := make([]string, 0, len(remaining))
+	for bvid, keyword := range remaining {
+		line := bvid
+		if keyword != "" {
+			line += "\t" + keyword
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return rewriteRecordFile("pending_bvids.txt", lines)
+}
+
+// rewriteRecordFile replaces a record file with lines, removing it when
+// there are none
+func rewriteRecordFile(recordFile string, lines []string) error {
+	path := filepath.Join(recordDir, recordFile)
+	if err := closeSentFile(path); err != nil {
+		return err
+	}
+
+	if len(lines) == 0 {
+		if _, err := os.Stat(path); err == nil {
+			return os.Remove(path)
 		}
 		return nil
 	}
@@ -226,14 +602,14 @@ func UpdatePendingMids(remainingMids map[string]struct{}) error {
 		return err
 	}
 
-	f, err := os.Create(filepath)
+	f, err := os.Create(path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
 
-	for mid := range remainingMids {
-		if _, err := f.WriteString(mid + "\n"); err != nil {
+	for _, line := range lines {
+		if _, err := f.WriteString(line + "\n"); err != nil {
 			return err
 		}
 	}
@@ -246,6 +622,21 @@ type VideoProgress struct {
 	Done   bool   `json:"done"`
 	Cursor string `json:"cursor"`
 	Aid    int64  `json:"aid,omitempty"`
+	Title  string `json:"title,omitempty"`
+	// Sample describes how the comments were sampled, nil if all were crawled
+	Sample *CommentSample `json:"sample,omitempty"`
+}
+
+// CommentSample records which main comment pages of a video were crawled
+// when its comments were sampled instead of crawled in full
+type CommentSample struct {
+	Mode  string `json:"mode"`
+	Pages []int  `json:"pages"` // pages fetched, from 1
+	// Main comment pages and comments of the video when it was sampled, 0
+	// if the API did not report them
+	TotalPages    int   `json:"total_pages,omitempty"`
+	TotalComments int   `json:"total_comments,omitempty"`
+	Seed          int64 `json:"seed,omitempty"` // seed of a random sample
 }
 
 func getProgressFilepath() string {
@@ -281,8 +672,9 @@ func saveProgressData(data map[string]*VideoProgress) error {
 	return os.WriteFile(filepath, content, 0644)
 }
 
-// SaveVideoCommentProgress saves the progress of comment crawling for a video
-func SaveVideoCommentProgress(bvid, cursor string, aid int64) error {
+// SaveVideoCommentProgress saves the progress of comment crawling for a
+// video. A zero aid or empty title keeps the recorded one.
+func SaveVideoCommentProgress(bvid, cursor string, aid int64, title string) error {
 	progressMu.Lock()
 	defer progressMu.Unlock()
 
@@ -298,6 +690,9 @@ func SaveVideoCommentProgress(bvid, cursor string, aid int64) error {
 	if aid != 0 {
 		data[bvid].Aid = aid
 	}
+	if title != "" {
+		data[bvid].Title = title
+	}
 
 	return saveProgressData(data)
 }
@@ -321,6 +716,27 @@ func MarkVideoCommentsDone(bvid string) error {
 	return saveProgressData(data)
 }
 
+// MarkVideoCommentsSampled marks a video's comments as done after sampling
+// them, recording the sample
+func MarkVideoCommentsSampled(bvid string, sample CommentSample) error {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+
+	data, err := loadProgressData()
+	if err != nil {
+		return err
+	}
+
+	if data[bvid] == nil {
+		data[bvid] = &VideoProgress{}
+	}
+	data[bvid].Done = true
+	data[bvid].Cursor = ""
+	data[bvid].Sample = &sample
+
+	return saveProgressData(data)
+}
+
 // GetVideoCommentProgress returns the progress of comment crawling for a video
 func GetVideoCommentProgress(bvid string) (*VideoProgress, error) {
 	progressMu.Lock()
@@ -345,7 +761,464 @@ func LoadAllVideoProgress() (map[string]*VideoProgress, error) {
 	return loadProgressData()
 }
 
+// ReplyProgress records how far the replies of a root comment were crawled.
+// Only threads interrupted after their first page have an entry.
+type ReplyProgress struct {
+	Page    int   `json:"page"`    // last page fully handled
+	Fetched int   `json:"fetched"` // replies handled up to that page
+	Aid     int64 `json:"aid,omitempty"`
+}
+
+func loadReplyProgressData() (map[string]ReplyProgress, error) {
+	data := make(map[string]ReplyProgress)
+	content, err := os.ReadFile(filepath.Join(recordDir, replyProgressFile))
+	if os.IsNotExist(err) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return make(map[string]ReplyProgress), nil
+	}
+	return data, nil
+}
+
+// replyProgress caches reply_progress.json, which changes after every reply
+// page. Changes are written out with the sent records: every sent-ID flush
+// interval, or at once when IDs are written through.
+var replyProgress struct {
+	path  string
+	data  map[string]ReplyProgress
+	dirty bool
+}
+
+// replyProgressData returns the cached reply progress of the record
+// directory, loading it on first use. Callers hold replyProgressMu.
+func replyProgressData() (map[string]ReplyProgress, error) {
+	path := filepath.Join(recordDir, replyProgressFile)
+	if replyProgress.data != nil && replyProgress.path == path {
+		return replyProgress.data, nil
+	}
+	// The record directory changed; keep what the old one was owed
+	if err := flushReplyProgressLocked(); err != nil {
+		return nil, err
+	}
+	data, err := loadReplyProgressData()
+	if err != nil {
+		return nil, err
+	}
+	replyProgress.path, replyProgress.data, replyProgress.dirty = path, data, false
+	return data, nil
+}
+
+// replyProgressChanged writes the cached reply progress out now if sent IDs
+// are written through, and otherwise leaves it to the periodic flush.
+// Callers hold replyProgressMu.
+func replyProgressChanged() error {
+	replyProgress.dirty = true
+
+	sentMu.Lock()
+	writeThrough := sentFsync == FsyncAlways || sentFlushInterval <= 0
+	if !writeThrough {
+		startSentFlusher()
+	}
+	sentMu.Unlock()
+
+	if writeThrough {
+		return flushReplyProgressLocked()
+	}
+	return nil
+}
+
+// flushReplyProgressLocked writes the cached reply progress if it changed.
+// Callers hold replyProgressMu.
+func flushReplyProgressLocked() error {
+	if !replyProgress.dirty {
+		return nil
+	}
+	if err := EnsureDir(filepath.Dir(replyProgress.path)); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(replyProgress.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(replyProgress.path, content, 0644); err != nil {
+		return err
+	}
+	replyProgress.dirty = false
+	return nil
+}
+
+// flushReplyProgress writes the cached reply progress if it changed; with
+// forget the cache is dropped so the file is read again on next use
+func flushReplyProgress(forget bool) error {
+	replyProgressMu.Lock()
+	defer replyProgressMu.Unlock()
+	err := flushReplyProgressLocked()
+	if forget && err == nil {
+		replyProgress.data = nil
+	}
+	return err
+}
+
+// SaveReplyProgress records the reply progress of a root comment
+func SaveReplyProgress(rpid int64, progress ReplyProgress) error {
+	replyProgressMu.Lock()
+	defer replyProgressMu.Unlock()
+
+	data, err := replyProgressData()
+	if err != nil {
+		return err
+	}
+	data[strconv.FormatInt(rpid, 10)] = progress
+	return replyProgressChanged()
+}
+
+// ClearReplyProgress forgets the reply progress of a root comment once its
+// replies are done
+func ClearReplyProgress(rpid int64) error {
+	replyProgressMu.Lock()
+	defer replyProgressMu.Unlock()
+
+	data, err := replyProgressData()
+	if err != nil {
+		return err
+	}
+	key := strconv.FormatInt(rpid, 10)
+	if _, ok := data[key]; !ok {
+		return nil
+	}
+	delete(data, key)
+	return replyProgressChanged()
+}
+
+// GetReplyProgress returns the reply progress of a root comment and whether
+// it has any
+func GetReplyProgress(rpid int64) (ReplyProgress, bool, error) {
+	replyProgressMu.Lock()
+	defer replyProgressMu.Unlock()
+
+	data, err := replyProgressData()
+	if err != nil {
+		return ReplyProgress{}, false, err
+	}
+	progress, ok := data[strconv.FormatInt(rpid, 10)]
+	return progress, ok, nil
+}
+
+// SearchProgress records which search result pages of a keyword were crawled
+type SearchProgress struct {
+	Pages    []int `json:"pages"`
+	NumPages int   `json:"num_pages"`
+	Updated  int64 `json:"updated"`
+}
+
+// HasPage reports whether the given page was already crawled
+func (p *SearchProgress) HasPage(page int) bool {
+	i := sort.SearchInts(p.Pages, page)
+	return i < len(p.Pages) && p.Pages[i] == page
+}
+
+func loadSearchProgressData() (map[string]*SearchProgress, error) {
+	data := make(map[string]*SearchProgress)
+
+	content, err := os.ReadFile(filepath.Join(recordDir, searchProgressFile))
+	if os.IsNotExist(err) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &data); err != nil {
+		return make(map[string]*SearchProgress), nil
+	}
+
+	return data, nil
+}
+
+// SaveSearchPage records that a search result page of a keyword was crawled
+func SaveSearchPage(keyword string, page, numPages int) error {
+	searchProgressMu.Lock()
+	defer searchProgressMu.Unlock()
+
+	data, err := loadSearchProgressData()
+	if err != nil {
+		return err
+	}
+
+	if data[keyword] == nil {
+		data[keyword] = &SearchProgress{}
+	}
+	progress := data[keyword]
+	if !progress.HasPage(page) {
+		progress.Pages = append(progress.Pages, page)
+		sort.Ints(progress.Pages)
+	}
+	if numPages > 0 {
+		progress.NumPages = numPages
+	}
+	progress.Updated = time.Now().Unix()
+
+	if err := EnsureDir(recordDir); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(recordDir, searchProgressFile), content, 0644)
+}
+
+// GetSearchProgress returns the search pagination progress of a keyword
+func GetSearchProgress(keyword string) (*SearchProgress, error) {
+	searchProgressMu.Lock()
+	defer searchProgressMu.Unlock()
+
+	data, err := loadSearchProgressData()
+	if err != nil {
+		return &SearchProgress{}, err
+	}
+
+	if progress, ok := data[keyword]; ok {
+		return progress, nil
+	}
+
+	return &SearchProgress{}, nil
+}
+
+// Failed task kinds
+const (
+	FailedVideo   = "video"
+	FailedComment = "comment"
+	FailedReply   = "reply"
+	FailedAccount = "account"
+)
+
+// FailedTask is an item that still failed after all retries
+type FailedTask struct {
+	Kind     string `json:"kind"`
+	ID       string `json:"id"`
+	Aid      int64  `json:"aid,omitempty"`
+	Bvid     string `json:"bvid,omitempty"`
+	Keyword  string `json:"keyword,omitempty"`
+	Title    string `json:"title,omitempty"` // video title of comment and reply tasks
+	Error    string `json:"error"`
+	Failures int    `json:"failures"`
+	Updated  int64  `json:"updated"`
+}
+
+func failedTaskKey(kind, id string) string {
+	return kind + ":" + id
+}
+
+func loadFailedTasksData() (map[string]*FailedTask, error) {
+	data := make(map[string]*FailedTask)
+
+	content, err := os.ReadFile(filepath.Join(recordDir, failedTasksFile))
+	if os.IsNotExist(err) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &data); err != nil {
+		return make(map[string]*FailedTask), nil
+	}
+
+	return data, nil
+}
+
+func saveFailedTasksData(data map[string]*FailedTask) error {
+	if err := EnsureDir(recordDir); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(recordDir, failedTasksFile), content, 0644)
+}
+
+// RecordFailedTask records or updates a failed task together with its error
+func RecordFailedTask(task FailedTask) error {
+	return RecordFailedTasks([]FailedTask{task})
+}
+
+// RecordFailedTasks records or updates several failed tasks with one write
+func RecordFailedTasks(tasks []FailedTask) error {
+	failedTasksMu.Lock()
+	defer failedTasksMu.Unlock()
+
+	data, err := loadFailedTasksData()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	for _, task := range tasks {
+		task := task
+		key := failedTaskKey(task.Kind, task.ID)
+		if prev, ok := data[key]; ok {
+			task.Failures = prev.Failures
+		}
+		task.Failures++
+		task.Updated = now
+		data[key] = &task
+	}
+
+	return saveFailedTasksData(data)
+}
+
+// ClearFailedTask removes a task from the failed list once it succeeds
+func ClearFailedTask(kind, id string) error {
+	failedTasksMu.Lock()
+	defer failedTasksMu.Unlock()
+
+	data, err := loadFailedTasksData()
+	if err != nil {
+		return err
+	}
+
+	key := failedTaskKey(kind, id)
+	if _, ok := data[key]; !ok {
+		return nil
+	}
+	delete(data, key)
+
+	return saveFailedTasksData(data)
+}
+
+// GetFailedTasks returns all recorded failed tasks ordered by kind and ID
+func GetFailedTasks() ([]FailedTask, error) {
+	failedTasksMu.Lock()
+	defer failedTasksMu.Unlock()
+
+	data, err := loadFailedTasksData()
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]FailedTask, 0, len(data))
+	for _, task := range data {
+		tasks = append(tasks, *task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Kind != tasks[j].Kind {
+			return tasks[i].Kind < tasks[j].Kind
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+
+	return tasks, nil
+}
+
+// RecordStatus summarizes the sent records and progress files
+type RecordStatus struct {
+	SentVideos         int                        `json:"sent_videos"`
+	SentComments       int                        `json:"sent_comments"`
+	SentAccounts       int                        `json:"sent_accounts"`
+	SentDynamics       int                        `json:"sent_dynamics"`
+	SentSubtitles      int                        `json:"sent_subtitles"`
+	DanmakuPages       int                        `json:"danmaku_pages"`
+	SentArticles       int                        `json:"sent_articles"`
+	SentLive           int                        `json:"sent_live"`
+	Tombstones         int                        `json:"tombstones"`
+	RelationMids       int                        `json:"relation_mids"`
+	FavoriteMids       int                        `json:"favorite_mids"`
+	SeenSearchBvids    int                        `json:"seen_search_bvids"`
+	PendingMids        int                        `json:"pending_mids"`
+	PendingBvids       int                        `json:"pending_bvids"`
+	CommentsDone       int                        `json:"comments_done"`
+	CommentsInProgress int                        `json:"comments_in_progress"`
+	RepliesInProgress  int                        `json:"replies_in_progress"`
+	Searches           map[string]*SearchProgress `json:"searches"`
+	FailedTasks        map[string]int             `json:"failed_tasks"`
+}
+
+// GetRecordStatus reads every record file and summarizes it
+func GetRecordStatus() (*RecordStatus, error) {
+	status := &RecordStatus{FailedTasks: make(map[string]int)}
+
+	counts := []struct {
+		file  string
+		count *int
+	}{
+		{"sent_videos.txt", &status.SentVideos},
+		{"sent_comments.txt", &status.SentComments},
+		{"sent_accounts.txt", &status.SentAccounts},
+		{"sent_dynamics.txt", &status.SentDynamics},
+		{"sent_subtitles.txt", &status.SentSubtitles},
+		{"sent_danmaku_cids.txt", &status.DanmakuPages},
+		{"sent_articles.txt", &status.SentArticles},
+		{"sent_live_mids.txt", &status.SentLive},
+		{"sent_tombstones.txt", &status.Tombstones},
+		{"sent_relation_mids.txt", &status.RelationMids},
+		{"sent_favorite_mids.txt", &status.FavoriteMids},
+		{"seen_search_bvids.txt", &status.SeenSearchBvids},
+		{"pending_mids.txt", &status.PendingMids},
+	}
+	for _, c := range counts {
+		ids, err := loadSentIDs(c.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", c.file, err)
+		}
+		*c.count = len(ids)
+	}
+
+	pendingBvids, err := GetPendingBvids()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pending_bvids.txt: %w", err)
+	}
+	status.PendingBvids = len(pendingBvids)
+
+	progress, err := LoadAllVideoProgress()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read comment progress: %w", err)
+	}
+	for _, p := range progress {
+		if p.Done {
+			status.CommentsDone++
+		} else if p.Cursor != "" {
+			status.CommentsInProgress++
+		}
+	}
+
+	replyProgressMu.Lock()
+	replies, err := replyProgressData()
+	replyProgressMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reply progress: %w", err)
+	}
+	status.RepliesInProgress = len(replies)
+
+	searchProgressMu.Lock()
+	status.Searches, err = loadSearchProgressData()
+	searchProgressMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read search progress: %w", err)
+	}
+
+	failed, err := GetFailedTasks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read failed tasks: %w", err)
+	}
+	for _, task := range failed {
+		status.FailedTasks[task.Kind]++
+	}
+
+	return status, nil
+}
+
 // SetRecordDir sets the record directory (for testing)
 func SetRecordDir(dir string) {
 	recordDir = dir
 }
+
+// RecordDir returns the record directory
+func RecordDir() string {
+	return recordDir
+}
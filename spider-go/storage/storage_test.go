@@ -3,6 +3,7 @@ package storage
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -102,7 +103,11 @@ func TestVideoProgress(t *testing.T) {
 	setupTestDir(t)
 
 	// Save progress
-	if err := SaveVideoCommentProgress("BV123", "cursor123", 12345); err != nil {
+	if err := SaveVideoCommentProgress("BV123", "cursor123", 12345, "标题"); err != nil {
+		t.Fatalf("Failed to save progress: %v", err)
+	}
+	// A later save without the aid and title keeps them
+	if err := SaveVideoCommentProgress("BV123", "cursor123", 0, ""); err != nil {
 		t.Fatalf("Failed to save progress: %v", err)
 	}
 
@@ -115,8 +120,8 @@ func TestVideoProgress(t *testing.T) {
 	if progress.Cursor != "cursor123" {
 		t.Errorf("Cursor = %s, expected cursor123", progress.Cursor)
 	}
-	if progress.Aid != 12345 {
-		t.Errorf("Aid = %d, expected 12345", progress.Aid)
+	if progress.Aid != 12345 || progress.Title != "标题" {
+		t.Errorf("Aid, Title = %d, %q, expected 12345, 标题", progress.Aid, progress.Title)
 	}
 	if progress.Done {
 		t.Error("Expected Done to be false")
@@ -127,7 +132,7 @@ func TestVideoProgress_MarkDone(t *testing.T) {
 	setupTestDir(t)
 
 	// Save initial progress
-	if err := SaveVideoCommentProgress("BV123", "cursor123", 12345); err != nil {
+	if err := SaveVideoCommentProgress("BV123", "cursor123", 12345, ""); err != nil {
 		t.Fatalf("Failed to save progress: %v", err)
 	}
 
@@ -150,6 +155,27 @@ func TestVideoProgress_MarkDone(t *testing.T) {
 	}
 }
 
+func TestVideoProgress_MarkSampled(t *testing.T) {
+	setupTestDir(t)
+
+	SaveVideoCommentProgress("BV123", "cursor123", 12345, "")
+	sample := CommentSample{Mode: "every", Pages: []int{1, 11, 21}, TotalPages: 25, TotalComments: 490}
+	if err := MarkVideoCommentsSampled("BV123", sample); err != nil {
+		t.Fatalf("Failed to mark sampled: %v", err)
+	}
+
+	progress, err := GetVideoCommentProgress("BV123")
+	if err != nil {
+		t.Fatalf("Failed to get progress: %v", err)
+	}
+	if !progress.Done || progress.Cursor != "" || progress.Aid != 12345 {
+		t.Errorf("progress = %+v, want done with the aid kept", progress)
+	}
+	if progress.Sample == nil || !reflect.DeepEqual(*progress.Sample, sample) {
+		t.Errorf("Sample = %+v, want %+v", progress.Sample, sample)
+	}
+}
+
 func TestVideoProgress_NonExistent(t *testing.T) {
 	setupTestDir(t)
 
@@ -171,8 +197,8 @@ func TestLoadAllVideoProgress(t *testing.T) {
 	setupTestDir(t)
 
 	// Save multiple progress entries
-	SaveVideoCommentProgress("BV1", "cursor1", 1)
-	SaveVideoCommentProgress("BV2", "cursor2", 2)
+	SaveVideoCommentProgress("BV1", "cursor1", 1, "")
+	SaveVideoCommentProgress("BV2", "cursor2", 2, "")
 	MarkVideoCommentsDone("BV3")
 
 	// Load all
@@ -200,9 +226,9 @@ func TestPendingMids(t *testing.T) {
 	setupTestDir(t)
 
 	// Save pending MIDs
-	SavePendingMid("123")
-	SavePendingMid("456")
-	SavePendingMid("789")
+	SavePendingMid("123", MidSource{})
+	SavePendingMid("456", MidSource{})
+	SavePendingMid("789", MidSource{})
 
 	// Get pending MIDs
 	mids, err := GetPendingMids()
@@ -219,11 +245,11 @@ func TestUpdatePendingMids(t *testing.T) {
 	tmpDir := setupTestDir(t)
 
 	// Save initial MIDs
-	SavePendingMid("123")
-	SavePendingMid("456")
+	SavePendingMid("123", MidSource{})
+	SavePendingMid("456", MidSource{})
 
 	// Update with remaining MIDs
-	remaining := map[string]struct{}{
+	remaining := map[string]MidSource{
 		"456": {},
 		"789": {},
 	}
@@ -248,7 +274,7 @@ func TestUpdatePendingMids(t *testing.T) {
 	}
 
 	// Update with empty set (should remove file)
-	if err := UpdatePendingMids(map[string]struct{}{}); err != nil {
+	if err := UpdatePendingMids(map[string]MidSource{}); err != nil {
 		t.Fatalf("Failed to update with empty set: %v", err)
 	}
 
@@ -258,6 +284,36 @@ func TestUpdatePendingMids(t *testing.T) {
 	}
 }
 
+func TestPendingBvids(t *testing.T) {
+	setupTestDir(t)
+
+	SavePendingBvid("BV1", "测试")
+	SavePendingBvid("BV2", "")
+	SavePendingBvid("BV1", "其他")
+
+	pending, err := GetPendingBvids()
+	if err != nil {
+		t.Fatalf("Failed to get pending bvids: %v", err)
+	}
+	expected := map[string]string{"BV1": "测试", "BV2": ""}
+	if !reflect.DeepEqual(pending, expected) {
+		t.Errorf("pending = %v, expected %v", pending, expected)
+	}
+
+	if err := UpdatePendingBvids(map[string]string{"BV2": ""}); err != nil {
+		t.Fatalf("Failed to update pending bvids: %v", err)
+	}
+	pending, _ = GetPendingBvids()
+	if len(pending) != 1 || pending["BV2"] != "" {
+		t.Errorf("pending after update = %v, expected only BV2", pending)
+	}
+
+	UpdatePendingBvids(nil)
+	if _, err := os.Stat(filepath.Join(recordDir, "pending_bvids.txt")); !os.IsNotExist(err) {
+		t.Error("pending_bvids.txt should be removed once empty")
+	}
+}
+
 func TestGetSavedFunctions(t *testing.T) {
 	tmpDir := setupTestDir(t)
 
@@ -265,6 +321,7 @@ func TestGetSavedFunctions(t *testing.T) {
 	os.WriteFile(filepath.Join(tmpDir, "sent_videos.txt"), []byte("BV1\nBV2\n"), 0644)
 	os.WriteFile(filepath.Join(tmpDir, "sent_comments.txt"), []byte("123\n456\n"), 0644)
 	os.WriteFile(filepath.Join(tmpDir, "sent_accounts.txt"), []byte("mid1\nmid2\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "sent_dynamics.txt"), []byte("d1\nd2\nd3\n"), 0644)
 
 	// Test GetSavedVideoBvids
 	bvids, err := GetSavedVideoBvids()
@@ -292,4 +349,281 @@ func TestGetSavedFunctions(t *testing.T) {
 	if len(mids) != 2 {
 		t.Errorf("Expected 2 MIDs, got %d", len(mids))
 	}
+
+	// Test GetSavedDynamicIDs
+	dynamics, err := GetSavedDynamicIDs()
+	if err != nil {
+		t.Fatalf("Failed to get saved dynamic IDs: %v", err)
+	}
+	if len(dynamics) != 3 {
+		t.Errorf("Expected 3 dynamic IDs, got %d", len(dynamics))
+	}
+}
+
+func TestSearchProgress(t *testing.T) {
+	setupTestDir(t)
+
+	SaveSearchPage("测试", 3, 10)
+	SaveSearchPage("测试", 1, 10)
+	SaveSearchPage("测试", 3, 0)
+	SaveSearchPage("其他", 1, 5)
+
+	progress, err := GetSearchProgress("测试")
+	if err != nil {
+		t.Fatalf("Failed to get search progress: %v", err)
+	}
+
+	if len(progress.Pages) != 2 || progress.Pages[0] != 1 || progress.Pages[1] != 3 {
+		t.Errorf("Pages = %v, expected [1 3]", progress.Pages)
+	}
+	if progress.NumPages != 10 {
+		t.Errorf("NumPages = %d, expected 10 (zero should not overwrite)", progress.NumPages)
+	}
+	if !progress.HasPage(3) || progress.HasPage(2) {
+		t.Error("HasPage returned unexpected result")
+	}
+
+	// Unknown keyword
+	progress, err = GetSearchProgress("未知")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(progress.Pages) != 0 {
+		t.Error("Expected no pages for unknown keyword")
+	}
+}
+
+func TestFailedTasks(t *testing.T) {
+	setupTestDir(t)
+
+	RecordFailedTask(FailedTask{Kind: FailedVideo, ID: "BV1", Error: "timeout"})
+	RecordFailedTask(FailedTask{Kind: FailedVideo, ID: "BV1", Error: "-412"})
+	RecordFailedTask(FailedTask{Kind: FailedAccount, ID: "123", Error: "-352"})
+
+	tasks, err := GetFailedTasks()
+	if err != nil {
+		t.Fatalf("Failed to get failed tasks: %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 failed tasks, got %d", len(tasks))
+	}
+	if tasks[0].Kind != FailedAccount || tasks[1].Kind != FailedVideo {
+		t.Errorf("Tasks should be ordered by kind, got %s, %s", tasks[0].Kind, tasks[1].Kind)
+	}
+	if tasks[1].Failures != 2 || tasks[1].Error != "-412" {
+		t.Errorf("Repeated failure should update error and count, got %+v", tasks[1])
+	}
+
+	ClearFailedTask(FailedVideo, "BV1")
+	ClearFailedTask(FailedVideo, "BV_unknown")
+
+	tasks, _ = GetFailedTasks()
+	if len(tasks) != 1 || tasks[0].ID != "123" {
+		t.Errorf("Expected only account 123 left, got %+v", tasks)
+	}
+}
+
+func TestRecordFailedTasks(t *testing.T) {
+	setupTestDir(t)
+
+	RecordFailedTask(FailedTask{Kind: FailedReply, ID: "1", Error: "timeout"})
+	RecordFailedTasks([]FailedTask{
+		{Kind: FailedReply, ID: "1", Bvid: "BV1", Error: "crawl cancelled"},
+		{Kind: FailedReply, ID: "2", Bvid: "BV2", Error: "crawl cancelled"},
+	})
+
+	tasks, err := GetFailedTasks()
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("GetFailedTasks = %+v, %v; expected 2 tasks", tasks, err)
+	}
+	if tasks[0].Bvid != "BV1" || tasks[0].Failures != 2 || tasks[1].Bvid != "BV2" || tasks[1].Failures != 1 {
+		t.Errorf("tasks = %+v, expected each batch entry recorded on its own", tasks)
+	}
+}
+
+func TestReplyProgress(t *testing.T) {
+	setupTestDir(t)
+
+	if _, ok, err := GetReplyProgress(100); err != nil || ok {
+		t.Fatalf("GetReplyProgress before save = %v, %v", ok, err)
+	}
+	SaveReplyProgress(100, ReplyProgress{Page: 1, Fetched: 20, Aid: 7})
+	SaveReplyProgress(100, ReplyProgress{Page: 3, Fetched: 58, Aid: 7})
+	SaveReplyProgress(200, ReplyProgress{Page: 2, Fetched: 40})
+
+	progress, ok, err := GetReplyProgress(100)
+	if err != nil || !ok {
+		t.Fatalf("GetReplyProgress = %v, %v", ok, err)
+	}
+	if progress != (ReplyProgress{Page: 3, Fetched: 58, Aid: 7}) {
+		t.Errorf("progress = %+v, expected the last save", progress)
+	}
+
+	if err := ClearReplyProgress(100); err != nil {
+		t.Fatalf("ClearReplyProgress: %v", err)
+	}
+	if err := ClearReplyProgress(300); err != nil {
+		t.Fatalf("ClearReplyProgress of unknown rpid: %v", err)
+	}
+	if _, ok, _ := GetReplyProgress(100); ok {
+		t.Error("progress should be gone after clearing")
+	}
+	if _, ok, _ := GetReplyProgress(200); !ok {
+		t.Error("clearing one rpid should keep the others")
+	}
+}
+
+func TestGetRecordStatus(t *testing.T) {
+	setupTestDir(t)
+
+	recordSentID("sent_videos.txt", "BV1")
+	recordSentID("sent_videos.txt", "BV2")
+	SavePendingMid("42", MidSource{})
+	MarkVideoCommentsDone("BV1")
+	SaveVideoCommentProgress("BV2", "cursor", 2, "")
+	SaveSearchPage("测试", 1, 5)
+	RecordFailedTask(FailedTask{Kind: FailedReply, ID: "100", Error: "timeout"})
+	SaveReplyProgress(100, ReplyProgress{Page: 2, Fetched: 40})
+
+	status, err := GetRecordStatus()
+	if err != nil {
+		t.Fatalf("Failed to get record status: %v", err)
+	}
+
+	if status.SentVideos != 2 || status.PendingMids != 1 || status.SentComments != 0 {
+		t.Errorf("Unexpected record counts: %+v", status)
+	}
+	if status.CommentsDone != 1 || status.CommentsInProgress != 1 {
+		t.Errorf("CommentsDone/InProgress = %d/%d, expected 1/1", status.CommentsDone, status.CommentsInProgress)
+	}
+	if status.RepliesInProgress != 1 {
+		t.Errorf("RepliesInProgress = %d, expected 1", status.RepliesInProgress)
+	}
+	if status.Searches["测试"] == nil || status.Searches["测试"].NumPages != 5 {
+		t.Error("Search progress should be included")
+	}
+	if status.FailedTasks[FailedReply] != 1 {
+		t.Errorf("FailedTasks = %v, expected one reply", status.FailedTasks)
+	}
+}
+
+func TestSaveSubtitle_RequiresID(t *testing.T) {
+	setupTestDir(t)
+	if err := SaveSubtitle(map[string]interface{}{"bvid": "BV1", "lan": "zh-CN"}); err == nil {
+		t.Error("Expected error for subtitle without cid")
+	}
+	if id := SubtitleID("BV1", 42, "zh-CN"); id != "BV1:42:zh-CN" {
+		t.Errorf("SubtitleID = %q", id)
+	}
+}
+
+func TestSaveDanmaku(t *testing.T) {
+	setupTestDir(t)
+	var keys []string
+	SetSink(SinkFunc(func(topic, key string, value []byte) error {
+		if topic != "claw_danmaku" {
+			t.Errorf("danmaku published to %s", topic)
+		}
+		keys = append(keys, key)
+		return nil
+	}))
+	t.Cleanup(func() { SetSink(nil) })
+
+	if err := SaveDanmaku(map[string]interface{}{"cid": int64(42), "content": "hi"}); err == nil {
+		t.Error("Expected error for danmaku without dmid")
+	}
+	if err := SaveDanmaku(map[string]interface{}{"dmid": "123", "cid": int64(42), "content": "hi"}); err != nil {
+		t.Fatalf("SaveDanmaku failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "123" {
+		t.Errorf("published keys = %v, expected [123]", keys)
+	}
+
+	if err := MarkDanmakuCrawled(42); err != nil {
+		t.Fatalf("MarkDanmakuCrawled failed: %v", err)
+	}
+	FlushSentIDs()
+	cids, err := GetDanmakuCids()
+	if err != nil {
+		t.Fatalf("GetDanmakuCids failed: %v", err)
+	}
+	if _, ok := cids["42"]; !ok || len(cids) != 1 {
+		t.Errorf("danmaku cids = %v, expected [42]", cids)
+	}
+}
+
+func TestSaveArticle(t *testing.T) {
+	setupTestDir(t)
+	var keys []string
+	SetSink(SinkFunc(func(topic, key string, value []byte) error {
+		if topic != "claw_article" {
+			t.Errorf("article published to %s", topic)
+		}
+		keys = append(keys, key)
+		return nil
+	}))
+	t.Cleanup(func() { SetSink(nil) })
+
+	if err := SaveArticle(map[string]interface{}{"title": "a"}); err == nil {
+		t.Error("Expected error for article without id")
+	}
+	if err := SaveArticle(map[string]interface{}{"id": int64(123), "title": "a"}); err != nil {
+		t.Fatalf("SaveArticle failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "123" {
+		t.Errorf("published keys = %v, expected [123]", keys)
+	}
+
+	FlushSentIDs()
+	ids, err := GetSavedArticleIDs()
+	if err != nil {
+		t.Fatalf("GetSavedArticleIDs failed: %v", err)
+	}
+	if _, ok := ids["123"]; !ok || len(ids) != 1 {
+		t.Errorf("saved articles = %v, expected [123]", ids)
+	}
+}
+
+func TestSaveLive_RequiresUID(t *testing.T) {
+	setupTestDir(t)
+	if err := SaveLive(map[string]interface{}{"room_id": float64(100)}); err == nil {
+		t.Error("Expected error for live room without uid")
+	}
+}
+
+func TestSaveTombstone_RequiresBvid(t *testing.T) {
+	setupTestDir(t)
+	if err := SaveTombstone(map[string]interface{}{"status": "deleted"}); err == nil {
+		t.Error("Expected error for tombstone without bvid")
+	}
+}
+
+func TestPendingMids_Source(t *testing.T) {
+	setupTestDir(t)
+
+	commenter := MidSource{Role: MidCommenter, Bvid: "BV1", Rpid: 100}
+	SavePendingMid("1", commenter)
+	SavePendingMid("1", MidSource{Role: MidOwner, Bvid: "BV2"})
+	SavePendingMid("2", MidSource{})
+	// A bare MID written before sources were recorded gains a later source
+	SavePendingMid("2", MidSource{Role: MidOwner, Bvid: "BV3"})
+
+	mids, err := GetPendingMids()
+	if err != nil {
+		t.Fatalf("Failed to get pending MIDs: %v", err)
+	}
+	if mids["1"] != commenter {
+		t.Errorf("Source of 1 = %+v, expected the first one %+v", mids["1"], commenter)
+	}
+	if mids["2"].Role != MidOwner {
+		t.Errorf("Source of 2 = %+v, expected the owner source", mids["2"])
+	}
+
+	// Sources survive the rewrite at the end of a run
+	if err := UpdatePendingMids(mids); err != nil {
+		t.Fatalf("Failed to update pending MIDs: %v", err)
+	}
+	if again, _ := GetPendingMids(); again["1"] != commenter || len(again) != 2 {
+		t.Errorf("Pending MIDs after rewrite = %+v", again)
+	}
 }
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// adminTimeout bounds a topic creation request
+const adminTimeout = 30 * time.Second
+
+// Topics returns every claw_* topic the crawler publishes to, sorted.
+// Topics routed by keyword (see SetTopicTemplate) are not included.
+func Topics() []string {
+	topics := make([]string, 0, len(kindTopics))
+	for _, topic := range kindTopics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// EnsureTopics creates the topics of Topics that do not exist yet, with the
+// given partition count and replication factor, and returns the ones it
+// created. Existing topics are left as they are.
+func EnsureTopics(ctx context.Context, partitions, replication int) ([]string, error) {
+	return ensureTopics(ctx, kafka.TCP(kafkaBootstrapServers), Topics(), partitions, replication)
+}
+
+func ensureTopics(ctx context.Context, addr net.Addr, topics []string, partitions, replication int) ([]string, error) {
+	if partitions < 1 || replication < 1 {
+		return nil, fmt.Errorf("partitions and replication must be >= 1 (got %d, %d)", partitions, replication)
+	}
+
+	configs := make([]kafka.TopicConfig, len(topics))
+	for i, topic := range topics {
+		configs[i] = kafka.TopicConfig{
+			Topic:             topic,
+			NumPartitions:     partitions,
+			ReplicationFactor: replication,
+		}
+	}
+
+	client := &kafka.Client{Addr: addr, Timeout: adminTimeout}
+	resp, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: configs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka topics: %w", err)
+	}
+
+	var created []string
+	for _, topic := range topics {
+		err := resp.Errors[topic]
+		switch {
+		case err == nil:
+			created = append(created, topic)
+		case errors.Is(err, kafka.TopicAlreadyExists):
+		default:
+			return created, fmt.Errorf("failed to create kafka topic %s: %w", topic, err)
+		}
+	}
+	return created, nil
+}
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"net"
+	"sort"
+	"testing"
+)
+
+func TestTopics(t *testing.T) {
+	topics := Topics()
+	if len(topics) != len(kindTopics) {
+		t.Fatalf("Topics() = %v, want %d topics", topics, len(kindTopics))
+	}
+	if !sort.StringsAreSorted(topics) {
+		t.Errorf("Topics() = %v, want sorted", topics)
+	}
+	for kind := range kindTopics {
+		topic, _ := TopicFor(kind)
+		if i := sort.SearchStrings(topics, topic); i == len(topics) || topics[i] != topic {
+			t.Errorf("Topics() lacks %s", topic)
+		}
+	}
+}
+
+func TestEnsureTopics_InvalidSettings(t *testing.T) {
+	for _, tc := range [][2]int{{0, 1}, {3, 0}} {
+		if _, err := EnsureTopics(context.Background(), tc[0], tc[1]); err == nil {
+			t.Errorf("EnsureTopics(%d, %d) succeeded, want error", tc[0], tc[1])
+		}
+	}
+}
+
+func TestEnsureTopics_Unreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr()
+	l.Close()
+
+	created, err := ensureTopics(context.Background(), addr, Topics(), 3, 1)
+	if err == nil || len(created) != 0 {
+		t.Errorf("ensureTopics = %v, %v, want an error", created, err)
+	}
+}
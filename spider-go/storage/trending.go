@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const trendingTermsFile = "trending_terms.json"
+
+var trendingTermsMu sync.Mutex
+
+// GetTrendingTerms returns the hot search terms the trending command has
+// searched, with the Unix time each was last searched
+func GetTrendingTerms() (map[string]int64, error) {
+	trendingTermsMu.Lock()
+	defer trendingTermsMu.Unlock()
+	return loadTrendingTerms()
+}
+
+// SaveTrendingTerm records that a hot search term was searched at searched
+func SaveTrendingTerm(term string, searched int64) error {
+	trendingTermsMu.Lock()
+	defer trendingTermsMu.Unlock()
+
+	terms, err := loadTrendingTerms()
+	if err != nil {
+		return err
+	}
+	terms[term] = searched
+
+	if err := EnsureDir(recordDir); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(terms, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(recordDir, trendingTermsFile), content, 0644)
+}
+
+func loadTrendingTerms() (map[string]int64, error) {
+	terms := make(map[string]int64)
+
+	content, err := os.ReadFile(filepath.Join(recordDir, trendingTermsFile))
+	if os.IsNotExist(err) {
+		return terms, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &terms); err != nil {
+		return make(map[string]int64), nil
+	}
+	return terms, nil
+}
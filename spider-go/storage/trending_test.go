@@ -0,0 +1,30 @@
+package storage
+
+import "testing"
+
+func TestTrendingTerms(t *testing.T) {
+	setupTestDir(t)
+
+	terms, err := GetTrendingTerms()
+	if err != nil || len(terms) != 0 {
+		t.Fatalf("GetTrendingTerms() = %v, %v; expected no terms", terms, err)
+	}
+
+	if err := SaveTrendingTerm("新番", 100); err != nil {
+		t.Fatalf("SaveTrendingTerm failed: %v", err)
+	}
+	if err := SaveTrendingTerm("游戏", 200); err != nil {
+		t.Fatalf("SaveTrendingTerm failed: %v", err)
+	}
+	if err := SaveTrendingTerm("新番", 300); err != nil {
+		t.Fatalf("SaveTrendingTerm failed: %v", err)
+	}
+
+	terms, err = GetTrendingTerms()
+	if err != nil {
+		t.Fatalf("GetTrendingTerms failed: %v", err)
+	}
+	if len(terms) != 2 || terms["新番"] != 300 || terms["游戏"] != 200 {
+		t.Errorf("terms = %v", terms)
+	}
+}
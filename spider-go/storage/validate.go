@@ -0,0 +1,194 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrQuarantined is returned for a record that failed validation and was
+// sent to the quarantine topic instead of its own
+var ErrQuarantined = errors.New("record quarantined")
+
+// validateRecords enables the validation stage for published records
+var validateRecords bool
+
+// SetRecordValidation enables or disables validation, sanitization and
+// timestamp normalization of published records. It must be called before
+// anything is saved.
+func SetRecordValidation(enabled bool) {
+	validateRecords = enabled
+}
+
+// fieldRule is a field a record must have, as a dotted path and a JSON kind
+// ("string", "number", "object", "array" or "any")
+type fieldRule struct {
+	path string
+	kind string
+}
+
+// recordSchemas are the fields required per topic
+var recordSchemas = map[string][]fieldRule{
+	kafkaTopicVideo: {
+		{"bvid", "string"}, {"aid", "number"}, {"title", "string"}, {"pubdate", "number"}, {"owner", "object"},
+	},
+	kafkaTopicComment: {
+		{"rpid", "number"}, {"oid", "number"}, {"mid", "number"}, {"ctime", "number"}, {"content.message", "string"},
+	},
+	kafkaTopicAccount:    {{"card", "object"}, {"card.mid", "any"}, {"card.name", "string"}},
+	kafkaTopicDynamic:    {{"id_str", "string"}, {"modules", "object"}},
+	kafkaTopicRelation:   {{"owner_mid", "any"}, {"mid", "any"}},
+	kafkaTopicFavorite:   {{"owner_mid", "any"}, {"bvid", "string"}, {"folder_id", "number"}},
+	kafkaTopicSubtitle:   {{"bvid", "string"}, {"lan", "string"}, {"body", "array"}},
+	kafkaTopicDanmaku:    {{"dmid", "string"}, {"cid", "number"}, {"content", "string"}},
+	kafkaTopicArticle:    {{"id", "number"}, {"mid", "number"}, {"title", "string"}, {"stats", "object"}},
+	kafkaTopicLive:       {{"uid", "number"}, {"room_id", "number"}},
+	kafkaTopicVideoStats: {{"bvid", "string"}, {"snapshot_at", "number"}},
+	kafkaTopicTombstone:  {{"bvid", "string"}, {"status", "string"}, {"detected_at", "number"}},
+}
+
+// timestampFields are Unix-second fields rewritten as RFC3339 strings
+var timestampFields = map[string]bool{
+	"ctime": true, "mtime": true, "pubdate": true, "pub_ts": true,
+	"snapshot_at": true, "detected_at": true, "pub_time": true,
+}
+
+// lookupPath returns the value at a dotted path of a record
+func lookupPath(record map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = record
+	for _, part := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[part]; !ok || value == nil {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// jsonKind returns the JSON kind of a decoded value
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64, int64, int:
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}, []map[string]interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// validateRecord checks a record against its topic's schema
+func validateRecord(topic string, record map[string]interface{}) error {
+	var problems []string
+	for _, rule := range recordSchemas[topic] {
+		value, ok := lookupPath(record, rule.path)
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("missing %s", rule.path))
+		case rule.kind != "any" && jsonKind(value) != rule.kind:
+			problems = append(problems, fmt.Sprintf("%s is %s, expected %s", rule.path, jsonKind(value), rule.kind))
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// sanitizeString drops invalid UTF-8 and control characters other than
+// newlines and tabs
+func sanitizeString(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\n' && r != '\t' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// sanitizeValue returns a copy of a decoded value with every string
+// sanitized and, under a timestamp key, Unix seconds as RFC3339
+func sanitizeValue(key string, v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return sanitizeString(t)
+	case float64:
+		if timestampFields[key] && t > 0 {
+			return time.Unix(int64(t), 0).UTC().Format(time.RFC3339)
+		}
+	case int64:
+		if timestampFields[key] && t > 0 {
+			return time.Unix(t, 0).UTC().Format(time.RFC3339)
+		}
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			out[k] = sanitizeValue(k, item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = sanitizeValue("", item)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]map[string]interface{}, len(t))
+		for i, item := range t {
+			out[i] = sanitizeValue("", item).(map[string]interface{})
+		}
+		return out
+	}
+	return v
+}
+
+// quarantine publishes a record that failed validation, with the error
+func quarantine(topic, key string, record map[string]interface{}, cause error) error {
+	if anonymizer != nil {
+		record = anonymizer.Record(record)
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"topic":          topic,
+		"key":            key,
+		"error":          cause.Error(),
+		"record":         record,
+		"quarantined_at": time.Now().UTC().Format(time.RFC3339),
+		"schema_version": SchemaVersion,
+	})
+	if err != nil {
+		return err
+	}
+
+	return publish(kafkaTopicQuarantine, key, data)
+}
+
+// encodeRecord serializes a record for a topic under its message key. With
+// validation enabled the record is checked against the topic's schema
+// (failures go to the quarantine topic and return ErrQuarantined), sanitized
+// and its timestamps normalized; with an anonymizer it is anonymized. Every
+// record is stamped with schema_version.
+func encodeRecord(topic, key string, record map[string]interface{}) ([]byte, error) {
+	if validateRecords {
+		if err := validateRecord(topic, record); err != nil {
+			if qErr := quarantine(topic, key, record, err); qErr != nil {
+				return nil, fmt.Errorf("failed to quarantine invalid record (%v): %w", err, qErr)
+			}
+			return nil, fmt.Errorf("%w: %v", ErrQuarantined, err)
+		}
+		record = sanitizeValue("", record).(map[string]interface{})
+	}
+	if anonymizer != nil {
+		record = anonymizer.Record(record)
+	}
+	return json.Marshal(withSchemaVersion(record))
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidateRecord(t *testing.T) {
+	comment := map[string]interface{}{
+		"rpid":    float64(1),
+		"oid":     float64(2),
+		"mid":     float64(3),
+		"ctime":   float64(1700000000),
+		"content": map[string]interface{}{"message": "你好"},
+	}
+	if err := validateRecord(kafkaTopicComment, comment); err != nil {
+		t.Fatalf("valid comment rejected: %v", err)
+	}
+
+	delete(comment, "mid")
+	comment["ctime"] = "yesterday"
+	err := validateRecord(kafkaTopicComment, comment)
+	if err == nil {
+		t.Fatal("expected an error for a comment without mid")
+	}
+	for _, want := range []string{"missing mid", "ctime is string, expected number"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %q", err, want)
+		}
+	}
+
+	if err := validateRecord(kafkaTopicVideo, map[string]interface{}{"bvid": "BV1"}); err == nil {
+		t.Error("expected an error for a video without aid")
+	}
+}
+
+func TestSanitizeString(t *testing.T) {
+	got := sanitizeString("a\x00b\x1bc\nd\te\xff")
+	if got != "abc\nd\te" {
+		t.Errorf("sanitizeString = %q", got)
+	}
+}
+
+func TestSanitizeValue(t *testing.T) {
+	video := map[string]interface{}{
+		"title":   "标题\x07",
+		"pubdate": float64(1700000000),
+		"aid":     float64(1700000000),
+		"pages":   []interface{}{map[string]interface{}{"ctime": int64(1700000000)}},
+	}
+
+	out := sanitizeValue("", video).(map[string]interface{})
+	if out["title"] != "标题" {
+		t.Errorf("title = %q", out["title"])
+	}
+	if out["pubdate"] != "2023-11-14T22:13:20Z" {
+		t.Errorf("pubdate = %v, expected RFC3339", out["pubdate"])
+	}
+	if out["aid"] != float64(1700000000) {
+		t.Errorf("aid = %v, only timestamp fields should be converted", out["aid"])
+	}
+	page := out["pages"].([]interface{})[0].(map[string]interface{})
+	if page["ctime"] != "2023-11-14T22:13:20Z" {
+		t.Errorf("nested ctime = %v", page["ctime"])
+	}
+
+	if video["pubdate"] != float64(1700000000) || video["title"] != "标题\x07" {
+		t.Error("sanitizeValue should not modify its input")
+	}
+}
+
+func TestEncodeRecord_Disabled(t *testing.T) {
+	data, err := encodeRecord(kafkaTopicVideo, "BV1", map[string]interface{}{"pubdate": float64(1)})
+	if err != nil {
+		t.Fatalf("encodeRecord: %v", err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out["pubdate"] != float64(1) {
+		t.Errorf("pubdate = %v, expected it unchanged without validation", out["pubdate"])
+	}
+}
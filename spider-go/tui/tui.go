@@ -0,0 +1,199 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"spider-go/crawler"
+)
+
+const refreshInterval = 500 * time.Millisecond
+
+// counterRow describes one counter line of the dashboard
+type counterRow struct {
+	Label string
+	Value func(crawler.Counters) int
+}
+
+var counterRows = []counterRow{
+	{"视频", func(c crawler.Counters) int { return c.VideosSaved }},
+	{"一级评论", func(c crawler.Counters) int { return c.CommentsSaved }},
+	{"二级评论", func(c crawler.Counters) int { return c.RepliesSaved }},
+	{"用户", func(c crawler.Counters) int { return c.AccountsSaved }},
+	{"动态", func(c crawler.Counters) int { return c.DynamicsSaved }},
+	{"关系", func(c crawler.Counters) int { return c.RelationsSaved }},
+}
+
+type tickMsg time.Time
+
+type finishedMsg struct{}
+
+type model struct {
+	snapshot func() crawler.Snapshot
+	cancel   func() // stops the crawl, which then drains
+	current  crawler.Snapshot
+	rates    []float64
+	lastTick time.Time
+	started  time.Time
+	stopping bool
+	finished bool
+}
+
+func newModel(snapshot func() crawler.Snapshot) model {
+	now := time.Now()
+	return model{
+		snapshot: snapshot,
+		current:  snapshot(),
+		rates:    make([]float64, len(counterRows)),
+		lastTick: now,
+		started:  now,
+	}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(refreshInterval, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
+}
+
+func (m model) Init() tea.Cmd {
+	return tick()
+}
+
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			// The dashboard stays until the cancelled crawl has drained
+			if m.cancel != nil {
+				m.cancel()
+			}
+			m.stopping = true
+			return m, nil
+		}
+	case tickMsg:
+		m.refresh(time.Time(msg))
+		return m, tick()
+	case finishedMsg:
+		m.refresh(time.Now())
+		m.finished = true
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// refresh takes a new snapshot and updates the per-second rates
+func (m *model) refresh(now time.Time) {
+	next := m.snapshot()
+	elapsed := now.Sub(m.lastTick).Seconds()
+	if elapsed > 0 {
+		for i, row := range counterRows {
+			m.rates[i] = float64(row.Value(next.Counters)-row.Value(m.current.Counters)) / elapsed
+		}
+	}
+	m.current = next
+	m.lastTick = now
+}
+
+func (m model) View() string {
+	var b strings.Builder
+	s := m.current
+
+	status := "运行中"
+	switch {
+	case m.finished || s.Finished:
+		status = "已完成"
+	case m.stopping:
+		status = "正在收尾"
+	}
+	fmt.Fprintf(&b, "BiliClaw  关键词: %s  状态: %s  运行时间: %s\n\n",
+		s.Keyword, status, time.Since(m.started).Truncate(time.Second))
+
+	b.WriteString("队列\n")
+	for _, q := range s.Queues {
+		fmt.Fprintf(&b, "  %-10s %6d / %-6d %s\n", q.Name, q.Len, q.Cap, bar(q.Len, q.Cap, 20))
+	}
+
+	b.WriteString("\n计数            保存      速率/s\n")
+	for i, row := range counterRows {
+		fmt.Fprintf(&b, "  %-10s %10d  %8.2f\n", row.Label, row.Value(s.Counters), m.rates[i])
+	}
+	fmt.Fprintf(&b, "  跳过: 视频 %d  评论 %d  用户 %d  过滤: 视频 %d\n",
+		s.Counters.VideosSkipped, s.Counters.CommentsSkipped, s.Counters.AccountsSkipped, s.Counters.VideosFiltered)
+
+	fmt.Fprintf(&b, "\nCookie: 可用 %v / 启用 %v / 总计 %v (%v)\n",
+		s.Cookies["valid"], s.Cookies["enabled"], s.Cookies["total"], s.Cookies["strategy"])
+
+	b.WriteString("\n最近错误\n")
+	for _, line := range tail(s.RecentErrors, 5) {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+
+	b.WriteString("\n最近日志\n")
+	for _, line := range tail(s.RecentLogs, 8) {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+
+	if m.stopping {
+		b.WriteString("\n正在等待进行中的任务收尾…\n")
+	} else {
+		b.WriteString("\n按 q 停止爬取并退出\n")
+	}
+	return b.String()
+}
+
+// bar renders a fill bar of the given width
+func bar(value, total, width int) string {
+	if total <= 0 {
+		return ""
+	}
+	filled := value * width / total
+	if filled > width {
+		filled = width
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", width-filled) + "]"
+}
+
+func tail(lines []string, n int) []string {
+	if len(lines) <= n {
+		return lines
+	}
+	return lines[len(lines)-n:]
+}
+
+// Run runs the crawl with the dashboard attached to the terminal. Crawler
+// output is only kept in memory while the dashboard is shown; the last lines,
+// including the final summary, are written to the crawler's log output once
+// it exits. Quitting the dashboard cancels the crawl and waits for it to
+// drain.
+func Run(c *crawler.BiliCrawler, run func()) error {
+	out := c.LogOutput()
+	c.SetLogOutput(io.Discard)
+
+	m := newModel(c.Snapshot)
+	m.cancel = c.Cancel
+	p := tea.NewProgram(m, tea.WithAltScreen())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run()
+		p.Send(finishedMsg{})
+	}()
+
+	_, err := p.Run()
+	if err != nil {
+		c.Cancel()
+	}
+	<-done
+	c.SetLogOutput(out)
+
+	for _, line := range tail(c.Snapshot().RecentLogs, 20) {
+		fmt.Fprintln(out, line)
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package tui
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"spider-go/crawler"
+)
+
+func TestBar(t *testing.T) {
+	tests := []struct {
+		value, total, width int
+		expected            string
+	}{
+		{0, 10, 4, "[....]"},
+		{5, 10, 4, "[##..]"},
+		{10, 10, 4, "[####]"},
+		{20, 10, 4, "[####]"},
+		{1, 0, 4, ""},
+	}
+
+	for _, tt := range tests {
+		if result := bar(tt.value, tt.total, tt.width); result != tt.expected {
+			t.Errorf("bar(%d, %d, %d) = %q, expected %q", tt.value, tt.total, tt.width, result, tt.expected)
+		}
+	}
+}
+
+func TestTail(t *testing.T) {
+	lines := []string{"a", "b", "c"}
+	if got := tail(lines, 2); len(got) != 2 || got[0] != "b" {
+		t.Errorf("tail(lines, 2) = %v", got)
+	}
+	if got := tail(lines, 5); len(got) != 3 {
+		t.Errorf("tail(lines, 5) = %v", got)
+	}
+}
+
+func TestModel_RefreshRates(t *testing.T) {
+	saved := 0
+	snapshot := func() crawler.Snapshot {
+		return crawler.Snapshot{Keyword: "测试", Counters: crawler.Counters{VideosSaved: saved}}
+	}
+
+	m := newModel(snapshot)
+	saved = 10
+	m.refresh(m.lastTick.Add(2 * time.Second))
+
+	if m.rates[0] != 5 {
+		t.Errorf("Video rate = %f, expected 5", m.rates[0])
+	}
+	if !strings.Contains(m.View(), "测试") {
+		t.Error("View should contain the keyword")
+	}
+}
+
+func TestModel_QuitCancelsAndWaits(t *testing.T) {
+	cancelled := 0
+	m := newModel(func() crawler.Snapshot { return crawler.Snapshot{} })
+	m.cancel = func() { cancelled++ }
+
+	next, cmd := m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("q")})
+	if cancelled != 1 {
+		t.Errorf("cancel called %d times, expected 1", cancelled)
+	}
+	if cmd != nil {
+		t.Error("Quitting should wait for the crawl to drain")
+	}
+	if view := next.View(); !strings.Contains(view, "正在收尾") {
+		t.Errorf("View = %q, expected the stopping state", view)
+	}
+
+	if _, cmd := next.Update(finishedMsg{}); cmd == nil {
+		t.Error("The dashboard should exit once the crawl has finished")
+	}
+}
@@ -0,0 +1,170 @@
+package web
+
+import (
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"net/http"
+	"net/url"
+
+	"spider-go/crawler"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// Controller is the part of the crawler driven by the web API
+type Controller interface {
+	Snapshot() crawler.Snapshot
+	Pause()
+	Resume()
+	SetRate(rate float64) error
+	AddKeyword(keyword string) error
+	Health() crawler.Health
+}
+
+// NewHandler returns the HTTP handler serving the dashboard page and JSON API:
+//
+//	GET  /api/stats     current crawl snapshot
+//	POST /api/pause     pause all workers
+//	POST /api/resume    resume paused workers
+//	POST /api/rate      {"rate": 1.5} change the request rate
+//	POST /api/keywords  {"keyword": "..."} queue another search keyword
+//	GET  /healthz       liveness: 503 while the crawl is degraded
+//	GET  /readyz        readiness: 503 unless the crawl is running
+//
+// The POST endpoints change the crawl, so they require token in an
+// "Authorization: Bearer" header and reject requests from another origin.
+// An empty token leaves them disabled.
+func NewHandler(ctrl Controller, token string) http.Handler {
+	mux := http.NewServeMux()
+
+	static, _ := fs.Sub(staticFiles, "static")
+	mux.Handle("/", http.FileServer(http.FS(static)))
+
+	mux.HandleFunc("/api/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, ctrl.Snapshot())
+	})
+
+	mux.HandleFunc("/healthz", healthHandler(ctrl, crawler.Health.Live))
+	mux.HandleFunc("/readyz", healthHandler(ctrl, crawler.Health.Ready))
+
+	mux.HandleFunc("/api/pause", control(token, func(w http.ResponseWriter, r *http.Request) {
+		ctrl.Pause()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"paused": true})
+	}))
+
+	mux.HandleFunc("/api/resume", control(token, func(w http.ResponseWriter, r *http.Request) {
+		ctrl.Resume()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"paused": false})
+	}))
+
+	mux.HandleFunc("/api/rate", control(token, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Rate float64 `json:"rate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := ctrl.SetRate(req.Rate); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"rate": req.Rate})
+	}))
+
+	mux.HandleFunc("/api/keywords", control(token, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Keyword string `json:"keyword"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := ctrl.AddKeyword(req.Keyword); err != nil {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"keyword": req.Keyword})
+	}))
+
+	return mux
+}
+
+// Serve starts the dashboard HTTP server on addr, accepting control requests
+// that carry token
+func Serve(addr string, ctrl Controller, token string) error {
+	return http.ListenAndServe(addr, NewHandler(ctrl, token))
+}
+
+// healthHandler reports the crawl health with 200 when ok holds and 503
+// otherwise
+func healthHandler(ctrl Controller, ok func(crawler.Health) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		health := ctrl.Health()
+		status := http.StatusOK
+		if !ok(health) {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, health)
+	}
+}
+
+// control guards a POST endpoint that changes the crawl: it must carry the
+// token and must not come from a page on another origin
+func control(token string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if crossOrigin(r) {
+			writeError(w, http.StatusForbidden, "cross-origin request")
+			return
+		}
+		if token == "" {
+			writeError(w, http.StatusForbidden, "control API disabled: set web_token")
+			return
+		}
+		given := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(given), []byte("Bearer "+token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// crossOrigin reports whether a browser sent the request from a page on
+// another origin
+func crossOrigin(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
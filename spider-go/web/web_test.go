@@ -0,0 +1,176 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"spider-go/crawler"
+)
+
+type fakeController struct {
+	paused   bool
+	rate     float64
+	keywords []string
+	health   crawler.Health
+}
+
+func (f *fakeController) Snapshot() crawler.Snapshot {
+	return crawler.Snapshot{Keywords: f.keywords, Paused: f.paused, Rate: f.rate}
+}
+
+func (f *fakeController) Pause()  { f.paused = true }
+func (f *fakeController) Resume() { f.paused = false }
+
+func (f *fakeController) SetRate(rate float64) error {
+	if rate <= 0 {
+		return fmt.Errorf("rate must be positive")
+	}
+	f.rate = rate
+	return nil
+}
+
+func (f *fakeController) AddKeyword(keyword string) error {
+	f.keywords = append(f.keywords, keyword)
+	return nil
+}
+
+func (f *fakeController) Health() crawler.Health { return f.health }
+
+func TestHealthEndpoints(t *testing.T) {
+	ctrl := &fakeController{}
+	handler := NewHandler(ctrl, "secret")
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	tests := []struct {
+		status  string
+		healthz int
+		readyz  int
+	}{
+		{crawler.HealthRunning, http.StatusOK, http.StatusOK},
+		{crawler.HealthPaused, http.StatusOK, http.StatusServiceUnavailable},
+		{crawler.HealthDegraded, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		{crawler.HealthFinished, http.StatusOK, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		ctrl.health = crawler.Health{Status: tt.status}
+		if code := get("/healthz"); code != tt.healthz {
+			t.Errorf("%s: /healthz = %d, expected %d", tt.status, code, tt.healthz)
+		}
+		if code := get("/readyz"); code != tt.readyz {
+			t.Errorf("%s: /readyz = %d, expected %d", tt.status, code, tt.readyz)
+		}
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	ctrl := &fakeController{rate: 2, keywords: []string{"测试"}}
+	handler := NewHandler(ctrl, "secret")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status = %d, expected 200", rec.Code)
+	}
+
+	var snapshot crawler.Snapshot
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("Failed to decode snapshot: %v", err)
+	}
+	if snapshot.Rate != 2 || len(snapshot.Keywords) != 1 {
+		t.Errorf("Unexpected snapshot: %+v", snapshot)
+	}
+}
+
+func TestControlEndpoints(t *testing.T) {
+	ctrl := &fakeController{}
+	handler := NewHandler(ctrl, "secret")
+
+	post := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer secret")
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	post("/api/pause", "")
+	if !ctrl.paused {
+		t.Error("Expected controller to be paused")
+	}
+	post("/api/resume", "")
+	if ctrl.paused {
+		t.Error("Expected controller to be resumed")
+	}
+
+	if rec := post("/api/rate", `{"rate": 0.5}`); rec.Code != http.StatusOK || ctrl.rate != 0.5 {
+		t.Errorf("Rate update failed: %d, rate %v", rec.Code, ctrl.rate)
+	}
+	if rec := post("/api/rate", `{"rate": -1}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid rate, got %d", rec.Code)
+	}
+
+	if rec := post("/api/keywords", `{"keyword": "新词"}`); rec.Code != http.StatusOK || len(ctrl.keywords) != 1 {
+		t.Errorf("Keyword addition failed: %d", rec.Code)
+	}
+}
+
+func TestControlEndpoints_RequirePost(t *testing.T) {
+	handler := NewHandler(&fakeController{}, "secret")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/pause", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Status = %d, expected 405", rec.Code)
+	}
+}
+
+func TestControlEndpoints_Guarded(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header map[string]string
+		status int
+	}{
+		{"no token", "secret", nil, http.StatusUnauthorized},
+		{"wrong token", "secret", map[string]string{"Authorization": "Bearer guess"}, http.StatusUnauthorized},
+		{"disabled", "", map[string]string{"Authorization": "Bearer "}, http.StatusForbidden},
+		{"cross origin", "secret", map[string]string{"Authorization": "Bearer secret", "Origin": "http://evil.example"}, http.StatusForbidden},
+		{"cross site", "secret", map[string]string{"Authorization": "Bearer secret", "Sec-Fetch-Site": "cross-site"}, http.StatusForbidden},
+		{"same origin", "secret", map[string]string{"Authorization": "Bearer secret", "Origin": "http://example.com", "Sec-Fetch-Site": "same-origin"}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		ctrl := &fakeController{}
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/pause", nil)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		NewHandler(ctrl, tt.token).ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, expected %d", tt.name, rec.Code, tt.status)
+		}
+		if ctrl.paused != (tt.status == http.StatusOK) {
+			t.Errorf("%s: paused = %v", tt.name, ctrl.paused)
+		}
+	}
+}
+
+func TestIndexPage(t *testing.T) {
+	handler := NewHandler(&fakeController{}, "secret")
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "BiliClaw") {
+		t.Errorf("Index page not served: %d", rec.Code)
+	}
+}